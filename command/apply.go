@@ -3,6 +3,7 @@ package command
 import (
 	"bytes"
 	"fmt"
+	"log"
 	"os"
 	"sort"
 	"strings"
@@ -27,6 +28,7 @@ type ApplyCommand struct {
 
 func (c *ApplyCommand) Run(args []string) int {
 	var destroyForce, refresh bool
+	var queueOutPath string
 	args = c.Meta.process(args, true)
 
 	cmdName := "apply"
@@ -42,6 +44,9 @@ func (c *ApplyCommand) Run(args []string) int {
 	cmdFlags.StringVar(&c.Meta.statePath, "state", DefaultStateFilename, "path")
 	cmdFlags.StringVar(&c.Meta.stateOutPath, "state-out", "", "path")
 	cmdFlags.StringVar(&c.Meta.backupPath, "backup", "", "path")
+	if !c.Destroy {
+		cmdFlags.StringVar(&queueOutPath, "queue-out", "", "path")
+	}
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -200,6 +205,27 @@ func (c *ApplyCommand) Run(args []string) int {
 		}
 	}
 
+	// Save the changes that were queued until their change window opens
+	if queueOutPath != "" && applyErr == nil {
+		if queued := ctx.QueuedPlan(); queued != nil {
+			log.Printf("[INFO] Writing queued plan to: %s", queueOutPath)
+			f, err := os.Create(queueOutPath)
+			if err == nil {
+				defer f.Close()
+				err = terraform.WritePlan(queued, f)
+			}
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error writing queued plan file: %s", err))
+				return 1
+			}
+
+			c.Ui.Output(fmt.Sprintf(
+				"Some changes are outside of their change window and were\n"+
+					"queued. To apply them once the window opens, run:\n\n"+
+					"    terraform apply %s", queueOutPath))
+		}
+	}
+
 	if applyErr != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Error applying plan:\n\n"+
@@ -278,6 +304,10 @@ Options:
 
   -no-color              If specified, output won't contain any color.
 
+  -queue-out=path        Path to save the changes that were queued because
+                         they're outside of the change window of their
+                         resource. Apply this plan once the window opens.
+
   -refresh=true          Update state prior to checking for differences. This
                          has no effect if a plan file is given to apply.
 
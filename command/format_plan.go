@@ -142,6 +142,9 @@ func formatPlanModuleExpand(
 				v,
 				newResource))
 		}
+		if rdiff.Provision {
+			buf.WriteString("    (provisioners triggered)\n")
+		}
 
 		// Write the reset color so we don't overload the user's terminal
 		buf.WriteString(opts.Color.Color("[reset]\n"))
@@ -188,6 +188,17 @@ func (h *UiHook) ProvisionOutput(
 	h.ui.Output(strings.TrimSpace(buf.String()))
 }
 
+func (h *UiHook) ProvisionFailed(
+	n *terraform.InstanceInfo,
+	provId string,
+	err error) (terraform.HookAction, error) {
+	id := n.HumanId()
+	h.ui.Output(h.Colorize.Color(fmt.Sprintf(
+		"[reset][yellow]%s: Provisioner '%s' failed, continuing: %s",
+		id, provId, err)))
+	return terraform.HookActionContinue, nil
+}
+
 func (h *UiHook) PreRefresh(
 	n *terraform.InstanceInfo,
 	s *terraform.InstanceState) (terraform.HookAction, error) {
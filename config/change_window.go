@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChangeWindow is the daily window of time, in UTC, that changes to a
+// resource may be applied in. See ResourceLifecycle.ChangeWindow.
+//
+// A window whose end is before its start spans midnight, so "22:00-02:00"
+// is open from 22:00 until 02:00 the next day.
+type ChangeWindow struct {
+	// Start and End are the offsets from midnight that the window opens
+	// and closes at.
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseChangeWindow parses a change window in the "HH:MM-HH:MM" format.
+func ParseChangeWindow(s string) (*ChangeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf(
+			"change window %q must be in the HH:MM-HH:MM format", s)
+	}
+
+	var result ChangeWindow
+	for i, p := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf(
+				"change window %q must be in the HH:MM-HH:MM format", s)
+		}
+
+		d := time.Duration(t.Hour())*time.Hour +
+			time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			result.Start = d
+		} else {
+			result.End = d
+		}
+	}
+
+	if result.Start == result.End {
+		return nil, fmt.Errorf("change window %q can't be empty", s)
+	}
+
+	return &result, nil
+}
+
+// Contains returns true if the window is open at the given time.
+func (w *ChangeWindow) Contains(t time.Time) bool {
+	d := w.offset(t)
+	if w.Start < w.End {
+		return d >= w.Start && d < w.End
+	}
+
+	return d >= w.Start || d < w.End
+}
+
+// Next returns the next time at or after the given time that the window
+// opens at.
+func (w *ChangeWindow) Next(t time.Time) time.Time {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	next := midnight.Add(w.Start)
+	if next.Before(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+func (w *ChangeWindow) String() string {
+	return fmt.Sprintf("%s-%s", w.clock(w.Start), w.clock(w.End))
+}
+
+func (w *ChangeWindow) offset(t time.Time) time.Duration {
+	t = t.UTC()
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+func (w *ChangeWindow) clock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
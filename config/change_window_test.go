@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseChangeWindow(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Result string
+		Err    bool
+	}{
+		{"02:00-04:00", "02:00-04:00", false},
+		{"22:30 - 01:15", "22:30-01:15", false},
+		{"02:00", "", true},
+		{"2am-4am", "", true},
+		{"02:00-02:00", "", true},
+		{"02:00-25:00", "", true},
+	}
+
+	for _, tc := range cases {
+		w, err := ParseChangeWindow(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: err: %s", tc.Input, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if w.String() != tc.Result {
+			t.Fatalf("%q: bad: %s", tc.Input, w)
+		}
+	}
+}
+
+func TestChangeWindow(t *testing.T) {
+	day := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time {
+		return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+	}
+
+	cases := []struct {
+		Window   string
+		Time     time.Time
+		Contains bool
+		Next     time.Time
+	}{
+		{"02:00-04:00", at(1, 59), false, at(2, 0)},
+		{"02:00-04:00", at(2, 0), true, at(2, 0)},
+		{"02:00-04:00", at(3, 59), true, at(26, 0)},
+		{"02:00-04:00", at(4, 0), false, at(26, 0)},
+		{"22:00-02:00", at(23, 0), true, at(46, 0)},
+		{"22:00-02:00", at(1, 0), true, at(22, 0)},
+		{"22:00-02:00", at(12, 0), false, at(22, 0)},
+	}
+
+	for _, tc := range cases {
+		w, err := ParseChangeWindow(tc.Window)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if actual := w.Contains(tc.Time); actual != tc.Contains {
+			t.Fatalf("%s at %s: bad contains: %v", tc.Window, tc.Time, actual)
+		}
+		if actual := w.Next(tc.Time); !actual.Equal(tc.Next) {
+			t.Fatalf("%s at %s: bad next: %s", tc.Window, tc.Time, actual)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/config/lang"
 	"github.com/hashicorp/terraform/config/lang/ast"
@@ -29,6 +30,7 @@ type Config struct {
 	Dir string
 
 	Atlas           *AtlasConfig
+	Terraform       *TerraformConfig
 	Modules         []*Module
 	ProviderConfigs []*ProviderConfig
 	Resources       []*Resource
@@ -47,6 +49,18 @@ type AtlasConfig struct {
 	Exclude []string
 }
 
+// TerraformConfig is the configuration of Terraform itself, in the
+// "terraform" block.
+type TerraformConfig struct {
+	// RequiredVersion is the version constraint that the version of
+	// Terraform must meet to use this configuration, such as ">= 0.6.0".
+	RequiredVersion string `hcl:"required_version"`
+
+	// Stages are the names of the lifecycle stages of the resources, in
+	// the order they are applied. See ResourceLifecycle.Stage.
+	Stages []string `hcl:"stages"`
+}
+
 // Module is a module used within a configuration.
 //
 // This does not represent a module itself, this represents a module
@@ -54,6 +68,7 @@ type AtlasConfig struct {
 type Module struct {
 	Name      string
 	Source    string
+	RawCount  *RawConfig
 	RawConfig *RawConfig
 }
 
@@ -79,13 +94,110 @@ type Resource struct {
 	Provider     string
 	DependsOn    []string
 	Lifecycle    ResourceLifecycle
+
+	// SoftDependsOn are the resources that this resource is ordered
+	// after, like DependsOn, but that it doesn't depend on succeeding.
+	// If one of them fails, this resource is still applied.
+	SoftDependsOn []string
+
+	// Timeouts are how long the apply of this resource may take.
+	Timeouts ResourceTimeouts
+
+	// Mode is whether this is a managed resource or a data source.
+	Mode ResourceMode
+}
+
+// ResourceMode is the kind of a resource in the configuration.
+type ResourceMode int
+
+const (
+	// ManagedResourceMode is a resource that is created, updated and
+	// destroyed by Terraform, declared in a "resource" block.
+	ManagedResourceMode ResourceMode = iota
+
+	// DataResourceMode is a data source, declared in a "data" block. It
+	// is only ever read, during refresh and plan, so that its attributes
+	// can be interpolated into other resources.
+	DataResourceMode
+)
+
+// ResourceTimeouts are how long the create, update and delete of a
+// resource may take before they're cancelled, such as "30m". An empty
+// timeout is no limit.
+type ResourceTimeouts struct {
+	Create string `mapstructure:"create"`
+	Update string `mapstructure:"update"`
+	Delete string `mapstructure:"delete"`
 }
 
 // ResourceLifecycle is used to store the lifecycle tuning parameters
 // to allow customized behavior
 type ResourceLifecycle struct {
-	CreateBeforeDestroy bool `mapstructure:"create_before_destroy"`
-	PreventDestroy      bool `mapstructure:"prevent_destroy"`
+	CreateBeforeDestroy bool   `mapstructure:"create_before_destroy"`
+	PreventDestroy      bool   `mapstructure:"prevent_destroy"`
+	Stage               string `mapstructure:"stage"`
+	Canary              bool   `mapstructure:"canary"`
+	CanaryIndex         int    `mapstructure:"canary_index"`
+	ZeroDowntime        bool   `mapstructure:"zero_downtime"`
+
+	// ReplaceTriggeredBy are the resources that, when they change, cause
+	// this resource to be replaced even if its own config didn't change.
+	ReplaceTriggeredBy []string `mapstructure:"replace_triggered_by"`
+
+	// IgnoreChanges are the attributes of the resource whose changes are
+	// left out of the plan, such as changes made outside of Terraform.
+	// A key also matches the elements of a list or map, so "tags" matches
+	// "tags.#" and "tags.Name". The key "*" matches every attribute.
+	IgnoreChanges []string `mapstructure:"ignore_changes"`
+
+	// LazyReferences are resources that this resource references, but
+	// doesn't depend on. Their attributes are resolved during the apply
+	// once their state is written instead, and are unknown when planning
+	// if they change. This breaks cycles that only exist because of the
+	// order of the graph, such as with create_before_destroy. They can't
+	// be referenced by the count.
+	LazyReferences []string `mapstructure:"lazy_references"`
+
+	// PauseAfter is the message for the operator if the apply should
+	// pause after this resource is created or updated, until the
+	// operator continues it.
+	PauseAfter string `mapstructure:"pause_after"`
+
+	// ExpectNoChange makes a plan fail if it has any change at all for
+	// this resource, for resources that must stay exactly as they are.
+	ExpectNoChange bool `mapstructure:"expect_no_change"`
+
+	// ChangeWindow is the daily window, in UTC, that changes to this
+	// resource may be applied in, such as "02:00-04:00". Changes outside
+	// of it are queued until it opens, and so are the changes of the
+	// resources that depend on them. See ChangeWindow.
+	ChangeWindow string `mapstructure:"change_window"`
+
+	// RolloutPercent, if set, applies the instances of a resource with a
+	// count in waves of this percentage of the count, rounded up. Each
+	// wave starts only once the wave before it succeeded.
+	RolloutPercent int `mapstructure:"rollout_percent"`
+
+	// RolloutPause is the message for the operator if the apply should
+	// pause between the waves of a rollout, such as to verify them.
+	RolloutPause string `mapstructure:"rollout_pause"`
+
+	// Parallelism, if set, is the most instances of a resource with a
+	// count that are applied at once, such as for an API with a rate
+	// limit. It limits only this resource, on top of the parallelism of
+	// the walk.
+	Parallelism int `mapstructure:"parallelism"`
+
+	// ReverseDestroy destroys the instances of a resource with a count
+	// one at a time from the highest index down, so that the instance
+	// with index zero is destroyed last, such as for a cluster leader.
+	ReverseDestroy bool `mapstructure:"reverse_destroy"`
+
+	// PrerequisiteChecks are the names of the prerequisite checks, such as
+	// that a DNS zone is delegated, that must pass before this resource is
+	// created or updated. The checks are registered with the context that
+	// applies the configuration.
+	PrerequisiteChecks []string `mapstructure:"prerequisite_checks"`
 }
 
 // Provisioner is a configured provisioner step on a resource.
@@ -93,6 +205,92 @@ type Provisioner struct {
 	Type      string
 	RawConfig *RawConfig
 	ConnInfo  *RawConfig
+
+	// Triggers are values that make the provisioner run again on an
+	// existing resource whenever any of them changes. Without triggers,
+	// a provisioner only runs when the resource is created.
+	Triggers *RawConfig
+
+	// When is when the provisioner runs, ProvisionerWhenCreate by default,
+	// ProvisionerWhenDestroy or ProvisionerWhenMigrate.
+	When string
+
+	// OnFailure is what happens when the provisioner fails. With
+	// ProvisionerOnFailureFail, the default, the apply of the resource
+	// fails: a created resource is tainted, and a resource is not
+	// destroyed. With ProvisionerOnFailureContinue, the failure is only
+	// logged.
+	OnFailure string
+
+	// Retry, if set, retries the provisioner when it fails. Provisioners
+	// aren't retried by default, since running one again after it failed
+	// part way through isn't safe for every provisioner.
+	Retry *ProvisionerRetry
+
+	// Teardown is the provisioner that undoes this one, if any. If a
+	// later provisioner of the resource fails, the teardowns of the
+	// provisioners that succeeded run in reverse order, so the resource
+	// isn't left half provisioned.
+	Teardown *Provisioner
+}
+
+const (
+	// ProvisionerWhenCreate provisioners run when the resource is created.
+	ProvisionerWhenCreate = "create"
+
+	// ProvisionerWhenDestroy provisioners run before the resource is
+	// destroyed, such as to drain it.
+	ProvisionerWhenDestroy = "destroy"
+
+	// ProvisionerWhenMigrate provisioners run on the new instance of a
+	// resource that is replaced with create_before_destroy, to move the
+	// data of the old instance before it is destroyed.
+	ProvisionerWhenMigrate = "migrate"
+
+	// ProvisionerOnFailureFail fails the apply of the resource if the
+	// provisioner fails. It is the default.
+	ProvisionerOnFailureFail = "fail"
+
+	// ProvisionerOnFailureContinue carries on with the apply of the
+	// resource if the provisioner fails.
+	ProvisionerOnFailureContinue = "continue"
+)
+
+// ProvisionerRetry is the retry config of a provisioner.
+type ProvisionerRetry struct {
+	// MaxAttempts is how many times the provisioner runs before it fails,
+	// including the first time.
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// Delay is the time to wait before the first retry, such as "5s".
+	Delay string `mapstructure:"delay"`
+
+	// Backoff multiplies the delay after each retry. It defaults to 1,
+	// which keeps the delay the same.
+	Backoff float64 `mapstructure:"backoff"`
+}
+
+// DelayDuration returns the delay before the retry that follows the given
+// attempt, starting at 1, with the backoff applied.
+func (r *ProvisionerRetry) DelayDuration(attempt int) (time.Duration, error) {
+	var d time.Duration
+	if r.Delay != "" {
+		var err error
+		d, err = time.ParseDuration(r.Delay)
+		if err != nil {
+			return 0, fmt.Errorf("delay: %s", err)
+		}
+	}
+
+	backoff := r.Backoff
+	if backoff == 0 {
+		backoff = 1
+	}
+	for i := 1; i < attempt; i++ {
+		d = time.Duration(float64(d) * backoff)
+	}
+
+	return d, nil
 }
 
 // Variable is a variable defined within the configuration.
@@ -139,6 +337,47 @@ func (r *Module) Id() string {
 	return fmt.Sprintf("%s", r.Name)
 }
 
+// CountAsVariable gives the count of this module the meaning it had
+// before modules had a count: it is passed to the module as the variable
+// named count, and the module isn't expanded. This is for the modules
+// that declare a variable named count, which would otherwise change
+// meaning.
+func (r *Module) CountAsVariable() error {
+	if r.RawCount == nil {
+		return nil
+	}
+
+	raw := make(map[string]interface{}, len(r.RawConfig.Raw)+1)
+	for k, v := range r.RawConfig.Raw {
+		raw[k] = v
+	}
+	raw["count"] = r.RawCount.Raw["count"]
+
+	rc, err := NewRawConfig(raw)
+	if err != nil {
+		return err
+	}
+
+	r.RawConfig = rc
+	r.RawCount = nil
+	return nil
+}
+
+// Count returns the count of this module. A module without a count
+// has a count of one.
+func (r *Module) Count() (int, error) {
+	if r.RawCount == nil {
+		return 1, nil
+	}
+
+	v, err := strconv.ParseInt(r.RawCount.Value().(string), 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(v), nil
+}
+
 // Count returns the count of this resource.
 func (r *Resource) Count() (int, error) {
 	v, err := strconv.ParseInt(r.RawCount.Value().(string), 0, 0)
@@ -151,6 +390,10 @@ func (r *Resource) Count() (int, error) {
 
 // A unique identifier for this resource.
 func (r *Resource) Id() string {
+	if r.Mode == DataResourceMode {
+		return fmt.Sprintf("data.%s.%s", r.Type, r.Name)
+	}
+
 	return fmt.Sprintf("%s.%s", r.Type, r.Name)
 }
 
@@ -287,6 +530,43 @@ func (c *Config) Validate() error {
 				m.Id()))
 		}
 
+		// The modules are expanded before the resources are walked, so
+		// the count can only reference variables, which are known by
+		// then. It is verified to be a number with a fixed value for
+		// them, like the count of a resource.
+		if m.RawCount != nil {
+			onlyVars := true
+			for _, v := range m.RawCount.Variables {
+				if _, ok := v.(*UserVariable); !ok {
+					onlyVars = false
+				}
+			}
+
+			if !onlyVars {
+				errs = append(errs, fmt.Errorf(
+					"%s: module count can only reference variables",
+					m.Id()))
+			} else {
+				m.RawCount.interpolate(func(root ast.Node) (string, error) {
+					out, _, err := lang.Eval(
+						lang.FixedValueTransform(
+							root, &ast.LiteralNode{Value: "5", Typex: ast.TypeString}),
+						nil)
+					if err != nil {
+						return "", err
+					}
+
+					return out.(string), nil
+				})
+				if count, err := m.Count(); err != nil || count < 0 {
+					errs = append(errs, fmt.Errorf(
+						"%s: module count must be a non-negative integer",
+						m.Id()))
+				}
+				m.RawCount.init()
+			}
+		}
+
 		// Check that the name matches our regexp
 		if !NameRegexp.Match([]byte(m.Name)) {
 			errs = append(errs, fmt.Errorf(
@@ -311,8 +591,11 @@ func (c *Config) Validate() error {
 		for _, v := range m.RawConfig.Variables {
 			switch v.(type) {
 			case *CountVariable:
-				errs = append(errs, fmt.Errorf(
-					"%s: count variables are only valid within resources", m.Name))
+				if m.RawCount == nil || m.RawCount.Value() == "1" {
+					errs = append(errs, fmt.Errorf(
+						"%s: count variables are only valid within resources "+
+							"and modules with a count", m.Name))
+				}
 			case *SelfVariable:
 				errs = append(errs, fmt.Errorf(
 					"%s: self variables are only valid within resources", m.Name))
@@ -338,11 +621,23 @@ func (c *Config) Validate() error {
 				continue
 			}
 
-			if _, ok := modules[mv.Name]; !ok {
+			m, ok := modules[mv.Name]
+			if !ok {
 				errs = append(errs, fmt.Errorf(
 					"%s: unknown module referenced: %s",
 					source,
 					mv.Name))
+				continue
+			}
+
+			// The instances of a module with a count each have their
+			// own outputs, which can't be told apart by a reference.
+			if m.RawCount != nil && m.RawCount.Value() != "1" {
+				errs = append(errs, fmt.Errorf(
+					"%s: can't reference the outputs of module %s, "+
+						"since it has a count",
+					source,
+					mv.Name))
 			}
 		}
 	}
@@ -375,18 +670,10 @@ func (c *Config) Validate() error {
 					"%s: resource count can't reference count variable: %s",
 					n,
 					v.FullKey()))
-			case *ModuleVariable:
-				errs = append(errs, fmt.Errorf(
-					"%s: resource count can't reference module variable: %s",
-					n,
-					v.FullKey()))
-			case *ResourceVariable:
-				errs = append(errs, fmt.Errorf(
-					"%s: resource count can't reference resource variable: %s",
-					n,
-					v.FullKey()))
-			case *UserVariable:
-				// Good
+			case *ModuleVariable, *ResourceVariable, *UserVariable:
+				// Good. Module outputs and resource attributes are
+				// interpolated when the resource is walked, so they
+				// must be known by plan time.
 			default:
 				panic("Unknown type in count var: " + n)
 			}
@@ -434,6 +721,91 @@ func (c *Config) Validate() error {
 			}
 		}
 
+		for _, d := range r.SoftDependsOn {
+			if _, ok := resources[d]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: resource soft depends on non-existent resource '%s'",
+					n, d))
+			}
+		}
+
+		for _, d := range r.Lifecycle.ReplaceTriggeredBy {
+			if _, ok := resources[d]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: replace_triggered_by references non-existent resource '%s'",
+					n, d))
+			}
+		}
+
+		for _, d := range r.Lifecycle.LazyReferences {
+			if _, ok := resources[d]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: lazy_references references non-existent resource '%s'",
+					n, d))
+				continue
+			}
+
+			// The count must be known when planning
+			for _, v := range r.RawCount.Variables {
+				if rv, ok := v.(*ResourceVariable); ok && rv.ResourceId() == d {
+					errs = append(errs, fmt.Errorf(
+						"%s: count can't reference '%s', which is in lazy_references",
+						n, d))
+					break
+				}
+			}
+		}
+
+		// Zero-downtime resources must be replaced by creating the new
+		// resource before destroying the old one.
+		if r.Lifecycle.ZeroDowntime && !r.Lifecycle.CreateBeforeDestroy {
+			errs = append(errs, fmt.Errorf(
+				"%s: resource is designated zero-downtime and must set "+
+					"create_before_destroy = true in its lifecycle", n))
+		}
+
+		if r.Lifecycle.ChangeWindow != "" {
+			if _, err := ParseChangeWindow(r.Lifecycle.ChangeWindow); err != nil {
+				errs = append(errs, fmt.Errorf(
+					"%s: lifecycle.change_window: %s", n, err))
+			}
+		}
+
+		if r.Lifecycle.RolloutPercent < 0 || r.Lifecycle.RolloutPercent > 100 {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle.rollout_percent must be between 1 and 100, got %d",
+				n, r.Lifecycle.RolloutPercent))
+		}
+
+		if r.Lifecycle.Parallelism < 0 {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle.parallelism can't be negative, got %d",
+				n, r.Lifecycle.Parallelism))
+		}
+
+		timeouts := map[string]string{
+			"create": r.Timeouts.Create,
+			"update": r.Timeouts.Update,
+			"delete": r.Timeouts.Delete,
+		}
+		for _, k := range []string{"create", "update", "delete"} {
+			v := timeouts[k]
+			if v == "" {
+				continue
+			}
+
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(
+					"%s: timeouts.%s: %s", n, k, err))
+				continue
+			}
+			if d <= 0 {
+				errs = append(errs, fmt.Errorf(
+					"%s: timeouts.%s must be positive, got %s", n, k, v))
+			}
+		}
+
 		// Verify provider points to a provider that is configured
 		if r.Provider != "" {
 			if _, ok := providerSet[r.Provider]; !ok {
@@ -443,6 +815,69 @@ func (c *Config) Validate() error {
 			}
 		}
 
+		// Data sources are only read, so there is nothing to provision
+		// and they are never replaced or destroyed.
+		if r.Mode == DataResourceMode {
+			if len(r.Provisioners) > 0 {
+				errs = append(errs, fmt.Errorf(
+					"%s: data sources can't have provisioners", n))
+			}
+			if r.Lifecycle.CreateBeforeDestroy || r.Lifecycle.PreventDestroy {
+				errs = append(errs, fmt.Errorf(
+					"%s: data sources can't set create_before_destroy "+
+						"or prevent_destroy", n))
+			}
+		}
+
+		// Verify the settings of the provisioners
+		for _, p := range r.Provisioners {
+			switch p.When {
+			case "", ProvisionerWhenCreate, ProvisionerWhenDestroy:
+			case ProvisionerWhenMigrate:
+				if !r.Lifecycle.CreateBeforeDestroy {
+					errs = append(errs, fmt.Errorf(
+						"%s: provisioner %s: when = %q requires "+
+							"create_before_destroy, since the old instance "+
+							"must still exist to migrate from it",
+						n, p.Type, ProvisionerWhenMigrate))
+				}
+			default:
+				errs = append(errs, fmt.Errorf(
+					"%s: provisioner %s: when must be %q, %q or %q, got %q",
+					n, p.Type, ProvisionerWhenCreate, ProvisionerWhenDestroy,
+					ProvisionerWhenMigrate, p.When))
+			}
+			switch p.OnFailure {
+			case "", ProvisionerOnFailureFail, ProvisionerOnFailureContinue:
+			default:
+				errs = append(errs, fmt.Errorf(
+					"%s: provisioner %s: on_failure must be %q or %q, got %q",
+					n, p.Type, ProvisionerOnFailureFail,
+					ProvisionerOnFailureContinue, p.OnFailure))
+			}
+
+			for _, prov := range []*Provisioner{p, p.Teardown} {
+				if prov == nil || prov.Retry == nil {
+					continue
+				}
+
+				if prov.Retry.MaxAttempts < 1 {
+					errs = append(errs, fmt.Errorf(
+						"%s: provisioner %s: retry max_attempts must be at least 1, got %d",
+						n, prov.Type, prov.Retry.MaxAttempts))
+				}
+				if prov.Retry.Backoff != 0 && prov.Retry.Backoff < 1 {
+					errs = append(errs, fmt.Errorf(
+						"%s: provisioner %s: retry backoff must be at least 1, got %g",
+						n, prov.Type, prov.Retry.Backoff))
+				}
+				if _, err := prov.Retry.DelayDuration(1); err != nil {
+					errs = append(errs, fmt.Errorf(
+						"%s: provisioner %s: retry %s", n, prov.Type, err))
+				}
+			}
+		}
+
 		// Verify provisioners don't contain any splats
 		for _, p := range r.Provisioners {
 			// This validation checks that there are now splat variables
@@ -485,8 +920,9 @@ func (c *Config) Validate() error {
 				continue
 			}
 
-			id := fmt.Sprintf("%s.%s", rv.Type, rv.Name)
-			if _, ok := resources[id]; !ok {
+			id := rv.ResourceId()
+			r, ok := resources[id]
+			if !ok {
 				errs = append(errs, fmt.Errorf(
 					"%s: unknown resource '%s' referenced in variable %s",
 					source,
@@ -494,6 +930,22 @@ func (c *Config) Validate() error {
 					rv.FullKey()))
 				continue
 			}
+
+			// If the count is known statically, verify that an indexed
+			// reference is within its bounds.
+			if !rv.Multi || rv.Index == -1 || len(r.RawCount.Variables) > 0 {
+				continue
+			}
+			if count, err := r.Count(); err == nil && rv.Index >= count {
+				errs = append(errs, fmt.Errorf(
+					"%s: index %d out of range for resource '%s' with count %d, "+
+						"referenced in variable %s",
+					source,
+					rv.Index,
+					id,
+					count,
+					rv.FullKey()))
+			}
 		}
 	}
 
@@ -530,7 +982,7 @@ func (c *Config) Validate() error {
 		}
 	}
 
-	// Validate the self variable
+	// Validate the self and secret variables
 	for source, rc := range c.rawConfigs() {
 		// Ignore provisioners. This is a pretty brittle way to do this,
 		// but better than also repeating all the resources.
@@ -539,9 +991,14 @@ func (c *Config) Validate() error {
 		}
 
 		for _, v := range rc.Variables {
-			if _, ok := v.(*SelfVariable); ok {
+			switch v.(type) {
+			case *SelfVariable:
 				errs = append(errs, fmt.Errorf(
 					"%s: cannot contain self-reference %s", source, v.FullKey()))
+			case *SecretVariable:
+				errs = append(errs, fmt.Errorf(
+					"%s: secrets can only be used in provisioners: %s",
+					source, v.FullKey()))
 			}
 		}
 	}
@@ -573,6 +1030,9 @@ func (c *Config) rawConfigs() map[string]*RawConfig {
 	for _, m := range c.Modules {
 		source := fmt.Sprintf("module '%s'", m.Name)
 		result[source] = m.RawConfig
+		if m.RawCount != nil {
+			result[source+" count"] = m.RawCount
+		}
 	}
 
 	for _, pc := range c.ProviderConfigs {
@@ -590,6 +1050,10 @@ func (c *Config) rawConfigs() map[string]*RawConfig {
 				"%s provisioner %s (#%d)",
 				source, p.Type, i+1)
 			result[subsource] = p.RawConfig
+			result[subsource+" triggers"] = p.Triggers
+			if p.Teardown != nil {
+				result[subsource+" teardown"] = p.Teardown.RawConfig
+			}
 		}
 	}
 
@@ -666,6 +1130,10 @@ func (m *Module) mergerMerge(other merger) merger {
 		result.Source = m2.Source
 	}
 
+	if m2.RawCount != nil && m2.RawCount.Value() != "1" {
+		result.RawCount = m2.RawCount
+	}
+
 	return &result
 }
 
@@ -710,7 +1178,7 @@ func (c *ProviderConfig) mergerMerge(m merger) merger {
 }
 
 func (r *Resource) mergerName() string {
-	return fmt.Sprintf("%s.%s", r.Type, r.Name)
+	return r.Id()
 }
 
 func (r *Resource) mergerMerge(m merger) merger {
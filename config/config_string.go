@@ -170,6 +170,17 @@ func providerConfigsStr(pcs []*ProviderConfig) string {
 	return strings.TrimSpace(result)
 }
 
+// resourceStrKey is how a resource is named in resourcesStr, such as
+// "aws_instance[web]", with a "data." prefix for data sources.
+func resourceStrKey(r *Resource) string {
+	k := fmt.Sprintf("%s[%s]", r.Type, r.Name)
+	if r.Mode == DataResourceMode {
+		k = "data." + k
+	}
+
+	return k
+}
+
 // This helper turns a resources field into a deterministic
 // string value for comparison in tests.
 func resourcesStr(rs []*Resource) string {
@@ -178,7 +189,7 @@ func resourcesStr(rs []*Resource) string {
 	ks := make([]string, 0, len(rs))
 	mapping := make(map[string]int)
 	for i, r := range rs {
-		k := fmt.Sprintf("%s[%s]", r.Type, r.Name)
+		k := resourceStrKey(r)
 		ks = append(ks, k)
 		mapping[k] = i
 	}
@@ -190,9 +201,8 @@ func resourcesStr(rs []*Resource) string {
 	for _, i := range order {
 		r := rs[i]
 		result += fmt.Sprintf(
-			"%s[%s] (x%s)\n",
-			r.Type,
-			r.Name,
+			"%s (x%s)\n",
+			resourceStrKey(r),
 			r.RawCount.Value())
 
 		ks := make([]string, 0, len(r.RawConfig.Raw))
@@ -229,6 +239,13 @@ func resourcesStr(rs []*Resource) string {
 			}
 		}
 
+		if len(r.SoftDependsOn) > 0 {
+			result += fmt.Sprintf("  softDependsOn\n")
+			for _, d := range r.SoftDependsOn {
+				result += fmt.Sprintf("    %s\n", d)
+			}
+		}
+
 		if len(r.RawConfig.Variables) > 0 {
 			result += fmt.Sprintf("  vars\n")
 
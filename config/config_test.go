@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // This is the directory where our test fixtures are.
@@ -54,6 +55,62 @@ func TestConfigValidate_badDependsOn(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_badSoftDependsOn(t *testing.T) {
+	c := testConfig(t, "validate-bad-soft-depends-on")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_badChangeWindow(t *testing.T) {
+	c := testConfig(t, "validate-bad-change-window")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_badTimeouts(t *testing.T) {
+	c := testConfig(t, "validate-bad-timeouts")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_badRolloutPercent(t *testing.T) {
+	c := testConfig(t, "validate-bad-rollout-percent")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_badParallelism(t *testing.T) {
+	c := testConfig(t, "validate-bad-parallelism")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_lazyReferences(t *testing.T) {
+	c := testConfig(t, "validate-lazy-references")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_lazyReferencesBad(t *testing.T) {
+	c := testConfig(t, "validate-lazy-references-bad")
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("should not be valid")
+	}
+
+	for _, expected := range []string{"non-existent resource 'aws_instance.nope'", "count can't reference"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("bad: %s", err)
+		}
+	}
+}
+
 func TestConfigValidate_countInt(t *testing.T) {
 	c := testConfig(t, "validate-count-int")
 	if err := c.Validate(); err != nil {
@@ -86,8 +143,8 @@ func TestConfigValidate_countCountVar(t *testing.T) {
 
 func TestConfigValidate_countModuleVar(t *testing.T) {
 	c := testConfig(t, "validate-count-module-var")
-	if err := c.Validate(); err == nil {
-		t.Fatal("should not be valid")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 }
 
@@ -100,8 +157,8 @@ func TestConfigValidate_countNotInt(t *testing.T) {
 
 func TestConfigValidate_countResourceVar(t *testing.T) {
 	c := testConfig(t, "validate-count-resource-var")
-	if err := c.Validate(); err == nil {
-		t.Fatal("should not be valid")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 }
 
@@ -147,6 +204,24 @@ func TestConfigValidate_dupResource(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_dataSourceProvisioner(t *testing.T) {
+	c := testConfig(t, "validate-data-source-provisioner")
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("should not be valid")
+	}
+	if !strings.Contains(err.Error(), "can't have provisioners") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestConfigValidate_dataSourceUnknown(t *testing.T) {
+	c := testConfig(t, "validate-data-source-unknown")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
 func TestConfigValidate_moduleNameBad(t *testing.T) {
 	c := testConfig(t, "validate-module-name-bad")
 	if err := c.Validate(); err == nil {
@@ -154,6 +229,44 @@ func TestConfigValidate_moduleNameBad(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_moduleCount(t *testing.T) {
+	c := testConfig(t, "validate-module-count")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	count, err := c.Modules[0].Count()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if count != 3 {
+		t.Fatalf("bad: %d", count)
+	}
+}
+
+func TestConfigValidate_moduleCountOutput(t *testing.T) {
+	c := testConfig(t, "validate-module-count-output")
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "since it has a count") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestConfigValidate_moduleCountVar(t *testing.T) {
+	c := testConfig(t, "validate-module-count-var")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_moduleCountResource(t *testing.T) {
+	c := testConfig(t, "validate-module-count-resource")
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "count can only reference variables") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
 func TestConfigValidate_moduleSourceVar(t *testing.T) {
 	c := testConfig(t, "validate-module-source-var")
 	if err := c.Validate(); err == nil {
@@ -280,6 +393,20 @@ func TestConfigValidate_resourceVarSelf(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_resourceProvVarSecret(t *testing.T) {
+	c := testConfig(t, "validate-resource-prov-secret")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("should be valid: %s", err)
+	}
+}
+
+func TestConfigValidate_resourceVarSecret(t *testing.T) {
+	c := testConfig(t, "validate-resource-secret")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
 func TestConfigValidate_unknownThing(t *testing.T) {
 	c := testConfig(t, "validate-unknownthing")
 	if err := c.Validate(); err == nil {
@@ -301,6 +428,115 @@ func TestConfigValidate_unknownResourceVar_output(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_unknownResourceVar_index(t *testing.T) {
+	c := testConfig(t, "validate-unknown-resource-var-index")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_zeroDowntime(t *testing.T) {
+	c := testConfig(t, "validate-zero-downtime")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_zeroDowntimeNoCBD(t *testing.T) {
+	c := testConfig(t, "validate-zero-downtime-no-cbd")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_provisionerRetryBad(t *testing.T) {
+	c := testConfig(t, "validate-provisioner-retry-bad")
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("should not be valid")
+	}
+
+	for _, expected := range []string{"max_attempts", "delay"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("bad: %s", err)
+		}
+	}
+}
+
+func TestConfigValidate_provisionerWhenBad(t *testing.T) {
+	c := testConfig(t, "validate-provisioner-when-bad")
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("should not be valid")
+	}
+
+	for _, expected := range []string{`when must be`, `on_failure must be`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("bad: %s", err)
+		}
+	}
+}
+
+func TestConfigValidate_provisionerMigrateCreateBeforeDestroy(t *testing.T) {
+	c := testConfig(t, "validate-provisioner-migrate-cbd")
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("should not be valid")
+	}
+	if !strings.Contains(err.Error(), "requires create_before_destroy") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestProvisionerRetryDelayDuration(t *testing.T) {
+	cases := []struct {
+		Retry    ProvisionerRetry
+		Attempt  int
+		Expected time.Duration
+	}{
+		{ProvisionerRetry{Delay: "2s"}, 1, 2 * time.Second},
+		{ProvisionerRetry{Delay: "2s"}, 3, 2 * time.Second},
+		{ProvisionerRetry{Delay: "2s", Backoff: 2}, 1, 2 * time.Second},
+		{ProvisionerRetry{Delay: "2s", Backoff: 2}, 3, 8 * time.Second},
+		{ProvisionerRetry{}, 2, 0},
+	}
+
+	for i, tc := range cases {
+		actual, err := tc.Retry.DelayDuration(tc.Attempt)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+	}
+}
+
+func TestConfigValidate_replaceTriggeredBy(t *testing.T) {
+	c := testConfig(t, "validate-replace-triggered-by")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual []string
+	for _, r := range c.Resources {
+		if r.Id() == "aws_instance.web" {
+			actual = r.Lifecycle.ReplaceTriggeredBy
+		}
+	}
+	expected := []string{"aws_ami.web"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestConfigValidate_replaceTriggeredByMissing(t *testing.T) {
+	c := testConfig(t, "validate-replace-triggered-by-missing")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
 func TestConfigValidate_unknownVar(t *testing.T) {
 	c := testConfig(t, "validate-unknownvar")
 	if err := c.Validate(); err == nil {
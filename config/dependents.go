@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// VariableDependent is a resource whose configuration depends on the value
+// of a variable. See Config.VariableDependents.
+type VariableDependent struct {
+	Resource *Resource
+
+	// Direct is true if the resource interpolates the variable itself. If
+	// it is false, the resource only depends on the variable through
+	// other resources that it interpolates.
+	Direct bool
+}
+
+// Addresses returns the addresses of the instances of the resource,
+// expanded by its count. If the count isn't known without interpolating
+// it, the address of the resource itself is returned.
+func (d *VariableDependent) Addresses() []string {
+	id := d.Resource.Id()
+	if len(d.Resource.RawCount.Variables) > 0 {
+		return []string{id}
+	}
+
+	count, err := d.Resource.Count()
+	if err != nil || count == 1 {
+		return []string{id}
+	}
+
+	result := make([]string, count)
+	for i := 0; i < count; i++ {
+		result[i] = fmt.Sprintf("%s.%d", id, i)
+	}
+
+	return result
+}
+
+// VariableDependents returns every resource whose configuration, count or
+// provisioners depend on the user variable with the given name, either
+// directly or transitively through the resources they reference. This can be used to
+// see which resources a change to the variable could affect.
+//
+// The result is sorted by the resource ID.
+func (c *Config) VariableDependents(name string) []*VariableDependent {
+	// Find the resources that reference the variable directly, and build
+	// the reverse mapping of what references each resource.
+	direct := make(map[string]bool)
+	referencedBy := make(map[string][]*Resource)
+	resources := make(map[string]*Resource)
+	for _, r := range c.Resources {
+		resources[r.Id()] = r
+
+		configs := []*RawConfig{r.RawConfig, r.RawCount}
+		for _, p := range r.Provisioners {
+			configs = append(configs, p.RawConfig, p.ConnInfo, p.Triggers)
+		}
+
+		for _, rc := range configs {
+			if rc == nil {
+				continue
+			}
+
+			for _, v := range rc.Variables {
+				switch v := v.(type) {
+				case *UserVariable:
+					if v.Name == name {
+						direct[r.Id()] = true
+					}
+				case *ResourceVariable:
+					id := v.ResourceId()
+					referencedBy[id] = append(referencedBy[id], r)
+				}
+			}
+		}
+	}
+
+	// Walk the resources that reference the direct dependents
+	seen := make(map[string]struct{})
+	queue := make([]string, 0, len(direct))
+	for id := range direct {
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		for _, r := range referencedBy[id] {
+			queue = append(queue, r.Id())
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := make([]*VariableDependent, len(ids))
+	for i, id := range ids {
+		result[i] = &VariableDependent{
+			Resource: resources[id],
+			Direct:   direct[id],
+		}
+	}
+
+	return result
+}
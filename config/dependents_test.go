@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigVariableDependents(t *testing.T) {
+	c := testConfig(t, "variable-dependents")
+
+	deps := c.VariableDependents("ami")
+	actual := make(map[string]bool)
+	for _, d := range deps {
+		actual[d.Resource.Id()] = d.Direct
+	}
+
+	expected := map[string]bool{
+		"aws_elb.lb":             false,
+		"aws_instance.bastion":   true,
+		"aws_instance.web":       true,
+		"aws_route53_record.www": false,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if deps[0].Resource.Id() != "aws_elb.lb" {
+		t.Fatalf("should be sorted: %#v", deps)
+	}
+}
+
+func TestConfigVariableDependents_connection(t *testing.T) {
+	c := testConfig(t, "variable-dependents")
+
+	// The worker only depends on the variable through the provisioner
+	// that references the app
+	deps := c.VariableDependents("key")
+	actual := make(map[string]bool)
+	for _, d := range deps {
+		actual[d.Resource.Id()] = d.Direct
+	}
+
+	expected := map[string]bool{
+		"aws_instance.app":    true,
+		"aws_instance.worker": false,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestConfigVariableDependents_none(t *testing.T) {
+	c := testConfig(t, "variable-dependents")
+	if deps := c.VariableDependents("unknown"); len(deps) != 0 {
+		t.Fatalf("bad: %#v", deps)
+	}
+}
+
+func TestVariableDependentAddresses(t *testing.T) {
+	c := testConfig(t, "variable-dependents")
+
+	cases := map[string][]string{
+		"aws_instance.web": []string{"aws_instance.web.0", "aws_instance.web.1"},
+		"aws_instance.db":  []string{"aws_instance.db"},
+	}
+
+	for _, r := range c.Resources {
+		expected, ok := cases[r.Id()]
+		if !ok {
+			continue
+		}
+
+		d := &VariableDependent{Resource: r}
+		if actual := d.Addresses(); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: bad: %#v", r.Id(), actual)
+		}
+	}
+}
@@ -58,9 +58,10 @@ const (
 // A ResourceVariable is a variable that is referencing the field
 // of a resource, such as "${aws_instance.foo.ami}"
 type ResourceVariable struct {
-	Type  string // Resource type, i.e. "aws_instance"
-	Name  string // Resource name
-	Field string // Resource field
+	Mode  ResourceMode // Data sources are "data.TYPE.NAME.FIELD"
+	Type  string       // Resource type, i.e. "aws_instance"
+	Name  string       // Resource name
+	Field string       // Resource field
 
 	Multi bool // True if multi-variable: aws_instance.foo.*.id
 	Index int  // Index for multi-variable: aws_instance.foo.1.id == 1
@@ -68,6 +69,14 @@ type ResourceVariable struct {
 	key string
 }
 
+// SecretVariable is a variable that is referencing a secret that the
+// provider reads for the provisioners of a resource: "${secret.password}"
+type SecretVariable struct {
+	Name string
+
+	key string
+}
+
 // SelfVariable is a variable that is referencing the same resource
 // it is running on: "${self.address}"
 type SelfVariable struct {
@@ -91,6 +100,8 @@ func NewInterpolatedVariable(v string) (InterpolatedVariable, error) {
 		return NewCountVariable(v)
 	} else if strings.HasPrefix(v, "path.") {
 		return NewPathVariable(v)
+	} else if strings.HasPrefix(v, "secret.") {
+		return NewSecretVariable(v)
 	} else if strings.HasPrefix(v, "self.") {
 		return NewSelfVariable(v)
 	} else if strings.HasPrefix(v, "var.") {
@@ -162,7 +173,12 @@ func (v *PathVariable) FullKey() string {
 }
 
 func NewResourceVariable(key string) (*ResourceVariable, error) {
+	mode := ManagedResourceMode
 	parts := strings.SplitN(key, ".", 3)
+	if strings.HasPrefix(key, "data.") {
+		mode = DataResourceMode
+		parts = strings.SplitN(key[len("data."):], ".", 3)
+	}
 	if len(parts) < 3 {
 		return nil, fmt.Errorf(
 			"%s: resource variables must be three parts: type.name.attr",
@@ -192,6 +208,7 @@ func NewResourceVariable(key string) (*ResourceVariable, error) {
 	}
 
 	return &ResourceVariable{
+		Mode:  mode,
 		Type:  parts[0],
 		Name:  parts[1],
 		Field: field,
@@ -202,6 +219,10 @@ func NewResourceVariable(key string) (*ResourceVariable, error) {
 }
 
 func (v *ResourceVariable) ResourceId() string {
+	if v.Mode == DataResourceMode {
+		return fmt.Sprintf("data.%s.%s", v.Type, v.Name)
+	}
+
 	return fmt.Sprintf("%s.%s", v.Type, v.Name)
 }
 
@@ -209,6 +230,27 @@ func (v *ResourceVariable) FullKey() string {
 	return v.key
 }
 
+func NewSecretVariable(key string) (*SecretVariable, error) {
+	name := key[len("secret."):]
+	if name == "" {
+		return nil, fmt.Errorf("%s: secret variables must have a name", key)
+	}
+
+	return &SecretVariable{
+		Name: name,
+
+		key: key,
+	}, nil
+}
+
+func (v *SecretVariable) FullKey() string {
+	return v.key
+}
+
+func (v *SecretVariable) GoString() string {
+	return fmt.Sprintf("*%#v", *v)
+}
+
 func NewSelfVariable(key string) (*SelfVariable, error) {
 	field := key[len("self."):]
 
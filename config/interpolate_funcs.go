@@ -2,6 +2,8 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +11,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/config/lang/ast"
 	"github.com/mitchellh/go-homedir"
@@ -392,3 +395,62 @@ func interpolationFuncValues(vs map[string]ast.Variable) ast.Function {
 		},
 	}
 }
+
+// TimestampVariable is the name of the variable that, if it is set, is
+// the value returned by the "timestamp" function. This lets the timestamp
+// be fixed for a whole run. It isn't a valid variable name, so it can't be
+// referenced directly in the configuration.
+const TimestampVariable = "~timestamp"
+
+// interpolationFuncTimestamp implements the "timestamp" function that
+// returns the current time in RFC 3339 format, or the fixed value of
+// TimestampVariable if it is set.
+func interpolationFuncTimestamp(vs map[string]ast.Variable) ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			if v, ok := vs[TimestampVariable]; ok {
+				return v.Value.(string), nil
+			}
+
+			return time.Now().UTC().Format(time.RFC3339), nil
+		},
+	}
+}
+
+// RandomSeedVariable is the name of the variable that seeds the "random"
+// function, such as with the address of the resource being interpolated.
+// Like TimestampVariable, it can't be referenced in the configuration.
+const RandomSeedVariable = "~random_seed"
+
+// interpolationFuncRandom implements the "random" function that returns
+// an integer between min and max, inclusive. The integer is derived from
+// RandomSeedVariable and the arguments rather than truly random, so that
+// the same resource gets the same value on every run, while different
+// resources get different values.
+func interpolationFuncRandom(vs map[string]ast.Variable) ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeInt, ast.TypeInt},
+		ReturnType: ast.TypeInt,
+		Callback: func(args []interface{}) (interface{}, error) {
+			min := args[0].(int)
+			max := args[1].(int)
+			if max < min {
+				return nil, fmt.Errorf(
+					"random(): max %d is less than min %d", max, min)
+			}
+
+			v, ok := vs[RandomSeedVariable]
+			if !ok {
+				return nil, errors.New(
+					"random() can only be used in the configuration of a resource")
+			}
+
+			sum := sha256.Sum256([]byte(
+				fmt.Sprintf("%s|%d|%d", v.Value.(string), min, max)))
+			n := binary.BigEndian.Uint64(sum[:8])
+			return min + int(n%uint64(max-min+1)), nil
+		},
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform/config/lang"
 	"github.com/hashicorp/terraform/config/lang/ast"
@@ -584,6 +585,114 @@ func TestInterpolateFuncElement(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncTimestamp(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			TimestampVariable: ast.Variable{
+				Value: "2015-07-01T12:00:00Z",
+				Type:  ast.TypeString,
+			},
+		},
+		Cases: []testFunctionCase{
+			{
+				`${timestamp()}`,
+				"2015-07-01T12:00:00Z",
+				false,
+			},
+
+			// Too many args
+			{
+				`${timestamp("foo")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncTimestamp_unset(t *testing.T) {
+	ast, err := lang.Parse(`${timestamp()}`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	out, _, err := lang.Eval(ast, langEvalConfig(nil))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := time.Parse(time.RFC3339, out.(string)); err != nil {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestInterpolateFuncRandom(t *testing.T) {
+	seed := func(s string) map[string]ast.Variable {
+		return map[string]ast.Variable{
+			RandomSeedVariable: ast.Variable{
+				Value: s,
+				Type:  ast.TypeString,
+			},
+		}
+	}
+
+	eval := func(input string, vs map[string]ast.Variable) (string, error) {
+		ast, err := lang.Parse(input)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		out, _, err := lang.Eval(ast, langEvalConfig(vs))
+		if err != nil {
+			return "", err
+		}
+
+		return out.(string), nil
+	}
+
+	// The same seed always gets the same value
+	first, err := eval(`${random(1, 1000000)}`, seed("aws_instance.foo"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := 0; i < 5; i++ {
+		actual, err := eval(`${random(1, 1000000)}`, seed("aws_instance.foo"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != first {
+			t.Fatalf("bad: %s != %s", actual, first)
+		}
+	}
+
+	// A different seed gets a different value
+	other, err := eval(`${random(1, 1000000)}`, seed("aws_instance.bar"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if other == first {
+		t.Fatalf("bad: %s", other)
+	}
+
+	// The value is within the range
+	actual, err := eval(`${random(5, 5)}`, seed("aws_instance.foo"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "5" {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	// Bad range
+	if _, err := eval(`${random(5, 1)}`, seed("aws_instance.foo")); err == nil {
+		t.Fatal("should error")
+	}
+
+	// Not in a resource
+	if _, err := eval(`${random(1, 5)}`, nil); err == nil {
+		t.Fatal("should error")
+	}
+}
+
 type testFunctionConfig struct {
 	Cases []testFunctionCase
 	Vars  map[string]ast.Variable
@@ -62,6 +62,14 @@ func TestNewInterpolatedVariable(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"secret.password",
+			&SecretVariable{
+				Name: "password",
+				key:  "secret.password",
+			},
+			false,
+		},
 	}
 
 	for i, tc := range cases {
@@ -99,6 +107,29 @@ func TestNewResourceVariable(t *testing.T) {
 	}
 }
 
+func TestNewResourceVariable_data(t *testing.T) {
+	v, err := NewResourceVariable("data.foo.bar.0.baz")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if v.Mode != DataResourceMode {
+		t.Fatalf("bad: %#v", v)
+	}
+	if v.Type != "foo" || v.Name != "bar" || v.Field != "baz" {
+		t.Fatalf("bad: %#v", v)
+	}
+	if !v.Multi || v.Index != 0 {
+		t.Fatalf("bad: %#v", v)
+	}
+	if v.ResourceId() != "data.foo.bar" {
+		t.Fatalf("bad: %s", v.ResourceId())
+	}
+	if v.FullKey() != "data.foo.bar.0.baz" {
+		t.Fatalf("bad: %#v", v)
+	}
+}
+
 func TestNewUserVariable(t *testing.T) {
 	v, err := NewUserVariable("var.bar")
 	if err != nil {
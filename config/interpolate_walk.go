@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform/config/lang"
@@ -71,6 +72,7 @@ func (w *interpolationWalker) Exit(loc reflectwalk.Location) error {
 		w.splitSlice()
 		w.cs = w.cs[:len(w.cs)-1]
 	case reflectwalk.SliceElem:
+		w.key = w.key[:len(w.key)-1]
 		w.csKey = w.csKey[:len(w.csKey)-1]
 	}
 
@@ -97,6 +99,7 @@ func (w *interpolationWalker) Slice(s reflect.Value) error {
 
 func (w *interpolationWalker) SliceElem(i int, elem reflect.Value) error {
 	w.csKey = append(w.csKey, reflect.ValueOf(i))
+	w.key = append(w.key, strconv.FormatInt(int64(i), 10))
 	w.sliceIndex = i
 	return nil
 }
@@ -190,13 +193,16 @@ func (w *interpolationWalker) Primitive(v reflect.Value) error {
 }
 
 func (w *interpolationWalker) removeCurrent() {
-	// Append the key to the unknown keys
-	w.unknownKeys = append(w.unknownKeys, strings.Join(w.key, "."))
-
 	for i := 1; i <= len(w.cs); i++ {
 		c := w.cs[len(w.cs)-i]
 		switch c.Kind() {
 		case reflect.Map:
+			// Append the key of what is removed to the unknown keys. The
+			// lists between here and the value are removed with it, so
+			// their indexes aren't part of the key.
+			key := w.key[:len(w.key)-(i-1)]
+			w.unknownKeys = append(w.unknownKeys, strings.Join(key, "."))
+
 			// Zero value so that we delete the map key
 			var val reflect.Value
 
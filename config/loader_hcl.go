@@ -18,12 +18,14 @@ type hclConfigurable struct {
 
 func (t *hclConfigurable) Config() (*Config, error) {
 	validKeys := map[string]struct{}{
-		"atlas":    struct{}{},
-		"module":   struct{}{},
-		"output":   struct{}{},
-		"provider": struct{}{},
-		"resource": struct{}{},
-		"variable": struct{}{},
+		"atlas":     struct{}{},
+		"data":      struct{}{},
+		"module":    struct{}{},
+		"output":    struct{}{},
+		"provider":  struct{}{},
+		"resource":  struct{}{},
+		"terraform": struct{}{},
+		"variable":  struct{}{},
 	}
 
 	type hclVariable struct {
@@ -81,6 +83,15 @@ func (t *hclConfigurable) Config() (*Config, error) {
 		}
 	}
 
+	// Get the Terraform configuration
+	if tf := t.Object.Get("terraform", false); tf != nil {
+		var err error
+		config.Terraform, err = loadTerraformHcl(tf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Build the modules
 	if modules := t.Object.Get("module", false); modules != nil {
 		var err error
@@ -108,6 +119,20 @@ func (t *hclConfigurable) Config() (*Config, error) {
 		}
 	}
 
+	// Build the data sources. They are declared like resources, so they
+	// are loaded the same way.
+	if data := t.Object.Get("data", false); data != nil {
+		dataSources, err := loadResourcesHcl(data)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range dataSources {
+			r.Mode = DataResourceMode
+		}
+		config.Resources = append(config.Resources, dataSources...)
+	}
+
 	// Build the outputs
 	if outputs := t.Object.Get("output", false); outputs != nil {
 		var err error
@@ -211,6 +236,19 @@ func loadAtlasHcl(obj *hclobj.Object) (*AtlasConfig, error) {
 	return &config, nil
 }
 
+// Given a handle to a HCL object, this transforms it into the Terraform
+// configuration.
+func loadTerraformHcl(obj *hclobj.Object) (*TerraformConfig, error) {
+	var config TerraformConfig
+	if err := hcl.DecodeObject(&config, obj); err != nil {
+		return nil, fmt.Errorf(
+			"Error reading terraform config: %s",
+			err)
+	}
+
+	return &config, nil
+}
+
 // Given a handle to a HCL object, this recurses into the structure
 // and pulls out a list of modules.
 //
@@ -249,6 +287,7 @@ func loadModulesHcl(os *hclobj.Object) ([]*Module, error) {
 
 		// Remove the fields we handle specially
 		delete(config, "source")
+		delete(config, "count")
 
 		rawConfig, err := NewRawConfig(config)
 		if err != nil {
@@ -258,7 +297,29 @@ func loadModulesHcl(os *hclobj.Object) ([]*Module, error) {
 				err)
 		}
 
-		// If we have a count, then figure it out
+		// If we have a count, then figure it out. It is left unset if
+		// there isn't one, see Module.CountAsVariable.
+		var countConfig *RawConfig
+		if o := obj.Get("count", false); o != nil {
+			var count string
+			err = hcl.DecodeObject(&count, o)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Error parsing count for %s: %s",
+					k,
+					err)
+			}
+
+			countConfig, err = NewRawConfig(map[string]interface{}{
+				"count": count,
+			})
+			if err != nil {
+				return nil, err
+			}
+			countConfig.Key = "count"
+		}
+
+		// If we have a source, then figure it out
 		var source string
 		if o := obj.Get("source", false); o != nil {
 			err = hcl.DecodeObject(&source, o)
@@ -273,6 +334,7 @@ func loadModulesHcl(os *hclobj.Object) ([]*Module, error) {
 		result = append(result, &Module{
 			Name:      k,
 			Source:    source,
+			RawCount:  countConfig,
 			RawConfig: rawConfig,
 		})
 	}
@@ -432,9 +494,11 @@ func loadResourcesHcl(os *hclobj.Object) ([]*Resource, error) {
 			delete(config, "connection")
 			delete(config, "count")
 			delete(config, "depends_on")
+			delete(config, "soft_depends_on")
 			delete(config, "provisioner")
 			delete(config, "provider")
 			delete(config, "lifecycle")
+			delete(config, "timeouts")
 
 			rawConfig, err := NewRawConfig(config)
 			if err != nil {
@@ -478,6 +542,18 @@ func loadResourcesHcl(os *hclobj.Object) ([]*Resource, error) {
 				}
 			}
 
+			var softDependsOn []string
+			if o := obj.Get("soft_depends_on", false); o != nil {
+				err := hcl.DecodeObject(&softDependsOn, o)
+				if err != nil {
+					return nil, fmt.Errorf(
+						"Error reading soft_depends_on for %s[%s]: %s",
+						t.Key,
+						k,
+						err)
+				}
+			}
+
 			// If we have connection info, then parse those out
 			var connInfo map[string]interface{}
 			if o := obj.Get("connection", false); o != nil {
@@ -540,6 +616,27 @@ func loadResourcesHcl(os *hclobj.Object) ([]*Resource, error) {
 				}
 			}
 
+			// The timeouts of the apply, if any
+			var timeouts ResourceTimeouts
+			if o := obj.Get("timeouts", false); o != nil {
+				var raw map[string]interface{}
+				if err = hcl.DecodeObject(&raw, o); err != nil {
+					return nil, fmt.Errorf(
+						"Error parsing timeouts for %s[%s]: %s",
+						t.Key,
+						k,
+						err)
+				}
+
+				if err := mapstructure.WeakDecode(raw, &timeouts); err != nil {
+					return nil, fmt.Errorf(
+						"Error parsing timeouts for %s[%s]: %s",
+						t.Key,
+						k,
+						err)
+				}
+			}
+
 			result = append(result, &Resource{
 				Name:         k,
 				Type:         t.Key,
@@ -549,6 +646,9 @@ func loadResourcesHcl(os *hclobj.Object) ([]*Resource, error) {
 				Provider:     provider,
 				DependsOn:    dependsOn,
 				Lifecycle:    lifecycle,
+
+				SoftDependsOn: softDependsOn,
+				Timeouts:      timeouts,
 			})
 		}
 	}
@@ -603,8 +703,32 @@ func loadProvisionersHcl(os *hclobj.Object, connInfo map[string]interface{}) ([]
 			return nil, err
 		}
 
-		// Delete the "connection" section, handle seperately
+		// Delete the "connection", "triggers", "teardown" and "retry"
+		// sections, and the "when" and "on_failure" settings, handle
+		// seperately
 		delete(config, "connection")
+		delete(config, "triggers")
+		delete(config, "teardown")
+		delete(config, "retry")
+
+		var when, onFailure string
+		for k, v := range map[string]*string{
+			"when":       &when,
+			"on_failure": &onFailure,
+		} {
+			raw, ok := config[k]
+			if !ok {
+				continue
+			}
+			delete(config, k)
+
+			str, ok := raw.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"provisioner %s: %s must be a string", po.Key, k)
+			}
+			*v = str
+		}
 
 		rawConfig, err := NewRawConfig(config)
 		if err != nil {
@@ -639,10 +763,65 @@ func loadProvisionersHcl(os *hclobj.Object, connInfo map[string]interface{}) ([]
 			return nil, err
 		}
 
+		// Parse the triggers
+		var triggers map[string]interface{}
+		if o := po.Get("triggers", false); o != nil {
+			err := hcl.DecodeObject(&triggers, o)
+			if err != nil {
+				return nil, err
+			}
+		}
+		triggersRaw, err := NewRawConfig(triggers)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parse the retry
+		var retry *ProvisionerRetry
+		if o := po.Get("retry", false); o != nil {
+			var raw map[string]interface{}
+			if err := hcl.DecodeObject(&raw, o); err != nil {
+				return nil, err
+			}
+
+			retry = new(ProvisionerRetry)
+			if err := mapstructure.WeakDecode(raw, retry); err != nil {
+				return nil, fmt.Errorf(
+					"provisioner %s: error parsing retry: %s", po.Key, err)
+			}
+		}
+
+		// Parse the teardown, which is a provisioner itself that uses
+		// the same connection.
+		var teardown *Provisioner
+		if o := po.Get("teardown", false); o != nil {
+			teardowns, err := loadProvisionersHcl(o, subConnInfo)
+			if err != nil {
+				return nil, err
+			}
+			if len(teardowns) != 1 {
+				return nil, fmt.Errorf(
+					"provisioner %s: only one teardown is allowed, got %d",
+					po.Key, len(teardowns))
+			}
+
+			teardown = teardowns[0]
+			if teardown.Teardown != nil {
+				return nil, fmt.Errorf(
+					"provisioner %s: a teardown can't have a teardown",
+					po.Key)
+			}
+		}
+
 		result = append(result, &Provisioner{
 			Type:      po.Key,
 			RawConfig: rawConfig,
 			ConnInfo:  connRaw,
+			Triggers:  triggersRaw,
+			When:      when,
+			OnFailure: onFailure,
+			Retry:     retry,
+			Teardown:  teardown,
 		})
 	}
 
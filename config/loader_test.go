@@ -403,6 +403,154 @@ func TestLoadFile_connections(t *testing.T) {
 	}
 }
 
+func TestLoadFile_provisionerTriggers(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "provisioner-triggers.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := c.Resources[0]
+	p1 := r.Provisioners[0]
+	if p1.Triggers == nil || len(p1.Triggers.Raw) != 1 {
+		t.Fatalf("Bad: %#v", p1.Triggers)
+	}
+	if p1.Triggers.Raw["version"] != "${var.version}" {
+		t.Fatalf("Bad: %#v", p1.Triggers)
+	}
+	if _, ok := p1.RawConfig.Raw["triggers"]; ok {
+		t.Fatalf("Bad: %#v", p1.RawConfig)
+	}
+
+	p2 := r.Provisioners[1]
+	if p2.Triggers == nil || len(p2.Triggers.Raw) != 0 {
+		t.Fatalf("Bad: %#v", p2.Triggers)
+	}
+}
+
+func TestLoadFile_provisionerTeardown(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "provisioner-teardown.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := c.Resources[0]
+	p1 := r.Provisioners[0]
+	if _, ok := p1.RawConfig.Raw["teardown"]; ok {
+		t.Fatalf("Bad: %#v", p1.RawConfig)
+	}
+
+	teardown := p1.Teardown
+	if teardown == nil || teardown.Type != "shell" {
+		t.Fatalf("Bad: %#v", teardown)
+	}
+	if teardown.RawConfig.Raw["path"] != "uninstall" {
+		t.Fatalf("Bad: %#v", teardown.RawConfig)
+	}
+	if teardown.ConnInfo.Raw["user"] != "root" {
+		t.Fatalf("Bad: %#v", teardown.ConnInfo)
+	}
+
+	p2 := r.Provisioners[1]
+	if p2.Teardown != nil {
+		t.Fatalf("Bad: %#v", p2.Teardown)
+	}
+}
+
+func TestLoadFile_provisionerRetry(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "provisioner-retry.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := c.Resources[0]
+	p1 := r.Provisioners[0]
+	if _, ok := p1.RawConfig.Raw["retry"]; ok {
+		t.Fatalf("Bad: %#v", p1.RawConfig)
+	}
+
+	expected := &ProvisionerRetry{
+		MaxAttempts: 5,
+		Delay:       "10s",
+		Backoff:     1.5,
+	}
+	if !reflect.DeepEqual(p1.Retry, expected) {
+		t.Fatalf("Bad: %#v", p1.Retry)
+	}
+
+	p2 := r.Provisioners[1]
+	if p2.Retry != nil {
+		t.Fatalf("Bad: %#v", p2.Retry)
+	}
+}
+
+func TestLoadFile_provisionerWhen(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "provisioner-when.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := c.Resources[0]
+	p1 := r.Provisioners[0]
+	if p1.When != ProvisionerWhenDestroy {
+		t.Fatalf("Bad: %#v", p1)
+	}
+	if p1.OnFailure != ProvisionerOnFailureContinue {
+		t.Fatalf("Bad: %#v", p1)
+	}
+	for _, k := range []string{"when", "on_failure"} {
+		if _, ok := p1.RawConfig.Raw[k]; ok {
+			t.Fatalf("Bad: %#v", p1.RawConfig)
+		}
+	}
+
+	p2 := r.Provisioners[1]
+	if p2.When != "" || p2.OnFailure != "" {
+		t.Fatalf("Bad: %#v", p2)
+	}
+}
+
+func TestLoadFile_softDependsOn(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "soft-depends-on.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := resourcesStr(c.Resources)
+	if actual != strings.TrimSpace(softDependsOnResourcesStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestLoadFile_dataSource(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "data-source.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := resourcesStr(c.Resources)
+	if actual != strings.TrimSpace(dataSourceResourcesStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	for _, r := range c.Resources {
+		expected := ManagedResourceMode
+		if r.Type == "aws_ami" {
+			expected = DataResourceMode
+		}
+		if r.Mode != expected {
+			t.Fatalf("bad: %s: %#v", r.Id(), r.Mode)
+		}
+	}
+}
+
 func TestLoadFile_createBeforeDestroy(t *testing.T) {
 	c, err := LoadFile(filepath.Join(fixtureDir, "create-before-destroy.tf"))
 	if err != nil {
@@ -440,6 +588,43 @@ func TestLoadFile_createBeforeDestroy(t *testing.T) {
 	}
 }
 
+func TestLoadFile_terraform(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "terraform.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &TerraformConfig{
+		RequiredVersion: ">= 0.6.0",
+		Stages:          []string{"network", "app"},
+	}
+	if !reflect.DeepEqual(c.Terraform, expected) {
+		t.Fatalf("bad: %#v", c.Terraform)
+	}
+}
+
+func TestLoadFile_timeouts(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "timeouts.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	expected := ResourceTimeouts{Create: "60m", Delete: "2h"}
+	if r.Timeouts != expected {
+		t.Fatalf("bad: %#v", r.Timeouts)
+	}
+
+	// The timeouts aren't part of the config of the resource
+	if _, ok := r.RawConfig.Raw["timeouts"]; ok {
+		t.Fatalf("bad: %#v", r.RawConfig.Raw)
+	}
+}
+
 func TestLoad_preventDestroyString(t *testing.T) {
 	c, err := LoadFile(filepath.Join(fixtureDir, "prevent-destroy-string.tf"))
 	if err != nil {
@@ -676,3 +861,19 @@ aws_instance[bar] (x1)
 aws_instance[web] (x1)
   ami
 `
+
+const dataSourceResourcesStr = `
+aws_instance[web] (x1)
+  ami
+  vars
+    resource: data.aws_ami.ubuntu.id
+data.aws_ami[ubuntu] (x1)
+  name
+`
+
+const softDependsOnResourcesStr = `
+aws_instance[db] (x1)
+aws_instance[web] (x1)
+  softDependsOn
+    aws_instance.db
+`
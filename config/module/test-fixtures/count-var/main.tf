@@ -0,0 +1,9 @@
+module "child" {
+    source = "./child"
+    count = 2
+}
+
+module "other" {
+    source = "./other"
+    count = 2
+}
@@ -207,6 +207,20 @@ func (t *Tree) Load(s Storage, mode GetMode) error {
 		}
 	}
 
+	// A module that declares a variable named count gets the count as
+	// that variable, the way it did before modules had a count.
+	for _, m := range t.config.Modules {
+		for _, v := range children[m.Name].config.Variables {
+			if v.Name != "count" {
+				continue
+			}
+
+			if err := m.CountAsVariable(); err != nil {
+				return fmt.Errorf("module %s: %s", m.Name, err)
+			}
+		}
+	}
+
 	// Set our tree up
 	t.children = children
 
@@ -178,6 +178,35 @@ func TestTreeLoad_subdir(t *testing.T) {
 	}
 }
 
+func TestTreeLoad_countVariable(t *testing.T) {
+	tree := NewTree("", testConfig(t, "count-var"))
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The child declares a variable named count, so it gets the count
+	// as that variable instead of being expanded
+	modules := tree.Config().Modules
+	if modules[0].RawCount != nil {
+		t.Fatalf("bad: %#v", modules[0].RawCount)
+	}
+	if v := modules[0].RawConfig.Raw["count"]; v != "2" {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	if modules[1].RawCount == nil {
+		t.Fatal("should have count")
+	}
+	if _, ok := modules[1].RawConfig.Raw["count"]; ok {
+		t.Fatalf("bad: %#v", modules[1].RawConfig.Raw)
+	}
+}
+
 func TestTreeModules(t *testing.T) {
 	tree := NewTree("", testConfig(t, "basic"))
 	actual := tree.Modules()
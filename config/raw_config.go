@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"encoding/gob"
+	"sort"
 	"sync"
 
 	"github.com/hashicorp/terraform/config/lang"
@@ -180,6 +181,7 @@ func (r *RawConfig) Merge(other *RawConfig) *RawConfig {
 	for k, _ := range unknownKeys {
 		result.unknownKeys = append(result.unknownKeys, k)
 	}
+	sort.Strings(result.unknownKeys)
 
 	return result
 }
@@ -229,6 +231,7 @@ func (r *RawConfig) interpolate(fn interpolationWalkerFunc) error {
 	}
 
 	r.unknownKeys = w.unknownKeys
+	sort.Strings(r.unknownKeys)
 	return nil
 }
 
@@ -252,7 +255,10 @@ func (r *RawConfig) merge(r2 *RawConfig) *RawConfig {
 }
 
 // UnknownKeys returns the keys of the configuration that are unknown
-// because they had interpolated variables that must be computed.
+// because they had interpolated variables that must be computed, sorted.
+// The keys are in the same format as ResourceConfig.Get, such as
+// "tags.Name" or "ingress.0.cidr_blocks". An unknown element of a list
+// of strings removes the whole list, so the key is that of the list.
 func (r *RawConfig) UnknownKeys() []string {
 	return r.unknownKeys
 }
@@ -306,6 +312,8 @@ func langEvalConfig(vs map[string]ast.Variable) *lang.EvalConfig {
 	funcMap["lookup"] = interpolationFuncLookup(vs)
 	funcMap["keys"] = interpolationFuncKeys(vs)
 	funcMap["values"] = interpolationFuncValues(vs)
+	funcMap["timestamp"] = interpolationFuncTimestamp(vs)
+	funcMap["random"] = interpolationFuncRandom(vs)
 
 	return &lang.EvalConfig{
 		GlobalScope: &ast.BasicScope{
@@ -271,6 +271,53 @@ func TestRawConfig_unknownPartial(t *testing.T) {
 	}
 }
 
+func TestRawConfig_unknownNested(t *testing.T) {
+	raw := map[string]interface{}{
+		"foo": "${var.bar}",
+		"bar": "${var.bar}",
+		"tags": map[string]interface{}{
+			"Name":  "${var.bar}",
+			"Owner": "me",
+		},
+		"list": []interface{}{"${var.bar}", "baz"},
+		"ingress": []interface{}{
+			map[string]interface{}{"cidr": "${var.bar}", "port": "80"},
+		},
+	}
+
+	rc, err := NewRawConfig(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	vars := map[string]ast.Variable{
+		"var.bar": ast.Variable{
+			Value: UnknownVariableValue,
+			Type:  ast.TypeString,
+		},
+	}
+	if err := rc.Interpolate(vars); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := rc.Config()
+	expected := map[string]interface{}{
+		"tags": map[string]interface{}{"Owner": "me"},
+		"ingress": []interface{}{
+			map[string]interface{}{"port": "80"},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Sorted, with the indexes of the lists they're in
+	expectedKeys := []string{"bar", "foo", "ingress.0.cidr", "list", "tags.Name"}
+	if !reflect.DeepEqual(rc.UnknownKeys(), expectedKeys) {
+		t.Fatalf("bad: %#v", rc.UnknownKeys())
+	}
+}
+
 func TestRawConfigValue(t *testing.T) {
 	raw := map[string]interface{}{
 		"foo": "${var.bar}",
@@ -0,0 +1,7 @@
+data "aws_ami" "ubuntu" {
+    name = "ubuntu"
+}
+
+resource "aws_instance" "web" {
+    ami = "${data.aws_ami.ubuntu.id}"
+}
@@ -0,0 +1,15 @@
+resource "aws_instance" "web" {
+    provisioner "remote-exec" {
+        inline = ["echo hello"]
+
+        retry {
+            max_attempts = 5
+            delay = "10s"
+            backoff = 1.5
+        }
+    }
+
+    provisioner "shell" {
+        path = "bar"
+    }
+}
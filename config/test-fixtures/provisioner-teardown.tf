@@ -0,0 +1,17 @@
+resource "aws_instance" "web" {
+    connection {
+        user = "root"
+    }
+
+    provisioner "shell" {
+        path = "install"
+
+        teardown "shell" {
+            path = "uninstall"
+        }
+    }
+
+    provisioner "shell" {
+        path = "bar"
+    }
+}
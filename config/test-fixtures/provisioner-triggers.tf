@@ -0,0 +1,13 @@
+resource "aws_instance" "web" {
+    provisioner "shell" {
+        path = "foo"
+
+        triggers {
+            version = "${var.version}"
+        }
+    }
+
+    provisioner "shell" {
+        path = "bar"
+    }
+}
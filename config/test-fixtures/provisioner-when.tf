@@ -0,0 +1,11 @@
+resource "aws_instance" "web" {
+    provisioner "shell" {
+        path = "drain"
+        when = "destroy"
+        on_failure = "continue"
+    }
+
+    provisioner "shell" {
+        path = "bar"
+    }
+}
@@ -0,0 +1,6 @@
+resource "aws_instance" "db" {
+}
+
+resource "aws_instance" "web" {
+    soft_depends_on = ["aws_instance.db"]
+}
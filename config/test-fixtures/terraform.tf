@@ -0,0 +1,4 @@
+terraform {
+    required_version = ">= 0.6.0"
+    stages = ["network", "app"]
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+
+    timeouts {
+        create = "60m"
+        delete = "2h"
+    }
+}
@@ -0,0 +1,5 @@
+resource "aws_instance" "web" {
+    lifecycle {
+        change_window = "2am-4am"
+    }
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    count = 4
+
+    lifecycle {
+        parallelism = -1
+    }
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    count = 4
+
+    lifecycle {
+        rollout_percent = 150
+    }
+}
@@ -0,0 +1,3 @@
+resource "aws_instance" "web" {
+    soft_depends_on = ["aws_instance.db"]
+}
@@ -0,0 +1,11 @@
+resource "aws_instance" "web" {
+    count = "${aws_instance.db.count}"
+
+    lifecycle {
+        lazy_references = ["aws_instance.db", "aws_instance.nope"]
+    }
+}
+
+resource "aws_instance" "db" {
+    count = 2
+}
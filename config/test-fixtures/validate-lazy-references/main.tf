@@ -0,0 +1,9 @@
+resource "aws_instance" "web" {
+    ami = "${aws_instance.db.private_ip}"
+
+    lifecycle {
+        lazy_references = ["aws_instance.db"]
+    }
+}
+
+resource "aws_instance" "db" {}
@@ -0,0 +1,8 @@
+module "foo" {
+    source = "./foo"
+    count = 3
+}
+
+resource "aws_instance" "web" {
+    ami = "${module.foo.ami}"
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "web" {
+    count = 2
+}
+
+module "foo" {
+    source = "./foo"
+    count = "${aws_instance.web.count}"
+}
@@ -0,0 +1,8 @@
+variable "count" {
+    default = 3
+}
+
+module "foo" {
+    source = "./foo"
+    count = "${var.count}"
+}
@@ -0,0 +1,5 @@
+module "foo" {
+    source = "./foo"
+    count = 3
+    name = "foo-${count.index}"
+}
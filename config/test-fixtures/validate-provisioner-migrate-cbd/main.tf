@@ -0,0 +1,6 @@
+resource "aws_db_instance" "db" {
+    provisioner "shell" {
+        command = "migrate"
+        when = "migrate"
+    }
+}
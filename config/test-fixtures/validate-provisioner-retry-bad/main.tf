@@ -0,0 +1,10 @@
+resource "aws_instance" "web" {
+    provisioner "remote-exec" {
+        inline = ["echo hello"]
+
+        retry {
+            max_attempts = 0
+            delay = "soon"
+        }
+    }
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    provisioner "shell" {
+        path = "drain"
+        when = "later"
+        on_failure = "ignore"
+    }
+}
@@ -0,0 +1,7 @@
+resource "aws_ami" "web" {}
+
+resource "aws_instance" "web" {
+  lifecycle {
+    replace_triggered_by = ["aws_ami.web"]
+  }
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+  count = 2
+}
+
+resource "aws_instance" "db" {
+  ami = "${aws_instance.web.2.id}"
+}
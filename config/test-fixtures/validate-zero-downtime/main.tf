@@ -0,0 +1,6 @@
+resource "aws_instance" "web" {
+  lifecycle {
+    create_before_destroy = true
+    zero_downtime = true
+  }
+}
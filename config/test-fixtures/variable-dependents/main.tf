@@ -0,0 +1,41 @@
+variable "ami" {}
+variable "size" {}
+
+resource "aws_instance" "web" {
+    ami = "${var.ami}"
+    count = 2
+}
+
+resource "aws_elb" "lb" {
+    instances = ["${aws_instance.web.*.id}"]
+}
+
+resource "aws_route53_record" "www" {
+    records = ["${aws_elb.lb.dns_name}"]
+}
+
+resource "aws_instance" "db" {
+    instance_type = "${var.size}"
+}
+
+variable "key" {}
+
+resource "aws_instance" "bastion" {
+    provisioner "remote-exec" {
+        inline = ["echo ${var.ami}"]
+    }
+}
+
+resource "aws_instance" "app" {
+    provisioner "remote-exec" {
+        connection {
+            key_file = "${var.key}"
+        }
+    }
+}
+
+resource "aws_instance" "worker" {
+    provisioner "local-exec" {
+        command = "echo ${aws_instance.app.id}"
+    }
+}
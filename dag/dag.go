@@ -95,6 +95,11 @@ func (g *AcyclicGraph) Root() (Vertex, error) {
 //
 // Complexity: O(V(V+E)), or asymptotically O(VE)
 func (g *AcyclicGraph) TransitiveReduction() {
+	// Soft edges don't carry failures along, so a regular edge can only
+	// be removed if there is another path to its target without soft
+	// edges. Soft edges only order, so any other path will do for them.
+	soft := g.softEdges()
+
 	// For each vertex u in graph g, do a DFS starting from each vertex
 	// v such that the edge (u,v) exists (v is a direct descendant of u).
 	//
@@ -106,12 +111,76 @@ func (g *AcyclicGraph) TransitiveReduction() {
 		g.DepthFirstWalk(vs, func(v Vertex, d int) error {
 			shared := uTargets.Intersection(g.DownEdges(v))
 			for _, vPrime := range AsVertexList(shared) {
-				g.RemoveEdge(BasicEdge(u, vPrime))
+				if len(soft) == 0 || soft.Include(u, vPrime) {
+					g.RemoveEdge(BasicEdge(u, vPrime))
+				}
 			}
 
 			return nil
 		})
+
+		if len(soft) > 0 {
+			g.reduceHard(u, soft)
+		}
+	}
+}
+
+// reduceHard removes the regular edges (u, v-prime) where v-prime is
+// reachable from u through a path of only regular edges.
+func (g *AcyclicGraph) reduceHard(u Vertex, soft edgeMap) {
+	var stack []Vertex
+	for _, v := range AsVertexList(g.DownEdges(u)) {
+		if !soft.Include(u, v) {
+			stack = append(stack, v)
+		}
+	}
+
+	seen := make(map[Vertex]struct{})
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+
+		for _, vPrime := range AsVertexList(g.DownEdges(v)) {
+			if soft.Include(v, vPrime) {
+				continue
+			}
+
+			if g.DownEdges(u).Include(vPrime) && !soft.Include(u, vPrime) {
+				g.RemoveEdge(BasicEdge(u, vPrime))
+			}
+
+			stack = append(stack, vPrime)
+		}
+	}
+}
+
+// edgeMap is a set of edges by source and target.
+type edgeMap map[Vertex]map[Vertex]struct{}
+
+func (m edgeMap) Include(source, target Vertex) bool {
+	_, ok := m[source][target]
+	return ok
+}
+
+// softEdges returns the soft edges of the graph. See SoftEdge.
+func (g *AcyclicGraph) softEdges() edgeMap {
+	result := make(edgeMap)
+	for _, e := range g.Edges() {
+		if !isSoftEdge(e) {
+			continue
+		}
+
+		if result[e.Source()] == nil {
+			result[e.Source()] = make(map[Vertex]struct{})
+		}
+		result[e.Source()][e.Target()] = struct{}{}
 	}
+
+	return result
 }
 
 // Validate validates the DAG. A DAG is valid if it has a single root
@@ -179,6 +248,9 @@ func (g *AcyclicGraph) Walk(cb WalkFunc) error {
 		vertMap[v] = make(chan struct{})
 	}
 
+	// A vertex is still walked if the targets of its soft edges failed
+	soft := g.softEdges()
+
 	// The map of whether a vertex errored or not during the walk
 	var errLock sync.Mutex
 	var errs error
@@ -218,6 +290,12 @@ func (g *AcyclicGraph) Walk(cb WalkFunc) error {
 			errLock.Lock()
 			defer errLock.Unlock()
 			for _, dep := range deps {
+				if errMap[dep] && soft.Include(v, dep) {
+					log.Printf("[WARN] vertex %s, soft dependency failed: %s",
+						VertexName(v), VertexName(dep))
+					continue
+				}
+
 				if errMap[dep] {
 					errMap[v] = true
 					readyCh <- false
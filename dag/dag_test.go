@@ -87,6 +87,28 @@ func TestAyclicGraphTransReduction_more(t *testing.T) {
 	}
 }
 
+func TestAyclicGraphTransReduction_soft(t *testing.T) {
+	var g AcyclicGraph
+	g.Add(1)
+	g.Add(2)
+	g.Add(3)
+	g.Add(4)
+	g.Connect(SoftEdge(1, 2))
+	g.Connect(BasicEdge(1, 3))
+	g.Connect(BasicEdge(2, 3))
+	g.Connect(SoftEdge(1, 4))
+	g.Connect(BasicEdge(3, 4))
+	g.TransitiveReduction()
+
+	// 1 must keep its regular edge to 3, the only other path goes
+	// through a soft edge. The soft edge to 4 isn't needed.
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testGraphTransReductionSoftStr)
+	if actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
 func TestAcyclicGraphValidate(t *testing.T) {
 	var g AcyclicGraph
 	g.Add(1)
@@ -260,6 +282,40 @@ func TestAcyclicGraphWalk_error(t *testing.T) {
 	t.Fatalf("bad: %#v", visits)
 }
 
+func TestAcyclicGraphWalk_softError(t *testing.T) {
+	var g AcyclicGraph
+	g.Add(1)
+	g.Add(2)
+	g.Add(3)
+	g.Add(4)
+	g.Connect(BasicEdge(4, 3))
+	g.Connect(SoftEdge(3, 2))
+	g.Connect(BasicEdge(2, 1))
+
+	var visits []Vertex
+	var lock sync.Mutex
+	err := g.Walk(func(v Vertex) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if v == 2 {
+			return fmt.Errorf("error")
+		}
+
+		visits = append(visits, v)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	// 3 still runs after 2, even though 2 failed
+	expected := []Vertex{1, 3, 4}
+	if !reflect.DeepEqual(visits, expected) {
+		t.Fatalf("bad: %#v", visits)
+	}
+}
+
 const testGraphTransReductionStr = `
 1
   2
@@ -277,3 +333,14 @@ const testGraphTransReductionMoreStr = `
   4
 4
 `
+
+const testGraphTransReductionSoftStr = `
+1
+  2
+  3
+2
+  3
+3
+  4
+4
+`
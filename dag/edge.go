@@ -35,3 +35,22 @@ func (e *basicEdge) Source() Vertex {
 func (e *basicEdge) Target() Vertex {
 	return e.T
 }
+
+// SoftEdge returns an Edge that orders the source after the target like
+// BasicEdge does, but that doesn't make the source depend on the target
+// succeeding: when the graph is walked, the source is still visited if
+// the target failed. A BasicEdge between the same vertices replaces it.
+func SoftEdge(source, target Vertex) Edge {
+	return &softEdge{basicEdge{S: source, T: target}}
+}
+
+// softEdge is the Edge implementation returned by SoftEdge. It has the
+// same hash code as a basicEdge between the same vertices.
+type softEdge struct {
+	basicEdge
+}
+
+func isSoftEdge(e Edge) bool {
+	_, ok := e.(*softEdge)
+	return ok
+}
@@ -24,3 +24,11 @@ func TestBasicEdgeHashcode_pointer(t *testing.T) {
 		t.Fatalf("bad")
 	}
 }
+
+func TestSoftEdgeHashcode(t *testing.T) {
+	e1 := SoftEdge(1, 2)
+	e2 := BasicEdge(1, 2)
+	if e1.Hashcode() != e2.Hashcode() {
+		t.Fatalf("bad")
+	}
+}
@@ -87,13 +87,21 @@ func (g *Graph) Replace(original, replacement Vertex) bool {
 		return true
 	}
 
-	// Add our new vertex, then copy all the edges
+	// Add our new vertex, then copy all the edges. Soft edges stay soft.
 	g.Add(replacement)
 	for _, target := range g.DownEdges(original).List() {
-		g.Connect(BasicEdge(replacement, target))
+		edgeFn := BasicEdge
+		if isSoftEdge(g.edge(original, target)) {
+			edgeFn = SoftEdge
+		}
+		g.Connect(edgeFn(replacement, target))
 	}
 	for _, source := range g.UpEdges(original).List() {
-		g.Connect(BasicEdge(source, replacement))
+		edgeFn := BasicEdge
+		if isSoftEdge(g.edge(source, original)) {
+			edgeFn = SoftEdge
+		}
+		g.Connect(edgeFn(source, replacement))
 	}
 
 	// Remove our old vertex, which will also remove all the edges
@@ -118,6 +126,16 @@ func (g *Graph) RemoveEdge(edge Edge) {
 	}
 }
 
+// edge returns the edge from the source to the target, or nil if there
+// is none.
+func (g *Graph) edge(source, target Vertex) Edge {
+	g.once.Do(g.init)
+	g.edges.once.Do(g.edges.init)
+
+	e, _ := g.edges.m[BasicEdge(source, target).Hashcode()].(Edge)
+	return e
+}
+
 // DownEdges returns the outward edges from the source Vertex v.
 func (g *Graph) DownEdges(v Vertex) *Set {
 	g.once.Do(g.init)
@@ -140,8 +158,13 @@ func (g *Graph) Connect(edge Edge) {
 	source := edge.Source()
 	target := edge.Target()
 
-	// Do we have this already? If so, don't add it again.
+	// Do we have this already? If so, don't add it again. The exception
+	// is a soft edge, which is replaced by a regular edge.
 	if s, ok := g.downEdges[source]; ok && s.Include(target) {
+		if !isSoftEdge(edge) && g.edges.Include(edge) {
+			g.edges.Add(edge)
+		}
+
 		return
 	}
 
@@ -1,6 +1,8 @@
 package dag
 
 import (
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -32,6 +34,20 @@ func TestGraph_basic(t *testing.T) {
 	}
 }
 
+func TestGraph_connectSoft(t *testing.T) {
+	var g Graph
+	g.Add(1)
+	g.Add(2)
+	g.Connect(SoftEdge(1, 2))
+	g.Connect(BasicEdge(1, 2))
+	g.Connect(SoftEdge(1, 2))
+
+	edges := g.Edges()
+	if len(edges) != 1 || isSoftEdge(edges[0]) {
+		t.Fatalf("bad: %#v", edges)
+	}
+}
+
 func TestGraph_remove(t *testing.T) {
 	var g Graph
 	g.Add(1)
@@ -63,6 +79,25 @@ func TestGraph_replace(t *testing.T) {
 	}
 }
 
+func TestGraph_replaceSoft(t *testing.T) {
+	var g Graph
+	g.Add(1)
+	g.Add(2)
+	g.Add(3)
+	g.Connect(SoftEdge(1, 2))
+	g.Connect(BasicEdge(2, 3))
+	g.Replace(2, 42)
+
+	soft := make(map[string]bool)
+	for _, e := range g.Edges() {
+		soft[fmt.Sprintf("%v-%v", e.Source(), e.Target())] = isSoftEdge(e)
+	}
+	expected := map[string]bool{"1-42": true, "42-3": false}
+	if !reflect.DeepEqual(soft, expected) {
+		t.Fatalf("bad: %#v", soft)
+	}
+}
+
 func TestGraph_replaceSelf(t *testing.T) {
 	var g Graph
 	g.Add(1)
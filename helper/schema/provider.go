@@ -33,12 +33,29 @@ type Provider struct {
 	// Diff, etc. to the proper resource.
 	ResourcesMap map[string]*Resource
 
+	// DataSourcesMap is the list of available data sources, the read-only
+	// resources declared in "data" blocks. Only the Schema and the Read
+	// function of a data source are used: Read is called with the
+	// configuration, and must set the ID and any computed attributes.
+	DataSourcesMap map[string]*Resource
+
 	// ConfigureFunc is a function for configuring the provider. If the
 	// provider doesn't need to be configured, this can be omitted.
 	//
 	// See the ConfigureFunc documentation for more information.
 	ConfigureFunc ConfigureFunc
 
+	// MaxConcurrentCalls, if above zero, is the most calls to Apply, Diff
+	// and Refresh that Terraform makes to this provider at once, such as
+	// to stay under the rate limit of its API.
+	MaxConcurrentCalls int
+
+	// PrerequisitesMap is the list of the implicit prerequisites that the
+	// resources of this provider may need, such as a default network, by
+	// name, along with the function that ensures each exists. Resources
+	// name the prerequisites they need in their Prerequisites.
+	PrerequisitesMap map[string]EnsurePrerequisiteFunc
+
 	meta interface{}
 }
 
@@ -50,6 +67,11 @@ type Provider struct {
 // structure, etc.
 type ConfigureFunc func(*ResourceData) (interface{}, error)
 
+// EnsurePrerequisiteFunc is the function used to make sure a prerequisite
+// exists, creating it if it doesn't. It is passed the meta of the
+// provider, like the functions of the resources.
+type EnsurePrerequisiteFunc func(interface{}) error
+
 // InternalValidate should be called to validate the structure
 // of the provider.
 //
@@ -70,6 +92,27 @@ func (p *Provider) InternalValidate() error {
 		if err := r.InternalValidate(nil); err != nil {
 			return fmt.Errorf("%s: %s", k, err)
 		}
+
+		for _, name := range r.Prerequisites {
+			if _, ok := p.PrerequisitesMap[name]; !ok {
+				return fmt.Errorf("%s: unknown prerequisite: %s", k, name)
+			}
+		}
+	}
+
+	for k, r := range p.DataSourcesMap {
+		if err := r.InternalValidate(nil); err != nil {
+			return fmt.Errorf("data source %s: %s", k, err)
+		}
+		if r.Read == nil {
+			return fmt.Errorf("data source %s: Read must be set", k)
+		}
+	}
+
+	for k, f := range p.PrerequisitesMap {
+		if f == nil {
+			return fmt.Errorf("prerequisite %s: function is nil", k)
+		}
 	}
 
 	return nil
@@ -175,6 +218,19 @@ func (p *Provider) Diff(
 	return r.Diff(s, c)
 }
 
+// ReadDataSource implementation of terraform.ResourceProviderDataSourceReader
+// interface.
+func (p *Provider) ReadDataSource(
+	info *terraform.InstanceInfo,
+	c *terraform.ResourceConfig) (*terraform.InstanceState, error) {
+	r, ok := p.DataSourcesMap[info.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown data source: %s", info.Type)
+	}
+
+	return r.ReadDataSource(c, p.meta)
+}
+
 // Refresh implementation of terraform.ResourceProvider interface.
 func (p *Provider) Refresh(
 	info *terraform.InstanceInfo,
@@ -187,6 +243,117 @@ func (p *Provider) Refresh(
 	return r.Refresh(s, p.meta)
 }
 
+// ReadSecrets implementation of terraform.ResourceProviderSecretReader
+// interface.
+func (p *Provider) ReadSecrets(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState) (map[string]string, error) {
+	r, ok := p.ResourcesMap[info.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource type: %s", info.Type)
+	}
+
+	return r.Secrets(s, p.meta)
+}
+
+// EstimateCost implementation of terraform.ResourceProviderCostEstimator
+// interface.
+func (p *Provider) EstimateCost(
+	info *terraform.InstanceInfo,
+	d *terraform.InstanceDiff) (float64, bool, error) {
+	r, ok := p.ResourcesMap[info.Type]
+	if !ok {
+		return 0, false, fmt.Errorf("unknown resource type: %s", info.Type)
+	}
+
+	return r.Cost(d, p.meta)
+}
+
+// DataMigration implementation of terraform.ResourceProviderDataMigrator
+// interface.
+func (p *Provider) DataMigration(t string) terraform.MigrateDataFunc {
+	r, ok := p.ResourcesMap[t]
+	if !ok || r.MigrateData == nil {
+		return nil
+	}
+
+	return func(info *terraform.InstanceInfo, from, to *terraform.InstanceState) error {
+		return r.MoveData(from, to, p.meta)
+	}
+}
+
+// AttributeMigrations implementation of terraform.ResourceProviderMigrator
+// interface.
+func (p *Provider) AttributeMigrations(t string) []terraform.AttributeMigration {
+	r, ok := p.ResourcesMap[t]
+	if !ok || len(r.AttributeMigrations) == 0 {
+		return nil
+	}
+
+	result := make([]terraform.AttributeMigration, len(r.AttributeMigrations))
+	for i, m := range r.AttributeMigrations {
+		migrate := m.Migrate
+		result[i] = terraform.AttributeMigration{
+			Version: m.Version,
+			Migrate: func(attrs map[string]string) error {
+				return migrate(attrs, p.meta)
+			},
+		}
+	}
+
+	return result
+}
+
+// DiffSuppressFuncs implementation of
+// terraform.ResourceProviderDiffSuppressor interface.
+func (p *Provider) DiffSuppressFuncs(t string) map[string]terraform.DiffSuppressFunc {
+	r, ok := p.ResourcesMap[t]
+	if !ok {
+		return nil
+	}
+
+	var result map[string]terraform.DiffSuppressFunc
+	for k, s := range r.Schema {
+		if s.DiffSuppressFunc == nil {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]terraform.DiffSuppressFunc)
+		}
+		result[k] = terraform.DiffSuppressFunc(s.DiffSuppressFunc)
+	}
+
+	return result
+}
+
+// Prerequisites implementation of terraform.ResourceProviderPrerequisiter
+// interface.
+func (p *Provider) Prerequisites(t string) []string {
+	r, ok := p.ResourcesMap[t]
+	if !ok {
+		return nil
+	}
+
+	return r.Prerequisites
+}
+
+// EnsurePrerequisite implementation of
+// terraform.ResourceProviderPrerequisiter interface.
+func (p *Provider) EnsurePrerequisite(name string) error {
+	f, ok := p.PrerequisitesMap[name]
+	if !ok {
+		return fmt.Errorf("unknown prerequisite: %s", name)
+	}
+
+	return f(p.meta)
+}
+
+// ConcurrencyLimit implementation of
+// terraform.ResourceProviderConcurrencyLimiter interface.
+func (p *Provider) ConcurrencyLimit() int {
+	return p.MaxConcurrentCalls
+}
+
 // Resources implementation of terraform.ResourceProvider interface.
 func (p *Provider) Resources() []terraform.ResourceType {
 	keys := make([]string, 0, len(p.ResourcesMap))
@@ -197,9 +364,19 @@ func (p *Provider) Resources() []terraform.ResourceType {
 
 	result := make([]terraform.ResourceType, 0, len(keys))
 	for _, k := range keys {
-		result = append(result, terraform.ResourceType{
-			Name: k,
-		})
+		rt := terraform.ResourceType{Name: k}
+		if r := p.ResourcesMap[k]; r != nil {
+			for attr, s := range r.Schema {
+				rt.Attributes = append(rt.Attributes, attr)
+				if s.JSON {
+					rt.JSONAttributes = append(rt.JSONAttributes, attr)
+				}
+			}
+			sort.Strings(rt.Attributes)
+			sort.Strings(rt.JSONAttributes)
+		}
+
+		result = append(result, rt)
 	}
 
 	return result
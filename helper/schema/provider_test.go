@@ -3,6 +3,7 @@ package schema
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform/config"
@@ -13,6 +14,38 @@ func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = new(Provider)
 }
 
+func TestProvider_implSecretReader(t *testing.T) {
+	var _ terraform.ResourceProviderSecretReader = new(Provider)
+}
+
+func TestProvider_implCostEstimator(t *testing.T) {
+	var _ terraform.ResourceProviderCostEstimator = new(Provider)
+}
+
+func TestProvider_implDataMigrator(t *testing.T) {
+	var _ terraform.ResourceProviderDataMigrator = new(Provider)
+}
+
+func TestProvider_implMigrator(t *testing.T) {
+	var _ terraform.ResourceProviderMigrator = new(Provider)
+}
+
+func TestProvider_implConcurrencyLimiter(t *testing.T) {
+	var _ terraform.ResourceProviderConcurrencyLimiter = new(Provider)
+}
+
+func TestProvider_implPrerequisiter(t *testing.T) {
+	var _ terraform.ResourceProviderPrerequisiter = new(Provider)
+}
+
+func TestProvider_implDataSourceReader(t *testing.T) {
+	var _ terraform.ResourceProviderDataSourceReader = new(Provider)
+}
+
+func TestProvider_implDiffSuppressor(t *testing.T) {
+	var _ terraform.ResourceProviderDiffSuppressor = new(Provider)
+}
+
 func TestProviderConfigure(t *testing.T) {
 	cases := []struct {
 		P      *Provider
@@ -107,6 +140,33 @@ func TestProviderResources(t *testing.T) {
 				terraform.ResourceType{Name: "foo"},
 			},
 		},
+
+		{
+			P: &Provider{
+				ResourcesMap: map[string]*Resource{
+					"foo": &Resource{
+						Schema: map[string]*Schema{
+							"policy": &Schema{
+								Type:     TypeString,
+								Optional: true,
+								JSON:     true,
+							},
+							"name": &Schema{
+								Type:     TypeString,
+								Required: true,
+							},
+						},
+					},
+				},
+			},
+			Result: []terraform.ResourceType{
+				terraform.ResourceType{
+					Name:           "foo",
+					Attributes:     []string{"name", "policy"},
+					JSONAttributes: []string{"policy"},
+				},
+			},
+		},
 	}
 
 	for i, tc := range cases {
@@ -132,6 +192,28 @@ func TestProviderValidate(t *testing.T) {
 			Config: nil,
 			Err:    true,
 		},
+
+		// Unknown prerequisite
+		{
+			P: &Provider{
+				ResourcesMap: map[string]*Resource{
+					"foo": &Resource{Prerequisites: []string{"vpc"}},
+				},
+			},
+			Config: nil,
+			Err:    true,
+		},
+
+		// Data source without Read
+		{
+			P: &Provider{
+				DataSourcesMap: map[string]*Resource{
+					"foo": &Resource{},
+				},
+			},
+			Config: nil,
+			Err:    true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -186,6 +268,241 @@ func TestProviderValidateResource(t *testing.T) {
 	}
 }
 
+func TestProviderDataMigration(t *testing.T) {
+	var moved []string
+	p := &Provider{
+		ResourcesMap: map[string]*Resource{
+			"foo": &Resource{
+				MigrateData: func(from, to *ResourceData, m interface{}) error {
+					if m != 42 {
+						return fmt.Errorf("meta not passed")
+					}
+
+					moved = append(moved, from.Id(), to.Id())
+					return nil
+				},
+			},
+			"bar": &Resource{},
+		},
+	}
+	p.SetMeta(42)
+
+	if f := p.DataMigration("bar"); f != nil {
+		t.Fatal("should not have a data migration")
+	}
+	if f := p.DataMigration("baz"); f != nil {
+		t.Fatal("should not have a data migration")
+	}
+
+	f := p.DataMigration("foo")
+	if f == nil {
+		t.Fatal("should have a data migration")
+	}
+
+	info := &terraform.InstanceInfo{Type: "foo"}
+	from := &terraform.InstanceState{ID: "old"}
+	to := &terraform.InstanceState{ID: "new"}
+	if err := f(info, from, to); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"old", "new"}
+	if !reflect.DeepEqual(moved, expected) {
+		t.Fatalf("bad: %#v", moved)
+	}
+}
+
+func TestProviderAttributeMigrations(t *testing.T) {
+	p := &Provider{
+		ResourcesMap: map[string]*Resource{
+			"foo": &Resource{
+				SchemaVersion: 1,
+				AttributeMigrations: []AttributeMigration{
+					AttributeMigration{
+						Version: 1,
+						Migrate: func(attrs map[string]string, m interface{}) error {
+							if m != 42 {
+								return fmt.Errorf("meta not passed")
+							}
+
+							attrs["name"] = attrs["tag"]
+							delete(attrs, "tag")
+							return nil
+						},
+					},
+				},
+			},
+			"bar": &Resource{},
+		},
+	}
+	p.SetMeta(42)
+
+	if ms := p.AttributeMigrations("bar"); ms != nil {
+		t.Fatalf("bad: %#v", ms)
+	}
+	if ms := p.AttributeMigrations("baz"); ms != nil {
+		t.Fatalf("bad: %#v", ms)
+	}
+
+	ms := p.AttributeMigrations("foo")
+	if len(ms) != 1 || ms[0].Version != 1 {
+		t.Fatalf("bad: %#v", ms)
+	}
+
+	attrs := map[string]string{"tag": "web"}
+	if err := ms[0].Migrate(attrs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{"name": "web"}
+	if !reflect.DeepEqual(attrs, expected) {
+		t.Fatalf("bad: %#v", attrs)
+	}
+}
+
+func TestProviderPrerequisites(t *testing.T) {
+	var ensured []string
+	p := &Provider{
+		ResourcesMap: map[string]*Resource{
+			"foo": &Resource{Prerequisites: []string{"vpc"}},
+			"bar": &Resource{},
+		},
+		PrerequisitesMap: map[string]EnsurePrerequisiteFunc{
+			"vpc": func(m interface{}) error {
+				if m != 42 {
+					return fmt.Errorf("meta not passed")
+				}
+
+				ensured = append(ensured, "vpc")
+				return nil
+			},
+		},
+	}
+	p.SetMeta(42)
+
+	if names := p.Prerequisites("bar"); len(names) != 0 {
+		t.Fatalf("bad: %#v", names)
+	}
+	if names := p.Prerequisites("baz"); len(names) != 0 {
+		t.Fatalf("bad: %#v", names)
+	}
+	if names := p.Prerequisites("foo"); !reflect.DeepEqual(names, []string{"vpc"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	if err := p.EnsurePrerequisite("vpc"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(ensured, []string{"vpc"}) {
+		t.Fatalf("bad: %#v", ensured)
+	}
+
+	if err := p.EnsurePrerequisite("role"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestProviderReadDataSource(t *testing.T) {
+	p := &Provider{
+		ResourcesMap: map[string]*Resource{
+			"bar": &Resource{},
+		},
+		DataSourcesMap: map[string]*Resource{
+			"foo": &Resource{
+				Schema: map[string]*Schema{
+					"name": &Schema{
+						Type:     TypeString,
+						Required: true,
+					},
+					"arn": &Schema{
+						Type:     TypeString,
+						Computed: true,
+					},
+				},
+				Read: func(d *ResourceData, m interface{}) error {
+					if m != 42 {
+						return fmt.Errorf("meta not passed")
+					}
+
+					d.SetId("foo")
+					return d.Set("arn", "arn:"+d.Get("name").(string))
+				},
+			},
+		},
+	}
+	p.SetMeta(42)
+
+	c, err := config.NewRawConfig(map[string]interface{}{"name": "bar"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	rc := terraform.NewResourceConfig(c)
+
+	state, err := p.ReadDataSource(&terraform.InstanceInfo{Type: "foo"}, rc)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &terraform.InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"id":   "foo",
+			"name": "bar",
+			"arn":  "arn:bar",
+		},
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Fatalf("bad: %#v", state)
+	}
+
+	// Managed resources aren't data sources
+	if _, err := p.ReadDataSource(&terraform.InstanceInfo{Type: "bar"}, rc); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestProviderDiffSuppressFuncs(t *testing.T) {
+	p := &Provider{
+		ResourcesMap: map[string]*Resource{
+			"foo": &Resource{
+				Schema: map[string]*Schema{
+					"policy": &Schema{
+						Type:     TypeString,
+						Optional: true,
+						DiffSuppressFunc: func(k, old, new string) bool {
+							return strings.TrimSpace(old) == strings.TrimSpace(new)
+						},
+					},
+					"name": &Schema{
+						Type:     TypeString,
+						Optional: true,
+					},
+				},
+			},
+			"bar": &Resource{},
+		},
+	}
+
+	if funcs := p.DiffSuppressFuncs("bar"); len(funcs) != 0 {
+		t.Fatalf("bad: %#v", funcs)
+	}
+
+	funcs := p.DiffSuppressFuncs("foo")
+	if len(funcs) != 1 {
+		t.Fatalf("bad: %#v", funcs)
+	}
+	f, ok := funcs["policy"]
+	if !ok {
+		t.Fatal("policy should have a diff suppress func")
+	}
+	if !f("policy", "{}", " {}\n") {
+		t.Fatal("whitespace should be suppressed")
+	}
+	if f("policy", "{}", "{\"a\": 1}") {
+		t.Fatal("a real change should not be suppressed")
+	}
+}
+
 func TestProviderMeta(t *testing.T) {
 	p := new(Provider)
 	if v := p.Meta(); v != nil {
@@ -50,6 +50,15 @@ type Resource struct {
 	// needs to make any remote API calls.
 	MigrateState StateMigrateFunc
 
+	// AttributeMigrations are optional migrations of the attributes of an
+	// InstanceState that was written under an older SchemaVersion, such as
+	// to rename an attribute. Unlike MigrateState, Terraform runs them
+	// before the instance is refreshed or diffed, one schema version at a
+	// time, see terraform.ResourceProviderMigrator. The Version of a
+	// migration is the schema version that the attributes are in once it
+	// has run, so it can't be newer than SchemaVersion.
+	AttributeMigrations []AttributeMigration
+
 	// The functions below are the CRUD operations for this resource.
 	//
 	// The only optional operation is Update. If Update is not implemented,
@@ -78,6 +87,30 @@ type Resource struct {
 	Update UpdateFunc
 	Delete DeleteFunc
 	Exists ExistsFunc
+
+	// ReadSecrets is an optional function that returns secrets of the
+	// resource that the provisioners may use but that must never be
+	// stored in the state, such as a generated admin password. The
+	// *ResourceData passed to ReadSecrets should _not_ be modified.
+	ReadSecrets ReadSecretsFunc
+
+	// EstimateCost is an optional function that estimates the change to
+	// the monthly cost of the resource from applying a diff, which is
+	// negative if it gets cheaper. The *ResourceData holds the planned
+	// values. It returns false if the cost can't be estimated.
+	EstimateCost EstimateCostFunc
+
+	// MigrateData is an optional function that moves the data of an
+	// instance that is being replaced, such as the contents of a
+	// database, from the old instance to its replacement. It is called
+	// with the old instance first, and only for create_before_destroy
+	// replacements, once the new instance is created.
+	MigrateData MigrateDataFunc
+
+	// Prerequisites are the names of the implicit prerequisites that this
+	// resource needs, in the PrerequisitesMap of its provider. Terraform
+	// ensures they exist before the resource is created or updated.
+	Prerequisites []string
 }
 
 // See Resource documentation.
@@ -95,6 +128,25 @@ type DeleteFunc func(*ResourceData, interface{}) error
 // See Resource documentation.
 type ExistsFunc func(*ResourceData, interface{}) (bool, error)
 
+// See Resource documentation.
+type ReadSecretsFunc func(*ResourceData, interface{}) (map[string]string, error)
+
+// See Resource documentation.
+type EstimateCostFunc func(*ResourceData, interface{}) (float64, bool, error)
+
+// See Resource documentation.
+type MigrateDataFunc func(*ResourceData, *ResourceData, interface{}) error
+
+// AttributeMigration is a migration of the attributes of a resource to
+// a schema version. See Resource documentation.
+type AttributeMigration struct {
+	Version int
+	Migrate AttributeMigrateFunc
+}
+
+// See Resource documentation.
+type AttributeMigrateFunc func(map[string]string, interface{}) error
+
 // See Resource documentation.
 type StateMigrateFunc func(
 	int, *terraform.InstanceState, interface{}) (*terraform.InstanceState, error)
@@ -215,6 +267,89 @@ func (r *Resource) Refresh(
 	return r.recordCurrentSchemaVersion(state), err
 }
 
+// ReadDataSource reads the data source with the given configuration,
+// and returns its state. The Read function is called with the values of
+// the configuration, as if they were being created.
+func (r *Resource) ReadDataSource(
+	c *terraform.ResourceConfig,
+	meta interface{}) (*terraform.InstanceState, error) {
+	diff, err := schemaMap(r.Schema).Diff(nil, c)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := schemaMap(r.Schema).Data(nil, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Read(data, meta); err != nil {
+		return nil, err
+	}
+
+	state := data.State()
+	if state != nil && state.ID == "" {
+		state = nil
+	}
+
+	return state, nil
+}
+
+// Secrets returns the secrets of the resource, or nil if the resource
+// has none.
+func (r *Resource) Secrets(
+	s *terraform.InstanceState,
+	meta interface{}) (map[string]string, error) {
+	if r.ReadSecrets == nil || s == nil || s.ID == "" {
+		return nil, nil
+	}
+
+	data, err := schemaMap(r.Schema).Data(s, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ReadSecrets(data, meta)
+}
+
+// Cost estimates the change to the monthly cost of the resource from
+// applying the diff. It returns false if the cost can't be estimated.
+func (r *Resource) Cost(
+	d *terraform.InstanceDiff,
+	meta interface{}) (float64, bool, error) {
+	if r.EstimateCost == nil {
+		return 0, false, nil
+	}
+
+	data, err := schemaMap(r.Schema).Data(nil, d)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return r.EstimateCost(data, meta)
+}
+
+// MoveData moves the data of the instance with the from state to the
+// instance with the to state, see MigrateData.
+func (r *Resource) MoveData(
+	from, to *terraform.InstanceState,
+	meta interface{}) error {
+	if r.MigrateData == nil {
+		return nil
+	}
+
+	fromData, err := schemaMap(r.Schema).Data(from, nil)
+	if err != nil {
+		return err
+	}
+	toData, err := schemaMap(r.Schema).Data(to, nil)
+	if err != nil {
+		return err
+	}
+
+	return r.MigrateData(fromData, toData, meta)
+}
+
 // InternalValidate should be called to validate the structure
 // of the resource.
 //
@@ -248,6 +383,18 @@ func (r *Resource) InternalValidate(topSchemaMap schemaMap) error {
 		tsm = schemaMap(r.Schema)
 	}
 
+	for _, m := range r.AttributeMigrations {
+		if m.Version > r.SchemaVersion {
+			return fmt.Errorf(
+				"AttributeMigrations: version %d is newer than SchemaVersion %d",
+				m.Version, r.SchemaVersion)
+		}
+		if m.Migrate == nil {
+			return fmt.Errorf(
+				"AttributeMigrations: version %d has no Migrate", m.Version)
+		}
+	}
+
 	return schemaMap(r.Schema).InternalValidate(tsm)
 }
 
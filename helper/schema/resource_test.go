@@ -312,6 +312,111 @@ func TestResourceApply_updateNoCallback(t *testing.T) {
 	}
 }
 
+func TestResourceSecrets(t *testing.T) {
+	r := &Resource{
+		Schema: map[string]*Schema{
+			"user": &Schema{
+				Type:     TypeString,
+				Optional: true,
+			},
+		},
+	}
+
+	r.ReadSecrets = func(d *ResourceData, m interface{}) (map[string]string, error) {
+		if m != 42 {
+			return nil, fmt.Errorf("meta not passed")
+		}
+
+		return map[string]string{
+			"password": d.Id() + "-" + d.Get("user").(string),
+		}, nil
+	}
+
+	s := &terraform.InstanceState{
+		ID: "bar",
+		Attributes: map[string]string{
+			"user": "admin",
+		},
+	}
+
+	actual, err := r.Secrets(s, 42)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{"password": "bar-admin"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestResourceSecrets_none(t *testing.T) {
+	r := &Resource{
+		Schema: map[string]*Schema{
+			"user": &Schema{
+				Type:     TypeString,
+				Optional: true,
+			},
+		},
+	}
+
+	s := &terraform.InstanceState{ID: "bar"}
+	actual, err := r.Secrets(s, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestResourceCost(t *testing.T) {
+	r := &Resource{
+		Schema: map[string]*Schema{
+			"instances": &Schema{
+				Type:     TypeInt,
+				Optional: true,
+			},
+		},
+	}
+
+	r.EstimateCost = func(d *ResourceData, m interface{}) (float64, bool, error) {
+		if m != 42 {
+			return 0, false, fmt.Errorf("meta not passed")
+		}
+
+		return float64(d.Get("instances").(int)) * 9.5, true, nil
+	}
+
+	d := &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"instances": &terraform.ResourceAttrDiff{
+				New: "2",
+			},
+		},
+	}
+
+	cost, ok, err := r.Cost(d, 42)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok || cost != 19 {
+		t.Fatalf("bad: %v %v", cost, ok)
+	}
+}
+
+func TestResourceCost_none(t *testing.T) {
+	r := &Resource{}
+
+	_, ok, err := r.Cost(&terraform.InstanceDiff{}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("cost should not be known")
+	}
+}
+
 func TestResourceInternalValidate(t *testing.T) {
 	cases := []struct {
 		In  *Resource
@@ -335,6 +440,31 @@ func TestResourceInternalValidate(t *testing.T) {
 			},
 			true,
 		},
+
+		// Attribute migration newer than the schema version
+		{
+			&Resource{
+				SchemaVersion: 1,
+				AttributeMigrations: []AttributeMigration{
+					AttributeMigration{
+						Version: 2,
+						Migrate: func(map[string]string, interface{}) error {
+							return nil
+						},
+					},
+				},
+			},
+			true,
+		},
+
+		// Attribute migration without a function
+		{
+			&Resource{
+				SchemaVersion:       1,
+				AttributeMigrations: []AttributeMigration{AttributeMigration{Version: 1}},
+			},
+			true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -139,6 +139,20 @@ type Schema struct {
 	//
 	// ValidateFunc currently only works for primitive types.
 	ValidateFunc SchemaValidateFunc
+
+	// DiffSuppressFunc allows a top-level field to suppress the diff of a
+	// change whose old and new values are equivalent even though they're
+	// written differently, such as two JSON documents that only differ
+	// in whitespace. It is yielded the key of the changed value within
+	// the field along with the old and new values, and returns true if
+	// the change should be suppressed.
+	DiffSuppressFunc SchemaDiffSuppressFunc
+
+	// JSON marks a top-level TypeString field whose value is a JSON
+	// document, so that a change to an equivalent document, such as one
+	// that only differs in key order or whitespace, isn't a diff. See
+	// terraform.ResourceType.JSONAttributes.
+	JSON bool
 }
 
 // SchemaDefaultFunc is a function called to return a default value for
@@ -185,6 +199,10 @@ type SchemaStateFunc func(interface{}) string
 // schema.
 type SchemaValidateFunc func(interface{}, string) ([]string, []error)
 
+// SchemaDiffSuppressFunc is a function used to suppress the diff of a
+// single field whose old and new values are equivalent.
+type SchemaDiffSuppressFunc func(k, old, new string) bool
+
 func (s *Schema) GoString() string {
 	return fmt.Sprintf("*%#v", *s)
 }
@@ -446,6 +464,10 @@ func (m schemaMap) InternalValidate(topSchemaMap schemaMap) error {
 			return fmt.Errorf("%s: Default cannot be set with Required", k)
 		}
 
+		if v.JSON && v.Type != TypeString {
+			return fmt.Errorf("%s: JSON can only be set on strings", k)
+		}
+
 		if len(v.ComputedWhen) > 0 && !v.Computed {
 			return fmt.Errorf("%s: ComputedWhen can only be set with Computed", k)
 		}
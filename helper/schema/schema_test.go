@@ -2649,6 +2649,18 @@ func TestSchemaMap_InternalValidate(t *testing.T) {
 			false,
 		},
 
+		// JSON on something other than a string
+		{
+			map[string]*Schema{
+				"foo": &Schema{
+					Type:     TypeInt,
+					Optional: true,
+					JSON:     true,
+				},
+			},
+			true,
+		},
+
 		// No optional and no required
 		{
 			map[string]*Schema{
@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"fmt"
+	"log"
 	"net/rpc"
 
 	"github.com/hashicorp/terraform/terraform"
@@ -100,6 +102,52 @@ func (p *ResourceProvider) Configure(c *terraform.ResourceConfig) error {
 }
 
 func (p *ResourceProvider) Apply(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState,
+	d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
+	return p.apply("Apply", info, s, d)
+}
+
+func (p *ResourceProvider) DryRunApply(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState,
+	d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
+	return p.apply("DryRunApply", info, s, d)
+}
+
+func (p *ResourceProvider) CustomApply(t string) terraform.ApplyFunc {
+	var ok bool
+	if err := p.Client.Call(p.Name+".HasCustomApply", t, &ok); err != nil {
+		log.Printf("[ERR] plugin: error checking for custom apply: %s", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	return func(
+		info *terraform.InstanceInfo,
+		s *terraform.InstanceState,
+		d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
+		return p.apply("CustomApply", info, s, d)
+	}
+}
+
+func (p *ResourceProvider) CancelApply(info *terraform.InstanceInfo) error {
+	var resp ResourceProviderCancelApplyResponse
+	err := p.Client.Call(p.Name+".CancelApply", info, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return err
+}
+
+func (p *ResourceProvider) apply(
+	method string,
 	info *terraform.InstanceInfo,
 	s *terraform.InstanceState,
 	d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
@@ -110,12 +158,15 @@ func (p *ResourceProvider) Apply(
 		Diff:  d,
 	}
 
-	err := p.Client.Call(p.Name+".Apply", args, &resp)
+	err := p.Client.Call(p.Name+"."+method, args, &resp)
 	if err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
 		err = resp.Error
+		if resp.ErrorClass != terraform.ApplyErrorUnclassified {
+			err = &terraform.ApplyError{Class: resp.ErrorClass, Err: err}
+		}
 	}
 
 	return resp.State, err
@@ -162,6 +213,210 @@ func (p *ResourceProvider) Refresh(
 	return resp.State, err
 }
 
+func (p *ResourceProvider) ReadSecrets(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState) (map[string]string, error) {
+	var resp ResourceProviderReadSecretsResponse
+	args := &ResourceProviderReadSecretsArgs{
+		Info:  info,
+		State: s,
+	}
+
+	err := p.Client.Call(p.Name+".ReadSecrets", args, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return resp.Secrets, err
+}
+
+func (p *ResourceProvider) EstimateCost(
+	info *terraform.InstanceInfo,
+	d *terraform.InstanceDiff) (float64, bool, error) {
+	var resp ResourceProviderEstimateCostResponse
+	args := &ResourceProviderEstimateCostArgs{
+		Info: info,
+		Diff: d,
+	}
+
+	err := p.Client.Call(p.Name+".EstimateCost", args, &resp)
+	if err != nil {
+		return 0, false, err
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return resp.Cost, resp.Known, err
+}
+
+func (p *ResourceProvider) DataMigration(t string) terraform.MigrateDataFunc {
+	var ok bool
+	if err := p.Client.Call(p.Name+".HasDataMigration", t, &ok); err != nil {
+		log.Printf("[ERR] plugin: error checking for data migration: %s", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	return func(
+		info *terraform.InstanceInfo,
+		from, to *terraform.InstanceState) error {
+		var resp ResourceProviderMigrateDataResponse
+		args := &ResourceProviderMigrateDataArgs{
+			Info: info,
+			From: from,
+			To:   to,
+		}
+
+		err := p.Client.Call(p.Name+".MigrateData", args, &resp)
+		if err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			err = resp.Error
+		}
+
+		return err
+	}
+}
+
+func (p *ResourceProvider) AttributeMigrations(
+	t string) []terraform.AttributeMigration {
+	var versions []int
+	err := p.Client.Call(p.Name+".AttributeMigrationVersions", t, &versions)
+	if err != nil {
+		log.Printf("[ERR] plugin: error getting the attribute migrations: %s", err)
+		return nil
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	result := make([]terraform.AttributeMigration, len(versions))
+	for i, v := range versions {
+		args := ResourceProviderMigrateAttributesArgs{Type: t, Version: v}
+		result[i] = terraform.AttributeMigration{
+			Version: v,
+			Migrate: func(attrs map[string]string) error {
+				args := args
+				args.Attributes = attrs
+
+				var resp ResourceProviderMigrateAttributesResponse
+				err := p.Client.Call(p.Name+".MigrateAttributes", &args, &resp)
+				if err != nil {
+					return err
+				}
+				if resp.Error != nil {
+					return resp.Error
+				}
+
+				// The attributes are migrated in place
+				for k := range attrs {
+					delete(attrs, k)
+				}
+				for k, v := range resp.Attributes {
+					attrs[k] = v
+				}
+
+				return nil
+			},
+		}
+	}
+
+	return result
+}
+
+func (p *ResourceProvider) ReadDataSource(
+	info *terraform.InstanceInfo,
+	c *terraform.ResourceConfig) (*terraform.InstanceState, error) {
+	var resp ResourceProviderReadDataSourceResponse
+	args := &ResourceProviderReadDataSourceArgs{
+		Info:   info,
+		Config: c,
+	}
+
+	err := p.Client.Call(p.Name+".ReadDataSource", args, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return resp.State, err
+}
+
+func (p *ResourceProvider) DiffSuppressFuncs(
+	t string) map[string]terraform.DiffSuppressFunc {
+	var keys []string
+	if err := p.Client.Call(p.Name+".DiffSuppressKeys", t, &keys); err != nil {
+		log.Printf("[ERR] plugin: error getting the diff suppress keys: %s", err)
+		return nil
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	result := make(map[string]terraform.DiffSuppressFunc, len(keys))
+	for _, key := range keys {
+		args := ResourceProviderSuppressDiffArgs{Type: t, Key: key}
+		result[key] = func(k, old, new string) bool {
+			args := args
+			args.Attr, args.Old, args.New = k, old, new
+
+			var suppress bool
+			err := p.Client.Call(p.Name+".SuppressDiff", &args, &suppress)
+			if err != nil {
+				log.Printf("[ERR] plugin: error suppressing the diff of %s: %s", k, err)
+				return false
+			}
+
+			return suppress
+		}
+	}
+
+	return result
+}
+
+func (p *ResourceProvider) ConcurrencyLimit() int {
+	var result int
+	err := p.Client.Call(p.Name+".ConcurrencyLimit", new(interface{}), &result)
+	if err != nil {
+		log.Printf("[ERR] plugin: error getting the concurrency limit: %s", err)
+		return 0
+	}
+
+	return result
+}
+
+func (p *ResourceProvider) Prerequisites(t string) []string {
+	var result []string
+	if err := p.Client.Call(p.Name+".Prerequisites", t, &result); err != nil {
+		log.Printf("[ERR] plugin: error getting the prerequisites: %s", err)
+		return nil
+	}
+
+	return result
+}
+
+func (p *ResourceProvider) EnsurePrerequisite(name string) error {
+	var resp ResourceProviderEnsurePrerequisiteResponse
+	err := p.Client.Call(p.Name+".EnsurePrerequisite", name, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return err
+}
+
 func (p *ResourceProvider) Resources() []terraform.ResourceType {
 	var result []terraform.ResourceType
 
@@ -206,7 +461,12 @@ type ResourceProviderApplyArgs struct {
 }
 
 type ResourceProviderApplyResponse struct {
-	State *terraform.InstanceState
+	State      *terraform.InstanceState
+	Error      *BasicError
+	ErrorClass terraform.ApplyErrorClass
+}
+
+type ResourceProviderCancelApplyResponse struct {
 	Error *BasicError
 }
 
@@ -231,6 +491,70 @@ type ResourceProviderRefreshResponse struct {
 	Error *BasicError
 }
 
+type ResourceProviderReadSecretsArgs struct {
+	Info  *terraform.InstanceInfo
+	State *terraform.InstanceState
+}
+
+type ResourceProviderReadSecretsResponse struct {
+	Secrets map[string]string
+	Error   *BasicError
+}
+
+type ResourceProviderEstimateCostArgs struct {
+	Info *terraform.InstanceInfo
+	Diff *terraform.InstanceDiff
+}
+
+type ResourceProviderEstimateCostResponse struct {
+	Cost  float64
+	Known bool
+	Error *BasicError
+}
+
+type ResourceProviderMigrateDataArgs struct {
+	Info *terraform.InstanceInfo
+	From *terraform.InstanceState
+	To   *terraform.InstanceState
+}
+
+type ResourceProviderMigrateDataResponse struct {
+	Error *BasicError
+}
+
+type ResourceProviderEnsurePrerequisiteResponse struct {
+	Error *BasicError
+}
+
+type ResourceProviderMigrateAttributesArgs struct {
+	Type       string
+	Version    int
+	Attributes map[string]string
+}
+
+type ResourceProviderMigrateAttributesResponse struct {
+	Attributes map[string]string
+	Error      *BasicError
+}
+
+type ResourceProviderReadDataSourceArgs struct {
+	Info   *terraform.InstanceInfo
+	Config *terraform.ResourceConfig
+}
+
+type ResourceProviderReadDataSourceResponse struct {
+	State *terraform.InstanceState
+	Error *BasicError
+}
+
+type ResourceProviderSuppressDiffArgs struct {
+	Type string
+	Key  string
+	Attr string
+	Old  string
+	New  string
+}
+
 type ResourceProviderValidateArgs struct {
 	Config *terraform.ResourceConfig
 }
@@ -322,12 +646,78 @@ func (s *ResourceProviderServer) Apply(
 	result *ResourceProviderApplyResponse) error {
 	state, err := s.Provider.Apply(args.Info, args.State, args.Diff)
 	*result = ResourceProviderApplyResponse{
-		State: state,
+		State:      state,
+		Error:      NewBasicError(err),
+		ErrorClass: terraform.ApplyErrorClassOf(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) DryRunApply(
+	args *ResourceProviderApplyArgs,
+	result *ResourceProviderApplyResponse) error {
+	dr, ok := s.Provider.(terraform.ResourceProviderDryRunner)
+	if !ok {
+		*result = ResourceProviderApplyResponse{
+			State: terraform.ProjectedState(args.State, args.Diff),
+		}
+		return nil
+	}
+
+	state, err := dr.DryRunApply(args.Info, args.State, args.Diff)
+	*result = ResourceProviderApplyResponse{
+		State:      state,
+		Error:      NewBasicError(err),
+		ErrorClass: terraform.ApplyErrorClassOf(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) CancelApply(
+	info *terraform.InstanceInfo,
+	result *ResourceProviderCancelApplyResponse) error {
+	var err error
+	if c, ok := s.Provider.(terraform.ResourceProviderApplyCanceler); ok {
+		err = c.CancelApply(info)
+	}
+	*result = ResourceProviderCancelApplyResponse{
 		Error: NewBasicError(err),
 	}
 	return nil
 }
 
+func (s *ResourceProviderServer) HasCustomApply(
+	t string,
+	result *bool) error {
+	ca, ok := s.Provider.(terraform.ResourceProviderCustomApplier)
+	*result = ok && ca.CustomApply(t) != nil
+	return nil
+}
+
+func (s *ResourceProviderServer) CustomApply(
+	args *ResourceProviderApplyArgs,
+	result *ResourceProviderApplyResponse) error {
+	var apply terraform.ApplyFunc
+	if ca, ok := s.Provider.(terraform.ResourceProviderCustomApplier); ok {
+		apply = ca.CustomApply(args.Info.Type)
+	}
+	if apply == nil {
+		*result = ResourceProviderApplyResponse{
+			Error: NewBasicError(fmt.Errorf(
+				"no custom apply for resource type: %s", args.Info.Type)),
+		}
+		return nil
+	}
+
+	state, err := apply(args.Info, args.State, args.Diff)
+	*result = ResourceProviderApplyResponse{
+		State:      state,
+		Error:      NewBasicError(err),
+		ErrorClass: terraform.ApplyErrorClassOf(err),
+	}
+	return nil
+}
+
 func (s *ResourceProviderServer) Diff(
 	args *ResourceProviderDiffArgs,
 	result *ResourceProviderDiffResponse) error {
@@ -350,6 +740,200 @@ func (s *ResourceProviderServer) Refresh(
 	return nil
 }
 
+func (s *ResourceProviderServer) ReadSecrets(
+	args *ResourceProviderReadSecretsArgs,
+	result *ResourceProviderReadSecretsResponse) error {
+	reader, ok := s.Provider.(terraform.ResourceProviderSecretReader)
+	if !ok {
+		*result = ResourceProviderReadSecretsResponse{}
+		return nil
+	}
+
+	secrets, err := reader.ReadSecrets(args.Info, args.State)
+	*result = ResourceProviderReadSecretsResponse{
+		Secrets: secrets,
+		Error:   NewBasicError(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) EstimateCost(
+	args *ResourceProviderEstimateCostArgs,
+	result *ResourceProviderEstimateCostResponse) error {
+	e, ok := s.Provider.(terraform.ResourceProviderCostEstimator)
+	if !ok {
+		*result = ResourceProviderEstimateCostResponse{}
+		return nil
+	}
+
+	cost, known, err := e.EstimateCost(args.Info, args.Diff)
+	*result = ResourceProviderEstimateCostResponse{
+		Cost:  cost,
+		Known: known,
+		Error: NewBasicError(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) HasDataMigration(
+	t string,
+	result *bool) error {
+	m, ok := s.Provider.(terraform.ResourceProviderDataMigrator)
+	*result = ok && m.DataMigration(t) != nil
+	return nil
+}
+
+func (s *ResourceProviderServer) MigrateData(
+	args *ResourceProviderMigrateDataArgs,
+	result *ResourceProviderMigrateDataResponse) error {
+	var migrate terraform.MigrateDataFunc
+	if m, ok := s.Provider.(terraform.ResourceProviderDataMigrator); ok {
+		migrate = m.DataMigration(args.Info.Type)
+	}
+	if migrate == nil {
+		*result = ResourceProviderMigrateDataResponse{
+			Error: NewBasicError(fmt.Errorf(
+				"no data migration for resource type: %s", args.Info.Type)),
+		}
+		return nil
+	}
+
+	err := migrate(args.Info, args.From, args.To)
+	*result = ResourceProviderMigrateDataResponse{
+		Error: NewBasicError(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) AttributeMigrationVersions(
+	t string,
+	result *[]int) error {
+	*result = nil
+	if m, ok := s.Provider.(terraform.ResourceProviderMigrator); ok {
+		for _, migration := range m.AttributeMigrations(t) {
+			*result = append(*result, migration.Version)
+		}
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) MigrateAttributes(
+	args *ResourceProviderMigrateAttributesArgs,
+	result *ResourceProviderMigrateAttributesResponse) error {
+	var migrate func(map[string]string) error
+	if m, ok := s.Provider.(terraform.ResourceProviderMigrator); ok {
+		for _, migration := range m.AttributeMigrations(args.Type) {
+			if migration.Version == args.Version {
+				migrate = migration.Migrate
+			}
+		}
+	}
+	if migrate == nil {
+		*result = ResourceProviderMigrateAttributesResponse{
+			Error: NewBasicError(fmt.Errorf(
+				"no attribute migration to schema version %d for resource type: %s",
+				args.Version, args.Type)),
+		}
+		return nil
+	}
+
+	attrs := args.Attributes
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	err := migrate(attrs)
+	*result = ResourceProviderMigrateAttributesResponse{
+		Attributes: attrs,
+		Error:      NewBasicError(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) ReadDataSource(
+	args *ResourceProviderReadDataSourceArgs,
+	result *ResourceProviderReadDataSourceResponse) error {
+	reader, ok := s.Provider.(terraform.ResourceProviderDataSourceReader)
+	if !ok {
+		*result = ResourceProviderReadDataSourceResponse{
+			Error: NewBasicError(fmt.Errorf(
+				"the provider doesn't support data sources")),
+		}
+		return nil
+	}
+
+	state, err := reader.ReadDataSource(args.Info, args.Config)
+	*result = ResourceProviderReadDataSourceResponse{
+		State: state,
+		Error: NewBasicError(err),
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) DiffSuppressKeys(
+	t string,
+	result *[]string) error {
+	*result = nil
+	if ds, ok := s.Provider.(terraform.ResourceProviderDiffSuppressor); ok {
+		for k, f := range ds.DiffSuppressFuncs(t) {
+			if f != nil {
+				*result = append(*result, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) SuppressDiff(
+	args *ResourceProviderSuppressDiffArgs,
+	result *bool) error {
+	*result = false
+	if ds, ok := s.Provider.(terraform.ResourceProviderDiffSuppressor); ok {
+		if f := ds.DiffSuppressFuncs(args.Type)[args.Key]; f != nil {
+			*result = f(args.Attr, args.Old, args.New)
+		}
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) ConcurrencyLimit(
+	nothing interface{},
+	result *int) error {
+	*result = 0
+	if l, ok := s.Provider.(terraform.ResourceProviderConcurrencyLimiter); ok {
+		*result = l.ConcurrencyLimit()
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) Prerequisites(
+	t string,
+	result *[]string) error {
+	*result = nil
+	if r, ok := s.Provider.(terraform.ResourceProviderPrerequisiter); ok {
+		*result = r.Prerequisites(t)
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) EnsurePrerequisite(
+	name string,
+	result *ResourceProviderEnsurePrerequisiteResponse) error {
+	r, ok := s.Provider.(terraform.ResourceProviderPrerequisiter)
+	if !ok {
+		*result = ResourceProviderEnsurePrerequisiteResponse{
+			Error: NewBasicError(fmt.Errorf(
+				"the provider doesn't have prerequisites")),
+		}
+		return nil
+	}
+
+	err := r.EnsurePrerequisite(name)
+	*result = ResourceProviderEnsurePrerequisiteResponse{
+		Error: NewBasicError(err),
+	}
+	return nil
+}
+
 func (s *ResourceProviderServer) Resources(
 	nothing interface{},
 	result *[]terraform.ResourceType) error {
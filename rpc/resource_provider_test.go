@@ -3,8 +3,11 @@ package rpc
 import (
 	"errors"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -164,6 +167,196 @@ func TestResourceProvider_apply(t *testing.T) {
 	}
 }
 
+func TestResourceProvider_applyErrorClass(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	p.ApplyReturnError = &terraform.ApplyError{
+		Class: terraform.ApplyErrorTransient,
+		Err:   errors.New("throttled"),
+	}
+
+	// Apply
+	info := &terraform.InstanceInfo{}
+	state := &terraform.InstanceState{}
+	diff := &terraform.InstanceDiff{}
+	_, err = provider.Apply(info, state, diff)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if err.Error() != "throttled" {
+		t.Fatalf("bad: %s", err)
+	}
+	if terraform.ApplyErrorClassOf(err) != terraform.ApplyErrorTransient {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestResourceProvider_dryRunApply(t *testing.T) {
+	p := &testDryRunProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		State:                &terraform.InstanceState{ID: "bar"},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Id: "aws_instance.foo"}
+	state := &terraform.InstanceState{ID: "foo"}
+	diff := &terraform.InstanceDiff{}
+	actual, err := provider.DryRunApply(info, state, diff)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.DryRunState, state) {
+		t.Fatalf("bad: %#v", p.DryRunState)
+	}
+	if !reflect.DeepEqual(actual, p.State) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+}
+
+func TestResourceProvider_dryRunApplyNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	// Without a dry run of the provider, the state is projected from the
+	// diff
+	info := &terraform.InstanceInfo{Id: "aws_instance.foo"}
+	state := &terraform.InstanceState{ID: "foo"}
+	diff := &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"num": &terraform.ResourceAttrDiff{Old: "1", New: "2"},
+		},
+	}
+	actual, err := provider.DryRunApply(info, state, diff)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual.ID != "foo" || actual.Attributes["num"] != "2" {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+}
+
+func TestResourceProvider_cancelApply(t *testing.T) {
+	p := &testCancelApplyProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"}
+	if err := provider.CancelApply(info); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.CancelInfo, info) {
+		t.Fatalf("bad: %#v", p.CancelInfo)
+	}
+}
+
+func TestResourceProvider_cancelApplyNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"}
+	if err := provider.CancelApply(info); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestResourceProvider_customApply(t *testing.T) {
+	var applied *terraform.InstanceDiff
+	p := &testCustomApplyProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Funcs: map[string]terraform.ApplyFunc{
+			"aws_instance": func(
+				info *terraform.InstanceInfo,
+				s *terraform.InstanceState,
+				d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
+				applied = d
+				return &terraform.InstanceState{ID: "bob"}, nil
+			},
+		},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if f := provider.CustomApply("aws_eip"); f != nil {
+		t.Fatal("should not have custom apply")
+	}
+
+	f := provider.CustomApply("aws_instance")
+	if f == nil {
+		t.Fatal("should have custom apply")
+	}
+
+	info := &terraform.InstanceInfo{Type: "aws_instance"}
+	diff := &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"ami": &terraform.ResourceAttrDiff{New: "bar"},
+		},
+	}
+	newState, err := f(info, &terraform.InstanceState{}, diff)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if !reflect.DeepEqual(applied, diff) {
+		t.Fatalf("bad: %#v", applied)
+	}
+	if newState == nil || newState.ID != "bob" {
+		t.Fatalf("bad: %#v", newState)
+	}
+}
+
+func TestResourceProvider_customApplyNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if f := provider.CustomApply("aws_instance"); f != nil {
+		t.Fatal("should not have custom apply")
+	}
+}
+
 func TestResourceProvider_diff(t *testing.T) {
 	p := new(terraform.MockResourceProvider)
 	client, server := testClientServer(t)
@@ -266,6 +459,465 @@ func TestResourceProvider_refresh(t *testing.T) {
 	}
 }
 
+func TestResourceProvider_readSecrets(t *testing.T) {
+	p := &testSecretsProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Secrets:              map[string]string{"password": "hunter2"},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Type: "aws_instance"}
+	state := &terraform.InstanceState{ID: "foo"}
+	secrets, err := provider.ReadSecrets(info, state)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.ReadState, state) {
+		t.Fatalf("bad: %#v", p.ReadState)
+	}
+	if !reflect.DeepEqual(secrets, p.Secrets) {
+		t.Fatalf("bad: %#v", secrets)
+	}
+}
+
+func TestResourceProvider_readSecretsError(t *testing.T) {
+	p := &testSecretsProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Error:                errors.New("vault sealed"),
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Type: "aws_instance"}
+	state := &terraform.InstanceState{ID: "foo"}
+	_, err = provider.ReadSecrets(info, state)
+	if err == nil || err.Error() != "vault sealed" {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestResourceProvider_readSecretsNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Type: "aws_instance"}
+	state := &terraform.InstanceState{ID: "foo"}
+	secrets, err := provider.ReadSecrets(info, state)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(secrets) != 0 {
+		t.Fatalf("bad: %#v", secrets)
+	}
+}
+
+func TestResourceProvider_estimateCost(t *testing.T) {
+	p := &testCostProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Cost:                 12.5,
+		Known:                true,
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Type: "aws_instance"}
+	diff := &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"instance_type": &terraform.ResourceAttrDiff{New: "m3.large"},
+		},
+	}
+	cost, ok, err := provider.EstimateCost(info, diff)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.EstimateDiff, diff) {
+		t.Fatalf("bad: %#v", p.EstimateDiff)
+	}
+	if !ok || cost != 12.5 {
+		t.Fatalf("bad: %v %v", cost, ok)
+	}
+}
+
+func TestResourceProvider_estimateCostNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Type: "aws_instance"}
+	_, ok, err := provider.EstimateCost(info, &terraform.InstanceDiff{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok {
+		t.Fatal("cost should not be known")
+	}
+}
+
+func TestResourceProvider_dataMigration(t *testing.T) {
+	p := &testMigrateDataProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Types:                map[string]bool{"aws_db_instance": true},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if f := provider.DataMigration("aws_instance"); f != nil {
+		t.Fatal("should not have a data migration")
+	}
+
+	f := provider.DataMigration("aws_db_instance")
+	if f == nil {
+		t.Fatal("should have a data migration")
+	}
+
+	info := &terraform.InstanceInfo{Type: "aws_db_instance"}
+	from := &terraform.InstanceState{ID: "old"}
+	to := &terraform.InstanceState{ID: "new"}
+	if err := f(info, from, to); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.From, from) {
+		t.Fatalf("bad: %#v", p.From)
+	}
+	if !reflect.DeepEqual(p.To, to) {
+		t.Fatalf("bad: %#v", p.To)
+	}
+}
+
+func TestResourceProvider_dataMigrationError(t *testing.T) {
+	p := &testMigrateDataProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Types:                map[string]bool{"aws_db_instance": true},
+		Error:                errors.New("disk full"),
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	f := provider.DataMigration("aws_db_instance")
+	if f == nil {
+		t.Fatal("should have a data migration")
+	}
+
+	info := &terraform.InstanceInfo{Type: "aws_db_instance"}
+	err = f(info, &terraform.InstanceState{ID: "old"}, &terraform.InstanceState{ID: "new"})
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestResourceProvider_dataMigrationNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if f := provider.DataMigration("aws_db_instance"); f != nil {
+		t.Fatal("should not have a data migration")
+	}
+}
+
+func TestResourceProvider_attributeMigrations(t *testing.T) {
+	p := &testMigratorProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Migrations: map[string][]terraform.AttributeMigration{
+			"aws_instance": []terraform.AttributeMigration{
+				terraform.AttributeMigration{
+					Version: 1,
+					Migrate: func(attrs map[string]string) error {
+						attrs["name"] = attrs["tag"]
+						delete(attrs, "tag")
+						return nil
+					},
+				},
+				terraform.AttributeMigration{
+					Version: 2,
+					Migrate: func(attrs map[string]string) error {
+						return errors.New("bad name")
+					},
+				},
+			},
+		},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if ms := provider.AttributeMigrations("aws_eip"); ms != nil {
+		t.Fatalf("bad: %#v", ms)
+	}
+
+	ms := provider.AttributeMigrations("aws_instance")
+	if len(ms) != 2 || ms[0].Version != 1 || ms[1].Version != 2 {
+		t.Fatalf("bad: %#v", ms)
+	}
+
+	attrs := map[string]string{"id": "foo", "tag": "web"}
+	if err := ms[0].Migrate(attrs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string]string{"id": "foo", "name": "web"}
+	if !reflect.DeepEqual(attrs, expected) {
+		t.Fatalf("bad: %#v", attrs)
+	}
+
+	err = ms[1].Migrate(attrs)
+	if err == nil || err.Error() != "bad name" {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestResourceProvider_attributeMigrationsNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if ms := provider.AttributeMigrations("aws_instance"); ms != nil {
+		t.Fatalf("bad: %#v", ms)
+	}
+}
+
+func TestResourceProvider_readDataSource(t *testing.T) {
+	p := &testDataSourceProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		State:                &terraform.InstanceState{ID: "ami-123"},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"}
+	config := &terraform.ResourceConfig{
+		Raw: map[string]interface{}{"name": "ubuntu"},
+	}
+	state, err := provider.ReadDataSource(info, config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(p.ReadConfig, config) {
+		t.Fatalf("bad: %#v", p.ReadConfig)
+	}
+	if !reflect.DeepEqual(state, p.State) {
+		t.Fatalf("bad: %#v", state)
+	}
+}
+
+func TestResourceProvider_readDataSourceUnsupported(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	info := &terraform.InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"}
+	_, err = provider.ReadDataSource(info, &terraform.ResourceConfig{})
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestResourceProvider_diffSuppressFuncs(t *testing.T) {
+	p := &testDiffSuppressProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if funcs := provider.DiffSuppressFuncs("aws_instance"); len(funcs) != 0 {
+		t.Fatalf("bad: %#v", funcs)
+	}
+
+	funcs := provider.DiffSuppressFuncs("aws_iam_policy")
+	if len(funcs) != 1 {
+		t.Fatalf("bad: %#v", funcs)
+	}
+	f, ok := funcs["policy"]
+	if !ok {
+		t.Fatal("policy should have a diff suppress func")
+	}
+	if !f("policy", "{}", " {} ") {
+		t.Fatal("whitespace should be suppressed")
+	}
+	if f("policy", "{}", "{\"a\": 1}") {
+		t.Fatal("a real change should not be suppressed")
+	}
+	if p.Key != "policy" {
+		t.Fatalf("bad: %s", p.Key)
+	}
+}
+
+func TestResourceProvider_diffSuppressFuncsNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if funcs := provider.DiffSuppressFuncs("aws_iam_policy"); len(funcs) != 0 {
+		t.Fatalf("bad: %#v", funcs)
+	}
+}
+
+func TestResourceProvider_concurrencyLimit(t *testing.T) {
+	p := &testLimitedProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Limit:                3,
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if n := provider.ConcurrencyLimit(); n != 3 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestResourceProvider_concurrencyLimitNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if n := provider.ConcurrencyLimit(); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestResourceProvider_concurrencyLimitSchema(t *testing.T) {
+	p := &schema.Provider{MaxConcurrentCalls: 2}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	// The limit of the plugin is used by the walk
+	ctx := &terraform.BuiltinEvalContext{
+		PathValue: terraform.RootModulePath,
+		Providers: map[string]terraform.ResourceProviderFactory{
+			"aws": func() (terraform.ResourceProvider, error) {
+				return provider, nil
+			},
+		},
+		ProviderCache: make(map[string]terraform.ResourceProvider),
+		ProviderLock:  new(sync.Mutex),
+	}
+	if _, err := ctx.InitProvider("aws"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if s := ctx.ProviderSemaphore(provider); cap(s) != 2 {
+		t.Fatalf("bad: %d", cap(s))
+	}
+}
+
+func TestResourceProvider_prerequisites(t *testing.T) {
+	p := &testPrerequisiteProvider{
+		MockResourceProvider: new(terraform.MockResourceProvider),
+		Names:                map[string][]string{"aws_instance": []string{"vpc"}},
+	}
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if names := provider.Prerequisites("aws_eip"); len(names) != 0 {
+		t.Fatalf("bad: %#v", names)
+	}
+	names := provider.Prerequisites("aws_instance")
+	if !reflect.DeepEqual(names, []string{"vpc"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	if err := provider.EnsurePrerequisite("vpc"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.Ensured != "vpc" {
+		t.Fatalf("bad: %#v", p.Ensured)
+	}
+
+	p.Error = errors.New("quota exceeded")
+	err = provider.EnsurePrerequisite("vpc")
+	if err == nil || err.Error() != "quota exceeded" {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestResourceProvider_prerequisitesNone(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+	client, server := testClientServer(t)
+	name, err := Register(server, p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := &ResourceProvider{Client: client, Name: name}
+
+	if names := provider.Prerequisites("aws_instance"); len(names) != 0 {
+		t.Fatalf("bad: %#v", names)
+	}
+	if err := provider.EnsurePrerequisite("vpc"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
 func TestResourceProvider_resources(t *testing.T) {
 	p := new(terraform.MockResourceProvider)
 	client, server := testClientServer(t)
@@ -276,8 +928,8 @@ func TestResourceProvider_resources(t *testing.T) {
 	provider := &ResourceProvider{Client: client, Name: name}
 
 	expected := []terraform.ResourceType{
-		{"foo"},
-		{"bar"},
+		{Name: "foo"},
+		{Name: "bar"},
 	}
 
 	p.ResourcesReturn = expected
@@ -516,3 +1168,160 @@ func TestResourceProvider_close(t *testing.T) {
 		t.Fatal("should have error")
 	}
 }
+
+type testCustomApplyProvider struct {
+	*terraform.MockResourceProvider
+
+	Funcs map[string]terraform.ApplyFunc
+}
+
+func (p *testCustomApplyProvider) CustomApply(t string) terraform.ApplyFunc {
+	return p.Funcs[t]
+}
+
+type testSecretsProvider struct {
+	*terraform.MockResourceProvider
+
+	Secrets   map[string]string
+	Error     error
+	ReadState *terraform.InstanceState
+}
+
+func (p *testSecretsProvider) ReadSecrets(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState) (map[string]string, error) {
+	p.ReadState = s
+	return p.Secrets, p.Error
+}
+
+type testCostProvider struct {
+	*terraform.MockResourceProvider
+
+	Cost         float64
+	Known        bool
+	EstimateDiff *terraform.InstanceDiff
+}
+
+func (p *testCostProvider) EstimateCost(
+	info *terraform.InstanceInfo,
+	d *terraform.InstanceDiff) (float64, bool, error) {
+	p.EstimateDiff = d
+	return p.Cost, p.Known, nil
+}
+
+type testMigrateDataProvider struct {
+	*terraform.MockResourceProvider
+
+	Types    map[string]bool
+	Error    error
+	From, To *terraform.InstanceState
+}
+
+func (p *testMigrateDataProvider) DataMigration(t string) terraform.MigrateDataFunc {
+	if !p.Types[t] {
+		return nil
+	}
+
+	return func(info *terraform.InstanceInfo, from, to *terraform.InstanceState) error {
+		p.From, p.To = from, to
+		return p.Error
+	}
+}
+
+type testCancelApplyProvider struct {
+	*terraform.MockResourceProvider
+
+	CancelInfo *terraform.InstanceInfo
+}
+
+func (p *testCancelApplyProvider) CancelApply(info *terraform.InstanceInfo) error {
+	p.CancelInfo = info
+	return nil
+}
+
+type testMigratorProvider struct {
+	*terraform.MockResourceProvider
+
+	Migrations map[string][]terraform.AttributeMigration
+}
+
+func (p *testMigratorProvider) AttributeMigrations(
+	t string) []terraform.AttributeMigration {
+	return p.Migrations[t]
+}
+
+type testLimitedProvider struct {
+	*terraform.MockResourceProvider
+
+	Limit int
+}
+
+func (p *testLimitedProvider) ConcurrencyLimit() int {
+	return p.Limit
+}
+
+type testPrerequisiteProvider struct {
+	*terraform.MockResourceProvider
+
+	Names   map[string][]string
+	Ensured string
+	Error   error
+}
+
+func (p *testPrerequisiteProvider) Prerequisites(t string) []string {
+	return p.Names[t]
+}
+
+func (p *testPrerequisiteProvider) EnsurePrerequisite(name string) error {
+	p.Ensured = name
+	return p.Error
+}
+
+type testDryRunProvider struct {
+	*terraform.MockResourceProvider
+
+	State       *terraform.InstanceState
+	DryRunState *terraform.InstanceState
+}
+
+func (p *testDryRunProvider) DryRunApply(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState,
+	d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
+	p.DryRunState = s
+	return p.State, nil
+}
+
+type testDataSourceProvider struct {
+	*terraform.MockResourceProvider
+
+	State      *terraform.InstanceState
+	ReadConfig *terraform.ResourceConfig
+}
+
+func (p *testDataSourceProvider) ReadDataSource(
+	info *terraform.InstanceInfo,
+	c *terraform.ResourceConfig) (*terraform.InstanceState, error) {
+	p.ReadConfig = c
+	return p.State, nil
+}
+
+type testDiffSuppressProvider struct {
+	*terraform.MockResourceProvider
+
+	Key string
+}
+
+func (p *testDiffSuppressProvider) DiffSuppressFuncs(
+	t string) map[string]terraform.DiffSuppressFunc {
+	if t != "aws_iam_policy" {
+		return nil
+	}
+
+	return map[string]terraform.DiffSuppressFunc{
+		"policy": func(k, old, new string) bool {
+			p.Key = k
+			return strings.TrimSpace(old) == strings.TrimSpace(new)
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package terraform
+
+import (
+	"path"
+	"sort"
+)
+
+// AttributeWatch is an entry of the watchlist of attributes whose changes
+// are reported to the PostApplyWatched hook. See
+// ContextOpts.AttributeWatchlist.
+type AttributeWatch struct {
+	// Pattern is matched against the flattened attribute names of every
+	// resource, such as "policy" or "ingress.*". A "*" matches any
+	// sequence of characters, including dots, so "ingress.*" matches all
+	// the attributes within the ingress rules. See path.Match for the
+	// full syntax.
+	Pattern string
+
+	// Redact, if true, replaces the values of the matching attributes
+	// with "<redacted>" in the reported changes, so only the fact that
+	// they changed is reported.
+	Redact bool
+}
+
+// AttributeChange is the change of a single watched attribute of a
+// resource that was applied. Old is empty if the attribute was added and
+// New is empty if it was removed.
+type AttributeChange struct {
+	Attribute string
+	Old       string
+	New       string
+}
+
+// redactedValue replaces the values of redacted watched attributes.
+const redactedValue = "<redacted>"
+
+// attributeChanges returns the changes between the attributes before and
+// after, sorted by the attribute name.
+func attributeChanges(before, after map[string]string) []*AttributeChange {
+	keys := make(map[string]struct{})
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+
+	var result []*AttributeChange
+	for k := range keys {
+		oldV, newV := before[k], after[k]
+		if oldV == newV {
+			continue
+		}
+
+		result = append(result, &AttributeChange{
+			Attribute: k,
+			Old:       oldV,
+			New:       newV,
+		})
+	}
+
+	sort.Sort(attributeChangeSort(result))
+	return result
+}
+
+// watchedChanges returns the changes between the attributes before and
+// after an apply to the attributes that match the watchlist, sorted by
+// the attribute name.
+func watchedChanges(
+	watchlist []*AttributeWatch,
+	before, after map[string]string) []*AttributeChange {
+	if len(watchlist) == 0 {
+		return nil
+	}
+
+	var result []*AttributeChange
+	for _, c := range attributeChanges(before, after) {
+		matched, redact := false, false
+		for _, w := range watchlist {
+			if ok, _ := path.Match(w.Pattern, c.Attribute); ok {
+				matched = true
+				redact = redact || w.Redact
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if redact {
+			if c.Old != "" {
+				c.Old = redactedValue
+			}
+			if c.New != "" {
+				c.New = redactedValue
+			}
+		}
+
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// attributeChangeSort sorts by the attribute name.
+type attributeChangeSort []*AttributeChange
+
+func (s attributeChangeSort) Len() int      { return len(s) }
+func (s attributeChangeSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s attributeChangeSort) Less(i, j int) bool {
+	return s[i].Attribute < s[j].Attribute
+}
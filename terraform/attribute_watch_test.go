@@ -0,0 +1,81 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWatchedChanges(t *testing.T) {
+	cases := []struct {
+		Watchlist []*AttributeWatch
+		Before    map[string]string
+		After     map[string]string
+		Result    []*AttributeChange
+	}{
+		// Nothing is watched
+		{
+			nil,
+			map[string]string{"policy": "a"},
+			map[string]string{"policy": "b"},
+			nil,
+		},
+
+		// Changed, added and removed attributes
+		{
+			[]*AttributeWatch{
+				&AttributeWatch{Pattern: "policy"},
+				&AttributeWatch{Pattern: "ingress.*"},
+			},
+			map[string]string{
+				"policy":         "a",
+				"ingress.#":      "1",
+				"ingress.0.cidr": "10.0.0.0/8",
+				"name":           "foo",
+			},
+			map[string]string{
+				"policy":         "b",
+				"ingress.#":      "1",
+				"ingress.1.cidr": "0.0.0.0/0",
+				"name":           "bar",
+			},
+			[]*AttributeChange{
+				&AttributeChange{
+					Attribute: "ingress.0.cidr",
+					Old:       "10.0.0.0/8",
+				},
+				&AttributeChange{
+					Attribute: "ingress.1.cidr",
+					New:       "0.0.0.0/0",
+				},
+				&AttributeChange{
+					Attribute: "policy",
+					Old:       "a",
+					New:       "b",
+				},
+			},
+		},
+
+		// Redacted
+		{
+			[]*AttributeWatch{
+				&AttributeWatch{Pattern: "password", Redact: true},
+				&AttributeWatch{Pattern: "pass*"},
+			},
+			map[string]string{},
+			map[string]string{"password": "secret"},
+			[]*AttributeChange{
+				&AttributeChange{
+					Attribute: "password",
+					New:       "<redacted>",
+				},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		actual := watchedChanges(tc.Watchlist, tc.Before, tc.After)
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("%d: bad: %#v", i, actual)
+		}
+	}
+}
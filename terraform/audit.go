@@ -0,0 +1,245 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// auditNow returns the current time for the audit records. It is a
+// variable so it can be changed in tests.
+var auditNow = time.Now
+
+// AuditSink is the interface that must be implemented to deliver audit
+// records to an external audit system. See AuditLog.
+type AuditSink interface {
+	// WriteAudit delivers a single record. An error means the record
+	// wasn't delivered, so it is delivered again later.
+	WriteAudit(*AuditRecord) error
+}
+
+// AuditRecord is the record of a single change to a resource that was
+// applied.
+type AuditRecord struct {
+	// Address is the address of the resource, such as
+	// "module.foo.aws_instance.bar".
+	Address string
+
+	// Action is "create", "update", "replace" or "destroy".
+	Action string
+
+	// Actor is who applied the change. See AuditLog.Actor.
+	Actor string
+
+	// Time is when the change was applied, in UTC.
+	Time time.Time
+
+	// Changes are the changes to the attributes, sorted by the
+	// attribute name. The values of the attributes that match
+	// AuditLog.Redact are replaced with "<redacted>". If the apply
+	// failed, they are the changes as far as they were made.
+	Changes []*AttributeChange
+
+	// Error is the error of the apply if it failed, or empty if it
+	// succeeded.
+	Error string
+}
+
+// AuditLog writes an audit record to the Sink for every change that is
+// applied, including the changes that failed, see ContextOpts.AuditLog.
+//
+// Unlike hooks, delivery is guaranteed: a record that can't be delivered
+// is retried, and if it still fails it is buffered and delivered before
+// the next record, in order. The records still buffered at the end of an
+// apply are retried once more, and if they still can't be delivered the
+// apply fails.
+//
+// Records are delivered one at a time, in order. While one write is
+// delivering the records, a write that isn't Required only buffers its
+// record for it to deliver, so a slow sink doesn't hold up the applies.
+type AuditLog struct {
+	Sink AuditSink
+
+	// Actor is the identity of who is applying, such as the user or the
+	// CI job. It is the Actor of every record.
+	Actor string
+
+	// Redact are patterns of the attribute names whose values are
+	// redacted in the records, such as "password" or "*.secret". See
+	// path.Match for the syntax.
+	Redact []string
+
+	// Retries is how many more times delivering a record is tried
+	// before it is buffered, waiting RetryInterval between the tries.
+	Retries       int
+	RetryInterval time.Duration
+
+	// Required, if true, makes a record that can't be delivered fail the
+	// apply of the resource. Otherwise it is only buffered. Either way,
+	// records that still can't be delivered fail the apply once it ends.
+	Required bool
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	pending  []*AuditRecord
+	flushing bool
+}
+
+// Write delivers the record, after any records still buffered. It returns
+// an error if it can't be delivered, in which case it is buffered.
+// The methods are safe to call on a nil log, which writes nothing.
+func (l *AuditLog) Write(r *AuditRecord) error {
+	if l == nil {
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.pending = append(l.pending, r)
+	if l.flushing && !l.Required {
+		return nil
+	}
+
+	return l.flush()
+}
+
+// Flush delivers the records that are still buffered.
+func (l *AuditLog) Flush() error {
+	if l == nil {
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.flush()
+}
+
+// Pending returns the number of records that are still buffered.
+func (l *AuditLog) Pending() int {
+	if l == nil {
+		return 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return len(l.pending)
+}
+
+// flush must be called with the lock held. It waits for any other flush
+// to finish, and releases the lock while it delivers the records, so
+// records can be buffered in the meantime.
+func (l *AuditLog) flush() error {
+	if l.cond == nil {
+		l.cond = sync.NewCond(&l.lock)
+	}
+	for l.flushing {
+		l.cond.Wait()
+	}
+
+	l.flushing = true
+	defer func() {
+		l.flushing = false
+		l.cond.Broadcast()
+	}()
+
+	for len(l.pending) > 0 {
+		r := l.pending[0]
+
+		l.lock.Unlock()
+		var err error
+		for i := 0; i <= l.Retries; i++ {
+			if i > 0 {
+				time.Sleep(l.RetryInterval)
+			}
+
+			if err = l.Sink.WriteAudit(r); err == nil {
+				break
+			}
+
+			log.Printf(
+				"[WARN] Error writing audit record for %s, try %d: %s",
+				r.Address, i+1, err)
+		}
+		l.lock.Lock()
+
+		if err != nil {
+			return fmt.Errorf(
+				"error writing audit record for %s, %d record(s) buffered: %s",
+				r.Address, len(l.pending), err)
+		}
+
+		l.pending = l.pending[1:]
+	}
+
+	return nil
+}
+
+// record returns the audit record of the change in diff, applied to a
+// resource with the attributes before, resulting in the attributes after.
+// Exists is whether the resource existed before, and err is the error of
+// the apply if it failed.
+func (l *AuditLog) record(
+	addr string,
+	diff *InstanceDiff,
+	exists bool,
+	before, after map[string]string,
+	err error) *AuditRecord {
+	action := "update"
+	switch {
+	case diff.Destroy && !diff.RequiresNew():
+		action = "destroy"
+	case diff.RequiresNew():
+		action = "replace"
+	case !exists:
+		action = "create"
+	}
+
+	var changes []*AttributeChange
+	for k, _ := range diff.Attributes {
+		oldV, newV := before[k], after[k]
+		if l.redacted(k) {
+			if oldV != "" {
+				oldV = redactedValue
+			}
+			if newV != "" {
+				newV = redactedValue
+			}
+		}
+
+		changes = append(changes, &AttributeChange{
+			Attribute: k,
+			Old:       oldV,
+			New:       newV,
+		})
+	}
+	sort.Sort(attributeChangeSort(changes))
+
+	r := &AuditRecord{
+		Address: addr,
+		Action:  action,
+		Actor:   l.Actor,
+		Time:    auditNow().UTC(),
+		Changes: changes,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+func (l *AuditLog) redacted(k string) bool {
+	for _, p := range l.Redact {
+		if ok, _ := path.Match(p, k); ok {
+			return true
+		}
+	}
+
+	return false
+}
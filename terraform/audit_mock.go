@@ -0,0 +1,30 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// MockAuditSink is an implementation of AuditSink that can be used for
+// tests.
+type MockAuditSink struct {
+	lock sync.Mutex
+
+	WriteAuditCalled int
+	WriteAuditError  error
+
+	// Records are the records that were delivered.
+	Records []*AuditRecord
+}
+
+func (s *MockAuditSink) WriteAudit(r *AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.WriteAuditCalled++
+	if s.WriteAuditError != nil {
+		return s.WriteAuditError
+	}
+
+	s.Records = append(s.Records, r)
+	return nil
+}
@@ -0,0 +1,195 @@
+package terraform
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMockAuditSink_impl(t *testing.T) {
+	var _ AuditSink = new(MockAuditSink)
+}
+
+func TestAuditLog(t *testing.T) {
+	sink := new(MockAuditSink)
+	l := &AuditLog{Sink: sink, Retries: 2}
+
+	r := &AuditRecord{Address: "aws_instance.foo"}
+	if err := l.Write(r); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(sink.Records, []*AuditRecord{r}) {
+		t.Fatalf("bad: %#v", sink.Records)
+	}
+}
+
+func TestAuditLog_buffered(t *testing.T) {
+	sink := &MockAuditSink{WriteAuditError: errors.New("down")}
+	l := &AuditLog{Sink: sink, Retries: 2}
+
+	r1 := &AuditRecord{Address: "aws_instance.foo"}
+	if err := l.Write(r1); err == nil {
+		t.Fatal("should error")
+	}
+	if sink.WriteAuditCalled != 3 {
+		t.Fatalf("bad: %d", sink.WriteAuditCalled)
+	}
+	if l.Pending() != 1 {
+		t.Fatalf("bad: %d", l.Pending())
+	}
+
+	// The buffered records are delivered first, in order
+	sink.WriteAuditError = nil
+	r2 := &AuditRecord{Address: "aws_instance.bar"}
+	if err := l.Write(r2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(sink.Records, []*AuditRecord{r1, r2}) {
+		t.Fatalf("bad: %#v", sink.Records)
+	}
+	if l.Pending() != 0 {
+		t.Fatalf("bad: %d", l.Pending())
+	}
+}
+
+func TestAuditLog_slowSink(t *testing.T) {
+	sink := &testBlockingAuditSink{
+		MockAuditSink: new(MockAuditSink),
+		Started:       make(chan struct{}),
+		Release:       make(chan struct{}),
+	}
+	l := &AuditLog{Sink: sink}
+
+	r1 := &AuditRecord{Address: "aws_instance.foo"}
+	doneCh := make(chan error)
+	go func() {
+		doneCh <- l.Write(r1)
+	}()
+	<-sink.Started
+
+	// While the first record is being delivered, another write only
+	// buffers its record instead of waiting for the sink
+	r2 := &AuditRecord{Address: "aws_instance.bar"}
+	writeCh := make(chan error)
+	go func() {
+		writeCh <- l.Write(r2)
+	}()
+	select {
+	case err := <-writeCh:
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write should not wait for the sink")
+	}
+	if l.Pending() != 2 {
+		t.Fatalf("bad: %d", l.Pending())
+	}
+
+	close(sink.Release)
+	if err := <-doneCh; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(sink.Records, []*AuditRecord{r1, r2}) {
+		t.Fatalf("bad: %#v", sink.Records)
+	}
+}
+
+func TestAuditLog_nil(t *testing.T) {
+	var l *AuditLog
+	if err := l.Write(new(AuditRecord)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	l := &AuditLog{Actor: "alice", Redact: []string{"password"}}
+
+	cases := []struct {
+		Diff   *InstanceDiff
+		Exists bool
+		Action string
+	}{
+		{&InstanceDiff{}, false, "create"},
+		{&InstanceDiff{}, true, "update"},
+		{&InstanceDiff{Destroy: true}, true, "destroy"},
+		{
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{RequiresNew: true},
+				},
+			},
+			true,
+			"replace",
+		},
+	}
+
+	for i, tc := range cases {
+		r := l.record("aws_instance.foo", tc.Diff, tc.Exists, nil, nil, nil)
+		if r.Action != tc.Action {
+			t.Fatalf("%d: bad: %s", i, r.Action)
+		}
+		if r.Actor != "alice" || r.Address != "aws_instance.foo" {
+			t.Fatalf("%d: bad: %#v", i, r)
+		}
+	}
+
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"password": &ResourceAttrDiff{New: "secret"},
+			"size":     &ResourceAttrDiff{Old: "1", New: "2"},
+		},
+	}
+	r := l.record(
+		"aws_instance.foo",
+		diff,
+		true,
+		map[string]string{"password": "old", "size": "1"},
+		map[string]string{"password": "secret", "size": "2"},
+		nil)
+
+	expected := []*AttributeChange{
+		&AttributeChange{
+			Attribute: "password",
+			Old:       redactedValue,
+			New:       redactedValue,
+		},
+		&AttributeChange{Attribute: "size", Old: "1", New: "2"},
+	}
+	if !reflect.DeepEqual(r.Changes, expected) {
+		t.Fatalf("bad: %#v", r.Changes)
+	}
+	if r.Error != "" {
+		t.Fatalf("bad: %#v", r.Error)
+	}
+
+	r = l.record("aws_instance.foo", diff, true, nil, nil, errors.New("failed"))
+	if r.Error != "failed" {
+		t.Fatalf("bad: %#v", r.Error)
+	}
+}
+
+// testBlockingAuditSink is an AuditSink whose first write blocks until
+// Release is closed. Started is closed once it blocks.
+type testBlockingAuditSink struct {
+	*MockAuditSink
+
+	Started chan struct{}
+	Release chan struct{}
+
+	once sync.Once
+}
+
+func (s *testBlockingAuditSink) WriteAudit(r *AuditRecord) error {
+	s.once.Do(func() {
+		close(s.Started)
+		<-s.Release
+	})
+
+	return s.MockAuditSink.WriteAudit(r)
+}
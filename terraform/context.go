@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/terraform/config"
@@ -46,6 +48,116 @@ type ContextOpts struct {
 	Targets      []string
 	Variables    map[string]string
 
+	// ProviderSnapshot, if set, is recorded to or replayed from
+	// according to ProviderSnapshotMode. See ProviderSnapshot.
+	ProviderSnapshot     *ProviderSnapshot
+	ProviderSnapshotMode ProviderSnapshotMode
+
+	// Timestamp, if set, is the value of the timestamp() interpolation
+	// function instead of the time the context is created. Plan.Context
+	// sets it to the timestamp of the plan, so that applying a saved
+	// plan interpolates the same timestamp as planning it.
+	Timestamp time.Time
+
+	// Events, if set, receives a ResourceEvent as each resource starts,
+	// progresses and finishes. Events are dropped rather than blocking
+	// when the channel is full, so it should be buffered.
+	Events chan<- *ResourceEvent
+
+	// StateUpdateInterval is the minimum interval between calls to the
+	// PostStateUpdate hook. Updates in between are coalesced, and the
+	// final update is always sent at the end of a walk; an error from it
+	// is returned by the walk. Updates that mark a resource pending are
+	// never coalesced. This defaults to
+	// DefaultStateUpdateInterval; a negative value disables throttling.
+	StateUpdateInterval time.Duration
+
+	// FailureThreshold, if greater than zero, is the number of failed
+	// nodes after which a walk stops evaluating new nodes. Nodes that are
+	// already being evaluated are allowed to finish.
+	FailureThreshold int
+
+	// Policy, if set, is checked before any change to a resource is
+	// applied. Changes that the policy denies fail to apply.
+	Policy Policy
+
+	// TaintErrorPatterns are matched against the errors from applying a
+	// resource. An error that matches any of them means the resource is
+	// in a state only recreating it can fix, so it is tainted and
+	// recreated once in the same apply instead of failing right away.
+	TaintErrorPatterns []*regexp.Regexp
+
+	// AttributeWatchlist are the attributes whose changes are reported
+	// to the PostApplyWatched hook when resources are applied, such as
+	// for security monitoring of sensitive attributes.
+	AttributeWatchlist []*AttributeWatch
+
+	// ModuleBudgets limit how many resources the modules may have. A
+	// validate or plan whose modules are over budget fails.
+	ModuleBudgets []*ModuleBudget
+
+	// DiffChecksum, if set, is the checksum of Diff when it was planned.
+	// Apply fails without changing anything if the diff doesn't match it.
+	// This is set by Plan.Context.
+	DiffChecksum string
+
+	// AuditLog, if set, is written an audit record for every change that
+	// is applied. See AuditLog.
+	AuditLog *AuditLog
+
+	// Coordinator, if set, coordinates the applies with the other
+	// deployments of the same configuration. See Coordinator.
+	Coordinator Coordinator
+
+	// RecoverState, if true, rebuilds the instances that are corrupted
+	// in the state from their providers when refreshing, as long as their
+	// ID can be salvaged. Otherwise corrupted instances are only logged.
+	// See EvalReadState.
+	RecoverState bool
+
+	// StateStream, if set, is sent an event for every write of an
+	// instance to the state, so that an external system can keep a live
+	// mirror of it. See StateStream.
+	StateStream StateStream
+
+	// StateBackend, if set, is where the state is stored remotely. Apply
+	// and refresh hold its lock while they walk, refuse to run if the
+	// stored state is newer than the state of the context, and write the
+	// state to it as it is updated and once more when they end, even if
+	// they fail. See StateBackend.
+	StateBackend StateBackend
+
+	// StateWriteEvery and StateWriteInterval throttle the writes of the
+	// state to the StateBackend while apply and refresh update it: the
+	// state is written after every StateWriteEvery updates, or once
+	// StateWriteInterval has passed since the last write, whichever comes
+	// first. If neither is set, every update is written. Updates that
+	// mark a resource pending are always written.
+	StateWriteEvery    int
+	StateWriteInterval time.Duration
+
+	// PrerequisiteChecks are the checks of external prerequisites by the
+	// name that resources use in their lifecycle. When any resource has
+	// prerequisite checks, Apply first runs the checks of every resource
+	// that is created or updated, and changes nothing if any of them
+	// fails. See PrerequisiteCheck.
+	PrerequisiteChecks map[string]PrerequisiteCheck
+
+	// CostBudget, if greater than zero, is the budget for the estimated
+	// change to the monthly cost of an apply. An apply over budget, or
+	// with changes whose cost isn't known, is blocked unless a hook
+	// confirms it. See CostConfirmer and ResourceProviderCostEstimator.
+	CostBudget float64
+
+	// DryRun, if true, makes Apply walk the changes as usual but without
+	// making them: the providers only project the state that applying
+	// would result in, see EvalApply, and the provisioners, prerequisites,
+	// data migrations and coordination marker are skipped. The state
+	// backend isn't used at all, and the PostStateUpdate hooks aren't
+	// called. The state that Apply returns is only the projection and
+	// must not be persisted.
+	DryRun bool
+
 	UIInput UIInput
 }
 
@@ -58,8 +170,11 @@ type Context struct {
 	diffLock     sync.RWMutex
 	hooks        []Hook
 	module       *module.Tree
+	modBudgets   []*ModuleBudget
+	policy       Policy
 	providers    map[string]ResourceProviderFactory
 	provisioners map[string]ResourceProvisionerFactory
+	rh           *rollbackHook
 	sh           *stopHook
 	state        *State
 	stateLock    sync.RWMutex
@@ -67,6 +182,21 @@ type Context struct {
 	uiInput      UIInput
 	variables    map[string]string
 
+	attributeWatchlist  []*AttributeWatch
+	auditLog            *AuditLog
+	coordinator         Coordinator
+	costBudget          float64
+	diffChecksum        string
+	dryRun              bool
+	failureThreshold    int
+	prerequisiteChecks  map[string]PrerequisiteCheck
+	recoverState        bool
+	stateBackend        StateBackend
+	stateWrites         *stateWriteThrottle
+	stateWriteSeq       *stateWriteSequence
+	stateStream         StateStream
+	taintErrorPatterns  []*regexp.Regexp
+	timestamp           time.Time
 	l                   sync.Mutex // Lock acquired during any task
 	parallelSem         Semaphore
 	providerInputConfig map[string]map[string]interface{}
@@ -79,12 +209,31 @@ type Context struct {
 // should not be mutated in any way, since the pointers are copied, not
 // the values themselves.
 func NewContext(opts *ContextOpts) *Context {
-	// Copy all the hooks and add our stop hook. We don't append directly
-	// to the Config so that we're not modifying that in-place.
+	// Copy all the hooks and add our event and stop hooks. We don't append
+	// directly to the Config so that we're not modifying that in-place.
+	// The state updates the user hooks see are throttled, unless that
+	// is disabled with a negative interval.
+	//
+	// The rollback hook is first so that it records every operation,
+	// even if another hook halts after it.
 	sh := new(stopHook)
-	hooks := make([]Hook, len(opts.Hooks)+1)
+	rh := new(rollbackHook)
+	hooks := make([]Hook, len(opts.Hooks), len(opts.Hooks)+3)
 	copy(hooks, opts.Hooks)
-	hooks[len(opts.Hooks)] = sh
+	interval := opts.StateUpdateInterval
+	if interval == 0 {
+		interval = DefaultStateUpdateInterval
+	}
+	if interval > 0 {
+		for i, h := range hooks {
+			hooks[i] = &stateThrottleHook{Hook: h, Interval: interval}
+		}
+	}
+	if opts.Events != nil {
+		hooks = append(hooks, &eventHook{Events: opts.Events})
+	}
+	hooks = append([]Hook{rh}, hooks...)
+	hooks = append(hooks, sh)
 
 	state := opts.State
 	if state == nil {
@@ -120,18 +269,52 @@ func NewContext(opts *ContextOpts) *Context {
 		variables[k] = v
 	}
 
+	// If we're recording or replaying a provider snapshot, wrap all
+	// the providers so their responses go through the snapshot.
+	providers := snapshotProviderFactories(
+		opts.Providers, opts.ProviderSnapshot, opts.ProviderSnapshotMode)
+
+	timestamp := opts.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	timestamp = timestamp.UTC()
+
+	stateWrites := &stateWriteThrottle{
+		Every:    opts.StateWriteEvery,
+		Interval: opts.StateWriteInterval,
+	}
+
 	return &Context{
 		destroy:      opts.Destroy,
 		diff:         opts.Diff,
 		hooks:        hooks,
 		module:       opts.Module,
-		providers:    opts.Providers,
+		modBudgets:   opts.ModuleBudgets,
+		policy:       opts.Policy,
+		providers:    providers,
 		provisioners: opts.Provisioners,
+		rh:           rh,
 		state:        state,
 		targets:      opts.Targets,
 		uiInput:      opts.UIInput,
 		variables:    variables,
 
+		attributeWatchlist:  opts.AttributeWatchlist,
+		auditLog:            opts.AuditLog,
+		coordinator:         opts.Coordinator,
+		costBudget:          opts.CostBudget,
+		diffChecksum:        opts.DiffChecksum,
+		dryRun:              opts.DryRun,
+		failureThreshold:    opts.FailureThreshold,
+		prerequisiteChecks:  opts.PrerequisiteChecks,
+		recoverState:        opts.RecoverState,
+		stateBackend:        opts.StateBackend,
+		stateWrites:         stateWrites,
+		stateWriteSeq:       new(stateWriteSequence),
+		stateStream:         opts.StateStream,
+		taintErrorPatterns:  opts.TaintErrorPatterns,
+		timestamp:           timestamp,
 		parallelSem:         NewSemaphore(par),
 		providerInputConfig: make(map[string]map[string]interface{}),
 		sh:                  sh,
@@ -145,6 +328,12 @@ type ContextGraphOpts struct {
 
 // Graph returns the graph for this config.
 func (c *Context) Graph(g *ContextGraphOpts) (*Graph, error) {
+	// The modules are expanded when the graph is built, so their counts
+	// must be known by then.
+	if err := interpolateModuleCounts(c.module, c.variables); err != nil {
+		return nil, err
+	}
+
 	return c.graphBuilder(g).Build(RootModulePath)
 }
 
@@ -163,15 +352,18 @@ func (c *Context) graphBuilder(g *ContextGraphOpts) GraphBuilder {
 	}
 
 	return &BuiltinGraphBuilder{
-		Root:         c.module,
-		Diff:         c.diff,
-		Providers:    providers,
-		Provisioners: provisioners,
-		State:        c.state,
-		Targets:      c.targets,
-		Destroy:      c.destroy,
-		Validate:     g.Validate,
-		Verbose:      g.Verbose,
+		Root:              c.module,
+		Diff:              c.diff,
+		Providers:         providers,
+		ProviderFactories: c.providers,
+		Provisioners:      provisioners,
+		State:             c.state,
+		Targets:           c.targets,
+		Destroy:           c.destroy,
+		Validate:          g.Validate,
+		Verbose:           g.Verbose,
+		Coordinate:        c.coordinator != nil,
+		CostBudget:        c.costBudget,
 	}
 }
 
@@ -282,6 +474,24 @@ func (c *Context) Apply() (*State, error) {
 	v := c.acquireRun()
 	defer c.releaseRun(v)
 
+	// The diff must be exactly the diff that was planned, nothing is
+	// applied otherwise. The apply changes the diff as it goes, so it is
+	// only verified once.
+	if c.diffChecksum != "" {
+		c.diffLock.RLock()
+		checksum := c.diff.Checksum()
+		c.diffLock.RUnlock()
+		if checksum != c.diffChecksum {
+			return c.state, fmt.Errorf(
+				"The diff to apply doesn't match the plan. The plan may be\n"+
+					"stale or have been modified since it was created.\n\n"+
+					"Planned checksum: %s\nActual checksum:  %s",
+				c.diffChecksum, checksum)
+		}
+
+		c.diffChecksum = ""
+	}
+
 	// Copy our own state
 	c.state = c.state.DeepCopy()
 
@@ -291,15 +501,75 @@ func (c *Context) Apply() (*State, error) {
 		return nil, err
 	}
 
+	// Check the prerequisites before anything is changed, so that a
+	// missing prerequisite doesn't leave the apply half done.
+	if usesPrerequisiteChecks(c.module) {
+		if _, err := c.walk(graph, walkPreflight); err != nil {
+			return c.state, err
+		}
+	}
+
 	// Do the walk
+	c.rh.Reset()
 	_, err = c.walk(graph, walkApply)
 
+	// If the apply failed partway through, report how to undo it
+	if err != nil {
+		if plan := c.rh.Plan(); len(plan.Steps) > 0 {
+			for _, h := range c.hooks {
+				h.PostRollbackPlan(plan)
+			}
+		}
+	}
+
 	// Clean out any unused things
 	c.state.prune()
 
 	return c.state, err
 }
 
+// QueuedPlan returns a plan of the changes that the last Apply queued
+// because they were outside of the change window of their resource, or
+// nil if nothing was queued. Applying the plan once the windows are open
+// resumes the queued changes. See config.ResourceLifecycle.ChangeWindow.
+func (c *Context) QueuedPlan() *Plan {
+	v := c.acquireRun()
+	defer c.releaseRun(v)
+
+	c.diffLock.RLock()
+	defer c.diffLock.RUnlock()
+
+	diff := new(Diff)
+	diff.init()
+	if c.diff != nil {
+		for _, md := range c.diff.Modules {
+			for k, rd := range md.Resources {
+				if rd == nil || rd.ScheduledFor.IsZero() {
+					continue
+				}
+
+				queued := diff.ModuleByPath(md.Path)
+				if queued == nil {
+					queued = diff.AddModule(md.Path)
+				}
+				queued.Resources[k] = rd.deepcopy()
+			}
+		}
+	}
+	if diff.Empty() {
+		return nil
+	}
+
+	return &Plan{
+		Diff:      diff,
+		Module:    c.module,
+		State:     c.state.DeepCopy(),
+		Vars:      c.variables,
+		Checksum:  diff.Checksum(),
+		Timestamp: c.timestamp,
+	}
+}
+
 // Plan generates an execution plan for the given context.
 //
 // The execution plan encapsulates the context and can be stored
@@ -311,19 +581,97 @@ func (c *Context) Plan() (*Plan, error) {
 	v := c.acquireRun()
 	defer c.releaseRun(v)
 
+	return c.plan(false)
+}
+
+// SpeculativePlan generates an execution plan in the same way as Plan,
+// but without any side effects on this context: the state and diff
+// of the context are left exactly as they were. This can be used
+// to preview the plan of a proposed configuration.
+func (c *Context) SpeculativePlan() (*Plan, error) {
+	v := c.acquireRun()
+	defer c.releaseRun(v)
+
+	// Restore the diff when we're done, the plan gets its own
+	c.diffLock.Lock()
+	oldDiff := c.diff
+	c.diffLock.Unlock()
+	defer func() {
+		c.diffLock.Lock()
+		c.diff = oldDiff
+		c.diffLock.Unlock()
+	}()
+
+	return c.plan(true)
+}
+
+// BaselinePlan generates a plan of the changes that would make the
+// infrastructure in the given baseline state match the configuration of
+// this context, such as to compare the state of another environment.
+// Resources that are only in the configuration are created and resources
+// that are only in the baseline are destroyed.
+//
+// This is only a comparison: the baseline isn't refreshed, and the state
+// and diff of this context are left exactly as they were.
+func (c *Context) BaselinePlan(baseline *State) (*Plan, error) {
+	v := c.acquireRun()
+	defer c.releaseRun(v)
+
+	// Restore the state and diff when we're done, the plan gets its own
+	c.diffLock.Lock()
+	oldDiff := c.diff
+	c.diffLock.Unlock()
+	oldState := c.state
+	defer func() {
+		c.state = oldState
+
+		c.diffLock.Lock()
+		c.diff = oldDiff
+		c.diffLock.Unlock()
+	}()
+
+	c.state = baseline.DeepCopy()
+	if c.state == nil {
+		c.state = &State{}
+		c.state.init()
+	}
+
+	return c.plan(true)
+}
+
+func (c *Context) plan(speculative bool) (*Plan, error) {
+	// Resources left pending by an interrupted apply are refreshed first,
+	// since their real state is unknown. A speculative plan can't change
+	// the state, so it plans with the state as it is.
+	if !speculative && c.state.HasPending() {
+		log.Printf("[INFO] Refreshing resources left pending by an interrupted apply")
+		if _, err := c.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
 	p := &Plan{
-		Module: c.module,
-		Vars:   c.variables,
-		State:  c.state,
+		Module:    c.module,
+		Vars:      c.variables,
+		State:     c.state,
+		Timestamp: c.timestamp,
+	}
+
+	// A speculative plan doesn't share the state with the context
+	if speculative {
+		p.State = c.state.DeepCopy()
 	}
 
-	var operation walkOperation
+	operation := walkPlan
 	if c.destroy {
 		operation = walkPlanDestroy
-	} else {
-		// Set our state to be something temporary. We do this so that
-		// the plan can update a fake state so that variables work, then
-		// we replace it back with our old state.
+	}
+
+	// Set our state to be something temporary. We do this so that
+	// the plan can update a fake state so that variables work, then
+	// we replace it back with our old state. A destroy plan doesn't
+	// update the state, so it only needs this if it's speculative.
+	if operation == walkPlan || speculative {
 		old := c.state
 		if old == nil {
 			c.state = &State{}
@@ -332,10 +680,16 @@ func (c *Context) Plan() (*Plan, error) {
 			c.state = old.DeepCopy()
 		}
 		defer func() {
+			// The data sources are read during the plan, and what was
+			// read is kept so that the apply sees the same values.
+			planned := c.state
 			c.state = old
+			if operation == walkPlan && !speculative && old != nil {
+				c.stateLock.Lock()
+				old.replaceDataSources(planned)
+				c.stateLock.Unlock()
+			}
 		}()
-
-		operation = walkPlan
 	}
 
 	// Setup our diff
@@ -355,6 +709,12 @@ func (c *Context) Plan() (*Plan, error) {
 		return nil, err
 	}
 	p.Diff = c.diff
+	p.Checksum = c.diff.Checksum()
+
+	// A speculative plan doesn't change the diff of the context
+	if !speculative {
+		c.diffChecksum = p.Checksum
+	}
 
 	// Now that we have a diff, we can build the exact graph that Apply will use
 	// and catch any possible cycles during the Plan phase.
@@ -375,6 +735,10 @@ func (c *Context) Refresh() (*State, error) {
 	v := c.acquireRun()
 	defer c.releaseRun(v)
 
+	return c.refresh()
+}
+
+func (c *Context) refresh() (*State, error) {
 	// Copy our own state
 	c.state = c.state.DeepCopy()
 
@@ -416,6 +780,29 @@ func (c *Context) Stop() {
 	<-ch
 }
 
+// CheckProvisioners does a dry run of the provisioners of all the
+// resources that exist in the state. The provisioners connect to the
+// resources and check that they would work, such as that the files to
+// upload exist, without changing anything. This catches problems such as
+// unreachable hosts before an apply.
+//
+// Provisioners that can't be checked are skipped. See
+// ResourceProvisionerChecker.
+func (c *Context) CheckProvisioners() error {
+	v := c.acquireRun()
+	defer c.releaseRun(v)
+
+	// Build the graph
+	graph, err := c.Graph(&ContextGraphOpts{Validate: true})
+	if err != nil {
+		return err
+	}
+
+	// Do the walk
+	_, err = c.walk(graph, walkProvisionCheck)
+	return err
+}
+
 // Validate validates the configuration and returns any warnings or errors.
 func (c *Context) Validate() ([]string, []error) {
 	v := c.acquireRun()
@@ -468,6 +855,14 @@ func (c *Context) Module() *module.Tree {
 	return c.module
 }
 
+// Timestamp returns the time this context was created, or
+// ContextOpts.Timestamp if it was set. This is the value of the
+// timestamp() interpolation function for every operation run with this
+// context, so that it is the same during validate, plan and apply.
+func (c *Context) Timestamp() time.Time {
+	return c.timestamp
+}
+
 // Variables will return the mapping of variables that were defined
 // for this Context. If Input was called, this mapping may be different
 // than what was given.
@@ -509,7 +904,149 @@ func (c *Context) releaseRun(ch chan<- struct{}) {
 func (c *Context) walk(
 	graph *Graph, operation walkOperation) (*ContextGraphWalker, error) {
 	// Walk the graph
-	log.Printf("[INFO] Starting graph walk: %s", operation.String())
+	log.Printf("[INFO] Starting graph walk: %s, timestamp: %s",
+		operation.String(), c.timestamp.Format(time.RFC3339))
 	walker := &ContextGraphWalker{Context: c, Operation: operation}
-	return walker, graph.Walk(walker)
+
+	for _, h := range c.hooks {
+		action, err := h.WalkStart(operation.String())
+		if err != nil {
+			return walker, err
+		}
+		if action == HookActionHalt {
+			log.Printf("[INFO] Graph walk %s halted by a hook", operation.String())
+			return walker, nil
+		}
+	}
+
+	// Only the leader may apply, and only one deployment at a time
+	if c.coordinator != nil && operation == walkApply {
+		leader, err := c.coordinator.Lock()
+		if err != nil {
+			return walker, fmt.Errorf("error taking coordination lock: %s", err)
+		}
+		defer func() {
+			if err := c.coordinator.Unlock(); err != nil {
+				log.Printf("[ERROR] Error releasing coordination lock: %s", err)
+			}
+		}()
+
+		if !leader {
+			return walker, fmt.Errorf(
+				"This deployment isn't the leader, so it can't apply. " +
+					"Only the leader of the coordinated deployments may apply.")
+		}
+	}
+
+	// Apply and refresh change the state, so only one run at a time may
+	// walk with the state of the backend. The lock is released however
+	// the walk ends.
+	backend := c.stateBackend
+	if operation != walkApply && operation != walkRefresh {
+		backend = nil
+	}
+	if c.dryRun {
+		backend = nil
+	}
+	if backend != nil {
+		info := &StateLockInfo{
+			Who: stateLockWho(),
+			Operation: strings.ToLower(
+				strings.TrimPrefix(operation.String(), "walk")),
+			Created: time.Now().UTC(),
+		}
+		if err := backend.Lock(info); err != nil {
+			if _, ok := err.(*StateLockedError); ok {
+				return walker, err
+			}
+
+			return walker, fmt.Errorf("error locking the state: %s", err)
+		}
+		defer func() {
+			if err := backend.Unlock(); err != nil {
+				log.Printf("[ERROR] Error unlocking the state: %s", err)
+			}
+		}()
+
+		if err := c.checkStateBackend(backend); err != nil {
+			return walker, err
+		}
+	}
+
+	err := graph.Walk(walker)
+
+	// Write the state even if the walk failed, so that what was applied
+	// before the failure isn't lost
+	if backend != nil {
+		c.stateLock.RLock()
+		werr := backend.Write(c.state)
+		c.stateLock.RUnlock()
+		if werr != nil {
+			err = multierror.Append(err, fmt.Errorf(
+				"error writing the state: %s", werr))
+		}
+	}
+
+	if walker.configFailure != "" {
+		err = multierror.Append(err, fmt.Errorf(
+			"Stopped after a configuration error applying %s. "+
+				"Resources that hadn't started yet were skipped.",
+			walker.configFailure))
+	} else if walker.aborted {
+		err = multierror.Append(err, fmt.Errorf(
+			"Stopped after %d failures, the failure threshold is %d. "+
+				"Resources that hadn't started yet were skipped.",
+			walker.failures, c.failureThreshold))
+	}
+
+	// Send any state updates that were throttled during the walk
+	for _, h := range c.hooks {
+		if th, ok := h.(*stateThrottleHook); ok {
+			if _, ferr := th.flush(); ferr != nil {
+				err = multierror.Append(err, ferr)
+			}
+		}
+	}
+
+	// Try once more to deliver the audit records that are buffered. The
+	// records that still can't be delivered would be lost, so the apply
+	// fails even if the audit log isn't required.
+	if operation == walkApply {
+		if aerr := c.auditLog.Flush(); aerr != nil {
+			err = multierror.Append(err, aerr)
+		}
+	}
+
+	for _, h := range c.hooks {
+		if _, herr := h.WalkEnd(operation.String(), err); herr != nil {
+			err = multierror.Append(err, herr)
+		}
+	}
+
+	return walker, err
+}
+
+// checkStateBackend makes sure that the state of the context isn't older
+// than the stored state, so that it doesn't clobber the changes of
+// another run. The serial of the state is then incremented, so that every
+// write of it during the walk, even a partial one, is newer than what
+// was stored.
+func (c *Context) checkStateBackend(b StateBackend) error {
+	stored, err := b.Read()
+	if err != nil {
+		return fmt.Errorf("error reading the state: %s", err)
+	}
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if stored != nil && stored.Serial > c.state.Serial {
+		return &StaleStateError{
+			Serial:        c.state.Serial,
+			BackendSerial: stored.Serial,
+		}
+	}
+
+	c.state.Serial++
+	return nil
 }
@@ -1,15 +1,20 @@
 package terraform
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/hashicorp/terraform/config"
 )
 
 func TestContext2Apply(t *testing.T) {
@@ -201,6 +206,98 @@ func TestContext2Apply_createBeforeDestroy(t *testing.T) {
 	}
 }
 
+func TestContext2Apply_lazyReferences(t *testing.T) {
+	m := testModule(t, "apply-lazy-references")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The reference is resolved once the state of the referenced
+	// resource is written, even though it isn't ordered before.
+	rs := state.RootModule().Resources["aws_instance.web"]
+	if rs == nil || rs.Primary.Attributes["value"] != "db" {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+// A lazy reference to a resource that is changing is unknown when
+// planning, so the change reaches the resource that references it.
+func TestContext2Apply_lazyReferencesUpdate(t *testing.T) {
+	m := testModule(t, "apply-lazy-references")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.db": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "db",
+							Attributes: map[string]string{
+								"value": "old",
+							},
+						},
+					},
+					"aws_instance.web": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "web",
+							Attributes: map[string]string{
+								"value": "old",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	d := plan.Diff.RootModule().Resources["aws_instance.web"]
+	if d == nil || !d.Attributes["value"].NewComputed {
+		t.Fatalf("bad: %s", plan.Diff)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rs := state.RootModule().Resources["aws_instance.web"]
+	if rs == nil || rs.Primary.Attributes["value"] != "db" {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
 func TestContext2Apply_createBeforeDestroyUpdate(t *testing.T) {
 	m := testModule(t, "apply-good-create-before-update")
 	p := testProvider("aws")
@@ -425,6 +522,117 @@ func TestContext2Apply_cancel(t *testing.T) {
 	}
 }
 
+func TestContext2Apply_pause(t *testing.T) {
+	m := testModule(t, "apply-pause")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	var applied []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		applied = append(applied, info.Id)
+		return testApplyFn(info, s, d)
+	}
+
+	h := &MockHook{
+		WaitForContinueFn: func(string, string) (HookAction, error) {
+			l.Lock()
+			defer l.Unlock()
+			if !reflect.DeepEqual(applied, []string{"aws_instance.db"}) {
+				t.Errorf("bad: %#v", applied)
+			}
+
+			return HookActionContinue, nil
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !h.WaitForContinueCalled {
+		t.Fatal("should be called")
+	}
+	if h.WaitForContinueName != "aws_instance.db" {
+		t.Fatalf("bad: %s", h.WaitForContinueName)
+	}
+	if h.WaitForContinueMessage != "Run the database migration" {
+		t.Fatalf("bad: %s", h.WaitForContinueMessage)
+	}
+	if len(state.RootModule().Resources) != 2 {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+func TestContext2Apply_pauseCancel(t *testing.T) {
+	m := testModule(t, "apply-pause")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	pausedCh := make(chan struct{})
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+	h := &MockHook{
+		WaitForContinueFn: func(string, string) (HookAction, error) {
+			close(pausedCh)
+			<-blockCh
+			return HookActionContinue, nil
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Start the Apply in a goroutine and stop it once it is paused
+	stateCh := make(chan *State)
+	go func() {
+		state, err := ctx.Apply()
+		if err != nil {
+			panic(err)
+		}
+
+		stateCh <- state
+	}()
+
+	<-pausedCh
+	ctx.Stop()
+
+	state := <-stateCh
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.db:
+  ID = foo
+  num = 2
+  type = aws_instance
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
 func TestContext2Apply_compute(t *testing.T) {
 	m := testModule(t, "apply-compute")
 	p := testProvider("aws")
@@ -522,6 +730,119 @@ func TestContext2Apply_countDecrease(t *testing.T) {
 	}
 }
 
+// The instances beyond a lowered count are destroyed after the instances
+// that are kept are updated.
+func TestContext2Apply_countDecreaseOrder(t *testing.T) {
+	m := testModule(t, "apply-count-dec")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var order []string
+	var orderLock sync.Mutex
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		orderLock.Lock()
+		order = append(order, info.Id)
+		orderLock.Unlock()
+
+		return testApplyFn(info, is, id)
+	}
+
+	resources := make(map[string]*ResourceState)
+	for i := 0; i < 3; i++ {
+		resources[fmt.Sprintf("aws_instance.foo.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: fmt.Sprintf("foo%d", i),
+				Attributes: map[string]string{
+					"foo":  "old",
+					"type": "aws_instance",
+				},
+			},
+		}
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: resources,
+				},
+			},
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	idx := make(map[string]int)
+	for i, id := range order {
+		idx[id] = i
+	}
+	for _, id := range []string{"aws_instance.foo.0", "aws_instance.foo.1"} {
+		if _, ok := idx[id]; !ok || idx[id] > idx["aws_instance.foo.2"] {
+			t.Fatalf("bad: %#v", order)
+		}
+	}
+}
+
+func TestContext2Apply_countZeroTargeted(t *testing.T) {
+	m := testModule(t, "plan-count-zero-targeted")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+					"aws_instance.foo.1": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "baz"},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:   s,
+		Targets: []string{"aws_instance.foo"},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	if actual != "<no state>" {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
 func TestContext2Apply_countDecreaseToOne(t *testing.T) {
 	m := testModule(t, "apply-count-dec-one")
 	p := testProvider("aws")
@@ -751,23 +1072,280 @@ func TestContext2Apply_module(t *testing.T) {
 	}
 }
 
-func TestContext2Apply_moduleDestroyOrder(t *testing.T) {
-	m := testModule(t, "apply-module-destroy-order")
+func TestContext2Apply_moduleCount(t *testing.T) {
+	m := testModule(t, "apply-module-count")
 	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
-	// Create a custom apply function to track the order they were destroyed
-	var order []string
-	var orderLock sync.Mutex
-	p.ApplyFn = func(
-		info *InstanceInfo,
-		is *InstanceState,
-		id *InstanceDiff) (*InstanceState, error) {
-		orderLock.Lock()
-		defer orderLock.Unlock()
-
-		order = append(order, is.ID)
-		return nil, nil
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+<no state>
+module.child[0]:
+  aws_instance.foo:
+    ID = foo
+    type = aws_instance
+    value = child-0
+module.child[1]:
+  aws_instance.foo:
+    ID = foo
+    type = aws_instance
+    value = child-1
+`)
+}
+
+func TestContext2Apply_moduleCountDecrease(t *testing.T) {
+	m := testModule(t, "apply-module-count")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{Modules: []*ModuleState{&ModuleState{Path: rootModulePath}}}
+	for i := 0; i < 3; i++ {
+		state.Modules = append(state.Modules, &ModuleState{
+			Path: []string{"root", moduleInstanceName("child", i)},
+			Resources: map[string]*ResourceState{
+				"aws_instance.foo": &ResourceState{
+					Type: "aws_instance",
+					Primary: &InstanceState{
+						ID: "bar",
+						Attributes: map[string]string{
+							"value": fmt.Sprintf("child-%d", i),
+						},
+					},
+				},
+			},
+		})
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The instance beyond the count is destroyed
+	checkStateString(t, state, `
+<no state>
+module.child[0]:
+  aws_instance.foo:
+    ID = bar
+    value = child-0
+module.child[1]:
+  aws_instance.foo:
+    ID = bar
+    value = child-1
+module.child[2]:
+  <no state>
+`)
+}
+
+func TestContext2Apply_moduleCountIncreaseFromOne(t *testing.T) {
+	m := testModule(t, "apply-module-count")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{Path: rootModulePath},
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"value": "child-0",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The module without a count becomes the first instance instead of
+	// being destroyed and created again
+	if md := plan.Diff.ModuleByPath([]string{"root", "child"}); md != nil && !md.Empty() {
+		t.Fatalf("bad:\n%s", plan.Diff)
+	}
+	if md := plan.Diff.ModuleByPath([]string{"root", "child[0]"}); md != nil && !md.Empty() {
+		t.Fatalf("bad:\n%s", plan.Diff)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+<no state>
+module.child[0]:
+  aws_instance.foo:
+    ID = bar
+    value = child-0
+module.child[1]:
+  aws_instance.foo:
+    ID = foo
+    type = aws_instance
+    value = child-1
+`)
+}
+
+func TestContext2Apply_moduleCountDecreaseToOne(t *testing.T) {
+	m := testModule(t, "apply-module-count-one")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{Modules: []*ModuleState{&ModuleState{Path: rootModulePath}}}
+	for i := 0; i < 2; i++ {
+		state.Modules = append(state.Modules, &ModuleState{
+			Path: []string{"root", moduleInstanceName("child", i)},
+			Resources: map[string]*ResourceState{
+				"aws_instance.foo": &ResourceState{
+					Type: "aws_instance",
+					Primary: &InstanceState{
+						ID: "bar",
+						Attributes: map[string]string{
+							"value": fmt.Sprintf("child-%d", i),
+						},
+					},
+				},
+			},
+		})
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The first instance becomes the module without a count, and the
+	// others are destroyed
+	checkStateString(t, state, `
+<no state>
+module.child:
+  aws_instance.foo:
+    ID = bar
+    value = child-0
+module.child[1]:
+  <no state>
+`)
+}
+
+func TestContext2Apply_moduleCountVar(t *testing.T) {
+	m := testModule(t, "apply-module-count-var")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]string{
+			"n": "2",
+		},
+	})
+
+	if w, e := ctx.Validate(); len(w) > 0 || len(e) > 0 {
+		t.Fatalf("bad: %#v %#v", w, e)
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+<no state>
+module.child[0]:
+  aws_instance.foo:
+    ID = foo
+    type = aws_instance
+    value = child-0
+module.child[1]:
+  aws_instance.foo:
+    ID = foo
+    type = aws_instance
+    value = child-1
+`)
+}
+
+func TestContext2Apply_moduleDestroyOrder(t *testing.T) {
+	m := testModule(t, "apply-module-destroy-order")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	// Create a custom apply function to track the order they were destroyed
+	var order []string
+	var orderLock sync.Mutex
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		orderLock.Lock()
+		defer orderLock.Unlock()
+
+		order = append(order, is.ID)
+		return nil, nil
 	}
 
 	state := &State{
@@ -1297,146 +1875,97 @@ func TestContext2Apply_providerComputedVar(t *testing.T) {
 	}
 }
 
-func TestContext2Apply_Provisioner_compute(t *testing.T) {
-	m := testModule(t, "apply-provisioner-compute")
-	p := testProvider("aws")
-	pr := testProvisioner()
+func TestContext2Apply_dataSource(t *testing.T) {
+	m := testModule(t, "apply-data-source")
+	p := testDataSourceProviderFor(testProvider("aws"))
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok || val != "computed_dynamical" {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
-		}
-
-		return nil
-	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		Variables: map[string]string{
-			"value": "1",
-		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
+	// The data source was read by the plan, it isn't part of the apply
+	p.ReadDataSourceCalled = false
 	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if p.ReadDataSourceCalled {
+		t.Fatal("the apply shouldn't read the data source")
+	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
+	expected := strings.TrimSpace(testTerraformApplyDataSourceStr)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Apply_provisionerCreateFail(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-create")
-	p := testProvider("aws")
-	pr := testProvisioner()
-	p.DiffFn = testDiffFn
-
+func TestContext2Apply_dataSourceComputed(t *testing.T) {
+	m := testModule(t, "apply-data-source-computed")
+	p := testDataSourceProviderFor(testProvider("aws"))
 	p.ApplyFn = func(
 		info *InstanceInfo,
-		is *InstanceState,
-		id *InstanceDiff) (*InstanceState, error) {
-		is.ID = "foo"
-		return is, fmt.Errorf("error")
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		result, err := testApplyFn(info, s, d)
+		if result != nil && result.Attributes["ami_name"] == config.UnknownVariableValue {
+			result.Attributes["ami_name"] = "ubuntu"
+		}
+		return result, err
 	}
-
+	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if p.ReadDataSourceCalled {
+		t.Fatal("the plan shouldn't read the data source")
+	}
 
+	// The data source is read once aws_instance.foo is created
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.ReadDataSourceCalled {
+		t.Fatal("the apply should read the data source")
+	}
+	if v, _ := p.ReadDataSourceConfig.Get("name"); v != "ubuntu" {
+		t.Fatalf("bad: %#v", v)
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateStr)
+	expected := strings.TrimSpace(testTerraformApplyDataSourceComputedStr)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Apply_provisionerCreateFailNoId(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-create")
+func TestContext2Apply_dryRun(t *testing.T) {
+	m := testModule(t, "apply-provisioner-compute")
+	b := new(MockStateBackend)
+	h := new(MockHook)
 	p := testProvider("aws")
 	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-
-	p.ApplyFn = func(
-		info *InstanceInfo,
-		is *InstanceState,
-		id *InstanceDiff) (*InstanceState, error) {
-		return nil, fmt.Errorf("error")
-	}
-
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-	})
-
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
-
-	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
-	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateNoIdStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
-}
-
-func TestContext2Apply_provisionerFail(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail")
-	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-
-	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
-		return fmt.Errorf("EXPLOSION")
-	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -1446,6 +1975,8 @@ func TestContext2Apply_provisionerFail(t *testing.T) {
 		Variables: map[string]string{
 			"value": "1",
 		},
+		StateBackend: b,
+		DryRun:       true,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -1453,40 +1984,76 @@ func TestContext2Apply_provisionerFail(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.ApplyCalled {
+		t.Fatal("should not apply")
+	}
+	if pr.ApplyCalled {
+		t.Fatal("should not provision")
+	}
+	if b.LockCalled || b.WriteCalled > 0 {
+		t.Fatalf("should not use the backend: %#v", b)
+	}
+	if h.PostStateUpdateCalled {
+		t.Fatal("should not update the state")
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailStr)
+	expected := strings.TrimSpace(testTerraformApplyDryRunStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-create-before")
+func TestContext2Apply_createBeforeDestroyPropagate(t *testing.T) {
+	m := testModule(t, "apply-cbd-propagate")
 	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
-		return fmt.Errorf("EXPLOSION")
-	}
 
+	var l sync.Mutex
+	var order []string
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+
+		if d.Destroy {
+			order = append(order, "destroy "+s.ID)
+		} else {
+			order = append(order, "create "+info.Id)
+		}
+
+		return testApplyFn(info, s, d)
+	}
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.lc": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "lc-old",
 							Attributes: map[string]string{
-								"require_new": "abc",
+								"require_new": "old",
+							},
+						},
+					},
+					"aws_instance.asg": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "asg-old",
+							Attributes: map[string]string{
+								"require_new": "old",
+								"lc":          "old",
 							},
 						},
+						Dependencies: []string{"aws_instance.lc"},
 					},
 				},
 			},
@@ -1497,9 +2064,6 @@ func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 		State: state,
 	})
 
@@ -1507,81 +2071,92 @@ func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateBeforeDestroyStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// The dependent is created before it is destroyed too
+	expected := []string{
+		"create aws_instance.lc",
+		"create aws_instance.asg",
+		"destroy asg-old",
+		"destroy lc-old",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
 	}
 }
 
-func TestContext2Apply_error_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-error-create-before")
+func TestContext2Apply_Provisioner_compute(t *testing.T) {
+	m := testModule(t, "apply-provisioner-compute")
 	p := testProvider("aws")
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-							Attributes: map[string]string{
-								"require_new": "abc",
-							},
-						},
-					},
-				},
-			},
-		},
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok || val != "computed_dynamical" {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		return nil
 	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: state,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]string{
+			"value": "1",
+		},
 	})
-	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
-		return nil, fmt.Errorf("error")
-	}
-	p.DiffFn = testDiffFn
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyErrorCreateBeforeDestroyStr)
+	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
 	if actual != expected {
-		t.Fatalf("bad: \n%s\n\nExpected:\n\n%s", actual, expected)
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
 	}
 }
 
-func TestContext2Apply_errorDestroy_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-error-create-before")
+func TestContext2CheckProvisioners(t *testing.T) {
+	m := testModule(t, "provisioner-check")
 	p := testProvider("aws")
-	state := &State{
+	pr := testProvisioner()
+	pr.CheckFn = func(rs *InstanceState, c *ResourceConfig) error {
+		if c.Config["source"] != "i-abc.sh" {
+			return fmt.Errorf("bad source: %#v", c.Config["source"])
+		}
+
+		return nil
+	}
+	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.web": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "i-abc",
 							Attributes: map[string]string{
-								"require_new": "abc",
+								"id": "i-abc",
 							},
 						},
 					},
@@ -1594,190 +2169,238 @@ func TestContext2Apply_errorDestroy_createBeforeDestroy(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: state,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State: s,
 	})
-	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
-		// Fail the destroy!
-		if id.Destroy {
-			return is, fmt.Errorf("error")
-		}
 
-		// Create should work
-		is = &InstanceState{
-			ID: "foo",
-		}
-		return is, nil
+	// Only the resource that exists is checked
+	if err := ctx.CheckProvisioners(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !pr.CheckCalled {
+		t.Fatal("check should be called")
+	}
+	if pr.CheckState.ID != "i-abc" {
+		t.Fatalf("bad: %#v", pr.CheckState)
 	}
-	p.DiffFn = testDiffFn
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
+	// Nothing is changed
+	if pr.ApplyCalled {
+		t.Fatal("provisioner should not be applied")
+	}
+	if p.ApplyCalled {
+		t.Fatal("provider should not be applied")
 	}
 
-	state, err := ctx.Apply()
+	// Check errors are returned
+	pr.CheckFn = nil
+	pr.CheckReturnError = fmt.Errorf("host unreachable")
+	err := ctx.CheckProvisioners()
 	if err == nil {
-		t.Fatal("should have error")
+		t.Fatal("should error")
 	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyErrorDestroyCreateBeforeDestroyStr)
-	if actual != expected {
-		t.Fatalf("bad: actual:\n%s\n\nexpected:\n%s", actual, expected)
+	if !strings.Contains(err.Error(), "host unreachable") {
+		t.Fatalf("bad: %s", err)
 	}
 }
 
-func TestContext2Apply_multiDepose_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-multi-depose-create-before-destroy")
+func TestContext2Apply_changeWindow(t *testing.T) {
+	day := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { changeWindowNow = old }(changeWindowNow)
+
+	m := testModule(t, "apply-change-window")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
-	ps := map[string]ResourceProviderFactory{"aws": testProviderFuncFixed(p)}
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.web": &ResourceState{
-						Type:    "aws_instance",
-						Primary: &InstanceState{ID: "foo"},
-					},
-				},
-			},
-		},
+
+	var lock sync.Mutex
+	applied := make(map[string]int)
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		applied[info.Id]++
+		lock.Unlock()
+
+		return testApplyFn(info, s, d)
+	}
+	providers := map[string]ResourceProviderFactory{
+		"aws": testProviderFuncFixed(p),
 	}
 
+	// Outside of the window, foo is queued
+	changeWindowNow = func() time.Time { return day.Add(12 * time.Hour) }
 	ctx := testContext2(t, &ContextOpts{
 		Module:    m,
-		Providers: ps,
-		State:     state,
+		Providers: providers,
 	})
-	createdInstanceId := "bar"
-	// Create works
-	createFunc := func(is *InstanceState) (*InstanceState, error) {
-		return &InstanceState{ID: createdInstanceId}, nil
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	// Destroy starts broken
-	destroyFunc := func(is *InstanceState) (*InstanceState, error) {
-		return is, fmt.Errorf("destroy failed")
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
-		if id.Destroy {
-			return destroyFunc(is)
-		} else {
-			return createFunc(is)
-		}
+	if _, ok := state.RootModule().Resources["aws_instance.foo"]; ok {
+		t.Fatalf("foo should be queued:\n%s", state)
+	}
+	if applied["aws_instance.bar"] != 1 {
+		t.Fatalf("bad: %#v", applied)
 	}
 
-	if _, err := ctx.Plan(); err != nil {
+	queued := ctx.QueuedPlan()
+	if queued == nil {
+		t.Fatal("should have a queued plan")
+	}
+	rd := queued.Diff.RootModule().Resources["aws_instance.foo"]
+	if rd == nil || len(queued.Diff.RootModule().Resources) != 1 {
+		t.Fatalf("bad: %s", queued.Diff)
+	}
+	if expected := day.Add(26 * time.Hour); !rd.ScheduledFor.Equal(expected) {
+		t.Fatalf("bad: %s", rd.ScheduledFor)
+	}
+
+	// The queued plan is saved, like a plan file, so that it can be
+	// resumed more than once
+	var buf bytes.Buffer
+	if err := WritePlan(queued, &buf); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	readQueued := func() *Plan {
+		p, err := ReadPlan(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
 
-	// Destroy is broken, so even though CBD successfully replaces the instance,
-	// we'll have to save the Deposed instance to destroy later
-	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+		return p
 	}
 
-	checkStateString(t, state, `
-aws_instance.web: (1 deposed)
-  ID = bar
-  Deposed ID 1 = foo
-	`)
+	// Once the window is open, resuming applies foo
+	changeWindowNow = func() time.Time { return day.Add(26*time.Hour + 30*time.Minute) }
+	queued = readQueued()
+	state, err = queued.Context(&ContextOpts{Providers: providers}).Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := state.RootModule().Resources["aws_instance.foo"]; !ok {
+		t.Fatalf("foo should be applied:\n%s", state)
+	}
+	if applied["aws_instance.foo"] != 1 || applied["aws_instance.bar"] != 1 {
+		t.Fatalf("bad: %#v", applied)
+	}
 
-	createdInstanceId = "baz"
-	ctx = testContext2(t, &ContextOpts{
-		Module:    m,
-		Providers: ps,
-		State:     state,
-	})
-
-	if _, err := ctx.Plan(); err != nil {
+	// Resuming again with the new state doesn't apply it again
+	queued = readQueued()
+	queued.State = state
+	state, err = queued.Context(&ContextOpts{Providers: providers}).Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
-	// We're replacing the primary instance once again. Destroy is _still_
-	// broken, so the Deposed list gets longer
-	state, err = ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+	if _, ok := state.RootModule().Resources["aws_instance.foo"]; !ok {
+		t.Fatalf("foo should be applied:\n%s", state)
+	}
+	if applied["aws_instance.foo"] != 1 {
+		t.Fatalf("bad: %#v", applied)
 	}
+}
 
-	checkStateString(t, state, `
-aws_instance.web: (2 deposed)
-  ID = baz
-  Deposed ID 1 = foo
-  Deposed ID 2 = bar
-	`)
+func TestContext2Apply_changeWindowDependent(t *testing.T) {
+	day := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { changeWindowNow = old }(changeWindowNow)
 
-	// Destroy partially fixed!
-	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
-		if is.ID == "foo" || is.ID == "baz" {
-			return nil, nil
-		} else {
-			return is, fmt.Errorf("destroy partially failed")
-		}
+	m := testModule(t, "apply-change-window-dependent")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	applied := make(map[string]int)
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		applied[info.Id]++
+		lock.Unlock()
+
+		return testApplyFn(info, s, d)
+	}
+	providers := map[string]ResourceProviderFactory{
+		"aws": testProviderFuncFixed(p),
 	}
 
-	createdInstanceId = "qux"
+	// Outside of the window, foo is queued and so are bar and baz, which
+	// depend on it
+	changeWindowNow = func() time.Time { return day.Add(12 * time.Hour) }
+	ctx := testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: providers,
+	})
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	state, err = ctx.Apply()
-	// Expect error because 1/2 of Deposed destroys failed
-	if err == nil {
-		t.Fatal("should have error")
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(state.RootModule().Resources) != 0 || len(applied) != 0 {
+		t.Fatalf("bad: %#v\n\n%s", applied, state)
 	}
 
-	// foo and baz are now gone, bar sticks around
-	checkStateString(t, state, `
-aws_instance.web: (1 deposed)
-  ID = qux
-  Deposed ID 1 = bar
-	`)
-
-	// Destroy working fully!
-	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
-		return nil, nil
+	queued := ctx.QueuedPlan()
+	if queued == nil {
+		t.Fatal("should have a queued plan")
+	}
+	resources := queued.Diff.RootModule().Resources
+	if len(resources) != 3 {
+		t.Fatalf("bad: %s", queued.Diff)
+	}
+	for _, k := range []string{
+		"aws_instance.foo", "aws_instance.bar", "aws_instance.baz"} {
+		rd := resources[k]
+		if rd == nil {
+			t.Fatalf("%s should be queued: %s", k, queued.Diff)
+		}
+		if expected := day.Add(26 * time.Hour); !rd.ScheduledFor.Equal(expected) {
+			t.Fatalf("%s: bad: %s", k, rd.ScheduledFor)
+		}
 	}
 
-	createdInstanceId = "quux"
-	if _, err := ctx.Plan(); err != nil {
+	// Once the window is open, resuming applies all of them
+	changeWindowNow = func() time.Time { return day.Add(26*time.Hour + 30*time.Minute) }
+	state, err = queued.Context(&ContextOpts{Providers: providers}).Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	state, err = ctx.Apply()
-	if err != nil {
-		t.Fatal("should not have error:", err)
+	for _, k := range []string{
+		"aws_instance.foo", "aws_instance.bar", "aws_instance.baz"} {
+		if applied[k] != 1 {
+			t.Fatalf("bad: %#v", applied)
+		}
 	}
 
-	// And finally the state is clean
-	checkStateString(t, state, `
-aws_instance.web:
-  ID = quux
-	`)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyChangeWindowDependentStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 }
 
-func TestContext2Apply_provisionerResourceRef(t *testing.T) {
-	m := testModule(t, "apply-provisioner-resource-ref")
+func TestContext2Apply_attributeWatchlist(t *testing.T) {
+	m := testModule(t, "apply-good")
+	h := new(MockHook)
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok || val != "2" {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
-		}
-
-		return nil
-	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
+		AttributeWatchlist: []*AttributeWatch{
+			&AttributeWatch{Pattern: "num"},
 		},
 	})
 
@@ -1785,46 +2408,37 @@ func TestContext2Apply_provisionerResourceRef(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerResourceRefStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if !h.PostApplyWatchedCalled {
+		t.Fatal("should be called")
+	}
+	if h.PostApplyWatchedInfo.Id != "aws_instance.foo" {
+		t.Fatalf("bad: %#v", h.PostApplyWatchedInfo)
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	expected := []*AttributeChange{
+		&AttributeChange{Attribute: "num", New: "2"},
+	}
+	if !reflect.DeepEqual(h.PostApplyWatchedChanges, expected) {
+		t.Fatalf("bad: %#v", h.PostApplyWatchedChanges)
 	}
 }
 
-func TestContext2Apply_provisionerSelfRef(t *testing.T) {
-	m := testModule(t, "apply-provisioner-self-ref")
+func TestContext2Apply_rollout(t *testing.T) {
+	m := testModule(t, "apply-rollout")
+	h := new(MockHook)
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["command"]
-		if !ok || val != "bar" {
-			t.Fatalf("bad value for command: %v %#v", val, c)
-		}
-
-		return nil
-	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -1836,160 +2450,2971 @@ func TestContext2Apply_provisionerSelfRef(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerSelfRefStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if len(state.RootModule().Resources) != 4 {
+		t.Fatalf("bad: %s", state)
 	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	if !h.WaitForContinueCalled {
+		t.Fatal("should pause")
+	}
+	if h.WaitForContinueMessage != "verify (wave 1 of 2 done)" {
+		t.Fatalf("bad: %s", h.WaitForContinueMessage)
 	}
 }
 
-func TestContext2Apply_provisionerMultiSelfRef(t *testing.T) {
-	var lock sync.Mutex
-	commands := make([]string, 0, 5)
-
-	m := testModule(t, "apply-provisioner-multi-self-ref")
+func TestContext2Apply_rolloutReplaceWaveFails(t *testing.T) {
+	m := testModule(t, "apply-rollout-replace")
 	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+
+	var lock sync.Mutex
+	var applied []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
 		lock.Lock()
 		defer lock.Unlock()
-
-		val, ok := c.Config["command"]
-		if !ok {
-			t.Fatalf("bad value for command: %v %#v", val, c)
+		if d.Destroy {
+			applied = append(applied, "destroy "+info.Id)
+			return nil, nil
 		}
 
-		commands = append(commands, val.(string))
-		return nil
+		applied = append(applied, "create "+info.Id)
+		if info.Id == "aws_instance.foo.1" {
+			return nil, fmt.Errorf("unhealthy")
+		}
+		return testApplyFn(info, s, d)
 	}
 
+	resources := make(map[string]*ResourceState)
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("i-%d", i)
+		resources[fmt.Sprintf("aws_instance.foo.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: id,
+				Attributes: map[string]string{
+					"id":          id,
+					"require_new": "no",
+				},
+			},
+		}
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: resources,
+				},
+			},
 		},
 	})
 
-	if _, err := ctx.Plan(); err != nil {
+	plan, err := ctx.Plan()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if n := strings.Count(plan.Diff.String(), "DESTROY/CREATE"); n != 4 {
+		t.Fatalf("should replace all of them:\n%s", plan.Diff)
+	}
 
 	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if err == nil {
+		t.Fatal("should have error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerMultiSelfRefStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// Only the first wave is replaced, the second is kept when it fails
+	sort.Strings(applied)
+	expected := []string{
+		"create aws_instance.foo.0",
+		"create aws_instance.foo.1",
+		"destroy aws_instance.foo.0",
+		"destroy aws_instance.foo.1",
 	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	if !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("bad: %#v", applied)
 	}
-
-	// Verify our result
-	sort.Strings(commands)
-	expectedCommands := []string{"number 0", "number 1", "number 2"}
-	if !reflect.DeepEqual(commands, expectedCommands) {
-		t.Fatalf("bad: %#v", commands)
+	for i := 2; i < 4; i++ {
+		rs := state.RootModule().Resources[fmt.Sprintf("aws_instance.foo.%d", i)]
+		if rs == nil || rs.Primary == nil || rs.Primary.ID != fmt.Sprintf("i-%d", i) {
+			t.Fatalf("%d: should be kept: %s", i, state)
+		}
 	}
 }
 
-// Provisioner should NOT run on a diff, only create
-func TestContext2Apply_Provisioner_Diff(t *testing.T) {
-	m := testModule(t, "apply-provisioner-diff")
+func TestContext2Apply_rolloutWaveFails(t *testing.T) {
+	m := testModule(t, "apply-rollout")
+	h := new(MockHook)
 	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		return nil
+
+	var lock sync.Mutex
+	var applied []string
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		applied = append(applied, info.Id)
+		lock.Unlock()
+
+		if info.Id == "aws_instance.foo.1" {
+			return nil, fmt.Errorf("error")
+		}
+
+		return testApplyFn(info, s, d)
 	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerDiffStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// The second wave is never started
+	sort.Strings(applied)
+	expected := []string{"aws_instance.foo.0", "aws_instance.foo.1"}
+	if !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("bad: %#v", applied)
 	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	if h.WaitForContinueCalled {
+		t.Fatal("should not pause")
 	}
-	pr.ApplyCalled = false
-
-	// Change the state to force a diff
-	mod := state.RootModule()
-	mod.Resources["aws_instance.bar"].Primary.Attributes["foo"] = "baz"
+}
 
-	// Re-create context with state
-	ctx = testContext2(t, &ContextOpts{
+func TestContext2Apply_auditLog(t *testing.T) {
+	m := testModule(t, "apply-good")
+	sink := new(MockAuditSink)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		State: state,
+		AuditLog: &AuditLog{Sink: sink, Actor: "alice"},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state2, err := ctx.Apply()
-	if err != nil {
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual = strings.TrimSpace(state2.String())
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if len(sink.Records) != 2 {
+		t.Fatalf("bad: %#v", sink.Records)
 	}
-
-	// Verify apply was NOT invoked
-	if pr.ApplyCalled {
-		t.Fatalf("provisioner invoked")
+	for _, r := range sink.Records {
+		if r.Action != "create" || r.Actor != "alice" {
+			t.Fatalf("bad: %#v", r)
+		}
 	}
 }
 
-func TestContext2Apply_outputDiffVars(t *testing.T) {
+func TestContext2Apply_auditLogRequired(t *testing.T) {
 	m := testModule(t, "apply-good")
+	sink := &MockAuditSink{WriteAuditError: fmt.Errorf("down")}
 	p := testProvider("aws")
-	s := &State{
-		Modules: []*ModuleState{
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		AuditLog: &AuditLog{Sink: sink, Required: true},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "error writing audit record") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestContext2Apply_auditLogUndelivered(t *testing.T) {
+	m := testModule(t, "apply-good")
+	sink := &MockAuditSink{WriteAuditError: fmt.Errorf("down")}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		AuditLog: &AuditLog{Sink: sink},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The records that can't be delivered fail the apply once it ends,
+	// even though the audit log isn't required
+	state, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "2 record(s) buffered") {
+		t.Fatalf("bad: %v", err)
+	}
+	if len(state.RootModule().Resources) != 2 {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+func TestContext2Apply_auditLogError(t *testing.T) {
+	m := testModule(t, "apply-error")
+	sink := new(MockAuditSink)
+	p := testProvider("aws")
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if info.Id == "aws_instance.bar" {
+			return &InstanceState{ID: "bar"}, fmt.Errorf("error")
+		}
+
+		return &InstanceState{
+			ID:         "foo",
+			Attributes: map[string]string{"num": "2"},
+		}, nil
+	}
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		AuditLog: &AuditLog{Sink: sink},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
+	}
+
+	// The failed apply is audited too
+	errs := make(map[string]string)
+	for _, r := range sink.Records {
+		errs[r.Address] = r.Error
+	}
+	expected := map[string]string{
+		"aws_instance.foo": "",
+		"aws_instance.bar": "error",
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Fatalf("bad: %#v", errs)
+	}
+}
+
+func TestContext2Apply_coordinator(t *testing.T) {
+	m := testModule(t, "apply-good")
+	h := new(MockHook)
+	c := &MockCoordinator{LockLeader: true}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Coordinator: c,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.LockCalled || c.WriteMarkerCalled {
+		t.Fatal("should only coordinate the apply")
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !c.LockCalled || !c.UnlockCalled {
+		t.Fatal("should lock")
+	}
+	if c.Marker == nil || c.Marker.Serial != 1 {
+		t.Fatalf("bad: %#v", c.Marker)
+	}
+	if !h.WalkStartCalled || h.WalkStartWalk != "walkApply" {
+		t.Fatalf("bad: %#v", h)
+	}
+	if !h.WalkEndCalled || h.WalkEndWalk != "walkApply" || h.WalkEndErr != nil {
+		t.Fatalf("bad: %#v", h)
+	}
+}
+
+func TestContext2Apply_coordinatorNotLeader(t *testing.T) {
+	m := testModule(t, "apply-good")
+	c := new(MockCoordinator)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Coordinator: c,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "isn't the leader") {
+		t.Fatalf("bad: %v", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("should not apply")
+	}
+	if !c.UnlockCalled {
+		t.Fatal("should unlock")
+	}
+	if c.WriteMarkerCalled {
+		t.Fatal("should not write marker")
+	}
+}
+
+func TestContext2Apply_stateBackend(t *testing.T) {
+	m := testModule(t, "apply-good")
+	b := new(MockStateBackend)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StateBackend: b,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !b.LockCalled || !b.UnlockCalled || !b.ReadCalled {
+		t.Fatalf("bad: %#v", b)
+	}
+	if b.LockInfo.Operation != "apply" || b.LockInfo.Who == "" {
+		t.Fatalf("bad: %#v", b.LockInfo)
+	}
+	if b.WriteCalled < 2 {
+		t.Fatalf("should write on every update: %d", b.WriteCalled)
+	}
+	if b.State.Serial != state.Serial || state.Serial == 0 {
+		t.Fatalf("bad: %d %d", b.State.Serial, state.Serial)
+	}
+
+	actual := strings.TrimSpace(b.State.String())
+	expected := strings.TrimSpace(testTerraformApplyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_stateBackendFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	m := testModule(t, "apply-good")
+	b := &FileStateBackend{Path: filepath.Join(dir, "terraform.tfstate")}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StateBackend:    b,
+		StateWriteEvery: 100,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The final state is written even if no write was due
+	actual, err := b.Read()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual.Serial != state.Serial {
+		t.Fatalf("bad: %d %d", actual.Serial, state.Serial)
+	}
+	if actual.String() != state.String() {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_stateBackendErrorPartial(t *testing.T) {
+	errored := false
+
+	m := testModule(t, "apply-error")
+	b := new(MockStateBackend)
+	p := testProvider("aws")
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:        s,
+		StateBackend: b,
+	})
+
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if errored {
+			return s, fmt.Errorf("error")
+		}
+		errored = true
+
+		return &InstanceState{
+			ID: "foo",
+			Attributes: map[string]string{
+				"num": "2",
+			},
+		}, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
+				},
+			},
+		}, nil
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if !b.UnlockCalled {
+		t.Fatal("should unlock")
+	}
+
+	b.State.prune()
+	actual := strings.TrimSpace(b.State.String())
+	expected := strings.TrimSpace(testTerraformApplyErrorPartialStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_stateBackendLocked(t *testing.T) {
+	m := testModule(t, "apply-good")
+	b := &MockStateBackend{LockError: fmt.Errorf("held by another run")}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StateBackend: b,
+	})
+
+	_, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "held by another run") {
+		t.Fatalf("bad: %v", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("should not apply")
+	}
+	if b.UnlockCalled || b.WriteCalled > 0 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestContext2Apply_stateBackendLockedBy(t *testing.T) {
+	m := testModule(t, "apply-good")
+	b := &MockStateBackend{
+		LockError: &StateLockedError{
+			Info: &StateLockInfo{
+				Who:       "alice@ci",
+				Operation: "apply",
+			},
+		},
+	}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StateBackend: b,
+	})
+
+	_, err := ctx.Apply()
+	if _, ok := err.(*StateLockedError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !strings.Contains(err.Error(), "locked by alice@ci for apply") {
+		t.Fatalf("bad: %s", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("should not apply")
+	}
+}
+
+func TestContext2Apply_stateBackendStale(t *testing.T) {
+	m := testModule(t, "apply-good")
+	b := &MockStateBackend{
+		State: &State{Serial: 3},
+	}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:        &State{Serial: 2},
+		StateBackend: b,
+	})
+
+	_, err := ctx.Apply()
+	if _, ok := err.(*StaleStateError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("should not apply")
+	}
+	if !b.UnlockCalled {
+		t.Fatal("should unlock")
+	}
+	if b.WriteCalled > 0 || b.State.Serial != 3 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestContext2Apply_providerPrerequisites(t *testing.T) {
+	m := testModule(t, "apply-count-variable")
+	p := &testPrerequisiteProvider{
+		MockResourceProvider: testProvider("aws"),
+		PrerequisitesMap: map[string][]string{
+			"aws_instance": []string{"vpc"},
+		},
+	}
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		p.lock.Lock()
+		ensured := len(p.Ensured)
+		p.lock.Unlock()
+		if ensured == 0 {
+			return nil, fmt.Errorf("%s: prerequisite not found", info.Id)
+		}
+
+		return testApplyFn(info, s, d)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]string{
+			"foo": "3",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The prerequisite is shared by all the instances
+	if !reflect.DeepEqual(p.Ensured, []string{"vpc"}) {
+		t.Fatalf("bad: %#v", p.Ensured)
+	}
+}
+
+func TestContext2Apply_costBudget(t *testing.T) {
+	for _, confirm := range []bool{false, true} {
+		m := testModule(t, "apply-count-variable")
+		p := &testCostProvider{
+			MockResourceProvider: testProvider("aws"),
+			Costs:                map[string]float64{"aws_instance": 20},
+		}
+		p.DiffFn = testDiffFn
+		p.ApplyFn = testApplyFn
+		h := &testCostConfirmHook{Confirm: confirm}
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Hooks:  []Hook{h},
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]string{
+				"foo": "3",
+			},
+			CostBudget: 50,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		_, err := ctx.Apply()
+		if h.Summary == nil || h.Summary.Total != 60 {
+			t.Fatalf("confirm %t: bad: %#v", confirm, h.Summary)
+		}
+		if confirm {
+			if err != nil {
+				t.Fatalf("confirm %t: err: %s", confirm, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), "budget is 50.00") {
+			t.Fatalf("confirm %t: bad: %v", confirm, err)
+		}
+		if p.ApplyCalled {
+			t.Fatalf("confirm %t: nothing should be applied", confirm)
+		}
+	}
+}
+
+func TestContext2Apply_providerConcurrencyLimit(t *testing.T) {
+	m := testModule(t, "apply-count-variable")
+	p := &testLimitedProvider{
+		MockResourceProvider: testProvider("aws"),
+		Limit:                2,
+	}
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var running, max int
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+
+		return testApplyFn(info, s, d)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]string{
+			"foo": "6",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if n := len(state.RootModule().Resources); n != 6 {
+		t.Fatalf("bad: %d\n%s", n, state)
+	}
+	if max > 2 {
+		t.Fatalf("bad: %d concurrent applies", max)
+	}
+}
+
+func TestContext2Apply_provisionerTriggers(t *testing.T) {
+	m := testModule(t, "apply-provisioner-triggers")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr := testProvisioner()
+
+	apply := func(s *State, version string, check func(*Plan)) *State {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+			State: s,
+			Variables: map[string]string{
+				"version": version,
+			},
+		})
+
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if check != nil {
+			check(plan)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return state
+	}
+
+	// Provisioners always run on create, and the triggers are recorded
+	state := apply(nil, "1", nil)
+	if !pr.ApplyCalled {
+		t.Fatal("provisioner should run on create")
+	}
+	is := state.RootModule().Resources["aws_instance.foo"].Primary
+	if v := is.Meta["provisioner.0.triggers.version"]; v != "1" {
+		t.Fatalf("bad: %#v", is.Meta)
+	}
+
+	// Nothing changed, nothing runs
+	pr.ApplyCalled = false
+	state = apply(state, "1", func(plan *Plan) {
+		if !plan.Diff.Empty() {
+			t.Fatalf("bad:\n%s", plan.Diff)
+		}
+	})
+	if pr.ApplyCalled {
+		t.Fatal("provisioner should not run")
+	}
+
+	// The trigger changed, so the provisioner runs again
+	state = apply(state, "2", func(plan *Plan) {
+		rd := plan.Diff.RootModule().Resources["aws_instance.foo"]
+		if rd == nil || !rd.Provision || len(rd.Attributes) != 0 {
+			t.Fatalf("bad:\n%s", plan.Diff)
+		}
+	})
+	if !pr.ApplyCalled {
+		t.Fatal("provisioner should run")
+	}
+	is = state.RootModule().Resources["aws_instance.foo"].Primary
+	if v := is.Meta["provisioner.0.triggers.version"]; v != "2" {
+		t.Fatalf("bad: %#v", is.Meta)
+	}
+	if is.ID != "foo" {
+		t.Fatalf("bad: %#v", is)
+	}
+}
+
+func TestContext2Apply_softDependsOn(t *testing.T) {
+	m := testModule(t, "apply-soft-depends-on")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var order []string
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		order = append(order, info.Id)
+		lock.Unlock()
+
+		if _, ok := d.Attributes["error"]; ok {
+			return nil, fmt.Errorf("error")
+		}
+
+		return testApplyFn(info, s, d)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The failure of foo is still reported, but bar is applied after it
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := []string{"aws_instance.foo", "aws_instance.bar"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
+	}
+	if _, ok := state.RootModule().Resources["aws_instance.bar"]; !ok {
+		t.Fatalf("bad:\n%s", state)
+	}
+}
+
+func TestContext2Apply_softDependsOnModule(t *testing.T) {
+	m := testModule(t, "apply-soft-depends-on-module")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if _, ok := d.Attributes["error"]; ok {
+			return nil, fmt.Errorf("error")
+		}
+
+		return testApplyFn(info, s, d)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The dependency stays soft once the module is flattened, so bar is
+	// still applied after foo failed
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	mod := state.ModuleByPath([]string{"root", "child"})
+	if mod == nil || mod.Resources["aws_instance.bar"] == nil {
+		t.Fatalf("bad:\n%s", state)
+	}
+}
+
+func TestContext2Apply_provisionerOutput(t *testing.T) {
+	m := testModule(t, "apply-provisioner-output")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr := &testOutputProvisioner{
+		MockResourceProvisioner: testProvisioner(),
+		Output:                  "one\r\ntwo\n",
+	}
+	h := new(testProvisionOutputHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": func() (ResourceProvisioner, error) { return pr, nil },
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every line is output on its own with the instance it's from
+	sort.Strings(h.Lines)
+	expected := []string{
+		"aws_instance.foo.0 (shell): one",
+		"aws_instance.foo.0 (shell): two",
+		"aws_instance.foo.1 (shell): one",
+		"aws_instance.foo.1 (shell): two",
+	}
+	if !reflect.DeepEqual(h.Lines, expected) {
+		t.Fatalf("bad: %#v", h.Lines)
+	}
+}
+
+func TestContext2Apply_provisionerSecret(t *testing.T) {
+	m := testModule(t, "apply-provisioner-secret")
+	p := &testSecretsProvider{
+		MockResourceProvider: testProvider("aws"),
+		Secrets:              map[string]string{"password": "hunter2"},
+	}
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr := testProvisioner()
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		if c.Config["password"] != "hunter2" {
+			t.Fatalf("bad: %#v", c.Config)
+		}
+
+		pr.ApplyOutput.Output("Logging in with hunter2")
+		return nil
+	}
+	h := new(MockHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !pr.ApplyCalled {
+		t.Fatal("provisioner not invoked")
+	}
+	if h.ProvisionOutputMessage != "Logging in with <secret>" {
+		t.Fatalf("bad: %s", h.ProvisionOutputMessage)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteState(state, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("secret should not be in the state:\n%s", buf.String())
+	}
+}
+
+func TestContext2Apply_provisionerCreateFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-create")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		is.ID = "foo"
+		return is, fmt.Errorf("error")
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_provisionerCreateFailNoId(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-create")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		return nil, fmt.Errorf("error")
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateNoIdStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_provisionerFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
+		return fmt.Errorf("EXPLOSION")
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]string{
+			"value": "1",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_provisionerFailContinue(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-continue")
+	h := new(MockHook)
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var commands []string
+	pr.ApplyFn = func(s *InstanceState, c *ResourceConfig) error {
+		command := c.Config["command"].(string)
+		commands = append(commands, command)
+		if command == "notify" {
+			return fmt.Errorf("EXPLOSION")
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The provisioners after the failed one still run
+	if !reflect.DeepEqual(commands, []string{"notify", "configure"}) {
+		t.Fatalf("bad: %#v", commands)
+	}
+
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	if rs == nil || rs.Primary == nil || rs.Primary.ID != "foo" || len(rs.Tainted) != 0 {
+		t.Fatalf("bad: %s", state)
+	}
+
+	if !h.ProvisionFailedCalled {
+		t.Fatal("ProvisionFailed should be called")
+	}
+	if h.ProvisionFailedProvisionerId != "shell" {
+		t.Fatalf("bad: %s", h.ProvisionFailedProvisionerId)
+	}
+	if h.ProvisionFailedErr == nil || !strings.Contains(h.ProvisionFailedErr.Error(), "EXPLOSION") {
+		t.Fatalf("bad: %v", h.ProvisionFailedErr)
+	}
+}
+
+func TestContext2Apply_provisionerDestroy(t *testing.T) {
+	cases := map[string]struct {
+		Fail      string
+		Err       bool
+		Destroyed bool
+	}{
+		"success":  {"", false, true},
+		"failure":  {"drain bar", true, false},
+		"continue": {"notify", false, true},
+	}
+
+	for name, tc := range cases {
+		m := testModule(t, "apply-provisioner-destroy")
+		p := testProvider("aws")
+		pr := testProvisioner()
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+
+		var commands []string
+		pr.ApplyFn = func(s *InstanceState, c *ResourceConfig) error {
+			command := c.Config["command"].(string)
+			commands = append(commands, command)
+			if command == tc.Fail {
+				return fmt.Errorf("EXPLOSION")
+			}
+
+			return nil
+		}
+
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "bar",
+								Attributes: map[string]string{
+									"foo": "bar",
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+			State:   state,
+			Destroy: true,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		state, err := ctx.Apply()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", name, err)
+		}
+
+		expected := []string{"drain bar", "notify"}
+		if tc.Err {
+			expected = expected[:1]
+		}
+		if !reflect.DeepEqual(commands, expected) {
+			t.Fatalf("%s: bad: %#v", name, commands)
+		}
+
+		rs := state.RootModule().Resources["aws_instance.foo"]
+		if tc.Destroyed {
+			if rs != nil {
+				t.Fatalf("%s: bad: %#v", name, rs)
+			}
+			continue
+		}
+		if rs == nil || rs.Primary == nil || rs.Primary.ID != "bar" || rs.Pending {
+			t.Fatalf("%s: bad: %#v", name, rs)
+		}
+	}
+}
+
+func TestContext2Apply_migrateData(t *testing.T) {
+	cases := map[string]struct {
+		Fail string
+		Err  bool
+	}{
+		"success":     {"", false},
+		"provider":    {"migrate", true},
+		"provisioner": {"check foo", true},
+	}
+
+	for name, tc := range cases {
+		m := testModule(t, "apply-migrate-data")
+		p := testProvider("aws")
+		pr := testProvisioner()
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+
+		var steps []string
+		provider := &testMigrateDataProvider{
+			MockResourceProvider: p,
+			Type:                 "aws_instance",
+			MigrateFn: func(
+				info *InstanceInfo, from, to *InstanceState) error {
+				steps = append(steps, fmt.Sprintf("migrate %s %s", from.ID, to.ID))
+				if tc.Fail == "migrate" {
+					return fmt.Errorf("EXPLOSION")
+				}
+
+				return nil
+			},
+		}
+		pr.ApplyFn = func(s *InstanceState, c *ResourceConfig) error {
+			command := c.Config["command"].(string)
+			steps = append(steps, command)
+			if command == tc.Fail {
+				return fmt.Errorf("EXPLOSION")
+			}
+
+			return nil
+		}
+
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.bar": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "bar",
+								Attributes: map[string]string{
+									"require_new": "abc",
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(provider),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+			State: state,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		state, err := ctx.Apply()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", name, err)
+		}
+
+		expected := []string{"migrate bar foo", "check foo"}
+		if tc.Fail == "migrate" {
+			expected = expected[:1]
+		}
+		if !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("%s: bad: %#v", name, steps)
+		}
+
+		// A failed migration keeps the old instance and taints the new
+		rs := state.RootModule().Resources["aws_instance.bar"]
+		if !tc.Err {
+			if rs.Primary.ID != "foo" || len(rs.Deposed) != 0 || len(rs.Tainted) != 0 {
+				t.Fatalf("%s: bad: %s", name, state)
+			}
+			continue
+		}
+		if rs.Primary.ID != "bar" || len(rs.Deposed) != 0 {
+			t.Fatalf("%s: bad: %s", name, state)
+		}
+		if len(rs.Tainted) != 1 || rs.Tainted[0].ID != "foo" {
+			t.Fatalf("%s: bad: %s", name, state)
+		}
+	}
+}
+
+func TestContext2Apply_provisionerRetry(t *testing.T) {
+	for _, failures := range []int{2, 3} {
+		m := testModule(t, "apply-provisioner-retry")
+		p := testProvider("aws")
+		pr := testProvisioner()
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+
+		var commands []string
+		pr.ApplyFn = func(s *InstanceState, c *ResourceConfig) error {
+			command := c.Config["command"].(string)
+			commands = append(commands, command)
+			if command == "retried" && len(commands) <= failures {
+				return fmt.Errorf("connection refused")
+			}
+
+			return nil
+		}
+
+		h := new(MockHook)
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Hooks:  []Hook{h},
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err := ctx.Apply()
+		if !strings.Contains(h.ProvisionOutputMessage, "Attempt 2 of 3 failed") {
+			t.Fatalf("%d failures: bad: %q", failures, h.ProvisionOutputMessage)
+		}
+
+		rs := state.RootModule().Resources["aws_instance.foo"]
+		if failures < 3 {
+			if err != nil {
+				t.Fatalf("%d failures: err: %s", failures, err)
+			}
+
+			expected := []string{"retried", "retried", "retried", "once"}
+			if !reflect.DeepEqual(commands, expected) {
+				t.Fatalf("%d failures: bad: %#v", failures, commands)
+			}
+			if rs == nil || rs.Primary == nil || len(rs.Tainted) != 0 {
+				t.Fatalf("%d failures: bad: %#v", failures, rs)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), "failed after 3 attempts: connection refused") {
+			t.Fatalf("%d failures: bad: %v", failures, err)
+		}
+
+		expected := []string{"retried", "retried", "retried"}
+		if !reflect.DeepEqual(commands, expected) {
+			t.Fatalf("%d failures: bad: %#v", failures, commands)
+		}
+		if rs == nil || rs.Primary != nil || len(rs.Tainted) != 1 {
+			t.Fatalf("%d failures: bad: %#v", failures, rs)
+		}
+	}
+}
+
+func TestContext2Apply_provisionerFail_teardown(t *testing.T) {
+	m := testModule(t, "apply-provisioner-teardown")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var commands []string
+	pr.ApplyFn = func(s *InstanceState, c *ResourceConfig) error {
+		command := c.Config["command"].(string)
+		commands = append(commands, command)
+
+		// The failed teardown must not hide the error of the provisioner
+		switch command {
+		case "four":
+			return fmt.Errorf("EXPLOSION")
+		case "undo-two":
+			return fmt.Errorf("TEARDOWN")
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "EXPLOSION") {
+		t.Fatalf("bad: %v", err)
+	}
+	if strings.Contains(err.Error(), "TEARDOWN") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	expected := []string{"one", "two", "three", "four", "undo-two", "undo-one"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("bad: %#v", commands)
+	}
+
+	rs := state.RootModule().Resources["aws_instance.bar"]
+	if rs == nil || rs.Primary != nil || len(rs.Tainted) != 1 {
+		t.Fatalf("bad: %#v", rs)
+	}
+}
+
+func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-create-before")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
+		return fmt.Errorf("EXPLOSION")
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "abc",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateBeforeDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_error_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-error-create-before")
+	p := testProvider("aws")
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "abc",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
+		return nil, fmt.Errorf("error")
+	}
+	p.DiffFn = testDiffFn
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyErrorCreateBeforeDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s\n\nExpected:\n\n%s", actual, expected)
+	}
+}
+
+func TestContext2Apply_errorDestroy_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-error-create-before")
+	p := testProvider("aws")
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "abc",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
+		// Fail the destroy!
+		if id.Destroy {
+			return is, fmt.Errorf("error")
+		}
+
+		// Create should work
+		is = &InstanceState{
+			ID: "foo",
+		}
+		return is, nil
+	}
+	p.DiffFn = testDiffFn
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyErrorDestroyCreateBeforeDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: actual:\n%s\n\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestContext2Apply_multiDepose_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-multi-depose-create-before-destroy")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ps := map[string]ResourceProviderFactory{"aws": testProviderFuncFixed(p)}
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.web": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: ps,
+		State:     state,
+	})
+	createdInstanceId := "bar"
+	// Create works
+	createFunc := func(is *InstanceState) (*InstanceState, error) {
+		return &InstanceState{ID: createdInstanceId}, nil
+	}
+	// Destroy starts broken
+	destroyFunc := func(is *InstanceState) (*InstanceState, error) {
+		return is, fmt.Errorf("destroy failed")
+	}
+	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
+		if id.Destroy {
+			return destroyFunc(is)
+		} else {
+			return createFunc(is)
+		}
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Destroy is broken, so even though CBD successfully replaces the instance,
+	// we'll have to save the Deposed instance to destroy later
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	checkStateString(t, state, `
+aws_instance.web: (1 deposed)
+  ID = bar
+  Deposed ID 1 = foo
+	`)
+
+	createdInstanceId = "baz"
+	ctx = testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: ps,
+		State:     state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// We're replacing the primary instance once again. Destroy is _still_
+	// broken, so the Deposed list gets longer
+	state, err = ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	checkStateString(t, state, `
+aws_instance.web: (2 deposed)
+  ID = baz
+  Deposed ID 1 = foo
+  Deposed ID 2 = bar
+	`)
+
+	// Destroy partially fixed!
+	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
+		if is.ID == "foo" || is.ID == "baz" {
+			return nil, nil
+		} else {
+			return is, fmt.Errorf("destroy partially failed")
+		}
+	}
+
+	createdInstanceId = "qux"
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err = ctx.Apply()
+	// Expect error because 1/2 of Deposed destroys failed
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	// foo and baz are now gone, bar sticks around
+	checkStateString(t, state, `
+aws_instance.web: (1 deposed)
+  ID = qux
+  Deposed ID 1 = bar
+	`)
+
+	// Destroy working fully!
+	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
+		return nil, nil
+	}
+
+	createdInstanceId = "quux"
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatal("should not have error:", err)
+	}
+
+	// And finally the state is clean
+	checkStateString(t, state, `
+aws_instance.web:
+  ID = quux
+	`)
+}
+
+func TestContext2Apply_provisionerResourceRef(t *testing.T) {
+	m := testModule(t, "apply-provisioner-resource-ref")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok || val != "2" {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerResourceRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+}
+
+func TestContext2Apply_provisionerSelfRef(t *testing.T) {
+	m := testModule(t, "apply-provisioner-self-ref")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["command"]
+		if !ok || val != "bar" {
+			t.Fatalf("bad value for command: %v %#v", val, c)
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerSelfRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+}
+
+func TestContext2Apply_provisionerSelfRefComputed(t *testing.T) {
+	m := testModule(t, "apply-provisioner-self-ref-computed")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		result, err := testApplyFn(info, s, d)
+		if err != nil {
+			return nil, err
+		}
+
+		// The IP is only known once the instance exists
+		result.Attributes["private_ip"] = "10.0.0.1"
+		return result, nil
+	}
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["command"]
+		if !ok || val != "10.0.0.1" {
+			t.Fatalf("bad value for command: %v %#v", val, c)
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+}
+
+func TestContext2Apply_provisionerMultiSelfRef(t *testing.T) {
+	var lock sync.Mutex
+	commands := make([]string, 0, 5)
+
+	m := testModule(t, "apply-provisioner-multi-self-ref")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		val, ok := c.Config["command"]
+		if !ok {
+			t.Fatalf("bad value for command: %v %#v", val, c)
+		}
+
+		commands = append(commands, val.(string))
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerMultiSelfRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+
+	// Verify our result
+	sort.Strings(commands)
+	expectedCommands := []string{"number 0", "number 1", "number 2"}
+	if !reflect.DeepEqual(commands, expectedCommands) {
+		t.Fatalf("bad: %#v", commands)
+	}
+}
+
+// Provisioner should NOT run on a diff, only create
+func TestContext2Apply_Provisioner_Diff(t *testing.T) {
+	m := testModule(t, "apply-provisioner-diff")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		return nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerDiffStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+	pr.ApplyCalled = false
+
+	// Change the state to force a diff
+	mod := state.RootModule()
+	mod.Resources["aws_instance.bar"].Primary.Attributes["foo"] = "baz"
+
+	// Re-create context with state
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state2, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual = strings.TrimSpace(state2.String())
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was NOT invoked
+	if pr.ApplyCalled {
+		t.Fatalf("provisioner invoked")
+	}
+}
+
+func TestContext2Apply_outputDiffVars(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.baz": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		for k, ad := range d.Attributes {
+			if ad.NewComputed {
+				return nil, fmt.Errorf("%s: computed", k)
+			}
+		}
+
+		result := s.MergeDiff(d)
+		result.ID = "foo"
+		return result, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"foo": &ResourceAttrDiff{
+					NewComputed: true,
+					Type:        DiffAttrOutput,
+				},
+				"bar": &ResourceAttrDiff{
+					New: "baz",
+				},
+			},
+		}, nil
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Apply_Provisioner_ConnInfo(t *testing.T) {
+	m := testModule(t, "apply-provisioner-conninfo")
+	p := testProvider("aws")
+	pr := testProvisioner()
+
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if s.Ephemeral.ConnInfo == nil {
+			t.Fatalf("ConnInfo not initialized")
+		}
+
+		result, _ := testApplyFn(info, s, d)
+		result.Ephemeral.ConnInfo = map[string]string{
+			"type": "ssh",
+			"host": "127.0.0.1",
+			"port": "22",
+		}
+		return result, nil
+	}
+	p.DiffFn = testDiffFn
+
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		conn := rs.Ephemeral.ConnInfo
+		if conn["type"] != "telnet" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["host"] != "127.0.0.1" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["port"] != "2222" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["user"] != "superuser" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["pass"] != "test" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]string{
+			"value": "1",
+			"pass":  "test",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+}
+
+func TestContext2Apply_destroy(t *testing.T) {
+	m := testModule(t, "apply-destroy")
+	h := new(HookRecordApplyOrder)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	// First plan and apply a create operation
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Next, plan and apply a destroy operation
+	h.Active = true
+	ctx = testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   state,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Test that things were destroyed _in the right order_
+	expected2 := []string{"aws_instance.bar", "aws_instance.foo"}
+	actual2 := h.IDs
+	if !reflect.DeepEqual(actual2, expected2) {
+		t.Fatalf("expected: %#v\n\ngot:%#v", expected2, actual2)
+	}
+}
+
+func TestContext2Apply_destroyReverse(t *testing.T) {
+	m := testModule(t, "apply-destroy-reverse")
+	h := new(HookRecordApplyOrder)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	h.Active = true
+	ctx = testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   state,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(state.RootModule().Resources) != 0 {
+		t.Fatalf("bad: %s", state)
+	}
+
+	// The highest index is destroyed first
+	expected := []string{
+		"aws_instance.foo.4",
+		"aws_instance.foo.3",
+		"aws_instance.foo.2",
+		"aws_instance.foo.1",
+		"aws_instance.foo.0",
+	}
+	if !reflect.DeepEqual(h.IDs, expected) {
+		t.Fatalf("expected: %#v\n\ngot:%#v", expected, h.IDs)
+	}
+}
+
+func TestContext2Apply_destroyPreDestroyHook(t *testing.T) {
+	m := testModule(t, "apply-destroy")
+	h := new(MockHook)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "i-foo",
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   s,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !h.PreDestroyCalled {
+		t.Fatal("should call PreDestroy")
+	}
+	if h.PreDestroyInfo.Id != "aws_instance.foo" {
+		t.Fatalf("bad: %#v", h.PreDestroyInfo)
+	}
+	if h.PreDestroyState == nil || h.PreDestroyState.ID != "i-foo" {
+		t.Fatalf("bad: %#v", h.PreDestroyState)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	if actual != "<no state>" {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_destroyPreDestroyHookHalt(t *testing.T) {
+	m := testModule(t, "apply-destroy")
+	h := &MockHook{PreDestroyReturn: HookActionHalt}
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "i-foo",
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   s,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.ApplyCalled {
+		t.Fatal("should not destroy")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.foo:
+  ID = i-foo
+	`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_destroyNestedModule(t *testing.T) {
+	m := testModule(t, "apply-destroy-nested-module")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "child", "subchild"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	// First plan and apply a create operation
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyDestroyNestedModuleStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
+	m := testModule(t, "apply-destroy-deeply-nested-module")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "child", "subchild", "subsubchild"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	// First plan and apply a create operation
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+module.child.subchild.subsubchild:
+  <no state>
+	`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_destroyOutputs(t *testing.T) {
+	m := testModule(t, "apply-destroy-outputs")
+	h := new(HookRecordApplyOrder)
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	// First plan and apply a create operation
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Next, plan and apply a destroy operation
+	h.Active = true
+	ctx = testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   state,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mod := state.RootModule()
+	if len(mod.Resources) > 0 {
+		t.Fatalf("bad: %#v", mod)
+	}
+}
+
+func TestContext2Apply_ignoreChanges(t *testing.T) {
+	m := testModule(t, "apply-ignore-changes")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"id":          "foo",
+								"require_new": "no",
+							},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"id":          "bar",
+								"foo":         "old",
+								"require_new": "no",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.Diff.String())
+	expected := strings.TrimSpace(`
+UPDATE: aws_instance.bar
+  foo:  "" => "new"
+  type: "" => "aws_instance"
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only aws_instance.bar is applied, and it is updated, not replaced
+	if p.ApplyInfo == nil || p.ApplyInfo.Id != "aws_instance.bar" {
+		t.Fatalf("bad: %#v", p.ApplyInfo)
+	}
+	if p.ApplyDiff.RequiresNew() {
+		t.Fatalf("bad: %#v", p.ApplyDiff)
+	}
+
+	// The test provider sets the ID of every instance it applies to foo
+	actual = strings.TrimSpace(state.String())
+	expected = strings.TrimSpace(`
+aws_instance.bar:
+  ID = foo
+  foo = new
+  require_new = no
+  type = aws_instance
+aws_instance.foo:
+  ID = foo
+  require_new = no
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Apply_ignoreChangesWildcard(t *testing.T) {
+	m := testModule(t, "apply-ignore-changes-wildcard")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"id":          "foo",
+								"foo":         "old",
+								"require_new": "no",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The existing resource is neither updated nor replaced, but the new
+	// one is still created
+	actual := strings.TrimSpace(plan.Diff.String())
+	expected := strings.TrimSpace(`
+CREATE: aws_instance.bar
+  foo:  "" => "new"
+  type: "" => "aws_instance"
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual = strings.TrimSpace(state.String())
+	expected = strings.TrimSpace(`
+aws_instance.bar:
+  ID = foo
+  foo = new
+  type = aws_instance
+aws_instance.foo:
+  ID = foo
+  foo = old
+  require_new = no
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Apply_preventDestroy(t *testing.T) {
+	// The diffs are planned before prevent_destroy is set, so only the
+	// apply can catch them.
+	for _, destroy := range []bool{true, false} {
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "i-abc123",
+								Attributes: map[string]string{
+									"require_new": "no",
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: testModule(t, "apply-prevent-destroy-plan"),
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State:   state,
+			Destroy: destroy,
+		})
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		ctx = testContext2(t, &ContextOpts{
+			Module: testModule(t, "apply-prevent-destroy"),
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State:   state,
+			Diff:    plan.Diff,
+			Destroy: destroy,
+		})
+
+		_, err = ctx.Apply()
+		expectedErr := "aws_instance.foo: the plan would destroy"
+		if !destroy {
+			expectedErr = "aws_instance.foo: the plan would replace this " +
+				"resource, since a change to require_new forces a new resource"
+		}
+		if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
+			t.Fatalf("destroy %t: expected err would contain %q\nerr: %s",
+				destroy, expectedErr, err)
+		}
+		if p.ApplyCalled {
+			t.Fatalf("destroy %t: apply shouldn't be called", destroy)
+		}
+	}
+}
+
+func TestContext2Apply_preventDestroyCreateBeforeDestroy(t *testing.T) {
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "i-abc123",
+							Attributes: map[string]string{
+								"require_new": "no",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: testModule(t, "apply-prevent-destroy-plan"),
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The new instance would be created before the replaced one is
+	// destroyed, so the replacement must be blocked before that.
+	ctx = testContext2(t, &ContextOpts{
+		Module: testModule(t, "apply-prevent-destroy-cbd"),
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+		Diff:  plan.Diff,
+	})
+
+	state, err = ctx.Apply()
+	expectedErr := "aws_instance.foo: the plan would replace this resource"
+	if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
+		t.Fatalf("expected err would contain %q\nerr: %s", expectedErr, err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply shouldn't be called")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.foo:
+  ID = i-abc123
+  require_new = no
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Apply_destroyTaintedDependent(t *testing.T) {
+	m := testModule(t, "apply-destroy-tainted-dep-replace")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var order []string
+	var l sync.Mutex
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		// Give the destroy of the dependency a chance to run first
+		if info.Id == "aws_instance.web" && id.Destroy {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		l.Lock()
+		defer l.Unlock()
+		op := "create"
+		if id.Destroy {
+			op = "destroy"
+		}
+		order = append(order, op+" "+info.Id)
+
+		return testApplyFn(info, is, id)
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.sg": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "sg",
+							Attributes: map[string]string{
+								"require_new": "old",
+							},
+						},
+					},
+					"aws_instance.web": &ResourceState{
+						Type:         "aws_instance",
+						Dependencies: []string{"aws_instance.sg"},
+						Tainted: []*InstanceState{
+							&InstanceState{
+								ID: "web",
+								Attributes: map[string]string{
+									"require_new": "new",
+									"foo":         "sg",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The tainted instance that uses the replaced resource is destroyed
+	// before it is.
+	expected := []string{
+		"destroy aws_instance.web",
+		"destroy aws_instance.sg",
+		"create aws_instance.sg",
+		"create aws_instance.web",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
+	}
+}
+
+func TestContext2Apply_destroyOrphan(t *testing.T) {
+	m := testModule(t, "apply-error")
+	p := testProvider("aws")
+	s := &State{
+		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
@@ -2001,102 +5426,547 @@ func TestContext2Apply_outputDiffVars(t *testing.T) {
 					},
 				},
 			},
-		},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if d.Destroy {
+			return nil, nil
+		}
+
+		result := s.MergeDiff(d)
+		result.ID = "foo"
+		return result, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
+				},
+			},
+		}, nil
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mod := state.RootModule()
+	if _, ok := mod.Resources["aws_instance.baz"]; ok {
+		t.Fatalf("bad: %#v", mod.Resources)
+	}
+}
+
+func TestContext2Apply_destroyTaintedProvisioner(t *testing.T) {
+	m := testModule(t, "apply-destroy-provisioner")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	called := false
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		called = true
+		return nil
+	}
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Tainted: []*InstanceState{
+							&InstanceState{
+								ID: "bar",
+								Attributes: map[string]string{
+									"id": "bar",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State:   s,
+		Destroy: true,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if called {
+		t.Fatal("provisioner should not be called")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace("<no state>")
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_canaryFail(t *testing.T) {
+	m := testModule(t, "apply-canary-fail")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	var lock sync.Mutex
+	var applied []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		applied = append(applied, info.Id)
+		return nil, fmt.Errorf("unhealthy")
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if len(applied) != 1 || applied[0] != "aws_instance.foo.1" {
+		t.Fatalf("bad: %#v", applied)
+	}
+}
+
+func TestContext2Apply_canaryVerifyFail(t *testing.T) {
+	m := testModule(t, "apply-canary-fail")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	h := new(MockHook)
+	h.VerifyCanaryError = fmt.Errorf("unhealthy")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	var lock sync.Mutex
+	var applied []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		applied = append(applied, info.Id)
+		return testApplyFn(info, s, d)
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The canary is applied, but fails verification, so the rest of the
+	// instances are left untouched
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if !strings.Contains(err.Error(), "canary failed verification") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	if len(applied) != 1 || applied[0] != "aws_instance.foo.1" {
+		t.Fatalf("bad: %#v", applied)
+	}
+	if !h.VerifyCanaryCalled || h.VerifyCanaryInfo.Id != "aws_instance.foo.1" {
+		t.Fatalf("bad: %#v", h)
+	}
+	if h.VerifyCanaryState == nil || h.VerifyCanaryState.ID != "foo" {
+		t.Fatalf("bad: %#v", h.VerifyCanaryState)
+	}
+
+	rs := state.RootModule().Resources
+	if len(rs) != 1 || rs["aws_instance.foo.1"] == nil {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+func TestContext2Apply_canaryReplaceFail(t *testing.T) {
+	m := testModule(t, "apply-canary-replace")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var applied []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if d.Destroy {
+			applied = append(applied, "destroy "+info.Id)
+			return nil, nil
+		}
+
+		applied = append(applied, "create "+info.Id)
+		return nil, fmt.Errorf("unhealthy")
+	}
+
+	resources := make(map[string]*ResourceState)
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("i-%d", i)
+		resources[fmt.Sprintf("aws_instance.foo.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: id,
+				Attributes: map[string]string{
+					"id":          id,
+					"require_new": "no",
+				},
+			},
+		}
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: resources,
+				},
+			},
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := strings.Count(plan.Diff.String(), "DESTROY/CREATE"); n != 3 {
+		t.Fatalf("should replace all of them:\n%s", plan.Diff)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	// Only the canary is replaced, the rest are kept when it fails
+	expected := []string{
+		"destroy aws_instance.foo.0",
+		"create aws_instance.foo.0",
+	}
+	if !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("bad: %#v", applied)
+	}
+	for i := 1; i < 3; i++ {
+		rs := state.RootModule().Resources[fmt.Sprintf("aws_instance.foo.%d", i)]
+		if rs == nil || rs.Primary == nil || rs.Primary.ID != fmt.Sprintf("i-%d", i) {
+			t.Fatalf("%d: should be kept: %s", i, state)
+		}
+	}
+}
+
+func TestContext2Apply_canaryReplace(t *testing.T) {
+	m := testModule(t, "apply-canary-replace")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var order []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		op := "create "
+		if d.Destroy {
+			op = "destroy "
+		}
+		order = append(order, op+info.Id)
+
+		return testApplyFn(info, s, d)
+	}
+
+	resources := make(map[string]*ResourceState)
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("i-%d", i)
+		resources[fmt.Sprintf("aws_instance.foo.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: id,
+				Attributes: map[string]string{
+					"id":          id,
+					"require_new": "no",
+				},
+			},
+		}
 	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: resources,
+				},
+			},
+		},
 	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		for k, ad := range d.Attributes {
-			if ad.NewComputed {
-				return nil, fmt.Errorf("%s: computed", k)
-			}
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		result := s.MergeDiff(d)
-		result.ID = "foo"
-		return result, nil
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"foo": &ResourceAttrDiff{
-					NewComputed: true,
-					Type:        DiffAttrOutput,
-				},
-				"bar": &ResourceAttrDiff{
-					New: "baz",
-				},
-			},
-		}, nil
+
+	// Each instance is destroyed only once, the others after the canary
+	// is created
+	if len(order) != 6 || order[0] != "destroy aws_instance.foo.0" ||
+		order[1] != "create aws_instance.foo.0" {
+		t.Fatalf("bad: %#v", order)
+	}
+	for i := 0; i < 3; i++ {
+		rs := state.RootModule().Resources[fmt.Sprintf("aws_instance.foo.%d", i)]
+		if rs == nil || rs.Primary == nil || rs.Primary.Attributes["require_new"] != "yes" {
+			t.Fatalf("%d: should be replaced: %s", i, state)
+		}
+	}
+}
+
+func TestContext2Apply_failureThreshold(t *testing.T) {
+	m := testModule(t, "apply-failure-threshold")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Parallelism:      1,
+		FailureThreshold: 2,
+	})
+
+	var lock sync.Mutex
+	applied := 0
+	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		applied++
+		return nil, fmt.Errorf("error")
 	}
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	if _, err := ctx.Apply(); err != nil {
-		t.Fatalf("err: %s", err)
+
+	_, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if !strings.Contains(err.Error(), "failure threshold is 2") {
+		t.Fatalf("bad: %s", err)
+	}
+	if applied != 2 {
+		t.Fatalf("bad: %d", applied)
 	}
 }
 
-func TestContext2Apply_Provisioner_ConnInfo(t *testing.T) {
-	m := testModule(t, "apply-provisioner-conninfo")
+func TestContext2Apply_errorClassTransient(t *testing.T) {
+	defer func(old time.Duration) { applyRetryDelay = old }(applyRetryDelay)
+	applyRetryDelay = 0
+
+	m := testModule(t, "apply-failure-threshold")
 	p := testProvider("aws")
-	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		if s.Ephemeral.ConnInfo == nil {
-			t.Fatalf("ConnInfo not initialized")
+	// Every instance fails twice before it is applied, and bar.1 never is
+	var lock sync.Mutex
+	tries := make(map[string]int)
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		tries[info.Id]++
+		n := tries[info.Id]
+		lock.Unlock()
+
+		if n <= 2 || info.Id == "aws_instance.bar.1" {
+			return nil, &ApplyError{
+				Class: ApplyErrorTransient,
+				Err:   fmt.Errorf("rate limited"),
+			}
 		}
 
-		result, _ := testApplyFn(info, s, d)
-		result.Ephemeral.ConnInfo = map[string]string{
-			"type": "ssh",
-			"host": "127.0.0.1",
-			"port": "22",
+		return testApplyFn(info, s, d)
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("bad: %s", err)
+	}
+	if len(state.RootModule().Resources) != 5 {
+		t.Fatalf("bad:\n%s", state)
+	}
+	for k, n := range tries {
+		expected := 3
+		if k == "aws_instance.bar.1" {
+			expected = 1 + applyTransientRetries
+		}
+		if n != expected {
+			t.Fatalf("bad: %#v", tries)
 		}
-		return result, nil
 	}
+}
+
+func TestContext2Apply_errorClassConfig(t *testing.T) {
+	m := testModule(t, "apply-failure-threshold")
+	p := testProvider("aws")
 	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Parallelism: 1,
+	})
 
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		conn := rs.Ephemeral.ConnInfo
-		if conn["type"] != "telnet" {
-			t.Fatalf("Bad: %#v", conn)
-		}
-		if conn["host"] != "127.0.0.1" {
-			t.Fatalf("Bad: %#v", conn)
+	var lock sync.Mutex
+	applied := 0
+	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		applied++
+		return nil, &ApplyError{Class: ApplyErrorConfig, Err: fmt.Errorf("bad ami")}
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The first config error stops the apply, without retrying it
+	_, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if !strings.Contains(err.Error(), "Stopped after a configuration error") {
+		t.Fatalf("bad: %s", err)
+	}
+	if applied != 1 {
+		t.Fatalf("bad: %d", applied)
+	}
+}
+
+func TestContext2Apply_errorClassOther(t *testing.T) {
+	classes := []ApplyErrorClass{ApplyErrorUnclassified, ApplyErrorInternal}
+	for _, class := range classes {
+		m := testModule(t, "apply-failure-threshold")
+		p := testProvider("aws")
+		p.DiffFn = testDiffFn
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Parallelism: 1,
+		})
+
+		var lock sync.Mutex
+		applied := 0
+		p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			applied++
+			return nil, &ApplyError{Class: class, Err: fmt.Errorf("error")}
 		}
-		if conn["port"] != "2222" {
-			t.Fatalf("Bad: %#v", conn)
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", class, err)
 		}
-		if conn["user"] != "superuser" {
-			t.Fatalf("Bad: %#v", conn)
+
+		// The errors are neither retried nor stop the other resources
+		if _, err := ctx.Apply(); err == nil {
+			t.Fatalf("%s: should have error", class)
 		}
-		if conn["pass"] != "test" {
-			t.Fatalf("Bad: %#v", conn)
+		if applied != 6 {
+			t.Fatalf("%s: bad: %d", class, applied)
 		}
-
-		return nil
 	}
+}
 
+func TestContext2Apply_orphanDeposed(t *testing.T) {
+	m := testModule(t, "plan-orphan")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.baz": &ResourceState{
+						Type: "aws_instance",
+						Deposed: []*InstanceState{
+							&InstanceState{ID: "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		Variables: map[string]string{
-			"value": "1",
-			"pass":  "test",
-		},
+		State: s,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -2109,32 +5979,32 @@ func TestContext2Apply_Provisioner_ConnInfo(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
+	expected := strings.TrimSpace(`
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+`)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Apply_destroy(t *testing.T) {
-	m := testModule(t, "apply-destroy")
-	h := new(HookRecordApplyOrder)
+func TestContext2Apply_pending(t *testing.T) {
+	m := testModule(t, "apply-good")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	h := new(testPendingHook)
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		StateUpdateInterval: -1,
 	})
 
-	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -2144,121 +6014,195 @@ func TestContext2Apply_destroy(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Next, plan and apply a destroy operation
-	h.Active = true
-	ctx = testContext2(t, &ContextOpts{
-		Destroy: true,
-		State:   state,
-		Module:  m,
-		Hooks:   []Hook{h},
+	if !h.Pending {
+		t.Fatal("resources should be pending during apply")
+	}
+	if state.HasPending() {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+// testPendingHook records whether any state update had a pending resource.
+type testPendingHook struct {
+	NilHook
+
+	sync.Mutex
+	Pending bool
+}
+
+func (h *testPendingHook) PostStateUpdate(s *State) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	if s.HasPending() {
+		h.Pending = true
+	}
+
+	return HookActionContinue, nil
+}
+
+func TestContext2Apply_policyDenied(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	policy := &MockPolicy{
+		CheckFn: func(info *InstanceInfo, d *InstanceDiff) (*PolicyDecision, error) {
+			if info.Id == "aws_instance.bar" {
+				return &PolicyDecision{Reason: "bar is frozen"}, nil
+			}
+
+			return &PolicyDecision{Allowed: true}, nil
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Policy: policy,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err = ctx.Apply()
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "bar is frozen") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Apply_planChecksum(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
-	// Test that things were destroyed
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyDestroyStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if plan.Checksum == "" {
+		t.Fatal("plan should have a checksum")
 	}
 
-	// Test that things were destroyed _in the right order_
-	expected2 := []string{"aws_instance.bar", "aws_instance.foo"}
-	actual2 := h.IDs
-	if !reflect.DeepEqual(actual2, expected2) {
-		t.Fatalf("expected: %#v\n\ngot:%#v", expected2, actual2)
+	// Change the diff after it was planned
+	plan.Diff.RootModule().Resources["aws_instance.foo"].Attributes["num"].New = "3"
+
+	ctx = plan.Context(&ContextOpts{
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
+	}
+	if p.ApplyCalled {
+		t.Fatal("nothing should be applied")
 	}
 }
 
-func TestContext2Apply_destroyNestedModule(t *testing.T) {
-	m := testModule(t, "apply-destroy-nested-module")
+func TestContext2Apply_rollbackPlan(t *testing.T) {
+	m := testModule(t, "apply-good")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if info.Id == "aws_instance.bar" {
+			return nil, fmt.Errorf("error")
+		}
 
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: []string{"root", "child", "subchild"},
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
-			},
-		},
+		return testApplyFn(info, s, d)
 	}
-
+	h := new(MockHook)
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
 	})
 
-	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
 	}
 
-	// Test that things were destroyed
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyDestroyNestedModuleStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if !h.PostRollbackPlanCalled {
+		t.Fatal("should be called")
+	}
+	expected := &RollbackPlan{
+		Steps: []*RollbackStep{
+			&RollbackStep{
+				Action:  RollbackDestroy,
+				Address: "aws_instance.foo",
+				Type:    "aws_instance",
+				ID:      "foo",
+			},
+		},
+	}
+	if !reflect.DeepEqual(h.PostRollbackPlanPlan, expected) {
+		t.Fatalf("bad: %s", h.PostRollbackPlanPlan)
 	}
 }
 
-func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
-	m := testModule(t, "apply-destroy-deeply-nested-module")
+func TestContext2Apply_taintErrorPattern(t *testing.T) {
+	m := testModule(t, "apply-good")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: []string{"root", "child", "subchild", "subsubchild"},
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
-			},
-		},
-	}
+	var l sync.Mutex
+	var broken bool
+	var destroyed []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+
+		if d.Destroy {
+			destroyed = append(destroyed, s.ID)
+			return nil, nil
+		}
+		if info.Id == "aws_instance.foo" && !broken {
+			broken = true
+			return &InstanceState{ID: "broken"},
+				fmt.Errorf("instance is in terminated state")
+		}
 
+		return testApplyFn(info, s, d)
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
+		TaintErrorPatterns: []*regexp.Regexp{
+			regexp.MustCompile("terminated state"),
+		},
 	})
 
-	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -2268,81 +6212,129 @@ func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Test that things were destroyed
+	if !reflect.DeepEqual(destroyed, []string{"broken"}) {
+		t.Fatalf("bad: %#v", destroyed)
+	}
+
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-module.child.subchild.subsubchild:
-  <no state>
-	`)
+	expected := strings.TrimSpace(testTerraformApplyStr)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Apply_destroyOutputs(t *testing.T) {
-	m := testModule(t, "apply-destroy-outputs")
-	h := new(HookRecordApplyOrder)
+// With create before destroy, the broken instance is destroyed in the same
+// apply, even though there is nothing else to destroy.
+func TestContext2Apply_taintErrorPatternCreateBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-good-create-before")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	var broken bool
+	var destroyed []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+
+		if d.Destroy {
+			destroyed = append(destroyed, s.ID)
+			return nil, nil
+		}
+		if !broken {
+			broken = true
+			return &InstanceState{ID: "broken"},
+				fmt.Errorf("instance is in terminated state")
+		}
+
+		return testApplyFn(info, s, d)
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
-		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		TaintErrorPatterns: []*regexp.Regexp{
+			regexp.MustCompile("terminated state"),
+		},
 	})
 
-	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	state, err := ctx.Apply()
-
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Next, plan and apply a destroy operation
-	h.Active = true
-	ctx = testContext2(t, &ContextOpts{
-		Destroy: true,
-		State:   state,
-		Module:  m,
-		Hooks:   []Hook{h},
+	if !reflect.DeepEqual(destroyed, []string{"broken"}) {
+		t.Fatalf("bad: %#v", destroyed)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCreateBeforeStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Apply_taintErrorPatternNoMatch(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if info.Id == "aws_instance.foo" {
+			return nil, fmt.Errorf("invalid ami")
+		}
+
+		return testApplyFn(info, s, d)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		TaintErrorPatterns: []*regexp.Regexp{
+			regexp.MustCompile("terminated state"),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err = ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
-
-	mod := state.RootModule()
-	if len(mod.Resources) > 0 {
-		t.Fatalf("bad: %#v", mod)
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
 	}
 }
 
-func TestContext2Apply_destroyOrphan(t *testing.T) {
-	m := testModule(t, "apply-error")
+func TestContext2Apply_replaceTriggeredBy(t *testing.T) {
+	m := testModule(t, "plan-replace-triggered-by")
 	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.baz": &ResourceState{
+					"aws_ami.web": &ResourceState{
+						Type: "aws_ami",
+						Primary: &InstanceState{
+							ID: "ami-1",
+							Attributes: map[string]string{
+								"foo": "old",
+							},
+						},
+					},
+					"aws_instance.web": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "i-1",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
 						},
 					},
 				},
@@ -2357,25 +6349,6 @@ func TestContext2Apply_destroyOrphan(t *testing.T) {
 		State: s,
 	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		if d.Destroy {
-			return nil, nil
-		}
-
-		result := s.MergeDiff(d)
-		result.ID = "foo"
-		return result, nil
-	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"num": &ResourceAttrDiff{
-					New: "bar",
-				},
-			},
-		}, nil
-	}
-
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -2385,75 +6358,96 @@ func TestContext2Apply_destroyOrphan(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	mod := state.RootModule()
-	if _, ok := mod.Resources["aws_instance.baz"]; ok {
-		t.Fatalf("bad: %#v", mod.Resources)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_ami.web:
+  ID = foo
+  foo = new
+  type = aws_ami
+aws_instance.web:
+  ID = foo
+  foo = bar
+  type = aws_instance
+
+  Dependencies:
+    aws_ami.web
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Apply_destroyTaintedProvisioner(t *testing.T) {
-	m := testModule(t, "apply-destroy-provisioner")
+func TestContext2Apply_timestamp(t *testing.T) {
+	m := testModule(t, "apply-timestamp")
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-
-	called := false
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		called = true
-		return nil
-	}
-
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Tainted: []*InstanceState{
-							&InstanceState{
-								ID: "bar",
-								Attributes: map[string]string{
-									"id": "bar",
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		State:   s,
-		Destroy: true,
 	})
 
-	if _, err := ctx.Plan(); err != nil {
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := ctx.Timestamp().Format(time.RFC3339)
+	for _, k := range []string{"aws_instance.foo", "aws_instance.bar"} {
+		rs := state.RootModule().Resources[k]
+		if actual := rs.Primary.Attributes["value"]; actual != expected {
+			t.Fatalf("%s: bad: %s, expected %s", k, actual, expected)
+		}
+	}
+}
+
+func TestContext2Apply_timestampSavedPlan(t *testing.T) {
+	m := testModule(t, "apply-timestamp")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	providers := map[string]ResourceProviderFactory{
+		"aws": testProviderFuncFixed(p),
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: providers,
+		Timestamp: time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
+	var buf bytes.Buffer
+	if err := WritePlan(plan, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	plan, err = ReadPlan(&buf)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if called {
-		t.Fatal("provisioner should not be called")
+	// Applying the saved plan interpolates the timestamp of the plan
+	ctx = plan.Context(&ContextOpts{Providers: providers})
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace("<no state>")
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	expected := "2015-01-01T12:00:00Z"
+	for _, k := range []string{"aws_instance.foo", "aws_instance.bar"} {
+		rs := state.RootModule().Resources[k]
+		if actual := rs.Primary.Attributes["value"]; actual != expected {
+			t.Fatalf("%s: bad: %s, expected %s", k, actual, expected)
+		}
 	}
 }
 
@@ -2511,6 +6505,63 @@ func TestContext2Apply_error(t *testing.T) {
 	}
 }
 
+func TestContext2Apply_errorPartialUpdate(t *testing.T) {
+	m := testModule(t, "apply-error-partial-update")
+	p := testProvider("aws")
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"num":  "2",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	// The update fails part way, returning only what it changed
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		return &InstanceState{
+			ID:         "foo",
+			Attributes: map[string]string{"num": "3"},
+		}, fmt.Errorf("error")
+	}
+	p.DiffFn = testDiffFn
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	// The attributes from before the apply are kept
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  num = 3
+  type = aws_instance
+	`)
+}
+
 func TestContext2Apply_errorPartial(t *testing.T) {
 	errored := false
 
@@ -2667,6 +6718,62 @@ func TestContext2Apply_hookOrphan(t *testing.T) {
 	}
 }
 
+func TestContext2Apply_hookPreApplyHalt(t *testing.T) {
+	m := testModule(t, "apply-blank")
+	h := new(MockHook)
+	h.PreApplyReturn = HookActionHalt
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !h.PreApplyCalled {
+		t.Fatal("should be called")
+	}
+	if p.ApplyCalled {
+		t.Fatal("shouldn't apply")
+	}
+
+	// The halted destroy leaves the resource as it was
+	checkStateString(t, state, `
+aws_instance.bar:
+  ID = bar
+`)
+}
+
 func TestContext2Apply_idAttr(t *testing.T) {
 	m := testModule(t, "apply-idattr")
 	p := testProvider("aws")
@@ -3141,6 +7248,105 @@ aws_instance.foo.1:
 	`)
 }
 
+func TestContext2Apply_targetedCountIndexDep(t *testing.T) {
+	m := testModule(t, "apply-targeted-count-dep")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Targets: []string{"aws_instance.bar.2"},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The resource the target depends on is applied too
+	checkStateString(t, state, `
+aws_instance.bar.2:
+  ID = foo
+  foo = 2
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo
+aws_instance.foo.0:
+  ID = foo
+  num = 2
+  type = aws_instance
+aws_instance.foo.1:
+  ID = foo
+  num = 2
+  type = aws_instance
+	`)
+}
+
+func TestContext2Apply_targetedCountIndexWalk(t *testing.T) {
+	m := testModule(t, "apply-targeted-count-index")
+	p := testProvider("aws")
+
+	var lock sync.Mutex
+	diffed := make(map[string]struct{})
+	applied := make(map[string]struct{})
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		lock.Lock()
+		diffed[info.Id] = struct{}{}
+		lock.Unlock()
+
+		return testDiffFn(info, s, c)
+	}
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		lock.Lock()
+		applied[info.Id] = struct{}{}
+		lock.Unlock()
+
+		return testApplyFn(info, s, d)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Targets: []string{"aws_instance.web.2"},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the target and what it depends on are walked, not the other
+	// instances of web, nor db which depends on it, nor baz
+	expected := map[string]struct{}{
+		"aws_instance.foo.0": struct{}{},
+		"aws_instance.foo.1": struct{}{},
+		"aws_instance.web.2": struct{}{},
+	}
+	if !reflect.DeepEqual(diffed, expected) {
+		t.Fatalf("bad: %#v", diffed)
+	}
+	if !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("bad: %#v", applied)
+	}
+}
+
 func TestContext2Apply_targetedDestroy(t *testing.T) {
 	m := testModule(t, "apply-targeted")
 	p := testProvider("aws")
@@ -3652,3 +7858,97 @@ func TestContext2Apply_singleDestroy(t *testing.T) {
 		t.Fatalf("bad: %d", invokeCount)
 	}
 }
+
+func TestContext2Apply_prerequisiteChecks(t *testing.T) {
+	m := testModule(t, "apply-prerequisite-checks")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	check := &MockPrerequisiteCheck{
+		CheckReturn: &PrerequisiteCheckResult{Passed: true},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		PrerequisiteChecks: map[string]PrerequisiteCheck{
+			"dns": check,
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !check.CheckCalled {
+		t.Fatal("check should be called")
+	}
+	if check.CheckInfo.Id != "aws_instance.bar" {
+		t.Fatalf("bad: %#v", check.CheckInfo)
+	}
+	if v, ok := check.CheckConfig.Get("zone"); !ok || v != "example.com" {
+		t.Fatalf("bad: %#v", check.CheckConfig)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.bar:
+  ID = foo
+  type = aws_instance
+  zone = example.com
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Apply_prerequisiteChecksFailed(t *testing.T) {
+	m := testModule(t, "apply-prerequisite-checks")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	check := &MockPrerequisiteCheck{
+		CheckReturn: &PrerequisiteCheckResult{
+			Message: "example.com isn't delegated",
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		PrerequisiteChecks: map[string]PrerequisiteCheck{
+			"dns": check,
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "example.com isn't delegated") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// Nothing is applied, not even the resources without checks
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if actual := strings.TrimSpace(state.String()); actual != "<no state>" {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
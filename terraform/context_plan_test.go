@@ -38,6 +38,245 @@ func TestContext2Plan(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_dataSource(t *testing.T) {
+	m := testModule(t, "plan-data-source")
+	p := testDataSourceProviderFor(testProvider("aws"))
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !p.ReadDataSourceCalled {
+		t.Fatal("should read the data source")
+	}
+	if v, _ := p.ReadDataSourceConfig.Get("name"); v != "ubuntu" {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	// The data source is never diffed, and the resource sees what was read
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanDataSourceStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_dataSourceComputed(t *testing.T) {
+	m := testModule(t, "plan-data-source-computed")
+	p := testDataSourceProviderFor(testProvider("aws"))
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The name isn't known until aws_instance.foo is created
+	if p.ReadDataSourceCalled {
+		t.Fatal("shouldn't read the data source")
+	}
+}
+
+func TestContext2Plan_dataSourceComputedDependent(t *testing.T) {
+	m := testModule(t, "apply-data-source-computed")
+	p := testDataSourceProviderFor(testProvider("aws"))
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.ReadDataSourceCalled {
+		t.Fatal("shouldn't read the data source")
+	}
+
+	// What aws_instance.bar gets from the data source isn't known yet
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanDataSourceComputedStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2SpeculativePlan(t *testing.T) {
+	m := testModule(t, "plan-good")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	speculative, err := ctx.SpeculativePlan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ctx.diff != nil {
+		t.Fatalf("diff should not be changed: %#v", ctx.diff)
+	}
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(speculative.String())
+	expected := strings.TrimSpace(plan.String())
+	if actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestContext2BaselinePlan(t *testing.T) {
+	m := testModule(t, "plan-good")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"num":  "2",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	baseline := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "baz",
+							Attributes: map[string]string{
+								"num":  "2",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.baz": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "qux",
+						},
+					},
+				},
+			},
+		},
+	}
+	expectedState := s.String()
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.BaselinePlan(baseline)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.Diff.String())
+	expected := strings.TrimSpace(testTerraformPlanBaselineStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	// The context is left as it was
+	if ctx.diff != nil {
+		t.Fatalf("diff should not be changed: %#v", ctx.diff)
+	}
+	if ctx.state.String() != expectedState {
+		t.Fatalf("state should not be changed:\n%s", ctx.state)
+	}
+	if len(baseline.RootModule().Resources) != 2 {
+		t.Fatalf("baseline should not be changed:\n%s", baseline)
+	}
+}
+
+func TestContext2SpeculativePlan_destroy(t *testing.T) {
+	m := testModule(t, "plan-destroy")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.one": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+	expected := s.String()
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:   s,
+		Destroy: true,
+	})
+
+	plan, err := ctx.SpeculativePlan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if plan.State == s {
+		t.Fatal("plan should not share the state")
+	}
+	if len(plan.Diff.RootModule().Resources) != 1 {
+		t.Fatalf("bad: %s", plan)
+	}
+
+	if ctx.state != s || s.String() != expected {
+		t.Fatalf("state should not be changed:\n%s", s)
+	}
+	if ctx.diff != nil {
+		t.Fatalf("diff should not be changed: %#v", ctx.diff)
+	}
+}
+
 func TestContext2Plan_createBefore_maintainRoot(t *testing.T) {
 	m := testModule(t, "plan-cbd-maintain-root")
 	p := testProvider("aws")
@@ -150,6 +389,109 @@ func TestContext2Plan_modules(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_random(t *testing.T) {
+	m := testModule(t, "plan-random")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	plan := func() *Plan {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return plan
+	}
+
+	first := plan()
+	if actual := plan(); actual.String() != first.String() {
+		t.Fatalf("bad:\n%s\n\n%s", actual, first)
+	}
+
+	resources := first.Diff.RootModule().Resources
+	foo0 := resources["aws_instance.foo.0"].Attributes["foo"].New
+	foo1 := resources["aws_instance.foo.1"].Attributes["foo"].New
+	if foo0 == "" || foo0 == foo1 {
+		t.Fatalf("bad: %q %q", foo0, foo1)
+	}
+
+	// Without a count, the value is that of index zero, so it doesn't
+	// change when the count changes between one and more
+	ctx := testContext2(t, &ContextOpts{
+		Module: testModule(t, "plan-random-single"),
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	single, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	rd := single.Diff.RootModule().Resources["aws_instance.foo"]
+	if actual := rd.Attributes["foo"].New; actual != foo0 {
+		t.Fatalf("bad: %q, expected %q", actual, foo0)
+	}
+}
+
+func TestContext2Plan_moduleBudget(t *testing.T) {
+	m := testModule(t, "plan-module-budget")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	cases := []struct {
+		Budgets []*ModuleBudget
+		Err     string
+	}{
+		{
+			[]*ModuleBudget{
+				&ModuleBudget{Pattern: "module.*", Max: 4},
+				&ModuleBudget{Pattern: "root", Max: 6},
+			},
+			"",
+		},
+		{
+			[]*ModuleBudget{
+				&ModuleBudget{Pattern: "module.*", Max: 3},
+			},
+			"module.child has 4 resources, more than its budget of 3",
+		},
+		{
+			[]*ModuleBudget{
+				&ModuleBudget{Pattern: "root", Max: 5},
+			},
+			"root has 6 resources, more than its budget of 5",
+		},
+	}
+
+	for i, tc := range cases {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			ModuleBudgets: tc.Budgets,
+		})
+
+		_, err := ctx.Plan()
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%d: err: %s", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%d: bad: %v", i, err)
+		}
+	}
+}
+
 // GH-1475
 func TestContext2Plan_moduleCycle(t *testing.T) {
 	m := testModule(t, "plan-module-cycle")
@@ -539,12 +881,141 @@ func TestContext2Plan_moduleVarComputed(t *testing.T) {
 	if actual != expected {
 		t.Fatalf("bad:\n%s", actual)
 	}
-}
-
-func TestContext2Plan_nil(t *testing.T) {
-	m := testModule(t, "plan-nil")
-	p := testProvider("aws")
-	p.DiffFn = testDiffFn
+}
+
+func TestContext2Plan_nil(t *testing.T) {
+	m := testModule(t, "plan-nil")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "bar",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(plan.Diff.RootModule().Resources) != 0 {
+		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
+	}
+}
+
+func TestContext2Plan_expectNoChange_bad(t *testing.T) {
+	m := testModule(t, "plan-expect-no-change")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "i-abc123",
+								Attributes: map[string]string{
+									"num":  "1",
+									"type": "aws_instance",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	plan, err := ctx.Plan()
+
+	for _, expectedErr := range []string{
+		"aws_instance.foo: the plan would change",
+		`num: ""`,
+	} {
+		if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
+			t.Fatalf("expected err would contain %q\nerr: %s\nplan: %s",
+				expectedErr, err, plan)
+		}
+	}
+}
+
+func TestContext2Plan_expectNoChange_good(t *testing.T) {
+	m := testModule(t, "plan-expect-no-change")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "i-abc123",
+								Attributes: map[string]string{
+									"num":  "2",
+									"type": "aws_instance",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !plan.Diff.Empty() {
+		t.Fatalf("Expected empty plan, got %s", plan.String())
+	}
+}
+
+func TestContext2Plan_diffSuppress(t *testing.T) {
+	m := testModule(t, "plan-diff-suppress")
+	p := &testDiffSuppressProvider{MockResourceProvider: testProvider("aws")}
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"policy": &ResourceAttrDiff{
+					Old: s.Attributes["policy"],
+					New: c.Config["policy"].(string),
+				},
+			},
+		}, nil
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
@@ -558,7 +1029,10 @@ func TestContext2Plan_nil(t *testing.T) {
 						"aws_instance.foo": &ResourceState{
 							Type: "aws_instance",
 							Primary: &InstanceState{
-								ID: "bar",
+								ID: "i-abc123",
+								Attributes: map[string]string{
+									"policy": `{"a":1}`,
+								},
 							},
 						},
 					},
@@ -567,12 +1041,13 @@ func TestContext2Plan_nil(t *testing.T) {
 		},
 	})
 
+	// The policy only changes whitespace
 	plan, err := ctx.Plan()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	if len(plan.Diff.RootModule().Resources) != 0 {
-		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
+	if !plan.Diff.Empty() {
+		t.Fatalf("Expected empty plan, got %s", plan.String())
 	}
 }
 
@@ -611,6 +1086,38 @@ func TestContext2Plan_preventDestroy_bad(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_preventDestroy_countDecrease(t *testing.T) {
+	m := testModule(t, "plan-prevent-destroy-count-dec")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo.0": resourceState("aws_instance", "i-abc123"),
+						"aws_instance.foo.1": resourceState("aws_instance", "i-bcd234"),
+						"aws_instance.foo.2": resourceState("aws_instance", "i-cde345"),
+					},
+				},
+			},
+		},
+	})
+
+	plan, err := ctx.Plan()
+
+	expectedErr := "aws_instance.foo: the plan would destroy"
+	if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
+		t.Fatalf("expected err would contain %q\nerr: %s\nplan: %s",
+			expectedErr, err, plan)
+	}
+}
+
 func TestContext2Plan_preventDestroy_good(t *testing.T) {
 	m := testModule(t, "plan-prevent-destroy-good")
 	p := testProvider("aws")
@@ -705,6 +1212,51 @@ func TestContext2Plan_computed(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_computedKeys(t *testing.T) {
+	m := testModule(t, "plan-computed-keys")
+	p := testProvider("aws")
+
+	var lock sync.Mutex
+	var bar *ResourceConfig
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		if info.Id == "aws_instance.bar" {
+			lock.Lock()
+			bar = c
+			lock.Unlock()
+		}
+		return testDiffFn(info, s, c)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only what interpolates the computed attribute is unknown, the rest
+	// of the config is known. The block is a list with one element.
+	expected := []string{"foo", "tags.0.Name"}
+	if !reflect.DeepEqual(bar.ComputedKeys, expected) {
+		t.Fatalf("bad: %#v", bar.ComputedKeys)
+	}
+	if v, ok := bar.Get("num"); !ok || v != "2" {
+		t.Fatalf("bad: %#v", v)
+	}
+	if v, ok := bar.Get("tags.0.Owner"); !ok || v != "me" {
+		t.Fatalf("bad: %#v", v)
+	}
+	if !bar.IsComputed("tags.0.Name") {
+		t.Fatal("tags.0.Name should be computed")
+	}
+}
+
 func TestContext2Plan_computedList(t *testing.T) {
 	m := testModule(t, "plan-computed-list")
 	p := testProvider("aws")
@@ -770,6 +1322,55 @@ func TestContext2Plan_countComputed(t *testing.T) {
 	if err == nil {
 		t.Fatal("should error")
 	}
+	if !strings.Contains(err.Error(), "isn't known until the apply") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestContext2Plan_countModuleVar(t *testing.T) {
+	m := testModule(t, "plan-count-module-var")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountModuleVarStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_countResourceVar(t *testing.T) {
+	m := testModule(t, "plan-count-resource-var")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountResourceVarStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
 }
 
 func TestContext2Plan_countIndex(t *testing.T) {
@@ -867,6 +1468,48 @@ func TestContext2Plan_countZero(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_countZeroTargeted(t *testing.T) {
+	m := testModule(t, "plan-count-zero-targeted")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+					"aws_instance.foo.1": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "baz"},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:   s,
+		Targets: []string{"aws_instance.foo"},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountZeroTargetedStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
 func TestContext2Plan_countOneIndex(t *testing.T) {
 	m := testModule(t, "plan-count-one-index")
 	p := testProvider("aws")
@@ -1452,6 +2095,152 @@ func TestContext2Plan_orphan(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_orphanDeposed(t *testing.T) {
+	m := testModule(t, "plan-orphan")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.baz": &ResourceState{
+						Type: "aws_instance",
+						Deposed: []*InstanceState{
+							&InstanceState{ID: "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.Diff.String())
+	expected := strings.TrimSpace(`
+DESTROY: aws_instance.baz
+CREATE: aws_instance.foo
+  num:  "" => "2"
+  type: "" => "aws_instance"
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_pending(t *testing.T) {
+	m := testModule(t, "plan-good")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.RefreshFn = func(info *InstanceInfo, s *InstanceState) (*InstanceState, error) {
+		return s, nil
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+						Pending: true,
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !p.RefreshCalled {
+		t.Fatal("pending resource should be refreshed")
+	}
+	if plan.State.HasPending() {
+		t.Fatalf("bad: %s", plan.State)
+	}
+}
+
+func TestContext2Plan_replaceTriggeredBy(t *testing.T) {
+	m := testModule(t, "plan-replace-triggered-by")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_ami.web": &ResourceState{
+						Type: "aws_ami",
+						Primary: &InstanceState{
+							ID: "ami-1",
+							Attributes: map[string]string{
+								"foo": "old",
+							},
+						},
+					},
+					"aws_instance.web": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "i-1",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.Diff.String())
+	expected := strings.TrimSpace(`
+UPDATE: aws_ami.web
+  foo:  "" => "new"
+  type: "" => "aws_ami"
+DESTROY/CREATE: aws_instance.web
+  foo:  "" => "bar"
+  type: "" => "aws_instance"
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
 func TestContext2Plan_state(t *testing.T) {
 	m := testModule(t, "plan-good")
 	p := testProvider("aws")
@@ -60,6 +60,250 @@ func TestContext2Refresh(t *testing.T) {
 	}
 }
 
+func TestContext2Refresh_recoverState(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "refresh-basic")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.web": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "foo",
+								Attributes: map[string]string{
+									"id":     "foo",
+									"tags.#": "3",
+									"tags.0": "a",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		RecoverState: true,
+	})
+
+	p.RefreshFn = nil
+	p.RefreshReturn = &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"id":     "foo",
+			"tags.#": "1",
+			"tags.0": "a",
+		},
+	}
+
+	s, err := ctx.Refresh()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.RefreshCalled {
+		t.Fatal("refresh should be called")
+	}
+
+	// The provider is refreshed with only the ID that was salvaged
+	expected := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"id": "foo"},
+	}
+	if !reflect.DeepEqual(p.RefreshState, expected) {
+		t.Fatalf("bad: %#v", p.RefreshState)
+	}
+
+	actual := s.RootModule().Resources["aws_instance.web"].Primary
+	if !reflect.DeepEqual(actual, p.RefreshReturn) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestContext2Refresh_drift(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "refresh-basic")
+	h := new(MockHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.web": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "foo",
+								Attributes: map[string]string{
+									"ami":  "ami-1",
+									"size": "small",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	// The instance was changed outside of Terraform
+	p.RefreshFn = nil
+	p.RefreshReturn = &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"ami":  "ami-1",
+			"size": "large",
+			"tags": "1",
+		},
+	}
+
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !h.PostRefreshDriftCalled {
+		t.Fatal("should report the drift")
+	}
+	if h.PostRefreshDriftInfo.Id != "aws_instance.web" {
+		t.Fatalf("bad: %#v", h.PostRefreshDriftInfo)
+	}
+	expected := []*AttributeChange{
+		&AttributeChange{Attribute: "size", Old: "small", New: "large"},
+		&AttributeChange{Attribute: "tags", New: "1"},
+	}
+	if !reflect.DeepEqual(h.PostRefreshDriftChanges, expected) {
+		t.Fatalf("bad: %#v", h.PostRefreshDriftChanges)
+	}
+}
+
+func TestContext2Refresh_driftNone(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "refresh-basic")
+	h := new(MockHook)
+	state := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"ami": "ami-1"},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.web": &ResourceState{
+							Type:    "aws_instance",
+							Primary: state,
+						},
+					},
+				},
+			},
+		},
+	})
+
+	p.RefreshFn = nil
+	p.RefreshReturn = state.deepcopy()
+
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if h.PostRefreshDriftCalled {
+		t.Fatalf("bad: %#v", h.PostRefreshDriftChanges)
+	}
+}
+
+func TestContext2Refresh_dataSource(t *testing.T) {
+	p := testDataSourceProviderFor(testProvider("aws"))
+	m := testModule(t, "plan-data-source")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"data.aws_ami.foo": &ResourceState{
+							Type: "aws_ami",
+							Primary: &InstanceState{
+								ID: "ami-old",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	s, err := ctx.Refresh()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.RefreshCalled {
+		t.Fatal("a data source isn't refreshed like a resource")
+	}
+
+	// What was read replaces what was there
+	rs := s.RootModule().Resources["data.aws_ami.foo"]
+	if rs == nil || rs.Primary.ID != "ami-123" || rs.Type != "aws_ami" {
+		t.Fatalf("bad: %#v", rs)
+	}
+}
+
+func TestContext2Refresh_dataSourceOrphan(t *testing.T) {
+	p := testDataSourceProviderFor(testProvider("aws"))
+	m := testModule(t, "refresh-data-source-orphan")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"data.aws_ami.foo": &ResourceState{
+							Type: "aws_ami",
+							Primary: &InstanceState{
+								ID: "ami-old",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	s, err := ctx.Refresh()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.ReadDataSourceCalled || p.RefreshCalled {
+		t.Fatal("the orphan shouldn't be read")
+	}
+
+	if _, ok := s.RootModule().Resources["data.aws_ami.foo"]; ok {
+		t.Fatalf("the orphan should be removed:\n%s", s)
+	}
+}
+
 func TestContext2Refresh_targeted(t *testing.T) {
 	p := testProvider("aws")
 	m := testModule(t, "refresh-targeted")
@@ -798,3 +1042,50 @@ func TestContext2Validate(t *testing.T) {
 		t.Fatalf("bad: %s", e)
 	}
 }
+
+func TestContext2Refresh_countOrphans(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "apply-count-dec")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo.0": resourceState("aws_instance", "i-abc123"),
+						"aws_instance.foo.1": resourceState("aws_instance", "i-bcd234"),
+						"aws_instance.foo.2": resourceState("aws_instance", "i-cde345"),
+					},
+				},
+			},
+		},
+	})
+
+	var l sync.Mutex
+	var refreshed []string
+	p.RefreshFn = func(i *InstanceInfo, is *InstanceState) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		refreshed = append(refreshed, i.Id)
+		return is, nil
+	}
+
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The instance beyond the count is refreshed too
+	expected := []string{
+		"aws_instance.foo.0",
+		"aws_instance.foo.1",
+		"aws_instance.foo.2",
+	}
+	sort.Strings(refreshed)
+	if !reflect.DeepEqual(refreshed, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, refreshed)
+	}
+}
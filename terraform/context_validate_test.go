@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -25,6 +26,34 @@ func TestContext2Validate_badVar(t *testing.T) {
 	}
 }
 
+func TestContext2Validate_requiredVersion(t *testing.T) {
+	cases := map[string]string{
+		"validate-required-version-bad":     "requires Terraform < 0.6.0",
+		"validate-required-version-invalid": "invalid required_version",
+	}
+
+	for fixture, expected := range cases {
+		p := testProvider("aws")
+		m := testModule(t, fixture)
+		c := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		_, e := c.Validate()
+		if len(e) != 1 || !strings.Contains(e[0].Error(), expected) {
+			t.Fatalf("%s: bad: %#v", fixture, e)
+		}
+
+		// Nothing else is validated
+		if p.ValidateResourceCalled {
+			t.Fatalf("%s: the resource shouldn't be validated", fixture)
+		}
+	}
+}
+
 func TestContext2Validate_computedVar(t *testing.T) {
 	p := testProvider("aws")
 	m := testModule(t, "validate-computed-var")
@@ -76,6 +105,45 @@ func TestContext2Validate_countNegative(t *testing.T) {
 	}
 }
 
+func TestContext2Validate_countComputed(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "validate-count-computed")
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	// The count is only known once planned, so it's only a warning
+	w, e := c.Validate()
+	if len(w) != 1 || !strings.Contains(w[0], "until it's planned") {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) > 0 {
+		t.Fatalf("bad: %s", e)
+	}
+}
+
+func TestContext2Validate_countString(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "validate-count-string")
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	w, e := c.Validate()
+	if len(w) > 0 {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) != 1 || !strings.Contains(e[0].Error(), "non-negative integer") {
+		t.Fatalf("bad: %s", e)
+	}
+}
+
 func TestContext2Validate_countVariable(t *testing.T) {
 	p := testProvider("aws")
 	m := testModule(t, "apply-count-variable")
@@ -114,6 +182,47 @@ func TestContext2Validate_countVariableNoDefault(t *testing.T) {
 	}
 }
 
+func TestContext2Validate_countVariableIndex(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "validate-count-variable-index")
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	w, e := c.Validate()
+	if len(w) > 0 {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) != 1 {
+		t.Fatalf("bad: %s", e)
+	}
+	if !strings.Contains(e[0].Error(), "valid indexes are 0 to 1") {
+		t.Fatalf("bad: %s", e[0])
+	}
+
+	// Raising the count makes the reference valid
+	c = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]string{
+			"count": "3",
+		},
+	})
+
+	w, e = c.Validate()
+	if len(w) > 0 {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) > 0 {
+		t.Fatalf("bad: %s", e)
+	}
+}
+
 /*
 TODO: What should we do here?
 func TestContext2Validate_cycle(t *testing.T) {
@@ -462,6 +571,100 @@ func TestContext2Validate_provisionerConfig_bad(t *testing.T) {
 	}
 }
 
+func TestContext2Validate_provisionerConfig_badAll(t *testing.T) {
+	m := testModule(t, "validate-bad-prov-all")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	p.ValidateResourceReturnErrors = []error{fmt.Errorf("bad resource")}
+	pr.ValidateFn = func(c *ResourceConfig) ([]string, []error) {
+		command, _ := c.Get("command")
+		return nil, []error{fmt.Errorf("bad command %s", command)}
+	}
+
+	// Every error is reported, not only the first one
+	_, e := c.Validate()
+	if len(e) != 3 {
+		t.Fatalf("bad: %#v", e)
+	}
+	var actual []string
+	for _, err := range e {
+		actual = append(actual, err.Error())
+	}
+	expected := []string{
+		"aws_instance.test: bad resource",
+		"aws_instance.test: bad command foo",
+		"aws_instance.test: bad command bar",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestContext2Validate_provisionerConnKeyFile(t *testing.T) {
+	m := testModule(t, "validate-prov-conn-key-file")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]string{
+			"key": "main.tf",
+		},
+	})
+
+	w, e := c.Validate()
+	if len(w) > 0 {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) > 0 {
+		t.Fatalf("bad: %#v", e)
+	}
+}
+
+func TestContext2Validate_provisionerConnKeyFileMissing(t *testing.T) {
+	m := testModule(t, "validate-prov-conn-key-file")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]string{
+			"key": "missing.pem",
+		},
+	})
+
+	w, e := c.Validate()
+	if len(w) > 0 {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) != 1 {
+		t.Fatalf("bad: %#v", e)
+	}
+	if !strings.Contains(e[0].Error(), "does not exist") {
+		t.Fatalf("bad: %s", e[0])
+	}
+}
+
 func TestContext2Validate_provisionerConfig_good(t *testing.T) {
 	m := testModule(t, "validate-bad-prov-conf")
 	p := testProvider("aws")
@@ -0,0 +1,42 @@
+package terraform
+
+import (
+	"time"
+)
+
+// Coordinator coordinates the applies of parallel deployments of the same
+// configuration, such as an active deployment in one region and a passive
+// one in another. Only the deployment that is the leader may apply, and
+// each apply of the leader leaves a marker that the other deployments can
+// read, such as to decide whether to take over.
+//
+// The implementation handles the distributed locking and the storage of
+// the marker. It knows which deployment it is for.
+type Coordinator interface {
+	// Lock takes the lock that only one deployment can hold at a time,
+	// for the duration of an apply, and returns whether this deployment
+	// is the leader, electing it if there is none. The lock is held even
+	// if it isn't the leader, until Unlock is called.
+	Lock() (bool, error)
+
+	// Unlock releases the lock taken by Lock.
+	Unlock() error
+
+	// ReadMarker returns the marker of the last apply of the leader, or
+	// nil if there is none yet.
+	ReadMarker() (*CoordinationMarker, error)
+
+	// WriteMarker replaces the marker once the leader has applied.
+	WriteMarker(*CoordinationMarker) error
+}
+
+// CoordinationMarker is the record of the last apply of the leader. See
+// Coordinator.
+type CoordinationMarker struct {
+	// Serial is incremented by every apply, so the other deployments
+	// can tell that there was a new one.
+	Serial int64
+
+	// Time is when the apply finished, in UTC.
+	Time time.Time
+}
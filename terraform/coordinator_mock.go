@@ -0,0 +1,65 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// MockCoordinator is an implementation of Coordinator that can be used
+// for tests.
+type MockCoordinator struct {
+	lock sync.Mutex
+
+	LockCalled bool
+	LockLeader bool
+	LockError  error
+
+	UnlockCalled bool
+	UnlockError  error
+
+	ReadMarkerCalled bool
+	ReadMarkerError  error
+
+	WriteMarkerCalled bool
+	WriteMarkerError  error
+
+	// Marker is the marker that ReadMarker returns and WriteMarker
+	// replaces.
+	Marker *CoordinationMarker
+}
+
+func (c *MockCoordinator) Lock() (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.LockCalled = true
+	return c.LockLeader, c.LockError
+}
+
+func (c *MockCoordinator) Unlock() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.UnlockCalled = true
+	return c.UnlockError
+}
+
+func (c *MockCoordinator) ReadMarker() (*CoordinationMarker, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ReadMarkerCalled = true
+	return c.Marker, c.ReadMarkerError
+}
+
+func (c *MockCoordinator) WriteMarker(m *CoordinationMarker) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.WriteMarkerCalled = true
+	if c.WriteMarkerError != nil {
+		return c.WriteMarkerError
+	}
+
+	c.Marker = m
+	return nil
+}
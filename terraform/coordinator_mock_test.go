@@ -0,0 +1,9 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestMockCoordinator_impl(t *testing.T) {
+	var _ Coordinator = new(MockCoordinator)
+}
@@ -0,0 +1,78 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CostSummary is the estimated cost of the changes of an apply, for
+// checking it against the budget. See ContextOpts.CostBudget.
+type CostSummary struct {
+	// Budget is the budget of the apply.
+	Budget float64
+
+	// Total is the sum of the estimated changes to the monthly cost of
+	// all the resources whose cost is known.
+	Total float64
+
+	// Unknown are the resources that change, but whose cost isn't known.
+	// Since they may cost anything, an apply with any of them needs to be
+	// confirmed just like one over budget.
+	Unknown []string
+}
+
+// OverBudget returns true if the apply must be confirmed, see CostConfirmer.
+func (s *CostSummary) OverBudget() bool {
+	return s.Total > s.Budget || len(s.Unknown) > 0
+}
+
+func (s *CostSummary) String() string {
+	result := fmt.Sprintf(
+		"The estimated monthly cost change of this apply is %.2f, "+
+			"and the budget is %.2f.", s.Total, s.Budget)
+	if len(s.Unknown) > 0 {
+		result += fmt.Sprintf(
+			" The cost of these resources isn't known: %s.",
+			strings.Join(s.Unknown, ", "))
+	}
+
+	return result
+}
+
+// CostConfirmer can be implemented by a Hook to confirm an apply whose
+// estimated cost is over its budget. Such an apply is blocked unless one of
+// the hooks confirms it, such as by asking the user.
+type CostConfirmer interface {
+	ConfirmCost(*CostSummary) (bool, error)
+}
+
+// newCostSummary sums the estimated costs of all the changes in the diff.
+func newCostSummary(d *Diff, budget float64) *CostSummary {
+	result := &CostSummary{Budget: budget}
+	if d == nil {
+		return result
+	}
+
+	for _, m := range d.Modules {
+		for k, rd := range m.Resources {
+			if rd.Empty() {
+				continue
+			}
+
+			if rd.CostDelta == nil {
+				name := k
+				if prefix := modulePrefixStr(m.Path); prefix != "" {
+					name = prefix + "." + name
+				}
+				result.Unknown = append(result.Unknown, name)
+				continue
+			}
+
+			result.Total += *rd.CostDelta
+		}
+	}
+	sort.Strings(result.Unknown)
+
+	return result
+}
@@ -3,11 +3,15 @@ package terraform
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 // DiffChangeType is an enum with the kind of changes a diff has planned.
@@ -111,6 +115,45 @@ func (d *Diff) String() string {
 	return strings.TrimSpace(buf.String())
 }
 
+// Checksum returns a checksum of all the resource diffs in this diff.
+// The checksum only depends on the contents of the diff, so identical
+// diffs always have the same checksum. It is used to verify that the
+// diff that is applied is exactly the diff that was planned.
+func (d *Diff) Checksum() string {
+	h := sha256.New()
+	if d != nil {
+		keys := make([]string, 0, len(d.Modules))
+		lookup := make(map[string]*ModuleDiff)
+		for _, m := range d.Modules {
+			if m.Empty() {
+				continue
+			}
+
+			key := strings.Join(m.Path, ".")
+			keys = append(keys, key)
+			lookup[key] = m
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			m := lookup[key]
+
+			names := make([]string, 0, len(m.Resources))
+			for name := range m.Resources {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				fmt.Fprintf(h, "%s.%s\n", key, name)
+				m.Resources[name].writeChecksum(h)
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func (d *Diff) init() {
 	if d.Modules == nil {
 		rootDiff := &ModuleDiff{Path: rootModulePath}
@@ -263,6 +306,15 @@ func (d *ModuleDiff) String() string {
 				v,
 				newResource))
 		}
+
+		if rdiff.Provision {
+			buf.WriteString("  (provisioners triggered)\n")
+		}
+		if !rdiff.ScheduledFor.IsZero() {
+			buf.WriteString(fmt.Sprintf(
+				"  (queued until %s)\n",
+				rdiff.ScheduledFor.UTC().Format(time.RFC3339)))
+		}
 	}
 
 	return buf.String()
@@ -273,6 +325,21 @@ type InstanceDiff struct {
 	Attributes     map[string]*ResourceAttrDiff
 	Destroy        bool
 	DestroyTainted bool
+
+	// Provision is true if the triggers of a provisioner changed, so the
+	// provisioners run again even if nothing else about the resource
+	// changes. See config.Provisioner.Triggers.
+	Provision bool
+
+	// ScheduledFor is set if the diff was queued during an apply because
+	// it was outside the change window of the resource. It is the time
+	// the window opens, when the diff can be applied.
+	ScheduledFor time.Time
+
+	// CostDelta is the estimated change to the monthly cost of the
+	// resource from applying the diff, or nil if it isn't known. See
+	// ResourceProviderCostEstimator.
+	CostDelta *float64
 }
 
 // ResourceAttrDiff is the diff of a single attribute of a resource.
@@ -309,6 +376,37 @@ func (d *InstanceDiff) init() {
 	}
 }
 
+func (d *InstanceDiff) deepcopy() *InstanceDiff {
+	if d == nil {
+		return nil
+	}
+
+	n := &InstanceDiff{
+		Destroy:        d.Destroy,
+		DestroyTainted: d.DestroyTainted,
+		Provision:      d.Provision,
+		ScheduledFor:   d.ScheduledFor,
+	}
+	if d.CostDelta != nil {
+		cost := *d.CostDelta
+		n.CostDelta = &cost
+	}
+	if d.Attributes != nil {
+		n.Attributes = make(map[string]*ResourceAttrDiff, len(d.Attributes))
+		for k, v := range d.Attributes {
+			if v == nil {
+				n.Attributes[k] = nil
+				continue
+			}
+
+			attr := *v
+			n.Attributes[k] = &attr
+		}
+	}
+
+	return n
+}
+
 // ChangeType returns the DiffChangeType represented by the diff
 // for this single instance.
 func (d *InstanceDiff) ChangeType() DiffChangeType {
@@ -337,7 +435,37 @@ func (d *InstanceDiff) Empty() bool {
 		return true
 	}
 
-	return !d.Destroy && len(d.Attributes) == 0
+	return !d.Destroy && !d.Provision && len(d.Attributes) == 0
+}
+
+// writeChecksum writes everything in the diff that affects what is
+// applied to w, in a stable order. See Diff.Checksum.
+func (d *InstanceDiff) writeChecksum(w io.Writer) {
+	if d == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "destroy=%t destroy_tainted=%t\n", d.Destroy, d.DestroyTainted)
+	if d.Provision {
+		fmt.Fprintln(w, "provision")
+	}
+	if d.CostDelta != nil {
+		fmt.Fprintf(w, "cost=%g\n", *d.CostDelta)
+	}
+
+	keys := make([]string, 0, len(d.Attributes))
+	for k := range d.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		a := d.Attributes[k]
+		fmt.Fprintf(
+			w, "%q %q %q %t %t %t %d %#v\n",
+			k, a.Old, a.New, a.NewComputed, a.NewRemoved, a.RequiresNew,
+			a.Type, a.NewExtra)
+	}
 }
 
 func (d *InstanceDiff) GoString() string {
@@ -502,3 +630,75 @@ func (d *InstanceDiff) Same(d2 *InstanceDiff) (bool, string) {
 
 	return true, ""
 }
+
+// AttrMismatch is an attribute whose diff isn't the same in two diffs of
+// the same instance. See InstanceDiff.AttrMismatches.
+type AttrMismatch struct {
+	Key string
+
+	// One and Two are the diffs of the attribute in each diff, or nil if
+	// the attribute is only in the other diff.
+	One, Two *ResourceAttrDiff
+}
+
+// RequiresNewChanged returns true if the attribute forces a new resource
+// in only one of the diffs.
+func (m *AttrMismatch) RequiresNewChanged() bool {
+	var one, two bool
+	if m.One != nil {
+		one = m.One.RequiresNew
+	}
+	if m.Two != nil {
+		two = m.Two.RequiresNew
+	}
+
+	return one != two
+}
+
+// AttrMismatches returns the attributes whose diffs differ between d and
+// d2, sorted by key, to explain why two diffs aren't the Same. Unlike
+// Same, it compares the attributes exactly, except that an attribute that
+// is computed in d may have any value in d2, and an attribute that d
+// removes may be missing from d2.
+func (d *InstanceDiff) AttrMismatches(d2 *InstanceDiff) []*AttrMismatch {
+	var one, two map[string]*ResourceAttrDiff
+	if d != nil {
+		one = d.Attributes
+	}
+	if d2 != nil {
+		two = d2.Attributes
+	}
+
+	keys := make([]string, 0, len(one)+len(two))
+	for k, _ := range one {
+		keys = append(keys, k)
+	}
+	for k, _ := range two {
+		if _, ok := one[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var result []*AttrMismatch
+	for _, k := range keys {
+		a, b := one[k], two[k]
+		switch {
+		case a != nil && b == nil && a.NewRemoved:
+			continue
+		case a != nil && b != nil && a.NewComputed:
+			continue
+		case a != nil && b != nil &&
+			a.Old == b.Old &&
+			a.New == b.New &&
+			a.NewComputed == b.NewComputed &&
+			a.NewRemoved == b.NewRemoved &&
+			a.RequiresNew == b.RequiresNew:
+			continue
+		}
+
+		result = append(result, &AttrMismatch{Key: k, One: a, Two: b})
+	}
+
+	return result
+}
@@ -27,6 +27,44 @@ func TestDiffEmpty(t *testing.T) {
 	}
 }
 
+func TestDiffChecksum(t *testing.T) {
+	newDiff := func() *Diff {
+		diff := new(Diff)
+		diff.init()
+		diff.RootModule().Resources["nodeA"] = &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"foo": &ResourceAttrDiff{
+					Old: "foo",
+					New: "bar",
+				},
+				"bar": &ResourceAttrDiff{
+					NewComputed: true,
+				},
+			},
+		}
+		diff.RootModule().Resources["nodeB"] = &InstanceDiff{Destroy: true}
+
+		return diff
+	}
+
+	one := newDiff()
+	two := newDiff()
+	if one.Checksum() != two.Checksum() {
+		t.Fatal("identical diffs should have the same checksum")
+	}
+
+	// Module diffs without any resources don't affect the checksum
+	two.AddModule([]string{"root", "child"})
+	if one.Checksum() != two.Checksum() {
+		t.Fatal("empty modules shouldn't change the checksum")
+	}
+
+	two.RootModule().Resources["nodeA"].Attributes["foo"].New = "baz"
+	if one.Checksum() == two.Checksum() {
+		t.Fatal("different diffs should have different checksums")
+	}
+}
+
 func TestModuleDiff_ChangeType(t *testing.T) {
 	cases := []struct {
 		Diff   *ModuleDiff
@@ -568,6 +606,50 @@ func TestInstanceDiffSame(t *testing.T) {
 	}
 }
 
+func TestInstanceDiffAttrMismatches(t *testing.T) {
+	one := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami":     &ResourceAttrDiff{Old: "foo", New: "bar"},
+			"ip":      &ResourceAttrDiff{Old: "", NewComputed: true},
+			"name":    &ResourceAttrDiff{Old: "foo", New: "foo"},
+			"size":    &ResourceAttrDiff{Old: "small", New: "large"},
+			"tags.#":  &ResourceAttrDiff{Old: "1", NewRemoved: true},
+			"volumes": &ResourceAttrDiff{Old: "1", New: "2"},
+		},
+	}
+	two := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami":  &ResourceAttrDiff{Old: "foo", New: "baz"},
+			"ip":   &ResourceAttrDiff{Old: "", New: "10.0.0.1"},
+			"name": &ResourceAttrDiff{Old: "foo", New: "foo"},
+			"size": &ResourceAttrDiff{
+				Old: "small", New: "large", RequiresNew: true},
+			"zone": &ResourceAttrDiff{Old: "", New: "a"},
+		},
+	}
+
+	ms := one.AttrMismatches(two)
+	keys := make([]string, len(ms))
+	for i, m := range ms {
+		keys[i] = m.Key
+	}
+	expected := []string{"ami", "size", "volumes", "zone"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad: %#v", keys)
+	}
+
+	if ms[0].RequiresNewChanged() || !ms[1].RequiresNewChanged() {
+		t.Fatalf("bad: %#v", ms)
+	}
+	if ms[2].Two != nil || ms[3].One != nil {
+		t.Fatalf("bad: %#v", ms)
+	}
+
+	if ms := one.AttrMismatches(one); len(ms) > 0 {
+		t.Fatalf("bad: %#v", ms)
+	}
+}
+
 const moduleDiffStrBasic = `
 CREATE: nodeA
   bar:     "foo" => "<computed>"
@@ -1,9 +1,12 @@
 package terraform
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/terraform/config"
@@ -19,6 +22,27 @@ type EvalApply struct {
 	Output    **InstanceState
 	CreateNew *bool
 	Error     *error
+
+	// ErrorClass, if set, is set to the class of the error returned by
+	// the provider, if any. See ApplyError.
+	ErrorClass *ApplyErrorClass
+
+	// Retries is how many times the apply is retried if the provider
+	// fails it with a transient error, see ApplyErrorTransient.
+	Retries int
+
+	// Timeouts, if set, are the timeouts of the resource. The apply is
+	// cancelled if it runs past the timeout of its operation, which the
+	// diff determines.
+	Timeouts *config.ResourceTimeouts
+
+	// DryRun, if true, outputs the state that applying the diff would
+	// result in without changing anything. The provider projects it if
+	// it implements ResourceProviderDryRunner, otherwise it is projected
+	// from the diff, with the attributes that aren't known yet computed.
+	// Nothing is audited or reported to the watchlist. This is also the
+	// case when the context is a dry run, see ContextOpts.DryRun.
+	DryRun bool
 }
 
 // TODO: test
@@ -27,10 +51,11 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	provider := *n.Provider
 	state := *n.State
 
-	// If we have no diff, we have nothing to do!
-	if diff.Empty() {
+	// If we have no diff, we have nothing to do! A diff that only runs
+	// the provisioners again doesn't change the resource either.
+	if applyDiffEmpty(diff) {
 		log.Printf(
-			"[DEBUG] apply: %s: diff is empty, doing nothing.", n.Info.Id)
+			"[DEBUG] apply: %s: diff is empty, doing nothing.", n.Info.logId())
 		return nil, nil
 	}
 
@@ -47,24 +72,54 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	}
 	state.init()
 
+	// Keep the attributes before the apply to report the changes to the
+	// watched ones and to the audit log, the provider may change the
+	// state in place.
+	var before map[string]string
+	watchlist := ctx.AttributeWatchlist()
+	audit := ctx.AuditLog()
+	exists := state.ID != ""
+	if len(watchlist) > 0 || audit != nil {
+		before = make(map[string]string, len(state.Attributes))
+		for k, v := range state.Attributes {
+			before[k] = v
+		}
+	}
+
 	// Flag if we're creating a new instance
 	if n.CreateNew != nil {
 		*n.CreateNew = (state.ID == "" && !diff.Destroy) || diff.RequiresNew()
 	}
 
-	{
-		// Call pre-apply hook
-		err := ctx.Hook(func(h Hook) (HookAction, error) {
-			return h.PreApply(n.Info, state, diff)
-		})
-		if err != nil {
-			return nil, err
+	if n.DryRun || ctx.DryRun() {
+		return n.dryRun(ctx, provider, state, diff)
+	}
+
+	// Use the provider's custom apply for this resource type, if it has one
+	apply := provider.Apply
+	if ca, ok := provider.(ResourceProviderCustomApplier); ok {
+		if f := ca.CustomApply(n.Info.Type); f != nil {
+			log.Printf("[DEBUG] apply: %s: using custom apply", n.Info.logId())
+			apply = f
 		}
 	}
 
-	// With the completed diff, apply!
-	log.Printf("[DEBUG] apply: %s: executing Apply", n.Info.Id)
-	state, err := provider.Apply(n.Info, state, diff)
+	op := applyOperation(state, diff)
+	timeout, err := applyTimeout(n.Timeouts, op)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.Info.HumanId(), err)
+	}
+
+	// With the completed diff, apply! The provider is only held while it
+	// applies, not while a retry waits.
+	state, err = applyWithRetry(ctx, n.Info, n.Retries, state,
+		func(s *InstanceState) (*InstanceState, error) {
+			log.Printf("[DEBUG] apply: %s: executing Apply", n.Info.logId())
+			release := acquireProvider(ctx, provider)
+			defer release()
+
+			return applyWithTimeout(n.Info, provider, apply, op, timeout, s, diff)
+		})
 	if state == nil {
 		state = new(InstanceState)
 	}
@@ -90,11 +145,48 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 		*n.Output = state
 	}
 
+	// Report the changes to the watched attributes. The resource is
+	// applied already, so a hook error is recorded like an apply error
+	// instead of losing the new state.
+	if changes := watchedChanges(watchlist, before, state.Attributes); len(changes) > 0 {
+		hookErr := ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PostApplyWatched(n.Info, changes)
+		})
+		if _, ok := hookErr.(EvalEarlyExitError); hookErr != nil && !ok {
+			err = multierror.Append(err, hookErr)
+		}
+	}
+
+	// Write the audit record of the change once it is applied, even if
+	// it failed, since it may have changed the resource part way. Unless
+	// the audit log is required, a record that can't be delivered is
+	// only buffered so it is delivered later.
+	if audit != nil {
+		r := audit.record(
+			n.Info.HumanId(), diff, exists, before, state.Attributes, err)
+		if auditErr := audit.Write(r); auditErr != nil {
+			if audit.Required {
+				err = multierror.Append(err, auditErr)
+			} else {
+				log.Printf("[WARN] %s: %s", n.Info.logId(), auditErr)
+			}
+		}
+	}
+
+	// Record the class of the error, if the provider classified it
+	class := ApplyErrorClassOf(err)
+	if n.ErrorClass != nil {
+		*n.ErrorClass = class
+	}
+
 	// If there are no errors, then we append it to our output error
 	// if we have one, otherwise we just output it.
 	if err != nil {
 		if n.Error != nil {
-			helpfulErr := fmt.Errorf("%s: %s", n.Info.Id, err.Error())
+			var helpfulErr error = fmt.Errorf("%s: %s", n.Info.Id, err.Error())
+			if class != ApplyErrorUnclassified {
+				helpfulErr = &ApplyError{Class: class, Err: helpfulErr}
+			}
 			*n.Error = multierror.Append(*n.Error, helpfulErr)
 		} else {
 			return nil, err
@@ -104,6 +196,72 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// dryRun outputs the state that applying the diff is projected to result
+// in. See EvalApply.DryRun.
+func (n *EvalApply) dryRun(
+	ctx EvalContext,
+	provider ResourceProvider,
+	state *InstanceState,
+	diff *InstanceDiff) (interface{}, error) {
+	var err error
+	if dr, ok := provider.(ResourceProviderDryRunner); ok {
+		log.Printf("[DEBUG] apply: %s: executing DryRunApply", n.Info.logId())
+		release := acquireProvider(ctx, provider)
+		state, err = dr.DryRunApply(n.Info, state, diff)
+		release()
+	} else {
+		log.Printf(
+			"[DEBUG] apply: %s: dry run, projecting the state from the diff",
+			n.Info.logId())
+		state = ProjectedState(state, diff)
+	}
+	if state == nil {
+		state = new(InstanceState)
+	}
+	state.init()
+
+	// Force the "id" attribute to be our ID
+	if state.ID != "" {
+		state.Attributes["id"] = state.ID
+	}
+
+	if n.Output != nil {
+		*n.Output = state
+	}
+
+	if err != nil {
+		if n.Error != nil {
+			*n.Error = multierror.Append(*n.Error, fmt.Errorf(
+				"%s: %s", n.Info.Id, err))
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ProjectedState returns the state that applying the diff to the given
+// state would result in, as far as the diff tells. The ID of an instance
+// that would be created and the computed attributes aren't known yet, so
+// they are config.UnknownVariableValue.
+//
+// This is what a dry run apply projects for the providers that don't
+// implement ResourceProviderDryRunner, see EvalApply.DryRun.
+func ProjectedState(state *InstanceState, diff *InstanceDiff) *InstanceState {
+	if diff.Destroy && len(diff.Attributes) == 0 {
+		return nil
+	}
+
+	result := state.MergeDiff(diff)
+	if result.ID == "" || diff.RequiresNew() {
+		result.ID = config.UnknownVariableValue
+	}
+
+	return result
+}
+
 // EvalApplyPost is an EvalNode implementation that does the post-Apply work
 type EvalApplyPost struct {
 	Info  *InstanceInfo
@@ -128,9 +286,253 @@ func (n *EvalApplyPost) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, *n.Error
 }
 
+// EvalPreDestroy is an EvalNode implementation that calls the PreDestroy
+// hook with the state of the instance that is about to be destroyed. If a
+// hook halts, the destroy is skipped.
+type EvalPreDestroy struct {
+	Info  *InstanceInfo
+	State **InstanceState
+}
+
+func (n *EvalPreDestroy) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PreDestroy(n.Info, state)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// EvalPreApply is an EvalNode implementation that calls the PreApply hook
+// with the state and the diff of the instance that is about to be
+// applied. It must come right before EvalApply, before anything such as
+// the pending mark is written, since a hook that halts skips the apply.
+//
+// The hooks are given the diff itself, so they can change the diff that
+// is applied.
+type EvalPreApply struct {
+	Info  *InstanceInfo
+	State **InstanceState
+	Diff  **InstanceDiff
+}
+
+func (n *EvalPreApply) Eval(ctx EvalContext) (interface{}, error) {
+	diff := *n.Diff
+	if applyDiffEmpty(diff) {
+		return nil, nil
+	}
+
+	// The hooks always get a state, even if the instance doesn't exist
+	state := *n.State
+	if state == nil {
+		state = new(InstanceState)
+	}
+	state.init()
+
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PreApply(n.Info, state, diff)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// applyDiffEmpty returns true if applying the diff wouldn't do anything.
+// A diff that only runs the provisioners again doesn't change the
+// resource either.
+func applyDiffEmpty(diff *InstanceDiff) bool {
+	return diff == nil || (!diff.Destroy && len(diff.Attributes) == 0)
+}
+
+// EvalApplyRecreate is an EvalNode implementation that recreates a
+// resource if the error from applying it matches one of the
+// TaintErrorPatterns of the context. It is evaluated right after
+// EvalApply, and the resource is recreated at most once.
+//
+// With create before destroy, the broken instance is destroyed once the
+// new instance is created. If that fails, it is output to Deposed, so
+// that it is kept and destroyed by the next apply like any other deposed
+// instance. Otherwise it is destroyed before the new instance is created.
+// If recreating fails, Tainted is set to true.
+type EvalApplyRecreate struct {
+	Info                *InstanceInfo
+	Config              **ResourceConfig
+	Provider            *ResourceProvider
+	State               **InstanceState
+	CreateBeforeDestroy bool
+	CreateNew           *bool
+	Deposed             **InstanceState
+	Tainted             *bool
+	Error               *error
+	Timeouts            *config.ResourceTimeouts
+
+	// ErrorClass, if set, is the class of the error, see EvalApply. An
+	// instance that failed with a config error isn't recreated, since
+	// the new instance would fail the same way.
+	ErrorClass *ApplyErrorClass
+}
+
+func (n *EvalApplyRecreate) Eval(ctx EvalContext) (interface{}, error) {
+	if *n.Error == nil || !n.matches(ctx, *n.Error) {
+		return nil, nil
+	}
+	if n.ErrorClass != nil && *n.ErrorClass == ApplyErrorConfig {
+		log.Printf(
+			"[INFO] apply: %s: not recreating, the error is a config error",
+			n.Info.logId())
+		return nil, nil
+	}
+
+	log.Printf(
+		"[INFO] apply: %s: error matches a taint pattern, recreating: %s",
+		n.Info.logId(), *n.Error)
+
+	// From here on out the broken instance is only kept to destroy it
+	broken := *n.State
+	var err error
+	if !n.CreateBeforeDestroy && broken != nil && broken.ID != "" {
+		if _, evalErr := Eval(n.destroy(&broken, &err), ctx); evalErr != nil {
+			return nil, evalErr
+		}
+		if err != nil {
+			if n.Tainted != nil {
+				*n.Tainted = true
+			}
+			*n.Error = multierror.Append(*n.Error, err)
+			return nil, nil
+		}
+	}
+
+	// Diff against an empty state to get the diff to create the
+	// replacement, and apply it.
+	var empty *InstanceState
+	var diff *InstanceDiff
+	_, evalErr := Eval(&EvalSequence{
+		Nodes: []EvalNode{
+			&EvalDiff{
+				Info:     n.Info,
+				Config:   n.Config,
+				Provider: n.Provider,
+				State:    &empty,
+				Output:   &diff,
+			},
+			&EvalPreApply{
+				Info:  n.Info,
+				State: &empty,
+				Diff:  &diff,
+			},
+			&EvalApply{
+				Info:      n.Info,
+				State:     &empty,
+				Diff:      &diff,
+				Provider:  n.Provider,
+				Output:    n.State,
+				CreateNew: n.CreateNew,
+				Error:     &err,
+				Timeouts:  n.Timeouts,
+			},
+		},
+	}, ctx)
+	if evalErr != nil {
+		return nil, evalErr
+	}
+	if err != nil {
+		if n.Tainted != nil {
+			*n.Tainted = true
+		}
+		*n.Error = err
+		return nil, nil
+	}
+
+	*n.Error = nil
+	if n.CreateBeforeDestroy && broken != nil && broken.ID != "" {
+		remaining := broken
+		if _, evalErr := Eval(n.destroy(&remaining, &err), ctx); evalErr != nil {
+			return nil, evalErr
+		}
+		if err != nil {
+			// The provider may not return what is left of it
+			if remaining == nil || remaining.ID == "" {
+				remaining = broken
+			}
+			if n.Deposed != nil {
+				*n.Deposed = remaining
+			}
+			*n.Error = err
+		}
+	}
+
+	return nil, nil
+}
+
+// destroy returns the EvalNode that destroys the broken instance, with
+// the error of the destroy in err.
+func (n *EvalApplyRecreate) destroy(broken **InstanceState, err *error) EvalNode {
+	destroyDiff := &InstanceDiff{Destroy: true}
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			&EvalPreApply{
+				Info:  n.Info,
+				State: broken,
+				Diff:  &destroyDiff,
+			},
+			&EvalApply{
+				Info:     n.Info,
+				State:    broken,
+				Diff:     &destroyDiff,
+				Provider: n.Provider,
+				Output:   broken,
+				Error:    err,
+				Timeouts: n.Timeouts,
+			},
+		},
+	}
+}
+
+func (n *EvalApplyRecreate) matches(ctx EvalContext, err error) bool {
+	msg := err.Error()
+	for _, p := range ctx.TaintErrorPatterns() {
+		if p.MatchString(msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // EvalApplyProvisioners is an EvalNode implementation that executes
 // the provisioners for a resource.
 //
+// If DryRun is true, the provisioners that implement
+// ResourceProvisionerChecker are checked instead of applied, and the rest
+// are skipped. This runs on existing resources, so CreateNew isn't used.
+//
+// All the provisioners run when the resource is created. On an existing
+// resource, only the provisioners with triggers that changed run, and a
+// failure doesn't taint the resource. The triggers are recorded in the
+// meta of the state each time the provisioners succeed.
+//
+// If a provisioner fails, the teardowns of the provisioners that succeeded
+// before it run in reverse order, before the resource is tainted. A failed
+// teardown is only logged, the error is the error of the provisioner.
+// Provisioners that continue on failure (see config.Provisioner.OnFailure)
+// only log the failure.
+//
+// If Destroy is true, only the provisioners that run when the resource is
+// destroyed run, on the existing resource before it is destroyed. A failure
+// stops the destroy. Otherwise those provisioners are skipped.
+//
+// If Migrate is true, only the provisioners that migrate the data of a
+// replaced resource run, on the new instance, see EvalMigrateData. A
+// failure is output to Error like a failed migration. Otherwise those
+// provisioners are skipped too.
+//
 // TODO(mitchellh): This should probably be split up into a more fine-grained
 // ApplyProvisioner (single) that is looped over.
 type EvalApplyProvisioners struct {
@@ -141,20 +543,78 @@ type EvalApplyProvisioners struct {
 	CreateNew      *bool
 	Tainted        *bool
 	Error          *error
+	DryRun         bool
+	Destroy        bool
+	Migrate        bool
 }
 
 // TODO: test
 func (n *EvalApplyProvisioners) Eval(ctx EvalContext) (interface{}, error) {
 	state := *n.State
 
-	if !*n.CreateNew {
-		// If we're not creating a new resource, then don't run provisioners
+	if !n.hasProvisioners() {
+		// We have no provisioners, so don't do anything
 		return nil, nil
 	}
 
-	if len(n.Resource.Provisioners) == 0 {
-		// We have no provisioners, so don't do anything
-		return nil, nil
+	if n.DryRun {
+		return nil, n.apply(ctx, nil)
+	}
+
+	// A failure of a provisioner on destroy stops the destroy, and one
+	// of a migration restores the old instance.
+	if n.Destroy || n.Migrate {
+		if state == nil || state.ID == "" {
+			return nil, nil
+		}
+		if n.Migrate && n.Error != nil && *n.Error != nil {
+			return nil, nil
+		}
+
+		err := ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PreProvisionResource(n.Info, state)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := n.apply(ctx, nil); err != nil {
+			if n.Migrate {
+				*n.Error = err
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		err = ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PostProvisionResource(n.Info, state)
+		})
+		return nil, err
+	}
+
+	// If we're not creating a new resource, then only the provisioners
+	// whose triggers changed run.
+	createNew := *n.CreateNew
+	var only map[int]struct{}
+	if !createNew {
+		if state == nil || state.ID == "" {
+			return nil, nil
+		}
+		if n.Error != nil && *n.Error != nil {
+			return nil, nil
+		}
+
+		triggered, err := triggeredProvisioners(
+			ctx, n.Resource, n.interpResource(state), state)
+		if err != nil {
+			return nil, err
+		}
+		if len(triggered) == 0 {
+			return nil, nil
+		}
+
+		only = triggered
 	}
 
 	if n.Error != nil && *n.Error != nil {
@@ -179,10 +639,13 @@ func (n *EvalApplyProvisioners) Eval(ctx EvalContext) (interface{}, error) {
 
 	// If there are no errors, then we append it to our output error
 	// if we have one, otherwise we just output it.
-	err := n.apply(ctx)
-	if n.Tainted != nil {
+	err := n.apply(ctx, only)
+	if n.Tainted != nil && createNew {
 		*n.Tainted = err != nil
 	}
+	if err == nil {
+		err = n.writeTriggers(ctx, only)
+	}
 	if err != nil {
 		if n.Error != nil {
 			*n.Error = multierror.Append(*n.Error, err)
@@ -204,7 +667,73 @@ func (n *EvalApplyProvisioners) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
-func (n *EvalApplyProvisioners) apply(ctx EvalContext) error {
+// hasProvisioners returns true if any of the provisioners of the resource
+// run, see runs.
+func (n *EvalApplyProvisioners) hasProvisioners() bool {
+	for _, prov := range n.Resource.Provisioners {
+		if n.runs(prov) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runs returns true if the provisioner runs when the resource is
+// destroyed if Destroy is set, when its data is migrated if Migrate is
+// set, or when it is created otherwise.
+func (n *EvalApplyProvisioners) runs(prov *config.Provisioner) bool {
+	switch prov.When {
+	case config.ProvisionerWhenDestroy:
+		return n.Destroy
+	case config.ProvisionerWhenMigrate:
+		return n.Migrate
+	default:
+		return !n.Destroy && !n.Migrate
+	}
+}
+
+// interpResource returns the resource to interpolate the provisioners
+// with, whose self variables resolve to the given applied state.
+func (n *EvalApplyProvisioners) interpResource(state *InstanceState) *Resource {
+	if n.InterpResource == nil {
+		return nil
+	}
+
+	r := *n.InterpResource
+	r.State = state
+	return &r
+}
+
+// writeTriggers records the triggers of the provisioners that ran in the
+// state. If only is nil, all the provisioners ran.
+func (n *EvalApplyProvisioners) writeTriggers(
+	ctx EvalContext, only map[int]struct{}) error {
+	state := *n.State
+	for i, prov := range n.Resource.Provisioners {
+		if _, ok := only[i]; (only != nil && !ok) || !n.runs(prov) {
+			continue
+		}
+
+		triggers, computed, err := provisionerTriggers(
+			ctx, prov, n.interpResource(state))
+		if err != nil {
+			return err
+		}
+		if computed || triggers == nil {
+			continue
+		}
+
+		writeProvisionerTriggers(state, i, triggers)
+	}
+
+	return nil
+}
+
+// apply runs the provisioners. If only is non-nil, only the provisioners
+// at the indexes in it run.
+func (n *EvalApplyProvisioners) apply(
+	ctx EvalContext, only map[int]struct{}) error {
 	state := *n.State
 
 	// Store the original connection info, restore later
@@ -213,86 +742,247 @@ func (n *EvalApplyProvisioners) apply(ctx EvalContext) error {
 		state.Ephemeral.ConnInfo = origConnInfo
 	}()
 
-	for _, prov := range n.Resource.Provisioners {
-		// Get the provisioner
-		provisioner := ctx.Provisioner(prov.Type)
+	var done []*config.Provisioner
+	for i, prov := range n.Resource.Provisioners {
+		if _, ok := only[i]; (only != nil && !ok) || !n.runs(prov) {
+			continue
+		}
+
+		if err := n.runRetry(ctx, prov, origConnInfo); err != nil {
+			_, exit := err.(EvalEarlyExitError)
+			if !n.DryRun && !exit &&
+				prov.OnFailure == config.ProvisionerOnFailureContinue {
+				log.Printf(
+					"[WARN] %s: provisioner %s failed, continuing: %s",
+					n.Info.Id, prov.Type, err)
+
+				// The failure isn't an error of the apply, but the
+				// hooks are still told about it.
+				hookErr := ctx.Hook(func(h Hook) (HookAction, error) {
+					return h.ProvisionFailed(n.Info, prov.Type, err)
+				})
+				if hookErr != nil {
+					return hookErr
+				}
+				continue
+			}
+			if !n.DryRun {
+				n.rollback(ctx, done, origConnInfo)
+			}
 
-		// Interpolate the provisioner config
-		provConfig, err := ctx.Interpolate(prov.RawConfig, n.InterpResource)
-		if err != nil {
 			return err
 		}
 
-		// Interpolate the conn info, since it may contain variables
-		connInfo, err := ctx.Interpolate(prov.ConnInfo, n.InterpResource)
-		if err != nil {
+		// A dry run checks the teardown too, since it may have to run
+		if n.DryRun && prov.Teardown != nil {
+			if err := n.run(ctx, prov.Teardown, origConnInfo); err != nil {
+				return err
+			}
+		}
+
+		done = append(done, prov)
+	}
+
+	return nil
+}
+
+// rollback runs the teardowns of the provisioners that succeeded, in
+// reverse order.
+func (n *EvalApplyProvisioners) rollback(
+	ctx EvalContext,
+	done []*config.Provisioner,
+	origConnInfo map[string]string) {
+	for i := len(done) - 1; i >= 0; i-- {
+		prov := done[i]
+		if prov.Teardown == nil {
+			continue
+		}
+
+		log.Printf(
+			"[INFO] %s: tearing down provisioner %s", n.Info.Id, prov.Type)
+		if err := n.runRetry(ctx, prov.Teardown, origConnInfo); err != nil {
+			log.Printf(
+				"[ERROR] %s: teardown of provisioner %s failed: %s",
+				n.Info.Id, prov.Type, err)
+		}
+	}
+}
+
+// runRetry runs a single provisioner, and retries it when it fails if it
+// has a retry config, see config.ProvisionerRetry. A dry run isn't retried.
+func (n *EvalApplyProvisioners) runRetry(
+	ctx EvalContext,
+	prov *config.Provisioner,
+	origConnInfo map[string]string) error {
+	if prov.Retry == nil || n.DryRun {
+		return n.run(ctx, prov, origConnInfo)
+	}
+
+	attempts := prov.Retry.MaxAttempts
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = n.run(ctx, prov, origConnInfo)
+		if err == nil || attempt >= attempts {
+			break
+		}
+
+		delay, derr := prov.Retry.DelayDuration(attempt)
+		if derr != nil {
+			return fmt.Errorf("%s: provisioner %s: retry %s",
+				n.Info.Id, prov.Type, derr)
+		}
+
+		// Show the retry in the output of the provisioner
+		msg := fmt.Sprintf("Attempt %d of %d failed, retrying in %s: %s",
+			attempt, attempts, delay, err)
+		log.Printf("[WARN] %s: %s: %s", n.Info.Id, prov.Type, msg)
+		ctx.Hook(func(h Hook) (HookAction, error) {
+			h.ProvisionOutput(n.Info, prov.Type, msg)
+			return HookActionContinue, nil
+		})
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Stopped():
 			return err
 		}
+	}
+	if err != nil && attempts > 1 {
+		return fmt.Errorf(
+			"%s failed after %d attempts: %s", prov.Type, attempts, err)
+	}
 
-		// Merge the connection information
-		overlay := make(map[string]string)
-		if origConnInfo != nil {
-			for k, v := range origConnInfo {
-				overlay[k] = v
-			}
+	return err
+}
+
+// run runs a single provisioner.
+func (n *EvalApplyProvisioners) run(
+	ctx EvalContext,
+	prov *config.Provisioner,
+	origConnInfo map[string]string) error {
+	state := *n.State
+
+	// Get the provisioner
+	provisioner := ctx.Provisioner(prov.Type)
+
+	// Interpolate the provisioner config
+	resource := n.interpResource(state)
+	provConfig, err := ctx.Interpolate(prov.RawConfig, resource)
+	if err != nil {
+		return err
+	}
+
+	// Interpolate the conn info, since it may contain variables
+	connInfo, err := ctx.Interpolate(prov.ConnInfo, resource)
+	if err != nil {
+		return err
+	}
+
+	// Merge the connection information
+	overlay := make(map[string]string)
+	if origConnInfo != nil {
+		for k, v := range origConnInfo {
+			overlay[k] = v
 		}
-		for k, v := range connInfo.Config {
-			switch vt := v.(type) {
-			case string:
-				overlay[k] = vt
-			case int64:
-				overlay[k] = strconv.FormatInt(vt, 10)
-			case int32:
-				overlay[k] = strconv.FormatInt(int64(vt), 10)
-			case int:
-				overlay[k] = strconv.FormatInt(int64(vt), 10)
-			case float32:
-				overlay[k] = strconv.FormatFloat(float64(vt), 'f', 3, 32)
-			case float64:
-				overlay[k] = strconv.FormatFloat(vt, 'f', 3, 64)
-			case bool:
-				overlay[k] = strconv.FormatBool(vt)
-			default:
-				overlay[k] = fmt.Sprintf("%v", vt)
-			}
+	}
+	for k, v := range connInfo.Config {
+		switch vt := v.(type) {
+		case string:
+			overlay[k] = vt
+		case int64:
+			overlay[k] = strconv.FormatInt(vt, 10)
+		case int32:
+			overlay[k] = strconv.FormatInt(int64(vt), 10)
+		case int:
+			overlay[k] = strconv.FormatInt(int64(vt), 10)
+		case float32:
+			overlay[k] = strconv.FormatFloat(float64(vt), 'f', 3, 32)
+		case float64:
+			overlay[k] = strconv.FormatFloat(vt, 'f', 3, 64)
+		case bool:
+			overlay[k] = strconv.FormatBool(vt)
+		default:
+			overlay[k] = fmt.Sprintf("%v", vt)
 		}
-		state.Ephemeral.ConnInfo = overlay
+	}
+	state.Ephemeral.ConnInfo = overlay
 
-		{
-			// Call pre hook
-			err := ctx.Hook(func(h Hook) (HookAction, error) {
-				return h.PreProvision(n.Info, prov.Type)
-			})
-			if err != nil {
-				return err
-			}
+	// A dry run doesn't provision, so it doesn't call the hooks
+	if !n.DryRun {
+		// Call pre hook
+		err := ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PreProvision(n.Info, prov.Type)
+		})
+		if err != nil {
+			return err
 		}
+	}
+
+	// Secrets the provisioner was given must never be in the output
+	var secrets map[string]string
+	if n.InterpResource != nil {
+		secrets = n.InterpResource.Secrets
+	}
 
-		// The output function
-		outputFn := func(msg string) {
+	// The output function. Each line is output on its own, so with the
+	// output of several instances provisioned at once every line is still
+	// tagged with the instance it's from.
+	outputFn := func(msg string) {
+		msg = redactSecrets(msg, secrets)
+		for _, line := range strings.Split(strings.TrimRight(msg, "\r\n"), "\n") {
+			line = strings.TrimRight(line, "\r")
 			ctx.Hook(func(h Hook) (HookAction, error) {
-				h.ProvisionOutput(n.Info, prov.Type, msg)
+				h.ProvisionOutput(n.Info, prov.Type, line)
 				return HookActionContinue, nil
 			})
 		}
+	}
 
-		// Invoke the Provisioner
-		output := CallbackUIOutput{OutputFn: outputFn}
-		if err := provisioner.Apply(&output, state, provConfig); err != nil {
-			return err
+	// Invoke the Provisioner
+	output := CallbackUIOutput{OutputFn: outputFn}
+	if n.DryRun {
+		if err := n.check(&output, provisioner, state, provConfig); err != nil {
+			return fmt.Errorf("%s: %s: %s",
+				n.Info.Id, prov.Type, redactSecrets(err.Error(), secrets))
+		}
+	} else if ctx.DryRun() {
+		// The resource is only projected in a dry run apply, so there is
+		// nothing to provision
+		log.Printf(
+			"[INFO] apply: %s: dry run, skipping provisioner %s",
+			n.Info.logId(), prov.Type)
+	} else if err := provisioner.Apply(&output, state, provConfig); err != nil {
+		if len(secrets) > 0 {
+			err = errors.New(redactSecrets(err.Error(), secrets))
 		}
 
-		{
-			// Call post hook
-			err := ctx.Hook(func(h Hook) (HookAction, error) {
-				return h.PostProvision(n.Info, prov.Type)
-			})
-			if err != nil {
-				return err
-			}
+		return err
+	}
+
+	if !n.DryRun {
+		// Call post hook
+		err := ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PostProvision(n.Info, prov.Type)
+		})
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
+}
+
+// check is the dry run version of calling Apply on the provisioner.
+func (n *EvalApplyProvisioners) check(
+	output UIOutput,
+	provisioner ResourceProvisioner,
+	state *InstanceState,
+	c *ResourceConfig) error {
+	checker, ok := provisioner.(ResourceProvisionerChecker)
+	if !ok {
+		output.Output("This provisioner can't be checked without running it, skipping")
+		return nil
+	}
 
+	return checker.Check(output, state, c)
 }
@@ -0,0 +1,58 @@
+package terraform
+
+import (
+	"log"
+	"time"
+)
+
+// applyTransientRetries is how many times the apply of a resource is
+// retried when it fails with a transient error, see ApplyErrorTransient.
+const applyTransientRetries = 3
+
+// applyRetryDelay is how long the first retry of an apply waits, each
+// retry after it waits twice as long as the one before. It is a variable
+// so it can be changed in tests.
+var applyRetryDelay = 5 * time.Second
+
+// applyWithRetry calls apply, and calls it again up to retries times for
+// as long as it fails with a transient error. A transient error means the
+// apply didn't change anything, so each retry starts again from a copy of
+// the state from before the first try, in case the provider changed it in
+// place. The retries are given up if the walk is stopped.
+func applyWithRetry(
+	ctx EvalContext,
+	info *InstanceInfo,
+	retries int,
+	state *InstanceState,
+	apply func(*InstanceState) (*InstanceState, error)) (*InstanceState, error) {
+	var orig *InstanceState
+	if retries > 0 {
+		orig = state.deepcopy()
+	}
+
+	delay := applyRetryDelay
+	for attempt := 1; ; attempt++ {
+		result, err := apply(state)
+		if err == nil || ApplyErrorClassOf(err) != ApplyErrorTransient {
+			return result, err
+		}
+		if attempt > retries {
+			log.Printf(
+				"[WARN] apply: %s: transient error, giving up after %d tries",
+				info.logId(), attempt)
+			return result, err
+		}
+
+		log.Printf(
+			"[WARN] apply: %s: transient error, retrying in %s (%d of %d): %s",
+			info.logId(), delay, attempt, retries, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Stopped():
+			return result, err
+		}
+
+		state = orig.deepcopy()
+		delay *= 2
+	}
+}
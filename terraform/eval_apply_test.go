@@ -0,0 +1,603 @@
+package terraform
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestEvalApply_errorClass(t *testing.T) {
+	var provider ResourceProvider = &MockResourceProvider{
+		ApplyReturnError: &ApplyError{
+			Class: ApplyErrorConfig,
+			Err:   fmt.Errorf("invalid ami"),
+		},
+	}
+
+	var state *InstanceState
+	var err error
+	var class ApplyErrorClass
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{New: "bad"},
+		},
+	}
+	node := &EvalApply{
+		Info:       &InstanceInfo{Id: "aws_instance.foo"},
+		State:      &state,
+		Diff:       &diff,
+		Provider:   &provider,
+		Output:     &state,
+		Error:      &err,
+		ErrorClass: &class,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if class != ApplyErrorConfig {
+		t.Fatalf("bad: %s", class)
+	}
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if ApplyErrorClassOf(err) != ApplyErrorConfig {
+		t.Fatalf("class should be preserved: %#v", err)
+	}
+}
+
+func TestEvalApply_customApply(t *testing.T) {
+	mock := new(MockResourceProvider)
+	var customCalled bool
+	var provider ResourceProvider = &testCustomApplyProvider{
+		MockResourceProvider: mock,
+		Type:                 "aws_instance",
+		ApplyFn: func(
+			info *InstanceInfo,
+			s *InstanceState,
+			d *InstanceDiff) (*InstanceState, error) {
+			customCalled = true
+
+			// Stopped halfway through, return what we did
+			return &InstanceState{ID: "foo"}, fmt.Errorf("failed to start")
+		},
+	}
+
+	var state *InstanceState
+	var err error
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{New: "bar"},
+		},
+	}
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &state,
+		Error:    &err,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !customCalled {
+		t.Fatal("custom apply should be called")
+	}
+	if mock.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if err == nil {
+		t.Fatal("should have error")
+	}
+	if state == nil || state.ID != "foo" {
+		t.Fatalf("partial state should be kept: %#v", state)
+	}
+
+	// Other resource types use the standard apply
+	mock.ApplyReturn = &InstanceState{ID: "bar"}
+	customCalled = false
+	state = nil
+	node.Info = &InstanceInfo{Id: "aws_elb.foo", Type: "aws_elb"}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if customCalled || !mock.ApplyCalled {
+		t.Fatal("apply should be called")
+	}
+}
+
+func TestEvalApply_dryRun(t *testing.T) {
+	mock := new(MockResourceProvider)
+	var provider ResourceProvider = mock
+
+	state := &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"ami":  "ami-1",
+			"size": "small",
+		},
+	}
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami":     &ResourceAttrDiff{Old: "ami-1", New: "ami-2"},
+			"address": &ResourceAttrDiff{NewComputed: true},
+		},
+	}
+	var output *InstanceState
+	var err error
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &output,
+		Error:    &err,
+		DryRun:   true,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if mock.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"id":      "foo",
+		"ami":     "ami-2",
+		"size":    "small",
+		"address": config.UnknownVariableValue,
+	}
+	if output.ID != "foo" || !reflect.DeepEqual(output.Attributes, expected) {
+		t.Fatalf("bad: %#v", output)
+	}
+	if state.Attributes["ami"] != "ami-1" {
+		t.Fatalf("state should not be changed: %#v", state)
+	}
+}
+
+func TestEvalApply_dryRunProvider(t *testing.T) {
+	mock := new(MockResourceProvider)
+	var provider ResourceProvider = &testDryRunProvider{
+		MockResourceProvider: mock,
+		DryRunApplyFn: func(
+			info *InstanceInfo,
+			s *InstanceState,
+			d *InstanceDiff) (*InstanceState, error) {
+			return &InstanceState{ID: "i-projected"}, nil
+		},
+	}
+
+	var state, output *InstanceState
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{New: "ami-2"},
+		},
+	}
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &output,
+	}
+
+	// The context is a dry run
+	ctx := &MockEvalContext{DryRunValue: true}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if mock.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if output == nil || output.ID != "i-projected" {
+		t.Fatalf("bad: %#v", output)
+	}
+}
+
+func TestProjectedState(t *testing.T) {
+	cases := map[string]struct {
+		State    *InstanceState
+		Diff     *InstanceDiff
+		Expected *InstanceState
+	}{
+		"create": {
+			nil,
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{New: "ami-1"},
+				},
+			},
+			&InstanceState{
+				ID: config.UnknownVariableValue,
+				Attributes: map[string]string{
+					"ami": "ami-1",
+				},
+			},
+		},
+
+		"replace": {
+			&InstanceState{
+				ID:         "foo",
+				Attributes: map[string]string{"ami": "ami-1"},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{
+						Old:         "ami-1",
+						New:         "ami-2",
+						RequiresNew: true,
+					},
+				},
+			},
+			&InstanceState{
+				ID: config.UnknownVariableValue,
+				Attributes: map[string]string{
+					"ami": "ami-2",
+				},
+			},
+		},
+
+		"destroy": {
+			&InstanceState{ID: "foo"},
+			&InstanceDiff{Destroy: true},
+			nil,
+		},
+	}
+
+	for k, tc := range cases {
+		actual := ProjectedState(tc.State, tc.Diff)
+		if actual == nil || tc.Expected == nil {
+			if actual != tc.Expected {
+				t.Fatalf("%s: bad: %#v", k, actual)
+			}
+			continue
+		}
+		if actual.ID != tc.Expected.ID ||
+			!reflect.DeepEqual(actual.Attributes, tc.Expected.Attributes) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
+// testDryRunProvider is a provider that implements
+// ResourceProviderDryRunner.
+type testDryRunProvider struct {
+	*MockResourceProvider
+
+	DryRunApplyFn ApplyFunc
+}
+
+func (p *testDryRunProvider) DryRunApply(
+	info *InstanceInfo,
+	s *InstanceState,
+	d *InstanceDiff) (*InstanceState, error) {
+	return p.DryRunApplyFn(info, s, d)
+}
+
+func TestEvalApply_timeout(t *testing.T) {
+	mock := new(MockResourceProvider)
+	provider := &testCancelApplyProvider{
+		MockResourceProvider: mock,
+		CancelCh:             make(chan struct{}),
+	}
+	mock.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		// Hang until cancelled, and return what we did
+		<-provider.CancelCh
+		return &InstanceState{ID: "foo"}, fmt.Errorf("cancelled")
+	}
+
+	var p ResourceProvider = provider
+	var state *InstanceState
+	var err error
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{New: "bar"},
+		},
+	}
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &p,
+		Output:   &state,
+		Error:    &err,
+		Timeouts: &config.ResourceTimeouts{
+			Create: "10ms",
+			Update: "1h",
+		},
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !provider.CancelApplyCalled {
+		t.Fatal("apply should be cancelled")
+	}
+	if err == nil || !strings.Contains(err.Error(), "create timed out after") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("bad: %s", err)
+	}
+	if state == nil || state.ID != "foo" {
+		t.Fatalf("partial state should be kept: %#v", state)
+	}
+}
+
+func TestEvalApply_timeoutNotCancelled(t *testing.T) {
+	old := applyCancelGrace
+	applyCancelGrace = 10 * time.Millisecond
+	defer func() { applyCancelGrace = old }()
+
+	// The apply can't be cancelled and returns long after the timeout,
+	// what it did must still be recorded.
+	var provider ResourceProvider = &MockResourceProvider{
+		ApplyFn: func(
+			info *InstanceInfo,
+			s *InstanceState,
+			d *InstanceDiff) (*InstanceState, error) {
+			time.Sleep(50 * time.Millisecond)
+			return &InstanceState{ID: "baz"}, nil
+		},
+	}
+
+	state := &InstanceState{ID: "bar"}
+	var err error
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+		},
+	}
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &state,
+		Error:    &err,
+		Timeouts: &config.ResourceTimeouts{Update: "10ms"},
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "update timed out after") {
+		t.Fatalf("bad: %s", err)
+	}
+	if state == nil || state.ID != "baz" {
+		t.Fatalf("state from the apply should be kept: %#v", state)
+	}
+}
+
+func TestEvalPreApply(t *testing.T) {
+	h := new(MockHook)
+	ctx := new(MockEvalContext)
+	ctx.HookHook = h
+
+	var state *InstanceState
+	diff := &InstanceDiff{Destroy: true}
+	node := &EvalPreApply{
+		Info:  &InstanceInfo{Id: "aws_instance.foo"},
+		State: &state,
+		Diff:  &diff,
+	}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !h.PreApplyCalled {
+		t.Fatal("should be called")
+	}
+	if h.PreApplyState == nil || h.PreApplyState.ID != "" {
+		t.Fatalf("bad: %#v", h.PreApplyState)
+	}
+	if h.PreApplyDiff != diff {
+		t.Fatalf("bad: %#v", h.PreApplyDiff)
+	}
+	if state != nil {
+		t.Fatalf("shouldn't change the state: %#v", state)
+	}
+}
+
+func TestEvalPreApply_empty(t *testing.T) {
+	h := new(MockHook)
+	ctx := new(MockEvalContext)
+	ctx.HookHook = h
+
+	state := &InstanceState{ID: "foo"}
+	diff := new(InstanceDiff)
+	node := &EvalPreApply{
+		Info:  &InstanceInfo{Id: "aws_instance.foo"},
+		State: &state,
+		Diff:  &diff,
+	}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if h.PreApplyCalled {
+		t.Fatal("shouldn't be called for an empty diff")
+	}
+}
+
+func TestApplyOperation(t *testing.T) {
+	cases := map[string]struct {
+		State    *InstanceState
+		Diff     *InstanceDiff
+		Expected string
+	}{
+		"create": {
+			State: nil,
+			Diff: &InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{New: "bar"},
+				},
+			},
+			Expected: applyOpCreate,
+		},
+		"replace": {
+			State: &InstanceState{ID: "foo"},
+			Diff: &InstanceDiff{
+				Destroy: true,
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{Old: "foo", New: "bar", RequiresNew: true},
+				},
+			},
+			Expected: applyOpCreate,
+		},
+		"update": {
+			State: &InstanceState{ID: "foo"},
+			Diff: &InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+				},
+			},
+			Expected: applyOpUpdate,
+		},
+		"delete": {
+			State:    &InstanceState{ID: "foo"},
+			Diff:     &InstanceDiff{Destroy: true},
+			Expected: applyOpDelete,
+		},
+	}
+
+	for k, tc := range cases {
+		if actual := applyOperation(tc.State, tc.Diff); actual != tc.Expected {
+			t.Fatalf("%s: bad: %s", k, actual)
+		}
+	}
+}
+
+type testCancelApplyProvider struct {
+	*MockResourceProvider
+
+	CancelCh          chan struct{}
+	CancelApplyCalled bool
+}
+
+func (p *testCancelApplyProvider) CancelApply(*InstanceInfo) error {
+	p.CancelApplyCalled = true
+	close(p.CancelCh)
+	return nil
+}
+
+type testCustomApplyProvider struct {
+	*MockResourceProvider
+
+	Type    string
+	ApplyFn ApplyFunc
+}
+
+func (p *testCustomApplyProvider) CustomApply(t string) ApplyFunc {
+	if t == p.Type {
+		return p.ApplyFn
+	}
+
+	return nil
+}
+
+func TestEvalApplyRecreate(t *testing.T) {
+	var destroyed []string
+	var destroyErr error
+	var provider ResourceProvider = &MockResourceProvider{
+		ApplyFn: func(
+			info *InstanceInfo,
+			s *InstanceState,
+			d *InstanceDiff) (*InstanceState, error) {
+			if d.Destroy {
+				destroyed = append(destroyed, s.ID)
+				return nil, destroyErr
+			}
+
+			return &InstanceState{ID: "new"}, nil
+		},
+		DiffReturn: &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"ami": &ResourceAttrDiff{New: "foo"},
+			},
+		},
+	}
+	ctx := &MockEvalContext{
+		TaintErrorPatternsPatterns: []*regexp.Regexp{
+			regexp.MustCompile("terminated state"),
+		},
+	}
+
+	cases := []struct {
+		Err                 error
+		CreateBeforeDestroy bool
+		DestroyErr          error
+		State               string
+		Deposed             string
+		Destroyed           []string
+		Error               bool
+	}{
+		// Errors that don't match fail as usual
+		{fmt.Errorf("invalid ami"), false, nil, "broken", "", nil, true},
+
+		// The broken instance is destroyed before it is recreated
+		{fmt.Errorf("instance is in terminated state"), false, nil, "new", "", []string{"broken"}, false},
+
+		// The broken instance is destroyed once it is recreated
+		{fmt.Errorf("instance is in terminated state"), true, nil, "new", "", []string{"broken"}, false},
+
+		// Unless that fails, then it is deposed
+		{fmt.Errorf("instance is in terminated state"), true, fmt.Errorf("busy"), "new", "broken", []string{"broken"}, true},
+	}
+
+	for i, tc := range cases {
+		destroyed = nil
+		destroyErr = tc.DestroyErr
+		state := &InstanceState{ID: "broken"}
+		config := testResourceConfig(t, map[string]interface{}{})
+		var deposed *InstanceState
+		var createNew, tainted bool
+		err := tc.Err
+		node := &EvalApplyRecreate{
+			Info:                &InstanceInfo{Id: "aws_instance.foo"},
+			Config:              &config,
+			Provider:            &provider,
+			State:               &state,
+			CreateBeforeDestroy: tc.CreateBeforeDestroy,
+			CreateNew:           &createNew,
+			Deposed:             &deposed,
+			Tainted:             &tainted,
+			Error:               &err,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		if (err != nil) != tc.Error {
+			t.Fatalf("%d: bad error: %s", i, err)
+		}
+		if state.ID != tc.State {
+			t.Fatalf("%d: bad state: %s", i, state.ID)
+		}
+		if (deposed != nil) != (tc.Deposed != "") ||
+			(deposed != nil && deposed.ID != tc.Deposed) {
+			t.Fatalf("%d: bad deposed: %#v", i, deposed)
+		}
+		if !reflect.DeepEqual(destroyed, tc.Destroyed) {
+			t.Fatalf("%d: bad destroyed: %#v", i, destroyed)
+		}
+		if tainted {
+			t.Fatalf("%d: should not be tainted", i)
+		}
+	}
+}
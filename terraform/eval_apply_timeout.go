@@ -0,0 +1,133 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/config"
+)
+
+// applyCancelGrace is how long an apply that timed out has to return
+// once it is cancelled before a warning that it is still running is
+// logged. It is a variable so it can be changed in tests.
+var applyCancelGrace = 30 * time.Second
+
+const (
+	applyOpCreate = "create"
+	applyOpUpdate = "update"
+	applyOpDelete = "delete"
+)
+
+// applyOperation returns the operation that applying the diff to the
+// state is: a destroy only is a delete, a new or replaced instance is a
+// create, and anything else is an update.
+func applyOperation(state *InstanceState, diff *InstanceDiff) string {
+	switch {
+	case diff.Destroy && len(diff.Attributes) == 0:
+		return applyOpDelete
+	case state == nil || state.ID == "" || diff.RequiresNew():
+		return applyOpCreate
+	default:
+		return applyOpUpdate
+	}
+}
+
+// applyTimeout returns the timeout of the given operation, or zero if it
+// has none.
+func applyTimeout(t *config.ResourceTimeouts, op string) (time.Duration, error) {
+	if t == nil {
+		return 0, nil
+	}
+
+	var v string
+	switch op {
+	case applyOpCreate:
+		v = t.Create
+	case applyOpUpdate:
+		v = t.Update
+	case applyOpDelete:
+		v = t.Delete
+	}
+	if v == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s timeout: %s", op, err)
+	}
+
+	return d, nil
+}
+
+// applyWithTimeout calls the apply function, and cancels it if it runs
+// past the timeout and the provider can cancel it, see
+// ResourceProviderApplyCanceler. The state the apply returns is kept along
+// with the timeout error.
+//
+// An apply is never abandoned, since whatever it creates after that would
+// never be recorded: if it doesn't return once cancelled, it is waited on
+// for as long as it runs. If Terraform is killed meanwhile, the resource
+// is left pending, see ResourceState.Pending, and is refreshed before it
+// is planned again.
+func applyWithTimeout(
+	info *InstanceInfo,
+	provider ResourceProvider,
+	apply ApplyFunc,
+	op string,
+	timeout time.Duration,
+	state *InstanceState,
+	diff *InstanceDiff) (*InstanceState, error) {
+	if timeout <= 0 {
+		return apply(info, state, diff)
+	}
+
+	type applyResult struct {
+		State *InstanceState
+		Err   error
+	}
+	resultCh := make(chan applyResult, 1)
+	start := time.Now()
+	go func() {
+		s, err := apply(info, state, diff)
+		resultCh <- applyResult{State: s, Err: err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		return r.State, r.Err
+	case <-time.After(timeout):
+	}
+
+	log.Printf(
+		"[WARN] apply: %s: %s timed out after %s, cancelling",
+		info.logId(), op, timeout)
+	if c, ok := provider.(ResourceProviderApplyCanceler); ok {
+		if err := c.CancelApply(info); err != nil {
+			log.Printf(
+				"[WARN] apply: %s: error cancelling the apply: %s",
+				info.logId(), err)
+		}
+	}
+
+	var r applyResult
+	select {
+	case r = <-resultCh:
+	case <-time.After(applyCancelGrace):
+		log.Printf(
+			"[WARN] apply: %s: %s couldn't be cancelled, waiting for it "+
+				"to return", info.logId(), op)
+		r = <-resultCh
+	}
+
+	err := fmt.Errorf(
+		"%s timed out after %s, the timeout is %s",
+		op, time.Since(start), timeout)
+	if r.Err != nil {
+		err = multierror.Append(err, r.Err)
+	}
+
+	return r.State, err
+}
@@ -0,0 +1,44 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+)
+
+// EvalVerifyCanary is an EvalNode implementation that verifies the canary
+// instance of a resource with the VerifyCanary hooks once it is applied,
+// see config.ResourceLifecycle.Canary. The rest of the instances depend on
+// the node this is in, so they're only applied if the canary passes.
+//
+// The hooks are only called if there is anything left to change after
+// the canary, like the pause of EvalRolloutGate.
+type EvalVerifyCanary struct {
+	Info  *InstanceInfo
+	State **InstanceState
+
+	// After are the state IDs of the instances that wait on the canary.
+	After []string
+}
+
+func (n *EvalVerifyCanary) Eval(ctx EvalContext) (interface{}, error) {
+	if !instancesChanged(ctx, n.After) {
+		return nil, nil
+	}
+
+	log.Printf("[INFO] %s: verifying canary", n.Info.Id)
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.VerifyCanary(n.Info, *n.State)
+	})
+
+	// Halting fails the canary too. An early exit on its own would let
+	// the instances that wait on it go ahead.
+	if _, ok := err.(EvalEarlyExitError); ok {
+		return nil, fmt.Errorf("%s: canary failed verification", n.Info.Id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%s: canary failed verification: %s", n.Info.Id, err)
+	}
+
+	return nil, nil
+}
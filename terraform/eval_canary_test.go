@@ -0,0 +1,68 @@
+package terraform
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestEvalVerifyCanary(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo.1": &InstanceDiff{Destroy: true},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		After     []string
+		HookError error
+		Verify    bool
+		Err       bool
+	}{
+		{[]string{"aws_instance.foo.1"}, nil, true, false},
+		{[]string{"aws_instance.foo.1"}, errors.New("unhealthy"), true, true},
+
+		// Halting fails the canary too
+		{[]string{"aws_instance.foo.1"}, EvalEarlyExitError{}, true, true},
+
+		// Nothing left to change after the canary
+		{[]string{"aws_instance.foo.2"}, nil, false, false},
+	}
+
+	for i, tc := range cases {
+		hook := new(MockHook)
+		hook.VerifyCanaryError = tc.HookError
+		ctx := &MockEvalContext{
+			HookHook: hook,
+			PathPath: rootModulePath,
+			DiffDiff: diff,
+			DiffLock: new(sync.RWMutex),
+		}
+
+		state := &InstanceState{ID: "foo"}
+		n := &EvalVerifyCanary{
+			Info:  &InstanceInfo{Id: "aws_instance.foo.0"},
+			State: &state,
+			After: tc.After,
+		}
+		_, err := n.Eval(ctx)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if _, ok := err.(EvalEarlyExitError); ok {
+			t.Fatalf("%d: should be a real error", i)
+		}
+
+		if hook.VerifyCanaryCalled != tc.Verify {
+			t.Fatalf("%d: bad: %#v", i, hook)
+		}
+		if tc.Verify && hook.VerifyCanaryState != state {
+			t.Fatalf("%d: bad: %#v", i, hook.VerifyCanaryState)
+		}
+	}
+}
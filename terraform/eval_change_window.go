@@ -0,0 +1,180 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// changeWindowNow returns the current time for the change windows. It is
+// a variable so it can be changed in tests.
+var changeWindowNow = time.Now
+
+// EvalQueueChange is an EvalNode implementation that queues the diff of a
+// resource instead of applying it if the change window of the resource,
+// see config.ChangeWindow, isn't open. The diff is written back with its
+// ScheduledFor set to when the window opens and the apply of the resource
+// stops there. The queued diffs are left in the diff of the context, see
+// Context.QueuedPlan.
+//
+// The change is queued too if the change of one of the resources in
+// Dependencies was queued by this apply, until that change is scheduled
+// for, since the change may need it. The queue propagates this way to
+// the dependents of the dependents, whether they have a window or not.
+//
+// If a queued diff is applied again once the window is open, it is
+// checked against the state first. If the state already has the change,
+// such as from an earlier resume, the diff is dropped instead of applied,
+// so resuming is idempotent.
+type EvalQueueChange struct {
+	Name         string
+	Window       string
+	Diff         **InstanceDiff
+	Dependencies []string
+}
+
+func (n *EvalQueueChange) Eval(ctx EvalContext) (interface{}, error) {
+	diff := *n.Diff
+	if diff.Empty() {
+		return nil, nil
+	}
+
+	now := changeWindowNow().UTC()
+	upstream, upstreamName := n.queuedDependency(ctx, now)
+	if n.Window == "" && upstream.IsZero() && diff.ScheduledFor.IsZero() {
+		return nil, nil
+	}
+
+	var w *config.ChangeWindow
+	if n.Window != "" {
+		var err error
+		if w, err = config.ParseChangeWindow(n.Window); err != nil {
+			return nil, fmt.Errorf("%s: %s", n.Name, err)
+		}
+	}
+
+	if upstream.IsZero() && (w == nil || w.Contains(now)) {
+		if diff.ScheduledFor.IsZero() {
+			return nil, nil
+		}
+
+		var state *InstanceState
+		read := &EvalReadState{Name: n.Name, Output: &state}
+		if _, err := read.Eval(ctx); err != nil {
+			return nil, err
+		}
+		if !queuedDiffApplied(state, diff) {
+			log.Printf("[INFO] %s: applying the change queued until %s",
+				n.Name, diff.ScheduledFor.Format(time.RFC3339))
+			return nil, nil
+		}
+
+		log.Printf("[INFO] %s: the queued change is already applied", n.Name)
+		write := &EvalWriteDiff{Name: n.Name}
+		if _, err := write.Eval(ctx); err != nil {
+			return nil, err
+		}
+
+		return nil, EvalEarlyExitError{}
+	}
+
+	diff = diff.deepcopy()
+	if upstream.IsZero() {
+		diff.ScheduledFor = w.Next(now)
+		log.Printf(
+			"[INFO] %s: outside of the change window %s, queued until %s",
+			n.Name, w, diff.ScheduledFor.Format(time.RFC3339))
+	} else {
+		diff.ScheduledFor = upstream
+		if w != nil && !w.Contains(upstream) {
+			diff.ScheduledFor = w.Next(upstream)
+		}
+		log.Printf(
+			"[INFO] %s: the change of %s is queued, queued until %s",
+			n.Name, upstreamName, diff.ScheduledFor.Format(time.RFC3339))
+	}
+
+	write := &EvalWriteDiff{Name: n.Name, Diff: &diff}
+	if _, err := write.Eval(ctx); err != nil {
+		return nil, err
+	}
+
+	return nil, EvalEarlyExitError{}
+}
+
+// queuedDependency returns the latest time that a change of the resources
+// in Dependencies was queued until by this apply, and the name of its
+// instance, or the zero time if none was. The changes that are resumed
+// were queued until a time that has passed.
+func (n *EvalQueueChange) queuedDependency(
+	ctx EvalContext, now time.Time) (time.Time, string) {
+	var result time.Time
+	var name string
+	if len(n.Dependencies) == 0 {
+		return result, name
+	}
+
+	diff, lock := ctx.Diff()
+	if diff == nil {
+		return result, name
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	modDiff := diff.ModuleByPath(ctx.Path())
+	if modDiff == nil {
+		return result, name
+	}
+
+	for _, id := range n.Dependencies {
+		for k, d := range modDiff.Resources {
+			// The diffs of counted resources are per instance
+			if k != id && !strings.HasPrefix(k, id+".") {
+				continue
+			}
+
+			if d.ScheduledFor.After(now) && d.ScheduledFor.After(result) {
+				result, name = d.ScheduledFor, k
+			}
+		}
+	}
+
+	return result, name
+}
+
+// queuedDiffApplied returns true if the state already has all the changes
+// of the diff.
+func queuedDiffApplied(state *InstanceState, diff *InstanceDiff) bool {
+	exists := state != nil && state.ID != ""
+	if diff.Destroy && !diff.RequiresNew() {
+		return !exists
+	}
+	if !exists || diff.Provision {
+		return false
+	}
+
+	for k, ad := range diff.Attributes {
+		if ad.NewComputed || ad.Type == DiffAttrOutput {
+			continue
+		}
+
+		v, ok := state.Attributes[k]
+		if ad.NewRemoved {
+			if ok {
+				return false
+			}
+
+			continue
+		}
+
+		if !ok || v != ad.New {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,43 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-version"
+)
+
+// EvalCheckCoreVersion is an EvalNode implementation that checks that the
+// version of Terraform meets the required_version constraint of a module.
+// A constraint that can't be parsed fails too, rather than being ignored.
+//
+// Only Version is compared, without VersionPrerelease, so that a
+// development build meets the constraints of the release it will be.
+type EvalCheckCoreVersion struct {
+	// Module is the name of the module with the constraint, such as
+	// "root" or "module.foo", for the errors.
+	Module string
+
+	Constraint string
+}
+
+func (n *EvalCheckCoreVersion) Eval(ctx EvalContext) (interface{}, error) {
+	cs, err := version.NewConstraint(n.Constraint)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%s: invalid required_version %q: %s", n.Module, n.Constraint, err)
+	}
+
+	v, err := version.NewVersion(Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cs.Check(v) {
+		return nil, fmt.Errorf(
+			"%s: the configuration requires Terraform %s, but this is "+
+				"Terraform %s. Use a version that meets the constraint.",
+			n.Module, n.Constraint, Version)
+	}
+
+	return nil, nil
+}
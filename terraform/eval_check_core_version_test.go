@@ -0,0 +1,38 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalCheckCoreVersion(t *testing.T) {
+	cases := map[string]string{
+		// The prerelease isn't compared
+		">= " + Version: "",
+		"= " + Version:  "",
+		">= 0.1.0":      "",
+		"> 0.1, < 100":  "",
+		"< 0.1.0":       "requires Terraform < 0.1.0",
+		"> 100":         "requires Terraform > 100",
+		"later":         "invalid required_version",
+		"":              "invalid required_version",
+	}
+
+	for constraint, expected := range cases {
+		n := &EvalCheckCoreVersion{Module: "root", Constraint: constraint}
+		_, err := n.Eval(new(MockEvalContext))
+		if expected == "" {
+			if err != nil {
+				t.Fatalf("%q: err: %s", constraint, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%q: bad: %v", constraint, err)
+		}
+		if !strings.HasPrefix(err.Error(), "root: ") {
+			t.Fatalf("%q: bad: %s", constraint, err)
+		}
+	}
+}
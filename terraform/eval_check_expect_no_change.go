@@ -0,0 +1,59 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalCheckExpectNoChange is an EvalNode implementation that returns an
+// error if a resource has ExpectNoChange configured and the diff has any
+// change at all for the resource. The error lists the changes.
+type EvalCheckExpectNoChange struct {
+	Resource *config.Resource
+	Diff     **InstanceDiff
+}
+
+func (n *EvalCheckExpectNoChange) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Resource == nil || !n.Resource.Lifecycle.ExpectNoChange {
+		return nil, nil
+	}
+	if n.Diff == nil || (*n.Diff).Empty() {
+		return nil, nil
+	}
+
+	diff := *n.Diff
+
+	var buf bytes.Buffer
+	if diff.Destroy {
+		buf.WriteString("\n  (destroy)")
+	}
+	if diff.Provision {
+		buf.WriteString("\n  (provisioners triggered)")
+	}
+
+	keys := make([]string, 0, len(diff.Attributes))
+	for k := range diff.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ad := diff.Attributes[k]
+
+		v := fmt.Sprintf("%q", ad.New)
+		if ad.NewComputed {
+			v = "<computed>"
+		} else if ad.NewRemoved {
+			v = "<removed>"
+		}
+
+		buf.WriteString(fmt.Sprintf("\n  %s: %q => %s", k, ad.Old, v))
+	}
+
+	return nil, fmt.Errorf(expectNoChangeErrStr, n.Resource.Id(), buf.String())
+}
+
+const expectNoChangeErrStr = `%s: the plan would change this resource, but it currently has lifecycle.expect_no_change set to true. The unexpected changes are:%s`
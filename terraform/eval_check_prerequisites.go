@@ -0,0 +1,61 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// EvalCheckPrerequisites is an EvalNode implementation that runs the
+// prerequisite checks with the given names, registered on the context,
+// for a resource instance with its interpolated config. It errors with
+// the message of every check that fails, so they can all be fixed at
+// once.
+//
+// The checks run in the preflight walk of an apply, before anything is
+// applied, see Context.Apply.
+type EvalCheckPrerequisites struct {
+	Info   *InstanceInfo
+	Checks []string
+	Config **ResourceConfig
+}
+
+func (n *EvalCheckPrerequisites) Eval(ctx EvalContext) (interface{}, error) {
+	checks := ctx.PrerequisiteChecks()
+
+	var err error
+	for _, name := range n.Checks {
+		check, ok := checks[name]
+		if !ok {
+			err = multierror.Append(err, fmt.Errorf(
+				"%s: prerequisite check '%s' isn't registered",
+				n.Info.HumanId(), name))
+			continue
+		}
+
+		result, checkErr := check.Check(n.Info, *n.Config)
+		if checkErr != nil {
+			err = multierror.Append(err, fmt.Errorf(
+				"%s: error running prerequisite check '%s': %s",
+				n.Info.HumanId(), name, checkErr))
+			continue
+		}
+		if result == nil || !result.Passed {
+			message := "no message given"
+			if result != nil && result.Message != "" {
+				message = result.Message
+			}
+
+			err = multierror.Append(err, fmt.Errorf(
+				"%s: prerequisite check '%s' failed: %s",
+				n.Info.HumanId(), name, message))
+			continue
+		}
+
+		log.Printf(
+			"[DEBUG] %s: prerequisite check '%s' passed", n.Info.HumanId(), name)
+	}
+
+	return nil, err
+}
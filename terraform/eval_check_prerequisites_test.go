@@ -0,0 +1,81 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvalCheckPrerequisites(t *testing.T) {
+	cases := map[string]struct {
+		Checks []string
+		Result *PrerequisiteCheckResult
+		Err    error
+		Called bool
+		Errors string
+	}{
+		"passed": {
+			Checks: []string{"dns"},
+			Result: &PrerequisiteCheckResult{Passed: true},
+			Called: true,
+		},
+		"failed": {
+			Checks: []string{"dns"},
+			Result: &PrerequisiteCheckResult{Message: "zone isn't delegated"},
+			Called: true,
+			Errors: "prerequisite check 'dns' failed: zone isn't delegated",
+		},
+		"no message": {
+			Checks: []string{"dns"},
+			Called: true,
+			Errors: "prerequisite check 'dns' failed: no message given",
+		},
+		"error": {
+			Checks: []string{"dns"},
+			Err:    fmt.Errorf("unreachable"),
+			Called: true,
+			Errors: "error running prerequisite check 'dns': unreachable",
+		},
+		"not registered": {
+			Checks: []string{"quota"},
+			Errors: "prerequisite check 'quota' isn't registered",
+		},
+	}
+
+	for k, tc := range cases {
+		check := &MockPrerequisiteCheck{
+			CheckReturn:      tc.Result,
+			CheckReturnError: tc.Err,
+		}
+		ctx := &MockEvalContext{
+			PrerequisiteChecksChecks: map[string]PrerequisiteCheck{
+				"dns": check,
+			},
+		}
+
+		config := testResourceConfig(t, map[string]interface{}{
+			"zone": "example.com",
+		})
+		node := &EvalCheckPrerequisites{
+			Info:   &InstanceInfo{Id: "aws_instance.foo"},
+			Checks: tc.Checks,
+			Config: &config,
+		}
+		_, err := node.Eval(ctx)
+		if check.CheckCalled != tc.Called {
+			t.Fatalf("%s: bad called: %#v", k, check.CheckCalled)
+		}
+		if tc.Called && check.CheckConfig != config {
+			t.Fatalf("%s: bad config: %#v", k, check.CheckConfig)
+		}
+		if tc.Errors == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.Errors) {
+			t.Fatalf("%s: bad err: %s", k, err)
+		}
+	}
+}
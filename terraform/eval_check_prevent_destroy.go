@@ -2,6 +2,8 @@ package terraform
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/hashicorp/terraform/config"
 )
@@ -29,4 +31,50 @@ func (n *EvalCheckPreventDestroy) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// EvalCheckPreventDestroyOnReplace is an EvalNode implementation that
+// returns an error if a resource has PreventDestroy configured and the
+// diff would replace the resource, since replacing it destroys it too.
+// Unlike EvalCheckPreventDestroy, it needs the whole diff rather than a
+// diff filtered to the destroy, so the error can name the attributes
+// that force the new resource.
+type EvalCheckPreventDestroyOnReplace struct {
+	Resource *config.Resource
+	Diff     **InstanceDiff
+}
+
+func (n *EvalCheckPreventDestroyOnReplace) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Diff == nil || *n.Diff == nil || n.Resource == nil {
+		return nil, nil
+	}
+
+	diff := *n.Diff
+	if !n.Resource.Lifecycle.PreventDestroy || !diff.RequiresNew() {
+		return nil, nil
+	}
+
+	// The computed ID of the new resource doesn't force it, unless
+	// nothing else does.
+	var keys, outputs []string
+	for k, ad := range diff.Attributes {
+		if ad == nil || !ad.RequiresNew {
+			continue
+		}
+		if ad.Type == DiffAttrOutput {
+			outputs = append(outputs, k)
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		keys = outputs
+	}
+	sort.Strings(keys)
+
+	return nil, fmt.Errorf(
+		preventReplaceErrStr, n.Resource.Id(), strings.Join(keys, ", "))
+}
+
 const preventDestroyErrStr = `%s: the plan would destroy this resource, but it currently has lifecycle.prevent_destroy set to true. To avoid this error and continue with the plan, either disable lifecycle.prevent_destroy or adjust the scope of the plan using the -target flag.`
+
+const preventReplaceErrStr = `%s: the plan would replace this resource, since a change to %s forces a new resource, but it currently has lifecycle.prevent_destroy set to true. The replacement was blocked before anything was changed. To avoid this error and continue with the plan, either disable lifecycle.prevent_destroy, change the configuration so that the resource isn't replaced, or adjust the scope of the plan using the -target flag.`
@@ -0,0 +1,72 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestEvalCheckPreventDestroyOnReplace(t *testing.T) {
+	r := &config.Resource{
+		Name:      "foo",
+		Type:      "aws_instance",
+		Lifecycle: config.ResourceLifecycle{PreventDestroy: true},
+	}
+	replace := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{
+				Old:         "ami-1",
+				New:         "ami-2",
+				RequiresNew: true,
+			},
+			"id": &ResourceAttrDiff{
+				Old:         "foo",
+				NewComputed: true,
+				RequiresNew: true,
+				Type:        DiffAttrOutput,
+			},
+			"tags.Name": &ResourceAttrDiff{
+				Old: "foo",
+				New: "bar",
+			},
+		},
+	}
+
+	n := &EvalCheckPreventDestroyOnReplace{Resource: r, Diff: &replace}
+	_, err := n.Eval(new(MockEvalContext))
+	expected := "aws_instance.foo: the plan would replace this resource, " +
+		"since a change to ami forces a new resource"
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Updates and explicit destroys are left to EvalCheckPreventDestroy
+	diffs := []*InstanceDiff{
+		nil,
+		&InstanceDiff{Destroy: true},
+		&InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"tags.Name": &ResourceAttrDiff{
+					Old: "foo",
+					New: "bar",
+				},
+			},
+		},
+	}
+	for i, diff := range diffs {
+		n := &EvalCheckPreventDestroyOnReplace{Resource: r, Diff: &diff}
+		if _, err := n.Eval(new(MockEvalContext)); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+
+	// Without prevent_destroy the resource can be replaced
+	n = &EvalCheckPreventDestroyOnReplace{
+		Resource: &config.Resource{Name: "foo", Type: "aws_instance"},
+		Diff:     &replace,
+	}
+	if _, err := n.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
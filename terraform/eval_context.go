@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"regexp"
 	"sync"
 
 	"github.com/hashicorp/terraform/config"
@@ -77,4 +78,80 @@ type EvalContext interface {
 	// State returns the global state as well as the lock that should
 	// be used to modify that state.
 	State() (*State, *sync.RWMutex)
+
+	// CorrelationId returns the correlation ID of the resource with the
+	// given name within this context's path. The ID is generated the first
+	// time it is requested during a walk, and the same ID is returned for
+	// the rest of the walk. It is used to correlate the logs of Terraform
+	// with the logs of providers and the systems they call.
+	CorrelationId(string) string
+
+	// Policy returns the policy that changes must be approved by before
+	// they're applied, or nil if there isn't one.
+	Policy() Policy
+
+	// Stopped returns a channel that is closed when the walk is asked to
+	// stop. This is for eval nodes that block for a long time, so they
+	// can give up instead of holding up the stop.
+	Stopped() <-chan struct{}
+
+	// TaintErrorPatterns returns the patterns of apply errors that cause
+	// a resource to be tainted and recreated. See
+	// ContextOpts.TaintErrorPatterns.
+	TaintErrorPatterns() []*regexp.Regexp
+
+	// ProviderSemaphore returns the semaphore that limits the concurrent
+	// calls to an initialized provider, or nil if the provider doesn't
+	// have a limit. See ResourceProviderConcurrencyLimiter.
+	ProviderSemaphore(ResourceProvider) Semaphore
+
+	// StateCache returns the cache of reads from the state for this walk.
+	// This may be nil, in which case nothing is cached.
+	StateCache() *StateReadCache
+
+	// AttributeWatchlist returns the attributes whose changes are reported
+	// to the PostApplyWatched hook. See ContextOpts.AttributeWatchlist.
+	AttributeWatchlist() []*AttributeWatch
+
+	// ModuleBudgets returns the tracker of the resources of each module
+	// for this walk. This may be nil if there are no budgets.
+	ModuleBudgets() *ModuleBudgetTracker
+
+	// Coordinator returns the coordinator of the applies with the other
+	// deployments, or nil if there is none. See ContextOpts.Coordinator.
+	Coordinator() Coordinator
+
+	// AuditLog returns the log that the changes that are applied are
+	// written to, or nil if there is none. See ContextOpts.AuditLog.
+	AuditLog() *AuditLog
+
+	// RecoverState returns true if the instances that are corrupted in
+	// the state are rebuilt from their providers. See
+	// ContextOpts.RecoverState.
+	RecoverState() bool
+
+	// StateStream returns the stream that the writes to the state are
+	// sent to, or nil if there is none. See ContextOpts.StateStream.
+	StateStream() StateStream
+
+	// PrerequisiteChecks returns the prerequisite checks by name. See
+	// ContextOpts.PrerequisiteChecks.
+	PrerequisiteChecks() map[string]PrerequisiteCheck
+
+	// StateBackend returns the backend that the state is stored in, or
+	// nil if there is none. See ContextOpts.StateBackend.
+	StateBackend() StateBackend
+
+	// StateWriteDue records an update of the state and returns true if
+	// the state is due to be written to the StateBackend. See
+	// ContextOpts.StateWriteEvery.
+	StateWriteDue() bool
+
+	// StateWriteSequence returns the sequence that orders the writes of
+	// the state to the StateBackend, or nil if they aren't ordered.
+	StateWriteSequence() *stateWriteSequence
+
+	// DryRun returns true if the apply only projects the changes without
+	// making them. See ContextOpts.DryRun.
+	DryRun() bool
 }
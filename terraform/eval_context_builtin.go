@@ -1,8 +1,11 @@
 package terraform
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -32,6 +35,7 @@ type BuiltinEvalContext struct {
 	ProviderCache       map[string]ResourceProvider
 	ProviderConfigCache map[string]*ResourceConfig
 	ProviderInputConfig map[string]map[string]interface{}
+	ProviderSemaphores  map[ResourceProvider]Semaphore
 	ProviderLock        *sync.Mutex
 	Provisioners        map[string]ResourceProvisionerFactory
 	ProvisionerCache    map[string]ResourceProvisioner
@@ -41,6 +45,29 @@ type BuiltinEvalContext struct {
 	StateValue          *State
 	StateLock           *sync.RWMutex
 
+	// CorrelationIds is shared between all contexts of a walk and is
+	// a mapping of PATH.NAME to the correlation ID of the resource. It
+	// is protected by CorrelationIdLock.
+	CorrelationIds    map[string]string
+	CorrelationIdLock *sync.Mutex
+
+	PolicyValue Policy
+	StoppedCh   <-chan struct{}
+
+	TaintErrorPatternsValue []*regexp.Regexp
+	StateCacheValue         *StateReadCache
+	AttributeWatchlistValue []*AttributeWatch
+	ModuleBudgetsValue      *ModuleBudgetTracker
+	CoordinatorValue        Coordinator
+	AuditLogValue           *AuditLog
+	RecoverStateValue       bool
+	StateStreamValue        StateStream
+	PrerequisiteChecksValue map[string]PrerequisiteCheck
+	StateBackendValue       StateBackend
+	StateWritesValue        *stateWriteThrottle
+	StateWriteSeqValue      *stateWriteSequence
+	DryRunValue             bool
+
 	once sync.Once
 }
 
@@ -98,6 +125,17 @@ func (ctx *BuiltinEvalContext) InitProvider(n string) (ResourceProvider, error)
 	providerPath[len(providerPath)-1] = n
 
 	ctx.ProviderCache[PathCacheKey(providerPath)] = p
+
+	// Providers that advertise a concurrency limit get their own
+	// semaphore, shared by everything that calls the provider.
+	if l, ok := p.(ResourceProviderConcurrencyLimiter); ok {
+		if n := l.ConcurrencyLimit(); n > 0 {
+			log.Printf("[DEBUG] limiting provider %s to %d concurrent calls",
+				PathCacheKey(providerPath), n)
+			ctx.ProviderSemaphores[p] = NewSemaphore(n)
+		}
+	}
+
 	return p, nil
 }
 
@@ -339,10 +377,103 @@ func (ctx *BuiltinEvalContext) State() (*State, *sync.RWMutex) {
 	return ctx.StateValue, ctx.StateLock
 }
 
+func (ctx *BuiltinEvalContext) Policy() Policy {
+	return ctx.PolicyValue
+}
+
+func (ctx *BuiltinEvalContext) Stopped() <-chan struct{} {
+	return ctx.StoppedCh
+}
+
+func (ctx *BuiltinEvalContext) TaintErrorPatterns() []*regexp.Regexp {
+	return ctx.TaintErrorPatternsValue
+}
+
+func (ctx *BuiltinEvalContext) StateCache() *StateReadCache {
+	return ctx.StateCacheValue
+}
+
+func (ctx *BuiltinEvalContext) AttributeWatchlist() []*AttributeWatch {
+	return ctx.AttributeWatchlistValue
+}
+
+func (ctx *BuiltinEvalContext) ModuleBudgets() *ModuleBudgetTracker {
+	return ctx.ModuleBudgetsValue
+}
+
+func (ctx *BuiltinEvalContext) Coordinator() Coordinator {
+	return ctx.CoordinatorValue
+}
+
+func (ctx *BuiltinEvalContext) AuditLog() *AuditLog {
+	return ctx.AuditLogValue
+}
+
+func (ctx *BuiltinEvalContext) RecoverState() bool {
+	return ctx.RecoverStateValue
+}
+
+func (ctx *BuiltinEvalContext) StateStream() StateStream {
+	return ctx.StateStreamValue
+}
+
+func (ctx *BuiltinEvalContext) PrerequisiteChecks() map[string]PrerequisiteCheck {
+	return ctx.PrerequisiteChecksValue
+}
+
+func (ctx *BuiltinEvalContext) StateBackend() StateBackend {
+	return ctx.StateBackendValue
+}
+
+func (ctx *BuiltinEvalContext) StateWriteDue() bool {
+	return ctx.StateWritesValue == nil || ctx.StateWritesValue.due()
+}
+
+func (ctx *BuiltinEvalContext) StateWriteSequence() *stateWriteSequence {
+	return ctx.StateWriteSeqValue
+}
+
+func (ctx *BuiltinEvalContext) DryRun() bool {
+	return ctx.DryRunValue
+}
+
+func (ctx *BuiltinEvalContext) ProviderSemaphore(p ResourceProvider) Semaphore {
+	ctx.once.Do(ctx.init)
+
+	ctx.ProviderLock.Lock()
+	defer ctx.ProviderLock.Unlock()
+
+	return ctx.ProviderSemaphores[p]
+}
+
+func (ctx *BuiltinEvalContext) CorrelationId(n string) string {
+	ctx.CorrelationIdLock.Lock()
+	defer ctx.CorrelationIdLock.Unlock()
+
+	key := PathCacheKey(ctx.Path()) + "." + n
+	if id, ok := ctx.CorrelationIds[key]; ok {
+		return id
+	}
+
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		// This should never happen, and a correlation ID is only
+		// used for logging, so don't fail the walk over it.
+		log.Printf("[WARN] Error generating correlation ID for %s: %s", n, err)
+	}
+
+	id := hex.EncodeToString(raw[:])
+	ctx.CorrelationIds[key] = id
+	return id
+}
+
 func (ctx *BuiltinEvalContext) init() {
 	// We nil-check the things below because they're meant to be configured,
 	// and we just default them to non-nil.
 	if ctx.Providers == nil {
 		ctx.Providers = make(map[string]ResourceProviderFactory)
 	}
+	if ctx.ProviderSemaphores == nil {
+		ctx.ProviderSemaphores = make(map[ResourceProvider]Semaphore)
+	}
 }
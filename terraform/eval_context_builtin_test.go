@@ -37,6 +37,35 @@ func TestBuiltinEvalContextProviderInput(t *testing.T) {
 	}
 }
 
+func TestBuiltinEvalContextCorrelationId(t *testing.T) {
+	var lock sync.Mutex
+	ids := make(map[string]string)
+
+	ctx1 := testBuiltinEvalContext(t)
+	ctx1.PathValue = []string{"root"}
+	ctx1.CorrelationIds = ids
+	ctx1.CorrelationIdLock = &lock
+
+	ctx2 := testBuiltinEvalContext(t)
+	ctx2.PathValue = []string{"root", "child"}
+	ctx2.CorrelationIds = ids
+	ctx2.CorrelationIdLock = &lock
+
+	id := ctx1.CorrelationId("aws_instance.foo")
+	if id == "" {
+		t.Fatal("should have an ID")
+	}
+	if actual := ctx1.CorrelationId("aws_instance.foo"); actual != id {
+		t.Fatalf("bad: %s %s", actual, id)
+	}
+	if actual := ctx1.CorrelationId("aws_instance.bar"); actual == id {
+		t.Fatalf("should differ by name: %s", actual)
+	}
+	if actual := ctx2.CorrelationId("aws_instance.foo"); actual == id {
+		t.Fatalf("should differ by path: %s", actual)
+	}
+}
+
 func testBuiltinEvalContext(t *testing.T) *BuiltinEvalContext {
 	return &BuiltinEvalContext{}
 }
@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"regexp"
 	"sync"
 
 	"github.com/hashicorp/terraform/config"
@@ -83,6 +84,59 @@ type MockEvalContext struct {
 	StateCalled bool
 	StateState  *State
 	StateLock   *sync.RWMutex
+
+	CorrelationIdCalled bool
+	CorrelationIdName   string
+	CorrelationIdId     string
+
+	PolicyCalled bool
+	PolicyPolicy Policy
+
+	StoppedCalled bool
+	StoppedCh     <-chan struct{}
+
+	TaintErrorPatternsCalled   bool
+	TaintErrorPatternsPatterns []*regexp.Regexp
+
+	ProviderSemaphoreCalled    bool
+	ProviderSemaphoreProvider  ResourceProvider
+	ProviderSemaphoreSemaphore Semaphore
+
+	StateCacheCalled bool
+	StateCacheCache  *StateReadCache
+
+	AttributeWatchlistCalled    bool
+	AttributeWatchlistWatchlist []*AttributeWatch
+
+	ModuleBudgetsCalled  bool
+	ModuleBudgetsTracker *ModuleBudgetTracker
+
+	CoordinatorCalled      bool
+	CoordinatorCoordinator Coordinator
+
+	AuditLogCalled bool
+	AuditLogLog    *AuditLog
+
+	RecoverStateCalled bool
+	RecoverStateValue  bool
+
+	StateStreamCalled bool
+	StateStreamStream StateStream
+
+	PrerequisiteChecksCalled bool
+	PrerequisiteChecksChecks map[string]PrerequisiteCheck
+
+	StateBackendCalled  bool
+	StateBackendBackend StateBackend
+
+	StateWriteDueCalled    bool
+	StateWriteDueThrottled bool
+
+	StateWriteSequenceCalled   bool
+	StateWriteSequenceSequence *stateWriteSequence
+
+	DryRunCalled bool
+	DryRunValue  bool
 }
 
 func (c *MockEvalContext) Hook(fn func(Hook) (HookAction, error)) error {
@@ -198,3 +252,90 @@ func (c *MockEvalContext) State() (*State, *sync.RWMutex) {
 	c.StateCalled = true
 	return c.StateState, c.StateLock
 }
+
+func (c *MockEvalContext) Policy() Policy {
+	c.PolicyCalled = true
+	return c.PolicyPolicy
+}
+
+func (c *MockEvalContext) Stopped() <-chan struct{} {
+	c.StoppedCalled = true
+	return c.StoppedCh
+}
+
+func (c *MockEvalContext) TaintErrorPatterns() []*regexp.Regexp {
+	c.TaintErrorPatternsCalled = true
+	return c.TaintErrorPatternsPatterns
+}
+
+func (c *MockEvalContext) StateCache() *StateReadCache {
+	c.StateCacheCalled = true
+	return c.StateCacheCache
+}
+
+func (c *MockEvalContext) AttributeWatchlist() []*AttributeWatch {
+	c.AttributeWatchlistCalled = true
+	return c.AttributeWatchlistWatchlist
+}
+
+func (c *MockEvalContext) ModuleBudgets() *ModuleBudgetTracker {
+	c.ModuleBudgetsCalled = true
+	return c.ModuleBudgetsTracker
+}
+
+func (c *MockEvalContext) Coordinator() Coordinator {
+	c.CoordinatorCalled = true
+	return c.CoordinatorCoordinator
+}
+
+func (c *MockEvalContext) AuditLog() *AuditLog {
+	c.AuditLogCalled = true
+	return c.AuditLogLog
+}
+
+func (c *MockEvalContext) RecoverState() bool {
+	c.RecoverStateCalled = true
+	return c.RecoverStateValue
+}
+
+func (c *MockEvalContext) StateStream() StateStream {
+	c.StateStreamCalled = true
+	return c.StateStreamStream
+}
+
+func (c *MockEvalContext) PrerequisiteChecks() map[string]PrerequisiteCheck {
+	c.PrerequisiteChecksCalled = true
+	return c.PrerequisiteChecksChecks
+}
+
+func (c *MockEvalContext) StateBackend() StateBackend {
+	c.StateBackendCalled = true
+	return c.StateBackendBackend
+}
+
+func (c *MockEvalContext) StateWriteDue() bool {
+	c.StateWriteDueCalled = true
+	return !c.StateWriteDueThrottled
+}
+
+func (c *MockEvalContext) StateWriteSequence() *stateWriteSequence {
+	c.StateWriteSequenceCalled = true
+	return c.StateWriteSequenceSequence
+}
+
+func (c *MockEvalContext) DryRun() bool {
+	c.DryRunCalled = true
+	return c.DryRunValue
+}
+
+func (c *MockEvalContext) ProviderSemaphore(p ResourceProvider) Semaphore {
+	c.ProviderSemaphoreCalled = true
+	c.ProviderSemaphoreProvider = p
+	return c.ProviderSemaphoreSemaphore
+}
+
+func (c *MockEvalContext) CorrelationId(n string) string {
+	c.CorrelationIdCalled = true
+	c.CorrelationIdName = n
+	return c.CorrelationIdId
+}
@@ -0,0 +1,42 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// coordinateNow returns the current time for the coordination markers. It
+// is a variable so it can be changed in tests.
+var coordinateNow = time.Now
+
+// EvalCoordinate is an EvalNode implementation that records an apply in
+// the marker of the Coordinator of the context, if there is one. It must
+// only be evaluated once everything else is applied, so that the marker
+// is only written by applies that succeeded.
+type EvalCoordinate struct{}
+
+func (n *EvalCoordinate) Eval(ctx EvalContext) (interface{}, error) {
+	c := ctx.Coordinator()
+	if c == nil || ctx.DryRun() {
+		return nil, nil
+	}
+
+	marker, err := c.ReadMarker()
+	if err != nil {
+		return nil, fmt.Errorf("error reading coordination marker: %s", err)
+	}
+
+	next := &CoordinationMarker{Time: coordinateNow().UTC()}
+	if marker != nil {
+		next.Serial = marker.Serial
+	}
+	next.Serial++
+
+	log.Printf("[INFO] Writing coordination marker, serial %d", next.Serial)
+	if err := c.WriteMarker(next); err != nil {
+		return nil, fmt.Errorf("error writing coordination marker: %s", err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,54 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvalCoordinate(t *testing.T) {
+	now := time.Date(2015, 7, 1, 12, 0, 0, 0, time.UTC)
+	old := coordinateNow
+	coordinateNow = func() time.Time { return now }
+	defer func() { coordinateNow = old }()
+
+	c := &MockCoordinator{
+		Marker: &CoordinationMarker{Serial: 4},
+	}
+	ctx := &MockEvalContext{CoordinatorCoordinator: c}
+
+	n := &EvalCoordinate{}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &CoordinationMarker{Serial: 5, Time: now}
+	if !reflect.DeepEqual(c.Marker, expected) {
+		t.Fatalf("bad: %#v", c.Marker)
+	}
+}
+
+func TestEvalCoordinate_first(t *testing.T) {
+	c := new(MockCoordinator)
+	ctx := &MockEvalContext{CoordinatorCoordinator: c}
+
+	n := &EvalCoordinate{}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Marker == nil || c.Marker.Serial != 1 {
+		t.Fatalf("bad: %#v", c.Marker)
+	}
+}
+
+func TestEvalCoordinate_none(t *testing.T) {
+	ctx := new(MockEvalContext)
+
+	n := &EvalCoordinate{}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ctx.CoordinatorCalled {
+		t.Fatal("should be called")
+	}
+}
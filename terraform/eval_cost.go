@@ -0,0 +1,91 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+)
+
+// EvalEstimateCost is an EvalNode implementation that estimates the change
+// to the cost of a resource from its diff, for providers that implement
+// ResourceProviderCostEstimator. The estimate is stored in the diff, see
+// InstanceDiff.CostDelta. It is left unset if the cost isn't known.
+type EvalEstimateCost struct {
+	Info     *InstanceInfo
+	Provider *ResourceProvider
+	Diff     **InstanceDiff
+}
+
+func (n *EvalEstimateCost) Eval(ctx EvalContext) (interface{}, error) {
+	diff := *n.Diff
+	if diff.Empty() {
+		return nil, nil
+	}
+
+	e, ok := (*n.Provider).(ResourceProviderCostEstimator)
+	if !ok {
+		return nil, nil
+	}
+
+	cost, ok, err := e.EstimateCost(n.Info, diff)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%s: error estimating cost: %s", n.Info.HumanId(), err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	diff = diff.deepcopy()
+	diff.CostDelta = &cost
+	*n.Diff = diff
+	return nil, nil
+}
+
+// EvalCostGate is an EvalNode implementation that sums the estimated costs
+// of all the changes in the diff, and stops the apply if the total is over
+// the budget unless a hook confirms it, see CostConfirmer. A change whose
+// cost isn't known could cost anything, so it needs to be confirmed too.
+//
+// This must be evaluated before anything is applied.
+type EvalCostGate struct {
+	Budget float64
+}
+
+func (n *EvalCostGate) Eval(ctx EvalContext) (interface{}, error) {
+	diff, lock := ctx.Diff()
+	lock.RLock()
+	summary := newCostSummary(diff, n.Budget)
+	lock.RUnlock()
+
+	if !summary.OverBudget() {
+		return nil, nil
+	}
+
+	var confirmed bool
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		// Throttled hooks are wrapped, see ContextOpts.StateUpdateInterval
+		if th, ok := h.(*stateThrottleHook); ok {
+			h = th.Hook
+		}
+
+		c, ok := h.(CostConfirmer)
+		if !ok || confirmed {
+			return HookActionContinue, nil
+		}
+
+		var err error
+		confirmed, err = c.ConfirmCost(summary)
+		return HookActionContinue, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !confirmed {
+		return nil, fmt.Errorf(
+			"%s The apply must be confirmed to go ahead.", summary)
+	}
+
+	log.Printf("[INFO] Apply over its cost budget confirmed: %s", summary)
+	return nil, nil
+}
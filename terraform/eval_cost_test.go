@@ -0,0 +1,181 @@
+package terraform
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEvalEstimateCost(t *testing.T) {
+	var provider ResourceProvider = &testCostProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		Costs:                map[string]float64{"aws_instance": 12.5},
+	}
+
+	cases := map[string]struct {
+		Type     string
+		Expected *float64
+	}{
+		"known":   {"aws_instance", testCost(12.5)},
+		"unknown": {"aws_eip", nil},
+	}
+
+	for name, tc := range cases {
+		diff := &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"ami": &ResourceAttrDiff{New: "bar"},
+			},
+		}
+		node := &EvalEstimateCost{
+			Info:     &InstanceInfo{Id: "foo", Type: tc.Type},
+			Provider: &provider,
+			Diff:     &diff,
+		}
+		if _, err := node.Eval(new(MockEvalContext)); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(diff.CostDelta, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", name, diff.CostDelta)
+		}
+	}
+}
+
+func TestEvalCostGate(t *testing.T) {
+	cases := map[string]struct {
+		Costs   map[string]*float64
+		Confirm bool
+		Asked   bool
+		Err     bool
+	}{
+		"under budget": {
+			Costs: map[string]*float64{
+				"aws_instance.foo": testCost(40),
+				"aws_instance.bar": testCost(-20),
+			},
+		},
+
+		"over budget": {
+			Costs: map[string]*float64{
+				"aws_instance.foo": testCost(60),
+			},
+			Asked: true,
+			Err:   true,
+		},
+
+		"over budget confirmed": {
+			Costs: map[string]*float64{
+				"aws_instance.foo": testCost(60),
+			},
+			Confirm: true,
+			Asked:   true,
+		},
+
+		"unknown": {
+			Costs: map[string]*float64{
+				"aws_instance.foo": testCost(10),
+				"aws_instance.bar": nil,
+			},
+			Asked: true,
+			Err:   true,
+		},
+	}
+
+	for name, tc := range cases {
+		md := &ModuleDiff{
+			Path:      rootModulePath,
+			Resources: make(map[string]*InstanceDiff),
+		}
+		for k, cost := range tc.Costs {
+			md.Resources[k] = &InstanceDiff{Destroy: true, CostDelta: cost}
+		}
+
+		h := &testCostConfirmHook{Confirm: tc.Confirm}
+		ctx := new(MockEvalContext)
+		ctx.DiffDiff = &Diff{Modules: []*ModuleDiff{md}}
+		ctx.DiffLock = new(sync.RWMutex)
+		ctx.HookHook = h
+
+		node := &EvalCostGate{Budget: 50}
+		_, err := node.Eval(ctx)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		if (h.Summary != nil) != tc.Asked {
+			t.Fatalf("%s: bad: %#v", name, h.Summary)
+		}
+	}
+}
+
+func TestCostSummary(t *testing.T) {
+	d := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo": &InstanceDiff{
+						Destroy:   true,
+						CostDelta: testCost(10),
+					},
+					"aws_instance.bar": &InstanceDiff{},
+				},
+			},
+			&ModuleDiff{
+				Path: []string{"root", "child"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo": &InstanceDiff{Destroy: true},
+				},
+			},
+		},
+	}
+
+	s := newCostSummary(d, 50)
+	if s.Total != 10 {
+		t.Fatalf("bad: %#v", s)
+	}
+	if !reflect.DeepEqual(s.Unknown, []string{"module.child.aws_instance.foo"}) {
+		t.Fatalf("bad: %#v", s.Unknown)
+	}
+	if !s.OverBudget() {
+		t.Fatal("should be over budget")
+	}
+	if !strings.Contains(s.String(), "module.child.aws_instance.foo") {
+		t.Fatalf("bad: %s", s)
+	}
+}
+
+func testCost(v float64) *float64 {
+	return &v
+}
+
+// testCostProvider is a MockResourceProvider that estimates a fixed cost
+// for the changes to each resource type.
+type testCostProvider struct {
+	*MockResourceProvider
+
+	Costs map[string]float64
+}
+
+func (p *testCostProvider) EstimateCost(
+	info *InstanceInfo, d *InstanceDiff) (float64, bool, error) {
+	cost, ok := p.Costs[info.Type]
+	if d.Destroy {
+		cost = -cost
+	}
+
+	return cost, ok, nil
+}
+
+// testCostConfirmHook is a Hook that confirms applies over budget or not.
+type testCostConfirmHook struct {
+	NilHook
+
+	Confirm bool
+	Summary *CostSummary
+}
+
+func (h *testCostConfirmHook) ConfirmCost(s *CostSummary) (bool, error) {
+	h.Summary = s
+	return h.Confirm, nil
+}
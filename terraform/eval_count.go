@@ -1,58 +1,57 @@
 package terraform
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/hashicorp/terraform/config"
 )
 
-// EvalCountFixZeroOneBoundary is an EvalNode that fixes up the state
-// when there is a resource count with zero/one boundary, i.e. fixing
-// a resource named "aws_instance.foo" to "aws_instance.foo.0" and vice-versa.
-type EvalCountFixZeroOneBoundary struct {
-	Resource *config.Resource
+// EvalCountInterpolate is an EvalNode implementation that interpolates the
+// count of a resource so that the resource can be expanded.
+//
+// The count may reference variables, module outputs and the attributes of
+// other resources. The graph walks the resources that the count depends on
+// first, but their values must still be known by the time this resource is
+// planned: a count that depends on a computed attribute is an error, since
+// the number of instances must be known to plan them.
+//
+// If AllowUnknown is set, a count that isn't known yet isn't an error. The
+// destroy nodes of a resource are walked before the resources its count
+// depends on, so they may not know the count. See ResourceCountTransformer
+// for how a resource with an unknown count is expanded.
+type EvalCountInterpolate struct {
+	Resource     *config.Resource
+	AllowUnknown bool
 }
 
-// TODO: test
-func (n *EvalCountFixZeroOneBoundary) Eval(ctx EvalContext) (interface{}, error) {
-	// Get the count, important for knowing whether we're supposed to
-	// be adding the zero, or trimming it.
-	count, err := n.Resource.Count()
-	if err != nil {
-		return nil, err
-	}
-
-	// Figure what to look for and what to replace it with
-	hunt := n.Resource.Id()
-	replace := hunt + ".0"
-	if count < 2 {
-		hunt, replace = replace, hunt
+func (n *EvalCountInterpolate) Eval(ctx EvalContext) (interface{}, error) {
+	if _, err := ctx.Interpolate(n.Resource.RawCount, nil); err != nil {
+		return nil, fmt.Errorf(
+			"%s: failed to interpolate count: %s", n.Resource.Id(), err)
 	}
 
-	state, lock := ctx.State()
+	if len(n.Resource.RawCount.UnknownKeys()) > 0 {
+		if n.AllowUnknown {
+			return nil, nil
+		}
 
-	// Get a lock so we can access this instance and potentially make
-	// changes to it.
-	lock.Lock()
-	defer lock.Unlock()
-
-	// Look for the module state. If we don't have one, then it doesn't matter.
-	mod := state.ModuleByPath(ctx.Path())
-	if mod == nil {
-		return nil, nil
+		return nil, fmt.Errorf(
+			"%s: count depends on a value that isn't known until the "+
+				"apply, such as a computed attribute. The count must be "+
+				"known when planning.",
+			n.Resource.Id())
 	}
 
-	// Look for the resource state. If we don't have one, then it is okay.
-	rs, ok := mod.Resources[hunt]
+	value, ok := n.Resource.RawCount.Value().(string)
 	if !ok {
-		return nil, nil
+		return nil, fmt.Errorf(
+			"%s: count must be an integer", n.Resource.Id())
 	}
-
-	// If the replacement key exists, we just keep both
-	if _, ok := mod.Resources[replace]; ok {
-		return nil, nil
+	if _, err := strconv.ParseInt(value, 0, 0); err != nil {
+		return nil, fmt.Errorf(
+			"%s: count must be an integer, got %q", n.Resource.Id(), value)
 	}
 
-	mod.Resources[replace] = rs
-	delete(mod.Resources, hunt)
-
 	return nil, nil
 }
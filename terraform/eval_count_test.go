@@ -0,0 +1,75 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/lang/ast"
+)
+
+func TestEvalCountInterpolate(t *testing.T) {
+	cases := map[string]struct {
+		Value        string
+		AllowUnknown bool
+		Err          string
+	}{
+		"integer": {
+			Value: "3",
+		},
+
+		"not an integer": {
+			Value: "three",
+			Err:   `count must be an integer, got "three"`,
+		},
+
+		"unknown": {
+			Value: config.UnknownVariableValue,
+			Err:   "isn't known until the apply",
+		},
+
+		"unknown allowed": {
+			Value:        config.UnknownVariableValue,
+			AllowUnknown: true,
+		},
+	}
+
+	for name, tc := range cases {
+		rc, err := config.NewRawConfig(map[string]interface{}{
+			"count": "${var.num}",
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		rc.Key = "count"
+
+		err = rc.Interpolate(map[string]ast.Variable{
+			"var.num": ast.Variable{
+				Value: tc.Value,
+				Type:  ast.TypeString,
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		n := &EvalCountInterpolate{
+			Resource: &config.Resource{
+				Name:     "foo",
+				Type:     "aws_instance",
+				RawCount: rc,
+			},
+			AllowUnknown: tc.AllowUnknown,
+		}
+		_, err = n.Eval(new(MockEvalContext))
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %v", name, err)
+		}
+	}
+}
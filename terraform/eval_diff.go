@@ -1,12 +1,20 @@
 package terraform
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 // EvalCompareDiff is an EvalNode implementation that compares two diffs
-// and errors if the diffs are not equal.
+// and errors if the diffs are not equal. One is the diff from the plan and
+// Two is the diff from the apply. The error lists the attributes that
+// differ, see InstanceDiff.AttrMismatches.
 type EvalCompareDiff struct {
 	Info     *InstanceInfo
 	One, Two **InstanceDiff
@@ -43,14 +51,56 @@ func (n *EvalCompareDiff) Eval(ctx EvalContext) (interface{}, error) {
 		log.Printf("[ERROR] %s: reason: %s", n.Info.Id, reason)
 		log.Printf("[ERROR] %s: diff one: %#v", n.Info.Id, one)
 		log.Printf("[ERROR] %s: diff two: %#v", n.Info.Id, two)
-		return nil, fmt.Errorf(
+
+		var buf bytes.Buffer
+		buf.WriteString(fmt.Sprintf(
 			"%s: diffs didn't match during apply. This is a bug with "+
-				"Terraform and should be reported.", n.Info.Id)
+				"Terraform and should be reported.\n\nReason: %s\n",
+			n.Info.Id, reason))
+		if ms := one.AttrMismatches(two); len(ms) > 0 {
+			buf.WriteString("\nAttributes that differ between the plan and the apply:\n\n")
+			for _, m := range ms {
+				buf.WriteString(fmt.Sprintf(
+					"  %s:\n    plan:  %s\n    apply: %s\n",
+					m.Key, attrDiffString(m.One), attrDiffString(m.Two)))
+				if m.RequiresNewChanged() {
+					buf.WriteString("    (whether it forces a new resource changed)\n")
+				}
+			}
+			buf.WriteString(
+				"\nAn attribute whose value changed is often a computed " +
+					"attribute that the provider didn't mark as computed.")
+		}
+
+		return nil, errors.New(strings.TrimSpace(buf.String()))
 	}
 
 	return nil, nil
 }
 
+// attrDiffString returns the diff of an attribute in the format of the
+// plan, or "<not in the diff>" for nil.
+func attrDiffString(ad *ResourceAttrDiff) string {
+	if ad == nil {
+		return "<not in the diff>"
+	}
+
+	v := fmt.Sprintf("%#v", ad.New)
+	switch {
+	case ad.NewComputed:
+		v = "<computed>"
+	case ad.NewRemoved:
+		v = "<removed>"
+	}
+
+	result := fmt.Sprintf("%#v => %s", ad.Old, v)
+	if ad.RequiresNew {
+		result += " (forces new resource)"
+	}
+
+	return result
+}
+
 // EvalDiff is an EvalNode implementation that does a refresh for
 // a resource.
 type EvalDiff struct {
@@ -84,7 +134,9 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 	diffState.init()
 
 	// Diff!
+	release := acquireProvider(ctx, provider)
 	diff, err := provider.Diff(n.Info, diffState, config)
+	release()
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +144,11 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 		diff = new(InstanceDiff)
 	}
 
+	// Drop the diffs of JSON attributes that haven't really changed
+	if attrs := schemaJSONAttributes(provider, n.Info.Type); attrs != nil {
+		suppressJSONDiffs(n.Info.Id, diff, attrs)
+	}
+
 	// Require a destroy if there is no ID and it requires new.
 	if diff.RequiresNew() && state != nil && state.ID != "" {
 		diff.Destroy = true
@@ -138,6 +195,270 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// EvalIgnoreChanges is an EvalNode implementation that removes the changes
+// to the ignored attributes of a resource, see config.ResourceLifecycle,
+// from the diff of an existing resource. It must come after EvalDiff.
+//
+// If an ignored attribute was the only reason to replace the resource, the
+// diff becomes an update, or a no-op if nothing else changes. If another
+// change still replaces it, the diff is left as it is so that the new
+// resource is created from the whole config.
+//
+// The key "*" ignores the changes to every attribute, so once the resource
+// exists it is neither updated nor replaced. A diff that destroys it
+// without changing attributes is kept.
+//
+// State is the state the diff was made from. If OutputState is set, it is
+// set to the state updated with the diff, like EvalDiff.OutputState.
+type EvalIgnoreChanges struct {
+	Info        *InstanceInfo
+	Keys        []string
+	State       **InstanceState
+	Diff        **InstanceDiff
+	OutputState **InstanceState
+}
+
+func (n *EvalIgnoreChanges) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	diff := *n.Diff
+
+	if len(n.Keys) > 0 && state != nil && state.ID != "" && !diff.Empty() {
+		diff = n.filter(diff)
+		*n.Diff = diff
+	}
+
+	if n.OutputState != nil {
+		*n.OutputState = state
+		if !diff.Empty() {
+			*n.OutputState = state.MergeDiff(diff)
+		}
+	}
+
+	return nil, nil
+}
+
+func (n *EvalIgnoreChanges) filter(diff *InstanceDiff) *InstanceDiff {
+	result := diff.deepcopy()
+
+	var ignored []string
+	for k := range result.Attributes {
+		for _, key := range n.Keys {
+			if key == "*" || k == key || strings.HasPrefix(k, key+".") {
+				ignored = append(ignored, k)
+				delete(result.Attributes, k)
+				break
+			}
+		}
+	}
+	if len(ignored) == 0 {
+		return diff
+	}
+	if !diffUnreplace(diff, result) {
+		log.Printf(
+			"[DEBUG] %s: not ignoring changes, the resource is replaced",
+			n.Info.Id)
+		return diff
+	}
+
+	sort.Strings(ignored)
+	log.Printf("[DEBUG] %s: ignoring changes to %s",
+		n.Info.Id, strings.Join(ignored, ", "))
+	return result
+}
+
+// diffUnreplace makes result, a copy of the diff with some attribute
+// diffs removed, update the resource instead of replacing it if the diff
+// replaced it only because of the removed attributes. It returns false if
+// the attributes that are left still replace the resource, in which case
+// result must not be used: the new resource is created from the whole
+// config, so the original diff is kept.
+func diffUnreplace(diff, result *InstanceDiff) bool {
+	if !diff.RequiresNew() {
+		return true
+	}
+
+	// The ID is computed whenever the resource is replaced, so it
+	// doesn't count as a reason to replace it.
+	for k, ad := range result.Attributes {
+		if k == "id" && ad.Type == DiffAttrOutput {
+			continue
+		}
+		if ad.RequiresNew {
+			return false
+		}
+	}
+
+	delete(result.Attributes, "id")
+	result.Destroy = false
+	return true
+}
+
+// EvalDiffSuppress is an EvalNode implementation that removes the changes
+// to attributes from a diff that the provider suppresses, since the old
+// and new values are equivalent. See ResourceProviderDiffSuppressor. A
+// diff whose changes are all suppressed is empty.
+//
+// Only the diffs of existing resources are suppressed, a new resource
+// needs all of its attributes. Like EvalIgnoreChanges, if a suppressed
+// attribute was the only reason to replace the resource, the diff becomes
+// an update. If another change still replaces it, the diff is left as it
+// is.
+type EvalDiffSuppress struct {
+	Info     *InstanceInfo
+	Provider *ResourceProvider
+	State    **InstanceState
+	Diff     **InstanceDiff
+}
+
+func (n *EvalDiffSuppress) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	diff := *n.Diff
+	if state == nil || state.ID == "" || diff.Empty() {
+		return nil, nil
+	}
+
+	ds, ok := (*n.Provider).(ResourceProviderDiffSuppressor)
+	if !ok {
+		return nil, nil
+	}
+	funcs := ds.DiffSuppressFuncs(n.Info.Type)
+	if len(funcs) == 0 {
+		return nil, nil
+	}
+
+	result := diff.deepcopy()
+	var suppressed []string
+	for k, ad := range result.Attributes {
+		if ad.NewComputed || ad.NewRemoved || ad.Old == ad.New {
+			continue
+		}
+
+		top := k
+		if idx := strings.Index(k, "."); idx != -1 {
+			top = k[:idx]
+		}
+		f, ok := funcs[top]
+		if !ok || !f(k, ad.Old, ad.New) {
+			continue
+		}
+
+		suppressed = append(suppressed, k)
+		delete(result.Attributes, k)
+	}
+	if len(suppressed) == 0 {
+		return nil, nil
+	}
+	if !diffUnreplace(diff, result) {
+		log.Printf(
+			"[DEBUG] %s: not suppressing diffs, the resource is replaced",
+			n.Info.Id)
+		return nil, nil
+	}
+
+	sort.Strings(suppressed)
+	log.Printf("[DEBUG] %s: suppressing the diffs of %s",
+		n.Info.Id, strings.Join(suppressed, ", "))
+	*n.Diff = result
+	return nil, nil
+}
+
+// EvalDiffReplaceTriggered is an EvalNode implementation that replaces an
+// existing resource if any of the resources that trigger its replacement
+// (see config.ResourceLifecycle) have a change in the diff, even if the
+// resource itself didn't change. The diff becomes the diff for creating
+// the resource from scratch, along with destroying the existing one.
+type EvalDiffReplaceTriggered struct {
+	Info        *InstanceInfo
+	Triggers    []string
+	Config      **ResourceConfig
+	Provider    *ResourceProvider
+	State       **InstanceState
+	Output      **InstanceDiff
+	OutputState **InstanceState
+}
+
+func (n *EvalDiffReplaceTriggered) Eval(ctx EvalContext) (interface{}, error) {
+	if len(n.Triggers) == 0 {
+		return nil, nil
+	}
+
+	// Only existing resources that aren't already replaced are affected
+	state := *n.State
+	if state == nil || state.ID == "" {
+		return nil, nil
+	}
+	if d := *n.Output; d != nil && d.RequiresNew() {
+		return nil, nil
+	}
+
+	trigger := n.changedTrigger(ctx)
+	if trigger == "" {
+		return nil, nil
+	}
+
+	log.Printf(
+		"[INFO] %s: replacing, triggered by a change to %s", n.Info.Id, trigger)
+
+	// Diff against an empty state so that the diff is the same as the
+	// diff for creating the resource after the existing one is gone.
+	diffState := new(InstanceState)
+	diffState.init()
+	release := acquireProvider(ctx, *n.Provider)
+	diff, err := (*n.Provider).Diff(n.Info, diffState, *n.Config)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	if diff == nil {
+		diff = new(InstanceDiff)
+	}
+
+	diff.init()
+	diff.Destroy = true
+	diff.Attributes["id"] = &ResourceAttrDiff{
+		Old:         state.Attributes["id"],
+		NewComputed: true,
+		RequiresNew: true,
+		Type:        DiffAttrOutput,
+	}
+
+	*n.Output = diff
+	if n.OutputState != nil {
+		*n.OutputState = state.MergeDiff(diff)
+	}
+
+	return nil, nil
+}
+
+// changedTrigger returns the name of a trigger that has a change in the
+// diff, or "" if none have.
+func (n *EvalDiffReplaceTriggered) changedTrigger(ctx EvalContext) string {
+	diff, lock := ctx.Diff()
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	modDiff := diff.ModuleByPath(ctx.Path())
+	if modDiff == nil {
+		return ""
+	}
+
+	for _, t := range n.Triggers {
+		for k, d := range modDiff.Resources {
+			// The diffs of counted resources are per instance
+			if k != t && !strings.HasPrefix(k, t+".") {
+				continue
+			}
+
+			if !d.Empty() {
+				return t
+			}
+		}
+	}
+
+	return ""
+}
+
 // EvalDiffDestroy is an EvalNode implementation that returns a plain
 // destroy diff.
 type EvalDiffDestroy struct {
@@ -333,3 +654,32 @@ func (n *EvalWriteDiff) Eval(ctx EvalContext) (interface{}, error) {
 
 	return nil, nil
 }
+
+// suppressJSONDiffs removes the attribute diffs of the given JSON attributes
+// where the old and new values are equivalent JSON. Values that aren't
+// valid JSON are compared as strings, so their diffs are kept.
+func suppressJSONDiffs(id string, diff *InstanceDiff, attrs map[string]struct{}) {
+	for k, ad := range diff.Attributes {
+		if _, ok := attrs[k]; !ok {
+			continue
+		}
+		if ad.NewComputed || ad.NewRemoved || ad.Old == ad.New {
+			continue
+		}
+
+		var oldValue, newValue interface{}
+		if err := json.Unmarshal([]byte(ad.Old), &oldValue); err != nil {
+			continue
+		}
+		if err := json.Unmarshal([]byte(ad.New), &newValue); err != nil {
+			continue
+		}
+
+		if reflect.DeepEqual(oldValue, newValue) {
+			log.Printf(
+				"[DEBUG] %s: suppressing diff of equivalent JSON attribute %q",
+				id, k)
+			delete(diff.Attributes, k)
+		}
+	}
+}
@@ -2,9 +2,52 @@ package terraform
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
+func TestEvalCompareDiff(t *testing.T) {
+	one := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+		},
+	}
+	two := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami":     &ResourceAttrDiff{Old: "foo", New: "bar"},
+			"address": &ResourceAttrDiff{Old: "", New: "10.0.0.1"},
+		},
+	}
+
+	node := &EvalCompareDiff{
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		One:  &one,
+		Two:  &two,
+	}
+	_, err := node.Eval(new(MockEvalContext))
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := `
+  address:
+    plan:  <not in the diff>
+    apply: "" => "10.0.0.1"
+`
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("bad: %s", err)
+	}
+	if strings.Contains(err.Error(), "ami") {
+		t.Fatalf("same attribute shouldn't be listed: %s", err)
+	}
+
+	// The same diffs match
+	two = one
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestEvalFilterDiff(t *testing.T) {
 	ctx := new(MockEvalContext)
 
@@ -76,3 +119,400 @@ func TestEvalFilterDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestEvalDiff_jsonAttributes(t *testing.T) {
+	p := testProvider("aws")
+	p.ResourcesReturn = []ResourceType{
+		ResourceType{
+			Name:           "aws_iam_policy",
+			JSONAttributes: []string{"policy", "invalid", "changed"},
+		},
+	}
+	p.DiffReturn = &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"policy": &ResourceAttrDiff{
+				Old: `{"a": 1, "b": [true, null]}`,
+				New: `{"b":[true,null],"a":1}`,
+			},
+			"invalid": &ResourceAttrDiff{
+				Old: `{"a": 1`,
+				New: `{"a":1`,
+			},
+			"changed": &ResourceAttrDiff{
+				Old: `{"a": 1}`,
+				New: `{"a": 2}`,
+			},
+			"name": &ResourceAttrDiff{
+				Old: `{"a": 1}`,
+				New: `{"a":1}`,
+			},
+		},
+	}
+
+	var provider ResourceProvider = p
+	config := testResourceConfig(t, map[string]interface{}{})
+	state := &InstanceState{ID: "foo"}
+	var diff *InstanceDiff
+	node := &EvalDiff{
+		Info:     &InstanceInfo{Id: "aws_iam_policy.foo", Type: "aws_iam_policy"},
+		Config:   &config,
+		Provider: &provider,
+		State:    &state,
+		Output:   &diff,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, k := range []string{"invalid", "changed", "name"} {
+		if _, ok := diff.Attributes[k]; !ok {
+			t.Fatalf("should keep %s: %#v", k, diff.Attributes)
+		}
+	}
+	if _, ok := diff.Attributes["policy"]; ok {
+		t.Fatalf("should suppress policy: %#v", diff.Attributes)
+	}
+}
+
+// testDiffSuppressProvider is a MockResourceProvider that suppresses the
+// diffs of "policy" that only change whitespace, see
+// ResourceProviderDiffSuppressor.
+type testDiffSuppressProvider struct {
+	*MockResourceProvider
+}
+
+func (p *testDiffSuppressProvider) DiffSuppressFuncs(
+	string) map[string]DiffSuppressFunc {
+	return map[string]DiffSuppressFunc{
+		"policy": func(k, old, new string) bool {
+			return strings.Join(strings.Fields(old), "") ==
+				strings.Join(strings.Fields(new), "")
+		},
+	}
+}
+
+func TestEvalDiffSuppress(t *testing.T) {
+	existing := &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"id":     "foo",
+			"policy": `{"a": 1}`,
+		},
+	}
+	policy := func(requiresNew bool) *InstanceDiff {
+		d := &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"policy": &ResourceAttrDiff{
+					Old:         `{"a": 1}`,
+					New:         "{\n  \"a\": 1\n}",
+					RequiresNew: requiresNew,
+				},
+			},
+		}
+		if requiresNew {
+			d.Destroy = true
+			d.Attributes["id"] = &ResourceAttrDiff{
+				Old:         "foo",
+				NewComputed: true,
+				RequiresNew: true,
+				Type:        DiffAttrOutput,
+			}
+		}
+		return d
+	}
+
+	cases := map[string]struct {
+		State  *InstanceState
+		Input  *InstanceDiff
+		Output *InstanceDiff
+	}{
+		"suppressed": {
+			existing,
+			policy(false),
+			&InstanceDiff{Attributes: map[string]*ResourceAttrDiff{}},
+		},
+
+		"changed": {
+			existing,
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"policy": &ResourceAttrDiff{
+						Old: `{"a": 1}`,
+						New: `{"a": 2}`,
+					},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"policy": &ResourceAttrDiff{
+						Old: `{"a": 1}`,
+						New: `{"a": 2}`,
+					},
+				},
+			},
+		},
+
+		"suppressed replacement": {
+			existing,
+			policy(true),
+			&InstanceDiff{Attributes: map[string]*ResourceAttrDiff{}},
+		},
+
+		"replaced": {
+			existing,
+			func() *InstanceDiff {
+				d := policy(true)
+				d.Attributes["ami"] = &ResourceAttrDiff{
+					Old:         "ami-1",
+					New:         "ami-2",
+					RequiresNew: true,
+				}
+				return d
+			}(),
+			func() *InstanceDiff {
+				d := policy(true)
+				d.Attributes["ami"] = &ResourceAttrDiff{
+					Old:         "ami-1",
+					New:         "ami-2",
+					RequiresNew: true,
+				}
+				return d
+			}(),
+		},
+
+		"created": {
+			nil,
+			policy(false),
+			policy(false),
+		},
+	}
+
+	for name, tc := range cases {
+		var provider ResourceProvider = &testDiffSuppressProvider{
+			MockResourceProvider: new(MockResourceProvider),
+		}
+		state := tc.State
+		diff := tc.Input
+		n := &EvalDiffSuppress{
+			Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+			Provider: &provider,
+			State:    &state,
+			Diff:     &diff,
+		}
+		if _, err := n.Eval(new(MockEvalContext)); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(diff, tc.Output) {
+			t.Fatalf("%s: bad:\n\n%#v", name, diff)
+		}
+	}
+}
+
+func TestEvalIgnoreChanges(t *testing.T) {
+	existing := &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"id":  "foo",
+			"ami": "ami-1",
+		},
+	}
+	replace := func() *InstanceDiff {
+		return &InstanceDiff{
+			Destroy: true,
+			Attributes: map[string]*ResourceAttrDiff{
+				"ami": &ResourceAttrDiff{
+					Old:         "ami-1",
+					New:         "ami-2",
+					RequiresNew: true,
+				},
+				"id": &ResourceAttrDiff{
+					Old:         "foo",
+					NewComputed: true,
+					RequiresNew: true,
+					Type:        DiffAttrOutput,
+				},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		Keys   []string
+		State  *InstanceState
+		Input  *InstanceDiff
+		Output *InstanceDiff
+	}{
+		"no keys": {
+			nil,
+			existing,
+			replace(),
+			replace(),
+		},
+
+		"only replacement ignored": {
+			[]string{"ami"},
+			existing,
+			replace(),
+			&InstanceDiff{Attributes: map[string]*ResourceAttrDiff{}},
+		},
+
+		"replacement ignored with update": {
+			[]string{"ami"},
+			existing,
+			func() *InstanceDiff {
+				d := replace()
+				d.Attributes["tags.Name"] = &ResourceAttrDiff{
+					Old: "foo",
+					New: "bar",
+				}
+				return d
+			}(),
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"tags.Name": &ResourceAttrDiff{
+						Old: "foo",
+						New: "bar",
+					},
+				},
+			},
+		},
+
+		"list or map": {
+			[]string{"tags"},
+			existing,
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"tags.#": &ResourceAttrDiff{
+						Old: "1",
+						New: "2",
+					},
+					"tags.Name": &ResourceAttrDiff{
+						New: "bar",
+					},
+					"tagsfoo": &ResourceAttrDiff{
+						New: "bar",
+					},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"tagsfoo": &ResourceAttrDiff{
+						New: "bar",
+					},
+				},
+			},
+		},
+
+		"still replaced": {
+			[]string{"tags"},
+			existing,
+			func() *InstanceDiff {
+				d := replace()
+				d.Attributes["tags.Name"] = &ResourceAttrDiff{
+					Old: "foo",
+					New: "bar",
+				}
+				return d
+			}(),
+			func() *InstanceDiff {
+				d := replace()
+				d.Attributes["tags.Name"] = &ResourceAttrDiff{
+					Old: "foo",
+					New: "bar",
+				}
+				return d
+			}(),
+		},
+
+		"wildcard": {
+			[]string{"*"},
+			existing,
+			func() *InstanceDiff {
+				d := replace()
+				d.Attributes["tags.Name"] = &ResourceAttrDiff{
+					Old: "foo",
+					New: "bar",
+				}
+				return d
+			}(),
+			&InstanceDiff{Attributes: map[string]*ResourceAttrDiff{}},
+		},
+
+		"wildcard destroy": {
+			[]string{"*"},
+			existing,
+			&InstanceDiff{Destroy: true},
+			&InstanceDiff{Destroy: true},
+		},
+
+		"wildcard new resource": {
+			[]string{"*"},
+			nil,
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{
+						New:         "ami-2",
+						RequiresNew: true,
+					},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{
+						New:         "ami-2",
+						RequiresNew: true,
+					},
+				},
+			},
+		},
+
+		"new resource": {
+			[]string{"ami"},
+			nil,
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{
+						New:         "ami-2",
+						RequiresNew: true,
+					},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{
+						New:         "ami-2",
+						RequiresNew: true,
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		state := tc.State
+		diff := tc.Input
+		var outputState *InstanceState
+		n := &EvalIgnoreChanges{
+			Info:        &InstanceInfo{Id: "aws_instance.foo"},
+			Keys:        tc.Keys,
+			State:       &state,
+			Diff:        &diff,
+			OutputState: &outputState,
+		}
+		if _, err := n.Eval(new(MockEvalContext)); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(diff, tc.Output) {
+			t.Fatalf("%s: bad:\n\n%#v", name, diff)
+		}
+
+		expected := state
+		if !diff.Empty() {
+			expected = state.MergeDiff(diff)
+		}
+		if !reflect.DeepEqual(outputState, expected) {
+			t.Fatalf("%s: bad state:\n\n%#v", name, outputState)
+		}
+	}
+}
@@ -5,7 +5,8 @@ import (
 )
 
 // EvalInterpolate is an EvalNode implementation that takes a raw
-// configuration and interpolates it.
+// configuration and interpolates it. The values that aren't known yet
+// are left out of the output and listed in its ComputedKeys.
 type EvalInterpolate struct {
 	Config   *config.RawConfig
 	Resource *Resource
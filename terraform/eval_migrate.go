@@ -0,0 +1,125 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// schemaVersionMetaKey is the key in the instance Meta that the schema
+// version of the attributes is recorded under.
+const schemaVersionMetaKey = "schema_version"
+
+// EvalMigrateAttributes is an EvalNode implementation that migrates the
+// attributes of an InstanceState that were written under an older schema
+// version of the resource type.
+//
+// The migrations are run in version order, and only the migrations newer
+// than the schema version recorded in the state are run, so running this
+// more than once has no further effect. The new schema version is recorded
+// in the instance.
+//
+// The instance may be the one in the state, which others read, so a copy
+// of it is migrated and replaces State. It must then be written with
+// EvalWriteState.
+//
+// If Migrations is nil, the migrations are requested from the provider
+// if it implements ResourceProviderMigrator.
+type EvalMigrateAttributes struct {
+	Info       *InstanceInfo
+	Provider   *ResourceProvider
+	State      **InstanceState
+	Migrations []AttributeMigration
+
+	// Migrated, if set, is set to whether any migration ran.
+	Migrated *bool
+}
+
+func (n *EvalMigrateAttributes) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Migrated != nil {
+		*n.Migrated = false
+	}
+
+	state := *n.State
+	if state == nil {
+		return nil, nil
+	}
+
+	migrations := n.Migrations
+	if migrations == nil && n.Provider != nil {
+		if m, ok := (*n.Provider).(ResourceProviderMigrator); ok {
+			migrations = m.AttributeMigrations(n.Info.Type)
+		}
+	}
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+
+	version := 0
+	if v, ok := state.Meta[schemaVersionMetaKey]; ok {
+		var err error
+		version, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%s: invalid schema version %q: %s", n.Info.Id, v, err)
+		}
+	}
+
+	sorted := make([]AttributeMigration, len(migrations))
+	copy(sorted, migrations)
+	sort.Sort(attributeMigrationSort(sorted))
+
+	migrated := false
+	for _, m := range sorted {
+		if m.Version <= version {
+			continue
+		}
+		if !migrated {
+			state = state.deepcopy()
+			migrated = true
+		}
+
+		log.Printf(
+			"[INFO] %s: migrating attributes to schema version %d",
+			n.Info.Id, m.Version)
+		if state.Attributes == nil {
+			state.Attributes = make(map[string]string)
+		}
+		if err := m.Migrate(state.Attributes); err != nil {
+			return nil, fmt.Errorf(
+				"%s: error migrating to schema version %d: %s",
+				n.Info.Id, m.Version, err)
+		}
+
+		version = m.Version
+		if state.Meta == nil {
+			state.Meta = make(map[string]string)
+		}
+		state.Meta[schemaVersionMetaKey] = strconv.Itoa(version)
+	}
+
+	if migrated {
+		*n.State = state
+	}
+	if n.Migrated != nil {
+		*n.Migrated = migrated
+	}
+
+	return nil, nil
+}
+
+// attributeMigrationSort sorts migrations by version, oldest first.
+type attributeMigrationSort []AttributeMigration
+
+func (s attributeMigrationSort) Len() int {
+	return len(s)
+}
+
+func (s attributeMigrationSort) Less(i, j int) bool {
+	return s[i].Version < s[j].Version
+}
+
+func (s attributeMigrationSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
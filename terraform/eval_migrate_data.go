@@ -0,0 +1,64 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+)
+
+// EvalMigrateData is an EvalNode implementation that moves the data of a
+// resource that is replaced with create before destroy from the old
+// instance, From, to the new one, State, for providers that implement
+// ResourceProviderDataMigrator. It runs once the new instance is created
+// and provisioned, and before the old instance is destroyed.
+//
+// A failed migration is the error of the apply, in Error: the new instance
+// is tainted and the old instance is restored, so it isn't destroyed along
+// with its data. Nothing is migrated if the apply already failed.
+type EvalMigrateData struct {
+	Info     *InstanceInfo
+	Provider *ResourceProvider
+	From     **InstanceState
+	State    **InstanceState
+	Error    *error
+}
+
+func (n *EvalMigrateData) Eval(ctx EvalContext) (interface{}, error) {
+	if *n.Error != nil {
+		return nil, nil
+	}
+
+	from, to := *n.From, *n.State
+	if from == nil || from.ID == "" || to == nil || to.ID == "" {
+		return nil, nil
+	}
+
+	m, ok := (*n.Provider).(ResourceProviderDataMigrator)
+	if !ok {
+		return nil, nil
+	}
+	migrate := m.DataMigration(n.Info.Type)
+	if migrate == nil {
+		return nil, nil
+	}
+	if ctx.DryRun() {
+		log.Printf(
+			"[INFO] apply: %s: dry run, not migrating data from %s to %s",
+			n.Info.logId(), from.ID, to.ID)
+		return nil, nil
+	}
+
+	log.Printf(
+		"[INFO] apply: %s: migrating data from %s to %s",
+		n.Info.logId(), from.ID, to.ID)
+	release := acquireProvider(ctx, *n.Provider)
+	err := migrate(n.Info, from, to)
+	release()
+	if err != nil {
+		*n.Error = fmt.Errorf(
+			"%s: error migrating data from %s to %s, the old instance is "+
+				"kept: %s",
+			n.Info.HumanId(), from.ID, to.ID, err)
+	}
+
+	return nil, nil
+}
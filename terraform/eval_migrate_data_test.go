@@ -0,0 +1,110 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvalMigrateData(t *testing.T) {
+	var from, to *InstanceState
+	var provider ResourceProvider = &testMigrateDataProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		Type:                 "aws_db_instance",
+		MigrateFn: func(info *InstanceInfo, f, t *InstanceState) error {
+			from, to = f, t
+			return nil
+		},
+	}
+
+	old := &InstanceState{ID: "old"}
+	state := &InstanceState{ID: "new"}
+	var err error
+	node := &EvalMigrateData{
+		Info:     &InstanceInfo{Id: "aws_db_instance.db", Type: "aws_db_instance"},
+		Provider: &provider,
+		From:     &old,
+		State:    &state,
+		Error:    &err,
+	}
+	if _, evalErr := node.Eval(new(MockEvalContext)); evalErr != nil {
+		t.Fatalf("err: %s", evalErr)
+	}
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if from != old || to != state {
+		t.Fatalf("bad: %#v %#v", from, to)
+	}
+}
+
+func TestEvalMigrateData_error(t *testing.T) {
+	var provider ResourceProvider = &testMigrateDataProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		Type:                 "aws_db_instance",
+		MigrateFn: func(info *InstanceInfo, f, t *InstanceState) error {
+			return fmt.Errorf("copy failed")
+		},
+	}
+
+	old := &InstanceState{ID: "old"}
+	state := &InstanceState{ID: "new"}
+	var err error
+	node := &EvalMigrateData{
+		Info:     &InstanceInfo{Id: "aws_db_instance.db", Type: "aws_db_instance"},
+		Provider: &provider,
+		From:     &old,
+		State:    &state,
+		Error:    &err,
+	}
+	if _, evalErr := node.Eval(new(MockEvalContext)); evalErr != nil {
+		t.Fatalf("err: %s", evalErr)
+	}
+	if err == nil || !strings.Contains(err.Error(), "copy failed") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestEvalMigrateData_noMigration(t *testing.T) {
+	called := false
+	var provider ResourceProvider = &testMigrateDataProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		Type:                 "aws_db_instance",
+		MigrateFn: func(info *InstanceInfo, f, t *InstanceState) error {
+			called = true
+			return nil
+		},
+	}
+
+	old := &InstanceState{ID: "old"}
+	state := &InstanceState{ID: "new"}
+	var err error
+	node := &EvalMigrateData{
+		Info:     &InstanceInfo{Id: "aws_instance.web", Type: "aws_instance"},
+		Provider: &provider,
+		From:     &old,
+		State:    &state,
+		Error:    &err,
+	}
+	if _, evalErr := node.Eval(new(MockEvalContext)); evalErr != nil {
+		t.Fatalf("err: %s", evalErr)
+	}
+	if err != nil || called {
+		t.Fatalf("bad: %v %v", err, called)
+	}
+}
+
+type testMigrateDataProvider struct {
+	*MockResourceProvider
+
+	Type      string
+	MigrateFn MigrateDataFunc
+}
+
+func (p *testMigrateDataProvider) DataMigration(t string) MigrateDataFunc {
+	if t == p.Type {
+		return p.MigrateFn
+	}
+
+	return nil
+}
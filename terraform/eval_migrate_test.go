@@ -0,0 +1,130 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvalMigrateAttributes(t *testing.T) {
+	rename := func(from, to string) func(map[string]string) error {
+		return func(attrs map[string]string) error {
+			if v, ok := attrs[from]; ok {
+				attrs[to] = v
+				delete(attrs, from)
+			}
+			return nil
+		}
+	}
+
+	// Out of order to test that they're sorted
+	migrations := []AttributeMigration{
+		AttributeMigration{Version: 2, Migrate: rename("name", "label")},
+		AttributeMigration{Version: 1, Migrate: rename("nm", "name")},
+	}
+
+	cases := map[string]struct {
+		Meta     map[string]string
+		Attrs    map[string]string
+		Expected map[string]string
+		Migrated bool
+	}{
+		"no version": {
+			nil,
+			map[string]string{"id": "foo", "nm": "bar"},
+			map[string]string{"id": "foo", "label": "bar"},
+			true,
+		},
+		"partially migrated": {
+			map[string]string{"schema_version": "1"},
+			map[string]string{"id": "foo", "name": "bar", "nm": "baz"},
+			map[string]string{"id": "foo", "label": "bar", "nm": "baz"},
+			true,
+		},
+		"fully migrated": {
+			map[string]string{"schema_version": "2"},
+			map[string]string{"id": "foo", "name": "bar"},
+			map[string]string{"id": "foo", "name": "bar"},
+			false,
+		},
+	}
+
+	for k, tc := range cases {
+		original := &InstanceState{
+			ID:         "foo",
+			Attributes: tc.Attrs,
+			Meta:       tc.Meta,
+		}
+		before := original.deepcopy()
+		state := original
+		var migrated bool
+		node := &EvalMigrateAttributes{
+			Info:       &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+			State:      &state,
+			Migrations: migrations,
+			Migrated:   &migrated,
+		}
+
+		if _, err := node.Eval(new(MockEvalContext)); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		if !reflect.DeepEqual(state.Attributes, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, state.Attributes)
+		}
+		if v := state.Meta["schema_version"]; v != "2" {
+			t.Fatalf("%s: bad version: %s", k, v)
+		}
+		if migrated != tc.Migrated {
+			t.Fatalf("%s: bad: %t", k, migrated)
+		}
+
+		// A copy is migrated, the instance that was read isn't changed
+		if !reflect.DeepEqual(original, before) {
+			t.Fatalf("%s: bad: %#v", k, original)
+		}
+	}
+}
+
+func TestEvalMigrateAttributes_provider(t *testing.T) {
+	p := &testMigrateProvider{
+		MockResourceProvider: testProvider("aws"),
+		Migrations: []AttributeMigration{
+			AttributeMigration{
+				Version: 1,
+				Migrate: func(attrs map[string]string) error {
+					attrs["new"] = "yes"
+					return nil
+				},
+			},
+		},
+	}
+
+	var provider ResourceProvider = p
+	state := &InstanceState{ID: "foo"}
+	node := &EvalMigrateAttributes{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		Provider: &provider,
+		State:    &state,
+	}
+
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.Type != "aws_instance" {
+		t.Fatalf("bad: %s", p.Type)
+	}
+	if state.Attributes["new"] != "yes" {
+		t.Fatalf("bad: %#v", state.Attributes)
+	}
+}
+
+type testMigrateProvider struct {
+	*MockResourceProvider
+
+	Type       string
+	Migrations []AttributeMigration
+}
+
+func (p *testMigrateProvider) AttributeMigrations(t string) []AttributeMigration {
+	p.Type = t
+	return p.Migrations
+}
@@ -0,0 +1,30 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalCheckModuleBudget is an EvalNode implementation that counts the
+// instances of a resource towards the budgets of the module it is in,
+// see ModuleBudget, and returns an error if the module is over budget.
+//
+// The count must be interpolated already. If it can't be determined yet,
+// the resource isn't counted: validating the count reports that.
+type EvalCheckModuleBudget struct {
+	Resource *config.Resource
+}
+
+func (n *EvalCheckModuleBudget) Eval(ctx EvalContext) (interface{}, error) {
+	count, err := n.Resource.Count()
+	if err != nil || count < 0 {
+		return nil, nil
+	}
+
+	if err := ctx.ModuleBudgets().Add(ctx.Path(), count); err != nil {
+		return nil, fmt.Errorf("%s: %s", n.Resource.Id(), err)
+	}
+
+	return nil, nil
+}
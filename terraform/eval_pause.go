@@ -0,0 +1,43 @@
+package terraform
+
+import (
+	"log"
+)
+
+// EvalPause is an EvalNode implementation that blocks at a pause point
+// until the WaitForContinue hooks return, so that an operator can do a
+// manual step partway through an apply. Anything that depends on the
+// node this is in waits for the pause as well.
+//
+// If the walk is stopped while paused, this returns an early exit error
+// right away without waiting for the hooks.
+type EvalPause struct {
+	Name    string
+	Message string
+}
+
+func (n *EvalPause) Eval(ctx EvalContext) (interface{}, error) {
+	log.Printf("[INFO] %s: paused: %s", n.Name, n.Message)
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.WaitForContinue(n.Name, n.Message)
+		})
+	}()
+
+	select {
+	case err := <-doneCh:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Stopped():
+		// The hooks are left to return on their own, nothing waits
+		// for them anymore.
+		log.Printf("[WARN] %s: stopped while paused", n.Name)
+		return nil, EvalEarlyExitError{}
+	}
+
+	log.Printf("[INFO] %s: continuing", n.Name)
+	return nil, nil
+}
@@ -0,0 +1,46 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestEvalPause(t *testing.T) {
+	hook := new(MockHook)
+	ctx := &MockEvalContext{HookHook: hook}
+
+	n := &EvalPause{Name: "foo", Message: "run the migration"}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !hook.WaitForContinueCalled {
+		t.Fatal("should be called")
+	}
+	if hook.WaitForContinueName != "foo" {
+		t.Fatalf("bad: %s", hook.WaitForContinueName)
+	}
+	if hook.WaitForContinueMessage != "run the migration" {
+		t.Fatalf("bad: %s", hook.WaitForContinueMessage)
+	}
+}
+
+func TestEvalPause_stopped(t *testing.T) {
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+
+	hook := &MockHook{
+		WaitForContinueFn: func(string, string) (HookAction, error) {
+			<-blockCh
+			return HookActionContinue, nil
+		},
+	}
+	stopCh := make(chan struct{})
+	close(stopCh)
+	ctx := &MockEvalContext{HookHook: hook, StoppedCh: stopCh}
+
+	n := &EvalPause{Name: "foo"}
+	_, err := n.Eval(ctx)
+	if _, ok := err.(EvalEarlyExitError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+}
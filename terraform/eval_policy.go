@@ -0,0 +1,45 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+)
+
+// EvalPolicyGate is an EvalNode implementation that submits the diff of a
+// resource to the policy configured on the context, and errors if the
+// policy denies the change. If no policy is configured, every change is
+// allowed.
+type EvalPolicyGate struct {
+	Info *InstanceInfo
+	Diff **InstanceDiff
+}
+
+func (n *EvalPolicyGate) Eval(ctx EvalContext) (interface{}, error) {
+	policy := ctx.Policy()
+	if policy == nil {
+		return nil, nil
+	}
+
+	diff := *n.Diff
+	if diff.Empty() {
+		return nil, nil
+	}
+
+	decision, err := policy.Check(n.Info, diff)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%s: error checking policy: %s", n.Info.HumanId(), err)
+	}
+	if decision == nil || !decision.Allowed {
+		reason := "no reason given"
+		if decision != nil && decision.Reason != "" {
+			reason = decision.Reason
+		}
+
+		return nil, fmt.Errorf(
+			"%s: change denied by policy: %s", n.Info.HumanId(), reason)
+	}
+
+	log.Printf("[DEBUG] %s: change allowed by policy", n.Info.HumanId())
+	return nil, nil
+}
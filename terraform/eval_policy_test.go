@@ -0,0 +1,83 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvalPolicyGate(t *testing.T) {
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+		},
+	}
+
+	cases := map[string]struct {
+		Diff     *InstanceDiff
+		Decision *PolicyDecision
+		Err      error
+		Called   bool
+		Errors   string
+	}{
+		"allowed": {
+			Diff:     diff,
+			Decision: &PolicyDecision{Allowed: true},
+			Called:   true,
+		},
+		"denied": {
+			Diff:     diff,
+			Decision: &PolicyDecision{Reason: "no ami changes"},
+			Called:   true,
+			Errors:   "change denied by policy: no ami changes",
+		},
+		"error": {
+			Diff:   diff,
+			Err:    fmt.Errorf("unreachable"),
+			Called: true,
+			Errors: "error checking policy: unreachable",
+		},
+		"empty diff": {
+			Diff:     nil,
+			Decision: &PolicyDecision{},
+		},
+	}
+
+	for k, tc := range cases {
+		policy := &MockPolicy{
+			CheckReturn:      tc.Decision,
+			CheckReturnError: tc.Err,
+		}
+		ctx := &MockEvalContext{PolicyPolicy: policy}
+
+		node := &EvalPolicyGate{
+			Info: &InstanceInfo{Id: "aws_instance.foo"},
+			Diff: &tc.Diff,
+		}
+		_, err := node.Eval(ctx)
+		if policy.CheckCalled != tc.Called {
+			t.Fatalf("%s: bad called: %#v", k, policy.CheckCalled)
+		}
+		if tc.Errors == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.Errors) {
+			t.Fatalf("%s: bad err: %s", k, err)
+		}
+	}
+}
+
+func TestEvalPolicyGate_noPolicy(t *testing.T) {
+	diff := &InstanceDiff{Destroy: true}
+	node := &EvalPolicyGate{
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		Diff: &diff,
+	}
+
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
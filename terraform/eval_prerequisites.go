@@ -0,0 +1,97 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// EvalEnsurePrerequisites is an EvalNode implementation that ensures the
+// implicit prerequisites of the given resource types exist, for the
+// providers that implement ResourceProviderPrerequisiter.
+//
+// Only the types of resources that the diff would create or update are
+// considered: a destroy never needs the prerequisites to be created. Each
+// prerequisite is ensured once, no matter how many types need it.
+type EvalEnsurePrerequisites struct {
+	Provider *ResourceProvider
+	Types    []string
+}
+
+func (n *EvalEnsurePrerequisites) Eval(ctx EvalContext) (interface{}, error) {
+	p, ok := (*n.Provider).(ResourceProviderPrerequisiter)
+	if !ok {
+		return nil, nil
+	}
+
+	changed := n.changedTypes(ctx)
+
+	seen := make(map[string]struct{})
+	names := make([]string, 0, len(changed))
+	for _, t := range n.Types {
+		if _, ok := changed[t]; !ok {
+			continue
+		}
+
+		for _, name := range p.Prerequisites(t) {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ctx.DryRun() {
+			log.Printf("[INFO] Dry run, not ensuring prerequisite %q", name)
+			continue
+		}
+
+		log.Printf("[DEBUG] Ensuring prerequisite %q exists", name)
+		if err := p.EnsurePrerequisite(name); err != nil {
+			return nil, fmt.Errorf(
+				"error ensuring prerequisite %q: %s", name, err)
+		}
+	}
+
+	return nil, nil
+}
+
+// changedTypes returns the set of resource types that have resources in
+// the diff of the current module that aren't only destroyed. Replaced
+// resources are created again, so they count.
+func (n *EvalEnsurePrerequisites) changedTypes(
+	ctx EvalContext) map[string]struct{} {
+	result := make(map[string]struct{})
+
+	diff, lock := ctx.Diff()
+	if diff == nil {
+		return result
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	md := diff.ModuleByPath(ctx.Path())
+	if md == nil {
+		return result
+	}
+
+	for k, rd := range md.Resources {
+		if rd.Empty() || (rd.Destroy && !rd.RequiresNew()) {
+			continue
+		}
+
+		t := k
+		if idx := strings.IndexRune(k, '.'); idx != -1 {
+			t = k[:idx]
+		}
+		result[t] = struct{}{}
+	}
+
+	return result
+}
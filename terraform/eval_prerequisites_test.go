@@ -0,0 +1,80 @@
+package terraform
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEvalEnsurePrerequisites(t *testing.T) {
+	p := &testPrerequisiteProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		PrerequisitesMap: map[string][]string{
+			"aws_instance": []string{"vpc", "role"},
+			"aws_eip":      []string{"vpc"},
+			"aws_elb":      []string{"elb-role"},
+		},
+	}
+	var provider ResourceProvider = p
+
+	ctx := &MockEvalContext{
+		PathPath: rootModulePath,
+		DiffDiff: &Diff{
+			Modules: []*ModuleDiff{
+				&ModuleDiff{
+					Path: rootModulePath,
+					Resources: map[string]*InstanceDiff{
+						"aws_instance.foo.0": &InstanceDiff{
+							Attributes: map[string]*ResourceAttrDiff{
+								"ami": &ResourceAttrDiff{New: "bar"},
+							},
+						},
+						"aws_eip.foo": &InstanceDiff{
+							Attributes: map[string]*ResourceAttrDiff{
+								"instance": &ResourceAttrDiff{New: "bar"},
+							},
+						},
+						"aws_elb.foo": &InstanceDiff{Destroy: true},
+					},
+				},
+			},
+		},
+		DiffLock: new(sync.RWMutex),
+	}
+
+	n := &EvalEnsurePrerequisites{
+		Provider: &provider,
+		Types:    []string{"aws_eip", "aws_elb", "aws_instance"},
+	}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"role", "vpc"}
+	if !reflect.DeepEqual(p.Ensured, expected) {
+		t.Fatalf("bad: %#v", p.Ensured)
+	}
+}
+
+// testPrerequisiteProvider is a MockResourceProvider that has implicit
+// prerequisites for some resource types.
+type testPrerequisiteProvider struct {
+	*MockResourceProvider
+
+	PrerequisitesMap map[string][]string
+
+	lock    sync.Mutex
+	Ensured []string
+}
+
+func (p *testPrerequisiteProvider) Prerequisites(t string) []string {
+	return p.PrerequisitesMap[t]
+}
+
+func (p *testPrerequisiteProvider) EnsurePrerequisite(name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.Ensured = append(p.Ensured, name)
+	return nil
+}
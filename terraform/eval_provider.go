@@ -143,3 +143,16 @@ func (n *EvalInputProvider) Eval(ctx EvalContext) (interface{}, error) {
 
 	return nil, nil
 }
+
+// acquireProvider blocks until another call can be made to the provider
+// under its concurrency limit, if it has one. The returned function must
+// be called once the call to the provider is done.
+func acquireProvider(ctx EvalContext, p ResourceProvider) func() {
+	sem := ctx.ProviderSemaphore(p)
+	if sem == nil {
+		return func() {}
+	}
+
+	sem.Acquire()
+	return sem.Release
+}
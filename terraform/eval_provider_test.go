@@ -151,3 +151,40 @@ func TestEvalGetProvider(t *testing.T) {
 		t.Fatalf("bad: %#v", ctx.ProviderName)
 	}
 }
+
+func TestAcquireProvider(t *testing.T) {
+	p := &MockResourceProvider{}
+
+	// No semaphore, nothing to acquire
+	ctx := &MockEvalContext{}
+	acquireProvider(ctx, p)()
+	if !ctx.ProviderSemaphoreCalled {
+		t.Fatal("should be called")
+	}
+	if ctx.ProviderSemaphoreProvider != p {
+		t.Fatalf("bad: %#v", ctx.ProviderSemaphoreProvider)
+	}
+
+	sem := NewSemaphore(1)
+	ctx = &MockEvalContext{ProviderSemaphoreSemaphore: sem}
+	release := acquireProvider(ctx, p)
+	if sem.TryAcquire() {
+		t.Fatal("should be acquired")
+	}
+	release()
+	if !sem.TryAcquire() {
+		t.Fatal("should be released")
+	}
+}
+
+// testLimitedProvider is a MockResourceProvider that advertises a
+// concurrency limit.
+type testLimitedProvider struct {
+	*MockResourceProvider
+
+	Limit int
+}
+
+func (p *testLimitedProvider) ConcurrencyLimit() int {
+	return p.Limit
+}
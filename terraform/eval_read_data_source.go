@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalReadDataSource is an EvalNode implementation that reads a data
+// source from its provider. The state it outputs replaces whatever was
+// read before; data sources are never diffed.
+type EvalReadDataSource struct {
+	Provider *ResourceProvider
+	Config   **ResourceConfig
+	Info     *InstanceInfo
+	Output   **InstanceState
+
+	// Placeholder, if set, makes a configuration that isn't known yet
+	// output a placeholder state instead of nothing, see
+	// dataSourcePlaceholder. This is set when planning, so that the
+	// dependents see computed values and the apply reads the data source.
+	Placeholder bool
+}
+
+func (n *EvalReadDataSource) Eval(ctx EvalContext) (interface{}, error) {
+	// A configuration that isn't known yet can't be read. The output is
+	// cleared so that the attributes are unknown to the dependents rather
+	// than left over from the last read.
+	if len((*n.Config).ComputedKeys) > 0 {
+		log.Printf(
+			"[DEBUG] %s: the config isn't known yet, not reading", n.Info.Id)
+		if n.Output != nil {
+			*n.Output = nil
+			if n.Placeholder {
+				*n.Output = dataSourcePlaceholder()
+			}
+		}
+		return nil, nil
+	}
+
+	provider := *n.Provider
+	reader, ok := provider.(ResourceProviderDataSourceReader)
+	if !ok {
+		return nil, fmt.Errorf(
+			"%s: the provider doesn't support data sources", n.Info.Id)
+	}
+
+	release := acquireProvider(ctx, provider)
+	state, err := reader.ReadDataSource(n.Info, *n.Config)
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.Info.Id, err)
+	}
+	if state == nil || state.ID == "" {
+		return nil, fmt.Errorf(
+			"%s: the provider didn't return an ID for the data source",
+			n.Info.Id)
+	}
+
+	if n.Output != nil {
+		*n.Output = state
+	}
+
+	return nil, nil
+}
+
+// dataSourcePlaceholder returns the state of a data source that is to be
+// read during the apply since its configuration isn't known when
+// planning. Every attribute of it is computed, see Interpolater.
+func dataSourcePlaceholder() *InstanceState {
+	return &InstanceState{
+		ID: config.UnknownVariableValue,
+		Attributes: map[string]string{
+			"id": config.UnknownVariableValue,
+		},
+	}
+}
+
+// isDataSourcePlaceholder returns true if the state is a placeholder
+// from dataSourcePlaceholder.
+func isDataSourcePlaceholder(s *InstanceState) bool {
+	return s != nil && s.ID == config.UnknownVariableValue
+}
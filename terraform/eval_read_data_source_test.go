@@ -0,0 +1,162 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+// testDataSourceProvider is a MockResourceProvider that provides data
+// sources, see ResourceProviderDataSourceReader.
+type testDataSourceProvider struct {
+	*MockResourceProvider
+
+	ReadDataSourceCalled bool
+	ReadDataSourceConfig *ResourceConfig
+	ReadDataSourceFn     func(*InstanceInfo, *ResourceConfig) (*InstanceState, error)
+}
+
+func (p *testDataSourceProvider) ReadDataSource(
+	info *InstanceInfo, c *ResourceConfig) (*InstanceState, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.ReadDataSourceCalled = true
+	p.ReadDataSourceConfig = c
+	return p.ReadDataSourceFn(info, c)
+}
+
+// testDataSourceProviderFor wraps the mock so that it provides the data
+// source "aws_ami", which always reads as "ami-123".
+func testDataSourceProviderFor(p *MockResourceProvider) *testDataSourceProvider {
+	return &testDataSourceProvider{
+		MockResourceProvider: p,
+		ReadDataSourceFn: func(
+			*InstanceInfo, *ResourceConfig) (*InstanceState, error) {
+			return &InstanceState{
+				ID:         "ami-123",
+				Attributes: map[string]string{"id": "ami-123"},
+			}, nil
+		},
+	}
+}
+
+func TestEvalReadDataSource(t *testing.T) {
+	p := &testDataSourceProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		ReadDataSourceFn: func(
+			info *InstanceInfo, c *ResourceConfig) (*InstanceState, error) {
+			name, _ := c.Get("name")
+			return &InstanceState{
+				ID:         "ami-123",
+				Attributes: map[string]string{"name": name.(string)},
+			}, nil
+		},
+	}
+	var provider ResourceProvider = p
+	rc := testResourceConfig(t, map[string]interface{}{"name": "ubuntu"})
+
+	var state *InstanceState
+	node := &EvalReadDataSource{
+		Provider: &provider,
+		Config:   &rc,
+		Info:     &InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"},
+		Output:   &state,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !p.ReadDataSourceCalled {
+		t.Fatal("should read the data source")
+	}
+	if state == nil || state.ID != "ami-123" || state.Attributes["name"] != "ubuntu" {
+		t.Fatalf("bad: %#v", state)
+	}
+}
+
+func TestEvalReadDataSource_computed(t *testing.T) {
+	p := &testDataSourceProvider{MockResourceProvider: new(MockResourceProvider)}
+	var provider ResourceProvider = p
+	rc := &ResourceConfig{ComputedKeys: []string{"name"}}
+
+	// The previous read is cleared
+	state := &InstanceState{ID: "ami-123"}
+	node := &EvalReadDataSource{
+		Provider: &provider,
+		Config:   &rc,
+		Info:     &InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"},
+		Output:   &state,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.ReadDataSourceCalled {
+		t.Fatal("shouldn't read the data source")
+	}
+	if state != nil {
+		t.Fatalf("bad: %#v", state)
+	}
+}
+
+func TestEvalReadDataSource_computedPlaceholder(t *testing.T) {
+	p := &testDataSourceProvider{MockResourceProvider: new(MockResourceProvider)}
+	var provider ResourceProvider = p
+	rc := &ResourceConfig{ComputedKeys: []string{"name"}}
+
+	state := &InstanceState{ID: "ami-123"}
+	node := &EvalReadDataSource{
+		Provider:    &provider,
+		Config:      &rc,
+		Info:        &InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"},
+		Output:      &state,
+		Placeholder: true,
+	}
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.ReadDataSourceCalled {
+		t.Fatal("shouldn't read the data source")
+	}
+	if !isDataSourcePlaceholder(state) {
+		t.Fatalf("bad: %#v", state)
+	}
+}
+
+func TestEvalReadDataSource_noID(t *testing.T) {
+	p := &testDataSourceProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		ReadDataSourceFn: func(
+			*InstanceInfo, *ResourceConfig) (*InstanceState, error) {
+			return &InstanceState{}, nil
+		},
+	}
+	var provider ResourceProvider = p
+	rc := testResourceConfig(t, map[string]interface{}{})
+
+	node := &EvalReadDataSource{
+		Provider: &provider,
+		Config:   &rc,
+		Info:     &InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"},
+	}
+	_, err := node.Eval(new(MockEvalContext))
+	if err == nil || !strings.Contains(err.Error(), "didn't return an ID") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestEvalReadDataSource_unsupported(t *testing.T) {
+	var provider ResourceProvider = new(MockResourceProvider)
+	rc := testResourceConfig(t, map[string]interface{}{})
+
+	node := &EvalReadDataSource{
+		Provider: &provider,
+		Config:   &rc,
+		Info:     &InstanceInfo{Id: "data.aws_ami.foo", Type: "aws_ami"},
+	}
+	_, err := node.Eval(new(MockEvalContext))
+	if err == nil || !strings.Contains(err.Error(), "doesn't support data sources") {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -33,8 +33,17 @@ func (n *EvalRefresh) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, err
 	}
 
+	// Keep the attributes before the refresh to report the drift, the
+	// provider may change the state in place.
+	before := make(map[string]string, len(state.Attributes))
+	for k, v := range state.Attributes {
+		before[k] = v
+	}
+
 	// Refresh!
+	release := acquireProvider(ctx, provider)
 	state, err = provider.Refresh(n.Info, state)
+	release()
 	if err != nil {
 		return nil, fmt.Errorf("%s: %s", n.Info.Id, err.Error())
 	}
@@ -47,6 +56,20 @@ func (n *EvalRefresh) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, err
 	}
 
+	// Report what changed outside of Terraform
+	var after map[string]string
+	if state != nil {
+		after = state.Attributes
+	}
+	if changes := attributeChanges(before, after); len(changes) > 0 {
+		err = ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PostRefreshDrift(n.Info, changes)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if n.Output != nil {
 		*n.Output = state
 	}
@@ -0,0 +1,20 @@
+package terraform
+
+// EvalResolve is an EvalNode implementation that reports to the
+// PostResolve hook that the state of a resource instance is available.
+// This doesn't change the apply in any way.
+type EvalResolve struct {
+	Info         *InstanceInfo
+	Dependencies []string
+}
+
+func (n *EvalResolve) Eval(ctx EvalContext) (interface{}, error) {
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostResolve(n.Info, n.Dependencies)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -9,5 +9,6 @@ type EvalInstanceInfo struct {
 // TODO: test
 func (n *EvalInstanceInfo) Eval(ctx EvalContext) (interface{}, error) {
 	n.Info.ModulePath = ctx.Path()
+	n.Info.CorrelationId = ctx.CorrelationId(n.Info.Id)
 	return nil, nil
 }
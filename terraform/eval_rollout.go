@@ -0,0 +1,69 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+)
+
+// EvalRolloutGate is an EvalNode implementation for the gate between two
+// waves of a rollout, see config.ResourceLifecycle.RolloutPercent. The
+// instances of the next wave depend on the node this is in, which depends
+// on the instances of the wave before, so the next wave is only started
+// once the wave before succeeded.
+//
+// If Message is set, this pauses like EvalPause until the operator
+// continues, but only if there is anything left to change after it. The
+// diffs of the instances before it are already cleared by their apply.
+type EvalRolloutGate struct {
+	Name    string
+	Wave    int
+	Waves   int
+	Message string
+
+	// After are the state IDs of the instances in the waves after the
+	// gate.
+	After []string
+}
+
+func (n *EvalRolloutGate) Eval(ctx EvalContext) (interface{}, error) {
+	log.Printf("[INFO] %s: wave %d of %d done", n.Name, n.Wave, n.Waves)
+	if n.Message == "" {
+		return nil, nil
+	}
+
+	if !instancesChanged(ctx, n.After) {
+		return nil, nil
+	}
+
+	pause := &EvalPause{
+		Name: n.Name,
+		Message: fmt.Sprintf(
+			"%s (wave %d of %d done)", n.Message, n.Wave, n.Waves),
+	}
+	return pause.Eval(ctx)
+}
+
+// instancesChanged returns true if the diff has a change for any of the
+// instances with the state IDs in the module of the context.
+func instancesChanged(ctx EvalContext, ids []string) bool {
+	diff, lock := ctx.Diff()
+	if diff == nil {
+		return false
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	md := diff.ModuleByPath(ctx.Path())
+	if md == nil {
+		return false
+	}
+
+	for _, id := range ids {
+		if d, ok := md.Resources[id]; ok && !d.Empty() {
+			return true
+		}
+	}
+
+	return false
+}
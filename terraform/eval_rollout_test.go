@@ -0,0 +1,58 @@
+package terraform
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestEvalRolloutGate(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo.0": &InstanceDiff{Destroy: true},
+					"aws_instance.foo.1": &InstanceDiff{Destroy: true},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		After []string
+		Pause bool
+	}{
+		{[]string{"aws_instance.foo.1", "aws_instance.foo.2"}, true},
+
+		// Nothing left to change after the gate
+		{[]string{"aws_instance.foo.2"}, false},
+	}
+
+	for i, tc := range cases {
+		hook := new(MockHook)
+		ctx := &MockEvalContext{
+			HookHook: hook,
+			PathPath: rootModulePath,
+			DiffDiff: diff,
+			DiffLock: new(sync.RWMutex),
+		}
+
+		n := &EvalRolloutGate{
+			Name:    "aws_instance.foo",
+			Wave:    1,
+			Waves:   2,
+			Message: "verify",
+			After:   tc.After,
+		}
+		if _, err := n.Eval(ctx); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		if hook.WaitForContinueCalled != tc.Pause {
+			t.Fatalf("%d: bad: %#v", i, hook)
+		}
+		if tc.Pause && hook.WaitForContinueMessage != "verify (wave 1 of 2 done)" {
+			t.Fatalf("%d: bad: %s", i, hook.WaitForContinueMessage)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// EvalReadSecrets is an EvalNode implementation that reads the secrets
+// for the provisioners of a resource from the provider. The secrets are
+// only written to Output, never to the state. Providers that don't
+// implement ResourceProviderSecretReader have no secrets.
+//
+// If Error is set, an error reading the secrets is appended to it
+// instead of being returned, so the resource is tainted like it would
+// be if the provisioners failed.
+type EvalReadSecrets struct {
+	Info     *InstanceInfo
+	Provider *ResourceProvider
+	State    **InstanceState
+	Output   *map[string]string
+	Error    *error
+}
+
+func (n *EvalReadSecrets) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	if state == nil || state.ID == "" {
+		return nil, nil
+	}
+
+	reader, ok := (*n.Provider).(ResourceProviderSecretReader)
+	if !ok {
+		return nil, nil
+	}
+
+	secrets, err := reader.ReadSecrets(n.Info, state)
+	if err != nil {
+		err = fmt.Errorf("%s: error reading secrets: %s", n.Info.Id, err)
+		if n.Error != nil {
+			*n.Error = multierror.Append(*n.Error, err)
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] %s: read %d secret(s)", n.Info.logId(), len(secrets))
+	if n.Output != nil {
+		*n.Output = secrets
+	}
+
+	return nil, nil
+}
+
+// redactSecrets replaces the values of the secrets in the string, so
+// that they're never in any output.
+func redactSecrets(s string, secrets map[string]string) string {
+	for _, v := range secrets {
+		if v == "" {
+			continue
+		}
+
+		s = strings.Replace(s, v, "<secret>", -1)
+	}
+
+	return s
+}
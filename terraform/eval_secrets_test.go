@@ -0,0 +1,101 @@
+package terraform
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEvalReadSecrets(t *testing.T) {
+	var provider ResourceProvider = &testSecretsProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		Secrets:              map[string]string{"password": "hunter2"},
+	}
+	state := &InstanceState{ID: "foo"}
+
+	var secrets map[string]string
+	n := &EvalReadSecrets{
+		Info:     &InstanceInfo{Id: "aws_instance.foo"},
+		Provider: &provider,
+		State:    &state,
+		Output:   &secrets,
+	}
+	if _, err := n.Eval(nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{"password": "hunter2"}
+	if !reflect.DeepEqual(secrets, expected) {
+		t.Fatalf("bad: %#v", secrets)
+	}
+	if len(state.Attributes) != 0 {
+		t.Fatalf("secrets should not be in the state: %#v", state)
+	}
+}
+
+func TestEvalReadSecrets_error(t *testing.T) {
+	var provider ResourceProvider = &testSecretsProvider{
+		MockResourceProvider: new(MockResourceProvider),
+		Error:                fmt.Errorf("no password yet"),
+	}
+	state := &InstanceState{ID: "foo"}
+
+	var err error
+	n := &EvalReadSecrets{
+		Info:     &InstanceInfo{Id: "aws_instance.foo"},
+		Provider: &provider,
+		State:    &state,
+		Error:    &err,
+	}
+	if _, err := n.Eval(nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestEvalReadSecrets_noReader(t *testing.T) {
+	var provider ResourceProvider = new(MockResourceProvider)
+	state := &InstanceState{ID: "foo"}
+
+	var secrets map[string]string
+	n := &EvalReadSecrets{
+		Info:     &InstanceInfo{Id: "aws_instance.foo"},
+		Provider: &provider,
+		State:    &state,
+		Output:   &secrets,
+	}
+	if _, err := n.Eval(nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if secrets != nil {
+		t.Fatalf("bad: %#v", secrets)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	secrets := map[string]string{
+		"password": "hunter2",
+		"empty":    "",
+	}
+
+	actual := redactSecrets("login with hunter2", secrets)
+	if actual != "login with <secret>" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+// testSecretsProvider is a provider that implements
+// ResourceProviderSecretReader.
+type testSecretsProvider struct {
+	*MockResourceProvider
+
+	Secrets map[string]string
+	Error   error
+}
+
+func (p *testSecretsProvider) ReadSecrets(
+	*InstanceInfo, *InstanceState) (map[string]string, error) {
+	return p.Secrets, p.Error
+}
@@ -21,3 +21,51 @@ func (n *EvalSequence) Filter(fn EvalNodeFilterFunc) {
 		n.Nodes[i] = fn(node)
 	}
 }
+
+// EvalValidateSequence is an EvalNode that evaluates in sequence like
+// EvalSequence, but that keeps going when a node returns validation errors
+// so that all of them are reported at once instead of one at a time.
+//
+// The warnings and errors of every EvalValidateError are combined into a
+// single EvalValidateError. Any other error, including EvalEarlyExitError,
+// stops the sequence, since the nodes after it usually depend on what
+// failed.
+type EvalValidateSequence struct {
+	Nodes []EvalNode
+}
+
+func (n *EvalValidateSequence) Eval(ctx EvalContext) (interface{}, error) {
+	var result EvalValidateError
+	for _, n := range n.Nodes {
+		_, err := EvalRaw(n, ctx)
+		if err == nil {
+			continue
+		}
+
+		verr, ok := err.(*EvalValidateError)
+		if !ok {
+			// Don't lose what was already found for an early exit.
+			if _, early := err.(EvalEarlyExitError); !early || !result.any() {
+				return nil, err
+			}
+
+			break
+		}
+
+		result.Warnings = append(result.Warnings, verr.Warnings...)
+		result.Errors = append(result.Errors, verr.Errors...)
+	}
+
+	if !result.any() {
+		return nil, nil
+	}
+
+	return nil, &result
+}
+
+// EvalNodeFilterable impl.
+func (n *EvalValidateSequence) Filter(fn EvalNodeFilterFunc) {
+	for i, node := range n.Nodes {
+		n.Nodes[i] = fn(node)
+	}
+}
@@ -1,9 +1,127 @@
 package terraform
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 )
 
 func TestEvalSequence_impl(t *testing.T) {
 	var _ EvalNodeFilterable = new(EvalSequence)
 }
+
+func TestEvalValidateSequence_impl(t *testing.T) {
+	var _ EvalNodeFilterable = new(EvalValidateSequence)
+}
+
+func TestEvalValidateSequence(t *testing.T) {
+	var ran bool
+	n := &EvalValidateSequence{
+		Nodes: []EvalNode{
+			&testEvalError{Err: &EvalValidateError{
+				Warnings: []string{"one"},
+				Errors:   []error{errors.New("one")},
+			}},
+			EvalNoop{},
+			&testEvalError{Err: &EvalValidateError{
+				Errors: []error{errors.New("two")},
+			}},
+			&testEvalRan{Ran: &ran},
+		},
+	}
+
+	_, err := n.Eval(new(MockEvalContext))
+	verr, ok := err.(*EvalValidateError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !reflect.DeepEqual(verr.Warnings, []string{"one"}) {
+		t.Fatalf("bad: %#v", verr.Warnings)
+	}
+	if len(verr.Errors) != 2 ||
+		verr.Errors[0].Error() != "one" || verr.Errors[1].Error() != "two" {
+		t.Fatalf("bad: %#v", verr.Errors)
+	}
+	if !ran {
+		t.Fatal("should run every node")
+	}
+}
+
+func TestEvalValidateSequence_none(t *testing.T) {
+	n := &EvalValidateSequence{Nodes: []EvalNode{EvalNoop{}}}
+	if _, err := n.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestEvalValidateSequence_error(t *testing.T) {
+	var ran bool
+	n := &EvalValidateSequence{
+		Nodes: []EvalNode{
+			&testEvalError{Err: &EvalValidateError{
+				Errors: []error{errors.New("one")},
+			}},
+			&testEvalError{Err: errors.New("failed")},
+			&testEvalRan{Ran: &ran},
+		},
+	}
+
+	_, err := n.Eval(new(MockEvalContext))
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("bad: %#v", err)
+	}
+	if ran {
+		t.Fatal("shouldn't run after an error")
+	}
+}
+
+func TestEvalValidateSequence_earlyExit(t *testing.T) {
+	var ran bool
+	n := &EvalValidateSequence{
+		Nodes: []EvalNode{
+			&testEvalError{Err: EvalEarlyExitError{}},
+			&testEvalRan{Ran: &ran},
+		},
+	}
+
+	_, err := n.Eval(new(MockEvalContext))
+	if _, ok := err.(EvalEarlyExitError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if ran {
+		t.Fatal("shouldn't run after an early exit")
+	}
+
+	// What was found before the early exit is still reported
+	n.Nodes = append([]EvalNode{
+		&testEvalError{Err: &EvalValidateError{
+			Errors: []error{errors.New("one")},
+		}},
+	}, n.Nodes...)
+	_, err = n.Eval(new(MockEvalContext))
+	if verr, ok := err.(*EvalValidateError); !ok || len(verr.Errors) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if ran {
+		t.Fatal("shouldn't run after an early exit")
+	}
+}
+
+// testEvalError is an EvalNode that returns an error.
+type testEvalError struct {
+	Err error
+}
+
+func (n *testEvalError) Eval(EvalContext) (interface{}, error) {
+	return nil, n.Err
+}
+
+// testEvalRan is an EvalNode that records that it was evaluated.
+type testEvalRan struct {
+	Ran *bool
+}
+
+func (n *testEvalRan) Eval(EvalContext) (interface{}, error) {
+	*n.Ran = true
+	return nil, nil
+}
@@ -2,19 +2,216 @@ package terraform
 
 import (
 	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/config"
 )
 
+// StaleStateError is returned when the state in memory is older than the
+// state in the backend.
+type StaleStateError struct {
+	Serial        int64
+	BackendSerial int64
+}
+
+func (e *StaleStateError) Error() string {
+	return fmt.Sprintf(
+		"State is stale: serial %d in memory, but %d in the backend. Another "+
+			"process may have modified the state; refresh and try again.",
+		e.Serial, e.BackendSerial)
+}
+
 // EvalReadState is an EvalNode implementation that reads the
 // primary InstanceState for a specific resource out of the state.
+//
+// If Backend is set, the serial of the state is checked against the
+// backend before the read. If the backend has a newer state, then the
+// instance is read from the state of the backend if Reload is true, or a
+// StaleStateError is returned otherwise. The state of the walk is left as
+// it is either way, since it has the writes of the walk so far.
+//
+// If Clean is true, the primary is only read if it is clean, see
+// ResourceState.CleanPrimary. This is for reads on behalf of dependents;
+// the recovery logic needs the primary as it is.
+//
+// Reads are served from the StateReadCache of the walk when they can be.
+//
+// If Path is set, the instance is read from the module with that path,
+// such as []string{"root", "foo"} for module.foo, instead of from the
+// module of the walk. It is an error if that module isn't in the state.
+//
+// If Recover is true, the instance that is read is checked for corruption,
+// such as from a truncated write or a manual edit, see
+// instanceStateCorruption. A corrupted instance is only logged, unless
+// the context recovers the state, see ContextOpts.RecoverState. Then the
+// output is a new instance with only the ID that could be salvaged, for
+// the refresh that follows to rebuild from the provider. This leaves the
+// state itself alone until then, and instances that aren't corrupted are
+// never changed.
 type EvalReadState struct {
-	Name   string
-	Output **InstanceState
+	Name    string
+	Output  **InstanceState
+	Clean   bool
+	Recover bool
+	Path    []string
+
+	Backend StateBackend
+	Reload  bool
 }
 
 func (n *EvalReadState) Eval(ctx EvalContext) (interface{}, error) {
-	return readInstanceFromState(ctx, n.Name, n.Output, func(rs *ResourceState) (*InstanceState, error) {
-		return rs.Primary, nil
-	})
+	var latest *State
+	if n.Backend != nil {
+		var err error
+		if latest, err = n.checkStale(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	kind := "primary"
+	if n.Clean {
+		kind = "clean"
+	}
+	path := n.Path
+	if path == nil {
+		path = ctx.Path()
+	}
+	var is *InstanceState
+	var ok bool
+	if latest != nil {
+		is, ok = n.readLatest(latest, path), true
+	} else {
+		is, ok = ctx.StateCache().Get(path, n.Name, kind)
+	}
+	if !ok {
+		var err error
+		is, err = readInstanceFromState(ctx, n.Path, n.Name, kind, nil, func(rs *ResourceState) (*InstanceState, error) {
+			if n.Clean {
+				return rs.CleanPrimary(), nil
+			}
+
+			return rs.Primary, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if n.Recover {
+		var err error
+		is, err = n.recover(ctx, is)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if n.Output != nil {
+		*n.Output = is
+	}
+
+	return is, nil
+}
+
+// recover returns the instance to refresh in place of the given one if it
+// is corrupted. See EvalReadState.
+func (n *EvalReadState) recover(
+	ctx EvalContext, is *InstanceState) (*InstanceState, error) {
+	reason := instanceStateCorruption(is)
+	if reason == "" {
+		return is, nil
+	}
+
+	if !ctx.RecoverState() {
+		log.Printf("[WARN] %s: the state is corrupted: %s", n.Name, reason)
+		return is, nil
+	}
+
+	id := is.ID
+	if id == "" {
+		id = is.Attributes["id"]
+	}
+	if id == "" {
+		return nil, fmt.Errorf(
+			"%s: the state is corrupted (%s) and has no ID to rebuild "+
+				"it from. Remove it from the state and import it again.",
+			n.Name, reason)
+	}
+
+	log.Printf(
+		"[WARN] %s: the state is corrupted: %s. Rebuilding it from the "+
+			"provider with the ID %q", n.Name, reason, id)
+	result := &InstanceState{
+		ID:         id,
+		Attributes: map[string]string{"id": id},
+	}
+	if is.Meta != nil {
+		result.Meta = make(map[string]string, len(is.Meta))
+		for k, v := range is.Meta {
+			result.Meta[k] = v
+		}
+	}
+
+	return result, nil
+}
+
+// checkStale compares the serial of the state with the backend. It
+// returns the state of the backend if it is newer and Reload is true, or
+// nil if the state isn't stale.
+func (n *EvalReadState) checkStale(ctx EvalContext) (*State, error) {
+	latest, err := n.Backend.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error checking state for staleness: %s", err)
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	var serial int64
+	state, lock := ctx.State()
+	if state != nil {
+		lock.RLock()
+		serial = state.Serial
+		lock.RUnlock()
+	}
+
+	if latest.Serial <= serial {
+		return nil, nil
+	}
+
+	if !n.Reload {
+		return nil, &StaleStateError{
+			Serial:        serial,
+			BackendSerial: latest.Serial,
+		}
+	}
+
+	log.Printf(
+		"[INFO] %s: reading from the stale state's backend: serial %d, "+
+			"backend serial %d", n.Name, serial, latest.Serial)
+	return latest, nil
+}
+
+// readLatest returns the instance in the state of the backend, see
+// checkStale.
+func (n *EvalReadState) readLatest(latest *State, path []string) *InstanceState {
+	mod := latest.ModuleByPath(path)
+	if mod == nil {
+		return nil
+	}
+
+	rs := mod.Resources[n.Name]
+	if rs == nil {
+		return nil
+	}
+
+	if n.Clean {
+		return rs.CleanPrimary()
+	}
+
+	return rs.Primary
 }
 
 // EvalReadStateTainted is an EvalNode implementation that reads a
@@ -28,7 +225,7 @@ type EvalReadStateTainted struct {
 }
 
 func (n *EvalReadStateTainted) Eval(ctx EvalContext) (interface{}, error) {
-	return readInstanceFromState(ctx, n.Name, n.Output, func(rs *ResourceState) (*InstanceState, error) {
+	return readInstanceFromState(ctx, nil, n.Name, "", n.Output, func(rs *ResourceState) (*InstanceState, error) {
 		// Get the index. If it is negative, then we get the last one
 		idx := n.Index
 		if idx < 0 {
@@ -42,6 +239,77 @@ func (n *EvalReadStateTainted) Eval(ctx EvalContext) (interface{}, error) {
 	})
 }
 
+// EvalReadAllTainted is an EvalNode implementation that reads a copy of
+// every tainted InstanceState for a specific resource out of the state.
+// If there are no tainted instances, the output is an empty list.
+type EvalReadAllTainted struct {
+	Name   string
+	Output *[]*InstanceState
+}
+
+func (n *EvalReadAllTainted) Eval(ctx EvalContext) (interface{}, error) {
+	state, lock := ctx.State()
+
+	// Get a read lock so we can access this instance
+	lock.RLock()
+	defer lock.RUnlock()
+
+	result := make([]*InstanceState, 0)
+	if mod := state.ModuleByPath(ctx.Path()); mod != nil {
+		if rs := mod.Resources[n.Name]; rs != nil {
+			for _, is := range rs.Tainted {
+				result = append(result, is.deepcopy())
+			}
+		}
+	}
+
+	if n.Output != nil {
+		*n.Output = result
+	}
+
+	return result, nil
+}
+
+// ResourceStateView is a read-only view of all the instances of a
+// single resource in the state.
+type ResourceStateView struct {
+	Primary *InstanceState
+	Tainted []*InstanceState
+	Deposed []*InstanceState
+}
+
+// EvalReadResourceState is an EvalNode implementation that reads a copy
+// of the primary, tainted and deposed instances of a specific resource
+// out of the state in a single read. If the resource isn't in the state,
+// the view is empty.
+type EvalReadResourceState struct {
+	Name   string
+	Output *ResourceStateView
+}
+
+func (n *EvalReadResourceState) Eval(ctx EvalContext) (interface{}, error) {
+	state, lock := ctx.State()
+
+	// Get a read lock so we can access this instance
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var view ResourceStateView
+	if mod := state.ModuleByPath(ctx.Path()); mod != nil {
+		if rs := mod.Resources[n.Name].deepcopy(); rs != nil {
+			view.Primary = rs.Primary
+			view.Tainted = rs.Tainted
+			view.Deposed = rs.Deposed
+		}
+	}
+
+	if n.Output != nil {
+		*n.Output = view
+	}
+
+	return &view, nil
+}
+
 // EvalReadStateDeposed is an EvalNode implementation that reads the
 // deposed InstanceState for a specific resource out of the state
 type EvalReadStateDeposed struct {
@@ -50,10 +318,25 @@ type EvalReadStateDeposed struct {
 	// Index indicates which instance in the Deposed list to target, or -1 for
 	// the last item.
 	Index int
+	// Key, if set, is the ID of the deposed instance to target instead of
+	// Index. Unlike the index, it keeps addressing the same instance when
+	// other deposed instances are removed from the list.
+	Key string
 }
 
 func (n *EvalReadStateDeposed) Eval(ctx EvalContext) (interface{}, error) {
-	return readInstanceFromState(ctx, n.Name, n.Output, func(rs *ResourceState) (*InstanceState, error) {
+	return readInstanceFromState(ctx, nil, n.Name, "", n.Output, func(rs *ResourceState) (*InstanceState, error) {
+		if n.Key != "" {
+			for _, is := range rs.Deposed {
+				if is != nil && is.ID == n.Key {
+					return is, nil
+				}
+			}
+
+			return nil, fmt.Errorf(
+				"%s: no deposed instance with key %q", n.Name, n.Key)
+		}
+
 		// Get the index. If it is negative, then we get the last one
 		idx := n.Index
 		if idx < 0 {
@@ -69,10 +352,13 @@ func (n *EvalReadStateDeposed) Eval(ctx EvalContext) (interface{}, error) {
 
 // Does the bulk of the work for the various flavors of ReadState eval nodes.
 // Each node just provides a reader function to get from the ResourceState to the
-// InstanceState, and this takes care of all the plumbing.
+// InstanceState, and this takes care of all the plumbing. If cacheKind isn't
+// empty, the result is put in the StateReadCache as that kind of read.
 func readInstanceFromState(
 	ctx EvalContext,
+	path []string,
 	resourceName string,
+	cacheKind string,
 	output **InstanceState,
 	readerFn func(*ResourceState) (*InstanceState, error),
 ) (*InstanceState, error) {
@@ -82,9 +368,20 @@ func readInstanceFromState(
 	lock.RLock()
 	defer lock.RUnlock()
 
-	// Look for the module state. If we don't have one, then it doesn't matter.
-	mod := state.ModuleByPath(ctx.Path())
+	// Look for the module state. If we don't have one, then it doesn't
+	// matter, unless a specific module was asked for.
+	explicit := path != nil
+	if !explicit {
+		path = ctx.Path()
+	}
+	mod := state.ModuleByPath(path)
 	if mod == nil {
+		if explicit {
+			return nil, fmt.Errorf(
+				"%s: the module %q isn't in the state",
+				resourceName, strings.Join(path, "."))
+		}
+
 		return nil, nil
 	}
 
@@ -100,6 +397,11 @@ func readInstanceFromState(
 		return nil, err
 	}
 
+	// Cache while we still hold the lock, so a write can't come between
+	if cacheKind != "" {
+		ctx.StateCache().Put(path, resourceName, cacheKind, is)
+	}
+
 	// Write the result to the output pointer
 	if output != nil {
 		*output = is
@@ -108,6 +410,88 @@ func readInstanceFromState(
 	return is, nil
 }
 
+// instanceStateCorruption returns why the instance is corrupted, or an
+// empty string if it isn't. An instance is corrupted if it has attributes
+// but no ID, or if the count of a top-level list, set or map in its
+// attributes, such as "foo.#" or "foo.%", isn't a number or doesn't match
+// its elements.
+//
+// Only the top-level attributes are checked, since the keys of a map may
+// have dots themselves, such as "tags.kubernetes.io/role", which can't be
+// told apart from nested attributes.
+func instanceStateCorruption(is *InstanceState) string {
+	if is == nil {
+		return ""
+	}
+
+	if is.ID == "" && len(is.Attributes) > 0 {
+		return "it has attributes but no ID"
+	}
+
+	var keys []string
+	for k, _ := range is.Attributes {
+		if !strings.HasSuffix(k, ".#") && !strings.HasSuffix(k, ".%") {
+			continue
+		}
+		if strings.Contains(k[:len(k)-2], ".") {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := is.Attributes[k]
+		if v == config.UnknownVariableValue {
+			continue
+		}
+
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 0 {
+			return fmt.Sprintf("the count %q of %q isn't a number", v, k)
+		}
+
+		// The elements of a list or set are numbered, and have nested
+		// attributes below the number. Otherwise it is a map, whose keys
+		// are the elements.
+		prefix := k[:len(k)-1]
+		elements := make(map[string]struct{})
+		mapKeys := make(map[string]struct{})
+		numbered := true
+		for k2, _ := range is.Attributes {
+			if !strings.HasPrefix(k2, prefix) {
+				continue
+			}
+
+			e := k2[len(prefix):]
+			if e == "#" || e == "%" {
+				continue
+			}
+
+			mapKeys[e] = struct{}{}
+			if idx := strings.Index(e, "."); idx != -1 {
+				e = e[:idx]
+			}
+			if _, err := strconv.Atoi(e); err != nil {
+				numbered = false
+			}
+			elements[e] = struct{}{}
+		}
+		if !numbered {
+			elements = mapKeys
+		}
+
+		if len(elements) != count {
+			return fmt.Sprintf(
+				"%q has %d elements, but its count is %d",
+				k[:len(k)-2], len(elements), count)
+		}
+	}
+
+	return ""
+}
+
 // EvalRequireState is an EvalNode implementation that early exits
 // if the state doesn't have an ID.
 type EvalRequireState struct {
@@ -128,24 +512,76 @@ func (n *EvalRequireState) Eval(ctx EvalContext) (interface{}, error) {
 }
 
 // EvalUpdateStateHook is an EvalNode implementation that calls the
-// PostStateUpdate hook with the current state.
-type EvalUpdateStateHook struct{}
+// PostStateUpdate hook with the current state, and then persists it with
+// EvalPersistState. It does nothing in a dry run, since the state is only
+// a projection that must not be persisted.
+//
+// Pending must be set if the update marks a resource pending, see
+// EvalWriteState.Pending. Those updates aren't throttled, see
+// ContextOpts.StateUpdateInterval, since an interrupted apply can only
+// be detected if the mark was persisted before the apply started.
+type EvalUpdateStateHook struct {
+	Pending bool
+}
 
 func (n *EvalUpdateStateHook) Eval(ctx EvalContext) (interface{}, error) {
+	if ctx.DryRun() {
+		return nil, nil
+	}
+
 	state, lock := ctx.State()
 
 	// Get a read lock so it doesn't change while we're calling this
 	lock.RLock()
-	defer lock.RUnlock()
-
-	// Call the hook
 	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		if th, ok := h.(*stateThrottleHook); ok && n.Pending {
+			return th.postStateUpdateNow(state)
+		}
+
 		return h.PostStateUpdate(state)
 	})
+	lock.RUnlock()
 	if err != nil {
 		return nil, err
 	}
 
+	return (&EvalPersistState{Force: n.Pending}).Eval(ctx)
+}
+
+// EvalPersistState is an EvalNode implementation that writes the state
+// to the state backend if there is one and a write is due, see
+// ContextOpts.StateWriteEvery. Force writes it even if it isn't due.
+//
+// The state is copied while its lock is held and the copy is written
+// once the lock is released, so a slow write doesn't hold up the nodes
+// that are waiting to write the state. The copies are written in the
+// order they were made, see stateWriteSequence. A failed write isn't
+// fatal, the state is written once more when the walk ends and that
+// error is reported.
+type EvalPersistState struct {
+	Force bool
+}
+
+func (n *EvalPersistState) Eval(ctx EvalContext) (interface{}, error) {
+	b := ctx.StateBackend()
+	if b == nil || ctx.DryRun() {
+		return nil, nil
+	}
+	if !ctx.StateWriteDue() && !n.Force {
+		return nil, nil
+	}
+
+	state, lock := ctx.State()
+	seq := ctx.StateWriteSequence()
+	lock.RLock()
+	copied := state.DeepCopy()
+	num := seq.Next()
+	lock.RUnlock()
+
+	if err := seq.Write(b, num, copied); err != nil {
+		log.Printf("[WARN] Error writing the state to the backend: %s", err)
+	}
+
 	return nil, nil
 }
 
@@ -157,17 +593,105 @@ type EvalWriteState struct {
 	Provider     string
 	Dependencies []string
 	State        **InstanceState
+
+	// Schema, if set, is the provider whose schema for ResourceType is
+	// used to prune attributes that are no longer part of the schema
+	// before the state is written. See ResourceType.Attributes.
+	Schema *ResourceProvider
+
+	// Pending marks the resource as having an apply in progress. Any
+	// write without it clears the mark. See ResourceState.Pending.
+	Pending bool
+
+	// Merge merges the attributes of State over those of the primary
+	// instance that is in the state already instead of replacing it, so
+	// that the attributes State has none of are kept, such as after an
+	// apply that failed part way. A State without an ID still removes
+	// the primary instance.
+	Merge bool
 }
 
 func (n *EvalWriteState) Eval(ctx EvalContext) (interface{}, error) {
+	var attrs map[string]struct{}
+	if n.Schema != nil && *n.Schema != nil {
+		attrs = schemaAttributes(*n.Schema, n.ResourceType)
+	}
+
+	stream := ctx.StateStream()
 	return writeInstanceToState(ctx, n.Name, n.ResourceType, n.Provider, n.Dependencies,
 		func(rs *ResourceState) error {
+			// The instance in the state may be the one being written,
+			// changed in place, so the event needs a copy of it first.
+			before := rs.Primary.deepcopy()
 			rs.Primary = *n.State
+			if n.Merge {
+				rs.Primary = mergeInstanceState(before, *n.State)
+			}
+			rs.Pending = n.Pending
+			if attrs != nil && rs.Primary != nil {
+				pruneInstanceAttributes(n.Name, rs.Primary, attrs)
+			}
+
+			// The event is sent while the state is still locked, so that
+			// the events are in the same order as the writes.
+			writeStateEvent(stream, newStateEvent(
+				ctx.Path(), n.Name, StateEventPrimary,
+				before, rs.Primary, rs.Pending))
 			return nil
 		},
 	)
 }
 
+// mergeInstanceState returns a copy of the new instance with the
+// attributes of the old one that it doesn't have. See EvalWriteState.Merge.
+//
+// The attributes are merged by their top-level name, so a list or map is
+// taken whole from the new instance if it has any of it, rather than
+// keeping the old elements that it doesn't have.
+func mergeInstanceState(old, new *InstanceState) *InstanceState {
+	if old == nil || new == nil || new.ID == "" {
+		return new
+	}
+
+	result := new.deepcopy()
+	result.init()
+	tops := make(map[string]struct{})
+	for k := range result.Attributes {
+		tops[topAttribute(k)] = struct{}{}
+	}
+	for k, v := range old.Attributes {
+		if _, ok := tops[topAttribute(k)]; !ok {
+			result.Attributes[k] = v
+		}
+	}
+
+	return result
+}
+
+// topAttribute returns the top-level name of a flattened attribute key,
+// such as "tags" for "tags.Name".
+func topAttribute(k string) string {
+	if idx := strings.Index(k, "."); idx != -1 {
+		return k[:idx]
+	}
+
+	return k
+}
+
+// pruneInstanceAttributes removes every attribute of the instance whose
+// top-level name isn't in the given set of schema attributes.
+func pruneInstanceAttributes(
+	name string, is *InstanceState, attrs map[string]struct{}) {
+	for k := range is.Attributes {
+		if _, ok := attrs[topAttribute(k)]; ok {
+			continue
+		}
+
+		log.Printf("[INFO] %s: pruning attribute %q not in schema", name, k)
+		delete(is.Attributes, k)
+	}
+}
+
 // EvalWriteStateTainted is an EvalNode implementation that writes
 // an InstanceState out to the Tainted list of a resource in the state.
 type EvalWriteStateTainted struct {
@@ -183,13 +707,20 @@ type EvalWriteStateTainted struct {
 // EvalWriteStateTainted is an EvalNode implementation that writes the
 // one of the tainted InstanceStates for a specific resource out of the state.
 func (n *EvalWriteStateTainted) Eval(ctx EvalContext) (interface{}, error) {
+	stream := ctx.StateStream()
 	return writeInstanceToState(ctx, n.Name, n.ResourceType, n.Provider, n.Dependencies,
 		func(rs *ResourceState) error {
+			var before *InstanceState
 			if n.Index == -1 {
 				rs.Tainted = append(rs.Tainted, *n.State)
 			} else {
+				before = rs.Tainted[n.Index].deepcopy()
 				rs.Tainted[n.Index] = *n.State
 			}
+
+			writeStateEvent(stream, newStateEvent(
+				ctx.Path(), n.Name, StateEventTainted,
+				before, *n.State, false))
 			return nil
 		},
 	)
@@ -205,21 +736,64 @@ type EvalWriteStateDeposed struct {
 	State        **InstanceState
 	// Index indicates which instance in the Deposed list to target, or -1 to append.
 	Index int
+	// Key, if set, is the ID of the deposed instance to target instead of
+	// Index, see EvalReadStateDeposed. A State without an ID, such as once
+	// the instance is destroyed, removes the instance from the list, which
+	// doesn't change the instances the other keys target.
+	Key string
 }
 
 func (n *EvalWriteStateDeposed) Eval(ctx EvalContext) (interface{}, error) {
+	stream := ctx.StateStream()
 	return writeInstanceToState(ctx, n.Name, n.ResourceType, n.Provider, n.Dependencies,
 		func(rs *ResourceState) error {
-			if n.Index == -1 {
+			var before *InstanceState
+			if n.Key != "" {
+				var err error
+				if before, err = n.writeKey(rs); err != nil {
+					return err
+				}
+			} else if n.Index == -1 {
 				rs.Deposed = append(rs.Deposed, *n.State)
-			} else {
+			} else if n.Index < len(rs.Deposed) {
+				before = rs.Deposed[n.Index].deepcopy()
 				rs.Deposed[n.Index] = *n.State
+			} else {
+				return fmt.Errorf(
+					"bad deposed index: %d, for resource: %s", n.Index, n.Name)
 			}
+
+			writeStateEvent(stream, newStateEvent(
+				ctx.Path(), n.Name, StateEventDeposed,
+				before, *n.State, false))
 			return nil
 		},
 	)
 }
 
+// writeKey writes the deposed instance with the key, and returns a copy
+// of the instance it wrote over.
+func (n *EvalWriteStateDeposed) writeKey(rs *ResourceState) (*InstanceState, error) {
+	for i, is := range rs.Deposed {
+		if is == nil || is.ID != n.Key {
+			continue
+		}
+
+		before := is.deepcopy()
+		if state := *n.State; state != nil && state.ID != "" {
+			rs.Deposed[i] = state
+			return before, nil
+		}
+
+		copy(rs.Deposed[i:], rs.Deposed[i+1:])
+		rs.Deposed[len(rs.Deposed)-1] = nil
+		rs.Deposed = rs.Deposed[:len(rs.Deposed)-1]
+		return before, nil
+	}
+
+	return nil, fmt.Errorf("%s: no deposed instance with key %q", n.Name, n.Key)
+}
+
 // Pulls together the common tasks of the EvalWriteState nodes.  All the args
 // are passed directly down from the EvalNode along with a `writer` function
 // which is yielded the *ResourceState and is responsible for writing an
@@ -258,6 +832,7 @@ func writeInstanceToState(
 	rs.Dependencies = dependencies
 	rs.Provider = provider
 
+	ctx.StateCache().Invalidate(ctx.Path(), resourceName)
 	if err := writerFn(rs); err != nil {
 		return nil, err
 	}
@@ -274,9 +849,9 @@ type EvalClearPrimaryState struct {
 func (n *EvalClearPrimaryState) Eval(ctx EvalContext) (interface{}, error) {
 	state, lock := ctx.State()
 
-	// Get a read lock so we can access this instance
-	lock.RLock()
-	defer lock.RUnlock()
+	// Get a write lock since we change this instance
+	lock.Lock()
+	defer lock.Unlock()
 
 	// Look for the module state. If we don't have one, then it doesn't matter.
 	mod := state.ModuleByPath(ctx.Path())
@@ -290,6 +865,7 @@ func (n *EvalClearPrimaryState) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, nil
 	}
 
+	ctx.StateCache().Invalidate(ctx.Path(), n.Name)
 	// Clear primary from the resource state
 	rs.Primary = nil
 
@@ -302,15 +878,23 @@ func (n *EvalClearPrimaryState) Eval(ctx EvalContext) (interface{}, error) {
 // the old state of the to-be-destroyed resource.
 type EvalDeposeState struct {
 	Name string
+
+	// Output, if set, is the instance that was deposed, or nil if there
+	// was none.
+	Output **InstanceState
 }
 
 // TODO: test
 func (n *EvalDeposeState) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Output != nil {
+		*n.Output = nil
+	}
+
 	state, lock := ctx.State()
 
-	// Get a read lock so we can access this instance
-	lock.RLock()
-	defer lock.RUnlock()
+	// Get a write lock since we change this instance
+	lock.Lock()
+	defer lock.Unlock()
 
 	// Look for the module state. If we don't have one, then it doesn't matter.
 	mod := state.ModuleByPath(ctx.Path())
@@ -329,10 +913,21 @@ func (n *EvalDeposeState) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, nil
 	}
 
+	ctx.StateCache().Invalidate(ctx.Path(), n.Name)
 	// Depose
-	rs.Deposed = append(rs.Deposed, rs.Primary)
+	deposed := rs.Primary
+	rs.Deposed = append(rs.Deposed, deposed)
+	if n.Output != nil {
+		*n.Output = deposed
+	}
 	rs.Primary = nil
 
+	stream := ctx.StateStream()
+	writeStateEvent(stream, newStateEvent(
+		ctx.Path(), n.Name, StateEventPrimary, deposed, nil, rs.Pending))
+	writeStateEvent(stream, newStateEvent(
+		ctx.Path(), n.Name, StateEventDeposed, nil, deposed, false))
+
 	return nil, nil
 }
 
@@ -346,9 +941,9 @@ type EvalUndeposeState struct {
 func (n *EvalUndeposeState) Eval(ctx EvalContext) (interface{}, error) {
 	state, lock := ctx.State()
 
-	// Get a read lock so we can access this instance
-	lock.RLock()
-	defer lock.RUnlock()
+	// Get a write lock since we change this instance
+	lock.Lock()
+	defer lock.Unlock()
 
 	// Look for the module state. If we don't have one, then it doesn't matter.
 	mod := state.ModuleByPath(ctx.Path())
@@ -367,10 +962,87 @@ func (n *EvalUndeposeState) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, nil
 	}
 
-	// Undepose
+	ctx.StateCache().Invalidate(ctx.Path(), n.Name)
+	// Undepose the most recently deposed instance
 	idx := len(rs.Deposed) - 1
+	before := rs.Primary
 	rs.Primary = rs.Deposed[idx]
 	rs.Deposed[idx] = nil
+	rs.Deposed = rs.Deposed[:idx]
+
+	stream := ctx.StateStream()
+	writeStateEvent(stream, newStateEvent(
+		ctx.Path(), n.Name, StateEventDeposed, rs.Primary, nil, false))
+	writeStateEvent(stream, newStateEvent(
+		ctx.Path(), n.Name, StateEventPrimary, before, rs.Primary, rs.Pending))
+
+	return nil, nil
+}
+
+// EvalTaintResource is an EvalNode implementation that marks the primary
+// instance of a specific resource as tainted, so that it is recreated by
+// the next apply. If the primary is tainted already, or there is no
+// primary, this does nothing. See ResourceState.Taint.
+type EvalTaintResource struct {
+	Name string
+}
+
+func (n *EvalTaintResource) Eval(ctx EvalContext) (interface{}, error) {
+	state, lock := ctx.State()
+
+	// Get a write lock since we change this instance
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Look for the module state. If we don't have one, then it doesn't matter.
+	mod := state.ModuleByPath(ctx.Path())
+	if mod == nil {
+		return nil, nil
+	}
+
+	// Look for the resource state. If we don't have one, then it is okay.
+	rs := mod.Resources[n.Name]
+	if rs == nil {
+		return nil, nil
+	}
+
+	ctx.StateCache().Invalidate(ctx.Path(), n.Name)
+	rs.Taint()
+
+	return nil, nil
+}
+
+// EvalUntaintResource is an EvalNode implementation that makes the most
+// recently tainted instance of a specific resource the primary again. If
+// there are no tainted instances, this does nothing. It is an error if
+// the resource has a primary already. See ResourceState.Untaint.
+type EvalUntaintResource struct {
+	Name string
+}
+
+func (n *EvalUntaintResource) Eval(ctx EvalContext) (interface{}, error) {
+	state, lock := ctx.State()
+
+	// Get a write lock since we change this instance
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Look for the module state. If we don't have one, then it doesn't matter.
+	mod := state.ModuleByPath(ctx.Path())
+	if mod == nil {
+		return nil, nil
+	}
+
+	// Look for the resource state. If we don't have one, then it is okay.
+	rs := mod.Resources[n.Name]
+	if rs == nil {
+		return nil, nil
+	}
+
+	ctx.StateCache().Invalidate(ctx.Path(), n.Name)
+	if err := rs.Untaint(); err != nil {
+		return nil, fmt.Errorf("%s: can't untaint: %s", n.Name, err)
+	}
 
 	return nil, nil
 }
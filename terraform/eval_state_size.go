@@ -0,0 +1,37 @@
+package terraform
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// EvalStateSize is an EvalNode implementation that reports the size of
+// the serialized InstanceState to the PostStateSize hook.
+type EvalStateSize struct {
+	Info  *InstanceInfo
+	State **InstanceState
+}
+
+func (n *EvalStateSize) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	if state == nil {
+		return nil, nil
+	}
+
+	// The report is advisory, so a failure to serialize isn't fatal.
+	// Writing the state will surface the actual error.
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("[WARN] %s: failed to compute state size: %s", n.Info.Id, err)
+		return nil, nil
+	}
+
+	err = ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostStateSize(n.Info, len(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,47 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestEvalStateSize(t *testing.T) {
+	hook := new(MockHook)
+	ctx := new(MockEvalContext)
+	ctx.HookHook = hook
+
+	info := &InstanceInfo{Id: "aws_instance.foo"}
+	state := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"user_data": "a very large blob"},
+	}
+	node := &EvalStateSize{Info: info, State: &state}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !hook.PostStateSizeCalled {
+		t.Fatal("should call PostStateSize")
+	}
+	if hook.PostStateSizeInfo != info {
+		t.Fatalf("bad: %#v", hook.PostStateSizeInfo)
+	}
+	if hook.PostStateSizeSize <= len("a very large blob") {
+		t.Fatalf("bad: %d", hook.PostStateSizeSize)
+	}
+}
+
+func TestEvalStateSize_nil(t *testing.T) {
+	hook := new(MockHook)
+	ctx := new(MockEvalContext)
+	ctx.HookHook = hook
+
+	var state *InstanceState
+	node := &EvalStateSize{Info: &InstanceInfo{}, State: &state}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if hook.PostStateSizeCalled {
+		t.Fatal("should not call PostStateSize")
+	}
+}
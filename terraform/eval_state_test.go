@@ -1,8 +1,12 @@
 package terraform
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalRequireState(t *testing.T) {
@@ -67,6 +71,150 @@ func TestEvalUpdateStateHook(t *testing.T) {
 	}
 }
 
+func TestEvalUpdateStateHook_stateBackend(t *testing.T) {
+	b := new(MockStateBackend)
+
+	ctx := new(MockEvalContext)
+	ctx.HookHook = new(MockHook)
+	ctx.StateState = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateBackendBackend = b
+
+	node := &EvalUpdateStateHook{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if b.WriteCalled != 1 || b.State.Serial != 42 {
+		t.Fatalf("bad: %#v", b)
+	}
+
+	// A failed write is reported once the walk ends instead
+	b.WriteError = fmt.Errorf("error")
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestEvalUpdateStateHook_stateBackendUnlocked(t *testing.T) {
+	lock := new(sync.RWMutex)
+	b := &testLockCheckBackend{
+		MockStateBackend: new(MockStateBackend),
+		StateLock:        lock,
+	}
+
+	ctx := new(MockEvalContext)
+	ctx.HookHook = new(MockHook)
+	ctx.StateState = &State{Serial: 42}
+	ctx.StateLock = lock
+	ctx.StateBackendBackend = b
+
+	node := &EvalUpdateStateHook{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if b.WriteCalled != 1 || b.State.Serial != 42 {
+		t.Fatalf("bad: %#v", b)
+	}
+	if b.Held {
+		t.Fatal("the state lock should not be held while writing")
+	}
+}
+
+func TestEvalPersistState(t *testing.T) {
+	b := new(MockStateBackend)
+
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateBackendBackend = b
+	ctx.StateWriteDueThrottled = true
+
+	node := &EvalPersistState{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ctx.StateWriteDueCalled {
+		t.Fatal("should call StateWriteDue")
+	}
+	if b.WriteCalled != 0 {
+		t.Fatal("shouldn't write yet")
+	}
+
+	ctx.StateWriteDueThrottled = false
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 1 || b.State.Serial != 42 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestEvalPersistState_sequence(t *testing.T) {
+	b := new(MockStateBackend)
+	seq := new(stateWriteSequence)
+
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateBackendBackend = b
+	ctx.StateWriteSequenceSequence = seq
+
+	node := &EvalPersistState{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 1 || seq.written != 1 {
+		t.Fatalf("bad: %#v %#v", b, seq)
+	}
+
+	// A newer copy was written while this one was being made
+	seq.written = 3
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 1 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestEvalPersistState_force(t *testing.T) {
+	b := new(MockStateBackend)
+
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateBackendBackend = b
+	ctx.StateWriteDueThrottled = true
+
+	node := &EvalPersistState{Force: true}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 1 || b.State.Serial != 42 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestEvalPersistState_dryRun(t *testing.T) {
+	b := new(MockStateBackend)
+
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateBackendBackend = b
+	ctx.DryRunValue = true
+
+	node := &EvalPersistState{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 0 {
+		t.Fatal("shouldn't write")
+	}
+}
+
 func TestEvalReadState(t *testing.T) {
 	var output *InstanceState
 	cases := map[string]struct {
@@ -88,6 +236,24 @@ func TestEvalReadState(t *testing.T) {
 			},
 			ExpectedInstanceId: "i-abc123",
 		},
+		"ReadState clean gets clean primary instance state": {
+			Resources: map[string]*ResourceState{
+				"aws_instance.bar": &ResourceState{
+					Primary: &InstanceState{
+						ID: "i-abc123",
+					},
+					Tainted: []*InstanceState{
+						&InstanceState{ID: "i-def456"},
+					},
+				},
+			},
+			Node: &EvalReadState{
+				Name:   "aws_instance.bar",
+				Output: &output,
+				Clean:  true,
+			},
+			ExpectedInstanceId: "i-abc123",
+		},
 		"ReadStateTainted gets tainted instance": {
 			Resources: map[string]*ResourceState{
 				"aws_instance.bar": &ResourceState{
@@ -118,6 +284,39 @@ func TestEvalReadState(t *testing.T) {
 			},
 			ExpectedInstanceId: "i-abc123",
 		},
+		"ReadStateDeposed gets last deposed instance": {
+			Resources: map[string]*ResourceState{
+				"aws_instance.bar": &ResourceState{
+					Deposed: []*InstanceState{
+						&InstanceState{ID: "i-abc123"},
+						&InstanceState{ID: "i-def456"},
+					},
+				},
+			},
+			Node: &EvalReadStateDeposed{
+				Name:   "aws_instance.bar",
+				Output: &output,
+				Index:  -1,
+			},
+			ExpectedInstanceId: "i-def456",
+		},
+		"ReadStateDeposed gets deposed instance by key": {
+			Resources: map[string]*ResourceState{
+				"aws_instance.bar": &ResourceState{
+					Deposed: []*InstanceState{
+						&InstanceState{ID: "i-abc123"},
+						&InstanceState{ID: "i-def456"},
+						&InstanceState{ID: "i-ghi789"},
+					},
+				},
+			},
+			Node: &EvalReadStateDeposed{
+				Name:   "aws_instance.bar",
+				Output: &output,
+				Key:    "i-def456",
+			},
+			ExpectedInstanceId: "i-def456",
+		},
 	}
 
 	for k, c := range cases {
@@ -151,78 +350,1258 @@ func TestEvalReadState(t *testing.T) {
 	}
 }
 
-func TestEvalWriteState(t *testing.T) {
-	state := &State{}
+func TestEvalReadStateDeposed_keyMissing(t *testing.T) {
 	ctx := new(MockEvalContext)
-	ctx.StateState = state
+	ctx.StateState = &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Deposed: []*InstanceState{
+							&InstanceState{ID: "i-abc123"},
+						},
+					},
+				},
+			},
+		},
+	}
 	ctx.StateLock = new(sync.RWMutex)
 	ctx.PathPath = rootModulePath
 
-	is := &InstanceState{ID: "i-abc123"}
-	node := &EvalWriteState{
-		Name:         "restype.resname",
-		ResourceType: "restype",
-		State:        &is,
+	var output *InstanceState
+	node := &EvalReadStateDeposed{
+		Name:   "aws_instance.bar",
+		Output: &output,
+		Key:    "i-def456",
 	}
 	_, err := node.Eval(ctx)
-	if err != nil {
-		t.Fatalf("Got err: %#v", err)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `no deposed instance with key "i-def456"`) {
+		t.Fatalf("bad: %s", err)
+	}
+	if output != nil {
+		t.Fatalf("bad: %#v", output)
 	}
-
-	checkStateString(t, state, `
-restype.resname:
-  ID = i-abc123
-	`)
 }
 
-func TestEvalWriteStateTainted(t *testing.T) {
-	state := &State{}
-	ctx := new(MockEvalContext)
-	ctx.StateState = state
-	ctx.StateLock = new(sync.RWMutex)
-	ctx.PathPath = rootModulePath
-
-	is := &InstanceState{ID: "i-abc123"}
-	node := &EvalWriteStateTainted{
-		Name:         "restype.resname",
-		ResourceType: "restype",
-		State:        &is,
-		Index:        -1,
+func TestEvalReadState_path(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Primary: &InstanceState{ID: "i-root"},
+					},
+				},
+			},
+			&ModuleState{
+				Path: []string{"root", "foo"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Primary: &InstanceState{ID: "i-foo"},
+					},
+				},
+			},
+		},
 	}
-	_, err := node.Eval(ctx)
-	if err != nil {
-		t.Fatalf("Got err: %#v", err)
+
+	cases := map[string]struct {
+		Path []string
+		ID   string
+		Err  bool
+	}{
+		"current": {
+			Path: nil,
+			ID:   "i-root",
+		},
+		"module": {
+			Path: []string{"root", "foo"},
+			ID:   "i-foo",
+		},
+		"missing module": {
+			Path: []string{"root", "bar"},
+			Err:  true,
+		},
 	}
 
-	checkStateString(t, state, `
-restype.resname: (1 tainted)
-  ID = <not created>
-  Tainted ID 1 = i-abc123
-	`)
+	for k, c := range cases {
+		ctx := new(MockEvalContext)
+		ctx.StateState = state
+		ctx.StateLock = new(sync.RWMutex)
+		ctx.StateCacheCache = new(StateReadCache)
+		ctx.PathPath = rootModulePath
+
+		var output *InstanceState
+		node := &EvalReadState{
+			Name:   "aws_instance.bar",
+			Output: &output,
+			Path:   c.Path,
+		}
+		_, err := node.Eval(ctx)
+		if (err != nil) != c.Err {
+			t.Fatalf("[%s] err: %s", k, err)
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), "root.bar") {
+				t.Fatalf("[%s] bad err: %s", k, err)
+			}
+			continue
+		}
+
+		if output == nil || output.ID != c.ID {
+			t.Fatalf("[%s] bad: %#v", k, output)
+		}
+	}
 }
 
-func TestEvalWriteStateDeposed(t *testing.T) {
+func TestEvalReadState_cache(t *testing.T) {
 	state := &State{}
 	ctx := new(MockEvalContext)
 	ctx.StateState = state
 	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateCacheCache = new(StateReadCache)
 	ctx.PathPath = rootModulePath
 
-	is := &InstanceState{ID: "i-abc123"}
-	node := &EvalWriteStateDeposed{
-		Name:         "restype.resname",
-		ResourceType: "restype",
-		State:        &is,
-		Index:        -1,
+	write := func(id string) {
+		is := &InstanceState{ID: id}
+		node := &EvalWriteState{
+			Name:         "aws_instance.bar",
+			ResourceType: "aws_instance",
+			State:        &is,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
 	}
-	_, err := node.Eval(ctx)
-	if err != nil {
-		t.Fatalf("Got err: %#v", err)
+	read := func() *InstanceState {
+		var output *InstanceState
+		node := &EvalReadState{
+			Name:   "aws_instance.bar",
+			Output: &output,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return output
 	}
 
-	checkStateString(t, state, `
-restype.resname: (1 deposed)
-  ID = <not created>
-  Deposed ID 1 = i-abc123
-	`)
+	write("i-abc123")
+	if is := read(); is == nil || is.ID != "i-abc123" {
+		t.Fatalf("bad: %#v", is)
+	}
+
+	// The second read is served from the cache
+	is, ok := ctx.StateCacheCache.Get(rootModulePath, "aws_instance.bar", "primary")
+	if !ok || is.ID != "i-abc123" {
+		t.Fatalf("should be cached: %#v", is)
+	}
+	if is := read(); is == nil || is.ID != "i-abc123" {
+		t.Fatalf("bad: %#v", is)
+	}
+
+	// A read after a write sees the write
+	write("i-def456")
+	if is := read(); is == nil || is.ID != "i-def456" {
+		t.Fatalf("bad: %#v", is)
+	}
+}
+
+func TestEvalReadState_recover(t *testing.T) {
+	cases := map[string]struct {
+		Primary  *InstanceState
+		Recover  bool
+		Expected *InstanceState
+		Err      bool
+	}{
+		"good": {
+			Primary: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"id":    "i-abc123",
+					"foo.#": "2",
+					"foo.0": "a",
+					"foo.1": "b",
+				},
+			},
+			Recover: true,
+			Expected: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"id":    "i-abc123",
+					"foo.#": "2",
+					"foo.0": "a",
+					"foo.1": "b",
+				},
+			},
+		},
+
+		"dotted map keys": {
+			Primary: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"id":                      "i-abc123",
+					"tags.#":                  "2",
+					"tags.kubernetes.io/role": "master",
+					"tags.kubernetes.io/name": "foo",
+					"disk.#":                  "1",
+					"disk.0.size":             "10",
+					"disk.0.tags.%":           "1",
+					"disk.0.tags.a.b":         "c",
+				},
+			},
+			Recover: true,
+			Expected: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"id":                      "i-abc123",
+					"tags.#":                  "2",
+					"tags.kubernetes.io/role": "master",
+					"tags.kubernetes.io/name": "foo",
+					"disk.#":                  "1",
+					"disk.0.size":             "10",
+					"disk.0.tags.%":           "1",
+					"disk.0.tags.a.b":         "c",
+				},
+			},
+		},
+
+		"truncated map": {
+			Primary: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"id":       "i-abc123",
+					"tags.%":   "2",
+					"tags.Foo": "a",
+				},
+			},
+			Recover: true,
+			Expected: &InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"id": "i-abc123"},
+			},
+		},
+
+		"truncated list": {
+			Primary: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"id":    "i-abc123",
+					"foo.#": "2",
+					"foo.0": "a",
+				},
+				Meta: map[string]string{"schema_version": "1"},
+			},
+			Recover: true,
+			Expected: &InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"id": "i-abc123"},
+				Meta:       map[string]string{"schema_version": "1"},
+			},
+		},
+
+		"missing ID": {
+			Primary: &InstanceState{
+				Attributes: map[string]string{
+					"id":  "i-abc123",
+					"ami": "ami-123",
+				},
+			},
+			Recover: true,
+			Expected: &InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"id": "i-abc123"},
+			},
+		},
+
+		"no salvageable ID": {
+			Primary: &InstanceState{
+				Attributes: map[string]string{"ami": "ami-123"},
+			},
+			Recover: true,
+			Err:     true,
+		},
+
+		"not recovering": {
+			Primary: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"foo.#": "bad",
+				},
+			},
+			Expected: &InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"foo.#": "bad",
+				},
+			},
+		},
+	}
+
+	for k, c := range cases {
+		ctx := new(MockEvalContext)
+		ctx.StateState = &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.bar": &ResourceState{
+							Primary: c.Primary,
+						},
+					},
+				},
+			},
+		}
+		ctx.StateLock = new(sync.RWMutex)
+		ctx.PathPath = rootModulePath
+		ctx.RecoverStateValue = c.Recover
+
+		var output *InstanceState
+		node := &EvalReadState{
+			Name:    "aws_instance.bar",
+			Output:  &output,
+			Recover: true,
+		}
+		_, err := node.Eval(ctx)
+		if (err != nil) != c.Err {
+			t.Fatalf("[%s] err: %s", k, err)
+		}
+		if c.Err {
+			continue
+		}
+
+		if !reflect.DeepEqual(output, c.Expected) {
+			t.Fatalf("[%s] bad: %#v", k, output)
+		}
+
+		// The state itself is left alone
+		rs := ctx.StateState.RootModule().Resources["aws_instance.bar"]
+		if rs.Primary != c.Primary {
+			t.Fatalf("[%s] state shouldn't change: %#v", k, rs.Primary)
+		}
+	}
+}
+
+func TestEvalReadState_stale(t *testing.T) {
+	newState := func(serial int64, id string) *State {
+		return &State{
+			Serial: serial,
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.bar": &ResourceState{
+							Primary: &InstanceState{ID: id},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		Backend *State
+		Reload  bool
+		Err     bool
+		ID      string
+	}{
+		"current": {
+			Backend: newState(1, "i-new"),
+			ID:      "i-old",
+		},
+		"stale": {
+			Backend: newState(2, "i-new"),
+			Err:     true,
+		},
+		"stale reload": {
+			Backend: newState(2, "i-new"),
+			Reload:  true,
+			ID:      "i-new",
+		},
+	}
+
+	for k, c := range cases {
+		ctx := new(MockEvalContext)
+		ctx.StateState = newState(1, "i-old")
+		ctx.StateLock = new(sync.RWMutex)
+		ctx.PathPath = rootModulePath
+
+		var output *InstanceState
+		node := &EvalReadState{
+			Name:    "aws_instance.bar",
+			Output:  &output,
+			Backend: &MockStateBackend{State: c.Backend},
+			Reload:  c.Reload,
+		}
+		_, err := node.Eval(ctx)
+		if (err != nil) != c.Err {
+			t.Fatalf("[%s] err: %s", k, err)
+		}
+		if err != nil {
+			if _, ok := err.(*StaleStateError); !ok {
+				t.Fatalf("[%s] bad err: %#v", k, err)
+			}
+			continue
+		}
+
+		if output == nil || output.ID != c.ID {
+			t.Fatalf("[%s] bad: %#v", k, output)
+		}
+
+		// The state of the walk isn't replaced
+		rs := ctx.StateState.RootModule().Resources["aws_instance.bar"]
+		if ctx.StateState.Serial != 1 || rs.Primary.ID != "i-old" {
+			t.Fatalf("[%s] bad: %s", k, ctx.StateState)
+		}
+	}
+}
+
+func TestEvalReadState_staleNilState(t *testing.T) {
+	ctx := new(MockEvalContext)
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	node := &EvalReadState{
+		Name:    "aws_instance.bar",
+		Backend: &MockStateBackend{State: &State{Serial: 1}},
+	}
+	_, err := node.Eval(ctx)
+	if _, ok := err.(*StaleStateError); !ok {
+		t.Fatalf("bad err: %#v", err)
+	}
+}
+
+func TestEvalReadAllTainted(t *testing.T) {
+	tainted := []*InstanceState{
+		&InstanceState{ID: "i-abc123"},
+		&InstanceState{ID: "i-def456"},
+	}
+
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{Tainted: tainted},
+				},
+			},
+		},
+	}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	var output []*InstanceState
+	node := &EvalReadAllTainted{Name: "aws_instance.bar", Output: &output}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(output) != 2 || output[0].ID != "i-abc123" || output[1].ID != "i-def456" {
+		t.Fatalf("bad: %#v", output)
+	}
+	if output[0] == tainted[0] {
+		t.Fatal("should be a copy")
+	}
+
+	// A resource without tainted instances reads as an empty list
+	node = &EvalReadAllTainted{Name: "aws_instance.foo", Output: &output}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if output == nil || len(output) != 0 {
+		t.Fatalf("bad: %#v", output)
+	}
+}
+
+func TestEvalReadResourceState(t *testing.T) {
+	rs := &ResourceState{
+		Primary: &InstanceState{ID: "i-abc123"},
+		Deposed: []*InstanceState{
+			&InstanceState{ID: "i-old1"},
+			&InstanceState{ID: "i-old2"},
+		},
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": rs,
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	var view ResourceStateView
+	node := &EvalReadResourceState{Name: "aws_instance.bar", Output: &view}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if view.Primary == nil || view.Primary.ID != "i-abc123" {
+		t.Fatalf("bad: %#v", view.Primary)
+	}
+	if len(view.Tainted) != 0 {
+		t.Fatalf("bad: %#v", view.Tainted)
+	}
+	if len(view.Deposed) != 2 || view.Deposed[1].ID != "i-old2" {
+		t.Fatalf("bad: %#v", view.Deposed)
+	}
+
+	// The view is a copy, changing it doesn't change the state
+	view.Primary.ID = "changed"
+	view.Deposed[0] = nil
+	if rs.Primary.ID != "i-abc123" || rs.Deposed[0] == nil {
+		t.Fatalf("state was modified: %#v", rs)
+	}
+
+	// A missing resource results in an empty view
+	node = &EvalReadResourceState{Name: "aws_instance.foo", Output: &view}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if view.Primary != nil || view.Deposed != nil {
+		t.Fatalf("bad: %#v", view)
+	}
+}
+
+func TestEvalWriteState(t *testing.T) {
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	is := &InstanceState{ID: "i-abc123"}
+	node := &EvalWriteState{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+	}
+	_, err := node.Eval(ctx)
+	if err != nil {
+		t.Fatalf("Got err: %#v", err)
+	}
+
+	checkStateString(t, state, `
+restype.resname:
+  ID = i-abc123
+	`)
+}
+
+func TestEvalWriteState_merge(t *testing.T) {
+	cases := map[string]struct {
+		Before   *InstanceState
+		State    *InstanceState
+		Expected string
+	}{
+		"merged": {
+			&InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"ami": "ami-old", "num": "2"},
+			},
+			&InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"ami": "ami-new"},
+			},
+			`
+restype.resname:
+  ID = i-abc123
+  ami = ami-new
+  num = 2
+`,
+		},
+
+		"list": {
+			&InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"tags.#":   "2",
+					"tags.Foo": "foo",
+					"tags.Bar": "bar",
+					"num":      "2",
+				},
+			},
+			&InstanceState{
+				ID: "i-abc123",
+				Attributes: map[string]string{
+					"tags.#":   "1",
+					"tags.Bar": "baz",
+				},
+			},
+			`
+restype.resname:
+  ID = i-abc123
+  num = 2
+  tags.# = 1
+  tags.Bar = baz
+`,
+		},
+
+		"no primary": {
+			nil,
+			&InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"ami": "ami-new"},
+			},
+			`
+restype.resname:
+  ID = i-abc123
+  ami = ami-new
+`,
+		},
+
+		"no ID": {
+			&InstanceState{
+				ID:         "i-abc123",
+				Attributes: map[string]string{"ami": "ami-old", "num": "2"},
+			},
+			&InstanceState{},
+			`
+restype.resname:
+  ID = <not created>
+`,
+		},
+	}
+
+	for k, tc := range cases {
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"restype.resname": &ResourceState{
+							Type:    "restype",
+							Primary: tc.Before,
+						},
+					},
+				},
+			},
+		}
+		ctx := new(MockEvalContext)
+		ctx.StateState = state
+		ctx.StateLock = new(sync.RWMutex)
+		ctx.PathPath = rootModulePath
+
+		is := tc.State
+		node := &EvalWriteState{
+			Name:         "restype.resname",
+			ResourceType: "restype",
+			State:        &is,
+			Merge:        true,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := strings.TrimSpace(state.String())
+		if actual != strings.TrimSpace(tc.Expected) {
+			t.Fatalf("%s: bad:\n%s", k, actual)
+		}
+
+		// The state that was written isn't changed
+		if _, ok := tc.State.Attributes["num"]; ok {
+			t.Fatalf("%s: bad: %#v", k, tc.State)
+		}
+	}
+}
+
+func TestEvalWriteState_schema(t *testing.T) {
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	var provider ResourceProvider = &MockResourceProvider{
+		ResourcesReturn: []ResourceType{
+			ResourceType{
+				Name:       "restype",
+				Attributes: []string{"ami", "tags"},
+			},
+		},
+	}
+
+	is := &InstanceState{
+		ID: "i-abc123",
+		Attributes: map[string]string{
+			"id":       "i-abc123",
+			"ami":      "ami-abc123",
+			"tags.#":   "1",
+			"tags.foo": "bar",
+			"legacy":   "value",
+		},
+	}
+	node := &EvalWriteState{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+		Schema:       &provider,
+	}
+	_, err := node.Eval(ctx)
+	if err != nil {
+		t.Fatalf("Got err: %#v", err)
+	}
+
+	checkStateString(t, state, `
+restype.resname:
+  ID = i-abc123
+  ami = ami-abc123
+  tags.# = 1
+  tags.foo = bar
+	`)
+}
+
+func TestEvalWriteState_stream(t *testing.T) {
+	stream := new(MockStateStream)
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = []string{"root", "child"}
+	ctx.StateStreamStream = stream
+
+	writes := []*InstanceState{
+		&InstanceState{ID: "i-abc123"},
+		&InstanceState{
+			ID:         "i-abc123",
+			Attributes: map[string]string{"ami": "ami-abc123"},
+		},
+		nil,
+		nil,
+	}
+	for i, is := range writes {
+		node := &EvalWriteState{
+			Name:         "restype.resname",
+			ResourceType: "restype",
+			State:        &is,
+			Pending:      i == 1,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+
+	// Writing nothing over nothing sends no event
+	if len(stream.Events) != 3 {
+		t.Fatalf("bad: %#v", stream.Events)
+	}
+
+	ops := []string{StateEventCreate, StateEventUpdate, StateEventDelete}
+	for i, e := range stream.Events {
+		if e.Operation != ops[i] {
+			t.Fatalf("%d: bad: %s", i, e.Operation)
+		}
+		if e.Address != "module.child.restype.resname" {
+			t.Fatalf("%d: bad: %s", i, e.Address)
+		}
+		if !reflect.DeepEqual(e.Path, []string{"root", "child"}) {
+			t.Fatalf("%d: bad: %#v", i, e.Path)
+		}
+		if e.Pending != (i == 1) {
+			t.Fatalf("%d: bad: %#v", i, e)
+		}
+	}
+
+	update := stream.Events[1]
+	if update.Old.ID != "i-abc123" || len(update.Old.Attributes) != 0 {
+		t.Fatalf("bad: %#v", update.Old)
+	}
+	if update.New.Attributes["ami"] != "ami-abc123" {
+		t.Fatalf("bad: %#v", update.New)
+	}
+	if stream.Events[2].New != nil {
+		t.Fatalf("bad: %#v", stream.Events[2].New)
+	}
+
+	// The events are copies
+	writes[1].Attributes["ami"] = "changed"
+	if update.New.Attributes["ami"] != "ami-abc123" {
+		t.Fatalf("bad: %#v", update.New)
+	}
+	for i, e := range stream.Events {
+		if e.Kind != StateEventPrimary {
+			t.Fatalf("%d: bad: %s", i, e.Kind)
+		}
+	}
+}
+
+// Writing the instance that is in the state, which the write then changes
+// in place, still sends the instance as it was before.
+func TestEvalWriteState_streamInPlace(t *testing.T) {
+	stream := new(MockStateStream)
+	is := &InstanceState{
+		ID: "i-abc123",
+		Attributes: map[string]string{
+			"ami":    "ami-abc123",
+			"legacy": "value",
+		},
+	}
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"restype.resname": &ResourceState{
+						Type:    "restype",
+						Primary: is,
+					},
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+	ctx.StateStreamStream = stream
+
+	var provider ResourceProvider = &MockResourceProvider{
+		ResourcesReturn: []ResourceType{
+			ResourceType{
+				Name:       "restype",
+				Attributes: []string{"ami"},
+			},
+		},
+	}
+	node := &EvalWriteState{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+		Schema:       &provider,
+	}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(stream.Events) != 1 {
+		t.Fatalf("bad: %#v", stream.Events)
+	}
+	e := stream.Events[0]
+	if _, ok := e.Old.Attributes["legacy"]; !ok {
+		t.Fatalf("bad: %#v", e.Old)
+	}
+	if _, ok := e.New.Attributes["legacy"]; ok {
+		t.Fatalf("bad: %#v", e.New)
+	}
+}
+
+func TestEvalWriteState_streamError(t *testing.T) {
+	stream := &MockStateStream{WriteStateEventError: fmt.Errorf("down")}
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+	ctx.StateStreamStream = stream
+
+	is := &InstanceState{ID: "i-abc123"}
+	node := &EvalWriteState{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+	}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if stream.WriteStateEventCalled != 1 {
+		t.Fatalf("bad: %d", stream.WriteStateEventCalled)
+	}
+
+	checkStateString(t, state, `
+restype.resname:
+  ID = i-abc123
+	`)
+}
+
+func TestEvalWriteStateTainted(t *testing.T) {
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	is := &InstanceState{ID: "i-abc123"}
+	node := &EvalWriteStateTainted{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+		Index:        -1,
+	}
+	_, err := node.Eval(ctx)
+	if err != nil {
+		t.Fatalf("Got err: %#v", err)
+	}
+
+	checkStateString(t, state, `
+restype.resname: (1 tainted)
+  ID = <not created>
+  Tainted ID 1 = i-abc123
+	`)
+}
+
+func TestEvalWriteStateTainted_stream(t *testing.T) {
+	stream := new(MockStateStream)
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+	ctx.StateStreamStream = stream
+
+	writes := []*InstanceState{
+		&InstanceState{ID: "i-abc123"},
+		nil,
+	}
+	for i, is := range writes {
+		node := &EvalWriteStateTainted{
+			Name:         "restype.resname",
+			ResourceType: "restype",
+			State:        &is,
+			Index:        i - 1,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+
+	if len(stream.Events) != 2 {
+		t.Fatalf("bad: %#v", stream.Events)
+	}
+	ops := []string{StateEventCreate, StateEventDelete}
+	for i, e := range stream.Events {
+		if e.Operation != ops[i] || e.Kind != StateEventTainted {
+			t.Fatalf("%d: bad: %#v", i, e)
+		}
+	}
+	if stream.Events[1].Old.ID != "i-abc123" {
+		t.Fatalf("bad: %#v", stream.Events[1].Old)
+	}
+}
+
+func TestEvalWriteStateDeposed(t *testing.T) {
+	state := &State{}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	is := &InstanceState{ID: "i-abc123"}
+	node := &EvalWriteStateDeposed{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+		Index:        -1,
+	}
+	_, err := node.Eval(ctx)
+	if err != nil {
+		t.Fatalf("Got err: %#v", err)
+	}
+
+	checkStateString(t, state, `
+restype.resname: (1 deposed)
+  ID = <not created>
+  Deposed ID 1 = i-abc123
+	`)
+}
+
+func TestEvalWriteStateDeposed_key(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"restype.resname": &ResourceState{
+						Type: "restype",
+						Deposed: []*InstanceState{
+							&InstanceState{ID: "i-abc123"},
+							&InstanceState{ID: "i-def456"},
+							&InstanceState{ID: "i-ghi789"},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	// Destroying an instance removes it
+	destroyed := new(InstanceState)
+	node := &EvalWriteStateDeposed{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &destroyed,
+		Key:          "i-abc123",
+	}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The keys of the others still target them
+	is := &InstanceState{
+		ID:         "i-ghi789",
+		Attributes: map[string]string{"ami": "ami-123"},
+	}
+	node = &EvalWriteStateDeposed{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+		Key:          "i-ghi789",
+	}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	deposed := state.RootModule().Resources["restype.resname"].Deposed
+	if len(deposed) != 2 || deposed[0].ID != "i-def456" || deposed[1] != is {
+		t.Fatalf("bad: %#v", deposed)
+	}
+
+	// A key that's gone is an error
+	node = &EvalWriteStateDeposed{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &destroyed,
+		Key:          "i-abc123",
+	}
+	_, err := node.Eval(ctx)
+	if err == nil || !strings.Contains(err.Error(), `no deposed instance with key "i-abc123"`) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestEvalWriteStateDeposed_badIndex(t *testing.T) {
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	is := &InstanceState{ID: "i-abc123"}
+	node := &EvalWriteStateDeposed{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+		Index:        1,
+	}
+	_, err := node.Eval(ctx)
+	if err == nil || !strings.Contains(err.Error(), "bad deposed index") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestEvalDeposeState_repeated(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{ID: "i-1"},
+					},
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	// A failed create before destroy leaves the deposed instance, and the
+	// next one must not drop it.
+	depose := &EvalDeposeState{Name: "aws_instance.foo"}
+	if _, err := depose.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	rs.Primary = &InstanceState{ID: "i-2"}
+	if _, err := depose.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+aws_instance.foo: (2 deposed)
+  ID = <not created>
+  Deposed ID 1 = i-1
+  Deposed ID 2 = i-2
+	`)
+
+	// Undeposing pops the most recent one
+	undepose := &EvalUndeposeState{Name: "aws_instance.foo"}
+	if _, err := undepose.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+aws_instance.foo: (1 deposed)
+  ID = i-2
+  Deposed ID 1 = i-1
+	`)
+}
+
+func TestEvalDeposeState_stream(t *testing.T) {
+	stream := new(MockStateStream)
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{ID: "i-1"},
+					},
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+	ctx.StateStreamStream = stream
+
+	depose := &EvalDeposeState{Name: "aws_instance.foo"}
+	if _, err := depose.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	undepose := &EvalUndeposeState{Name: "aws_instance.foo"}
+	if _, err := undepose.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"delete primary",
+		"create deposed",
+		"delete deposed",
+		"create primary",
+	}
+	if len(stream.Events) != len(expected) {
+		t.Fatalf("bad: %#v", stream.Events)
+	}
+	for i, e := range stream.Events {
+		if actual := e.Operation + " " + e.Kind; actual != expected[i] {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+		is := e.Old
+		if is == nil {
+			is = e.New
+		}
+		if is.ID != "i-1" {
+			t.Fatalf("%d: bad: %#v", i, e)
+		}
+	}
+}
+
+func TestEvalTaintResource(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{ID: "i-1"},
+					},
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	// Tainting again once it is fully tainted doesn't add it twice
+	taint := &EvalTaintResource{Name: "aws_instance.foo"}
+	for i := 0; i < 2; i++ {
+		if _, err := taint.Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	checkStateString(t, state, `
+aws_instance.foo: (1 tainted)
+  ID = <not created>
+  Tainted ID 1 = i-1
+	`)
+
+	untaint := &EvalUntaintResource{Name: "aws_instance.foo"}
+	if _, err := untaint.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = i-1
+	`)
+}
+
+func TestEvalUntaintResource_primary(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{ID: "i-2"},
+						Tainted: []*InstanceState{
+							&InstanceState{ID: "i-1"},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	untaint := &EvalUntaintResource{Name: "aws_instance.foo"}
+	if _, err := untaint.Eval(ctx); err == nil {
+		t.Fatal("should error")
+	}
+
+	checkStateString(t, state, `
+aws_instance.foo: (1 tainted)
+  ID = i-2
+  Tainted ID 1 = i-1
+	`)
+}
+
+// testLockCheckBackend is a MockStateBackend that records whether the
+// state lock is held while the state is written.
+type testLockCheckBackend struct {
+	*MockStateBackend
+
+	StateLock *sync.RWMutex
+	Held      bool
+}
+
+func (b *testLockCheckBackend) Write(s *State) error {
+	doneCh := make(chan struct{})
+	go func() {
+		b.StateLock.Lock()
+		b.StateLock.Unlock()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(100 * time.Millisecond):
+		b.Held = true
+	}
+
+	return b.MockStateBackend.Write(s)
 }
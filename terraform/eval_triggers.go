@@ -0,0 +1,159 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalDiffProvisionerTriggers is an EvalNode implementation that marks
+// the diff of an existing resource to run its provisioners again if the
+// triggers of any of them changed since they last ran. A diff is created
+// if there isn't one.
+//
+// New resources run all their provisioners anyways, so they're skipped.
+type EvalDiffProvisionerTriggers struct {
+	Resource       *config.Resource
+	InterpResource *Resource
+	State          **InstanceState
+	Diff           **InstanceDiff
+}
+
+func (n *EvalDiffProvisionerTriggers) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	if state == nil || state.ID == "" {
+		return nil, nil
+	}
+
+	diff := *n.Diff
+	if diff != nil && (diff.Destroy || diff.RequiresNew()) {
+		return nil, nil
+	}
+
+	triggered, err := triggeredProvisioners(
+		ctx, n.Resource, n.InterpResource, state)
+	if err != nil {
+		return nil, err
+	}
+	if len(triggered) == 0 {
+		return nil, nil
+	}
+
+	log.Printf(
+		"[DEBUG] %s: provisioner triggers changed, will provision",
+		n.Resource.Id())
+	if diff == nil {
+		diff = new(InstanceDiff)
+	}
+	diff.Provision = true
+	*n.Diff = diff
+
+	return nil, nil
+}
+
+// provisionerTriggers interpolates the triggers of a provisioner. If any
+// of them can't be computed yet, computed is true.
+func provisionerTriggers(
+	ctx EvalContext,
+	p *config.Provisioner,
+	r *Resource) (triggers map[string]string, computed bool, err error) {
+	if p.Triggers == nil || len(p.Triggers.Raw) == 0 {
+		return nil, false, nil
+	}
+
+	rc, err := ctx.Interpolate(p.Triggers.Copy(), r)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(rc.ComputedKeys) > 0 {
+		return nil, true, nil
+	}
+
+	triggers = make(map[string]string, len(rc.Config))
+	for k, v := range rc.Config {
+		if s, ok := v.(string); ok {
+			triggers[k] = s
+		} else {
+			triggers[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return triggers, false, nil
+}
+
+// triggeredProvisioners returns the indexes of the provisioners of the
+// resource that have triggers that differ from the ones they last ran
+// with, as recorded in the state by writeProvisionerTriggers. Triggers
+// that can't be computed yet count as changed.
+func triggeredProvisioners(
+	ctx EvalContext,
+	resource *config.Resource,
+	r *Resource,
+	state *InstanceState) (map[int]struct{}, error) {
+	result := make(map[int]struct{})
+	for i, p := range resource.Provisioners {
+		// Provisioners that run on destroy or migrate aren't triggered
+		if p.When == config.ProvisionerWhenDestroy ||
+			p.When == config.ProvisionerWhenMigrate {
+			continue
+		}
+
+		triggers, computed, err := provisionerTriggers(ctx, p, r)
+		if err != nil {
+			return nil, err
+		}
+		if !computed && triggers == nil {
+			continue
+		}
+
+		if computed || !sameProvisionerTriggers(state, i, triggers) {
+			result[i] = struct{}{}
+		}
+	}
+
+	return result, nil
+}
+
+// provisionerTriggersPrefix is the prefix of the keys in the meta of an
+// instance that the triggers of the provisioner at index i are kept in.
+func provisionerTriggersPrefix(i int) string {
+	return fmt.Sprintf("provisioner.%d.triggers.", i)
+}
+
+func sameProvisionerTriggers(
+	state *InstanceState, i int, triggers map[string]string) bool {
+	prefix := provisionerTriggersPrefix(i)
+
+	count := 0
+	for k, v := range state.Meta {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		count++
+		if t, ok := triggers[k[len(prefix):]]; !ok || t != v {
+			return false
+		}
+	}
+
+	return count == len(triggers)
+}
+
+// writeProvisionerTriggers records the triggers the provisioner at index
+// i ran with in the meta of the instance, replacing the old ones.
+func writeProvisionerTriggers(
+	state *InstanceState, i int, triggers map[string]string) {
+	prefix := provisionerTriggersPrefix(i)
+
+	state.init()
+	for k := range state.Meta {
+		if strings.HasPrefix(k, prefix) {
+			delete(state.Meta, k)
+		}
+	}
+	for k, v := range triggers {
+		state.Meta[prefix+k] = v
+	}
+}
@@ -2,8 +2,13 @@ package terraform
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/mitchellh/go-homedir"
 )
 
 // EvalValidateError is the error structure returned if there were
@@ -17,38 +22,222 @@ func (e *EvalValidateError) Error() string {
 	return fmt.Sprintf("Warnings: %s. Errors: %s", e.Warnings, e.Errors)
 }
 
+// any returns true if there are any warnings or errors.
+func (e *EvalValidateError) any() bool {
+	return len(e.Warnings) > 0 || len(e.Errors) > 0
+}
+
 // EvalValidateCount is an EvalNode implementation that validates
 // the count of a resource.
+//
+// The count must be a non-negative integer once it's interpolated. If it
+// depends on something that is only known once it's planned, such as an
+// attribute of another resource, it can't be checked yet, which is only a
+// warning. The rest of the resource is then validated with a count of one.
+//
+// The destroy nodes of the resource expand the same count, so with Destroy
+// set the count is interpolated and replaced the same way, but only the
+// resource itself reports what's wrong with it.
 type EvalValidateCount struct {
 	Resource *config.Resource
+	Destroy  bool
 }
 
-// TODO: test
 func (n *EvalValidateCount) Eval(ctx EvalContext) (interface{}, error) {
-	var count int
-	var errs []error
-	var err error
 	if _, err := ctx.Interpolate(n.Resource.RawCount, nil); err != nil {
+		return nil, &EvalValidateError{
+			Errors: []error{fmt.Errorf("Failed to interpolate count: %s", err)},
+		}
+	}
+
+	var errs []error
+	var warns []string
+	if len(n.Resource.RawCount.UnknownKeys()) > 0 {
+		warns = append(warns, fmt.Sprintf(
+			"count %q can't be validated until it's planned, since it "+
+				"depends on values that aren't known yet",
+			n.Resource.RawCount.Raw[n.Resource.RawCount.Key]))
+	} else if count, err := n.Resource.Count(); err != nil {
 		errs = append(errs, fmt.Errorf(
-			"Failed to interpolate count: %s", err))
-		goto RETURN
+			"count must be a non-negative integer, got %q",
+			n.Resource.RawCount.Value()))
+	} else if count < 0 {
+		errs = append(errs, fmt.Errorf(
+			"count must be a non-negative integer, got %d", count))
 	}
 
-	count, err = n.Resource.Count()
-	if err != nil {
-		// If we can't get the count during validation, then
-		// just replace it with the number 1.
-		c := n.Resource.RawCount.Config()
-		c[n.Resource.RawCount.Key] = "1"
-		count = 1
+	if len(warns) == 0 && len(errs) == 0 {
+		return nil, nil
 	}
 
-	if count < 0 {
-		errs = append(errs, fmt.Errorf(
-			"Count is less than zero: %d", count))
+	// Validate the rest with a count of one, so that a count that isn't
+	// valid or known yet doesn't fail the expansion of the resource too.
+	c := n.Resource.RawCount.Config()
+	c[n.Resource.RawCount.Key] = "1"
+
+	if n.Destroy {
+		return nil, nil
+	}
+
+	return nil, &EvalValidateError{
+		Warnings: warns,
+		Errors:   errs,
+	}
+}
+
+// EvalValidateReferences is an EvalNode implementation that validates
+// that the references of a resource resolve: references to resources,
+// such as "aws_instance.foo.id" or the counted "aws_instance.foo.0.id",
+// to resources declared in the same module, and references to modules,
+// such as "module.child.address", to the outputs of declared modules.
+//
+// The configuration doesn't record positions, so the errors name the
+// resource, the reference and the directory of the module.
+type EvalValidateReferences struct {
+	Resource *config.Resource
+
+	// Module is the module tree of the module the resource is in.
+	Module *module.Tree
+}
+
+func (n *EvalValidateReferences) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Module == nil {
+		return nil, nil
+	}
+
+	c := n.Module.Config()
+	resources := make(map[string]struct{}, len(c.Resources))
+	for _, r := range c.Resources {
+		resources[r.Id()] = struct{}{}
+	}
+	modules := make(map[string]struct{}, len(c.Modules))
+	for _, m := range c.Modules {
+		modules[m.Name] = struct{}{}
+	}
+
+	raws := []*config.RawConfig{n.Resource.RawCount, n.Resource.RawConfig}
+	for _, p := range n.Resource.Provisioners {
+		raws = append(raws, p.RawConfig, p.ConnInfo)
+	}
+
+	var errs []error
+	for _, raw := range raws {
+		if raw == nil {
+			continue
+		}
+
+		for _, v := range raw.Variables {
+			var reason string
+			switch v := v.(type) {
+			case *config.ResourceVariable:
+				if _, ok := resources[v.ResourceId()]; !ok {
+					reason = fmt.Sprintf("unknown resource '%s'", v.ResourceId())
+				}
+			case *config.ModuleVariable:
+				if _, ok := modules[v.Name]; !ok {
+					reason = fmt.Sprintf("unknown module '%s'", v.Name)
+					break
+				}
+
+				reason = fmt.Sprintf(
+					"module '%s' has no output '%s'", v.Name, v.Field)
+				if child := n.Module.Children()[v.Name]; child != nil {
+					for _, o := range child.Config().Outputs {
+						if o.Name == v.Field {
+							reason = ""
+							break
+						}
+					}
+				}
+			}
+			if reason == "" {
+				continue
+			}
+
+			errs = append(errs, fmt.Errorf(
+				"%s: reference ${%s} doesn't resolve: %s (in %s)",
+				n.Resource.Id(), v.FullKey(), reason, c.Dir))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	return nil, &EvalValidateError{
+		Errors: errs,
+	}
+}
+
+// EvalValidateResourceIndexes is an EvalNode implementation that validates
+// that indexed references to other resources, such as
+// "aws_instance.foo.5.id", are within the count of those resources.
+//
+// Literal counts are checked when the configuration is validated, so only
+// counts that are interpolated are checked here. If a count can't be
+// resolved yet, such as a computed count, the references are skipped.
+type EvalValidateResourceIndexes struct {
+	Resource *config.Resource
+
+	// Resources are all the resources in the same module.
+	Resources []*config.Resource
+}
+
+func (n *EvalValidateResourceIndexes) Eval(ctx EvalContext) (interface{}, error) {
+	targets := make(map[string]*config.Resource, len(n.Resources))
+	for _, r := range n.Resources {
+		targets[r.Id()] = r
+	}
+
+	raws := []*config.RawConfig{n.Resource.RawCount, n.Resource.RawConfig}
+	for _, p := range n.Resource.Provisioners {
+		raws = append(raws, p.RawConfig)
+		if p.Teardown != nil {
+			raws = append(raws, p.Teardown.RawConfig)
+		}
+	}
+
+	var errs []error
+	for _, raw := range raws {
+		for _, v := range raw.Variables {
+			rv, ok := v.(*config.ResourceVariable)
+			if !ok || !rv.Multi || rv.Index < 0 {
+				continue
+			}
+
+			target, ok := targets[rv.ResourceId()]
+			if !ok || len(target.RawCount.Variables) == 0 {
+				continue
+			}
+
+			// Interpolate a copy of the count, since the count of the
+			// target may have been replaced while validating it.
+			rc := target.RawCount.Copy()
+			if _, err := ctx.Interpolate(rc, nil); err != nil {
+				continue
+			}
+			value, ok := rc.Value().(string)
+			if !ok || value == config.UnknownVariableValue {
+				continue
+			}
+			count, err := strconv.ParseInt(value, 0, 0)
+			if err != nil {
+				continue
+			}
+
+			if int64(rv.Index) >= count {
+				errs = append(errs, fmt.Errorf(
+					"%s: index %d is out of range for resource '%s' with "+
+						"count %d, valid indexes are 0 to %d",
+					rv.FullKey(), rv.Index, target.Id(), count, count-1))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
 	}
 
-RETURN:
 	return nil, &EvalValidateError{
 		Errors: errs,
 	}
@@ -97,6 +286,96 @@ func (n *EvalValidateProvisioner) Eval(ctx EvalContext) (interface{}, error) {
 	}
 }
 
+// connectionKeyFiles are the keys of a connection block that are paths
+// to credential files.
+var connectionKeyFiles = []string{"key_file", "bastion_key_file"}
+
+// EvalValidateConnection is an EvalNode implementation that validates
+// that the credential files referenced by the connection block of a
+// provisioner exist and are readable, so that a resource isn't created
+// only for its provisioning to fail.
+//
+// Paths that can't be resolved yet, such as ones that reference computed
+// attributes, are skipped. The contents of a key are never put into an
+// error, even if they are given in place of a path.
+type EvalValidateConnection struct {
+	Name     string
+	Config   *config.RawConfig
+	Resource *Resource
+}
+
+func (n *EvalValidateConnection) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Config == nil {
+		return nil, nil
+	}
+
+	rc, err := ctx.Interpolate(n.Config.Copy(), n.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, k := range connectionKeyFiles {
+		raw, ok := rc.Get(k)
+		if !ok || rc.IsComputed(k) {
+			continue
+		}
+		path, ok := raw.(string)
+		if !ok || path == "" || path == config.UnknownVariableValue {
+			continue
+		}
+
+		if strings.Contains(path, "PRIVATE KEY") {
+			errs = append(errs, fmt.Errorf(
+				"%s: connection %s must be the path to a key, "+
+					"not the contents of the key (<sensitive>)", n.Name, k))
+			continue
+		}
+
+		if err := validateConnectionFile(path); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"%s: connection %s: %s", n.Name, k, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	return nil, &EvalValidateError{
+		Errors: errs,
+	}
+}
+
+// validateConnectionFile verifies that the file at the path exists and
+// can be opened for reading.
+func validateConnectionFile(path string) error {
+	fullPath, err := homedir.Expand(path)
+	if err != nil {
+		return fmt.Errorf("error expanding %q: %s", path, err)
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file %q does not exist", path)
+		}
+
+		return fmt.Errorf("file %q is not readable: %s", path, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("file %q is not readable: %s", path, err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%q is a directory, not a file", path)
+	}
+
+	return nil
+}
+
 // EvalValidateResource is an EvalNode implementation that validates
 // the configuration of a resource.
 type EvalValidateResource struct {
@@ -0,0 +1,137 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// dependencyStateTimeout is how long EvalWaitForDependencies waits for the
+// state of a dependency, and dependencyStatePoll how often it checks it.
+// They are variables so they can be changed in tests.
+var (
+	dependencyStateTimeout = 30 * time.Second
+	dependencyStatePoll    = 50 * time.Millisecond
+)
+
+// EvalWaitForDependencies is an EvalNode implementation that waits until
+// the resources that the config of a resource references have their state
+// written, before the config is interpolated for the apply. A dependency
+// with a change in the diff must have been applied, so that its computed
+// attributes are read from its fresh state rather than being unknown.
+//
+// The graph orders an apply after the applies of its dependencies, so the
+// state is normally written already. If it isn't written before the
+// timeout, the apply fails with an error naming the dependency. A stopped
+// walk stops the wait.
+//
+// This resource doesn't depend on the resources in Lazy, see
+// config.ResourceLifecycle.LazyReferences, so they may still be applying
+// and the timeout doesn't apply to them. If their apply fails, their diff
+// is cleared, which ends the wait too. When planning, they're unknown if
+// they have a change, see Interpolater.lazyPending.
+type EvalWaitForDependencies struct {
+	Name   string
+	Config *config.RawConfig
+	Lazy   []string
+}
+
+func (n *EvalWaitForDependencies) Eval(ctx EvalContext) (interface{}, error) {
+	var ids []string
+	for _, v := range n.Config.Variables {
+		if rv, ok := v.(*config.ResourceVariable); ok {
+			ids = append(ids, rv.ResourceId())
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	lazy := make(map[string]struct{})
+	for _, id := range n.Lazy {
+		lazy[id] = struct{}{}
+	}
+
+	start := time.Now()
+	for {
+		waiting, id := n.waiting(ctx, ids)
+		if waiting == "" {
+			return nil, nil
+		}
+
+		_, isLazy := lazy[id]
+		if !isLazy && time.Since(start) >= dependencyStateTimeout {
+			return nil, fmt.Errorf(
+				"%s: timed out after %s waiting for the state of %s, which "+
+					"it depends on. The apply of %s may have failed or be "+
+					"taking too long.",
+				n.Name, dependencyStateTimeout, waiting, waiting)
+		}
+
+		log.Printf("[DEBUG] %s: waiting for the state of %s", n.Name, waiting)
+		select {
+		case <-time.After(dependencyStatePoll):
+		case <-ctx.Stopped():
+			log.Printf("[WARN] %s: stopped while waiting for %s", n.Name, waiting)
+			return nil, EvalEarlyExitError{}
+		}
+	}
+}
+
+// waiting returns the name of an instance of the resources with the given
+// IDs that is still to be written to the state and the ID of its resource,
+// or "" if there is none.
+func (n *EvalWaitForDependencies) waiting(
+	ctx EvalContext, ids []string) (string, string) {
+	diff, diffLock := ctx.Diff()
+	state, stateLock := ctx.State()
+
+	diffLock.RLock()
+	defer diffLock.RUnlock()
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+
+	if diff == nil {
+		return "", ""
+	}
+	modDiff := diff.ModuleByPath(ctx.Path())
+	if modDiff == nil {
+		return "", ""
+	}
+
+	var modState *ModuleState
+	if state != nil {
+		modState = state.ModuleByPath(ctx.Path())
+	}
+
+	for _, id := range ids {
+		for k, d := range modDiff.Resources {
+			// The diffs of counted resources are per instance
+			if k != id && !strings.HasPrefix(k, id+".") {
+				continue
+			}
+
+			// Only the instances that this apply creates or updates
+			// are written. Queued changes aren't applied until later.
+			if d.Empty() || (d.Destroy && len(d.Attributes) == 0) {
+				continue
+			}
+			if !d.ScheduledFor.IsZero() {
+				continue
+			}
+
+			var rs *ResourceState
+			if modState != nil {
+				rs = modState.Resources[k]
+			}
+			if rs == nil || rs.Pending || rs.Primary == nil || rs.Primary.ID == "" {
+				return k, id
+			}
+		}
+	}
+
+	return "", ""
+}
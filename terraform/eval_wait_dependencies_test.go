@@ -0,0 +1,171 @@
+package terraform
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestEvalWaitForDependencies(t *testing.T) {
+	oldTimeout, oldPoll := dependencyStateTimeout, dependencyStatePoll
+	dependencyStateTimeout = 50 * time.Millisecond
+	dependencyStatePoll = time.Millisecond
+	defer func() {
+		dependencyStateTimeout, dependencyStatePoll = oldTimeout, oldPoll
+	}()
+
+	create := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"id": &ResourceAttrDiff{NewComputed: true, RequiresNew: true},
+		},
+	}
+
+	cases := map[string]struct {
+		Diff  map[string]*InstanceDiff
+		State map[string]*ResourceState
+		Err   bool
+	}{
+		"applied": {
+			map[string]*InstanceDiff{"aws_instance.foo": create},
+			map[string]*ResourceState{
+				"aws_instance.foo": &ResourceState{
+					Primary: &InstanceState{ID: "foo"},
+				},
+			},
+			false,
+		},
+
+		"not written": {
+			map[string]*InstanceDiff{"aws_instance.foo": create},
+			nil,
+			true,
+		},
+
+		"pending": {
+			map[string]*InstanceDiff{"aws_instance.foo": create},
+			map[string]*ResourceState{
+				"aws_instance.foo": &ResourceState{
+					Primary: &InstanceState{ID: "foo"},
+					Pending: true,
+				},
+			},
+			true,
+		},
+
+		"counted": {
+			map[string]*InstanceDiff{
+				"aws_instance.foo.0": create,
+				"aws_instance.foo.1": create,
+			},
+			map[string]*ResourceState{
+				"aws_instance.foo.0": &ResourceState{
+					Primary: &InstanceState{ID: "foo"},
+				},
+			},
+			true,
+		},
+
+		"no change": {
+			nil,
+			nil,
+			false,
+		},
+
+		"queued": {
+			map[string]*InstanceDiff{
+				"aws_instance.foo": &InstanceDiff{
+					Attributes:   create.Attributes,
+					ScheduledFor: time.Now(),
+				},
+			},
+			nil,
+			false,
+		},
+	}
+
+	for name, tc := range cases {
+		rc, err := config.NewRawConfig(map[string]interface{}{
+			"foo": "${aws_instance.foo.id}",
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		ctx := new(MockEvalContext)
+		ctx.PathPath = rootModulePath
+		ctx.DiffDiff = &Diff{
+			Modules: []*ModuleDiff{
+				&ModuleDiff{Path: rootModulePath, Resources: tc.Diff},
+			},
+		}
+		ctx.DiffLock = new(sync.RWMutex)
+		ctx.StateState = &State{
+			Modules: []*ModuleState{
+				&ModuleState{Path: rootModulePath, Resources: tc.State},
+			},
+		}
+		ctx.StateLock = new(sync.RWMutex)
+
+		n := &EvalWaitForDependencies{Name: "aws_instance.bar", Config: rc}
+		_, err = n.Eval(ctx)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "waiting for the state of aws_instance.foo") {
+			t.Fatalf("%s: bad: %s", name, err)
+		}
+	}
+}
+
+func TestEvalWaitForDependencies_written(t *testing.T) {
+	oldPoll := dependencyStatePoll
+	dependencyStatePoll = time.Millisecond
+	defer func() { dependencyStatePoll = oldPoll }()
+
+	rc, err := config.NewRawConfig(map[string]interface{}{
+		"foo": "${aws_instance.foo.id}",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state := &State{}
+	state.init()
+	ctx := new(MockEvalContext)
+	ctx.PathPath = rootModulePath
+	ctx.DiffDiff = &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"id": &ResourceAttrDiff{NewComputed: true},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx.DiffLock = new(sync.RWMutex)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+
+	// The state is written while the node waits for it
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ctx.StateLock.Lock()
+		defer ctx.StateLock.Unlock()
+		state.RootModule().Resources["aws_instance.foo"] = &ResourceState{
+			Primary: &InstanceState{ID: "foo"},
+		}
+	}()
+
+	n := &EvalWaitForDependencies{Name: "aws_instance.bar", Config: rc}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -89,12 +89,19 @@ func (g *Graph) Replace(o, n dag.Vertex) bool {
 // GraphNodeDependables. It returns the list of dependents it was
 // unable to connect to.
 func (g *Graph) ConnectDependent(raw dag.Vertex) []string {
-	v, ok := raw.(GraphNodeDependent)
-	if !ok {
-		return nil
+	var missing []string
+	if v, ok := raw.(GraphNodeDependent); ok {
+		missing = g.ConnectTo(v, v.DependentOn())
+	}
+
+	// Soft dependencies are connected last, so that they never replace
+	// a regular dependency on the same node.
+	if v, ok := raw.(GraphNodeSoftDependent); ok {
+		missing = append(
+			missing, g.connectTo(v, v.SoftDependentOn(), dag.SoftEdge)...)
 	}
 
-	return g.ConnectTo(v, v.DependentOn())
+	return missing
 }
 
 // ConnectDependents goes through the graph, connecting all the
@@ -105,9 +112,7 @@ func (g *Graph) ConnectDependent(raw dag.Vertex) []string {
 // specific ConnectDependent should be used.
 func (g *Graph) ConnectDependents() {
 	for _, v := range g.Vertices() {
-		if dv, ok := v.(GraphNodeDependent); ok {
-			g.ConnectDependent(dv)
-		}
+		g.ConnectDependent(v)
 	}
 }
 
@@ -124,12 +129,19 @@ func (g *Graph) ConnectFrom(source string, target dag.Vertex) {
 // ConnectTo connects a vertex to a raw string of targets that are the
 // result of DependableName, and returns the list of targets that are missing.
 func (g *Graph) ConnectTo(v dag.Vertex, targets []string) []string {
+	return g.connectTo(v, targets, dag.BasicEdge)
+}
+
+func (g *Graph) connectTo(
+	v dag.Vertex,
+	targets []string,
+	edgeFn func(source, target dag.Vertex) dag.Edge) []string {
 	g.once.Do(g.init)
 
 	var missing []string
 	for _, t := range targets {
 		if dest := g.dependableMap[t]; dest != nil {
-			g.Connect(dag.BasicEdge(v, dest))
+			g.Connect(edgeFn(v, dest))
 		} else {
 			missing = append(missing, t)
 		}
@@ -253,3 +265,18 @@ type GraphNodeDependable interface {
 type GraphNodeDependent interface {
 	DependentOn() []string
 }
+
+// GraphNodeSoftDependent is an interface which says that a node should
+// come after other GraphNodeDependables by some name, but that it doesn't
+// depend on them succeeding. See dag.SoftEdge.
+type GraphNodeSoftDependent interface {
+	SoftDependentOn() []string
+}
+
+// GraphNodeLazyDependent is an interface which says that a node references
+// other GraphNodeDependables by some name without depending on them, since
+// the references are only resolved during the apply. See
+// LazyReferenceTransformer.
+type GraphNodeLazyDependent interface {
+	LazyDependentOn() []string
+}
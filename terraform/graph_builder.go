@@ -67,6 +67,10 @@ type BuiltinGraphBuilder struct {
 	// Providers is the list of providers supported.
 	Providers []string
 
+	// ProviderFactories are the factories of the providers, used to ask
+	// the providers about the resource types they have while building.
+	ProviderFactories map[string]ResourceProviderFactory
+
 	// Provisioners is the list of provisioners supported.
 	Provisioners []string
 
@@ -86,6 +90,14 @@ type BuiltinGraphBuilder struct {
 	// skipping any prune steps. This is used for early cycle detection during
 	// Validate and for manual inspection via `terraform graph -verbose`.
 	Verbose bool
+
+	// Coordinate is set to true when the applies are coordinated with
+	// the other deployments by a Coordinator.
+	Coordinate bool
+
+	// CostBudget, if greater than zero, is the budget that the estimated
+	// cost of an apply is checked against. See ContextOpts.CostBudget.
+	CostBudget float64
 }
 
 // Build builds the graph according to the steps returned by Steps.
@@ -104,6 +116,7 @@ func (b *BuiltinGraphBuilder) Steps(path []string) []GraphTransformer {
 	steps := []GraphTransformer{
 		// Create all our resources from the configuration and state
 		&ConfigTransformer{Module: b.Root},
+		&ModuleCountTransformer{State: b.State},
 		&OrphanTransformer{
 			State:     b.State,
 			Module:    b.Root,
@@ -150,6 +163,15 @@ func (b *BuiltinGraphBuilder) Steps(path []string) []GraphTransformer {
 			// their dependencies.
 			&TargetsTransformer{Targets: b.Targets, Destroy: b.Destroy},
 
+			// Resources that depend on one that is created before it is
+			// destroyed must be too. This must happen before the stages
+			// add their edges, they aren't dependencies.
+			&CreateBeforeDestroyPropagateTransformer{},
+
+			// Order the resources by their lifecycle stages. This has to
+			// happen after flattening so that stages span modules.
+			&StageTransformer{Stages: b.stages()},
+
 			// Prune the providers and provisioners. This must happen
 			// only once because flattened modules might depend on empty
 			// providers.
@@ -159,6 +181,11 @@ func (b *BuiltinGraphBuilder) Steps(path []string) []GraphTransformer {
 			// Create the destruction nodes
 			&DestroyTransformer{FullDestroy: b.Destroy},
 			&CreateBeforeDestroyTransformer{},
+
+			// Lazy references must not wait on a resource that depends
+			// on the resource that references it
+			&LazyReferenceTransformer{},
+
 			b.conditional(&conditionalOpts{
 				If:   func() bool { return !b.Verbose },
 				Then: &PruneDestroyTransformer{Diff: b.Diff, State: b.State},
@@ -167,10 +194,31 @@ func (b *BuiltinGraphBuilder) Steps(path []string) []GraphTransformer {
 			// Remove the noop nodes
 			&PruneNoopTransformer{Diff: b.Diff, State: b.State},
 
+			// Ensure the implicit prerequisites of the resources that
+			// are left before they're applied
+			&PrerequisiteTransformer{Providers: b.ProviderFactories},
+
+			// Check the cost of the apply before anything is applied
+			b.conditional(&conditionalOpts{
+				If:   func() bool { return b.CostBudget > 0 },
+				Then: &CostGateTransformer{Budget: b.CostBudget},
+			}),
+
+			// Check the required versions of Terraform before anything
+			// else is validated
+			&CoreVersionTransformer{Module: b.Root},
+
 			// Insert nodes to close opened plugin connections
 			&CloseProviderTransformer{},
 			&CloseProvisionerTransformer{},
 
+			// Record the apply for the other deployments once everything
+			// else is done
+			b.conditional(&conditionalOpts{
+				If:   func() bool { return b.Coordinate },
+				Then: &CoordinateTransformer{},
+			}),
+
 			// Make sure we have a single root after the above changes.
 			// This is the 2nd root transformer. In practice this shouldn't
 			// actually matter as the RootTransformer is idempotent.
@@ -203,3 +251,17 @@ func (b *BuiltinGraphBuilder) conditional(o *conditionalOpts) GraphTransformer {
 	}
 	return nil
 }
+
+// stages returns the lifecycle stages declared in the root module, in
+// the order they are applied.
+func (b *BuiltinGraphBuilder) stages() []string {
+	if b.Root == nil {
+		return nil
+	}
+
+	if c := b.Root.Config(); c != nil && c.Terraform != nil {
+		return c.Terraform.Stages
+	}
+
+	return nil
+}
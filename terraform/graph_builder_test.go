@@ -136,6 +136,35 @@ func TestBuiltinGraphBuilder_cbdDepNonCbd_errorsWhenVerbose(t *testing.T) {
 	}
 }
 
+// A lazy reference breaks the cycle of a create before destroy resource
+// that depends on one that isn't.
+func TestBuiltinGraphBuilder_cbdDepNonCbd_lazy(t *testing.T) {
+	b := &BuiltinGraphBuilder{
+		Root:     testModule(t, "graph-builder-cbd-non-cbd-lazy"),
+		Validate: true,
+		Verbose:  true,
+	}
+
+	if _, err := b.Build(RootModulePath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestBuiltinGraphBuilder_lazyCycle(t *testing.T) {
+	b := &BuiltinGraphBuilder{
+		Root:     testModule(t, "graph-builder-lazy-cycle"),
+		Validate: true,
+	}
+
+	_, err := b.Build(RootModulePath)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "lazy reference to aws_instance.db is a cycle") {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestBuiltinGraphBuilder_multiLevelModule(t *testing.T) {
 	b := &BuiltinGraphBuilder{
 		Root:     testModule(t, "graph-builder-multi-level-module"),
@@ -249,7 +278,9 @@ aws_instance.db
   aws_instance.db (destroy)
 aws_instance.db (destroy tainted)
   aws_instance.web (destroy tainted)
+  aws_instance.web (destroy)
 aws_instance.db (destroy)
+  aws_instance.web (destroy tainted)
   aws_instance.web (destroy)
 aws_instance.web
   aws_instance.db
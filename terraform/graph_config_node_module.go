@@ -46,7 +46,29 @@ func (n *GraphNodeConfigModule) DependentOn() []string {
 }
 
 func (n *GraphNodeConfigModule) Name() string {
-	return fmt.Sprintf("module.%s", n.Module.Name)
+	return fmt.Sprintf("module.%s", moduleInstanceName(n.Module.Name, n.index()))
+}
+
+// index returns the index of this instance of a module with a count, or
+// -1 if the module doesn't have one.
+func (n *GraphNodeConfigModule) index() int {
+	if len(n.Path) == 0 {
+		return -1
+	}
+
+	_, index := moduleInstanceIndex(n.Path[len(n.Path)-1])
+	return index
+}
+
+// resource returns the resource that the configuration of the module is
+// interpolated for, so that count.index is the index of the instance.
+func (n *GraphNodeConfigModule) resource() *Resource {
+	index := n.index()
+	if index < 0 {
+		return nil
+	}
+
+	return &Resource{CountIndex: index}
 }
 
 // GraphNodeExpandable
@@ -148,8 +170,9 @@ func (n *graphNodeModuleExpanded) EvalTree() EvalNode {
 	return &EvalSequence{
 		Nodes: []EvalNode{
 			&EvalInterpolate{
-				Config: n.Original.Module.RawConfig,
-				Output: &resourceConfig,
+				Config:   n.Original.Module.RawConfig,
+				Resource: n.Original.resource(),
+				Output:   &resourceConfig,
 			},
 
 			&EvalVariableBlock{
@@ -192,6 +215,7 @@ func (n *graphNodeModuleExpanded) FlattenGraph() *Graph {
 				// Also set the module so we set the value on it properly.
 				vn.Module = graph.Path[len(graph.Path)-1]
 				vn.Value = config
+				vn.Resource = n.Original.resource()
 			}
 		}
 	}
@@ -102,3 +102,23 @@ func (n *GraphNodeConfigOutputFlat) DependentOn() []string {
 		n.GraphNodeConfigOutput.DependentOn(),
 		prefix)
 }
+
+// GraphNodeDestroyEdgeInclude impl.
+func (n *GraphNodeConfigOutputFlat) DestroyEdgeInclude(v dag.Vertex) bool {
+	// The destroy node of a resource whose count depends on this module
+	// keeps the edge, since the count must be known to expand it.
+	cv, ok := v.(GraphNodeCountDependent)
+	if !ok {
+		return false
+	}
+
+	for _, d := range cv.CountDependentOn() {
+		for _, d2 := range n.DependableName() {
+			if d == d2 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
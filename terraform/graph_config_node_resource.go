@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/module"
 	"github.com/hashicorp/terraform/dag"
 	"github.com/hashicorp/terraform/dot"
 )
@@ -26,6 +27,10 @@ type GraphNodeConfigResource struct {
 	// Used during DynamicExpand to target indexes
 	Targets []ResourceAddress
 
+	// Module is the module tree of the module the resource is in, used
+	// to validate the references of the resource.
+	Module *module.Tree
+
 	Path []string
 }
 
@@ -57,32 +62,69 @@ func (n *GraphNodeConfigResource) DependentOn() []string {
 			len(n.Resource.DependsOn))*2)
 	copy(result, n.Resource.DependsOn)
 
+	// The triggers must be planned before this resource so that their
+	// diffs can be checked.
+	result = append(result, n.Resource.Lifecycle.ReplaceTriggeredBy...)
+
 	for _, v := range n.Resource.RawCount.Variables {
 		if vn := varNameForVar(v); vn != "" {
 			result = append(result, vn)
 		}
 	}
+	// The lazy references aren't dependencies, but the count must be
+	// known when planning so it can't reference them.
+	lazy := make(map[string]struct{})
+	for _, r := range n.Resource.Lifecycle.LazyReferences {
+		lazy[r] = struct{}{}
+	}
+	depends := func(vn string) bool {
+		_, ok := lazy[vn]
+		return vn != "" && !ok
+	}
+
 	for _, v := range n.Resource.RawConfig.Variables {
-		if vn := varNameForVar(v); vn != "" {
+		if vn := varNameForVar(v); depends(vn) {
 			result = append(result, vn)
 		}
 	}
 	for _, p := range n.Resource.Provisioners {
 		for _, v := range p.ConnInfo.Variables {
-			if vn := varNameForVar(v); vn != "" && vn != n.Resource.Id() {
+			if vn := varNameForVar(v); depends(vn) && vn != n.Resource.Id() {
 				result = append(result, vn)
 			}
 		}
 		for _, v := range p.RawConfig.Variables {
-			if vn := varNameForVar(v); vn != "" && vn != n.Resource.Id() {
+			if vn := varNameForVar(v); depends(vn) && vn != n.Resource.Id() {
+				result = append(result, vn)
+			}
+		}
+		for _, v := range p.Triggers.Variables {
+			if vn := varNameForVar(v); depends(vn) && vn != n.Resource.Id() {
 				result = append(result, vn)
 			}
 		}
+		if p.Teardown != nil {
+			for _, v := range p.Teardown.RawConfig.Variables {
+				if vn := varNameForVar(v); depends(vn) && vn != n.Resource.Id() {
+					result = append(result, vn)
+				}
+			}
+		}
 	}
 
 	return result
 }
 
+// GraphNodeSoftDependent impl.
+func (n *GraphNodeConfigResource) SoftDependentOn() []string {
+	return n.Resource.SoftDependsOn
+}
+
+// GraphNodeLazyDependent impl.
+func (n *GraphNodeConfigResource) LazyDependentOn() []string {
+	return n.Resource.Lifecycle.LazyReferences
+}
+
 // VarWalk calls a callback for all the variables that this resource
 // depends on.
 func (n *GraphNodeConfigResource) VarWalk(fn func(config.InterpolatedVariable)) {
@@ -99,6 +141,14 @@ func (n *GraphNodeConfigResource) VarWalk(fn func(config.InterpolatedVariable))
 		for _, v := range p.RawConfig.Variables {
 			fn(v)
 		}
+		for _, v := range p.Triggers.Variables {
+			fn(v)
+		}
+		if p.Teardown != nil {
+			for _, v := range p.Teardown.RawConfig.Variables {
+				fn(v)
+			}
+		}
 	}
 }
 
@@ -138,9 +188,11 @@ func (n *GraphNodeConfigResource) Flatten(p []string) (dag.Vertex, error) {
 
 // GraphNodeDynamicExpandable impl.
 func (n *GraphNodeConfigResource) DynamicExpand(ctx EvalContext) (*Graph, error) {
+	// This takes the write lock since moving the state across the count
+	// boundary changes it
 	state, lock := ctx.State()
-	lock.RLock()
-	defer lock.RUnlock()
+	lock.Lock()
+	defer lock.Unlock()
 
 	// Start creating the steps
 	steps := make([]GraphTransformer, 0, 5)
@@ -149,16 +201,45 @@ func (n *GraphNodeConfigResource) DynamicExpand(ctx EvalContext) (*Graph, error)
 	// all the nodes, expanding counts.
 	switch n.DestroyMode {
 	case DestroyNone, DestroyPrimary:
+		steps = append(steps, &CountBoundaryTransformer{
+			Resource:   n.Resource,
+			State:      state,
+			StateCache: ctx.StateCache(),
+		})
 		steps = append(steps, &ResourceCountTransformer{
 			Resource: n.Resource,
 			Destroy:  n.DestroyMode != DestroyNone,
 			Targets:  n.Targets,
+			State:    state,
 		})
 	}
 
 	// Additional destroy modifications.
 	switch n.DestroyMode {
+	case DestroyNone:
+		// The instances beyond the count, such as when it was lowered,
+		// are destroyed after the instances that are kept are created
+		// or updated.
+		steps = append(steps, &ResourceCountOrphanTransformer{
+			Resource: n.Resource,
+			Targets:  n.Targets,
+			State:    state,
+		})
 	case DestroyPrimary:
+		// The instances beyond the count aren't orphans of the
+		// destroy, they're destroyed above.
+		orphans, err := resourceCountOrphans(n.Resource, state, ctx.Path())
+		if err != nil {
+			return nil, err
+		}
+		exclude := make([]string, len(orphans))
+		for i, index := range orphans {
+			exclude[i] = (&graphNodeExpandedResource{
+				Index:    index,
+				Resource: n.Resource,
+			}).stateId()
+		}
+
 		// If we're destroying the primary instance, then we want to
 		// expand orphans, which have all the same semantics in a destroy
 		// as a primary.
@@ -166,11 +247,13 @@ func (n *GraphNodeConfigResource) DynamicExpand(ctx EvalContext) (*Graph, error)
 			State:     state,
 			View:      n.Resource.Id(),
 			Targeting: (len(n.Targets) > 0),
+			Exclude:   exclude,
 		})
 
 		steps = append(steps, &DeposedTransformer{
-			State: state,
-			View:  n.Resource.Id(),
+			State:   state,
+			View:    n.Resource.Id(),
+			Exclude: resourceDeferReplaceIds(n.Resource),
 		})
 	case DestroyTainted:
 		// If we're only destroying tainted resources, then we only
@@ -207,16 +290,72 @@ func (n *GraphNodeConfigResource) SetTargets(targets []ResourceAddress) {
 
 // GraphNodeEvalable impl.
 func (n *GraphNodeConfigResource) EvalTree() EvalNode {
-	return &EvalSequence{
+	var resources []*config.Resource
+	if n.Module != nil {
+		resources = n.Module.Config().Resources
+	}
+
+	seq := &EvalSequence{
 		Nodes: []EvalNode{
-			&EvalInterpolate{Config: n.Resource.RawCount},
+			// The count must be known to plan and apply the resource.
+			// Validating checks it with EvalValidateCount instead.
 			&EvalOpFilter{
-				Ops:  []walkOperation{walkValidate},
-				Node: &EvalValidateCount{Resource: n.Resource},
+				Ops: []walkOperation{walkPlan, walkApply, walkPreflight},
+				Node: &EvalCountInterpolate{
+					Resource:     n.Resource,
+					AllowUnknown: n.DestroyMode != DestroyNone,
+				},
+			},
+			&EvalOpFilter{
+				Ops: []walkOperation{
+					walkPlanDestroy, walkRefresh, walkProvisionCheck,
+				},
+				Node: &EvalCountInterpolate{
+					Resource:     n.Resource,
+					AllowUnknown: true,
+				},
+			},
+			&EvalOpFilter{
+				Ops:  []walkOperation{walkInput},
+				Node: &EvalInterpolate{Config: n.Resource.RawCount},
+			},
+			&EvalOpFilter{
+				Ops: []walkOperation{walkValidate},
+				Node: &EvalValidateSequence{
+					Nodes: []EvalNode{
+						&EvalValidateReferences{
+							Resource: n.Resource,
+							Module:   n.Module,
+						},
+						&EvalValidateResourceIndexes{
+							Resource:  n.Resource,
+							Resources: resources,
+						},
+						&EvalValidateCount{
+							Resource: n.Resource,
+							Destroy:  n.DestroyMode != DestroyNone,
+						},
+					},
+				},
 			},
-			&EvalCountFixZeroOneBoundary{Resource: n.Resource},
 		},
 	}
+
+	// Only the resource itself counts towards the budget of its
+	// module, not its destroy nodes.
+	if n.DestroyMode == DestroyNone {
+		seq.Nodes = append(seq.Nodes, &EvalOpFilter{
+			Ops:  []walkOperation{walkValidate, walkPlan},
+			Node: &EvalCheckModuleBudget{Resource: n.Resource},
+		})
+	}
+
+	return seq
+}
+
+// GraphNodeStaged impl.
+func (n *GraphNodeConfigResource) StageName() string {
+	return n.Resource.Lifecycle.Stage
 }
 
 // GraphNodeProviderConsumer
@@ -226,9 +365,12 @@ func (n *GraphNodeConfigResource) ProvidedBy() []string {
 
 // GraphNodeProvisionerConsumer
 func (n *GraphNodeConfigResource) ProvisionedBy() []string {
-	result := make([]string, len(n.Resource.Provisioners))
-	for i, p := range n.Resource.Provisioners {
-		result[i] = p.Type
+	result := make([]string, 0, len(n.Resource.Provisioners))
+	for _, p := range n.Resource.Provisioners {
+		result = append(result, p.Type)
+		if p.Teardown != nil {
+			result = append(result, p.Teardown.Type)
+		}
 	}
 
 	return result
@@ -241,6 +383,11 @@ func (n *GraphNodeConfigResource) DestroyNode(mode GraphNodeDestroyMode) GraphNo
 		return nil
 	}
 
+	// Data sources are only read, there's nothing to destroy
+	if n.Resource.Mode == config.DataResourceMode {
+		return nil
+	}
+
 	result := &graphNodeResourceDestroy{
 		GraphNodeConfigResource: *n,
 		Original:                n,
@@ -262,6 +409,19 @@ func (n *GraphNodeConfigResource) Noop(opts *NoopOpts) bool {
 		return false
 	}
 
+	// Grab the ID which is the prefix (in the case count > 0 at some point)
+	prefix := n.Resource.Id()
+
+	// A data source that couldn't be read when planning is read during
+	// the apply, see dataSourcePlaceholder.
+	if n.Resource.Mode == config.DataResourceMode && opts.ModState != nil {
+		for k, rs := range opts.ModState.Resources {
+			if strings.HasPrefix(k, prefix) && isDataSourcePlaceholder(rs.Primary) {
+				return false
+			}
+		}
+	}
+
 	// If we have no module diff, we're certainly a noop. This is because
 	// it means there is a diff, and that the module we're in just isn't
 	// in it, meaning we're not doing anything.
@@ -269,9 +429,6 @@ func (n *GraphNodeConfigResource) Noop(opts *NoopOpts) bool {
 		return true
 	}
 
-	// Grab the ID which is the prefix (in the case count > 0 at some point)
-	prefix := n.Resource.Id()
-
 	// Go through the diff and if there are any with our name on it, keep us
 	found := false
 	for k, _ := range opts.ModDiff.Resources {
@@ -313,6 +470,20 @@ func (n *GraphNodeConfigResourceFlat) DependentOn() []string {
 		prefix)
 }
 
+func (n *GraphNodeConfigResourceFlat) SoftDependentOn() []string {
+	soft := n.GraphNodeConfigResource.SoftDependentOn()
+	result := make([]string, len(soft))
+	copy(result, soft)
+	return modulePrefixList(result, modulePrefixStr(n.PathValue))
+}
+
+func (n *GraphNodeConfigResourceFlat) LazyDependentOn() []string {
+	lazy := n.GraphNodeConfigResource.LazyDependentOn()
+	result := make([]string, len(lazy))
+	copy(result, lazy)
+	return modulePrefixList(result, modulePrefixStr(n.PathValue))
+}
+
 func (n *GraphNodeConfigResourceFlat) ProvidedBy() []string {
 	prefix := modulePrefixStr(n.PathValue)
 	return modulePrefixList(
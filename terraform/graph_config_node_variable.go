@@ -18,6 +18,11 @@ type GraphNodeConfigVariable struct {
 	Module string
 	Value  *config.RawConfig
 
+	// Resource, if non-nil, is the resource that the value is
+	// interpolated for. This is how count.index is set for the
+	// instances of a module with a count.
+	Resource *Resource
+
 	depPrefix string
 }
 
@@ -116,8 +121,9 @@ func (n *GraphNodeConfigVariable) EvalTree() EvalNode {
 	return &EvalSequence{
 		Nodes: []EvalNode{
 			&EvalInterpolate{
-				Config: n.Value,
-				Output: &config,
+				Config:   n.Value,
+				Resource: n.Resource,
+				Output:   &config,
 			},
 
 			&EvalVariableBlock{
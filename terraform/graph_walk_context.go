@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"fmt"
+	"log"
 	"sync"
 
 	"github.com/hashicorp/errwrap"
@@ -23,6 +24,9 @@ type ContextGraphWalker struct {
 	ValidationErrors   []error
 
 	errorLock           sync.Mutex
+	failures            int
+	aborted             bool
+	configFailure       string
 	once                sync.Once
 	contexts            map[string]*BuiltinEvalContext
 	contextLock         sync.Mutex
@@ -30,9 +34,14 @@ type ContextGraphWalker struct {
 	interpolaterVarLock sync.Mutex
 	providerCache       map[string]ResourceProvider
 	providerConfigCache map[string]*ResourceConfig
+	providerSemaphores  map[ResourceProvider]Semaphore
 	providerLock        sync.Mutex
 	provisionerCache    map[string]ResourceProvisioner
 	provisionerLock     sync.Mutex
+	correlationIds      map[string]string
+	correlationIdLock   sync.Mutex
+	stateCache          *StateReadCache
+	moduleBudgets       *ModuleBudgetTracker
 }
 
 func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
@@ -63,6 +72,13 @@ func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
 	w.interpolaterVars[key] = variables
 	w.interpolaterVarLock.Unlock()
 
+	// During apply, everything that is referenced must have been
+	// created already, so missing resources are an error.
+	missing := MissingResourceUnknown
+	if w.Operation == walkApply {
+		missing = MissingResourceError
+	}
+
 	ctx := &BuiltinEvalContext{
 		PathValue:           path,
 		Hooks:               w.Context.hooks,
@@ -70,6 +86,7 @@ func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
 		Providers:           w.Context.providers,
 		ProviderCache:       w.providerCache,
 		ProviderConfigCache: w.providerConfigCache,
+		ProviderSemaphores:  w.providerSemaphores,
 		ProviderInputConfig: w.Context.providerInputConfig,
 		ProviderLock:        &w.providerLock,
 		Provisioners:        w.Context.provisioners,
@@ -80,14 +97,36 @@ func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
 		StateValue:          w.Context.state,
 		StateLock:           &w.Context.stateLock,
 		Interpolater: &Interpolater{
-			Operation: w.Operation,
-			Module:    w.Context.module,
-			State:     w.Context.state,
-			StateLock: &w.Context.stateLock,
-			Variables: variables,
+			Operation:       w.Operation,
+			Module:          w.Context.module,
+			State:           w.Context.state,
+			StateLock:       &w.Context.stateLock,
+			Variables:       variables,
+			MissingResource: missing,
+			Timestamp:       w.Context.timestamp,
+			Diff:            w.Context.diff,
+			DiffLock:        &w.Context.diffLock,
 		},
 		InterpolaterVars:    w.interpolaterVars,
 		InterpolaterVarLock: &w.interpolaterVarLock,
+		CorrelationIds:      w.correlationIds,
+		CorrelationIdLock:   &w.correlationIdLock,
+		PolicyValue:         w.Context.policy,
+		StoppedCh:           w.Context.sh.StopCh(),
+
+		TaintErrorPatternsValue: w.Context.taintErrorPatterns,
+		StateCacheValue:         w.stateCache,
+		AttributeWatchlistValue: w.Context.attributeWatchlist,
+		ModuleBudgetsValue:      w.moduleBudgets,
+		CoordinatorValue:        w.Context.coordinator,
+		AuditLogValue:           w.Context.auditLog,
+		RecoverStateValue:       w.Context.recoverState,
+		StateStreamValue:        w.Context.stateStream,
+		PrerequisiteChecksValue: w.Context.prerequisiteChecks,
+		StateBackendValue:       w.Context.stateBackend,
+		StateWritesValue:        w.Context.stateWrites,
+		StateWriteSeqValue:      w.Context.stateWriteSeq,
+		DryRunValue:             w.Context.dryRun,
 	}
 
 	w.contexts[key] = ctx
@@ -98,6 +137,16 @@ func (w *ContextGraphWalker) EnterEvalTree(v dag.Vertex, n EvalNode) EvalNode {
 	// Acquire a lock on the semaphore
 	w.Context.parallelSem.Acquire()
 
+	// If we've failed too many times already, don't start anything new
+	w.errorLock.Lock()
+	aborted := w.aborted
+	w.errorLock.Unlock()
+	if aborted {
+		log.Printf("[DEBUG] Skipping %s, the walk was aborted",
+			dag.VertexName(v))
+		return &EvalNoop{}
+	}
+
 	// We want to filter the evaluation tree to only include operations
 	// that belong in this operation.
 	return EvalFilter(n, EvalNodeFilterOp(w.Operation))
@@ -105,8 +154,9 @@ func (w *ContextGraphWalker) EnterEvalTree(v dag.Vertex, n EvalNode) EvalNode {
 
 func (w *ContextGraphWalker) ExitEvalTree(
 	v dag.Vertex, output interface{}, err error) error {
-	// Release the semaphore
-	w.Context.parallelSem.Release()
+	// Release the semaphore when we're done. This happens last so that
+	// failures are recorded before another node can start.
+	defer w.Context.parallelSem.Release()
 
 	if err == nil {
 		return nil
@@ -120,6 +170,21 @@ func (w *ContextGraphWalker) ExitEvalTree(
 	// error, then just record the normal error.
 	verr, ok := err.(*EvalValidateError)
 	if !ok {
+		w.failures++
+		threshold := w.Context.failureThreshold
+		if threshold > 0 && w.failures >= threshold {
+			w.aborted = true
+		}
+
+		// Applying anything else won't help until the configuration is
+		// fixed, so fail fast
+		if w.Operation == walkApply && ApplyErrorClassOf(err) == ApplyErrorConfig {
+			if w.configFailure == "" {
+				w.configFailure = dag.VertexName(v)
+			}
+			w.aborted = true
+		}
+
 		return err
 	}
 
@@ -141,6 +206,10 @@ func (w *ContextGraphWalker) init() {
 	w.contexts = make(map[string]*BuiltinEvalContext, 5)
 	w.providerCache = make(map[string]ResourceProvider, 5)
 	w.providerConfigCache = make(map[string]*ResourceConfig, 5)
+	w.providerSemaphores = make(map[ResourceProvider]Semaphore)
 	w.provisionerCache = make(map[string]ResourceProvisioner, 5)
 	w.interpolaterVars = make(map[string]map[string]string, 5)
+	w.correlationIds = make(map[string]string)
+	w.stateCache = new(StateReadCache)
+	w.moduleBudgets = &ModuleBudgetTracker{Budgets: w.Context.modBudgets}
 }
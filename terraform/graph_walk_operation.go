@@ -13,4 +13,6 @@ const (
 	walkPlanDestroy
 	walkRefresh
 	walkValidate
+	walkProvisionCheck
+	walkPreflight
 )
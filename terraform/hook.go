@@ -24,9 +24,16 @@ type Hook interface {
 	// PreApply and PostApply are called before and after a single
 	// resource is applied. The error argument in PostApply is the
 	// error, if any, that was returned from the provider Apply call itself.
+	// Halting in PreApply skips the apply, leaving the resource as it was.
+	// The diff can be changed in PreApply to change what is applied.
 	PreApply(*InstanceInfo, *InstanceState, *InstanceDiff) (HookAction, error)
 	PostApply(*InstanceInfo, *InstanceState, error) (HookAction, error)
 
+	// PreDestroy is called before a single resource is destroyed, with
+	// the state of the instance that is about to be deleted, such as to
+	// back up its data. Halting skips the destroy.
+	PreDestroy(*InstanceInfo, *InstanceState) (HookAction, error)
+
 	// PreDiff and PostDiff are called before and after a single resource
 	// resource is diffed.
 	PreDiff(*InstanceInfo, *InstanceState) (HookAction, error)
@@ -36,15 +43,21 @@ type Hook interface {
 	//
 	// All should be self-explanatory. ProvisionOutput is called with
 	// output sent back by the provisioners. This will be called multiple
-	// times as output comes in, but each call should represent a line of
-	// output. The ProvisionOutput method cannot control whether the
-	// hook continues running.
+	// times as output comes in, and each call is a single line of output
+	// without its newline, even if the provisioner output several at once.
+	// The ProvisionOutput method cannot control whether the hook continues
+	// running.
 	PreProvisionResource(*InstanceInfo, *InstanceState) (HookAction, error)
 	PostProvisionResource(*InstanceInfo, *InstanceState) (HookAction, error)
 	PreProvision(*InstanceInfo, string) (HookAction, error)
 	PostProvision(*InstanceInfo, string) (HookAction, error)
 	ProvisionOutput(*InstanceInfo, string, string)
 
+	// ProvisionFailed is called when a provisioner that continues on
+	// failure fails, with the error, since the failure doesn't fail the
+	// apply. See config.Provisioner.OnFailure.
+	ProvisionFailed(*InstanceInfo, string, error) (HookAction, error)
+
 	// PreRefresh and PostRefresh are called before and after a single
 	// resource state is refreshed, respectively.
 	PreRefresh(*InstanceInfo, *InstanceState) (HookAction, error)
@@ -52,6 +65,54 @@ type Hook interface {
 
 	// PostStateUpdate is called after the state is updated.
 	PostStateUpdate(*State) (HookAction, error)
+
+	// PostStateSize is called with the size in bytes of the serialized
+	// state of a single resource instance. This is advisory, to help
+	// find the resources that contribute the most to the state size.
+	PostStateSize(*InstanceInfo, int) (HookAction, error)
+
+	// PostResolve is called once the state of a resource instance has
+	// been written during an apply, which is when the resources that
+	// depend on it can proceed. The list is the resources it depends on.
+	// This is diagnostic, to verify the order that resources resolve in.
+	PostResolve(*InstanceInfo, []string) (HookAction, error)
+
+	// WaitForContinue is called at a pause point during an apply with
+	// the name of the pause point and the message for the operator. The
+	// apply of the resources after the pause point is blocked until it
+	// returns, so this can be used for manual steps during an apply.
+	WaitForContinue(string, string) (HookAction, error)
+
+	// VerifyCanary is called once the canary instance of a resource has
+	// been applied, with its new state, before any of the other instances
+	// are applied. Returning an error or halting fails the canary, and the
+	// rest of the instances are left untouched. See
+	// config.ResourceLifecycle.Canary.
+	VerifyCanary(*InstanceInfo, *InstanceState) (HookAction, error)
+
+	// PostRollbackPlan is called when an apply fails after changing
+	// anything, with the manual steps that would undo the changes. The
+	// plan is only advisory, Terraform doesn't execute it.
+	PostRollbackPlan(*RollbackPlan) (HookAction, error)
+
+	// PostApplyWatched is called after a resource is applied with the
+	// changes to its attributes that match the watchlist of the context,
+	// if there are any. See ContextOpts.AttributeWatchlist.
+	PostApplyWatched(*InstanceInfo, []*AttributeChange) (HookAction, error)
+
+	// PostRefreshDrift is called after a resource is refreshed with the
+	// changes to its attributes since the state was last written, if
+	// there are any. These are changes made outside of Terraform, unlike
+	// the changes of a plan, which come from the configuration. If the
+	// resource no longer exists, all of its attributes are removed.
+	PostRefreshDrift(*InstanceInfo, []*AttributeChange) (HookAction, error)
+
+	// WalkStart and WalkEnd are called before and after each walk of the
+	// graph, such as the apply, with the name of the walk. The error
+	// argument in WalkEnd is the error, if any, of the walk. Halting in
+	// WalkStart skips the walk.
+	WalkStart(string) (HookAction, error)
+	WalkEnd(string, error) (HookAction, error)
 }
 
 // NilHook is a Hook implementation that does nothing. It exists only to
@@ -67,6 +128,10 @@ func (*NilHook) PostApply(*InstanceInfo, *InstanceState, error) (HookAction, err
 	return HookActionContinue, nil
 }
 
+func (*NilHook) PreDestroy(*InstanceInfo, *InstanceState) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
 func (*NilHook) PreDiff(*InstanceInfo, *InstanceState) (HookAction, error) {
 	return HookActionContinue, nil
 }
@@ -95,6 +160,10 @@ func (*NilHook) ProvisionOutput(
 	*InstanceInfo, string, string) {
 }
 
+func (*NilHook) ProvisionFailed(*InstanceInfo, string, error) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
 func (*NilHook) PreRefresh(*InstanceInfo, *InstanceState) (HookAction, error) {
 	return HookActionContinue, nil
 }
@@ -107,6 +176,42 @@ func (*NilHook) PostStateUpdate(*State) (HookAction, error) {
 	return HookActionContinue, nil
 }
 
+func (*NilHook) PostStateSize(*InstanceInfo, int) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) PostResolve(*InstanceInfo, []string) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) WaitForContinue(string, string) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) VerifyCanary(*InstanceInfo, *InstanceState) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) PostRollbackPlan(*RollbackPlan) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) PostApplyWatched(*InstanceInfo, []*AttributeChange) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) PostRefreshDrift(*InstanceInfo, []*AttributeChange) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) WalkStart(string) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) WalkEnd(string, error) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
 // handleHook turns hook actions into panics. This lets you use the
 // panic/recover mechanism in Go as a flow control mechanism for hook
 // actions.
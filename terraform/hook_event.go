@@ -0,0 +1,171 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceEventType is the type of a ResourceEvent.
+type ResourceEventType byte
+
+const (
+	ResourceEventInvalid ResourceEventType = iota
+	ResourceEventStart
+	ResourceEventProgress
+	ResourceEventFinish
+	ResourceEventFail
+)
+
+// ResourceEvent is a single event about the progress of an operation on
+// a resource instance. Events are sent on the ContextOpts.Events channel.
+type ResourceEvent struct {
+	Type ResourceEventType
+
+	// Action is the operation the event is about: "refresh", "apply"
+	// or "provision".
+	Action string
+
+	// Address is the human-friendly address of the instance, including
+	// the module path and count index, such as "module.foo.aws_instance.bar.1".
+	// Index is the count index, or -1 if the resource has no count.
+	Address string
+	Index   int
+
+	// CorrelationId is the correlation ID of the resource for the walk
+	// the event happened in. See InstanceInfo.
+	CorrelationId string
+
+	// Time is when the event occurred. Duration is set on finish and
+	// fail events to the time elapsed since the matching start event.
+	Time     time.Time
+	Duration time.Duration
+
+	// Message is set on progress events, such as provisioner output.
+	// Error is set on fail events.
+	Message string
+	Error   error
+}
+
+// eventHook is a private Hook implementation that Terraform uses to
+// turn hook callbacks into ResourceEvents sent on a channel.
+//
+// Sending never blocks: if the channel is full, the event is dropped.
+// The channel should be buffered to avoid losing events.
+type eventHook struct {
+	NilHook
+
+	Events chan<- *ResourceEvent
+
+	lock  sync.Mutex
+	start map[string]time.Time
+}
+
+func (h *eventHook) PreApply(
+	info *InstanceInfo, s *InstanceState, d *InstanceDiff) (HookAction, error) {
+	h.started("apply", info)
+	return HookActionContinue, nil
+}
+
+func (h *eventHook) PostApply(
+	info *InstanceInfo, s *InstanceState, err error) (HookAction, error) {
+	h.finished("apply", info, err)
+	return HookActionContinue, nil
+}
+
+func (h *eventHook) PreProvision(info *InstanceInfo, n string) (HookAction, error) {
+	h.progress("provision", info, fmt.Sprintf("Provisioning with '%s'", n))
+	return HookActionContinue, nil
+}
+
+func (h *eventHook) ProvisionOutput(info *InstanceInfo, n string, msg string) {
+	h.progress("provision", info, msg)
+}
+
+func (h *eventHook) PreRefresh(info *InstanceInfo, s *InstanceState) (HookAction, error) {
+	h.started("refresh", info)
+	return HookActionContinue, nil
+}
+
+func (h *eventHook) PostRefresh(info *InstanceInfo, s *InstanceState) (HookAction, error) {
+	h.finished("refresh", info, nil)
+	return HookActionContinue, nil
+}
+
+func (h *eventHook) started(action string, info *InstanceInfo) {
+	ev := h.event(ResourceEventStart, action, info)
+
+	h.lock.Lock()
+	if h.start == nil {
+		h.start = make(map[string]time.Time)
+	}
+	h.start[action+" "+ev.Address] = ev.Time
+	h.lock.Unlock()
+
+	h.send(ev)
+}
+
+func (h *eventHook) progress(action string, info *InstanceInfo, msg string) {
+	ev := h.event(ResourceEventProgress, action, info)
+	ev.Message = msg
+	h.send(ev)
+}
+
+func (h *eventHook) finished(action string, info *InstanceInfo, err error) {
+	ev := h.event(ResourceEventFinish, action, info)
+	if err != nil {
+		ev.Type = ResourceEventFail
+		ev.Error = err
+	}
+
+	key := action + " " + ev.Address
+	h.lock.Lock()
+	if start, ok := h.start[key]; ok {
+		ev.Duration = ev.Time.Sub(start)
+		delete(h.start, key)
+	}
+	h.lock.Unlock()
+
+	h.send(ev)
+}
+
+func (h *eventHook) event(
+	t ResourceEventType, action string, info *InstanceInfo) *ResourceEvent {
+	return &ResourceEvent{
+		Type:          t,
+		Action:        action,
+		Address:       info.HumanId(),
+		Index:         instanceIndex(info.Id),
+		CorrelationId: info.CorrelationId,
+		Time:          time.Now(),
+	}
+}
+
+// instanceIndex returns the index of the instance with the Id, which is
+// "type.name" or "type.name.index", with a "data." prefix for data
+// sources. It returns -1 if the Id doesn't have an index.
+func instanceIndex(id string) int {
+	id = strings.TrimPrefix(id, "data.")
+	parts := strings.Split(id, ".")
+	if len(parts) != 3 {
+		return -1
+	}
+
+	i, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return -1
+	}
+
+	return i
+}
+
+func (h *eventHook) send(ev *ResourceEvent) {
+	select {
+	case h.Events <- ev:
+	default:
+		log.Printf("[WARN] Event channel full, dropping event for %s", ev.Address)
+	}
+}
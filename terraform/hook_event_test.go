@@ -0,0 +1,119 @@
+package terraform
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEventHook_impl(t *testing.T) {
+	var _ Hook = new(eventHook)
+}
+
+func TestEventHook(t *testing.T) {
+	ch := make(chan *ResourceEvent, 10)
+	h := &eventHook{Events: ch}
+
+	info := &InstanceInfo{
+		Id:         "aws_instance.foo.1",
+		ModulePath: []string{"root", "child"},
+	}
+	h.PreApply(info, nil, nil)
+	h.ProvisionOutput(info, "shell", "hello")
+	h.PostApply(info, nil, fmt.Errorf("failed"))
+	close(ch)
+
+	var events []*ResourceEvent
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	if len(events) != 3 {
+		t.Fatalf("bad: %#v", events)
+	}
+
+	expected := []ResourceEventType{
+		ResourceEventStart, ResourceEventProgress, ResourceEventFail}
+	for i, ev := range events {
+		if ev.Type != expected[i] {
+			t.Fatalf("bad %d: %#v", i, ev)
+		}
+		if ev.Address != "module.child.aws_instance.foo.1" || ev.Index != 1 {
+			t.Fatalf("bad %d: %#v", i, ev)
+		}
+	}
+	if events[1].Message != "hello" {
+		t.Fatalf("bad: %#v", events[1])
+	}
+	if events[2].Error == nil || events[2].Duration < 0 {
+		t.Fatalf("bad: %#v", events[2])
+	}
+}
+
+func TestEventHook_index(t *testing.T) {
+	cases := []struct {
+		Id    string
+		Index int
+	}{
+		{"aws_instance.foo", -1},
+		{"aws_instance.foo.2", 2},
+		{"data.aws_ami.foo", -1},
+		{"data.aws_ami.foo.3", 3},
+	}
+
+	for _, tc := range cases {
+		ch := make(chan *ResourceEvent, 1)
+		h := &eventHook{Events: ch}
+		h.PreRefresh(&InstanceInfo{Id: tc.Id}, nil)
+
+		ev := <-ch
+		if ev.Index != tc.Index {
+			t.Fatalf("%s: bad: %#v", tc.Id, ev)
+		}
+	}
+}
+
+func TestEventHook_full(t *testing.T) {
+	ch := make(chan *ResourceEvent)
+	h := &eventHook{Events: ch}
+
+	// Nobody is receiving, this must not block
+	h.PreRefresh(&InstanceInfo{Id: "aws_instance.foo"}, nil)
+}
+
+func TestContext2Apply_events(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ch := make(chan *ResourceEvent, 10)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Events: ch,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	close(ch)
+
+	finished := make(map[string]bool)
+	for ev := range ch {
+		if ev.Action == "apply" && ev.Type == ResourceEventFinish {
+			finished[ev.Address] = true
+		}
+		if ev.CorrelationId == "" {
+			t.Fatalf("no correlation ID: %#v", ev)
+		}
+	}
+	if !finished["aws_instance.foo"] || !finished["aws_instance.bar"] {
+		t.Fatalf("bad: %#v", finished)
+	}
+	if p.ApplyInfo.CorrelationId == "" {
+		t.Fatal("provider should get the correlation ID")
+	}
+}
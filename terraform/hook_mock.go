@@ -17,6 +17,12 @@ type MockHook struct {
 	PostApplyReturn      HookAction
 	PostApplyReturnError error
 
+	PreDestroyCalled bool
+	PreDestroyInfo   *InstanceInfo
+	PreDestroyState  *InstanceState
+	PreDestroyReturn HookAction
+	PreDestroyError  error
+
 	PreDiffCalled bool
 	PreDiffInfo   *InstanceInfo
 	PreDiffState  *InstanceState
@@ -58,6 +64,13 @@ type MockHook struct {
 	ProvisionOutputProvisionerId string
 	ProvisionOutputMessage       string
 
+	ProvisionFailedCalled        bool
+	ProvisionFailedInfo          *InstanceInfo
+	ProvisionFailedProvisionerId string
+	ProvisionFailedErr           error
+	ProvisionFailedReturn        HookAction
+	ProvisionFailedError         error
+
 	PostRefreshCalled bool
 	PostRefreshInfo   *InstanceInfo
 	PostRefreshState  *InstanceState
@@ -74,6 +87,60 @@ type MockHook struct {
 	PostStateUpdateState  *State
 	PostStateUpdateReturn HookAction
 	PostStateUpdateError  error
+
+	PostStateSizeCalled bool
+	PostStateSizeInfo   *InstanceInfo
+	PostStateSizeSize   int
+	PostStateSizeReturn HookAction
+	PostStateSizeError  error
+
+	PostResolveCalled       bool
+	PostResolveInfo         *InstanceInfo
+	PostResolveDependencies []string
+	PostResolveReturn       HookAction
+	PostResolveError        error
+
+	WaitForContinueCalled  bool
+	WaitForContinueName    string
+	WaitForContinueMessage string
+	WaitForContinueFn      func(string, string) (HookAction, error)
+	WaitForContinueReturn  HookAction
+	WaitForContinueError   error
+
+	VerifyCanaryCalled bool
+	VerifyCanaryInfo   *InstanceInfo
+	VerifyCanaryState  *InstanceState
+	VerifyCanaryFn     func(*InstanceInfo, *InstanceState) (HookAction, error)
+	VerifyCanaryReturn HookAction
+	VerifyCanaryError  error
+
+	PostRollbackPlanCalled bool
+	PostRollbackPlanPlan   *RollbackPlan
+	PostRollbackPlanReturn HookAction
+	PostRollbackPlanError  error
+
+	PostApplyWatchedCalled  bool
+	PostApplyWatchedInfo    *InstanceInfo
+	PostApplyWatchedChanges []*AttributeChange
+	PostApplyWatchedReturn  HookAction
+	PostApplyWatchedError   error
+
+	PostRefreshDriftCalled  bool
+	PostRefreshDriftInfo    *InstanceInfo
+	PostRefreshDriftChanges []*AttributeChange
+	PostRefreshDriftReturn  HookAction
+	PostRefreshDriftError   error
+
+	WalkStartCalled bool
+	WalkStartWalk   string
+	WalkStartReturn HookAction
+	WalkStartError  error
+
+	WalkEndCalled bool
+	WalkEndWalk   string
+	WalkEndErr    error
+	WalkEndReturn HookAction
+	WalkEndError  error
 }
 
 func (h *MockHook) PreApply(n *InstanceInfo, s *InstanceState, d *InstanceDiff) (HookAction, error) {
@@ -92,6 +159,13 @@ func (h *MockHook) PostApply(n *InstanceInfo, s *InstanceState, e error) (HookAc
 	return h.PostApplyReturn, h.PostApplyReturnError
 }
 
+func (h *MockHook) PreDestroy(n *InstanceInfo, s *InstanceState) (HookAction, error) {
+	h.PreDestroyCalled = true
+	h.PreDestroyInfo = n
+	h.PreDestroyState = s
+	return h.PreDestroyReturn, h.PreDestroyError
+}
+
 func (h *MockHook) PreDiff(n *InstanceInfo, s *InstanceState) (HookAction, error) {
 	h.PreDiffCalled = true
 	h.PreDiffInfo = n
@@ -144,6 +218,15 @@ func (h *MockHook) ProvisionOutput(
 	h.ProvisionOutputMessage = msg
 }
 
+func (h *MockHook) ProvisionFailed(
+	n *InstanceInfo, provId string, err error) (HookAction, error) {
+	h.ProvisionFailedCalled = true
+	h.ProvisionFailedInfo = n
+	h.ProvisionFailedProvisionerId = provId
+	h.ProvisionFailedErr = err
+	return h.ProvisionFailedReturn, h.ProvisionFailedError
+}
+
 func (h *MockHook) PreRefresh(n *InstanceInfo, s *InstanceState) (HookAction, error) {
 	h.PreRefreshCalled = true
 	h.PreRefreshInfo = n
@@ -163,3 +246,75 @@ func (h *MockHook) PostStateUpdate(s *State) (HookAction, error) {
 	h.PostStateUpdateState = s
 	return h.PostStateUpdateReturn, h.PostStateUpdateError
 }
+
+func (h *MockHook) PostStateSize(n *InstanceInfo, size int) (HookAction, error) {
+	h.PostStateSizeCalled = true
+	h.PostStateSizeInfo = n
+	h.PostStateSizeSize = size
+	return h.PostStateSizeReturn, h.PostStateSizeError
+}
+
+func (h *MockHook) PostResolve(n *InstanceInfo, deps []string) (HookAction, error) {
+	h.PostResolveCalled = true
+	h.PostResolveInfo = n
+	h.PostResolveDependencies = deps
+	return h.PostResolveReturn, h.PostResolveError
+}
+
+func (h *MockHook) WaitForContinue(n, msg string) (HookAction, error) {
+	h.WaitForContinueCalled = true
+	h.WaitForContinueName = n
+	h.WaitForContinueMessage = msg
+	if h.WaitForContinueFn != nil {
+		return h.WaitForContinueFn(n, msg)
+	}
+
+	return h.WaitForContinueReturn, h.WaitForContinueError
+}
+
+func (h *MockHook) VerifyCanary(
+	n *InstanceInfo, s *InstanceState) (HookAction, error) {
+	h.VerifyCanaryCalled = true
+	h.VerifyCanaryInfo = n
+	h.VerifyCanaryState = s
+	if h.VerifyCanaryFn != nil {
+		return h.VerifyCanaryFn(n, s)
+	}
+
+	return h.VerifyCanaryReturn, h.VerifyCanaryError
+}
+
+func (h *MockHook) PostRollbackPlan(p *RollbackPlan) (HookAction, error) {
+	h.PostRollbackPlanCalled = true
+	h.PostRollbackPlanPlan = p
+	return h.PostRollbackPlanReturn, h.PostRollbackPlanError
+}
+
+func (h *MockHook) PostApplyWatched(
+	n *InstanceInfo, c []*AttributeChange) (HookAction, error) {
+	h.PostApplyWatchedCalled = true
+	h.PostApplyWatchedInfo = n
+	h.PostApplyWatchedChanges = c
+	return h.PostApplyWatchedReturn, h.PostApplyWatchedError
+}
+
+func (h *MockHook) PostRefreshDrift(
+	n *InstanceInfo, c []*AttributeChange) (HookAction, error) {
+	h.PostRefreshDriftCalled = true
+	h.PostRefreshDriftInfo = n
+	h.PostRefreshDriftChanges = c
+	return h.PostRefreshDriftReturn, h.PostRefreshDriftError
+}
+
+func (h *MockHook) WalkStart(walk string) (HookAction, error) {
+	h.WalkStartCalled = true
+	h.WalkStartWalk = walk
+	return h.WalkStartReturn, h.WalkStartError
+}
+
+func (h *MockHook) WalkEnd(walk string, err error) (HookAction, error) {
+	h.WalkEndCalled = true
+	h.WalkEndWalk = walk
+	h.WalkEndErr = err
+	return h.WalkEndReturn, h.WalkEndError
+}
@@ -0,0 +1,89 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolution is a single resource instance resolving during an apply.
+// See Hook.PostResolve.
+type Resolution struct {
+	// Address is the human-friendly address of the instance, and
+	// ModulePath is the path of the module it is in.
+	Address    string
+	ModulePath []string
+
+	// Dependencies are the resources the instance depends on, relative to
+	// its module, such as "aws_instance.foo" or "module.bar".
+	Dependencies []string
+
+	Time time.Time
+}
+
+// ResolveTimelineHook is a Hook implementation that records the order
+// resource instances resolve in during an apply, so that the order can be
+// verified against their dependencies.
+type ResolveTimelineHook struct {
+	NilHook
+
+	lock     sync.Mutex
+	timeline []Resolution
+}
+
+func (h *ResolveTimelineHook) PostResolve(
+	info *InstanceInfo, deps []string) (HookAction, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.timeline = append(h.timeline, Resolution{
+		Address:      info.HumanId(),
+		ModulePath:   info.ModulePath,
+		Dependencies: deps,
+		Time:         time.Now(),
+	})
+
+	return HookActionContinue, nil
+}
+
+// Timeline returns the resolutions in the order they happened.
+func (h *ResolveTimelineHook) Timeline() []Resolution {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	result := make([]Resolution, len(h.timeline))
+	copy(result, h.timeline)
+	return result
+}
+
+// Verify returns an error for every resolution that happened before one
+// of the resolutions it depends on. Dependencies that never resolved,
+// such as resources that didn't change, aren't errors.
+func (h *ResolveTimelineHook) Verify() []error {
+	timeline := h.Timeline()
+
+	var errs []error
+	for i, r := range timeline {
+		for _, dep := range r.Dependencies {
+			prefix := dep
+			if len(r.ModulePath) > 1 {
+				prefix = fmt.Sprintf(
+					"module.%s.%s", strings.Join(r.ModulePath[1:], "."), dep)
+			}
+
+			// Anything that depends on the resource, including each of
+			// its counted instances, must be later in the timeline.
+			for _, later := range timeline[i+1:] {
+				if later.Address == prefix ||
+					strings.HasPrefix(later.Address, prefix+".") {
+					errs = append(errs, fmt.Errorf(
+						"%s resolved before its dependency %s",
+						r.Address, later.Address))
+				}
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestResolveTimelineHook_impl(t *testing.T) {
+	var _ Hook = new(ResolveTimelineHook)
+}
+
+func TestResolveTimelineHook(t *testing.T) {
+	h := new(ResolveTimelineHook)
+	h.PostResolve(&InstanceInfo{Id: "aws_instance.foo.0"}, nil)
+	h.PostResolve(&InstanceInfo{Id: "aws_instance.foo.1"}, nil)
+	h.PostResolve(&InstanceInfo{
+		Id:         "aws_instance.bar",
+		ModulePath: []string{"root", "child"},
+	}, nil)
+	h.PostResolve(&InstanceInfo{Id: "aws_instance.baz"},
+		[]string{"aws_instance.foo", "module.child"})
+
+	if actual := len(h.Timeline()); actual != 4 {
+		t.Fatalf("bad: %d", actual)
+	}
+	if errs := h.Verify(); len(errs) > 0 {
+		t.Fatalf("bad: %s", errs)
+	}
+}
+
+func TestResolveTimelineHook_outOfOrder(t *testing.T) {
+	h := new(ResolveTimelineHook)
+	h.PostResolve(&InstanceInfo{
+		Id:         "aws_instance.bar",
+		ModulePath: []string{"root", "child"},
+	}, []string{"aws_instance.foo"})
+	h.PostResolve(&InstanceInfo{
+		Id:         "aws_instance.foo.0",
+		ModulePath: []string{"root", "child"},
+	}, nil)
+
+	errs := h.Verify()
+	if len(errs) != 1 {
+		t.Fatalf("bad: %s", errs)
+	}
+
+	expected := "module.child.aws_instance.bar resolved before its " +
+		"dependency module.child.aws_instance.foo.0"
+	if errs[0].Error() != expected {
+		t.Fatalf("bad: %s", errs[0])
+	}
+}
+
+func TestContext2Apply_resolveTimeline(t *testing.T) {
+	m := testModule(t, "apply-depends-create-before")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	h := new(ResolveTimelineHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	timeline := h.Timeline()
+	if len(timeline) != 2 {
+		t.Fatalf("bad: %#v", timeline)
+	}
+	if timeline[0].Address != "aws_instance.web" {
+		t.Fatalf("bad: %#v", timeline)
+	}
+	if errs := h.Verify(); len(errs) > 0 {
+		t.Fatalf("bad: %s", errs)
+	}
+}
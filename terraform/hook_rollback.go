@@ -0,0 +1,225 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RollbackAction is the kind of manual step in a RollbackPlan.
+type RollbackAction byte
+
+const (
+	RollbackInvalid RollbackAction = iota
+
+	// RollbackDestroy means the instance was created and must be
+	// destroyed to undo the apply.
+	RollbackDestroy
+
+	// RollbackRevert means the instance was updated in place and the
+	// changed attributes must be set back to their old values.
+	RollbackRevert
+
+	// RollbackRecreate means the instance was destroyed. It can't be
+	// brought back, it must be created again.
+	RollbackRecreate
+)
+
+func (a RollbackAction) String() string {
+	switch a {
+	case RollbackDestroy:
+		return "destroy"
+	case RollbackRevert:
+		return "revert"
+	case RollbackRecreate:
+		return "recreate"
+	default:
+		return "invalid"
+	}
+}
+
+// RollbackPlan is the list of manual steps that undo the operations of
+// an apply that failed partway through. It is only advisory: Terraform
+// never executes it. See Hook.PostRollbackPlan.
+type RollbackPlan struct {
+	// Steps are in the order they should be done in, which is the reverse
+	// of the order the operations were applied in.
+	Steps []*RollbackStep
+}
+
+// RollbackStep is a single step of a RollbackPlan, the inverse of one
+// operation that was applied.
+type RollbackStep struct {
+	Action RollbackAction
+
+	// Address is the human-friendly address of the instance, such as
+	// "module.foo.aws_instance.bar.1". Type is the resource type.
+	Address string
+	Type    string
+
+	// ID is the ID of the instance the step is about: for destroy and
+	// revert the ID it has now, and for recreate the ID it had.
+	ID string
+
+	// Attributes are the attributes to restore, as their old values.
+	// This is only set for revert.
+	Attributes map[string]string
+}
+
+func (p *RollbackPlan) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("# The apply failed. To undo the changes that were applied,\n")
+	buf.WriteString("# do these steps manually in this order:\n")
+	for _, s := range p.Steps {
+		buf.WriteString(s.String() + "\n")
+	}
+
+	return buf.String()
+}
+
+func (s *RollbackStep) String() string {
+	switch s.Action {
+	case RollbackDestroy:
+		return fmt.Sprintf("destroy %s (ID: %s)", s.Address, s.ID)
+	case RollbackRecreate:
+		return fmt.Sprintf(
+			"recreate %s (was ID: %s), it was destroyed", s.Address, s.ID)
+	case RollbackRevert:
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var buf bytes.Buffer
+		buf.WriteString(fmt.Sprintf("revert %s (ID: %s):", s.Address, s.ID))
+		for _, k := range keys {
+			buf.WriteString(fmt.Sprintf("\n  %s = %q", k, s.Attributes[k]))
+		}
+
+		return buf.String()
+	default:
+		return fmt.Sprintf("unknown step for %s", s.Address)
+	}
+}
+
+// rollbackHook is a private Hook implementation that Terraform uses to
+// record the operations done during an apply, so that a RollbackPlan
+// can be made if the apply fails.
+type rollbackHook struct {
+	NilHook
+
+	lock    sync.Mutex
+	pending map[string]*rollbackOperation
+	steps   []*RollbackStep
+}
+
+// rollbackOperation is what is known about an operation from PreApply,
+// until PostApply finishes it.
+type rollbackOperation struct {
+	ID   string
+	Diff *InstanceDiff
+}
+
+func (h *rollbackHook) PreApply(
+	info *InstanceInfo, s *InstanceState, d *InstanceDiff) (HookAction, error) {
+	op := &rollbackOperation{Diff: d}
+	if s != nil {
+		op.ID = s.ID
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.pending == nil {
+		h.pending = make(map[string]*rollbackOperation)
+	}
+	h.pending[info.HumanId()] = op
+
+	return HookActionContinue, nil
+}
+
+func (h *rollbackHook) PostApply(
+	info *InstanceInfo, s *InstanceState, err error) (HookAction, error) {
+	addr := info.HumanId()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	op, ok := h.pending[addr]
+	if !ok {
+		return HookActionContinue, nil
+	}
+	delete(h.pending, addr)
+
+	newId := ""
+	if s != nil {
+		newId = s.ID
+	}
+
+	var steps []*RollbackStep
+	if op.ID != "" && newId != op.ID {
+		// The old instance is gone, whether it was destroyed or replaced
+		steps = append(steps, &RollbackStep{
+			Action:  RollbackRecreate,
+			Address: addr,
+			Type:    info.Type,
+			ID:      op.ID,
+		})
+	}
+	if newId != "" && newId != op.ID {
+		// Created, even if the apply failed after that
+		steps = append(steps, &RollbackStep{
+			Action:  RollbackDestroy,
+			Address: addr,
+			Type:    info.Type,
+			ID:      newId,
+		})
+	}
+	if err == nil && newId != "" && newId == op.ID && op.Diff != nil {
+		attrs := make(map[string]string)
+		for k, ad := range op.Diff.Attributes {
+			if ad.Type == DiffAttrOutput || ad.Old == ad.New {
+				continue
+			}
+
+			attrs[k] = ad.Old
+		}
+
+		if len(attrs) > 0 {
+			steps = append(steps, &RollbackStep{
+				Action:     RollbackRevert,
+				Address:    addr,
+				Type:       info.Type,
+				ID:         newId,
+				Attributes: attrs,
+			})
+		}
+	}
+
+	h.steps = append(h.steps, steps...)
+	return HookActionContinue, nil
+}
+
+// Plan returns the rollback plan for the operations recorded so far.
+func (h *rollbackHook) Plan() *RollbackPlan {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	steps := make([]*RollbackStep, 0, len(h.steps))
+	for i := len(h.steps) - 1; i >= 0; i-- {
+		steps = append(steps, h.steps[i])
+	}
+
+	return &RollbackPlan{Steps: steps}
+}
+
+// Reset forgets all the recorded operations.
+func (h *rollbackHook) Reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.pending = nil
+	h.steps = nil
+}
@@ -0,0 +1,114 @@
+package terraform
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRollbackHook_impl(t *testing.T) {
+	var _ Hook = new(rollbackHook)
+}
+
+func TestRollbackHook(t *testing.T) {
+	h := new(rollbackHook)
+
+	// Created
+	create := &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"}
+	h.PreApply(create, &InstanceState{}, &InstanceDiff{})
+	h.PostApply(create, &InstanceState{ID: "i-foo"}, nil)
+
+	// Updated in place
+	update := &InstanceInfo{Id: "aws_instance.bar", Type: "aws_instance"}
+	h.PreApply(update, &InstanceState{ID: "i-bar"}, &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "ami-1", New: "ami-2"},
+			"ip": &ResourceAttrDiff{
+				NewComputed: true,
+				Type:        DiffAttrOutput,
+			},
+		},
+	})
+	h.PostApply(update, &InstanceState{ID: "i-bar"}, nil)
+
+	// Replaced, but creating the replacement failed partway through
+	replace := &InstanceInfo{
+		Id:         "aws_instance.baz",
+		ModulePath: []string{"root", "child"},
+		Type:       "aws_instance",
+	}
+	h.PreApply(replace, &InstanceState{ID: "i-old"}, &InstanceDiff{})
+	h.PostApply(replace, &InstanceState{ID: "i-new"}, fmt.Errorf("failed"))
+
+	actual := h.Plan()
+	expected := &RollbackPlan{
+		Steps: []*RollbackStep{
+			&RollbackStep{
+				Action:  RollbackDestroy,
+				Address: "module.child.aws_instance.baz",
+				Type:    "aws_instance",
+				ID:      "i-new",
+			},
+			&RollbackStep{
+				Action:  RollbackRecreate,
+				Address: "module.child.aws_instance.baz",
+				Type:    "aws_instance",
+				ID:      "i-old",
+			},
+			&RollbackStep{
+				Action:     RollbackRevert,
+				Address:    "aws_instance.bar",
+				Type:       "aws_instance",
+				ID:         "i-bar",
+				Attributes: map[string]string{"ami": "ami-1"},
+			},
+			&RollbackStep{
+				Action:  RollbackDestroy,
+				Address: "aws_instance.foo",
+				Type:    "aws_instance",
+				ID:      "i-foo",
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	h.Reset()
+	if len(h.Plan().Steps) != 0 {
+		t.Fatal("should be empty after reset")
+	}
+}
+
+func TestRollbackPlanString(t *testing.T) {
+	p := &RollbackPlan{
+		Steps: []*RollbackStep{
+			&RollbackStep{
+				Action:     RollbackRevert,
+				Address:    "aws_instance.bar",
+				ID:         "i-bar",
+				Attributes: map[string]string{"ami": "ami-1"},
+			},
+			&RollbackStep{
+				Action:  RollbackDestroy,
+				Address: "aws_instance.foo",
+				ID:      "i-foo",
+			},
+		},
+	}
+
+	actual := strings.TrimSpace(p.String())
+	expected := strings.TrimSpace(testRollbackPlanStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+const testRollbackPlanStr = `
+# The apply failed. To undo the changes that were applied,
+# do these steps manually in this order:
+revert aws_instance.bar (ID: i-bar):
+  ami = "ami-1"
+destroy aws_instance.foo (ID: i-foo)
+`
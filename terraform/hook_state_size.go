@@ -0,0 +1,65 @@
+package terraform
+
+import (
+	"sort"
+	"sync"
+)
+
+// StateSize is the serialized state size of a single resource instance.
+type StateSize struct {
+	Address string
+	Size    int
+}
+
+// StateSizeHook is a Hook implementation that collects the state size
+// of every resource instance so that the largest can be reported.
+type StateSizeHook struct {
+	NilHook
+
+	lock  sync.Mutex
+	sizes map[string]int
+}
+
+func (h *StateSizeHook) PostStateSize(info *InstanceInfo, size int) (HookAction, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.sizes == nil {
+		h.sizes = make(map[string]int)
+	}
+	h.sizes[info.HumanId()] = size
+
+	return HookActionContinue, nil
+}
+
+// Largest returns the n resource instances with the largest state, from
+// largest to smallest. If n is negative, all instances are returned.
+func (h *StateSizeHook) Largest(n int) []StateSize {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	result := make([]StateSize, 0, len(h.sizes))
+	for k, v := range h.sizes {
+		result = append(result, StateSize{Address: k, Size: v})
+	}
+	sort.Sort(stateSizeSort(result))
+
+	if n >= 0 && n < len(result) {
+		result = result[:n]
+	}
+
+	return result
+}
+
+// stateSizeSort sorts by size, largest first, then by address.
+type stateSizeSort []StateSize
+
+func (s stateSizeSort) Len() int      { return len(s) }
+func (s stateSizeSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s stateSizeSort) Less(i, j int) bool {
+	if s[i].Size != s[j].Size {
+		return s[i].Size > s[j].Size
+	}
+
+	return s[i].Address < s[j].Address
+}
@@ -0,0 +1,36 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateSizeHook_impl(t *testing.T) {
+	var _ Hook = new(StateSizeHook)
+}
+
+func TestStateSizeHook(t *testing.T) {
+	h := new(StateSizeHook)
+	h.PostStateSize(&InstanceInfo{Id: "aws_instance.small"}, 10)
+	h.PostStateSize(&InstanceInfo{Id: "aws_instance.big"}, 500)
+	h.PostStateSize(&InstanceInfo{
+		Id:         "aws_instance.big",
+		ModulePath: []string{"root", "child"},
+	}, 200)
+
+	// Later reports for the same instance replace earlier ones
+	h.PostStateSize(&InstanceInfo{Id: "aws_instance.small"}, 20)
+
+	actual := h.Largest(2)
+	expected := []StateSize{
+		StateSize{Address: "aws_instance.big", Size: 500},
+		StateSize{Address: "module.child.aws_instance.big", Size: 200},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if actual := h.Largest(-1); len(actual) != 3 || actual[2].Size != 20 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
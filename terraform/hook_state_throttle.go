@@ -0,0 +1,67 @@
+package terraform
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStateUpdateInterval is the default minimum interval between
+// calls to the PostStateUpdate hook.
+const DefaultStateUpdateInterval = 200 * time.Millisecond
+
+// stateThrottleHook is a private Hook implementation that wraps another
+// hook and coalesces PostStateUpdate calls so the wrapped hook sees at
+// most one update per interval. Updates that were coalesced away are
+// sent with flush, so the last state the wrapped hook sees is always
+// the final state.
+//
+// Updates that mark a resource pending, see EvalUpdateStateHook.Pending,
+// are sent right away with postStateUpdateNow.
+type stateThrottleHook struct {
+	Hook
+
+	Interval time.Duration
+
+	lock    sync.Mutex
+	last    time.Time
+	pending *State
+}
+
+func (h *stateThrottleHook) PostStateUpdate(s *State) (HookAction, error) {
+	h.lock.Lock()
+	now := time.Now()
+	if now.Sub(h.last) < h.Interval {
+		h.pending = s
+		h.lock.Unlock()
+		return HookActionContinue, nil
+	}
+	h.lock.Unlock()
+
+	return h.postStateUpdateNow(s)
+}
+
+// postStateUpdateNow sends the update even if it is within the interval,
+// which supersedes the updates that were coalesced before it.
+func (h *stateThrottleHook) postStateUpdateNow(s *State) (HookAction, error) {
+	h.lock.Lock()
+	h.last = time.Now()
+	h.pending = nil
+	h.lock.Unlock()
+
+	return h.Hook.PostStateUpdate(s)
+}
+
+// flush sends the last coalesced state update, if there is one.
+func (h *stateThrottleHook) flush() (HookAction, error) {
+	h.lock.Lock()
+	s := h.pending
+	h.pending = nil
+	h.last = time.Now()
+	h.lock.Unlock()
+
+	if s == nil {
+		return HookActionContinue, nil
+	}
+
+	return h.Hook.PostStateUpdate(s)
+}
@@ -0,0 +1,161 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateThrottleHook_impl(t *testing.T) {
+	var _ Hook = new(stateThrottleHook)
+}
+
+func TestStateThrottleHook(t *testing.T) {
+	mock := new(MockHook)
+	h := &stateThrottleHook{Hook: mock, Interval: time.Hour}
+
+	first := &State{Serial: 1}
+	if _, err := h.PostStateUpdate(first); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mock.PostStateUpdateState != first {
+		t.Fatalf("first update should be sent: %#v", mock.PostStateUpdateState)
+	}
+
+	// Updates within the interval are coalesced
+	h.PostStateUpdate(&State{Serial: 2})
+	last := &State{Serial: 3}
+	h.PostStateUpdate(last)
+	if mock.PostStateUpdateState != first {
+		t.Fatalf("updates should be coalesced: %#v", mock.PostStateUpdateState)
+	}
+
+	// Flushing sends the last one
+	if _, err := h.flush(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mock.PostStateUpdateState != last {
+		t.Fatalf("last update should be sent: %#v", mock.PostStateUpdateState)
+	}
+
+	// Nothing is sent if nothing is pending
+	mock.PostStateUpdateCalled = false
+	h.flush()
+	if mock.PostStateUpdateCalled {
+		t.Fatal("should not send an update")
+	}
+}
+
+func TestEvalUpdateStateHook_pendingThrottled(t *testing.T) {
+	mock := new(MockHook)
+	h := &stateThrottleHook{Hook: mock, Interval: time.Hour}
+	h.PostStateUpdate(&State{Serial: 1})
+
+	ctx := new(MockEvalContext)
+	ctx.HookHook = h
+	ctx.StateState = &State{Serial: 2}
+	ctx.StateLock = new(sync.RWMutex)
+
+	// Marking a resource pending is sent right away
+	node := &EvalUpdateStateHook{Pending: true}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mock.PostStateUpdateState.Serial != 2 {
+		t.Fatalf("should send the update: %#v", mock.PostStateUpdateState)
+	}
+
+	// Other updates are throttled
+	ctx.StateState = &State{Serial: 3}
+	node = &EvalUpdateStateHook{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mock.PostStateUpdateState.Serial != 2 {
+		t.Fatalf("should be throttled: %#v", mock.PostStateUpdateState)
+	}
+}
+
+// testPendingStateHook records the state updates that mark a resource
+// pending, and fails the others.
+type testPendingStateHook struct {
+	NilHook
+
+	lock    sync.Mutex
+	pending int
+}
+
+func (h *testPendingStateHook) PostStateUpdate(s *State) (HookAction, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !s.HasPending() {
+		return HookActionContinue, fmt.Errorf("failed to persist")
+	}
+
+	h.pending++
+	return HookActionContinue, nil
+}
+
+func TestContext2Apply_stateUpdateThrottlePending(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	h := new(testPendingStateHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StateUpdateInterval: time.Hour,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every pending mark is sent, and the error of the final update
+	// that was throttled is returned
+	_, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "failed to persist") {
+		t.Fatalf("bad: %v", err)
+	}
+	if h.pending != 2 {
+		t.Fatalf("bad: %d", h.pending)
+	}
+}
+
+func TestContext2Apply_stateUpdateThrottle(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	h := new(MockHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StateUpdateInterval: time.Hour,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if h.PostStateUpdateState == nil {
+		t.Fatal("should call PostStateUpdate")
+	}
+	if h.PostStateUpdateState.String() != state.String() {
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", h.PostStateUpdateState, state)
+	}
+}
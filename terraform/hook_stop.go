@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"sync"
 	"sync/atomic"
 )
 
@@ -8,6 +9,11 @@ import (
 // signal when to stop or cancel actions.
 type stopHook struct {
 	stop uint32
+
+	// ch is closed when the hook is stopped, for the things that block
+	// and can't wait for the next hook call to notice the stop.
+	ch   chan struct{}
+	lock sync.Mutex
 }
 
 func (h *stopHook) PreApply(*InstanceInfo, *InstanceState, *InstanceDiff) (HookAction, error) {
@@ -18,6 +24,10 @@ func (h *stopHook) PostApply(*InstanceInfo, *InstanceState, error) (HookAction,
 	return h.hook()
 }
 
+func (h *stopHook) PreDestroy(*InstanceInfo, *InstanceState) (HookAction, error) {
+	return h.hook()
+}
+
 func (h *stopHook) PreDiff(*InstanceInfo, *InstanceState) (HookAction, error) {
 	return h.hook()
 }
@@ -45,6 +55,10 @@ func (h *stopHook) PostProvision(*InstanceInfo, string) (HookAction, error) {
 func (h *stopHook) ProvisionOutput(*InstanceInfo, string, string) {
 }
 
+func (h *stopHook) ProvisionFailed(*InstanceInfo, string, error) (HookAction, error) {
+	return h.hook()
+}
+
 func (h *stopHook) PreRefresh(*InstanceInfo, *InstanceState) (HookAction, error) {
 	return h.hook()
 }
@@ -57,6 +71,42 @@ func (h *stopHook) PostStateUpdate(*State) (HookAction, error) {
 	return h.hook()
 }
 
+func (h *stopHook) PostStateSize(*InstanceInfo, int) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) PostResolve(*InstanceInfo, []string) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) WaitForContinue(string, string) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) VerifyCanary(*InstanceInfo, *InstanceState) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) PostRollbackPlan(*RollbackPlan) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) PostApplyWatched(*InstanceInfo, []*AttributeChange) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) PostRefreshDrift(*InstanceInfo, []*AttributeChange) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) WalkStart(string) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) WalkEnd(string, error) (HookAction, error) {
+	return h.hook()
+}
+
 func (h *stopHook) hook() (HookAction, error) {
 	if h.Stopped() {
 		return HookActionHalt, nil
@@ -67,11 +117,36 @@ func (h *stopHook) hook() (HookAction, error) {
 
 // reset should be called within the lock context
 func (h *stopHook) Reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
 	atomic.StoreUint32(&h.stop, 0)
+	h.ch = nil
 }
 
 func (h *stopHook) Stop() {
-	atomic.StoreUint32(&h.stop, 1)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if atomic.SwapUint32(&h.stop, 1) == 0 && h.ch != nil {
+		close(h.ch)
+	}
+}
+
+// StopCh returns a channel that is closed when the hook is stopped.
+// A new channel is used after every Reset.
+func (h *stopHook) StopCh() <-chan struct{} {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.ch == nil {
+		h.ch = make(chan struct{})
+		if atomic.LoadUint32(&h.stop) == 1 {
+			close(h.ch)
+		}
+	}
+
+	return h.ch
 }
 
 func (h *stopHook) Stopped() bool {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/config/lang/ast"
@@ -17,14 +18,36 @@ const (
 	VarEnvPrefix = "TF_VAR_"
 )
 
+// MissingResourcePolicy determines how references to resources that
+// aren't in the state yet are interpolated.
+type MissingResourcePolicy byte
+
+const (
+	// MissingResourceUnknown interpolates the references as unknown.
+	MissingResourceUnknown MissingResourcePolicy = iota
+
+	// MissingResourceError makes the references an error.
+	MissingResourceError
+)
+
 // Interpolater is the structure responsible for determining the values
 // for interpolations such as `aws_instance.foo.bar`.
 type Interpolater struct {
-	Operation walkOperation
-	Module    *module.Tree
-	State     *State
-	StateLock *sync.RWMutex
-	Variables map[string]string
+	Operation       walkOperation
+	Module          *module.Tree
+	State           *State
+	StateLock       *sync.RWMutex
+	Variables       map[string]string
+	MissingResource MissingResourcePolicy
+
+	// Timestamp, if set, is the value of the timestamp() function, so
+	// that it is the same everywhere it is used.
+	Timestamp time.Time
+
+	// Diff is the diff being planned. The lazy references to resources
+	// with a change in it are unknown when planning, see lazyPending.
+	Diff     *Diff
+	DiffLock *sync.RWMutex
 }
 
 // InterpolationScope is the current scope of execution. This is required
@@ -41,11 +64,36 @@ func (i *Interpolater) Values(
 	vars map[string]config.InterpolatedVariable) (map[string]ast.Variable, error) {
 	result := make(map[string]ast.Variable, len(vars))
 
+	if !i.Timestamp.IsZero() {
+		result[config.TimestampVariable] = ast.Variable{
+			Value: i.Timestamp.UTC().Format(time.RFC3339),
+			Type:  ast.TypeString,
+		}
+	}
+
+	if scope != nil && scope.Resource != nil && scope.Resource.Info != nil {
+		// The seed always has the index, so that the random values don't
+		// change when the count changes between one and more, which
+		// changes the ID between "foo" and "foo.0".
+		r := scope.Resource
+		seed := fmt.Sprintf("%s.%d",
+			strings.TrimSuffix(r.Info.Id, fmt.Sprintf(".%d", r.CountIndex)),
+			r.CountIndex)
+		if len(scope.Path) > 1 {
+			seed = modulePrefixStr(scope.Path) + "." + seed
+		}
+
+		result[config.RandomSeedVariable] = ast.Variable{
+			Value: seed,
+			Type:  ast.TypeString,
+		}
+	}
+
 	// Copy the default variables
 	if i.Module != nil && scope != nil {
 		mod := i.Module
 		if len(scope.Path) > 1 {
-			mod = i.Module.Child(scope.Path[1:])
+			mod = moduleTreeChild(i.Module, scope.Path[1:])
 		}
 		for _, v := range mod.Config().Variables {
 			for k, val := range v.DefaultsMap() {
@@ -68,6 +116,8 @@ func (i *Interpolater) Values(
 			err = i.valuePathVar(scope, n, v, result)
 		case *config.ResourceVariable:
 			err = i.valueResourceVar(scope, n, v, result)
+		case *config.SecretVariable:
+			err = i.valueSecretVar(scope, n, v, result)
 		case *config.SelfVariable:
 			err = i.valueSelfVar(scope, n, v, result)
 		case *config.UserVariable:
@@ -176,7 +226,7 @@ func (i *Interpolater) valuePathVar(
 			Type:  ast.TypeString,
 		}
 	case config.PathValueModule:
-		if t := i.Module.Child(scope.Path[1:]); t != nil {
+		if t := moduleTreeChild(i.Module, scope.Path[1:]); t != nil {
 			result[n] = ast.Variable{
 				Value: t.Config().Dir,
 				Type:  ast.TypeString,
@@ -210,6 +260,16 @@ func (i *Interpolater) valueResourceVar(
 		return nil
 	}
 
+	// A lazy reference to a resource that is changing is only known once
+	// it is applied, so its state is stale when planning.
+	if i.Operation == walkPlan && i.lazyPending(scope, v) {
+		result[n] = ast.Variable{
+			Value: config.UnknownVariableValue,
+			Type:  ast.TypeString,
+		}
+		return nil
+	}
+
 	var attr string
 	var err error
 	if v.Multi && v.Index == -1 {
@@ -228,11 +288,103 @@ func (i *Interpolater) valueResourceVar(
 	return nil
 }
 
+// lazyPending returns whether the variable is a lazy reference of the
+// resource in scope to a resource that has a change in the diff that the
+// apply writes, see EvalWaitForDependencies. The resources referenced
+// lazily are planned first, see LazyReferenceTransformer.
+func (i *Interpolater) lazyPending(
+	scope *InterpolationScope, v *config.ResourceVariable) bool {
+	if scope == nil || scope.Resource == nil || i.Diff == nil {
+		return false
+	}
+
+	id := v.ResourceId()
+	lazy := false
+	for _, r := range scope.Resource.LazyReferences {
+		if r == id {
+			lazy = true
+			break
+		}
+	}
+	if !lazy {
+		return false
+	}
+
+	i.DiffLock.RLock()
+	defer i.DiffLock.RUnlock()
+
+	modDiff := i.Diff.ModuleByPath(scope.Path)
+	if modDiff == nil {
+		return false
+	}
+	for k, d := range modDiff.Resources {
+		// The diffs of counted resources are per instance
+		if k != id && !strings.HasPrefix(k, id+".") {
+			continue
+		}
+		if d.Empty() || (d.Destroy && len(d.Attributes) == 0) {
+			continue
+		}
+		if !d.ScheduledFor.IsZero() {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (i *Interpolater) valueSecretVar(
+	scope *InterpolationScope,
+	n string,
+	v *config.SecretVariable,
+	result map[string]ast.Variable) error {
+	if scope == nil || scope.Resource == nil {
+		return fmt.Errorf(
+			"%s: secrets are only valid in the provisioners of a resource", n)
+	}
+
+	val, ok := scope.Resource.Secrets[v.Name]
+	if !ok {
+		// Secrets are only read right before provisioning, so nothing
+		// else can know them.
+		if i.Operation != walkApply {
+			result[n] = ast.Variable{
+				Value: config.UnknownVariableValue,
+				Type:  ast.TypeString,
+			}
+			return nil
+		}
+
+		return fmt.Errorf(
+			"%s: the provider has no secret '%s' for this resource", n, v.Name)
+	}
+
+	result[n] = ast.Variable{
+		Value: val,
+		Type:  ast.TypeString,
+	}
+	return nil
+}
+
 func (i *Interpolater) valueSelfVar(
 	scope *InterpolationScope,
 	n string,
 	v *config.SelfVariable,
 	result map[string]ast.Variable) error {
+	// In the provisioners, self is the instance that was just applied,
+	// which may not be in the state yet.
+	if is := scope.Resource.State; is != nil {
+		if attr, ok := is.Attributes[v.Field]; ok {
+			result[n] = ast.Variable{
+				Value: attr,
+				Type:  ast.TypeString,
+			}
+			return nil
+		}
+	}
+
 	rv, err := config.NewResourceVariable(fmt.Sprintf(
 		"%s.%s.%d.%s",
 		scope.Resource.Type,
@@ -300,14 +452,16 @@ func (i *Interpolater) computeResourceVariable(
 		return "", err
 	}
 
-	// If we have no module in the state yet or count, return empty
+	// If we have no module in the state yet, the resource hasn't
+	// been created yet.
 	if module == nil || len(module.Resources) == 0 {
-		return "", nil
+		return i.missingResource(v)
 	}
 
 	// Get the resource out from the state. We know the state exists
 	// at this point and if there is a state, we expect there to be a
 	// resource with the given name.
+	var primary *InstanceState
 	r, ok := module.Resources[id]
 	if !ok && v.Multi && v.Index == 0 {
 		r, ok = module.Resources[v.ResourceId()]
@@ -319,11 +473,19 @@ func (i *Interpolater) computeResourceVariable(
 		goto MISSING
 	}
 
-	if r.Primary == nil {
+	// Dependents only ever see a clean primary, never an instance that
+	// is tainted or deposed.
+	primary = r.CleanPrimary()
+	if primary == nil {
 		goto MISSING
 	}
 
-	if attr, ok := r.Primary.Attributes[v.Field]; ok {
+	// A data source that is only read during the apply is all computed
+	if isDataSourcePlaceholder(primary) {
+		return config.UnknownVariableValue, nil
+	}
+
+	if attr, ok := primary.Attributes[v.Field]; ok {
 		return attr, nil
 	}
 
@@ -346,13 +508,13 @@ func (i *Interpolater) computeResourceVariable(
 		for i := 1; i < len(parts); i++ {
 			// Lists and sets make this
 			key := fmt.Sprintf("%s.#", strings.Join(parts[:i], "."))
-			if attr, ok := r.Primary.Attributes[key]; ok {
+			if attr, ok := primary.Attributes[key]; ok {
 				return attr, nil
 			}
 
 			// Maps make this
 			key = fmt.Sprintf("%s", strings.Join(parts[:i], "."))
-			if attr, ok := r.Primary.Attributes[key]; ok {
+			if attr, ok := primary.Attributes[key]; ok {
 				return attr, nil
 			}
 		}
@@ -404,11 +566,17 @@ func (i *Interpolater) computeResourceMultiVariable(
 			err)
 	}
 
-	// If we have no module in the state yet or count, return empty
-	if module == nil || len(module.Resources) == 0 || count == 0 {
+	// If we have no count, return empty
+	if count == 0 {
 		return "", nil
 	}
 
+	// If we have no module in the state yet, the resource hasn't
+	// been created yet.
+	if module == nil || len(module.Resources) == 0 {
+		return i.missingResource(v)
+	}
+
 	var values []string
 	for i := 0; i < count; i++ {
 		id := fmt.Sprintf("%s.%d", v.ResourceId(), i)
@@ -424,11 +592,15 @@ func (i *Interpolater) computeResourceMultiVariable(
 			continue
 		}
 
-		if r.Primary == nil {
+		primary := r.CleanPrimary()
+		if primary == nil {
 			continue
 		}
+		if isDataSourcePlaceholder(primary) {
+			return config.UnknownVariableValue, nil
+		}
 
-		attr, ok := r.Primary.Attributes[v.Field]
+		attr, ok := primary.Attributes[v.Field]
 		if !ok {
 			continue
 		}
@@ -461,6 +633,19 @@ func (i *Interpolater) computeResourceMultiVariable(
 	return config.NewStringList(values).String(), nil
 }
 
+// missingResource returns the value of a variable referencing a resource
+// that isn't in the state, according to the MissingResource policy.
+func (i *Interpolater) missingResource(v *config.ResourceVariable) (string, error) {
+	if i.MissingResource == MissingResourceError {
+		return "", fmt.Errorf(
+			"Resource '%s' not in the state for variable '%s'",
+			v.ResourceId(),
+			v.FullKey())
+	}
+
+	return config.UnknownVariableValue, nil
+}
+
 func (i *Interpolater) resourceVariableInfo(
 	scope *InterpolationScope,
 	v *config.ResourceVariable) (*ModuleState, *config.Resource, error) {
@@ -468,7 +653,7 @@ func (i *Interpolater) resourceVariableInfo(
 	// either the current module (path is empty) or a child.
 	modTree := i.Module
 	if len(scope.Path) > 1 {
-		modTree = i.Module.Child(scope.Path[1:])
+		modTree = moduleTreeChild(i.Module, scope.Path[1:])
 	}
 
 	// Get the resource from the configuration so we can verify
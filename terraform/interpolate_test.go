@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/config/lang/ast"
@@ -136,6 +137,83 @@ func TestInterpolater_pathRoot(t *testing.T) {
 	})
 }
 
+func TestInterpolater_timestamp(t *testing.T) {
+	i := &Interpolater{
+		Timestamp: time.Date(2015, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	actual, err := i.Values(nil, map[string]config.InterpolatedVariable{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]ast.Variable{
+		config.TimestampVariable: ast.Variable{
+			Value: "2015-07-01T12:00:00Z",
+			Type:  ast.TypeString,
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestInterpolater_randomSeed(t *testing.T) {
+	i := new(Interpolater)
+	scope := &InterpolationScope{
+		Path: []string{"root", "child"},
+		Resource: &Resource{
+			CountIndex: 1,
+			Info:       &InstanceInfo{Id: "aws_instance.foo.1"},
+		},
+	}
+
+	actual, err := i.Values(scope, map[string]config.InterpolatedVariable{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]ast.Variable{
+		config.RandomSeedVariable: ast.Variable{
+			Value: "module.child.aws_instance.foo.1",
+			Type:  ast.TypeString,
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestInterpolater_randomSeedNoIndex(t *testing.T) {
+	i := new(Interpolater)
+	values := func(id string) map[string]ast.Variable {
+		scope := &InterpolationScope{
+			Path: rootModulePath,
+			Resource: &Resource{
+				Info: &InstanceInfo{Id: id},
+			},
+		}
+
+		actual, err := i.Values(scope, map[string]config.InterpolatedVariable{})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return actual
+	}
+
+	// The seed of a resource without a count is that of index zero, so
+	// it doesn't change when the count changes between one and more
+	actual := values("aws_instance.foo")
+	expected := values("aws_instance.foo.0")
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if v := actual[config.RandomSeedVariable].Value; v != "aws_instance.foo.0" {
+		t.Fatalf("bad: %#v", v)
+	}
+}
+
 func TestInterpolater_resourceVariable(t *testing.T) {
 	lock := new(sync.RWMutex)
 	state := &State{
@@ -173,6 +251,135 @@ func TestInterpolater_resourceVariable(t *testing.T) {
 	})
 }
 
+func TestInterpolater_resourceVariableMissing(t *testing.T) {
+	i := &Interpolater{
+		Module:    testModule(t, "interpolate-resource-variable"),
+		State:     &State{},
+		StateLock: new(sync.RWMutex),
+	}
+
+	scope := &InterpolationScope{
+		Path: rootModulePath,
+	}
+
+	testInterpolate(t, i, scope, "aws_instance.web.foo", ast.Variable{
+		Value: config.UnknownVariableValue,
+		Type:  ast.TypeString,
+	})
+
+	// With the strict policy, the missing resource is an error
+	i.MissingResource = MissingResourceError
+	v, err := config.NewInterpolatedVariable("aws_instance.web.foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, err = i.Values(scope, map[string]config.InterpolatedVariable{
+		"foo": v,
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestInterpolater_resourceVariableTainted(t *testing.T) {
+	lock := new(sync.RWMutex)
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.web": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
+						},
+						Tainted: []*InstanceState{
+							&InstanceState{ID: "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	i := &Interpolater{
+		Module:    testModule(t, "interpolate-resource-variable"),
+		State:     state,
+		StateLock: lock,
+	}
+
+	scope := &InterpolationScope{
+		Path: rootModulePath,
+	}
+
+	// The primary is tainted, so it isn't used
+	v, err := config.NewInterpolatedVariable("aws_instance.web.foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, err = i.Values(scope, map[string]config.InterpolatedVariable{
+		"foo": v,
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestInterpolater_selfVariableApplied(t *testing.T) {
+	lock := new(sync.RWMutex)
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.web": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
+						},
+						Tainted: []*InstanceState{
+							&InstanceState{ID: "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	i := &Interpolater{
+		Module:    testModule(t, "interpolate-resource-variable"),
+		State:     state,
+		StateLock: lock,
+	}
+
+	// self is the applied instance, even if the state doesn't have it
+	scope := &InterpolationScope{
+		Path: rootModulePath,
+		Resource: &Resource{
+			Name:       "web",
+			Type:       "aws_instance",
+			CountIndex: -1,
+			State: &InstanceState{
+				ID: "baz",
+				Attributes: map[string]string{
+					"private_ip": "10.0.0.1",
+				},
+			},
+		},
+	}
+
+	testInterpolate(t, i, scope, "self.private_ip", ast.Variable{
+		Value: "10.0.0.1",
+		Type:  ast.TypeString,
+	})
+}
+
 func TestInterpolater_resourceVariableMulti(t *testing.T) {
 	lock := new(sync.RWMutex)
 	state := &State{
@@ -0,0 +1,80 @@
+package terraform
+
+import (
+	"fmt"
+	"path"
+	"sync"
+)
+
+// ModuleBudget is the most resources that the modules matching a pattern
+// may have. See ContextOpts.ModuleBudgets.
+type ModuleBudget struct {
+	// Pattern is matched against the address of each module, such as
+	// "module.tenant_*" or "module.foo.module.bar". The root module is
+	// "root". A "*" matches any sequence of characters, including dots.
+	// See path.Match for the full syntax.
+	Pattern string
+
+	// Max is the most resources, counting every instance of a resource
+	// with a count, that a matching module may have. The resources of
+	// the modules within it count towards it too.
+	Max int
+}
+
+// ModuleBudgetTracker counts the resources of each module during a walk
+// and checks them against the budgets. The methods are safe to call on a
+// nil tracker, which has no budgets.
+type ModuleBudgetTracker struct {
+	Budgets []*ModuleBudget
+
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+// Add counts n more resources in the module at the given path, for the
+// module and each module it is within. It returns an error if that puts
+// any of them over its budget.
+func (t *ModuleBudgetTracker) Add(p []string, n int) error {
+	if t == nil || len(t.Budgets) == 0 {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.counts == nil {
+		t.counts = make(map[string]int)
+	}
+
+	for i := len(p); i > 0; i-- {
+		addr := "root"
+		if i > 1 {
+			addr = modulePrefixStr(p[:i])
+		}
+
+		budget := t.budget(addr)
+		if budget == nil {
+			continue
+		}
+
+		t.counts[addr] += n
+		if total := t.counts[addr]; total > budget.Max {
+			return fmt.Errorf(
+				"%s has %d resources, more than its budget of %d",
+				addr, total, budget.Max)
+		}
+	}
+
+	return nil
+}
+
+// budget returns the first budget that matches the module address.
+func (t *ModuleBudgetTracker) budget(addr string) *ModuleBudget {
+	for _, b := range t.Budgets {
+		if ok, _ := path.Match(b.Pattern, addr); ok {
+			return b
+		}
+	}
+
+	return nil
+}
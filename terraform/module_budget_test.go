@@ -0,0 +1,67 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModuleBudgetTracker(t *testing.T) {
+	tracker := &ModuleBudgetTracker{
+		Budgets: []*ModuleBudget{
+			&ModuleBudget{Pattern: "module.child", Max: 3},
+			&ModuleBudget{Pattern: "root", Max: 4},
+		},
+	}
+	child := []string{"root", "child"}
+
+	if err := tracker.Add(child, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Modules without a budget aren't limited, but still count towards
+	// the modules they are within.
+	if err := tracker.Add([]string{"root", "other"}, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := tracker.Add(child, 2)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	expected := "module.child has 4 resources, more than its budget of 3"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestModuleBudgetTracker_nil(t *testing.T) {
+	var tracker *ModuleBudgetTracker
+	if err := tracker.Add(rootModulePath, 100); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestEvalCheckModuleBudget(t *testing.T) {
+	r := testModule(t, "plan-module-budget").Config().Resources[0]
+	ctx := &MockEvalContext{
+		PathPath: []string{"root", "child"},
+		ModuleBudgetsTracker: &ModuleBudgetTracker{
+			Budgets: []*ModuleBudget{
+				&ModuleBudget{Pattern: "module.*", Max: 3},
+			},
+		},
+	}
+
+	n := &EvalCheckModuleBudget{Resource: r}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err := n.Eval(ctx)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "aws_instance.foo: module.child has 4") {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform/config/module"
 )
@@ -26,17 +27,28 @@ type Plan struct {
 	State  *State
 	Vars   map[string]string
 
+	// Checksum is the checksum of Diff when the plan was created. It is
+	// verified before the plan is applied. See Diff.Checksum.
+	Checksum string
+
+	// Timestamp is the value of the timestamp() interpolation function
+	// when the plan was created, so that it is the same when the plan is
+	// applied. See Context.Timestamp.
+	Timestamp time.Time
+
 	once sync.Once
 }
 
 // Context returns a Context with the data encapsulated in this plan.
 //
 // The following fields in opts are overridden by the plan: Config,
-// Diff, State, Variables.
+// Diff, DiffChecksum, State, Timestamp, Variables.
 func (p *Plan) Context(opts *ContextOpts) *Context {
 	opts.Diff = p.Diff
+	opts.DiffChecksum = p.Checksum
 	opts.Module = p.Module
 	opts.State = p.State
+	opts.Timestamp = p.Timestamp
 	opts.Variables = p.Vars
 	return NewContext(opts)
 }
@@ -3,8 +3,8 @@ package terraform
 import (
 	"bytes"
 	"strings"
-
 	"testing"
+	"time"
 )
 
 func TestReadWritePlan(t *testing.T) {
@@ -53,6 +53,7 @@ func TestReadWritePlan(t *testing.T) {
 		Vars: map[string]string{
 			"foo": "bar",
 		},
+		Timestamp: time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC),
 	}
 
 	buf := new(bytes.Buffer)
@@ -70,4 +71,7 @@ func TestReadWritePlan(t *testing.T) {
 	if actualStr != expectedStr {
 		t.Fatalf("bad:\n\n%s\n\nexpected:\n\n%s", actualStr, expectedStr)
 	}
+	if !actual.Timestamp.Equal(plan.Timestamp) {
+		t.Fatalf("bad: %s", actual.Timestamp)
+	}
 }
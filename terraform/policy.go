@@ -0,0 +1,20 @@
+package terraform
+
+// Policy is the interface that must be implemented by a policy service
+// that approves changes to resources before they're applied.
+type Policy interface {
+	// Check returns the decision of the policy for applying the given
+	// diff to the given resource instance. An error means the decision
+	// couldn't be made, and the change isn't applied.
+	Check(*InstanceInfo, *InstanceDiff) (*PolicyDecision, error)
+}
+
+// PolicyDecision is the decision of a Policy for a single change.
+type PolicyDecision struct {
+	// Allowed is true if the change can be applied.
+	Allowed bool
+
+	// Reason is the explanation the policy gives for its decision. It is
+	// shown to the user when a change is denied.
+	Reason string
+}
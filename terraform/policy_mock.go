@@ -0,0 +1,33 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// MockPolicy implements Policy but mocks out all the calls for testing
+// purposes.
+type MockPolicy struct {
+	sync.Mutex
+
+	CheckCalled      bool
+	CheckInfo        *InstanceInfo
+	CheckDiff        *InstanceDiff
+	CheckFn          func(*InstanceInfo, *InstanceDiff) (*PolicyDecision, error)
+	CheckReturn      *PolicyDecision
+	CheckReturnError error
+}
+
+func (p *MockPolicy) Check(
+	info *InstanceInfo, d *InstanceDiff) (*PolicyDecision, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.CheckCalled = true
+	p.CheckInfo = info
+	p.CheckDiff = d
+	if p.CheckFn != nil {
+		return p.CheckFn(info, d)
+	}
+
+	return p.CheckReturn, p.CheckReturnError
+}
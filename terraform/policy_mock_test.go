@@ -0,0 +1,9 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestMockPolicy_impl(t *testing.T) {
+	var _ Policy = new(MockPolicy)
+}
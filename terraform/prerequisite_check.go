@@ -0,0 +1,52 @@
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/config/module"
+)
+
+// PrerequisiteCheck is the interface that must be implemented by a check
+// of an external prerequisite of resources that Terraform doesn't manage,
+// such as a DNS zone that must be delegated or a quota increase that must
+// be approved. See ContextOpts.PrerequisiteChecks.
+type PrerequisiteCheck interface {
+	// Check returns the result of the check for the given resource
+	// instance with its interpolated config. Values that aren't known
+	// until the apply are computed in the config. An error means the
+	// check couldn't be made, and nothing is applied either.
+	Check(*InstanceInfo, *ResourceConfig) (*PrerequisiteCheckResult, error)
+}
+
+// PrerequisiteCheckResult is the result of a PrerequisiteCheck for a
+// single resource instance.
+type PrerequisiteCheckResult struct {
+	// Passed is true if the prerequisite is ready.
+	Passed bool
+
+	// Message explains the result. It is shown to the user when the check
+	// fails, so it should say what to do about it.
+	Message string
+}
+
+// usesPrerequisiteChecks returns true if any resource in the module tree
+// has prerequisite checks in its lifecycle.
+func usesPrerequisiteChecks(t *module.Tree) bool {
+	if t == nil {
+		return false
+	}
+
+	if c := t.Config(); c != nil {
+		for _, r := range c.Resources {
+			if len(r.Lifecycle.PrerequisiteChecks) > 0 {
+				return true
+			}
+		}
+	}
+
+	for _, child := range t.Children() {
+		if usesPrerequisiteChecks(child) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// MockPrerequisiteCheck implements PrerequisiteCheck but mocks out all the
+// calls for testing purposes.
+type MockPrerequisiteCheck struct {
+	sync.Mutex
+
+	CheckCalled      bool
+	CheckInfo        *InstanceInfo
+	CheckConfig      *ResourceConfig
+	CheckFn          func(*InstanceInfo, *ResourceConfig) (*PrerequisiteCheckResult, error)
+	CheckReturn      *PrerequisiteCheckResult
+	CheckReturnError error
+}
+
+func (p *MockPrerequisiteCheck) Check(
+	info *InstanceInfo, c *ResourceConfig) (*PrerequisiteCheckResult, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.CheckCalled = true
+	p.CheckInfo = info
+	p.CheckConfig = c
+	if p.CheckFn != nil {
+		return p.CheckFn(info, c)
+	}
+
+	return p.CheckReturn, p.CheckReturnError
+}
@@ -31,15 +31,32 @@ type Resource struct {
 	Type       string
 	CountIndex int
 
+	// Info is the instance this is. Its Id, with the index CountIndex
+	// even if the Id has none, seeds the random() function when the
+	// configuration of the resource is interpolated.
+	Info *InstanceInfo
+
+	// Secrets are the secrets the provider read for the provisioners.
+	// They're only kept in memory, never in the state.
+	// See ResourceProviderSecretReader.
+	Secrets map[string]string
+
+	// State is the applied state of the instance while its provisioners
+	// run. The self variables in their configuration resolve to it, so
+	// they see the attributes the apply computed.
+	State *InstanceState
+
+	// LazyReferences are the resources that the configuration references
+	// lazily, see config.ResourceLifecycle.LazyReferences.
+	LazyReferences []string
+
 	// These aren't really used anymore anywhere, but we keep them around
 	// since we haven't done a proper cleanup yet.
 	Id           string
-	Info         *InstanceInfo
 	Config       *ResourceConfig
 	Dependencies []string
 	Diff         *InstanceDiff
 	Provider     ResourceProvider
-	State        *InstanceState
 	Provisioners []*ResourceProvisionerConfig
 	Flags        ResourceFlag
 	TaintedIndex int
@@ -71,6 +88,11 @@ type InstanceInfo struct {
 
 	// Type is the resource type of this instance
 	Type string
+
+	// CorrelationId is an ID that is unique to this resource for a single
+	// walk of the graph. It is included in the logs for this resource and
+	// is available to providers to include in their own logs.
+	CorrelationId string
 }
 
 // HumanId is a unique Id that is human-friendly and useful for UI elements.
@@ -85,10 +107,23 @@ func (i *InstanceInfo) HumanId() string {
 		i.Id)
 }
 
+// logId is the Id of this instance along with its correlation ID, if it
+// has one, for use in log messages.
+func (i *InstanceInfo) logId() string {
+	if i.CorrelationId == "" {
+		return i.Id
+	}
+
+	return fmt.Sprintf("%s (correlation ID %s)", i.Id, i.CorrelationId)
+}
+
 // ResourceConfig holds the configuration given for a resource. This is
 // done instead of a raw `map[string]interface{}` type so that rich
 // methods can be added to it to make dealing with it easier.
 type ResourceConfig struct {
+	// ComputedKeys are the keys whose values aren't known yet, because
+	// they interpolate something that is only known after it is applied.
+	// They are left out of Config, see config.RawConfig.UnknownKeys.
 	ComputedKeys []string
 	Raw          map[string]interface{}
 	Config       map[string]interface{}
@@ -121,9 +121,10 @@ func tokenizeResourceAddress(s string) (map[string]string, error) {
 		// "aws_instance.web" (optional when module path specified)
 		`(?:(?P<type>[^.]+)\.(?P<name>[^.[]+))?` +
 		// "tainted" (optional, omission implies: "primary")
-		`(?:\.(?P<instance_type>\w+))?` +
-		// "1" (optional, omission implies: "0")
-		`(?:\[(?P<index>\d+)\])?` +
+		`(?:\.(?P<instance_type>[a-z]\w*))?` +
+		// "1" (optional, omission implies: "0"), or ".1" like the
+		// instance is named in the state
+		`(?:\[(?P<index>\d+)\]|\.(?P<dot_index>\d+))?` +
 		`\z`)
 	groupNames := re.SubexpNames()
 	rawMatches := re.FindAllStringSubmatch(s, -1)
@@ -134,5 +135,8 @@ func tokenizeResourceAddress(s string) (map[string]string, error) {
 	for i, m := range rawMatches[0] {
 		matches[groupNames[i]] = m
 	}
+	if matches["dot_index"] != "" {
+		matches["index"] = matches["dot_index"]
+	}
 	return matches, nil
 }
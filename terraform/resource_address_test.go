@@ -37,6 +37,24 @@ func TestParseResourceAddress(t *testing.T) {
 				Index:        2,
 			},
 		},
+		"implicit primary, index like in the state": {
+			Input: "aws_instance.foo.2",
+			Expected: &ResourceAddress{
+				Type:         "aws_instance",
+				Name:         "foo",
+				InstanceType: TypePrimary,
+				Index:        2,
+			},
+		},
+		"tainted, index like in the state": {
+			Input: "aws_instance.foo.tainted.2",
+			Expected: &ResourceAddress{
+				Type:         "aws_instance",
+				Name:         "foo",
+				InstanceType: TypeTainted,
+				Index:        2,
+			},
+		},
 		"tainted": {
 			Input: "aws_instance.foo.tainted",
 			Expected: &ResourceAddress{
@@ -77,9 +77,151 @@ type ResourceProviderCloser interface {
 	Close() error
 }
 
+// ApplyFunc applies a diff to an instance, with the same semantics as
+// ResourceProvider.Apply.
+type ApplyFunc func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error)
+
+// ResourceProviderCustomApplier is an interface that providers can
+// implement to apply some resource types with a custom function instead
+// of Apply, for resources whose updates need a sequence of steps of
+// their own. CustomApply returns nil for resource types that use Apply.
+//
+// As with Apply, if the function returns a non-nil state along with an
+// error, that state is still written so partial progress isn't lost.
+type ResourceProviderCustomApplier interface {
+	CustomApply(resourceType string) ApplyFunc
+}
+
+// AttributeMigration migrates the attributes of an instance that were
+// written under an older schema version of a resource type, such as to
+// rename an attribute. Version is the schema version the attributes are
+// in once the migration has run.
+type AttributeMigration struct {
+	Version int
+	Migrate func(attrs map[string]string) error
+}
+
+// ResourceProviderMigrator is an interface that providers can implement
+// to migrate the attributes in the state of a resource type across
+// schema versions. AttributeMigrations returns nil for resource types
+// that have no migrations.
+type ResourceProviderMigrator interface {
+	AttributeMigrations(resourceType string) []AttributeMigration
+}
+
+// ResourceProviderSecretReader is an interface that providers can
+// implement to give the provisioners of a resource secrets that must not
+// be stored in the state, such as a generated admin password. The
+// secrets are referenced in provisioners as "${secret.NAME}" and are
+// only ever kept in memory.
+type ResourceProviderSecretReader interface {
+	ReadSecrets(*InstanceInfo, *InstanceState) (map[string]string, error)
+}
+
+// ResourceProviderApplyCanceler is an interface that providers can
+// implement to cancel an apply that is still running, such as when it
+// runs past the timeout of its resource. CancelApply should make the
+// apply of the given instance return as soon as it can, with the state of
+// whatever it did so far.
+type ResourceProviderApplyCanceler interface {
+	CancelApply(*InstanceInfo) error
+}
+
+// ResourceProviderDryRunner is an interface that providers can implement
+// to project the state that applying a diff would result in, without
+// changing anything, for dry run applies. See ContextOpts.DryRun. Without
+// it, the state is projected from the diff alone.
+type ResourceProviderDryRunner interface {
+	DryRunApply(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error)
+}
+
+// ResourceProviderDataSourceReader is an interface that providers
+// implement to provide data sources, the read-only resources declared in
+// "data" blocks. ReadDataSource reads the data source of the given type
+// with the given configuration, and returns its current state. The state
+// must have an ID, like the state of any other instance.
+type ResourceProviderDataSourceReader interface {
+	ReadDataSource(*InstanceInfo, *ResourceConfig) (*InstanceState, error)
+}
+
+// DiffSuppressFunc returns true if changing the attribute with the given
+// key from old to new isn't a real change, such as for two policy
+// documents that only differ in whitespace.
+type DiffSuppressFunc func(k, old, new string) bool
+
+// ResourceProviderDiffSuppressor is an interface that providers can
+// implement to suppress the diffs of attributes whose values are
+// equivalent even though they're written differently. DiffSuppressFuncs
+// returns the functions of the given resource type by top-level attribute
+// name. The function of an attribute is called for the diffs of its
+// elements too, such as "tags.Name" for "tags". See EvalDiffSuppress.
+type ResourceProviderDiffSuppressor interface {
+	DiffSuppressFuncs(resourceType string) map[string]DiffSuppressFunc
+}
+
+// ResourceProviderConcurrencyLimiter is an interface that providers can
+// implement to limit how many calls to Apply, Diff and Refresh are made
+// to them at once, such as to stay under the rate limit of their API.
+// This limit applies on top of the parallelism of the walk; a limit of
+// zero or less means only the parallelism applies.
+type ResourceProviderConcurrencyLimiter interface {
+	ConcurrencyLimit() int
+}
+
+// ResourceProviderPrerequisiter is an interface that providers can
+// implement when some of their resource types implicitly depend on
+// something the provider manages itself that isn't in the configuration,
+// such as a default network or a service-linked role. Terraform ensures
+// the prerequisites exist before any resource that needs them is applied.
+type ResourceProviderPrerequisiter interface {
+	// Prerequisites returns the names of the prerequisites that the
+	// resources of the given type need.
+	Prerequisites(string) []string
+
+	// EnsurePrerequisite makes sure the prerequisite with the given name
+	// exists, creating it if it doesn't. It is called once per apply for
+	// each prerequisite, no matter how many resources need it.
+	EnsurePrerequisite(string) error
+}
+
+// ResourceProviderCostEstimator is an interface that providers can
+// implement to estimate how much the changes they plan cost. The estimates
+// are checked against the budget of an apply, see ContextOpts.CostBudget.
+type ResourceProviderCostEstimator interface {
+	// EstimateCost returns the estimated change to the monthly cost of
+	// the resource from applying the diff, which is negative if it gets
+	// cheaper. It returns false if the cost can't be estimated.
+	EstimateCost(*InstanceInfo, *InstanceDiff) (float64, bool, error)
+}
+
+// MigrateDataFunc moves the data of an instance that is being replaced,
+// such as the contents of a database, from the old instance to the new.
+type MigrateDataFunc func(info *InstanceInfo, from, to *InstanceState) error
+
+// ResourceProviderDataMigrator is an interface that providers can implement
+// for stateful resource types whose data must be moved to the replacement
+// of an instance before the old instance is destroyed. This only happens
+// with create_before_destroy, see EvalMigrateData. DataMigration returns
+// nil for resource types that have no data to move.
+type ResourceProviderDataMigrator interface {
+	DataMigration(resourceType string) MigrateDataFunc
+}
+
 // ResourceType is a type of resource that a resource provider can manage.
 type ResourceType struct {
 	Name string
+
+	// Attributes, if non-empty, is the complete list of top-level
+	// attribute names in the current schema of this resource type.
+	// Attributes found in the state that aren't in this list are pruned
+	// before the state is written. Leaving this empty disables pruning.
+	Attributes []string
+
+	// JSONAttributes are the top-level attributes of this resource type
+	// whose values are JSON documents. A diff of one of these attributes
+	// is suppressed if the old and new values are equivalent JSON, such
+	// as when only the key order or whitespace differs.
+	JSONAttributes []string
 }
 
 // ResourceProviderFactory is a function type that creates a new instance
@@ -103,3 +245,45 @@ func ProviderSatisfies(p ResourceProvider, n string) bool {
 
 	return false
 }
+
+// schemaAttributes returns the set of top-level attribute names that the
+// provider declares for the given resource type, or nil if the provider
+// doesn't declare any.
+func schemaAttributes(p ResourceProvider, n string) map[string]struct{} {
+	for _, rt := range p.Resources() {
+		if rt.Name != n || len(rt.Attributes) == 0 {
+			continue
+		}
+
+		result := make(map[string]struct{}, len(rt.Attributes)+1)
+		for _, a := range rt.Attributes {
+			result[a] = struct{}{}
+		}
+
+		// The ID is managed by Terraform and is never pruned
+		result["id"] = struct{}{}
+		return result
+	}
+
+	return nil
+}
+
+// schemaJSONAttributes returns the set of top-level attribute names that
+// the provider declares as JSON for the given resource type, or nil if the
+// provider doesn't declare any.
+func schemaJSONAttributes(p ResourceProvider, n string) map[string]struct{} {
+	for _, rt := range p.Resources() {
+		if rt.Name != n || len(rt.JSONAttributes) == 0 {
+			continue
+		}
+
+		result := make(map[string]struct{}, len(rt.JSONAttributes))
+		for _, a := range rt.JSONAttributes {
+			result[a] = struct{}{}
+		}
+
+		return result
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"github.com/hashicorp/go-multierror"
+)
+
+// ApplyErrorClass classifies an error returned by a provider from Apply
+// so that callers can decide how to respond to it.
+type ApplyErrorClass byte
+
+const (
+	// ApplyErrorUnclassified is an error the provider didn't classify.
+	// These are treated as non-retryable.
+	ApplyErrorUnclassified ApplyErrorClass = iota
+
+	// ApplyErrorTransient is an error that may succeed if retried, such
+	// as a timeout or rate limiting by the remote API. The apply is
+	// retried a few times from the state it started with, so providers
+	// must only return it if the apply didn't change anything.
+	ApplyErrorTransient
+
+	// ApplyErrorConfig is an error caused by the user's configuration.
+	// Retrying won't help until the configuration is changed, so the
+	// apply stops starting new resources once one fails with it.
+	ApplyErrorConfig
+
+	// ApplyErrorInternal is an error caused by a bug in the provider.
+	ApplyErrorInternal
+)
+
+func (c ApplyErrorClass) String() string {
+	switch c {
+	case ApplyErrorTransient:
+		return "transient"
+	case ApplyErrorConfig:
+		return "config"
+	case ApplyErrorInternal:
+		return "internal"
+	default:
+		return "unclassified"
+	}
+}
+
+// ApplyError is an error that a provider can return from Apply to
+// classify the underlying error.
+type ApplyError struct {
+	Class ApplyErrorClass
+	Err   error
+}
+
+func (e *ApplyError) Error() string {
+	return e.Err.Error()
+}
+
+// Retryable returns true if the operation that caused this error can
+// be retried.
+func (e *ApplyError) Retryable() bool {
+	return e.Class == ApplyErrorTransient
+}
+
+// ApplyErrorClassOf returns the class of the given error. Errors that aren't
+// an ApplyError are unclassified. A multierror only has a class if all of
+// its errors share that class.
+func ApplyErrorClassOf(err error) ApplyErrorClass {
+	switch e := err.(type) {
+	case *ApplyError:
+		return e.Class
+	case *multierror.Error:
+		if len(e.Errors) == 0 {
+			return ApplyErrorUnclassified
+		}
+
+		class := ApplyErrorClassOf(e.Errors[0])
+		for _, err := range e.Errors[1:] {
+			if ApplyErrorClassOf(err) != class {
+				return ApplyErrorUnclassified
+			}
+		}
+
+		return class
+	default:
+		return ApplyErrorUnclassified
+	}
+}
@@ -0,0 +1,44 @@
+package terraform
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestApplyErrorClassOf(t *testing.T) {
+	transient := &ApplyError{Class: ApplyErrorTransient, Err: fmt.Errorf("timeout")}
+	config := &ApplyError{Class: ApplyErrorConfig, Err: fmt.Errorf("bad ami")}
+
+	cases := []struct {
+		Err      error
+		Expected ApplyErrorClass
+	}{
+		{nil, ApplyErrorUnclassified},
+		{fmt.Errorf("foo"), ApplyErrorUnclassified},
+		{transient, ApplyErrorTransient},
+		{config, ApplyErrorConfig},
+		{multierror.Append(nil, transient, transient), ApplyErrorTransient},
+		{multierror.Append(nil, transient, config), ApplyErrorUnclassified},
+		{multierror.Append(nil, transient, fmt.Errorf("foo")), ApplyErrorUnclassified},
+	}
+
+	for i, tc := range cases {
+		if actual := ApplyErrorClassOf(tc.Err); actual != tc.Expected {
+			t.Fatalf("%d: expected %s, got %s", i, tc.Expected, actual)
+		}
+	}
+}
+
+func TestApplyError_retryable(t *testing.T) {
+	err := &ApplyError{Class: ApplyErrorTransient, Err: fmt.Errorf("foo")}
+	if !err.Retryable() {
+		t.Fatal("transient errors should be retryable")
+	}
+
+	err.Class = ApplyErrorUnclassified
+	if err.Retryable() {
+		t.Fatal("unclassified errors should not be retryable")
+	}
+}
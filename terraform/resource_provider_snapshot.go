@@ -0,0 +1,351 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ProviderSnapshotMode is the mode that a ProviderSnapshot is used in
+// by a Context.
+type ProviderSnapshotMode byte
+
+const (
+	// ProviderSnapshotOff disables snapshotting, providers are called
+	// as usual.
+	ProviderSnapshotOff ProviderSnapshotMode = iota
+
+	// ProviderSnapshotRecord calls the real providers and records the
+	// responses to Refresh and Diff into the snapshot.
+	ProviderSnapshotRecord
+
+	// ProviderSnapshotReplay never calls the real providers for Refresh
+	// or Diff and instead returns the responses recorded in the snapshot.
+	// This allows a plan to be run offline, without provider credentials.
+	ProviderSnapshotReplay
+)
+
+// ProviderSnapshot is a recording of the responses providers gave to
+// Refresh and Diff calls, keyed by the human-readable resource address
+// (see InstanceInfo.HumanId).
+//
+// A snapshot recorded during a live plan can be replayed to produce
+// the identical diff offline against the same configuration and state.
+type ProviderSnapshot struct {
+	Refresh map[string]*InstanceState `json:"refresh"`
+	Diff    map[string]*InstanceDiff  `json:"diff"`
+
+	lock sync.Mutex
+}
+
+// NewProviderSnapshot returns an empty snapshot ready for recording.
+func NewProviderSnapshot() *ProviderSnapshot {
+	s := &ProviderSnapshot{}
+	s.init()
+	return s
+}
+
+// ReadProviderSnapshot reads a snapshot in the format that was written
+// by WriteProviderSnapshot.
+func ReadProviderSnapshot(src io.Reader) (*ProviderSnapshot, error) {
+	s := &ProviderSnapshot{}
+	if err := json.NewDecoder(src).Decode(s); err != nil {
+		return nil, fmt.Errorf("Decoding provider snapshot failed: %v", err)
+	}
+	s.init()
+
+	return s, nil
+}
+
+// WriteProviderSnapshot writes a snapshot so that it can be read again
+// with ReadProviderSnapshot.
+func WriteProviderSnapshot(s *ProviderSnapshot, dst io.Writer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode provider snapshot: %s", err)
+	}
+
+	if _, err := dst.Write(data); err != nil {
+		return fmt.Errorf("Failed to write provider snapshot: %s", err)
+	}
+
+	return nil
+}
+
+func (s *ProviderSnapshot) init() {
+	if s.Refresh == nil {
+		s.Refresh = make(map[string]*InstanceState)
+	}
+	if s.Diff == nil {
+		s.Diff = make(map[string]*InstanceDiff)
+	}
+}
+
+// snapshotProviderFactories wraps every factory so that the providers it
+// creates record to or replay from the snapshot, depending on the mode.
+func snapshotProviderFactories(
+	fs map[string]ResourceProviderFactory,
+	s *ProviderSnapshot,
+	mode ProviderSnapshotMode) map[string]ResourceProviderFactory {
+	if s == nil || mode == ProviderSnapshotOff {
+		return fs
+	}
+
+	result := make(map[string]ResourceProviderFactory, len(fs))
+	for k, f := range fs {
+		f := f
+		result[k] = func() (ResourceProvider, error) {
+			p, err := f()
+			if err != nil {
+				return nil, err
+			}
+
+			return &snapshotResourceProvider{
+				ResourceProvider: p,
+				Snapshot:         s,
+				Mode:             mode,
+			}, nil
+		}
+	}
+
+	return result
+}
+
+// snapshotResourceProvider is a ResourceProvider that records or replays
+// the Refresh and Diff calls of the wrapped provider.
+type snapshotResourceProvider struct {
+	ResourceProvider
+
+	Snapshot *ProviderSnapshot
+	Mode     ProviderSnapshotMode
+}
+
+func (p *snapshotResourceProvider) Configure(c *ResourceConfig) error {
+	// Replaying must work without credentials, so never configure
+	// the real provider.
+	if p.Mode == ProviderSnapshotReplay {
+		return nil
+	}
+
+	return p.ResourceProvider.Configure(c)
+}
+
+func (p *snapshotResourceProvider) Apply(
+	info *InstanceInfo,
+	s *InstanceState,
+	d *InstanceDiff) (*InstanceState, error) {
+	if p.Mode == ProviderSnapshotReplay {
+		return nil, fmt.Errorf(
+			"%s: cannot apply while replaying a provider snapshot", info.HumanId())
+	}
+
+	return p.ResourceProvider.Apply(info, s, d)
+}
+
+func (p *snapshotResourceProvider) DryRunApply(
+	info *InstanceInfo,
+	s *InstanceState,
+	d *InstanceDiff) (*InstanceState, error) {
+	// A dry run never changes anything, so it may still call the real
+	// provider while replaying.
+	if dr, ok := p.ResourceProvider.(ResourceProviderDryRunner); ok {
+		return dr.DryRunApply(info, s, d)
+	}
+
+	return ProjectedState(s, d), nil
+}
+
+func (p *snapshotResourceProvider) CancelApply(info *InstanceInfo) error {
+	if c, ok := p.ResourceProvider.(ResourceProviderApplyCanceler); ok {
+		return c.CancelApply(info)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) CustomApply(t string) ApplyFunc {
+	// Nothing can be applied while replaying, let Apply error
+	if p.Mode == ProviderSnapshotReplay {
+		return nil
+	}
+
+	if ca, ok := p.ResourceProvider.(ResourceProviderCustomApplier); ok {
+		return ca.CustomApply(t)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) DataMigration(t string) MigrateDataFunc {
+	// Nothing can be applied while replaying
+	if p.Mode == ProviderSnapshotReplay {
+		return nil
+	}
+
+	if m, ok := p.ResourceProvider.(ResourceProviderDataMigrator); ok {
+		return m.DataMigration(t)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) AttributeMigrations(t string) []AttributeMigration {
+	if m, ok := p.ResourceProvider.(ResourceProviderMigrator); ok {
+		return m.AttributeMigrations(t)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) ConcurrencyLimit() int {
+	if l, ok := p.ResourceProvider.(ResourceProviderConcurrencyLimiter); ok {
+		return l.ConcurrencyLimit()
+	}
+
+	return 0
+}
+
+func (p *snapshotResourceProvider) Prerequisites(t string) []string {
+	if r, ok := p.ResourceProvider.(ResourceProviderPrerequisiter); ok {
+		return r.Prerequisites(t)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) EnsurePrerequisite(name string) error {
+	// Nothing can be created while replaying
+	if p.Mode == ProviderSnapshotReplay {
+		return nil
+	}
+
+	if r, ok := p.ResourceProvider.(ResourceProviderPrerequisiter); ok {
+		return r.EnsurePrerequisite(name)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) ReadDataSource(
+	info *InstanceInfo,
+	c *ResourceConfig) (*InstanceState, error) {
+	if p.Mode == ProviderSnapshotReplay {
+		return nil, fmt.Errorf(
+			"%s: cannot read data sources while replaying a provider snapshot",
+			info.HumanId())
+	}
+
+	if r, ok := p.ResourceProvider.(ResourceProviderDataSourceReader); ok {
+		return r.ReadDataSource(info, c)
+	}
+
+	return nil, fmt.Errorf(
+		"%s: the provider doesn't support data sources", info.HumanId())
+}
+
+func (p *snapshotResourceProvider) DiffSuppressFuncs(t string) map[string]DiffSuppressFunc {
+	if ds, ok := p.ResourceProvider.(ResourceProviderDiffSuppressor); ok {
+		return ds.DiffSuppressFuncs(t)
+	}
+
+	return nil
+}
+
+func (p *snapshotResourceProvider) ReadSecrets(
+	info *InstanceInfo,
+	s *InstanceState) (map[string]string, error) {
+	if p.Mode == ProviderSnapshotReplay {
+		return nil, nil
+	}
+
+	if r, ok := p.ResourceProvider.(ResourceProviderSecretReader); ok {
+		return r.ReadSecrets(info, s)
+	}
+
+	return nil, nil
+}
+
+func (p *snapshotResourceProvider) EstimateCost(
+	info *InstanceInfo,
+	d *InstanceDiff) (float64, bool, error) {
+	if p.Mode == ProviderSnapshotReplay {
+		return 0, false, nil
+	}
+
+	if e, ok := p.ResourceProvider.(ResourceProviderCostEstimator); ok {
+		return e.EstimateCost(info, d)
+	}
+
+	return 0, false, nil
+}
+
+func (p *snapshotResourceProvider) Diff(
+	info *InstanceInfo,
+	s *InstanceState,
+	c *ResourceConfig) (*InstanceDiff, error) {
+	key := info.HumanId()
+	if p.Mode == ProviderSnapshotReplay {
+		p.Snapshot.lock.Lock()
+		defer p.Snapshot.lock.Unlock()
+
+		d, ok := p.Snapshot.Diff[key]
+		if !ok {
+			return nil, fmt.Errorf(
+				"%s: no diff recorded in provider snapshot", key)
+		}
+
+		return d.deepcopy(), nil
+	}
+
+	d, err := p.ResourceProvider.Diff(info, s, c)
+	if err != nil {
+		return d, err
+	}
+
+	p.Snapshot.lock.Lock()
+	p.Snapshot.Diff[key] = d.deepcopy()
+	p.Snapshot.lock.Unlock()
+
+	return d, nil
+}
+
+func (p *snapshotResourceProvider) Refresh(
+	info *InstanceInfo,
+	s *InstanceState) (*InstanceState, error) {
+	key := info.HumanId()
+	if p.Mode == ProviderSnapshotReplay {
+		p.Snapshot.lock.Lock()
+		defer p.Snapshot.lock.Unlock()
+
+		rs, ok := p.Snapshot.Refresh[key]
+		if !ok {
+			return nil, fmt.Errorf(
+				"%s: no refresh recorded in provider snapshot", key)
+		}
+
+		return rs.deepcopy(), nil
+	}
+
+	rs, err := p.ResourceProvider.Refresh(info, s)
+	if err != nil {
+		return rs, err
+	}
+
+	p.Snapshot.lock.Lock()
+	p.Snapshot.Refresh[key] = rs.deepcopy()
+	p.Snapshot.lock.Unlock()
+
+	return rs, nil
+}
+
+func (p *snapshotResourceProvider) Close() error {
+	if c, ok := p.ResourceProvider.(ResourceProviderCloser); ok {
+		return c.Close()
+	}
+
+	return nil
+}
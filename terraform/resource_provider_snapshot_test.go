@@ -0,0 +1,139 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotResourceProvider_impl(t *testing.T) {
+	var _ ResourceProvider = new(snapshotResourceProvider)
+	var _ ResourceProviderCloser = new(snapshotResourceProvider)
+	var _ ResourceProviderCustomApplier = new(snapshotResourceProvider)
+	var _ ResourceProviderDryRunner = new(snapshotResourceProvider)
+	var _ ResourceProviderMigrator = new(snapshotResourceProvider)
+	var _ ResourceProviderPrerequisiter = new(snapshotResourceProvider)
+}
+
+func TestProviderSnapshot_recordReplay(t *testing.T) {
+	m := testModule(t, "plan-good")
+	snapshot := NewProviderSnapshot()
+
+	// Record a live plan
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		ProviderSnapshot:     snapshot,
+		ProviderSnapshotMode: ProviderSnapshotRecord,
+	})
+
+	live, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(snapshot.Diff) != 2 {
+		t.Fatalf("bad: %#v", snapshot.Diff)
+	}
+
+	// Round-trip the snapshot through its serialized form
+	var buf bytes.Buffer
+	if err := WriteProviderSnapshot(snapshot, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	snapshot, err = ReadProviderSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Replay offline with a provider that can't do anything
+	p = testProvider("aws")
+	p.ConfigureReturnError = fmt.Errorf("no credentials")
+	p.DiffReturnError = fmt.Errorf("offline")
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		ProviderSnapshot:     snapshot,
+		ProviderSnapshotMode: ProviderSnapshotReplay,
+	})
+
+	offline, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.DiffCalled || p.ConfigureCalled {
+		t.Fatal("provider should not be called while replaying")
+	}
+
+	actual := strings.TrimSpace(offline.String())
+	expected := strings.TrimSpace(live.String())
+	if actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestProviderSnapshot_replayMissing(t *testing.T) {
+	p := &snapshotResourceProvider{
+		ResourceProvider: testProvider("aws"),
+		Snapshot:         NewProviderSnapshot(),
+		Mode:             ProviderSnapshotReplay,
+	}
+
+	info := &InstanceInfo{Id: "aws_instance.foo"}
+	if _, err := p.Diff(info, nil, nil); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := p.Refresh(info, nil); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestSnapshotResourceProvider_dryRunApply(t *testing.T) {
+	info := &InstanceInfo{Id: "aws_instance.foo"}
+	state := &InstanceState{ID: "foo"}
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"num": &ResourceAttrDiff{Old: "1", New: "2"},
+		},
+	}
+
+	// The dry run of the provider is used
+	var called bool
+	p := &snapshotResourceProvider{
+		ResourceProvider: &testDryRunProvider{
+			MockResourceProvider: testProvider("aws"),
+			DryRunApplyFn: func(
+				info *InstanceInfo,
+				s *InstanceState,
+				d *InstanceDiff) (*InstanceState, error) {
+				called = true
+				return &InstanceState{ID: "bar"}, nil
+			},
+		},
+		Snapshot: NewProviderSnapshot(),
+		Mode:     ProviderSnapshotRecord,
+	}
+	actual, err := p.DryRunApply(info, state, diff)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !called || actual.ID != "bar" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Without one, the state is projected from the diff
+	p.ResourceProvider = testProvider("aws")
+	actual, err = p.DryRunApply(info, state, diff)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual.ID != "foo" || actual.Attributes["num"] != "2" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -23,6 +23,15 @@ type ResourceProvisioner interface {
 	Apply(UIOutput, *InstanceState, *ResourceConfig) error
 }
 
+// ResourceProvisionerChecker is an interface that provisioners that can
+// check whether they would succeed, without changing anything, must
+// implement. Check should connect to the resource and verify everything
+// Apply needs is there, such as files to upload, and output what Apply
+// would do instead of doing it.
+type ResourceProvisionerChecker interface {
+	Check(UIOutput, *InstanceState, *ResourceConfig) error
+}
+
 // ResourceProvisionerCloser is an interface that provisioners that can close
 // connections that aren't needed anymore must implement.
 type ResourceProvisionerCloser interface {
@@ -13,6 +13,13 @@ type MockResourceProvisioner struct {
 	ApplyFn          func(*InstanceState, *ResourceConfig) error
 	ApplyReturnError error
 
+	CheckCalled      bool
+	CheckOutput      UIOutput
+	CheckState       *InstanceState
+	CheckConfig      *ResourceConfig
+	CheckFn          func(*InstanceState, *ResourceConfig) error
+	CheckReturnError error
+
 	ValidateCalled       bool
 	ValidateConfig       *ResourceConfig
 	ValidateFn           func(c *ResourceConfig) ([]string, []error)
@@ -42,3 +49,17 @@ func (p *MockResourceProvisioner) Apply(
 	}
 	return p.ApplyReturnError
 }
+
+func (p *MockResourceProvisioner) Check(
+	output UIOutput,
+	state *InstanceState,
+	c *ResourceConfig) error {
+	p.CheckCalled = true
+	p.CheckOutput = output
+	p.CheckState = state
+	p.CheckConfig = c
+	if p.CheckFn != nil {
+		return p.CheckFn(state, c)
+	}
+	return p.CheckReturnError
+}
@@ -7,3 +7,7 @@ import (
 func TestMockResourceProvisioner_impl(t *testing.T) {
 	var _ ResourceProvisioner = new(MockResourceProvisioner)
 }
+
+func TestMockResourceProvisioner_checker(t *testing.T) {
+	var _ ResourceProvisionerChecker = new(MockResourceProvisioner)
+}
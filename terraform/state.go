@@ -110,8 +110,10 @@ func (s *State) ModuleOrphans(path []string, c *config.Config) [][]string {
 	childrenKeys := make(map[string]struct{})
 	if c != nil {
 		for _, m := range c.Modules {
-			childrenKeys[m.Name] = struct{}{}
-			direct[m.Name] = struct{}{}
+			for _, k := range moduleInstanceKeys(m) {
+				childrenKeys[k] = struct{}{}
+				direct[k] = struct{}{}
+			}
 		}
 	}
 
@@ -166,6 +168,24 @@ func (s *State) Empty() bool {
 	return len(s.Modules) == 0
 }
 
+// HasPending returns true if any resource in the state was left pending
+// by an interrupted apply. See ResourceState.Pending.
+func (s *State) HasPending() bool {
+	if s == nil {
+		return false
+	}
+
+	for _, m := range s.Modules {
+		for _, r := range m.Resources {
+			if r.Pending {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // IsRemote returns true if State represents a state that exists and is
 // remote.
 func (s *State) IsRemote() bool {
@@ -264,6 +284,32 @@ func (s *State) IncrementSerialMaybe(other *State) {
 	}
 }
 
+// replaceDataSources replaces the data sources in this state with the ones
+// in the other state, such as after a plan read them into a copy of it.
+func (s *State) replaceDataSources(other *State) {
+	for _, mod := range s.Modules {
+		for k := range mod.Resources {
+			if strings.HasPrefix(k, "data.") {
+				delete(mod.Resources, k)
+			}
+		}
+	}
+
+	for _, otherMod := range other.Modules {
+		for k, rs := range otherMod.Resources {
+			if !strings.HasPrefix(k, "data.") {
+				continue
+			}
+
+			mod := s.ModuleByPath(otherMod.Path)
+			if mod == nil {
+				mod = s.AddModule(otherMod.Path)
+			}
+			mod.Resources[k] = rs.deepcopy()
+		}
+	}
+}
+
 func (s *State) init() {
 	if s.Version == 0 {
 		s.Version = StateVersion
@@ -721,6 +767,12 @@ type ResourceState struct {
 	// e.g. "aws_instance" goes with the "aws" provider.
 	// If the resource block contained a "provider" key, that value will be set here.
 	Provider string `json:"provider,omitempty"`
+
+	// Pending is set while an apply of this resource is in progress. If
+	// it is still set when the state is next read, the apply was
+	// interrupted and the real state of the resource is unknown, so the
+	// resource should be refreshed before it is planned again.
+	Pending bool `json:"pending,omitempty"`
 }
 
 // Equal tests whether two ResourceStates are equal.
@@ -785,18 +837,67 @@ func (s *ResourceState) Equal(other *ResourceState) bool {
 }
 
 // Taint takes the primary state and marks it as tainted. If there is no
-// primary state, this does nothing.
+// primary state, this does nothing. If the primary is tainted already,
+// such as partway through recovering from a failed apply, it isn't added
+// to the taint list again.
 func (r *ResourceState) Taint() {
 	// If there is no primary, nothing to do
 	if r.Primary == nil {
 		return
 	}
 
+	for _, is := range r.Tainted {
+		if is == r.Primary || (is != nil && is.ID != "" && is.ID == r.Primary.ID) {
+			r.Primary = nil
+			return
+		}
+	}
+
 	// Shuffle to the end of the taint list and set primary to nil
 	r.Tainted = append(r.Tainted, r.Primary)
 	r.Primary = nil
 }
 
+// Untaint takes the most recently tainted instance and makes it the
+// primary again. If there are no tainted instances, this does nothing.
+// It is an error if there is a primary already.
+func (r *ResourceState) Untaint() error {
+	if len(r.Tainted) == 0 {
+		return nil
+	}
+	if r.Primary != nil {
+		return fmt.Errorf(
+			"there is a primary instance already, %q", r.Primary.ID)
+	}
+
+	idx := len(r.Tainted) - 1
+	r.Primary = r.Tainted[idx]
+	r.Tainted[idx] = nil
+	r.Tainted = r.Tainted[:idx]
+
+	return nil
+}
+
+// CleanPrimary returns the primary instance, or nil if the primary is
+// transient: it is the same instance as one that is tainted or deposed,
+// which can happen partway through recovering from a failed apply.
+// Anything that depends on the resource should only see a clean primary.
+func (r *ResourceState) CleanPrimary() *InstanceState {
+	if r.Primary == nil {
+		return nil
+	}
+
+	for _, list := range [][]*InstanceState{r.Tainted, r.Deposed} {
+		for _, is := range list {
+			if is == r.Primary || (is != nil && is.ID != "" && is.ID == r.Primary.ID) {
+				return nil
+			}
+		}
+	}
+
+	return r.Primary
+}
+
 func (r *ResourceState) init() {
 	if r.Primary == nil {
 		r.Primary = &InstanceState{}
@@ -815,6 +916,7 @@ func (r *ResourceState) deepcopy() *ResourceState {
 		Primary:      r.Primary.deepcopy(),
 		Tainted:      nil,
 		Provider:     r.Provider,
+		Pending:      r.Pending,
 	}
 	if r.Dependencies != nil {
 		n.Dependencies = make([]string, len(r.Dependencies))
@@ -869,6 +971,38 @@ func (r *ResourceState) sort() {
 	sort.Strings(r.Dependencies)
 }
 
+// UnmarshalJSON reads a ResourceState, including those from older states
+// where Deposed was a single instance rather than a list.
+func (r *ResourceState) UnmarshalJSON(data []byte) error {
+	// resourceState has no methods, so this doesn't recurse
+	type resourceState ResourceState
+	v := struct {
+		*resourceState
+		Deposed json.RawMessage `json:"deposed,omitempty"`
+	}{resourceState: (*resourceState)(r)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	raw := bytes.TrimSpace(v.Deposed)
+	r.Deposed = nil
+	switch {
+	case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+	case raw[0] == '{':
+		var is InstanceState
+		if err := json.Unmarshal(raw, &is); err != nil {
+			return err
+		}
+		r.Deposed = []*InstanceState{&is}
+	default:
+		if err := json.Unmarshal(raw, &r.Deposed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *ResourceState) GoString() string {
 	return fmt.Sprintf("*%#v", *s)
 }
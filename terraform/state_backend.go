@@ -0,0 +1,175 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StateBackend is implemented by things that hold the persisted copy of
+// the state, such as in S3 or Consul, so that a team shares it. See
+// ContextOpts.StateBackend.
+//
+// The walks that change the state, apply and refresh, hold the lock of
+// the backend for their whole duration, so concurrent runs can't clobber
+// each other. The state is written as it is updated during the walk, see
+// ContextOpts.StateWriteEvery, and once more when the walk ends, even if
+// it failed, so the partial state of a failed apply isn't lost. The lock
+// is released however the walk ends.
+type StateBackend interface {
+	// Read returns the stored state, or nil if there is none yet.
+	Read() (*State, error)
+
+	// Write replaces the stored state. The write must be atomic, so a
+	// failed write leaves the previous state. The state is locked while
+	// Write is called and must not be kept or modified after it returns.
+	Write(*State) error
+
+	// Lock takes the advisory lock that only one run can hold at a time,
+	// and stores the info with it so other runs can tell who holds it.
+	// If another run holds the lock already, Lock returns a
+	// *StateLockedError with the info of that lock.
+	Lock(*StateLockInfo) error
+
+	// Unlock releases the lock taken by Lock.
+	Unlock() error
+}
+
+// StateLockInfo is the metadata stored with the lock of a StateBackend.
+type StateLockInfo struct {
+	// Who is the user and host that holds the lock, as "user@host".
+	Who string
+
+	// Operation is the walk that the lock is held for, such as "apply".
+	Operation string
+
+	// Created is when the lock was taken, in UTC.
+	Created time.Time
+}
+
+func (i *StateLockInfo) String() string {
+	return fmt.Sprintf(
+		"%s for %s since %s",
+		i.Who, i.Operation, i.Created.Format(time.RFC3339))
+}
+
+// StateLockedError is returned by StateBackend.Lock when another run holds
+// the lock.
+type StateLockedError struct {
+	Info *StateLockInfo
+}
+
+func (e *StateLockedError) Error() string {
+	if e.Info == nil {
+		return "The state is locked by another run."
+	}
+
+	return fmt.Sprintf(
+		"The state is locked by %s. Another run may be using it; try "+
+			"again once it is done.",
+		e.Info)
+}
+
+// stateLockWho returns who takes the lock of the state, as "user@host".
+func stateLockWho() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "unknown"
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s", user, host)
+}
+
+// stateWriteSequence orders the writes of the copies of the state to the
+// backend during a walk. Each copy is numbered while the lock of the state
+// is held, and the copies are written one at a time, skipping those that
+// are older than the last one written, so that a newer state is never
+// overwritten by an older one whose write was slower to start. A nil
+// sequence writes every copy.
+type stateWriteSequence struct {
+	lock    sync.Mutex
+	next    uint64
+	written uint64
+}
+
+// Next returns the number of the copy of the state being made. It must be
+// called while the lock of the state is held, with the copy.
+func (s *stateWriteSequence) Next() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.AddUint64(&s.next, 1)
+}
+
+// Write writes the copy of the state with the number to the backend,
+// unless a newer copy has been written already.
+func (s *stateWriteSequence) Write(b StateBackend, seq uint64, state *State) error {
+	if s == nil {
+		return b.Write(state)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if seq <= s.written {
+		log.Printf("[DEBUG] Skipping the write of state copy %d, copy %d "+
+			"is written already", seq, s.written)
+		return nil
+	}
+
+	if err := b.Write(state); err != nil {
+		return err
+	}
+
+	s.written = seq
+	return nil
+}
+
+// stateWriteThrottle throttles the writes of the state to the backend
+// while it is updated during a walk. A write is due after Every updates
+// of the state or once Interval has passed since the last write,
+// whichever comes first. If neither is set, every update is written. See
+// ContextOpts.StateWriteEvery.
+type stateWriteThrottle struct {
+	Every    int
+	Interval time.Duration
+
+	lock    sync.Mutex
+	updates int
+	last    time.Time
+}
+
+// due records an update of the state and returns true if a write is due,
+// in which case the count of updates starts over.
+func (t *stateWriteThrottle) due() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.updates++
+	if t.last.IsZero() {
+		t.last = time.Now()
+	}
+
+	due := t.Every <= 0 && t.Interval <= 0
+	if t.Every > 0 && t.updates >= t.Every {
+		due = true
+	}
+	if t.Interval > 0 && time.Since(t.last) >= t.Interval {
+		due = true
+	}
+
+	if due {
+		t.updates = 0
+		t.last = time.Now()
+	}
+
+	return due
+}
@@ -0,0 +1,112 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStateBackend is a StateBackend that stores the state in a local
+// file, so that if the process crashes during an apply or refresh, what
+// was done before the crash can be recovered from it.
+//
+// The lock is a file next to the state, with the suffix ".lock", that
+// holds the info of the lock.
+type FileStateBackend struct {
+	// Path is the file the state is stored in. The state is written to a
+	// temporary file next to it that is renamed over it, so if the
+	// process is killed while writing, the previous state is left intact.
+	Path string
+
+	lock sync.Mutex
+}
+
+func (b *FileStateBackend) Read() (*State, error) {
+	f, err := os.Open(b.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadState(f)
+}
+
+func (b *FileStateBackend) Write(s *State) error {
+	var buf bytes.Buffer
+	if err := WriteState(s, &buf); err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	dir, name := filepath.Split(b.Path)
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), b.Path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (b *FileStateBackend) Lock(info *StateLockInfo) error {
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(b.lockPath(), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if !os.IsExist(err) {
+			return err
+		}
+
+		// Someone else holds the lock, tell who if we can
+		var held StateLockInfo
+		data, rerr := ioutil.ReadFile(b.lockPath())
+		if rerr != nil || json.Unmarshal(data, &held) != nil {
+			return &StateLockedError{}
+		}
+
+		return &StateLockedError{Info: &held}
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(info)
+}
+
+func (b *FileStateBackend) Unlock() error {
+	return os.Remove(b.lockPath())
+}
+
+func (b *FileStateBackend) lockPath() string {
+	return b.Path + ".lock"
+}
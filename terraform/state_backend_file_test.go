@@ -0,0 +1,82 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStateBackend_impl(t *testing.T) {
+	var _ StateBackend = new(FileStateBackend)
+}
+
+func TestFileStateBackend(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := &FileStateBackend{Path: filepath.Join(dir, "terraform.tfstate")}
+	actual, err := b.Read()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if err := b.Write(&State{Serial: 1}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := b.Write(&State{Serial: 2}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err = b.Read()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual.Serial != 2 {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The temporary files are renamed over the state
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp*"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(matches) > 0 {
+		t.Fatalf("bad: %#v", matches)
+	}
+}
+
+func TestFileStateBackendLock(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := &FileStateBackend{Path: filepath.Join(dir, "terraform.tfstate")}
+	info := &StateLockInfo{
+		Who:       "foo@bar",
+		Operation: "apply",
+		Created:   time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := b.Lock(info); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := b.Lock(&StateLockInfo{Who: "baz@bar"})
+	lerr, ok := err.(*StateLockedError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !reflect.DeepEqual(lerr.Info, info) {
+		t.Fatalf("bad: %#v", lerr.Info)
+	}
+
+	if err := b.Unlock(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := b.Lock(info); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
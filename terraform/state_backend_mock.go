@@ -0,0 +1,70 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// MockStateBackend is an implementation of StateBackend that can be used
+// for tests.
+type MockStateBackend struct {
+	lock sync.Mutex
+
+	ReadCalled bool
+	ReadError  error
+
+	WriteCalled int
+	WriteError  error
+
+	LockCalled bool
+	LockInfo   *StateLockInfo
+	LockError  error
+
+	UnlockCalled bool
+	UnlockError  error
+
+	// State is the state that Read returns. Write replaces it with a
+	// copy of the state it is given.
+	State *State
+}
+
+func (b *MockStateBackend) Read() (*State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.ReadCalled = true
+	if b.ReadError != nil {
+		return nil, b.ReadError
+	}
+
+	return b.State.DeepCopy(), nil
+}
+
+func (b *MockStateBackend) Write(s *State) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.WriteCalled++
+	if b.WriteError != nil {
+		return b.WriteError
+	}
+
+	b.State = s.DeepCopy()
+	return nil
+}
+
+func (b *MockStateBackend) Lock(info *StateLockInfo) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.LockCalled = true
+	b.LockInfo = info
+	return b.LockError
+}
+
+func (b *MockStateBackend) Unlock() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.UnlockCalled = true
+	return b.UnlockError
+}
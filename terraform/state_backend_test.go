@@ -0,0 +1,113 @@
+package terraform
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateLockedError(t *testing.T) {
+	cases := []struct {
+		Info     *StateLockInfo
+		Expected string
+	}{
+		{
+			nil,
+			"The state is locked by another run.",
+		},
+		{
+			&StateLockInfo{
+				Who:       "alice@ci",
+				Operation: "refresh",
+				Created:   time.Date(2015, 9, 1, 12, 0, 0, 0, time.UTC),
+			},
+			"The state is locked by alice@ci for refresh since " +
+				"2015-09-01T12:00:00Z. Another run may be using it; try " +
+				"again once it is done.",
+		},
+	}
+
+	for i, tc := range cases {
+		err := &StateLockedError{Info: tc.Info}
+		if actual := err.Error(); actual != tc.Expected {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+	}
+}
+
+func TestStateWriteSequence(t *testing.T) {
+	b := new(MockStateBackend)
+	seq := new(stateWriteSequence)
+
+	// The newer copy is written first, so the older one is skipped
+	older := seq.Next()
+	newer := seq.Next()
+	if err := seq.Write(b, newer, &State{Serial: 2}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := seq.Write(b, older, &State{Serial: 1}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 1 || b.State.Serial != 2 {
+		t.Fatalf("bad: %#v", b)
+	}
+
+	if err := seq.Write(b, seq.Next(), &State{Serial: 3}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 2 || b.State.Serial != 3 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestStateWriteSequence_failed(t *testing.T) {
+	b := &MockStateBackend{WriteError: errors.New("boom")}
+	seq := new(stateWriteSequence)
+
+	// A copy that failed to write doesn't keep the older ones out
+	older := seq.Next()
+	if err := seq.Write(b, seq.Next(), &State{Serial: 2}); err == nil {
+		t.Fatal("should error")
+	}
+
+	b.WriteError = nil
+	if err := seq.Write(b, older, &State{Serial: 1}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b.WriteCalled != 2 || b.State.Serial != 1 {
+		t.Fatalf("bad: %#v", b)
+	}
+}
+
+func TestStateWriteThrottleDue(t *testing.T) {
+	th := new(stateWriteThrottle)
+	for i := 0; i < 3; i++ {
+		if !th.due() {
+			t.Fatalf("%d: should be due", i)
+		}
+	}
+}
+
+func TestStateWriteThrottleDue_every(t *testing.T) {
+	th := &stateWriteThrottle{Every: 3}
+	for i := 1; i <= 6; i++ {
+		if due := th.due(); due != (i%3 == 0) {
+			t.Fatalf("%d: bad: %#v", i, due)
+		}
+	}
+}
+
+func TestStateWriteThrottleDue_interval(t *testing.T) {
+	th := &stateWriteThrottle{Interval: 50 * time.Millisecond}
+	if th.due() {
+		t.Fatal("shouldn't be due")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !th.due() {
+		t.Fatal("should be due")
+	}
+	if th.due() {
+		t.Fatal("shouldn't be due")
+	}
+}
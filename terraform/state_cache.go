@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// StateReadCache caches the instances read from the state during a walk,
+// so that reading the same resource again, such as for each of the many
+// resources that depend on it, doesn't take the state lock again.
+//
+// The entry for a resource must be invalidated whenever the resource is
+// written. Both reads that fill the cache and writes that invalidate it
+// must hold the state lock, so that a read after a write sees the written
+// value. The methods are safe to call on a nil cache, which caches nothing.
+type StateReadCache struct {
+	lock    sync.Mutex
+	entries map[string]map[string]*InstanceState
+}
+
+// Get returns the instance cached for the resource with the given name in
+// the module at path. Kind distinguishes the different reads of the same
+// resource, such as of the primary and of the clean primary.
+func (c *StateReadCache) Get(
+	path []string, name, kind string) (*InstanceState, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	is, ok := c.entries[c.key(path, name)][kind]
+	return is, ok
+}
+
+// Put caches the instance read for the resource. See Get.
+func (c *StateReadCache) Put(
+	path []string, name, kind string, is *InstanceState) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]map[string]*InstanceState)
+	}
+
+	key := c.key(path, name)
+	if c.entries[key] == nil {
+		c.entries[key] = make(map[string]*InstanceState)
+	}
+	c.entries[key][kind] = is
+}
+
+// Invalidate removes everything cached for the resource.
+func (c *StateReadCache) Invalidate(path []string, name string) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, c.key(path, name))
+}
+
+// Reset removes everything from the cache, such as when the whole state
+// is replaced.
+func (c *StateReadCache) Reset() {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = nil
+}
+
+func (c *StateReadCache) key(path []string, name string) string {
+	return PathCacheKey(path) + "|" + name
+}
@@ -0,0 +1,53 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestStateReadCache(t *testing.T) {
+	c := new(StateReadCache)
+	is := &InstanceState{ID: "foo"}
+
+	if _, ok := c.Get(rootModulePath, "aws_instance.foo", "primary"); ok {
+		t.Fatal("should not be cached")
+	}
+
+	c.Put(rootModulePath, "aws_instance.foo", "primary", is)
+	c.Put(rootModulePath, "aws_instance.foo", "clean", nil)
+	if actual, ok := c.Get(rootModulePath, "aws_instance.foo", "primary"); !ok || actual != is {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual, ok := c.Get(rootModulePath, "aws_instance.foo", "clean"); !ok || actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Other modules are cached separately
+	child := []string{"root", "child"}
+	if _, ok := c.Get(child, "aws_instance.foo", "primary"); ok {
+		t.Fatal("should not be cached")
+	}
+
+	c.Invalidate(rootModulePath, "aws_instance.foo")
+	if _, ok := c.Get(rootModulePath, "aws_instance.foo", "primary"); ok {
+		t.Fatal("should not be cached")
+	}
+	if _, ok := c.Get(rootModulePath, "aws_instance.foo", "clean"); ok {
+		t.Fatal("should not be cached")
+	}
+
+	c.Put(rootModulePath, "aws_instance.foo", "primary", is)
+	c.Reset()
+	if _, ok := c.Get(rootModulePath, "aws_instance.foo", "primary"); ok {
+		t.Fatal("should not be cached")
+	}
+}
+
+func TestStateReadCache_nil(t *testing.T) {
+	var c *StateReadCache
+	c.Put(rootModulePath, "aws_instance.foo", "primary", &InstanceState{})
+	if _, ok := c.Get(rootModulePath, "aws_instance.foo", "primary"); ok {
+		t.Fatal("should not be cached")
+	}
+	c.Invalidate(rootModulePath, "aws_instance.foo")
+	c.Reset()
+}
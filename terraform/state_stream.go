@@ -0,0 +1,119 @@
+package terraform
+
+import (
+	"log"
+)
+
+// StateStream is the interface that must be implemented to receive an
+// event for every write of an instance to the state, such as to keep a
+// live mirror of the state in an inventory. See ContextOpts.StateStream.
+//
+// Unlike the audit log, which records the changes that were applied, the
+// stream sees every write, including the intermediate ones such as a
+// refresh or the pending state written before an apply. The events of a
+// state are sent in the order the writes were made.
+type StateStream interface {
+	// WriteStateEvent sends a single event. It is called while the state
+	// is locked, so it should be quick. An error is logged, but doesn't
+	// fail the write: the state is already written.
+	WriteStateEvent(*StateEvent) error
+}
+
+const (
+	StateEventCreate = "create"
+	StateEventUpdate = "update"
+	StateEventDelete = "delete"
+)
+
+const (
+	StateEventPrimary = "primary"
+	StateEventTainted = "tainted"
+	StateEventDeposed = "deposed"
+)
+
+// StateEvent is a single write of an instance of a resource to the state.
+type StateEvent struct {
+	// Path is the path of the module of the resource, such as
+	// ["root", "foo"].
+	Path []string
+
+	// Address is the address of the resource, such as
+	// "module.foo.aws_instance.bar.0".
+	Address string
+
+	// Operation is StateEventCreate if there was no instance before,
+	// StateEventDelete if there is no instance after, and otherwise
+	// StateEventUpdate.
+	Operation string
+
+	// Kind is the kind of instance that was written: StateEventPrimary,
+	// StateEventTainted or StateEventDeposed. An instance that becomes
+	// another kind, such as the primary once it is deposed, is a delete
+	// of the one kind and a create of the other.
+	Kind string
+
+	// Old and New are the instance before and after the write: Old is
+	// the instance as it was in the state when it was written over. Old
+	// is nil on create, and New is nil on delete. They are copies, so
+	// they may be kept.
+	Old *InstanceState
+	New *InstanceState
+
+	// Pending is whether the resource has an apply in progress after the
+	// write. See ResourceState.Pending.
+	Pending bool
+}
+
+// newStateEvent returns the event of a write that replaced the instance
+// of the given kind before with after, or nil if neither is an instance.
+func newStateEvent(
+	path []string, name, kind string,
+	before, after *InstanceState, pending bool) *StateEvent {
+	if before != nil && before.ID == "" {
+		before = nil
+	}
+	if after != nil && after.ID == "" {
+		after = nil
+	}
+
+	op := StateEventUpdate
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		op = StateEventCreate
+	case after == nil:
+		op = StateEventDelete
+	}
+
+	addr := name
+	if prefix := modulePrefixStr(path); prefix != "" {
+		addr = prefix + "." + addr
+	}
+
+	result := &StateEvent{
+		Path:      make([]string, len(path)),
+		Address:   addr,
+		Operation: op,
+		Kind:      kind,
+		Old:       before.deepcopy(),
+		New:       after.deepcopy(),
+		Pending:   pending,
+	}
+	copy(result.Path, path)
+
+	return result
+}
+
+// writeStateEvent sends the event to the stream, logging an error.
+func writeStateEvent(s StateStream, e *StateEvent) {
+	if s == nil || e == nil {
+		return
+	}
+
+	if err := s.WriteStateEvent(e); err != nil {
+		log.Printf(
+			"[WARN] Error writing %s state event for %s: %s",
+			e.Operation, e.Address, err)
+	}
+}
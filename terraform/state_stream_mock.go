@@ -0,0 +1,30 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// MockStateStream is an implementation of StateStream that can be used for
+// tests.
+type MockStateStream struct {
+	lock sync.Mutex
+
+	WriteStateEventCalled int
+	WriteStateEventError  error
+
+	// Events are the events that were sent.
+	Events []*StateEvent
+}
+
+func (s *MockStateStream) WriteStateEvent(e *StateEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.WriteStateEventCalled++
+	if s.WriteStateEventError != nil {
+		return s.WriteStateEventError
+	}
+
+	s.Events = append(s.Events, e)
+	return nil
+}
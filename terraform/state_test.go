@@ -85,6 +85,39 @@ func TestStateModuleOrphans(t *testing.T) {
 	}
 }
 
+func TestStateModuleOrphans_count(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+			},
+			&ModuleState{
+				Path: []string{RootModuleName, "child"},
+			},
+			&ModuleState{
+				Path: []string{RootModuleName, "child[0]"},
+			},
+			&ModuleState{
+				Path: []string{RootModuleName, "child[3]"},
+			},
+			&ModuleState{
+				Path: []string{RootModuleName, "other"},
+			},
+		},
+	}
+
+	config := testModule(t, "transform-module-count").Config()
+	actual := state.ModuleOrphans(RootModulePath, config)
+	expected := [][]string{
+		[]string{RootModuleName, "child"},
+		[]string{RootModuleName, "child[3]"},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
 func TestStateModuleOrphans_nested(t *testing.T) {
 	state := &State{
 		Modules: []*ModuleState{
@@ -376,6 +409,20 @@ func TestResourceStateTaint(t *testing.T) {
 				},
 			},
 		},
+
+		"primary, tainted already": {
+			&ResourceState{
+				Primary: &InstanceState{ID: "foo"},
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "foo"},
+				},
+			},
+			&ResourceState{
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "foo"},
+				},
+			},
+		},
 	}
 
 	for k, tc := range cases {
@@ -388,6 +435,118 @@ func TestResourceStateTaint(t *testing.T) {
 	}
 }
 
+func TestResourceStateUntaint(t *testing.T) {
+	cases := map[string]struct {
+		Input  *ResourceState
+		Output *ResourceState
+		Err    bool
+	}{
+		"no tainted": {
+			&ResourceState{
+				Primary: &InstanceState{ID: "foo"},
+			},
+			&ResourceState{
+				Primary: &InstanceState{ID: "foo"},
+			},
+			false,
+		},
+
+		"tainted": {
+			&ResourceState{
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "bar"},
+					&InstanceState{ID: "foo"},
+				},
+			},
+			&ResourceState{
+				Primary: &InstanceState{ID: "foo"},
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "bar"},
+				},
+			},
+			false,
+		},
+
+		"primary, with tainted": {
+			&ResourceState{
+				Primary: &InstanceState{ID: "foo"},
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "bar"},
+				},
+			},
+			&ResourceState{
+				Primary: &InstanceState{ID: "foo"},
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "bar"},
+				},
+			},
+			true,
+		},
+	}
+
+	for k, tc := range cases {
+		err := tc.Input.Untaint()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		if !reflect.DeepEqual(tc.Input, tc.Output) {
+			t.Fatalf(
+				"Failure: %s\n\nExpected: %#v\n\nGot: %#v",
+				k, tc.Output, tc.Input)
+		}
+	}
+}
+
+func TestResourceStateCleanPrimary(t *testing.T) {
+	primary := &InstanceState{ID: "foo"}
+	cases := map[string]struct {
+		Input  *ResourceState
+		Output *InstanceState
+	}{
+		"no primary": {
+			&ResourceState{},
+			nil,
+		},
+
+		"clean primary": {
+			&ResourceState{
+				Primary: primary,
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "bar"},
+				},
+				Deposed: []*InstanceState{
+					&InstanceState{ID: "baz"},
+				},
+			},
+			primary,
+		},
+
+		"tainted primary": {
+			&ResourceState{
+				Primary: primary,
+				Tainted: []*InstanceState{
+					&InstanceState{ID: "foo"},
+				},
+			},
+			nil,
+		},
+
+		"deposed primary": {
+			&ResourceState{
+				Primary: primary,
+				Deposed: []*InstanceState{primary},
+			},
+			nil,
+		},
+	}
+
+	for k, tc := range cases {
+		if actual := tc.Input.CleanPrimary(); actual != tc.Output {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
 func TestInstanceStateEmpty(t *testing.T) {
 	cases := map[string]struct {
 		In     *InstanceState
@@ -714,6 +873,56 @@ func TestReadWriteState(t *testing.T) {
 	}
 }
 
+func TestReadState_deposedSingle(t *testing.T) {
+	// Older states have a single deposed instance rather than a list
+	src := `{
+    "version": 1,
+    "serial": 1,
+    "modules": [
+        {
+            "path": ["root"],
+            "resources": {
+                "aws_instance.foo": {
+                    "type": "aws_instance",
+                    "primary": {
+                        "id": "new"
+                    },
+                    "deposed": {
+                        "id": "old"
+                    }
+                }
+            }
+        }
+    ]
+}`
+
+	state, err := ReadState(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	if rs.Primary == nil || rs.Primary.ID != "new" {
+		t.Fatalf("bad: %#v", rs.Primary)
+	}
+	if len(rs.Deposed) != 1 || rs.Deposed[0].ID != "old" {
+		t.Fatalf("bad: %#v", rs.Deposed)
+	}
+
+	// It is written back as a list
+	var buf bytes.Buffer
+	if err := WriteState(state, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	actual, err := ReadState(&buf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, state) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
 func TestReadStateNewVersion(t *testing.T) {
 	type out struct {
 		Version int
@@ -128,6 +128,38 @@ func (h *HookRecordApplyOrder) PreApply(
 	return HookActionContinue, nil
 }
 
+// testProvisionOutputHook is a test hook that records the output of the
+// provisioners, each message prefixed with its instance and provisioner.
+type testProvisionOutputHook struct {
+	NilHook
+
+	Lines []string
+
+	l sync.Mutex
+}
+
+func (h *testProvisionOutputHook) ProvisionOutput(
+	info *InstanceInfo, provId string, msg string) {
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	h.Lines = append(h.Lines, fmt.Sprintf("%s (%s): %s", info.Id, provId, msg))
+}
+
+// testOutputProvisioner is a MockResourceProvisioner that outputs Output
+// every time it's applied.
+type testOutputProvisioner struct {
+	*MockResourceProvisioner
+
+	Output string
+}
+
+func (p *testOutputProvisioner) Apply(
+	output UIOutput, state *InstanceState, c *ResourceConfig) error {
+	output.Output(p.Output)
+	return nil
+}
+
 // Below are all the constant strings that are the expected output for
 // various tests.
 
@@ -416,6 +448,51 @@ aws_instance.foo:
   type = aws_instance
 `
 
+const testTerraformApplyDataSourceStr = `
+aws_instance.foo:
+  ID = foo
+  ami = ami-123
+  type = aws_instance
+
+  Dependencies:
+    data.aws_ami.foo
+data.aws_ami.foo:
+  ID = ami-123
+`
+
+const testTerraformApplyDataSourceComputedStr = `
+aws_instance.bar:
+  ID = foo
+  ami = ami-123
+  type = aws_instance
+
+  Dependencies:
+    data.aws_ami.foo
+aws_instance.foo:
+  ID = foo
+  ami_name = ubuntu
+  num = 2
+  type = aws_instance
+data.aws_ami.foo:
+  ID = ami-123
+
+  Dependencies:
+    aws_instance.foo
+`
+
+const testTerraformApplyDryRunStr = `
+aws_instance.bar:
+  ID = 74D93920-ED26-11E3-AC10-0800200C9A66
+
+  Dependencies:
+    aws_instance.foo
+aws_instance.foo:
+  ID = 74D93920-ED26-11E3-AC10-0800200C9A66
+  dynamical = computed_dynamical
+  num = 2
+  type = aws_instance
+`
+
 const testTerraformApplyProvisionerFailStr = `
 aws_instance.bar: (1 tainted)
   ID = <not created>
@@ -803,6 +880,20 @@ STATE:
 <no state>
 `
 
+const testTerraformPlanCountZeroTargetedStr = `
+DIFF:
+
+DESTROY: aws_instance.foo
+DESTROY: aws_instance.foo.1
+
+STATE:
+
+aws_instance.foo:
+  ID = bar
+aws_instance.foo.1:
+  ID = baz
+`
+
 const testTerraformPlanCountZeroStr = `
 DIFF:
 
@@ -836,6 +927,39 @@ STATE:
 <no state>
 `
 
+const testTerraformPlanCountModuleVarStr = `
+DIFF:
+
+CREATE: aws_instance.foo.0
+  foo:  "" => "foo"
+  type: "" => "aws_instance"
+CREATE: aws_instance.foo.1
+  foo:  "" => "foo"
+  type: "" => "aws_instance"
+
+STATE:
+
+<no state>
+`
+
+const testTerraformPlanCountResourceVarStr = `
+DIFF:
+
+CREATE: aws_instance.bar.0
+  foo:  "" => "bar"
+  type: "" => "aws_instance"
+CREATE: aws_instance.bar.1
+  foo:  "" => "bar"
+  type: "" => "aws_instance"
+CREATE: aws_instance.foo
+  num:  "" => "2"
+  type: "" => "aws_instance"
+
+STATE:
+
+<no state>
+`
+
 const testTerraformPlanCountDecreaseStr = `
 DIFF:
 
@@ -1286,3 +1410,64 @@ STATE:
 
 <no state>
 `
+
+const testTerraformPlanBaselineStr = `
+CREATE: aws_instance.bar
+  foo:  "" => "2"
+  type: "" => "aws_instance"
+DESTROY: aws_instance.baz
+`
+
+const testTerraformPlanDataSourceComputedStr = `
+DIFF:
+
+CREATE: aws_instance.bar
+  ami:  "" => "<computed>"
+  type: "" => "aws_instance"
+CREATE: aws_instance.foo
+  ami_name: "" => "<computed>"
+  num:      "" => "2"
+  type:     "" => "aws_instance"
+
+STATE:
+
+data.aws_ami.foo:
+  ID = 74D93920-ED26-11E3-AC10-0800200C9A66
+
+  Dependencies:
+    aws_instance.foo
+`
+
+const testTerraformPlanDataSourceStr = `
+DIFF:
+
+CREATE: aws_instance.foo
+  ami:  "" => "ami-123"
+  type: "" => "aws_instance"
+
+STATE:
+
+data.aws_ami.foo:
+  ID = ami-123
+`
+
+const testTerraformApplyChangeWindowDependentStr = `
+aws_instance.bar:
+  ID = foo
+  foo = 2
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo
+aws_instance.baz:
+  ID = foo
+  foo = 2
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.bar
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+`
@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    count = 3
+    require_new = "yes"
+    lifecycle {
+        canary = true
+    }
+}
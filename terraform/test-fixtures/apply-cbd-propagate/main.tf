@@ -0,0 +1,9 @@
+resource "aws_instance" "lc" {
+    require_new = "new"
+    lifecycle { create_before_destroy = true }
+}
+
+resource "aws_instance" "asg" {
+    require_new = "new"
+    lc = "${aws_instance.lc.require_new}"
+}
@@ -0,0 +1,15 @@
+resource "aws_instance" "foo" {
+    num = "2"
+
+    lifecycle {
+        change_window = "02:00-04:00"
+    }
+}
+
+resource "aws_instance" "bar" {
+    foo = "${aws_instance.foo.num}"
+}
+
+resource "aws_instance" "baz" {
+    foo = "${aws_instance.bar.foo}"
+}
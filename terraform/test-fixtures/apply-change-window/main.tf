@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+    num = "2"
+
+    lifecycle {
+        change_window = "02:00-04:00"
+    }
+}
+
+resource "aws_instance" "bar" {
+    foo = "bar"
+}
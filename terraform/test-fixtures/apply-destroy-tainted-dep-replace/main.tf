@@ -0,0 +1,8 @@
+resource "aws_instance" "sg" {
+    require_new = "new"
+}
+
+resource "aws_instance" "web" {
+    require_new = "new"
+    foo = "${aws_instance.sg.id}"
+}
@@ -0,0 +1,16 @@
+resource "aws_instance" "foo" {
+    foo = "new"
+    require_new = "yes"
+
+    lifecycle {
+        ignore_changes = ["*"]
+    }
+}
+
+resource "aws_instance" "bar" {
+    foo = "new"
+
+    lifecycle {
+        ignore_changes = ["*"]
+    }
+}
@@ -0,0 +1,16 @@
+resource "aws_instance" "foo" {
+    require_new = "yes"
+
+    lifecycle {
+        ignore_changes = ["require_new", "type"]
+    }
+}
+
+resource "aws_instance" "bar" {
+    foo = "new"
+    require_new = "yes"
+
+    lifecycle {
+        ignore_changes = ["require_new"]
+    }
+}
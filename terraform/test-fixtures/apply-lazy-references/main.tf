@@ -0,0 +1,11 @@
+resource "aws_instance" "web" {
+    value = "${aws_instance.db.value}"
+
+    lifecycle {
+        lazy_references = ["aws_instance.db"]
+    }
+}
+
+resource "aws_instance" "db" {
+    value = "db"
+}
@@ -0,0 +1,12 @@
+resource "aws_instance" "bar" {
+    require_new = "xyz"
+
+    provisioner "shell" {
+        command = "check ${self.id}"
+        when = "migrate"
+    }
+
+    lifecycle {
+        create_before_destroy = true
+    }
+}
@@ -0,0 +1,9 @@
+variable "n" {
+    default = "1"
+}
+
+module "child" {
+    source = "./child"
+    count = "${var.n}"
+    value = "child-${count.index}"
+}
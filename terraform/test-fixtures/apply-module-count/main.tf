@@ -0,0 +1,5 @@
+module "child" {
+    source = "./child"
+    count = 2
+    value = "child-${count.index}"
+}
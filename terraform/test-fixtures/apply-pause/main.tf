@@ -0,0 +1,11 @@
+resource "aws_instance" "db" {
+    num = "2"
+
+    lifecycle {
+        pause_after = "Run the database migration"
+    }
+}
+
+resource "aws_instance" "web" {
+    depends_on = ["aws_instance.db"]
+}
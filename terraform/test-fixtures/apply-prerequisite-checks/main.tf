@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+    num = "2"
+}
+
+resource "aws_instance" "bar" {
+    zone = "example.com"
+
+    lifecycle {
+        prerequisite_checks = ["dns"]
+    }
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    require_new = "yes"
+
+    lifecycle {
+        create_before_destroy = true
+        prevent_destroy = true
+    }
+}
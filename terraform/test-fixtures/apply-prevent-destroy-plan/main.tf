@@ -0,0 +1,3 @@
+resource "aws_instance" "foo" {
+    require_new = "yes"
+}
@@ -0,0 +1,18 @@
+resource "aws_instance" "foo" {
+    foo = "bar"
+
+    provisioner "shell" {
+        command = "create"
+    }
+
+    provisioner "shell" {
+        command = "drain ${self.foo}"
+        when = "destroy"
+    }
+
+    provisioner "shell" {
+        command = "notify"
+        when = "destroy"
+        on_failure = "continue"
+    }
+}
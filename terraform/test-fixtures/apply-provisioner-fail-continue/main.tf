@@ -0,0 +1,12 @@
+resource "aws_instance" "foo" {
+    foo = "bar"
+
+    provisioner "shell" {
+        command = "notify"
+        on_failure = "continue"
+    }
+
+    provisioner "shell" {
+        command = "configure"
+    }
+}
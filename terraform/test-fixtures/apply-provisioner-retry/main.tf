@@ -0,0 +1,15 @@
+resource "aws_instance" "foo" {
+    provisioner "shell" {
+        command = "retried"
+
+        retry {
+            max_attempts = 3
+            delay = "1ms"
+            backoff = 2
+        }
+    }
+
+    provisioner "shell" {
+        command = "once"
+    }
+}
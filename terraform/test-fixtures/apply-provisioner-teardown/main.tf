@@ -0,0 +1,29 @@
+resource "aws_instance" "bar" {
+    provisioner "shell" {
+        command = "one"
+
+        teardown "shell" {
+            command = "undo-one"
+        }
+    }
+
+    provisioner "shell" {
+        command = "two"
+
+        teardown "shell" {
+            command = "undo-two"
+        }
+    }
+
+    provisioner "shell" {
+        command = "three"
+    }
+
+    provisioner "shell" {
+        command = "four"
+
+        teardown "shell" {
+            command = "undo-four"
+        }
+    }
+}
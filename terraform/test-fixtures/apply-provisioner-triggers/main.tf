@@ -0,0 +1,13 @@
+variable "version" {}
+
+resource "aws_instance" "foo" {
+    foo = "bar"
+
+    provisioner "shell" {
+        command = "deploy"
+
+        triggers {
+            version = "${var.version}"
+        }
+    }
+}
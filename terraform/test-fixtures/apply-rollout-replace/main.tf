@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    count = 4
+    require_new = "yes"
+
+    lifecycle {
+        rollout_percent = 50
+    }
+}
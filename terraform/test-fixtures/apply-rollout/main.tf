@@ -0,0 +1,9 @@
+resource "aws_instance" "foo" {
+    count = 4
+    foo = "bar"
+
+    lifecycle {
+        rollout_percent = 50
+        rollout_pause = "verify"
+    }
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    error = "true"
+}
+
+resource "aws_instance" "bar" {
+    num = "2"
+    soft_depends_on = ["aws_instance.foo"]
+}
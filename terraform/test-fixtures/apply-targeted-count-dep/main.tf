@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+  count = 2
+  num = "2"
+}
+
+resource "aws_instance" "bar" {
+  count = 3
+  foo = "${aws_instance.foo.0.num}"
+}
+
+resource "aws_instance" "baz" {}
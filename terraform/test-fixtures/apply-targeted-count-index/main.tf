@@ -0,0 +1,15 @@
+resource "aws_instance" "foo" {
+  count = 2
+  num = "2"
+}
+
+resource "aws_instance" "web" {
+  count = 3
+  foo = "${aws_instance.foo.0.num}"
+}
+
+resource "aws_instance" "db" {
+  foo = "${aws_instance.web.2.foo}"
+}
+
+resource "aws_instance" "baz" {}
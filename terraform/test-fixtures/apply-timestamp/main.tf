@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    value = "${timestamp()}"
+}
+
+resource "aws_instance" "bar" {
+    value = "${timestamp()}"
+}
@@ -0,0 +1,13 @@
+provider "aws" {}
+
+resource "aws_instance" "web" {
+    db = "${aws_instance.db.id}"
+
+    lifecycle {
+        lazy_references = ["aws_instance.db"]
+    }
+}
+
+resource "aws_instance" "db" {
+    web = "${aws_instance.web.id}"
+}
@@ -0,0 +1,13 @@
+resource "aws_instance" "foo" {
+    num = "2"
+    compute = "foo"
+}
+
+resource "aws_instance" "bar" {
+    foo = "${aws_instance.foo.foo}"
+    num = "${aws_instance.foo.num}"
+    tags {
+        Name = "bar-${aws_instance.foo.foo}"
+        Owner = "me"
+    }
+}
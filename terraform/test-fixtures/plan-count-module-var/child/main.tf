@@ -0,0 +1,3 @@
+output "num" {
+    value = "2"
+}
@@ -0,0 +1,8 @@
+module "child" {
+    source = "./child"
+}
+
+resource "aws_instance" "foo" {
+    count = "${module.child.num}"
+    foo = "foo"
+}
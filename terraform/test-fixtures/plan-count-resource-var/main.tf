@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    num = "2"
+}
+
+resource "aws_instance" "bar" {
+    count = "${aws_instance.foo.num}"
+    foo = "bar"
+}
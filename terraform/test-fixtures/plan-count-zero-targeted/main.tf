@@ -0,0 +1,4 @@
+resource "aws_instance" "foo" {
+    count = 0
+    foo = "foo"
+}
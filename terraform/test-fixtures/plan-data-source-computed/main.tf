@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    num = "2"
+    compute = "ami_name"
+}
+
+data "aws_ami" "foo" {
+    name = "${aws_instance.foo.ami_name}"
+}
@@ -0,0 +1,7 @@
+data "aws_ami" "foo" {
+    name = "ubuntu"
+}
+
+resource "aws_instance" "foo" {
+    ami = "${data.aws_ami.foo.id}"
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    count = 2
+
+    lifecycle {
+        prevent_destroy = true
+    }
+}
@@ -0,0 +1,3 @@
+resource "aws_instance" "foo" {
+    foo = "${random(1, 1000000)}"
+}
@@ -0,0 +1,11 @@
+resource "aws_ami" "web" {
+    foo = "new"
+}
+
+resource "aws_instance" "web" {
+    foo = "bar"
+
+    lifecycle {
+        replace_triggered_by = ["aws_ami.web"]
+    }
+}
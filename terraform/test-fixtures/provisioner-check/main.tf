@@ -0,0 +1,11 @@
+resource "aws_instance" "web" {
+    provisioner "shell" {
+        source = "${self.id}.sh"
+    }
+}
+
+resource "aws_instance" "db" {
+    provisioner "shell" {
+        source = "db.sh"
+    }
+}
@@ -0,0 +1,9 @@
+terraform {
+    required_version = ">= 0.6.0"
+}
+
+resource "aws_instance" "web" {}
+
+module "child" {
+    source = "./child"
+}
@@ -0,0 +1,13 @@
+resource "aws_lc" "foo" {
+    lifecycle { create_before_destroy = true }
+}
+
+resource "aws_autoscale" "bar" {
+    lc = "${aws_lc.foo.id}"
+}
+
+resource "aws_elb" "baz" {
+    group = "${aws_autoscale.bar.id}"
+}
+
+resource "aws_instance" "other" {}
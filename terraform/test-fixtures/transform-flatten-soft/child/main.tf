@@ -0,0 +1,8 @@
+resource "aws_instance" "a" {
+    value = "foo"
+}
+
+resource "aws_instance" "b" {
+    value = "bar"
+    soft_depends_on = ["aws_instance.a"]
+}
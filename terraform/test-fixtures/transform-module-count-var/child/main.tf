@@ -0,0 +1,6 @@
+variable "n" {}
+
+module "grandchild" {
+    source = "./grandchild"
+    count = "${var.n}"
+}
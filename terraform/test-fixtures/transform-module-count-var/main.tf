@@ -0,0 +1,7 @@
+variable "n" {}
+
+module "child" {
+    source = "./child"
+    count = "${var.n}"
+    n = "${var.n}"
+}
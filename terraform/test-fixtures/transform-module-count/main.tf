@@ -0,0 +1,11 @@
+variable "foo" {}
+
+module "child" {
+    source = "./child"
+    count = 3
+    value = "${var.foo}"
+}
+
+module "other" {
+    source = "./child"
+}
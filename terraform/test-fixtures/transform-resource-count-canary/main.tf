@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    count = 3
+    lifecycle {
+        canary = true
+        canary_index = 1
+    }
+}
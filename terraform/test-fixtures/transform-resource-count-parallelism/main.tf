@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    count = 5
+
+    lifecycle {
+        parallelism = 2
+    }
+}
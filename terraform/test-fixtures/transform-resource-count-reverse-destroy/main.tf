@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    count = 3
+
+    lifecycle {
+        reverse_destroy = true
+    }
+}
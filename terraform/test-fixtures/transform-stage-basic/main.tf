@@ -0,0 +1,26 @@
+terraform {
+    stages = ["network", "data", "app"]
+}
+
+resource "aws_vpc" "net" {
+    lifecycle { stage = "network" }
+}
+
+resource "aws_subnet" "net" {
+    vpc = "${aws_vpc.net.id}"
+    lifecycle { stage = "network" }
+}
+
+resource "aws_db_instance" "data" {
+    subnet = "${aws_subnet.net.id}"
+    lifecycle { stage = "data" }
+}
+
+resource "aws_instance" "app" {
+    db = "${aws_db_instance.data.id}"
+    lifecycle { stage = "app" }
+}
+
+resource "aws_instance" "worker" {
+    lifecycle { stage = "app" }
+}
@@ -0,0 +1,21 @@
+terraform {
+    stages = ["one", "two"]
+}
+
+resource "aws_instance" "A" {
+    lifecycle { stage = "one" }
+}
+
+resource "aws_instance" "B" {
+    foo = "${aws_instance.A.id}"
+    lifecycle { stage = "two" }
+}
+
+resource "aws_instance" "C" {
+    lifecycle { stage = "two" }
+}
+
+resource "aws_instance" "D" {
+    foo = "${aws_instance.C.id}"
+    lifecycle { stage = "one" }
+}
@@ -0,0 +1,17 @@
+terraform {
+    stages = ["first", "empty", "second", "third"]
+}
+
+resource "aws_instance" "third" {
+    lifecycle { stage = "third" }
+}
+
+resource "aws_instance" "second" {
+    lifecycle { stage = "second" }
+}
+
+resource "aws_instance" "first" {
+    lifecycle { stage = "first" }
+}
+
+resource "aws_instance" "unstaged" {}
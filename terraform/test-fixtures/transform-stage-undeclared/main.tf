@@ -0,0 +1,7 @@
+terraform {
+    stages = ["one"]
+}
+
+resource "aws_instance" "A" {
+    lifecycle { stage = "two" }
+}
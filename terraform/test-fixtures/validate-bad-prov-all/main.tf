@@ -0,0 +1,9 @@
+resource "aws_instance" "test" {
+    provisioner "shell" {
+        command = "foo"
+    }
+
+    provisioner "shell" {
+        command = "bar"
+    }
+}
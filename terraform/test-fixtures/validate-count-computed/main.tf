@@ -0,0 +1,5 @@
+resource "aws_instance" "foo" {}
+
+resource "aws_instance" "bar" {
+    count = "${aws_instance.foo.num}"
+}
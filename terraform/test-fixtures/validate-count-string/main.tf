@@ -0,0 +1,7 @@
+variable "count" {
+    default = "foo"
+}
+
+resource "aws_instance" "foo" {
+    count = "${var.count}"
+}
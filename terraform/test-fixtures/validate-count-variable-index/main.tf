@@ -0,0 +1,11 @@
+variable "count" {
+    default = 2
+}
+
+resource "aws_instance" "foo" {
+    count = "${var.count}"
+}
+
+resource "aws_instance" "bar" {
+    foo = "${aws_instance.foo.2.id}"
+}
@@ -0,0 +1,11 @@
+variable "key" {}
+
+resource "aws_instance" "foo" {
+    provisioner "shell" {
+        command = "foo"
+
+        connection {
+            key_file = "${path.module}/${var.key}"
+        }
+    }
+}
@@ -0,0 +1,16 @@
+module "child" {
+    source = "./child"
+}
+
+resource "aws_instance" "web" {
+    count = 2
+}
+
+resource "aws_instance" "foo" {
+    ami = "${aws_instance.web.0.id}"
+    all = "${join(",", aws_instance.web.*.id)}"
+    typo = "${aws_instance.typo.id}"
+    address = "${module.child.address}"
+    missing = "${module.child.missing}"
+    nope = "${module.nope.address}"
+}
@@ -0,0 +1,5 @@
+terraform {
+    required_version = "< 0.6.0"
+}
+
+resource "aws_instance" "foo" {}
@@ -0,0 +1,5 @@
+terraform {
+    required_version = "0.6 or later"
+}
+
+resource "aws_instance" "foo" {}
@@ -27,7 +27,7 @@ func (t *ConfigTransformer) Transform(g *Graph) error {
 	}
 
 	// Get the module we care about
-	module := t.Module.Child(g.Path[1:])
+	module := moduleTreeChild(t.Module, g.Path[1:])
 	if module == nil {
 		return nil
 	}
@@ -57,6 +57,7 @@ func (t *ConfigTransformer) Transform(g *Graph) error {
 	for _, r := range config.Resources {
 		nodes = append(nodes, &GraphNodeConfigResource{
 			Resource: r,
+			Module:   module,
 			Path:     g.Path,
 		})
 	}
@@ -0,0 +1,47 @@
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/dot"
+)
+
+// CoordinateTransformer is a GraphTransformer that adds a node that
+// depends on every other node, to record the apply in the marker of the
+// Coordinator once everything is applied. See EvalCoordinate.
+type CoordinateTransformer struct{}
+
+func (t *CoordinateTransformer) Transform(g *Graph) error {
+	n := new(graphNodeCoordinate)
+	vs := g.Vertices()
+	g.Add(n)
+	for _, v := range vs {
+		g.Connect(dag.BasicEdge(n, v))
+	}
+
+	return nil
+}
+
+type graphNodeCoordinate struct{}
+
+func (n *graphNodeCoordinate) Name() string {
+	return "coordinate"
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeCoordinate) EvalTree() EvalNode {
+	return &EvalOpFilter{
+		Ops:  []walkOperation{walkApply},
+		Node: &EvalCoordinate{},
+	}
+}
+
+// GraphNodeDotter impl.
+func (n *graphNodeCoordinate) DotNode(name string, opts *GraphDotOpts) *dot.Node {
+	if !opts.Verbose {
+		return nil
+	}
+	return dot.NewNode(name, map[string]string{
+		"label": n.Name(),
+		"shape": "diamond",
+	})
+}
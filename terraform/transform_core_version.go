@@ -0,0 +1,99 @@
+package terraform
+
+import (
+	"sort"
+
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/dot"
+)
+
+// CoreVersionTransformer is a GraphTransformer that adds a node that every
+// other node depends on, to check the required_version constraints of the
+// modules when validating, before anything else is. The node is only
+// added if a module has a constraint. See EvalCheckCoreVersion.
+type CoreVersionTransformer struct {
+	Module *module.Tree
+}
+
+func (t *CoreVersionTransformer) Transform(g *Graph) error {
+	var checks []*EvalCheckCoreVersion
+	var walk func(*module.Tree)
+	walk = func(m *module.Tree) {
+		c := m.Config()
+		if c.Terraform != nil && c.Terraform.RequiredVersion != "" {
+			checks = append(checks, &EvalCheckCoreVersion{
+				Module:     coreVersionModuleName(m.Path()),
+				Constraint: c.Terraform.RequiredVersion,
+			})
+		}
+
+		children := m.Children()
+		names := make([]string, 0, len(children))
+		for name := range children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			walk(children[name])
+		}
+	}
+	if t.Module != nil {
+		walk(t.Module)
+	}
+
+	if len(checks) == 0 {
+		return nil
+	}
+
+	n := &graphNodeCoreVersion{Checks: checks}
+	vs := g.Vertices()
+	g.Add(n)
+	for _, v := range vs {
+		g.Connect(dag.BasicEdge(v, n))
+	}
+
+	return nil
+}
+
+// coreVersionModuleName is the name of the module at the given path of a
+// module tree, such as "module.foo.module.bar", or "root".
+func coreVersionModuleName(path []string) string {
+	if len(path) == 0 {
+		return "root"
+	}
+
+	return modulePrefixStr(append([]string{"root"}, path...))
+}
+
+type graphNodeCoreVersion struct {
+	Checks []*EvalCheckCoreVersion
+}
+
+func (n *graphNodeCoreVersion) Name() string {
+	return "core version"
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeCoreVersion) EvalTree() EvalNode {
+	nodes := make([]EvalNode, len(n.Checks))
+	for i, c := range n.Checks {
+		nodes[i] = c
+	}
+
+	return &EvalOpFilter{
+		Ops:  []walkOperation{walkValidate},
+		Node: &EvalSequence{Nodes: nodes},
+	}
+}
+
+// GraphNodeDotter impl.
+func (n *graphNodeCoreVersion) DotNode(name string, opts *GraphDotOpts) *dot.Node {
+	if !opts.Verbose {
+		return nil
+	}
+	return dot.NewNode(name, map[string]string{
+		"label": n.Name(),
+		"shape": "diamond",
+	})
+}
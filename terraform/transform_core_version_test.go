@@ -0,0 +1,80 @@
+package terraform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoreVersionTransformer(t *testing.T) {
+	mod := testModule(t, "transform-core-version")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	transform := &CoreVersionTransformer{Module: mod}
+	if err := transform.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformCoreVersionStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	var n *graphNodeCoreVersion
+	for _, v := range g.Vertices() {
+		if cv, ok := v.(*graphNodeCoreVersion); ok {
+			n = cv
+		}
+	}
+	checks := []*EvalCheckCoreVersion{
+		&EvalCheckCoreVersion{Module: "root", Constraint: ">= 0.6.0"},
+		&EvalCheckCoreVersion{Module: "module.child", Constraint: "~> 0.6"},
+	}
+	if !reflect.DeepEqual(n.Checks, checks) {
+		t.Fatalf("bad: %#v", n.Checks)
+	}
+}
+
+func TestCoreVersionTransformer_none(t *testing.T) {
+	mod := testModule(t, "transform-provider-basic")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	transform := &CoreVersionTransformer{Module: mod}
+	if err := transform.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformCoreVersionNoneStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+const testTransformCoreVersionStr = `
+aws_instance.web
+  core version
+core version
+module.child
+  core version
+`
+
+const testTransformCoreVersionNoneStr = `
+aws_instance.web
+provider.aws
+`
@@ -0,0 +1,51 @@
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/dot"
+)
+
+// CostGateTransformer is a GraphTransformer that adds a node that every
+// other node depends on, to check the estimated cost of the apply against
+// the budget before anything is applied. See EvalCostGate.
+type CostGateTransformer struct {
+	Budget float64
+}
+
+func (t *CostGateTransformer) Transform(g *Graph) error {
+	n := &graphNodeCostGate{Budget: t.Budget}
+	vs := g.Vertices()
+	g.Add(n)
+	for _, v := range vs {
+		g.Connect(dag.BasicEdge(v, n))
+	}
+
+	return nil
+}
+
+type graphNodeCostGate struct {
+	Budget float64
+}
+
+func (n *graphNodeCostGate) Name() string {
+	return "cost gate"
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeCostGate) EvalTree() EvalNode {
+	return &EvalOpFilter{
+		Ops:  []walkOperation{walkApply},
+		Node: &EvalCostGate{Budget: n.Budget},
+	}
+}
+
+// GraphNodeDotter impl.
+func (n *graphNodeCostGate) DotNode(name string, opts *GraphDotOpts) *dot.Node {
+	if !opts.Verbose {
+		return nil
+	}
+	return dot.NewNode(name, map[string]string{
+		"label": n.Name(),
+		"shape": "diamond",
+	})
+}
@@ -0,0 +1,90 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// CountBoundaryTransformer is a GraphTransformer that migrates the state
+// of a resource across the boundary of a count of one, before the count
+// is expanded. An instance of a resource with a count of one is in the
+// state as "aws_instance.foo", but as "aws_instance.foo.0" with a higher
+// count, so this moves it to the key for the current count. Otherwise
+// raising the count from one would destroy the existing instance and
+// create it again as the first of many, and vice versa.
+//
+// This doesn't change the graph. It changes State, so the state lock
+// must be held for writing. It is idempotent.
+type CountBoundaryTransformer struct {
+	Resource *config.Resource
+
+	// State is the global state. The module state is looked up by the
+	// path of the graph.
+	State *State
+
+	// StateCache, if set, is invalidated for the keys that are moved.
+	StateCache *StateReadCache
+}
+
+func (t *CountBoundaryTransformer) Transform(g *Graph) error {
+	// If the count isn't known yet, the state is left as it is until
+	// it is, see ResourceCountTransformer.
+	if t.State == nil || len(t.Resource.RawCount.UnknownKeys()) > 0 {
+		return nil
+	}
+
+	// Get the count, important for knowing whether we're supposed to
+	// be adding the zero, or trimming it.
+	count, err := t.Resource.Count()
+	if err != nil {
+		return err
+	}
+
+	// Figure what to look for and what to replace it with
+	id := t.Resource.Id()
+	hunt, replace := countBoundaryKeys(count, func(i int) string {
+		if i < 0 {
+			return id
+		}
+
+		return fmt.Sprintf("%s.%d", id, i)
+	})
+
+	// Look for the module state. If we don't have one, then it doesn't matter.
+	mod := t.State.ModuleByPath(g.Path)
+	if mod == nil {
+		return nil
+	}
+
+	// Look for the resource state. If we don't have one, then it is okay.
+	rs, ok := mod.Resources[hunt]
+	if !ok {
+		return nil
+	}
+
+	// If the replacement key exists, we just keep both
+	if _, ok := mod.Resources[replace]; ok {
+		return nil
+	}
+
+	mod.Resources[replace] = rs
+	delete(mod.Resources, hunt)
+	t.StateCache.Invalidate(g.Path, hunt)
+	t.StateCache.Invalidate(g.Path, replace)
+
+	return nil
+}
+
+// countBoundaryKeys returns the key of the state of an instance that is
+// moved across the boundary of a count of one, and the key it is moved
+// to, for the given count. The key function returns the key of the
+// instance with an index, or of the instance without one for -1.
+func countBoundaryKeys(count int, key func(int) string) (string, string) {
+	hunt, replace := key(-1), key(0)
+	if count < 2 {
+		hunt, replace = replace, hunt
+	}
+
+	return hunt, replace
+}
@@ -0,0 +1,126 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountBoundaryTransformer_increase(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-basic").Config()
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+				},
+			},
+		},
+	}
+	cache := new(StateReadCache)
+	cache.Put(RootModulePath, "aws_instance.foo", "primary", nil)
+
+	g := Graph{Path: RootModulePath}
+	tf := &CountBoundaryTransformer{
+		Resource:   cfg.Resources[0],
+		State:      state,
+		StateCache: cache,
+	}
+
+	// Transforming twice is the same as once
+	for i := 0; i < 2; i++ {
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		actual := strings.TrimSpace(state.String())
+		expected := strings.TrimSpace(testCountBoundaryTransformIncreaseStr)
+		if actual != expected {
+			t.Fatalf("%d: bad:\n\n%s", i, actual)
+		}
+	}
+
+	if _, ok := cache.Get(RootModulePath, "aws_instance.foo", "primary"); ok {
+		t.Fatal("should invalidate")
+	}
+}
+
+func TestCountBoundaryTransformer_decrease(t *testing.T) {
+	cfg := testModule(t, "transform-count-boundary-one").Config()
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+					"aws_instance.foo.1": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+				},
+			},
+		},
+	}
+
+	g := Graph{Path: RootModulePath}
+	tf := &CountBoundaryTransformer{Resource: cfg.Resources[0], State: state}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testCountBoundaryTransformDecreaseStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestCountBoundaryTransformer_both(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-basic").Config()
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+					"aws_instance.foo.0": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+				},
+			},
+		},
+	}
+
+	// If both keys exist, both are kept
+	g := Graph{Path: RootModulePath}
+	tf := &CountBoundaryTransformer{Resource: cfg.Resources[0], State: state}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(state.RootModule().Resources) != 2 {
+		t.Fatalf("bad:\n\n%s", state)
+	}
+}
+
+const testCountBoundaryTransformIncreaseStr = `
+aws_instance.foo.0:
+  ID = foo
+`
+
+const testCountBoundaryTransformDecreaseStr = `
+aws_instance.foo:
+  ID = foo
+aws_instance.foo.1:
+  ID = bar
+`
@@ -1,6 +1,10 @@
 package terraform
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/dag"
+)
 
 // DeposedTransformer is a GraphTransformer that adds deposed resources
 // to the graph.
@@ -12,6 +16,11 @@ type DeposedTransformer struct {
 	// View, if non-empty, is the ModuleState.View used around the state
 	// to find deposed resources.
 	View string
+
+	// Exclude are the state IDs of resources whose deposed instances are
+	// left out, since they're destroyed along with a deferred replacement
+	// instead. See resourceDeferReplace.
+	Exclude []string
 }
 
 func (t *DeposedTransformer) Transform(g *Graph) error {
@@ -30,14 +39,15 @@ func (t *DeposedTransformer) Transform(g *Graph) error {
 	// Go through all the resources in our state to look for deposed resources
 	for k, rs := range state.Resources {
 		// If we have no deposed resources, then move on
-		if len(rs.Deposed) == 0 {
+		if len(rs.Deposed) == 0 || deposedExcluded(t.Exclude, k) {
 			continue
 		}
 		deposed := rs.Deposed
 
-		for i, _ := range deposed {
+		for i, is := range deposed {
 			g.Add(&graphNodeDeposedResource{
 				Index:        i,
+				Key:          deposedKey(is),
 				ResourceName: k,
 				ResourceType: rs.Type,
 				Provider:     rs.Provider,
@@ -48,12 +58,44 @@ func (t *DeposedTransformer) Transform(g *Graph) error {
 	return nil
 }
 
+func deposedExcluded(exclude []string, k string) bool {
+	for _, id := range exclude {
+		if id == k {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deposedKey returns the key that targets the given deposed instance, see
+// EvalReadStateDeposed.Key.
+func deposedKey(is *InstanceState) string {
+	if is == nil {
+		return ""
+	}
+
+	return is.ID
+}
+
 // graphNodeDeposedResource is the graph vertex representing a deposed resource.
 type graphNodeDeposedResource struct {
 	Index        int
 	ResourceName string
+
+	// Key is the ID of the deposed instance, which keeps targeting it
+	// when the other deposed instances of the resource are destroyed and
+	// removed before it. Index is only used if it's empty.
+	Key string
+
 	ResourceType string
 	Provider     string
+
+	// PlanDestroy, if true, writes a destroy diff for the resource while
+	// planning so the destruction of the deposed instance shows up in the
+	// plan. This must only be set if no other node writes a diff for
+	// the resource.
+	PlanDestroy bool
 }
 
 func (n *graphNodeDeposedResource) Name() string {
@@ -64,6 +106,14 @@ func (n *graphNodeDeposedResource) ProvidedBy() []string {
 	return []string{resourceProvider(n.ResourceName, n.Provider)}
 }
 
+// GraphNodeFlattenable impl.
+func (n *graphNodeDeposedResource) Flatten(p []string) (dag.Vertex, error) {
+	return &graphNodeDeposedResourceFlat{
+		graphNodeDeposedResource: n,
+		PathValue:                p,
+	}, nil
+}
+
 // GraphNodeEvalable impl.
 func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 	var provider ResourceProvider
@@ -88,6 +138,7 @@ func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 					Name:   n.ResourceName,
 					Output: &state,
 					Index:  n.Index,
+					Key:    n.Key,
 				},
 				&EvalRefresh{
 					Info:     info,
@@ -101,13 +152,41 @@ func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 					Provider:     n.Provider,
 					State:        &state,
 					Index:        n.Index,
+					Key:          n.Key,
 				},
 			},
 		},
 	})
 
-	// Apply
+	// Diff the resource, only to show it in the plan. Apply doesn't
+	// read this diff.
 	var diff *InstanceDiff
+	if n.PlanDestroy {
+		seq.Nodes = append(seq.Nodes, &EvalOpFilter{
+			Ops: []walkOperation{walkPlan, walkPlanDestroy},
+			Node: &EvalSequence{
+				Nodes: []EvalNode{
+					&EvalReadStateDeposed{
+						Name:   n.ResourceName,
+						Output: &state,
+						Index:  n.Index,
+						Key:    n.Key,
+					},
+					&EvalDiffDestroy{
+						Info:   info,
+						State:  &state,
+						Output: &diff,
+					},
+					&EvalWriteDiff{
+						Name: n.ResourceName,
+						Diff: &diff,
+					},
+				},
+			},
+		})
+	}
+
+	// Apply
 	var err error
 	seq.Nodes = append(seq.Nodes, &EvalOpFilter{
 		Ops: []walkOperation{walkApply},
@@ -121,12 +200,18 @@ func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 					Name:   n.ResourceName,
 					Output: &state,
 					Index:  n.Index,
+					Key:    n.Key,
 				},
 				&EvalDiffDestroy{
 					Info:   info,
 					State:  &state,
 					Output: &diff,
 				},
+				&EvalPreApply{
+					Info:  info,
+					State: &state,
+					Diff:  &diff,
+				},
 				&EvalApply{
 					Info:     info,
 					State:    &state,
@@ -144,6 +229,7 @@ func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 					Provider:     n.Provider,
 					State:        &state,
 					Index:        n.Index,
+					Key:          n.Key,
 				},
 				&EvalReturnError{
 					Error: &err,
@@ -155,3 +241,26 @@ func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 
 	return seq
 }
+
+// graphNodeDeposedResourceFlat is the flattened version of
+// graphNodeDeposedResource, for deposed instances of orphans in modules.
+type graphNodeDeposedResourceFlat struct {
+	*graphNodeDeposedResource
+
+	PathValue []string
+}
+
+func (n *graphNodeDeposedResourceFlat) Name() string {
+	return fmt.Sprintf(
+		"%s.%s", modulePrefixStr(n.PathValue), n.graphNodeDeposedResource.Name())
+}
+
+func (n *graphNodeDeposedResourceFlat) Path() []string {
+	return n.PathValue
+}
+
+func (n *graphNodeDeposedResourceFlat) ProvidedBy() []string {
+	return modulePrefixList(
+		n.graphNodeDeposedResource.ProvidedBy(),
+		modulePrefixStr(n.PathValue))
+}
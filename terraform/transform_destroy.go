@@ -1,6 +1,8 @@
 package terraform
 
 import (
+	"log"
+
 	"github.com/hashicorp/terraform/dag"
 )
 
@@ -62,14 +64,37 @@ func (t *DestroyTransformer) Transform(g *Graph) error {
 	var connect, remove []dag.Edge
 
 	modes := []GraphNodeDestroyMode{DestroyPrimary, DestroyTainted}
-	for _, m := range modes {
-		connectMode, removeMode, err := t.transform(g, m)
+	nodeToDns := make([]map[dag.Vertex]dag.Vertex, len(modes))
+	for i, m := range modes {
+		connectMode, removeMode, nodeToDn, err := t.transform(g, m)
 		if err != nil {
 			return err
 		}
 
 		connect = append(connect, connectMode...)
 		remove = append(remove, removeMode...)
+		nodeToDns[i] = nodeToDn
+	}
+
+	// The destroy nodes of each mode only wait on the destroys of the
+	// same mode of the things that depend on them. They must wait on
+	// the destroys of the other modes too: if a resource is replaced,
+	// the tainted instances of its dependents must be destroyed before
+	// it is.
+	for i, nodeToDn := range nodeToDns {
+		for _, n := range nodeToDn {
+			for _, downRaw := range g.DownEdges(n).List() {
+				for j, other := range nodeToDns {
+					if i == j {
+						continue
+					}
+
+					if target := other[downRaw.(dag.Vertex)]; target != nil {
+						connect = append(connect, dag.BasicEdge(target, n))
+					}
+				}
+			}
+		}
 	}
 
 	// Atomatically add/remove the edges
@@ -84,7 +109,8 @@ func (t *DestroyTransformer) Transform(g *Graph) error {
 }
 
 func (t *DestroyTransformer) transform(
-	g *Graph, mode GraphNodeDestroyMode) ([]dag.Edge, []dag.Edge, error) {
+	g *Graph, mode GraphNodeDestroyMode) (
+	[]dag.Edge, []dag.Edge, map[dag.Vertex]dag.Vertex, error) {
 	var connect, remove []dag.Edge
 	nodeToCn := make(map[dag.Vertex]dag.Vertex, len(g.Vertices()))
 	nodeToDn := make(map[dag.Vertex]dag.Vertex, len(g.Vertices()))
@@ -155,7 +181,7 @@ func (t *DestroyTransformer) transform(
 		}
 	}
 
-	return connect, remove, nil
+	return connect, remove, nodeToDn, nil
 }
 
 // CreateBeforeDestroyTransformer is a GraphTransformer that modifies
@@ -226,6 +252,67 @@ func (t *CreateBeforeDestroyTransformer) Transform(g *Graph) error {
 	return nil
 }
 
+// CreateBeforeDestroyPropagateTransformer is a GraphTransformer that
+// enables create before destroy on the resources that depend, directly or
+// not, on a resource that has it enabled, such as an autoscaling group
+// that references a launch configuration. Otherwise a dependent that is
+// replaced is still destroyed before it is created. It must run before
+// the destroy nodes are created.
+//
+// The configuration itself isn't changed: the nodes get a copy of their
+// resource with create before destroy enabled.
+type CreateBeforeDestroyPropagateTransformer struct{}
+
+func (t *CreateBeforeDestroyPropagateTransformer) Transform(g *Graph) error {
+	for _, v := range g.Vertices() {
+		rn := createBeforeDestroyConfigNode(v)
+		if rn == nil || !rn.Resource.Lifecycle.CreateBeforeDestroy {
+			continue
+		}
+
+		dependents, err := g.Descendents(v)
+		if err != nil {
+			return err
+		}
+
+		for _, raw := range dependents.List() {
+			dn := createBeforeDestroyConfigNode(raw.(dag.Vertex))
+			if dn == nil || dn.Resource.Lifecycle.CreateBeforeDestroy {
+				continue
+			}
+
+			log.Printf(
+				"[DEBUG] %s: enabling create_before_destroy, it depends on %s",
+				dag.VertexName(raw), dag.VertexName(v))
+			r := *dn.Resource
+			r.Lifecycle.CreateBeforeDestroy = true
+			dn.Resource = &r
+		}
+	}
+
+	return nil
+}
+
+// createBeforeDestroyConfigNode returns the resource node of the vertex
+// if it is the create side of a resource in the configuration, or nil.
+func createBeforeDestroyConfigNode(v dag.Vertex) *GraphNodeConfigResource {
+	var n *GraphNodeConfigResource
+	switch t := v.(type) {
+	case *GraphNodeConfigResource:
+		n = t
+	case *GraphNodeConfigResourceFlat:
+		n = t.GraphNodeConfigResource
+	default:
+		return nil
+	}
+
+	if n.DestroyMode != DestroyNone {
+		return nil
+	}
+
+	return n
+}
+
 // PruneDestroyTransformer is a GraphTransformer that removes the destroy
 // nodes that aren't in the diff.
 type PruneDestroyTransformer struct {
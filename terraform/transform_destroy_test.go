@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -62,6 +63,48 @@ func TestCreateBeforeDestroyTransformer(t *testing.T) {
 	}
 }
 
+func TestCreateBeforeDestroyPropagateTransformer(t *testing.T) {
+	mod := testModule(t, "transform-create-before-destroy-propagate")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		tf := &CreateBeforeDestroyPropagateTransformer{}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := make(map[string]bool)
+	for _, v := range g.Vertices() {
+		if n, ok := v.(*GraphNodeConfigResource); ok {
+			actual[n.Resource.Id()] = n.Resource.Lifecycle.CreateBeforeDestroy
+		}
+	}
+	expected := map[string]bool{
+		"aws_lc.foo":         true,
+		"aws_autoscale.bar":  true,
+		"aws_elb.baz":        true,
+		"aws_instance.other": false,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The configuration isn't changed
+	for _, r := range mod.Config().Resources {
+		if r.Id() != "aws_lc.foo" && r.Lifecycle.CreateBeforeDestroy {
+			t.Fatalf("bad: %s", r.Id())
+		}
+	}
+}
+
 func TestCreateBeforeDestroyTransformer_twice(t *testing.T) {
 	mod := testModule(t, "transform-create-before-destroy-twice")
 
@@ -409,7 +452,9 @@ aws_instance.foo
   aws_instance.foo (destroy)
 aws_instance.foo (destroy tainted)
   aws_instance.bar (destroy tainted)
+  aws_instance.bar (destroy)
 aws_instance.foo (destroy)
+  aws_instance.bar (destroy tainted)
   aws_instance.bar (destroy)
 `
 
@@ -467,9 +512,11 @@ aws_instance.web
   aws_instance.web (destroy tainted)
 aws_instance.web (destroy tainted)
   aws_load_balancer.lb (destroy tainted)
+  aws_load_balancer.lb (destroy)
 aws_instance.web (destroy)
   aws_instance.web
   aws_load_balancer.lb
+  aws_load_balancer.lb (destroy tainted)
   aws_load_balancer.lb (destroy)
 aws_load_balancer.lb
   aws_instance.web
@@ -490,8 +537,10 @@ aws_lc.foo
   aws_lc.foo (destroy tainted)
 aws_lc.foo (destroy tainted)
   aws_autoscale.bar (destroy tainted)
+  aws_autoscale.bar (destroy)
 aws_lc.foo (destroy)
   aws_autoscale.bar
+  aws_autoscale.bar (destroy tainted)
   aws_autoscale.bar (destroy)
   aws_lc.foo
 `
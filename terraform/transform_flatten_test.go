@@ -35,6 +35,38 @@ func TestFlattenTransformer(t *testing.T) {
 	}
 }
 
+func TestFlattenTransformer_soft(t *testing.T) {
+	mod := testModule(t, "transform-flatten-soft")
+
+	var b BasicGraphBuilder
+	b = BasicGraphBuilder{
+		Steps: []GraphTransformer{
+			&ConfigTransformer{Module: mod},
+			&VertexTransformer{
+				Transforms: []GraphVertexTransformer{
+					&ExpandTransform{
+						Builder: &b,
+					},
+				},
+			},
+			&FlattenTransformer{},
+		},
+	}
+
+	g, err := b.Build(rootModulePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The soft dependency is on the resource of the module, not on the
+	// resource with the same name in the root module
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformFlattenSoftStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
 func TestFlattenTransformer_withProxy(t *testing.T) {
 	mod := testModule(t, "transform-flatten")
 
@@ -79,6 +111,14 @@ module.child.var.var
   aws_instance.parent
 `
 
+const testTransformFlattenSoftStr = `
+aws_instance.a
+module.child.aws_instance.a
+module.child.aws_instance.b
+  module.child.aws_instance.a
+module.child.plan-destroy
+`
+
 const testTransformFlattenProxyStr = `
 aws_instance.parent
 aws_instance.parent-output
@@ -0,0 +1,73 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/dag"
+)
+
+// LazyReferenceTransformer is a GraphTransformer that checks the lazy
+// references of the resources, see GraphNodeLazyDependent.
+//
+// A resource doesn't depend on the resources it references lazily, it
+// waits for their state during the apply instead, see
+// EvalWaitForDependencies. That only works if the referenced resource
+// doesn't itself depend on the resource, directly or not, since then
+// they'd wait on each other. Such a reference is a genuine cycle, and an
+// error. Otherwise the resource is still ordered after the referenced
+// one with a soft edge, so that the plan sees its diff, see
+// Interpolater.lazyPending.
+type LazyReferenceTransformer struct{}
+
+func (t *LazyReferenceTransformer) Transform(g *Graph) error {
+	// Destroy nodes don't interpolate anything, and share the names of
+	// the nodes they destroy.
+	nodes := make(map[string]dag.Vertex)
+	for _, v := range g.Vertices() {
+		if _, ok := v.(GraphNodeDestroy); ok {
+			continue
+		}
+
+		if dv, ok := v.(GraphNodeDependable); ok {
+			for _, n := range dv.DependableName() {
+				nodes[n] = v
+			}
+		}
+	}
+
+	var err error
+	for _, v := range g.Vertices() {
+		if _, ok := v.(GraphNodeDestroy); ok {
+			continue
+		}
+
+		lv, ok := v.(GraphNodeLazyDependent)
+		if !ok {
+			continue
+		}
+
+		for _, name := range lv.LazyDependentOn() {
+			target := nodes[name]
+			if target == nil {
+				continue
+			}
+
+			deps, ancestorsErr := g.Ancestors(target)
+			if ancestorsErr != nil {
+				return ancestorsErr
+			}
+			if deps.Include(v) {
+				err = multierror.Append(err, fmt.Errorf(
+					"%s: lazy reference to %s is a cycle: %s depends on %s, "+
+						"so they can't be applied in any order",
+					dag.VertexName(v), name, name, dag.VertexName(v)))
+				continue
+			}
+
+			g.Connect(dag.SoftEdge(v, target))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,279 @@
+package terraform
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/lang/ast"
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/hashicorp/terraform/dag"
+)
+
+// ModuleCountTransformer is a GraphTransformer that expands the count
+// out for the modules in the graph, the way ResourceCountTransformer
+// does for a resource.
+//
+// Each instance of a module with a count is a module of its own with
+// the index in the last element of its path, such as "child[0]", so the
+// resources in it are walked and put into the state under that path.
+// Like with resources, a module with a count of one isn't indexed, and
+// the state of a module is moved across that boundary the way
+// CountBoundaryTransformer does for a resource: raising the count from
+// one moves "child" to "child[0]", and lowering it to one moves it back.
+type ModuleCountTransformer struct {
+	// State is the global state. Moving the state of the modules across
+	// the boundary of a count of one changes it.
+	State *State
+}
+
+func (t *ModuleCountTransformer) Transform(g *Graph) error {
+	for _, v := range g.Vertices() {
+		mn, ok := v.(*GraphNodeConfigModule)
+		if !ok {
+			continue
+		}
+
+		count, err := mn.Module.Count()
+		if err != nil {
+			return fmt.Errorf("%s: %s", mn.Name(), err)
+		}
+		if count < 0 {
+			return fmt.Errorf("%s: negative count: %d", mn.Name(), count)
+		}
+		t.moveBoundary(mn, count)
+		if count == 1 {
+			continue
+		}
+
+		// Get all the things that depend on the module so we can
+		// re-connect them to the instances.
+		dependents := make([]dag.Vertex, 0, 5)
+		for _, v := range g.UpEdges(v).List() {
+			dependents = append(dependents, v)
+		}
+
+		g.Remove(v)
+
+		parent := mn.Path[:len(mn.Path)-1]
+		for i := 0; i < count; i++ {
+			path := make([]string, len(parent), len(parent)+1)
+			copy(path, parent)
+			path = append(path, moduleInstanceName(mn.Module.Name, i))
+
+			instance := g.Add(&GraphNodeConfigModule{
+				Path:   path,
+				Module: mn.Module,
+				Tree:   mn.Tree,
+			})
+			g.ConnectDependent(instance)
+		}
+
+		for _, v := range dependents {
+			g.ConnectDependent(v)
+		}
+	}
+
+	return nil
+}
+
+// moveBoundary moves the state of the module, and of the modules in it,
+// across the boundary of a count of one for the given count. If there is
+// state at both paths already, both are kept.
+func (t *ModuleCountTransformer) moveBoundary(mn *GraphNodeConfigModule, count int) {
+	if t.State == nil {
+		return
+	}
+
+	parent := mn.Path[:len(mn.Path)-1]
+	hunt, replace := countBoundaryKeys(count, func(i int) string {
+		return moduleInstanceName(mn.Module.Name, i)
+	})
+
+	var moved []*ModuleState
+	for _, m := range t.State.Modules {
+		if len(m.Path) <= len(parent) ||
+			!reflect.DeepEqual(m.Path[:len(parent)], parent) {
+			continue
+		}
+
+		switch m.Path[len(parent)] {
+		case hunt:
+			moved = append(moved, m)
+		case replace:
+			return
+		}
+	}
+
+	for _, m := range moved {
+		path := make([]string, len(m.Path))
+		copy(path, m.Path)
+		path[len(parent)] = replace
+		m.Path = path
+	}
+	if len(moved) > 0 {
+		t.State.sort()
+	}
+}
+
+// interpolateModuleCounts interpolates the counts of the modules in the
+// tree that reference variables, so that they are known when the graph
+// is built and config.Module.Count returns them. A module count can only
+// reference the variables of the module it is in; vars are those of the
+// root module. The variables of the other modules are known as far as
+// the modules that use them set them to values that are known.
+func interpolateModuleCounts(t *module.Tree, vars map[string]string) error {
+	values := make(map[string]ast.Variable)
+	for _, v := range t.Config().Variables {
+		for k, val := range v.DefaultsMap() {
+			values[k] = ast.Variable{Value: val, Type: ast.TypeString}
+		}
+	}
+	for k, val := range vars {
+		values["var."+k] = ast.Variable{Value: val, Type: ast.TypeString}
+	}
+
+	for _, m := range t.Config().Modules {
+		if m.RawCount != nil && len(m.RawCount.Variables) > 0 {
+			for n, _ := range m.RawCount.Variables {
+				if _, ok := values[n]; !ok {
+					return fmt.Errorf(
+						"%s: count references %s, which isn't known "+
+							"when the graph is built", m.Id(), n)
+				}
+			}
+
+			if err := m.RawCount.Interpolate(values); err != nil {
+				return fmt.Errorf("%s: error interpolating count: %s", m.Id(), err)
+			}
+		}
+
+		child := t.Children()[m.Name]
+		if child == nil {
+			continue
+		}
+
+		// The variables of the module that are known are those set to
+		// literals or to the variables that are known here.
+		childVars := make(map[string]string)
+		for k, raw := range m.RawConfig.Raw {
+			rc, err := config.NewRawConfig(map[string]interface{}{k: raw})
+			if err != nil {
+				continue
+			}
+
+			known := true
+			for n, v := range rc.Variables {
+				if _, ok := v.(*config.UserVariable); !ok {
+					known = false
+				} else if _, ok := values[n]; !ok {
+					known = false
+				}
+			}
+			if !known {
+				continue
+			}
+
+			if len(rc.Variables) > 0 {
+				if err := rc.Interpolate(values); err != nil {
+					continue
+				}
+			}
+			if v, ok := rc.Config()[k].(string); ok {
+				childVars[k] = v
+			}
+		}
+
+		if err := interpolateModuleCounts(child, childVars); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moduleInstanceRegexp matches the name of an instance of a module with
+// a count, as it is in a module path.
+var moduleInstanceRegexp = regexp.MustCompile(`^(.+)\[(\d+)\]$`)
+
+// moduleInstanceName returns the name of the instance of the module with
+// the given index, as it is in a module path. An index of -1 is for a
+// module without a count.
+func moduleInstanceName(name string, index int) string {
+	if index < 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s[%d]", name, index)
+}
+
+// moduleInstanceIndex returns the name of the module and the index of
+// the instance for an element of a module path. The index is -1 if the
+// element isn't an instance of a module with a count.
+func moduleInstanceIndex(key string) (string, int) {
+	match := moduleInstanceRegexp.FindStringSubmatch(key)
+	if match == nil {
+		return key, -1
+	}
+
+	index, err := strconv.Atoi(match[2])
+	if err != nil {
+		return key, -1
+	}
+
+	return match[1], index
+}
+
+// moduleInstanceKeys returns the elements of the module path of all the
+// instances of the module in the configuration.
+func moduleInstanceKeys(m *config.Module) []string {
+	count, err := m.Count()
+	if err != nil || count == 1 {
+		return []string{m.Name}
+	}
+
+	result := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		result = append(result, moduleInstanceName(m.Name, i))
+	}
+
+	return result
+}
+
+// moduleTreeChild returns the module tree for the module at the path,
+// relative to the root, where the elements of the path may be instances
+// of modules with a count. This returns nil if the path isn't in the
+// configuration, including for the instances that are beyond the count.
+func moduleTreeChild(root *module.Tree, path []string) *module.Tree {
+	current := root
+	for _, key := range path {
+		name, _ := moduleInstanceIndex(key)
+
+		var found bool
+		for _, m := range current.Config().Modules {
+			if m.Name != name {
+				continue
+			}
+
+			for _, k := range moduleInstanceKeys(m) {
+				if k == key {
+					found = true
+					break
+				}
+			}
+			break
+		}
+		if !found {
+			return nil
+		}
+
+		current = current.Children()[name]
+		if current == nil {
+			return nil
+		}
+	}
+
+	return current
+}
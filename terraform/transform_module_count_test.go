@@ -0,0 +1,168 @@
+package terraform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestModuleCountTransformer(t *testing.T) {
+	mod := testModule(t, "transform-module-count")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		tf := &ModuleCountTransformer{}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testModuleCountTransformStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	for _, v := range g.Vertices() {
+		mn, ok := v.(*GraphNodeConfigModule)
+		if !ok || mn.Module.Name != "child" {
+			continue
+		}
+
+		_, index := moduleInstanceIndex(mn.Path[len(mn.Path)-1])
+		expected := []string{RootModuleName, moduleInstanceName("child", index)}
+		if index < 0 || !reflect.DeepEqual(mn.Path, expected) {
+			t.Fatalf("bad: %#v", mn.Path)
+		}
+	}
+}
+
+func TestModuleCountTransformer_boundary(t *testing.T) {
+	mod := testModule(t, "transform-module-count")
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{Path: rootModulePath},
+			&ModuleState{Path: []string{"root", "child"}},
+			&ModuleState{Path: []string{"root", "child", "nested"}},
+			&ModuleState{Path: []string{"root", "other[0]"}},
+		},
+	}
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		tf := &ModuleCountTransformer{State: state}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	var actual [][]string
+	for _, m := range state.Modules {
+		actual = append(actual, m.Path)
+	}
+	expected := [][]string{
+		[]string{"root"},
+		[]string{"root", "child[0]"},
+		[]string{"root", "other"},
+		[]string{"root", "child[0]", "nested"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestInterpolateModuleCounts(t *testing.T) {
+	mod := testModule(t, "transform-module-count-var")
+	if err := interpolateModuleCounts(mod, map[string]string{"n": "2"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	child := mod.Config().Modules[0]
+	grandchild := mod.Children()["child"].Config().Modules[0]
+	for _, m := range []*config.Module{child, grandchild} {
+		count, err := m.Count()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if count != 2 {
+			t.Fatalf("%s: bad: %d", m.Name, count)
+		}
+	}
+
+	err := interpolateModuleCounts(mod, nil)
+	if err == nil || !strings.Contains(err.Error(), "count references var.n") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestModuleInstanceIndex(t *testing.T) {
+	cases := map[string]struct {
+		Name  string
+		Index int
+	}{
+		"child":     {"child", -1},
+		"child[0]":  {"child", 0},
+		"child[12]": {"child", 12},
+		"child[]":   {"child[]", -1},
+		"child[a]":  {"child[a]", -1},
+	}
+
+	for key, tc := range cases {
+		name, index := moduleInstanceIndex(key)
+		if name != tc.Name || index != tc.Index {
+			t.Fatalf("%s: bad: %s %d", key, name, index)
+		}
+	}
+}
+
+func TestModuleTreeChild(t *testing.T) {
+	mod := testModule(t, "transform-module-count")
+
+	cases := map[string]bool{
+		"other":    true,
+		"other[0]": false,
+		"child":    false,
+		"child[0]": true,
+		"child[2]": true,
+		"child[3]": false,
+		"nope":     false,
+	}
+
+	for key, found := range cases {
+		actual := moduleTreeChild(mod, []string{key})
+		if (actual != nil) != found {
+			t.Fatalf("%s: bad: %#v", key, actual)
+		}
+	}
+
+	if moduleTreeChild(mod, nil) != mod {
+		t.Fatal("should be the root")
+	}
+}
+
+const testModuleCountTransformStr = `
+module.child[0]
+  var.foo
+module.child[1]
+  var.foo
+module.child[2]
+  var.foo
+module.other
+var.foo
+`
@@ -3,6 +3,7 @@ package terraform
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/config/module"
@@ -33,6 +34,11 @@ type OrphanTransformer struct {
 
 	// View, if non-nil will set a view on the module state.
 	View string
+
+	// Exclude are the state IDs of resources that aren't orphans even
+	// though nothing in the graph represents them, since they're
+	// destroyed elsewhere. See ResourceCountOrphanTransformer.
+	Exclude []string
 }
 
 func (t *OrphanTransformer) Transform(g *Graph) error {
@@ -50,6 +56,9 @@ func (t *OrphanTransformer) Transform(g *Graph) error {
 
 	// Build up all our state representatives
 	resourceRep := make(map[string]struct{})
+	for _, k := range t.Exclude {
+		resourceRep[k] = struct{}{}
+	}
 	for _, v := range g.Vertices() {
 		if sr, ok := v.(GraphNodeStateRepresentative); ok {
 			for _, k := range sr.StateId() {
@@ -60,7 +69,7 @@ func (t *OrphanTransformer) Transform(g *Graph) error {
 
 	var config *config.Config
 	if t.Module != nil {
-		if module := t.Module.Child(g.Path[1:]); module != nil {
+		if module := moduleTreeChild(t.Module, g.Path[1:]); module != nil {
 			config = module.Config()
 		}
 	}
@@ -86,6 +95,35 @@ func (t *OrphanTransformer) Transform(g *Graph) error {
 
 			rs := state.Resources[k]
 
+			// A data source that isn't in the configuration anymore is
+			// only removed from the state, there's nothing to destroy.
+			if strings.HasPrefix(k, "data.") {
+				resourceVertexes[i] = g.Add(&graphNodeOrphanDataSource{
+					ResourceName: k,
+				})
+				continue
+			}
+
+			// Deposed instances are normally destroyed by the expanded
+			// config resource, which orphans don't have. Add them here
+			// so they don't leak.
+			for j, is := range rs.Deposed {
+				g.Add(&graphNodeDeposedResource{
+					Index:        j,
+					Key:          deposedKey(is),
+					ResourceName: k,
+					ResourceType: rs.Type,
+					Provider:     rs.Provider,
+					PlanDestroy:  rs.Primary == nil,
+				})
+			}
+
+			// If only deposed instances are left, there is nothing else
+			// to destroy.
+			if rs.Primary == nil && len(rs.Deposed) > 0 {
+				continue
+			}
+
 			resourceVertexes[i] = g.Add(&graphNodeOrphanResource{
 				ResourceName: k,
 				ResourceType: rs.Type,
@@ -243,6 +281,10 @@ func (n *graphNodeOrphanResource) EvalTree() EvalNode {
 		Ops: []walkOperation{walkPlan, walkPlanDestroy},
 		Node: &EvalSequence{
 			Nodes: []EvalNode{
+				&EvalGetProvider{
+					Name:   n.ProvidedBy()[0],
+					Output: &provider,
+				},
 				&EvalReadState{
 					Name:   n.ResourceName,
 					Output: &state,
@@ -252,6 +294,11 @@ func (n *graphNodeOrphanResource) EvalTree() EvalNode {
 					State:  &state,
 					Output: &diff,
 				},
+				&EvalEstimateCost{
+					Info:     info,
+					Provider: &provider,
+					Diff:     &diff,
+				},
 				&EvalWriteDiff{
 					Name: n.ResourceName,
 					Diff: &diff,
@@ -278,6 +325,11 @@ func (n *graphNodeOrphanResource) EvalTree() EvalNode {
 					Name:   n.ResourceName,
 					Output: &state,
 				},
+				&EvalPreApply{
+					Info:  info,
+					State: &state,
+					Diff:  &diff,
+				},
 				&EvalApply{
 					Info:     info,
 					State:    &state,
@@ -328,6 +380,52 @@ func (n *graphNodeOrphanResource) CreateNode() dag.Vertex {
 	return n
 }
 
+// graphNodeOrphanDataSource is the graph vertex representing a data
+// source that is in the state but not in the configuration.
+type graphNodeOrphanDataSource struct {
+	ResourceName string
+}
+
+func (n *graphNodeOrphanDataSource) Name() string {
+	return fmt.Sprintf("%s (orphan)", n.ResourceName)
+}
+
+func (n *graphNodeOrphanDataSource) Flatten(p []string) (dag.Vertex, error) {
+	return &graphNodeOrphanDataSourceFlat{
+		graphNodeOrphanDataSource: n,
+		PathValue:                 p,
+	}, nil
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeOrphanDataSource) EvalTree() EvalNode {
+	var state *InstanceState
+
+	return &EvalOpFilter{
+		Ops: []walkOperation{walkRefresh, walkPlan, walkApply},
+		Node: &EvalWriteState{
+			Name:  n.ResourceName,
+			State: &state,
+		},
+	}
+}
+
+// Same as graphNodeOrphanDataSource, but for flattening
+type graphNodeOrphanDataSourceFlat struct {
+	*graphNodeOrphanDataSource
+
+	PathValue []string
+}
+
+func (n *graphNodeOrphanDataSourceFlat) Name() string {
+	return fmt.Sprintf(
+		"%s.%s", modulePrefixStr(n.PathValue), n.graphNodeOrphanDataSource.Name())
+}
+
+func (n *graphNodeOrphanDataSourceFlat) Path() []string {
+	return n.PathValue
+}
+
 // Same as graphNodeOrphanResource, but for flattening
 type graphNodeOrphanResourceFlat struct {
 	*graphNodeOrphanResource
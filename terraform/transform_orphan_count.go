@@ -0,0 +1,109 @@
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/dag"
+)
+
+// ResourceCountOrphanTransformer is a GraphTransformer that adds destroy
+// nodes for the instances of a resource with a count that are in the
+// state but that the count no longer generates, such as
+// "aws_instance.foo.3" and "aws_instance.foo.4" when the count is lowered
+// from 5 to 3. Unlike the orphans of OrphanTransformer, they're destroyed
+// with the configuration of the resource, so prevent_destroy applies to
+// them.
+//
+// It runs after ResourceCountTransformer in the expansion of the resource
+// itself rather than of its destroy node, so that the instances it adds
+// are destroyed after the instances that are kept are created or updated.
+// The expansion of the destroy node skips them, see
+// resourceCountOrphans.
+type ResourceCountOrphanTransformer struct {
+	Resource *config.Resource
+	Targets  []ResourceAddress
+
+	// State is the global state. The module state is looked up by the
+	// path of the graph.
+	State *State
+}
+
+func (t *ResourceCountOrphanTransformer) Transform(g *Graph) error {
+	indexes, err := resourceCountOrphans(t.Resource, t.State, g.Path)
+	if err != nil {
+		return err
+	}
+
+	// The instances that are kept, which the orphans are destroyed after
+	var kept []dag.Vertex
+	for _, v := range g.Vertices() {
+		n, ok := v.(*graphNodeExpandedResource)
+		if ok && n.Resource == t.Resource {
+			kept = append(kept, v)
+		}
+	}
+
+	for _, index := range indexes {
+		node := &graphNodeExpandedResourceDestroy{
+			graphNodeExpandedResource: &graphNodeExpandedResource{
+				Index:    index,
+				Resource: t.Resource,
+				Path:     g.Path,
+			},
+			Orphan: true,
+		}
+		if !resourceNodeIsTargeted(t.Targets, node) {
+			continue
+		}
+
+		g.Add(node)
+		for _, k := range kept {
+			g.Connect(dag.BasicEdge(node, k))
+		}
+	}
+
+	return nil
+}
+
+// resourceCountOrphans returns the indexes of the instances of the resource
+// in the state of the module at path that its count no longer generates,
+// sorted, with -1 for the instance without an index.
+func resourceCountOrphans(
+	r *config.Resource, state *State, path []string) ([]int, error) {
+	// Data sources are only read, there's nothing to destroy
+	if r.Mode == config.DataResourceMode {
+		return nil, nil
+	}
+
+	// If the count isn't known yet, ResourceCountTransformer expands
+	// every instance in the state already.
+	if len(r.RawCount.UnknownKeys()) > 0 {
+		return nil, nil
+	}
+
+	count, err := r.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	// With a count of zero every instance is an orphan, which
+	// ResourceCountTransformer expands already too.
+	if count <= 0 {
+		return nil, nil
+	}
+
+	var result []int
+	for _, index := range resourceStateIndexes(state, path, r.Id()) {
+		// A count of one generates only the instance without an index,
+		// see ResourceCountTransformer.
+		if count == 1 && index == -1 {
+			continue
+		}
+		if count > 1 && index >= 0 && index < count {
+			continue
+		}
+
+		result = append(result, index)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResourceCountOrphanTransformer(t *testing.T) {
+	cfg := testModule(t, "transform-orphan-count").Config()
+	resource := cfg.Resources[0]
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": resourceState("aws_instance", "i-0"),
+					"aws_instance.foo.1": resourceState("aws_instance", "i-1"),
+					"aws_instance.foo.2": resourceState("aws_instance", "i-2"),
+					"aws_instance.foo.3": resourceState("aws_instance", "i-3"),
+					"aws_instance.foo.4": resourceState("aws_instance", "i-4"),
+
+					// Only the instances of the resource itself
+					"aws_instance.foobar.3": resourceState("aws_instance", "i-5"),
+				},
+			},
+		},
+	}
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{
+			Resource: resource,
+			State:    state,
+		}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		tf := &ResourceCountOrphanTransformer{
+			Resource: resource,
+			State:    state,
+		}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testResourceCountOrphanTransformStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	// Only the orphans are destroyed
+	for _, v := range g.Vertices() {
+		switch n := v.(type) {
+		case *graphNodeExpandedResourceDestroy:
+			if !n.Orphan || n.Index < 3 {
+				t.Fatalf("bad: %s", n.Name())
+			}
+		case *graphNodeExpandedResource:
+			if n.Index >= 3 {
+				t.Fatalf("bad: %s", n.Name())
+			}
+		}
+	}
+}
+
+func TestResourceCountOrphanTransformer_targeted(t *testing.T) {
+	cfg := testModule(t, "transform-orphan-count").Config()
+	resource := cfg.Resources[0]
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.3": resourceState("aws_instance", "i-3"),
+					"aws_instance.foo.4": resourceState("aws_instance", "i-4"),
+				},
+			},
+		},
+	}
+
+	g := Graph{Path: RootModulePath}
+	tf := &ResourceCountOrphanTransformer{
+		Resource: resource,
+		State:    state,
+		Targets: []ResourceAddress{
+			ResourceAddress{
+				Type:         "aws_instance",
+				Name:         "foo",
+				Index:        4,
+				InstanceType: TypePrimary,
+			},
+		},
+	}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := "aws_instance.foo #4 (destroy)"
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+const testResourceCountOrphanTransformStr = `
+aws_instance.foo #0
+aws_instance.foo #1
+aws_instance.foo #2
+aws_instance.foo #3 (destroy)
+  aws_instance.foo #0
+  aws_instance.foo #1
+  aws_instance.foo #2
+aws_instance.foo #4 (destroy)
+  aws_instance.foo #0
+  aws_instance.foo #1
+  aws_instance.foo #2
+`
@@ -0,0 +1,193 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/dot"
+)
+
+// PrerequisiteTransformer is a GraphTransformer that adds a node for each
+// provider used by resources that have implicit prerequisites, that
+// ensures those prerequisites exist before any of the resources is
+// applied. See ResourceProviderPrerequisiter.
+//
+// The providers are created from Providers to ask them which resource
+// types have prerequisites. There is no node for a provider that doesn't
+// implement ResourceProviderPrerequisiter or whose resource types have
+// none, and only the resources with prerequisites depend on the node.
+//
+// There is only one of these nodes per provider, so a prerequisite shared
+// by many resources is only ensured once. This must run on the flattened
+// graph after the noops are pruned, so that only the resources that are
+// left depend on it.
+type PrerequisiteTransformer struct {
+	Providers map[string]ResourceProviderFactory
+}
+
+func (t *PrerequisiteTransformer) Transform(g *Graph) error {
+	pm := providerVertexMap(g)
+	prereqs := &prerequisiteCache{Providers: t.Providers}
+	defer prereqs.Close()
+
+	nodes := make(map[string]*graphNodePrerequisites)
+	consumers := make(map[string][]dag.Vertex)
+	for _, v := range g.Vertices() {
+		var rn *GraphNodeConfigResource
+		path := rootModulePath
+		switch n := v.(type) {
+		case *GraphNodeConfigResource:
+			rn = n
+		case *GraphNodeConfigResourceFlat:
+			rn = n.GraphNodeConfigResource
+			path = n.Path()
+		default:
+			continue
+		}
+
+		for _, p := range v.(GraphNodeProviderConsumer).ProvidedBy() {
+			if _, ok := pm[p]; !ok {
+				// Validation will catch this later
+				continue
+			}
+
+			ok, err := prereqs.Has(p, rn.Resource.Type)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			n, ok := nodes[p]
+			if !ok {
+				n = &graphNodePrerequisites{
+					ProviderNameValue: resourceProvider(
+						rn.Resource.Type, rn.Resource.Provider),
+					PathValue: path,
+				}
+				nodes[p] = n
+			}
+			n.addType(rn.Resource.Type)
+			consumers[p] = append(consumers[p], v)
+		}
+	}
+
+	for p, n := range nodes {
+		g.Add(n)
+		g.Connect(dag.BasicEdge(n, pm[p]))
+		for _, v := range consumers[p] {
+			g.Connect(dag.BasicEdge(v, n))
+		}
+	}
+
+	return nil
+}
+
+// prerequisiteCache creates the providers once each to ask them which
+// resource types have prerequisites.
+type prerequisiteCache struct {
+	Providers map[string]ResourceProviderFactory
+
+	providers map[string]ResourceProvider
+}
+
+// Has returns true if the resources of the given type have prerequisites
+// in the provider with the given name.
+func (c *prerequisiteCache) Has(name, resourceType string) (bool, error) {
+	if c.providers == nil {
+		c.providers = make(map[string]ResourceProvider)
+	}
+
+	typeName := strings.SplitN(name, ".", 2)[0]
+	p, ok := c.providers[typeName]
+	if !ok {
+		if f, ok := c.Providers[typeName]; ok {
+			var err error
+			if p, err = f(); err != nil {
+				return false, err
+			}
+		}
+
+		c.providers[typeName] = p
+	}
+
+	r, ok := p.(ResourceProviderPrerequisiter)
+	return ok && len(r.Prerequisites(resourceType)) > 0, nil
+}
+
+// Close closes the providers that were created.
+func (c *prerequisiteCache) Close() {
+	for k, p := range c.providers {
+		if closer, ok := p.(ResourceProviderCloser); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("[WARN] Error closing provider %s: %s", k, err)
+			}
+		}
+	}
+}
+
+type graphNodePrerequisites struct {
+	ProviderNameValue string
+	PathValue         []string
+	Types             []string
+}
+
+func (n *graphNodePrerequisites) Name() string {
+	name := fmt.Sprintf("provider.%s (prerequisites)", n.ProviderNameValue)
+	if prefix := modulePrefixStr(n.PathValue); prefix != "" {
+		name = prefix + "." + name
+	}
+
+	return name
+}
+
+// GraphNodeSubPath impl.
+func (n *graphNodePrerequisites) Path() []string {
+	return n.PathValue
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodePrerequisites) EvalTree() EvalNode {
+	var provider ResourceProvider
+	return &EvalOpFilter{
+		Ops: []walkOperation{walkApply},
+		Node: &EvalSequence{
+			Nodes: []EvalNode{
+				&EvalGetProvider{
+					Name:   n.ProviderNameValue,
+					Output: &provider,
+				},
+				&EvalEnsurePrerequisites{
+					Provider: &provider,
+					Types:    n.Types,
+				},
+			},
+		},
+	}
+}
+
+func (n *graphNodePrerequisites) addType(t string) {
+	idx := sort.SearchStrings(n.Types, t)
+	if idx < len(n.Types) && n.Types[idx] == t {
+		return
+	}
+
+	n.Types = append(n.Types, "")
+	copy(n.Types[idx+1:], n.Types[idx:])
+	n.Types[idx] = t
+}
+
+// GraphNodeDotter impl.
+func (n *graphNodePrerequisites) DotNode(name string, opts *GraphDotOpts) *dot.Node {
+	if !opts.Verbose {
+		return nil
+	}
+	return dot.NewNode(name, map[string]string{
+		"label": n.Name(),
+		"shape": "diamond",
+	})
+}
@@ -0,0 +1,107 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrerequisiteTransformer(t *testing.T) {
+	mod := testModule(t, "transform-prerequisite-basic")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		transform := &ProviderTransformer{}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	p := &testPrerequisiteProvider{
+		MockResourceProvider: testProvider("aws"),
+		PrerequisitesMap: map[string][]string{
+			"aws_instance": []string{"vpc"},
+		},
+	}
+	transform := &PrerequisiteTransformer{
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	}
+	if err := transform.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformPrerequisiteBasicStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestPrerequisiteTransformer_none(t *testing.T) {
+	mod := testModule(t, "transform-prerequisite-basic")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		transform := &ProviderTransformer{}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Neither a provider without prerequisites nor one whose resource
+	// types have none get a node
+	providers := []ResourceProvider{
+		testProvider("aws"),
+		&testPrerequisiteProvider{MockResourceProvider: testProvider("aws")},
+	}
+	for i, p := range providers {
+		transform := &PrerequisiteTransformer{
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		actual := strings.TrimSpace(g.String())
+		expected := strings.TrimSpace(testTransformPrerequisiteNoneStr)
+		if actual != expected {
+			t.Fatalf("%d: bad:\n\n%s", i, actual)
+		}
+	}
+}
+
+const testTransformPrerequisiteBasicStr = `
+aws_eip.ip
+  provider.aws
+aws_instance.web
+  provider.aws
+  provider.aws (prerequisites)
+provider.aws
+provider.aws (prerequisites)
+  provider.aws
+`
+
+const testTransformPrerequisiteNoneStr = `
+aws_eip.ip
+  provider.aws
+aws_instance.web
+  provider.aws
+provider.aws
+`
@@ -2,6 +2,8 @@ package terraform
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform/config"
@@ -14,9 +16,22 @@ type ResourceCountTransformer struct {
 	Resource *config.Resource
 	Destroy  bool
 	Targets  []ResourceAddress
+
+	// State is the global state. If the count is zero when destroying,
+	// or isn't known yet, the instances of the resource that are in it
+	// are expanded.
+	State *State
 }
 
 func (t *ResourceCountTransformer) Transform(g *Graph) error {
+	// If the count depends on something that isn't known yet, such as
+	// for the destroy nodes that are walked before the resources the
+	// count depends on, the instances in the state are expanded instead.
+	if len(t.Resource.RawCount.UnknownKeys()) > 0 {
+		t.addNodes(g, resourceStateIndexes(t.State, g.Path, t.Resource.Id()), false)
+		return nil
+	}
+
 	// Expand the resource count
 	count, err := t.Resource.Count()
 	if err != nil {
@@ -28,16 +43,75 @@ func (t *ResourceCountTransformer) Transform(g *Graph) error {
 		return fmt.Errorf("negative count: %d", count)
 	}
 
-	// For each count, build and add the node
-	nodes := make([]dag.Vertex, 0, count)
+	// Build the indexes. If our count is 1 we special case it so that
+	// we handle the "resource.0" and "resource" boundary properly.
+	indexes := make([]int, 0, count)
 	for i := 0; i < count; i++ {
-		// Set the index. If our count is 1 we special case it so that
-		// we handle the "resource.0" and "resource" boundary properly.
 		index := i
 		if count == 1 {
 			index = -1
 		}
 
+		indexes = append(indexes, index)
+	}
+
+	// With a count of zero there is nothing in the configuration to
+	// expand, but the instances still in the state must be destroyed,
+	// including the one without an index from when the count was one.
+	// The orphans would usually find them, but not when targeting.
+	if count == 0 && t.Destroy {
+		indexes = resourceStateIndexes(t.State, g.Path, t.Resource.Id())
+	}
+
+	nodes := t.addNodes(g, indexes, count == 0)
+
+	// The replacements of the instances that wait on others are destroyed
+	// by the nodes from addReplaceDestroy instead, which wait along with
+	// the instances, see resourceDeferReplace.
+	if t.Destroy {
+		for _, n := range nodes {
+			dn := n.(*graphNodeExpandedResourceDestroy)
+			dn.DeferReplace = resourceDeferReplace(t.Resource, count, dn.Index)
+		}
+		return nil
+	}
+
+	canary := t.Resource.Lifecycle.Canary && count > 1
+	rollout := t.Resource.Lifecycle.RolloutPercent > 0 && count > 1
+	if !canary && !rollout {
+		return nil
+	}
+
+	replace := make(map[dag.Vertex][]dag.Vertex)
+	for _, n := range nodes {
+		replace[n] = t.addReplaceDestroy(g, n.(*graphNodeExpandedResource), count)
+	}
+
+	// If this is a canary deployment, the rest of the instances wait
+	// on the canary so that they're only applied if it succeeds.
+	if canary {
+		if err := t.connectCanary(g, nodes, replace, count); err != nil {
+			return err
+		}
+	}
+
+	// If this is a gradual rollout, the instances are applied in waves
+	// with a gate between each of them.
+	if rollout {
+		t.connectRollout(g, nodes, replace, count)
+	}
+
+	return nil
+}
+
+// addNodes adds a node for each of the indexes to the graph, and returns
+// the nodes that were added. Orphan is set on the destroy nodes, see
+// graphNodeExpandedResourceDestroy.
+func (t *ResourceCountTransformer) addNodes(
+	g *Graph, indexes []int, orphan bool) []dag.Vertex {
+	// For each index, build and add the node
+	nodes := make([]dag.Vertex, 0, len(indexes))
+	for _, index := range indexes {
 		// Save the node for later so we can do connections. Make the
 		// proper node depending on if we're just a destroy node or if
 		// were a regular node.
@@ -46,14 +120,20 @@ func (t *ResourceCountTransformer) Transform(g *Graph) error {
 			Resource: t.Resource,
 			Path:     g.Path,
 		}
+		if t.Resource.Mode == config.DataResourceMode {
+			node = &graphNodeExpandedDataSource{
+				graphNodeExpandedResource: node.(*graphNodeExpandedResource),
+			}
+		}
 		if t.Destroy {
 			node = &graphNodeExpandedResourceDestroy{
 				graphNodeExpandedResource: node.(*graphNodeExpandedResource),
+				Orphan:                    orphan,
 			}
 		}
 
 		// Skip nodes if targeting excludes them
-		if !t.nodeIsTargeted(node) {
+		if !resourceNodeIsTargeted(t.Targets, node) {
 			continue
 		}
 
@@ -69,12 +149,285 @@ func (t *ResourceCountTransformer) Transform(g *Graph) error {
 		g.ConnectDependent(n)
 	}
 
+	// When destroying in reverse, each instance depends on the one with
+	// the next higher index, so they're destroyed one at a time from the
+	// highest index down. That already walks a single chain, so it takes
+	// the place of the parallelism limit, which would make a cycle.
+	if t.Destroy && t.Resource.Lifecycle.ReverseDestroy {
+		t.connectReverseDestroy(g, nodes)
+		return nodes
+	}
+
+	// Limit how many of the instances are walked at once by making each
+	// one depend on the one that many places before it, so that there
+	// are only that many chains of instances to walk.
+	if p := t.Resource.Lifecycle.Parallelism; p > 0 {
+		for i := p; i < len(nodes); i++ {
+			g.Connect(dag.BasicEdge(nodes[i], nodes[i-p]))
+		}
+	}
+
+	return nodes
+}
+
+// connectReverseDestroy makes each of the destroy nodes depend on the one
+// with the next higher index. The instance without an index, from when the
+// count was one, is destroyed last.
+func (t *ResourceCountTransformer) connectReverseDestroy(
+	g *Graph, nodes []dag.Vertex) {
+	sorted := make([]dag.Vertex, len(nodes))
+	copy(sorted, nodes)
+	sort.Sort(resourceNodesByIndex(sorted))
+
+	for i := 0; i < len(sorted)-1; i++ {
+		g.Connect(dag.BasicEdge(sorted[i], sorted[i+1]))
+	}
+}
+
+// resourceNodesByIndex sorts the expanded destroy nodes of a resource by
+// their index.
+type resourceNodesByIndex []dag.Vertex
+
+func (s resourceNodesByIndex) Len() int      { return len(s) }
+func (s resourceNodesByIndex) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s resourceNodesByIndex) Less(i, j int) bool {
+	return s[i].(*graphNodeExpandedResourceDestroy).Index <
+		s[j].(*graphNodeExpandedResourceDestroy).Index
+}
+
+// connectCanary adds a gate that verifies the canary once it is applied,
+// and makes the instances other than the canary, and the destroys of their
+// replacements in replace, depend on the gate.
+func (t *ResourceCountTransformer) connectCanary(
+	g *Graph,
+	nodes []dag.Vertex,
+	replace map[dag.Vertex][]dag.Vertex,
+	count int) error {
+	idx := t.Resource.Lifecycle.CanaryIndex
+	if idx < 0 || idx >= count {
+		return fmt.Errorf(
+			"%s: canary index %d out of range for count %d",
+			t.Resource.Id(), idx, count)
+	}
+
+	var canary dag.Vertex
+	for _, n := range nodes {
+		if n.(*graphNodeExpandedResource).Index == idx {
+			canary = n
+			break
+		}
+	}
+
+	// The canary may have been excluded by targeting
+	if canary == nil {
+		return nil
+	}
+
+	gate := &graphNodeCanaryGate{
+		Canary: canary.(*graphNodeExpandedResource),
+	}
+	for _, n := range nodes {
+		if n != canary {
+			gate.After = append(
+				gate.After, n.(*graphNodeExpandedResource).stateId())
+		}
+	}
+
+	g.Add(gate)
+	g.Connect(dag.BasicEdge(gate, canary))
+	for _, n := range nodes {
+		if n == canary {
+			continue
+		}
+
+		g.Connect(dag.BasicEdge(n, gate))
+		for _, d := range replace[n] {
+			g.Connect(dag.BasicEdge(d, gate))
+		}
+	}
+
 	return nil
 }
 
-func (t *ResourceCountTransformer) nodeIsTargeted(node dag.Vertex) bool {
+// resourceDeferReplace returns true if replacing the instance of the
+// resource with the index must wait for other instances to be applied,
+// such as for the canary or the earlier waves of a rollout. Without
+// create before destroy, the replaced instances are otherwise all
+// destroyed before any instance is created.
+func resourceDeferReplace(r *config.Resource, count, index int) bool {
+	if r.Lifecycle.CreateBeforeDestroy || count <= 1 || index < 0 {
+		return false
+	}
+	if r.Lifecycle.Canary && index != r.Lifecycle.CanaryIndex {
+		return true
+	}
+
+	return r.Lifecycle.RolloutPercent > 0 &&
+		index >= resourceRolloutWaveSize(r, count)
+}
+
+// resourceRolloutWaveSize returns how many instances of the resource are
+// in each wave of its rollout. The size is rounded up so no instance is
+// left out, which may leave the last wave smaller.
+func resourceRolloutWaveSize(r *config.Resource, count int) int {
+	size := (count*r.Lifecycle.RolloutPercent + 99) / 100
+	if size < 1 {
+		size = 1
+	}
+
+	return size
+}
+
+// resourceDeferReplaceIds returns the state IDs of the instances of the
+// resource for which resourceDeferReplace is true.
+func resourceDeferReplaceIds(r *config.Resource) []string {
+	count, err := r.Count()
+	if err != nil {
+		return nil
+	}
+
+	var result []string
+	for i := 0; i < count; i++ {
+		if resourceDeferReplace(r, count, i) {
+			result = append(result, fmt.Sprintf("%s.%d", r.Id(), i))
+		}
+	}
+
+	return result
+}
+
+// addReplaceDestroy adds the nodes that destroy the instance of the node
+// when it is replaced, and its deposed instances, if the replacement is
+// deferred, see resourceDeferReplace. The node is connected to depend on
+// the destroy, and the added nodes are returned so the caller can make
+// them wait.
+func (t *ResourceCountTransformer) addReplaceDestroy(
+	g *Graph, n *graphNodeExpandedResource, count int) []dag.Vertex {
+	if !resourceDeferReplace(t.Resource, count, n.Index) {
+		return nil
+	}
+
+	destroy := &graphNodeExpandedResourceDestroy{
+		graphNodeExpandedResource: &graphNodeExpandedResource{
+			Index:    n.Index,
+			Resource: n.Resource,
+			Path:     n.Path,
+		},
+		ReplaceOnly: true,
+	}
+	g.Add(destroy)
+	g.Connect(dag.BasicEdge(n, destroy))
+	result := []dag.Vertex{destroy}
+
+	if t.State == nil {
+		return result
+	}
+	ms := t.State.ModuleByPath(g.Path)
+	if ms == nil {
+		return result
+	}
+	rs, ok := ms.Resources[n.stateId()]
+	if !ok {
+		return result
+	}
+	for i, is := range rs.Deposed {
+		deposed := &graphNodeDeposedResource{
+			Index:        i,
+			Key:          deposedKey(is),
+			ResourceName: n.stateId(),
+			ResourceType: rs.Type,
+			Provider:     rs.Provider,
+		}
+		g.Add(deposed)
+		result = append(result, deposed)
+	}
+
+	return result
+}
+
+// resourceStateIndexes returns the indexes of the instances of the
+// resource with the given ID in the state of the module at path, sorted,
+// with -1 for the instance without an index.
+func resourceStateIndexes(state *State, path []string, id string) []int {
+	if state == nil {
+		return nil
+	}
+
+	ms := state.ModuleByPath(path)
+	if ms == nil {
+		return nil
+	}
+
+	var result []int
+	for k, _ := range ms.Resources {
+		if k == id {
+			result = append(result, -1)
+			continue
+		}
+		if !strings.HasPrefix(k, id+".") {
+			continue
+		}
+
+		index, err := strconv.Atoi(k[len(id)+1:])
+		if err != nil {
+			continue
+		}
+
+		result = append(result, index)
+	}
+	sort.Ints(result)
+
+	return result
+}
+
+// connectRollout adds a gate between each of the waves of the rollout.
+// The instances of a wave, and the destroys of their replacements in
+// replace, depend on the gate, which depends on the previous wave.
+func (t *ResourceCountTransformer) connectRollout(
+	g *Graph,
+	nodes []dag.Vertex,
+	replace map[dag.Vertex][]dag.Vertex,
+	count int) {
+	size := resourceRolloutWaveSize(t.Resource, count)
+	waves := (count + size - 1) / size
+
+	byWave := make([][]dag.Vertex, waves)
+	for _, n := range nodes {
+		wave := n.(*graphNodeExpandedResource).Index / size
+		byWave[wave] = append(byWave[wave], n)
+	}
+
+	for i := 1; i < waves; i++ {
+		gate := &graphNodeRolloutGate{
+			Resource: t.Resource,
+			Wave:     i,
+			Waves:    waves,
+		}
+		for _, wave := range byWave[i:] {
+			for _, n := range wave {
+				gate.After = append(
+					gate.After, n.(*graphNodeExpandedResource).stateId())
+			}
+		}
+
+		g.Add(gate)
+		for _, n := range byWave[i-1] {
+			g.Connect(dag.BasicEdge(gate, n))
+		}
+		for _, n := range byWave[i] {
+			g.Connect(dag.BasicEdge(n, gate))
+			for _, d := range replace[n] {
+				g.Connect(dag.BasicEdge(d, gate))
+			}
+		}
+	}
+}
+
+// resourceNodeIsTargeted returns true if the expanded resource node is
+// one of the targets, or if there are no targets.
+func resourceNodeIsTargeted(targets []ResourceAddress, node dag.Vertex) bool {
 	// no targets specified, everything stays in the graph
-	if len(t.Targets) == 0 {
+	if len(targets) == 0 {
 		return true
 	}
 	addressable, ok := node.(GraphNodeAddressable)
@@ -83,7 +436,7 @@ func (t *ResourceCountTransformer) nodeIsTargeted(node dag.Vertex) bool {
 	}
 
 	addr := addressable.ResourceAddress()
-	for _, targetAddr := range t.Targets {
+	for _, targetAddr := range targets {
 		if targetAddr.Equals(addr) {
 			return true
 		}
@@ -199,6 +552,7 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 	var provider ResourceProvider
 	var resourceConfig *ResourceConfig
 	var state *InstanceState
+	var migrated bool
 
 	// Build the resource. If we aren't part of a multi-resource, then
 	// we still consider ourselves as count index zero.
@@ -210,12 +564,15 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 		Name:       n.Resource.Name,
 		Type:       n.Resource.Type,
 		CountIndex: index,
+		Info:       n.instanceInfo(),
+
+		LazyReferences: n.Resource.Lifecycle.LazyReferences,
 	}
 
 	seq := &EvalSequence{Nodes: make([]EvalNode, 0, 5)}
 
 	// Validate the resource
-	vseq := &EvalSequence{Nodes: make([]EvalNode, 0, 5)}
+	vseq := &EvalValidateSequence{Nodes: make([]EvalNode, 0, 5)}
 	vseq.Nodes = append(vseq.Nodes, &EvalGetProvider{
 		Name:   n.ProvidedBy()[0],
 		Output: &provider,
@@ -232,8 +589,15 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 		ResourceType: n.Resource.Type,
 	})
 
-	// Validate all the provisioners
+	// Validate all the provisioners, along with their teardowns
+	provisioners := make([]*config.Provisioner, 0, len(n.Resource.Provisioners))
 	for _, p := range n.Resource.Provisioners {
+		provisioners = append(provisioners, p)
+		if p.Teardown != nil {
+			provisioners = append(provisioners, p.Teardown)
+		}
+	}
+	for _, p := range provisioners {
 		var provisioner ResourceProvisioner
 		vseq.Nodes = append(vseq.Nodes, &EvalGetProvisioner{
 			Name:   p.Type,
@@ -245,6 +609,10 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 		}, &EvalValidateProvisioner{
 			Provisioner: &provisioner,
 			Config:      &resourceConfig,
+		}, &EvalValidateConnection{
+			Name:     n.Resource.Id(),
+			Config:   p.ConnInfo,
+			Resource: resource,
 		})
 	}
 
@@ -268,8 +636,14 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Output: &provider,
 				},
 				&EvalReadState{
-					Name:   n.stateId(),
-					Output: &state,
+					Name:    n.stateId(),
+					Output:  &state,
+					Recover: true,
+				},
+				&EvalMigrateAttributes{
+					Info:     info,
+					Provider: &provider,
+					State:    &state,
 				},
 				&EvalRefresh{
 					Info:     info,
@@ -283,11 +657,78 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Provider:     n.Resource.Provider,
 					Dependencies: n.StateDependencies(),
 					State:        &state,
+					Schema:       &provider,
+				},
+				&EvalStateSize{
+					Info:  info,
+					State: &state,
+				},
+			},
+		},
+	})
+
+	// Check the provisioners of existing resources without running them
+	seq.Nodes = append(seq.Nodes, &EvalOpFilter{
+		Ops: []walkOperation{walkProvisionCheck},
+		Node: &EvalSequence{
+			Nodes: []EvalNode{
+				&EvalReadState{
+					Name:   n.stateId(),
+					Output: &state,
+				},
+				&EvalRequireState{
+					State: &state,
+				},
+				&EvalApplyProvisioners{
+					Info:           info,
+					State:          &state,
+					Resource:       n.Resource,
+					InterpResource: resource,
+					DryRun:         true,
 				},
 			},
 		},
 	})
 
+	// Check the prerequisites of the changes that the apply will make
+	if checks := n.Resource.Lifecycle.PrerequisiteChecks; len(checks) > 0 {
+		var diffPreflight *InstanceDiff
+		seq.Nodes = append(seq.Nodes, &EvalOpFilter{
+			Ops: []walkOperation{walkPreflight},
+			Node: &EvalSequence{
+				Nodes: []EvalNode{
+					&EvalReadDiff{
+						Name: n.stateId(),
+						Diff: &diffPreflight,
+					},
+					&EvalIf{
+						If: func(ctx EvalContext) (bool, error) {
+							if diffPreflight.Empty() {
+								return true, EvalEarlyExitError{}
+							}
+							if diffPreflight.Destroy && len(diffPreflight.Attributes) == 0 {
+								return true, EvalEarlyExitError{}
+							}
+
+							return true, nil
+						},
+						Then: EvalNoop{},
+					},
+					&EvalInterpolate{
+						Config:   n.Resource.RawConfig.Copy(),
+						Resource: resource,
+						Output:   &resourceConfig,
+					},
+					&EvalCheckPrerequisites{
+						Info:   info,
+						Checks: checks,
+						Config: &resourceConfig,
+					},
+				},
+			},
+		})
+	}
+
 	// Diff the resource
 	seq.Nodes = append(seq.Nodes, &EvalOpFilter{
 		Ops: []walkOperation{walkPlan},
@@ -306,18 +747,71 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Name:   n.stateId(),
 					Output: &state,
 				},
+				&EvalMigrateAttributes{
+					Info:     info,
+					Provider: &provider,
+					State:    &state,
+					Migrated: &migrated,
+				},
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						return migrated, nil
+					},
+					Then: &EvalWriteState{
+						Name:         n.stateId(),
+						ResourceType: n.Resource.Type,
+						Provider:     n.Resource.Provider,
+						Dependencies: n.StateDependencies(),
+						State:        &state,
+					},
+				},
+				&EvalStateSize{
+					Info:  info,
+					State: &state,
+				},
 				&EvalDiff{
+					Info:     info,
+					Config:   &resourceConfig,
+					Provider: &provider,
+					State:    &state,
+					Output:   &diff,
+				},
+				&EvalDiffSuppress{
+					Info:     info,
+					Provider: &provider,
+					State:    &state,
+					Diff:     &diff,
+				},
+				&EvalIgnoreChanges{
 					Info:        info,
+					Keys:        n.Resource.Lifecycle.IgnoreChanges,
+					State:       &state,
+					Diff:        &diff,
+					OutputState: &state,
+				},
+				&EvalDiffReplaceTriggered{
+					Info:        info,
+					Triggers:    n.Resource.Lifecycle.ReplaceTriggeredBy,
 					Config:      &resourceConfig,
 					Provider:    &provider,
 					State:       &state,
 					Output:      &diff,
 					OutputState: &state,
 				},
+				&EvalDiffProvisionerTriggers{
+					Resource:       n.Resource,
+					InterpResource: resource,
+					State:          &state,
+					Diff:           &diff,
+				},
 				&EvalCheckPreventDestroy{
 					Resource: n.Resource,
 					Diff:     &diff,
 				},
+				&EvalCheckExpectNoChange{
+					Resource: n.Resource,
+					Diff:     &diff,
+				},
 				&EvalWriteState{
 					Name:         n.stateId(),
 					ResourceType: n.Resource.Type,
@@ -329,6 +823,11 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Diff: &diff,
 					Name: n.stateId(),
 				},
+				&EvalEstimateCost{
+					Info:     info,
+					Provider: &provider,
+					Diff:     &diff,
+				},
 				&EvalWriteDiff{
 					Name: n.stateId(),
 					Diff: &diff,
@@ -342,6 +841,10 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 		Ops: []walkOperation{walkPlanDestroy},
 		Node: &EvalSequence{
 			Nodes: []EvalNode{
+				&EvalGetProvider{
+					Name:   n.ProvidedBy()[0],
+					Output: &provider,
+				},
 				&EvalReadState{
 					Name:   n.stateId(),
 					Output: &state,
@@ -355,6 +858,11 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Resource: n.Resource,
 					Diff:     &diff,
 				},
+				&EvalEstimateCost{
+					Info:     info,
+					Provider: &provider,
+					Diff:     &diff,
+				},
 				&EvalWriteDiff{
 					Name: n.stateId(),
 					Diff: &diff,
@@ -365,7 +873,9 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 
 	// Apply
 	var diffApply *InstanceDiff
+	var deposed, replaced *InstanceState
 	var err error
+	var errClass ApplyErrorClass
 	var createNew, tainted bool
 	var createBeforeDestroyEnabled bool
 	seq.Nodes = append(seq.Nodes, &EvalOpFilter{
@@ -378,6 +888,15 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Diff: &diffApply,
 				},
 
+				// Changes outside of the change window, or that depend on
+				// a queued change, are queued
+				&EvalQueueChange{
+					Name:         n.stateId(),
+					Window:       n.Resource.Lifecycle.ChangeWindow,
+					Diff:         &diffApply,
+					Dependencies: n.StateDependencies(),
+				},
+
 				// We don't want to do any destroys
 				&EvalIf{
 					If: func(ctx EvalContext) (bool, error) {
@@ -395,6 +914,21 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Then: EvalNoop{},
 				},
 
+				// A replacement must be blocked before the replaced
+				// instance is deposed, or the new one would be created
+				// before the destroy node catches it.
+				&EvalCheckPreventDestroyOnReplace{
+					Resource: n.Resource,
+					Diff:     &diffApply,
+				},
+
+				// The planned change must be allowed by the policy
+				// before anything is changed.
+				&EvalPolicyGate{
+					Info: info,
+					Diff: &diffApply,
+				},
+
 				&EvalIf{
 					If: func(ctx EvalContext) (bool, error) {
 						destroy := false
@@ -409,10 +943,18 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 						return createBeforeDestroyEnabled, nil
 					},
 					Then: &EvalDeposeState{
-						Name: n.stateId(),
+						Name:   n.stateId(),
+						Output: &replaced,
 					},
 				},
 
+				// The computed attributes the config references must be
+				// read from the state written by their apply.
+				&EvalWaitForDependencies{
+					Name:   n.stateId(),
+					Config: n.Resource.RawConfig,
+					Lazy:   n.Resource.Lifecycle.LazyReferences,
+				},
 				&EvalInterpolate{
 					Config:   n.Resource.RawConfig.Copy(),
 					Resource: resource,
@@ -434,6 +976,18 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					State:    &state,
 					Output:   &diffApply,
 				},
+				&EvalDiffSuppress{
+					Info:     info,
+					Provider: &provider,
+					State:    &state,
+					Diff:     &diffApply,
+				},
+				&EvalIgnoreChanges{
+					Info:  info,
+					Keys:  n.Resource.Lifecycle.IgnoreChanges,
+					State: &state,
+					Diff:  &diffApply,
+				},
 
 				// Get the saved diff
 				&EvalReadDiff{
@@ -456,21 +1010,107 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Name:   n.stateId(),
 					Output: &state,
 				},
-				&EvalApply{
-					Info:      info,
-					State:     &state,
-					Diff:      &diffApply,
-					Provider:  &provider,
-					Output:    &state,
-					Error:     &err,
-					CreateNew: &createNew,
+				&EvalPreApply{
+					Info:  info,
+					State: &state,
+					Diff:  &diffApply,
 				},
+
+				// Mark the resource as pending so that an interrupted
+				// apply can be detected. The write after the apply
+				// clears the mark.
 				&EvalWriteState{
 					Name:         n.stateId(),
 					ResourceType: n.Resource.Type,
 					Provider:     n.Resource.Provider,
 					Dependencies: n.StateDependencies(),
 					State:        &state,
+					Pending:      true,
+				},
+				&EvalUpdateStateHook{Pending: true},
+				&EvalApply{
+					Info:       info,
+					State:      &state,
+					Diff:       &diffApply,
+					Provider:   &provider,
+					Output:     &state,
+					Error:      &err,
+					ErrorClass: &errClass,
+					Retries:    applyTransientRetries,
+					CreateNew:  &createNew,
+					Timeouts:   &n.Resource.Timeouts,
+				},
+				&EvalApplyRecreate{
+					Info:                info,
+					Config:              &resourceConfig,
+					Provider:            &provider,
+					State:               &state,
+					CreateBeforeDestroy: n.Resource.Lifecycle.CreateBeforeDestroy,
+					CreateNew:           &createNew,
+					Deposed:             &deposed,
+					Tainted:             &tainted,
+					Error:               &err,
+					ErrorClass:          &errClass,
+					Timeouts:            &n.Resource.Timeouts,
+				},
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						return deposed != nil, nil
+					},
+					Then: &EvalWriteStateDeposed{
+						Name:         n.stateId(),
+						ResourceType: n.Resource.Type,
+						Provider:     n.Resource.Provider,
+						Dependencies: n.StateDependencies(),
+						State:        &deposed,
+						Index:        -1,
+					},
+				},
+				// If an update failed part way, the attributes that the
+				// provider didn't return are kept from before. A new
+				// instance has nothing to keep.
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						return err != nil && !createNew, nil
+					},
+					Then: &EvalWriteState{
+						Name:         n.stateId(),
+						ResourceType: n.Resource.Type,
+						Provider:     n.Resource.Provider,
+						Dependencies: n.StateDependencies(),
+						State:        &state,
+						Schema:       &provider,
+						Merge:        true,
+					},
+					Else: &EvalWriteState{
+						Name:         n.stateId(),
+						ResourceType: n.Resource.Type,
+						Provider:     n.Resource.Provider,
+						Dependencies: n.StateDependencies(),
+						State:        &state,
+						Schema:       &provider,
+					},
+				},
+				&EvalResolve{
+					Info:         info,
+					Dependencies: n.StateDependencies(),
+				},
+				n.waitForLazyProvisioners(),
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						// Provisioners also run on existing resources
+						// if their triggers changed.
+						provision := createNew || (diff != nil && diff.Provision)
+						return provision && err == nil &&
+							len(n.Resource.Provisioners) > 0, nil
+					},
+					Then: &EvalReadSecrets{
+						Info:     info,
+						Provider: &provider,
+						State:    &state,
+						Output:   &resource.Secrets,
+						Error:    &err,
+					},
 				},
 				&EvalApplyProvisioners{
 					Info:           info,
@@ -481,6 +1121,34 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Tainted:        &tainted,
 					Error:          &err,
 				},
+
+				// The data of the replaced instance is moved to the new
+				// one before the replaced instance is destroyed. If the
+				// migration fails, the replaced instance is restored.
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						return createBeforeDestroyEnabled && replaced != nil, nil
+					},
+					Then: &EvalSequence{
+						Nodes: []EvalNode{
+							&EvalMigrateData{
+								Info:     info,
+								Provider: &provider,
+								From:     &replaced,
+								State:    &state,
+								Error:    &err,
+							},
+							&EvalApplyProvisioners{
+								Info:           info,
+								State:          &state,
+								Resource:       n.Resource,
+								InterpResource: resource,
+								Error:          &err,
+								Migrate:        true,
+							},
+						},
+					},
+				},
 				&EvalIf{
 					If: func(ctx EvalContext) (bool, error) {
 						if createBeforeDestroyEnabled {
@@ -527,12 +1195,25 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 							},
 						},
 					},
-					Else: &EvalWriteState{
-						Name:         n.stateId(),
-						ResourceType: n.Resource.Type,
-						Provider:     n.Resource.Provider,
-						Dependencies: n.StateDependencies(),
-						State:        &state,
+					Else: &EvalIf{
+						If: func(ctx EvalContext) (bool, error) {
+							return err != nil && !createNew, nil
+						},
+						Then: &EvalWriteState{
+							Name:         n.stateId(),
+							ResourceType: n.Resource.Type,
+							Provider:     n.Resource.Provider,
+							Dependencies: n.StateDependencies(),
+							State:        &state,
+							Merge:        true,
+						},
+						Else: &EvalWriteState{
+							Name:         n.stateId(),
+							ResourceType: n.Resource.Type,
+							Provider:     n.Resource.Provider,
+							Dependencies: n.StateDependencies(),
+							State:        &state,
+						},
 					},
 				},
 				&EvalApplyPost{
@@ -541,6 +1222,15 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 					Error: &err,
 				},
 				&EvalUpdateStateHook{},
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						return n.Resource.Lifecycle.PauseAfter != "", nil
+					},
+					Then: &EvalPause{
+						Name:    n.stateId(),
+						Message: n.Resource.Lifecycle.PauseAfter,
+					},
+				},
 			},
 		},
 	})
@@ -548,6 +1238,34 @@ func (n *graphNodeExpandedResource) EvalTree() EvalNode {
 	return seq
 }
 
+// waitForLazyProvisioners returns the EvalNode that waits for the state of
+// the resources that the provisioners reference lazily. Without lazy
+// references, the graph already orders the provisioners after everything
+// they reference.
+func (n *graphNodeExpandedResource) waitForLazyProvisioners() EvalNode {
+	lazy := n.Resource.Lifecycle.LazyReferences
+	if len(lazy) == 0 {
+		return EvalNoop{}
+	}
+
+	var nodes []EvalNode
+	for _, p := range n.Resource.Provisioners {
+		for _, c := range []*config.RawConfig{p.RawConfig, p.ConnInfo} {
+			if c == nil {
+				continue
+			}
+
+			nodes = append(nodes, &EvalWaitForDependencies{
+				Name:   n.stateId(),
+				Config: c,
+				Lazy:   lazy,
+			})
+		}
+	}
+
+	return &EvalSequence{Nodes: nodes}
+}
+
 // instanceInfo is used for EvalTree.
 func (n *graphNodeExpandedResource) instanceInfo() *InstanceInfo {
 	return &InstanceInfo{Id: n.stateId(), Type: n.Resource.Type}
@@ -567,10 +1285,119 @@ func (n *graphNodeExpandedResource) StateId() []string {
 	return []string{n.stateId()}
 }
 
+// graphNodeExpandedDataSource represents an expanded data source. Unlike
+// a managed resource, it is read again on every refresh and plan and its
+// state is replaced with what was read, so it is never diffed, applied or
+// destroyed.
+//
+// A data source whose configuration isn't known yet when planning, such
+// as when it references a resource that is still to be created, is
+// planned as a placeholder that is all computed, and is read during the
+// apply once its dependencies are applied.
+type graphNodeExpandedDataSource struct {
+	*graphNodeExpandedResource
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeExpandedDataSource) EvalTree() EvalNode {
+	var provider ResourceProvider
+	var resourceConfig *ResourceConfig
+	var state *InstanceState
+
+	index := n.Index
+	if index < 0 {
+		index = 0
+	}
+	resource := &Resource{
+		Name:       n.Resource.Name,
+		Type:       n.Resource.Type,
+		CountIndex: index,
+		Info:       n.instanceInfo(),
+	}
+
+	info := n.instanceInfo()
+	read := func(placeholder bool) EvalNode {
+		return &EvalSequence{
+			Nodes: []EvalNode{
+				&EvalGetProvider{
+					Name:   n.ProvidedBy()[0],
+					Output: &provider,
+				},
+				&EvalInterpolate{
+					Config:   n.Resource.RawConfig.Copy(),
+					Resource: resource,
+					Output:   &resourceConfig,
+				},
+				&EvalReadDataSource{
+					Provider:    &provider,
+					Config:      &resourceConfig,
+					Info:        info,
+					Output:      &state,
+					Placeholder: placeholder,
+				},
+				&EvalWriteState{
+					Name:         n.stateId(),
+					ResourceType: n.Resource.Type,
+					Provider:     n.Resource.Provider,
+					Dependencies: n.StateDependencies(),
+					State:        &state,
+				},
+			},
+		}
+	}
+
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			&EvalInstanceInfo{Info: info},
+			&EvalOpFilter{
+				Ops:  []walkOperation{walkRefresh},
+				Node: read(false),
+			},
+			&EvalOpFilter{
+				Ops:  []walkOperation{walkPlan},
+				Node: read(true),
+			},
+
+			// A data source that couldn't be read when planning is read
+			// now, its dependencies are applied before it.
+			&EvalOpFilter{
+				Ops: []walkOperation{walkApply},
+				Node: &EvalSequence{
+					Nodes: []EvalNode{
+						&EvalReadState{
+							Name:   n.stateId(),
+							Output: &state,
+						},
+						&EvalIf{
+							If: func(ctx EvalContext) (bool, error) {
+								return isDataSourcePlaceholder(state), nil
+							},
+							Then: read(false),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 // graphNodeExpandedResourceDestroy represents an expanded resource that
 // is to be destroyed.
 type graphNodeExpandedResourceDestroy struct {
 	*graphNodeExpandedResource
+
+	// Orphan is set when the instance is only in the state, such as when
+	// the count is zero or was lowered, so it is refreshed and the plan
+	// must destroy it too.
+	Orphan bool
+
+	// DeferReplace is set if replacing the instance is deferred, see
+	// resourceDeferReplace, so this node only destroys it if it isn't
+	// replaced. ReplaceOnly is set on the node that destroys it when it
+	// is replaced instead, which is walked with the instances that are
+	// created.
+	DeferReplace bool
+	ReplaceOnly  bool
 }
 
 func (n *graphNodeExpandedResourceDestroy) Name() string {
@@ -586,11 +1413,22 @@ func (n *graphNodeExpandedResourceDestroy) ConfigType() GraphNodeConfigType {
 func (n *graphNodeExpandedResourceDestroy) EvalTree() EvalNode {
 	info := n.instanceInfo()
 
+	index := n.Index
+	if index < 0 {
+		index = 0
+	}
+	resource := &Resource{
+		Name:       n.Resource.Name,
+		Type:       n.Resource.Type,
+		CountIndex: index,
+		Info:       info,
+	}
+
 	var diffApply *InstanceDiff
 	var provider ResourceProvider
 	var state *InstanceState
 	var err error
-	return &EvalOpFilter{
+	apply := &EvalOpFilter{
 		Ops: []walkOperation{walkApply},
 		Node: &EvalSequence{
 			Nodes: []EvalNode{
@@ -600,6 +1438,35 @@ func (n *graphNodeExpandedResourceDestroy) EvalTree() EvalNode {
 					Diff: &diffApply,
 				},
 
+				// Only one of the nodes of a deferred replacement
+				// destroys the instance
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						replace := diffApply.RequiresNew()
+						if (n.DeferReplace && replace) || (n.ReplaceOnly && !replace) {
+							return true, EvalEarlyExitError{}
+						}
+
+						return true, nil
+					},
+					Then: EvalNoop{},
+				},
+
+				// Changes outside of the change window are queued. This
+				// queues the whole diff, not only the destroy.
+				&EvalQueueChange{
+					Name:   n.stateId(),
+					Window: n.Resource.Lifecycle.ChangeWindow,
+					Diff:   &diffApply,
+				},
+
+				// The filtered diff doesn't say what forces a
+				// replacement, so that is checked first.
+				&EvalCheckPreventDestroyOnReplace{
+					Resource: n.Resource,
+					Diff:     &diffApply,
+				},
+
 				// Filter the diff so we only get the destroy
 				&EvalFilterDiff{
 					Diff:    &diffApply,
@@ -619,6 +1486,19 @@ func (n *graphNodeExpandedResourceDestroy) EvalTree() EvalNode {
 					Then: EvalNoop{},
 				},
 
+				// The plan checks this too, but the diff may be from a
+				// plan that was saved before prevent_destroy was set.
+				// The filtered diff is a destroy for replacements too.
+				&EvalCheckPreventDestroy{
+					Resource: n.Resource,
+					Diff:     &diffApply,
+				},
+
+				&EvalPolicyGate{
+					Info: info,
+					Diff: &diffApply,
+				},
+
 				&EvalGetProvider{
 					Name:   n.ProvidedBy()[0],
 					Output: &provider,
@@ -630,6 +1510,35 @@ func (n *graphNodeExpandedResourceDestroy) EvalTree() EvalNode {
 				&EvalRequireState{
 					State: &state,
 				},
+				&EvalPreDestroy{
+					Info:  info,
+					State: &state,
+				},
+				&EvalPreApply{
+					Info:  info,
+					State: &state,
+					Diff:  &diffApply,
+				},
+
+				// The provisioners that run on destroy run while the
+				// resource still exists. If they fail, it isn't destroyed.
+				&EvalApplyProvisioners{
+					Info:           info,
+					State:          &state,
+					Resource:       n.Resource,
+					InterpResource: resource,
+					Destroy:        true,
+				},
+
+				&EvalWriteState{
+					Name:         n.stateId(),
+					ResourceType: n.Resource.Type,
+					Provider:     n.Resource.Provider,
+					Dependencies: n.StateDependencies(),
+					State:        &state,
+					Pending:      true,
+				},
+				&EvalUpdateStateHook{Pending: true},
 				&EvalApply{
 					Info:     info,
 					State:    &state,
@@ -637,6 +1546,8 @@ func (n *graphNodeExpandedResourceDestroy) EvalTree() EvalNode {
 					Provider: &provider,
 					Output:   &state,
 					Error:    &err,
+					Retries:  applyTransientRetries,
+					Timeouts: &n.Resource.Timeouts,
 				},
 				&EvalWriteState{
 					Name:         n.stateId(),
@@ -653,4 +1564,136 @@ func (n *graphNodeExpandedResourceDestroy) EvalTree() EvalNode {
 			},
 		},
 	}
+
+	if !n.Orphan {
+		return apply
+	}
+
+	var diff *InstanceDiff
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			&EvalOpFilter{
+				Ops: []walkOperation{walkRefresh},
+				Node: &EvalSequence{
+					Nodes: []EvalNode{
+						&EvalGetProvider{
+							Name:   n.ProvidedBy()[0],
+							Output: &provider,
+						},
+						&EvalReadState{
+							Name:   n.stateId(),
+							Output: &state,
+						},
+						&EvalRefresh{
+							Info:     info,
+							Provider: &provider,
+							State:    &state,
+							Output:   &state,
+						},
+						&EvalWriteState{
+							Name:         n.stateId(),
+							ResourceType: n.Resource.Type,
+							Provider:     n.Resource.Provider,
+							Dependencies: n.StateDependencies(),
+							State:        &state,
+						},
+					},
+				},
+			},
+			&EvalOpFilter{
+				Ops: []walkOperation{walkPlan, walkPlanDestroy},
+				Node: &EvalSequence{
+					Nodes: []EvalNode{
+						&EvalGetProvider{
+							Name:   n.ProvidedBy()[0],
+							Output: &provider,
+						},
+						&EvalReadState{
+							Name:   n.stateId(),
+							Output: &state,
+						},
+						&EvalDiffDestroy{
+							Info:   info,
+							State:  &state,
+							Output: &diff,
+						},
+						&EvalCheckPreventDestroy{
+							Resource: n.Resource,
+							Diff:     &diff,
+						},
+						&EvalEstimateCost{
+							Info:     info,
+							Provider: &provider,
+							Diff:     &diff,
+						},
+						&EvalWriteDiff{
+							Name: n.stateId(),
+							Diff: &diff,
+						},
+					},
+				},
+			},
+			apply,
+		},
+	}
+}
+
+// graphNodeCanaryGate is the gate between the canary instance of a
+// resource and the rest of its instances. See EvalVerifyCanary.
+type graphNodeCanaryGate struct {
+	Canary *graphNodeExpandedResource
+	After  []string
+}
+
+func (n *graphNodeCanaryGate) Name() string {
+	return fmt.Sprintf("%s (canary)", n.Canary.Resource.Id())
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeCanaryGate) EvalTree() EvalNode {
+	var state *InstanceState
+
+	return &EvalOpFilter{
+		Ops: []walkOperation{walkApply},
+		Node: &EvalSequence{
+			Nodes: []EvalNode{
+				&EvalReadState{
+					Name:   n.Canary.stateId(),
+					Output: &state,
+				},
+				&EvalVerifyCanary{
+					Info:  n.Canary.instanceInfo(),
+					State: &state,
+					After: n.After,
+				},
+			},
+		},
+	}
+}
+
+// graphNodeRolloutGate is the gate between two waves of the instances of
+// a resource with a gradual rollout. See EvalRolloutGate.
+type graphNodeRolloutGate struct {
+	Resource *config.Resource
+	Wave     int
+	Waves    int
+	After    []string
+}
+
+func (n *graphNodeRolloutGate) Name() string {
+	return fmt.Sprintf("%s (rollout wave %d)", n.Resource.Id(), n.Wave)
+}
+
+// GraphNodeEvalable impl.
+func (n *graphNodeRolloutGate) EvalTree() EvalNode {
+	return &EvalOpFilter{
+		Ops: []walkOperation{walkApply},
+		Node: &EvalRolloutGate{
+			Name:    n.Resource.Id(),
+			Wave:    n.Wave,
+			Waves:   n.Waves,
+			Message: n.Resource.Lifecycle.RolloutPause,
+			After:   n.After,
+		},
+	}
 }
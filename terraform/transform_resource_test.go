@@ -1,6 +1,8 @@
 package terraform
 
 import (
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -37,6 +39,151 @@ func TestResourceCountTransformer_countNegative(t *testing.T) {
 	}
 }
 
+func TestResourceCountTransformer_countZero(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-zero").Config()
+	resource := cfg.Resources[0]
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+					"aws_instance.foo.2": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+					"aws_instance.foobar.0": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+				},
+			},
+		},
+	}
+
+	// Nothing to add unless destroying
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource, State: state}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if actual := strings.TrimSpace(g.String()); actual != "" {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	{
+		tf := &ResourceCountTransformer{
+			Resource: resource,
+			Destroy:  true,
+			State:    state,
+		}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	var ids []string
+	for _, v := range g.Vertices() {
+		n, ok := v.(*graphNodeExpandedResourceDestroy)
+		if !ok {
+			t.Fatalf("bad: %#v", v)
+		}
+		ids = append(ids, n.stateId())
+	}
+	sort.Strings(ids)
+
+	expected := []string{"aws_instance.foo", "aws_instance.foo.2"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("bad: %#v", ids)
+	}
+}
+
+func TestResourceCountTransformer_rollout(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-rollout").Config()
+	resource := cfg.Resources[0]
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testResourceCountTransformRolloutStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	for _, v := range g.Vertices() {
+		gate, ok := v.(*graphNodeRolloutGate)
+		if !ok || gate.Wave != 2 {
+			continue
+		}
+
+		if !reflect.DeepEqual(gate.After, []string{"aws_instance.foo.4"}) {
+			t.Fatalf("bad: %#v", gate.After)
+		}
+	}
+}
+
+func TestResourceCountTransformer_parallelism(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-parallelism").Config()
+	resource := cfg.Resources[0]
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testResourceCountTransformParallelismStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestResourceCountTransformer_reverseDestroy(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-reverse-destroy").Config()
+	resource := cfg.Resources[0]
+
+	// Only destroying is ordered
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testResourceCountTransformStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	g = Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource, Destroy: true}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	actual = strings.TrimSpace(g.String())
+	expected = strings.TrimSpace(testResourceCountTransformReverseDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
 func TestResourceCountTransformer_deps(t *testing.T) {
 	cfg := testModule(t, "transform-resource-count-deps").Config()
 	resource := cfg.Resources[0]
@@ -56,6 +203,108 @@ func TestResourceCountTransformer_deps(t *testing.T) {
 	}
 }
 
+func TestResourceCountTransformer_canary(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-canary").Config()
+	resource := cfg.Resources[0]
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testResourceCountTransformCanaryStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestResourceCountTransformer_canaryDeposed(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-canary").Config()
+	resource := cfg.Resources[0]
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: RootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.2": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+						Deposed: []*InstanceState{
+							&InstanceState{ID: "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// The deposed instances of the instances that wait on the canary
+	// wait too, instead of being destroyed with the other destroys
+	g := Graph{Path: RootModulePath}
+	tf := &ResourceCountTransformer{Resource: resource, State: state}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	if !strings.Contains(actual, "aws_instance.foo.2 (deposed #0)\n  aws_instance.foo (canary)") {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+
+	dg := Graph{Path: RootModulePath}
+	dt := &DeposedTransformer{
+		State:   state,
+		View:    resource.Id(),
+		Exclude: resourceDeferReplaceIds(resource),
+	}
+	if err := dt.Transform(&dg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(dg.Vertices()) != 0 {
+		t.Fatalf("bad:\n\n%s", dg.String())
+	}
+}
+
+func TestResourceCountTransformer_canaryCBD(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-canary").Config()
+	resource := cfg.Resources[0]
+	resource.Lifecycle.CreateBeforeDestroy = true
+
+	// The replacements are created before anything is destroyed, so the
+	// destroys don't need to wait on the canary
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testResourceCountTransformCanaryCBDStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestResourceCountTransformer_canaryIndex(t *testing.T) {
+	cfg := testModule(t, "transform-resource-count-canary").Config()
+	resource := cfg.Resources[0]
+	resource.Lifecycle.CanaryIndex = 3
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ResourceCountTransformer{Resource: resource}
+		if err := tf.Transform(&g); err == nil {
+			t.Fatal("should error")
+		}
+	}
+}
+
 const testResourceCountTransformStr = `
 aws_instance.foo #0
 aws_instance.foo #1
@@ -67,3 +316,74 @@ aws_instance.foo #0
 aws_instance.foo #1
   aws_instance.foo #0
 `
+
+const testResourceCountTransformRolloutStr = `
+aws_instance.foo #0
+aws_instance.foo #1
+aws_instance.foo #2
+  aws_instance.foo #2 (destroy)
+  aws_instance.foo (rollout wave 1)
+aws_instance.foo #2 (destroy)
+  aws_instance.foo (rollout wave 1)
+aws_instance.foo #3
+  aws_instance.foo #3 (destroy)
+  aws_instance.foo (rollout wave 1)
+aws_instance.foo #3 (destroy)
+  aws_instance.foo (rollout wave 1)
+aws_instance.foo #4
+  aws_instance.foo #4 (destroy)
+  aws_instance.foo (rollout wave 2)
+aws_instance.foo #4 (destroy)
+  aws_instance.foo (rollout wave 2)
+aws_instance.foo (rollout wave 1)
+  aws_instance.foo #0
+  aws_instance.foo #1
+aws_instance.foo (rollout wave 2)
+  aws_instance.foo #2
+  aws_instance.foo #3
+`
+
+const testResourceCountTransformParallelismStr = `
+aws_instance.foo #0
+aws_instance.foo #1
+aws_instance.foo #2
+  aws_instance.foo #0
+aws_instance.foo #3
+  aws_instance.foo #1
+aws_instance.foo #4
+  aws_instance.foo #2
+`
+
+const testResourceCountTransformReverseDestroyStr = `
+aws_instance.foo #0 (destroy)
+  aws_instance.foo #1 (destroy)
+aws_instance.foo #1 (destroy)
+  aws_instance.foo #2 (destroy)
+aws_instance.foo #2 (destroy)
+`
+
+const testResourceCountTransformCanaryStr = `
+aws_instance.foo #0
+  aws_instance.foo #0 (destroy)
+  aws_instance.foo (canary)
+aws_instance.foo #0 (destroy)
+  aws_instance.foo (canary)
+aws_instance.foo #1
+aws_instance.foo #2
+  aws_instance.foo #2 (destroy)
+  aws_instance.foo (canary)
+aws_instance.foo #2 (destroy)
+  aws_instance.foo (canary)
+aws_instance.foo (canary)
+  aws_instance.foo #1
+`
+
+const testResourceCountTransformCanaryCBDStr = `
+aws_instance.foo #0
+  aws_instance.foo (canary)
+aws_instance.foo #1
+aws_instance.foo #2
+  aws_instance.foo (canary)
+aws_instance.foo (canary)
+  aws_instance.foo #1
+`
@@ -0,0 +1,120 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/dag"
+)
+
+// GraphNodeStaged is an interface that nodes can implement to be placed
+// into a named stage. See StageTransformer.
+type GraphNodeStaged interface {
+	StageName() string
+}
+
+// StageTransformer is a GraphTransformer that orders the stages that
+// staged nodes belong to.
+//
+// Stages are applied in the order they're declared in, in the "stages"
+// of the "terraform" block of the root module: every node in a stage is
+// made to depend on every node in the stage with nodes before it, so
+// stages that have no dependencies between them are ordered too. Within
+// a stage, the normal dependencies and parallelism apply.
+//
+// It is an error for a node to be in a stage that isn't declared, or to
+// depend (directly or transitively) on a node in a later stage, since
+// the order of the stages can't be kept then.
+type StageTransformer struct {
+	// Stages are the names of the stages in the order they are applied.
+	Stages []string
+}
+
+func (t *StageTransformer) Transform(g *Graph) error {
+	order := make(map[string]int, len(t.Stages))
+	for i, name := range t.Stages {
+		order[name] = i
+	}
+
+	// Group the staged nodes by their stage
+	stages := make([][]dag.Vertex, len(t.Stages))
+	var err error
+	for _, v := range g.Vertices() {
+		sn, ok := v.(GraphNodeStaged)
+		if !ok {
+			continue
+		}
+
+		name := sn.StageName()
+		if name == "" {
+			continue
+		}
+
+		i, ok := order[name]
+		if !ok {
+			err = multierror.Append(err, fmt.Errorf(
+				"%s: stage %q isn't declared in the stages of the "+
+					"terraform block", dag.VertexName(v), name))
+			continue
+		}
+
+		stages[i] = append(stages[i], v)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A node can't depend on a node in a later stage, that would make a
+	// cycle with the order of the stages.
+	for i, vs := range stages {
+		for _, v := range vs {
+			deps, derr := g.Ancestors(v)
+			if derr != nil {
+				return derr
+			}
+
+			var later []string
+			for _, raw := range deps.List() {
+				sn, ok := raw.(GraphNodeStaged)
+				if !ok {
+					continue
+				}
+
+				if j, ok := order[sn.StageName()]; ok && j > i {
+					later = append(later, fmt.Sprintf(
+						"%s (stage %q)", dag.VertexName(raw), t.Stages[j]))
+				}
+			}
+			sort.Strings(later)
+
+			for _, dep := range later {
+				err = multierror.Append(err, fmt.Errorf(
+					"%s: stage %q can't depend on %s, which is in a "+
+						"later stage", dag.VertexName(v), t.Stages[i], dep))
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Every node in a stage depends on every node in the stage before
+	// it. The stages without nodes are skipped so that the order carries
+	// across them.
+	var prev []dag.Vertex
+	for _, vs := range stages {
+		if len(vs) == 0 {
+			continue
+		}
+
+		for _, source := range vs {
+			for _, target := range prev {
+				g.Connect(dag.BasicEdge(source, target))
+			}
+		}
+		prev = vs
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStageTransformer(t *testing.T) {
+	mod := testModule(t, "transform-stage-basic")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		tf := &StageTransformer{Stages: mod.Config().Terraform.Stages}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformStageBasicStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestStageTransformer_independent(t *testing.T) {
+	mod := testModule(t, "transform-stage-independent")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The stages don't depend on each other, but are still ordered
+	{
+		tf := &StageTransformer{Stages: mod.Config().Terraform.Stages}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformStageIndependentStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestStageTransformer_cycle(t *testing.T) {
+	mod := testModule(t, "transform-stage-cycle")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	tf := &StageTransformer{Stages: mod.Config().Terraform.Stages}
+	err := tf.Transform(&g)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `aws_instance.D: stage "one" can't depend on aws_instance.C (stage "two")`) {
+		t.Fatalf("bad: %s", err)
+	}
+	if strings.Contains(err.Error(), "aws_instance.B") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestStageTransformer_undeclared(t *testing.T) {
+	mod := testModule(t, "transform-stage-undeclared")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	tf := &StageTransformer{Stages: mod.Config().Terraform.Stages}
+	err := tf.Transform(&g)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `stage "two" isn't declared`) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+const testTransformStageBasicStr = `
+aws_db_instance.data
+  aws_subnet.net
+  aws_vpc.net
+aws_instance.app
+  aws_db_instance.data
+aws_instance.worker
+  aws_db_instance.data
+aws_subnet.net
+  aws_vpc.net
+aws_vpc.net
+`
+
+const testTransformStageIndependentStr = `
+aws_instance.first
+aws_instance.second
+  aws_instance.first
+aws_instance.third
+  aws_instance.second
+aws_instance.unstaged
+`
@@ -131,6 +131,11 @@ func (n *graphNodeTaintedResource) EvalTree() EvalNode {
 					State:  &state,
 					Output: &diff,
 				},
+				&EvalPreApply{
+					Info:  info,
+					State: &state,
+					Diff:  &diff,
+				},
 				&EvalApply{
 					Info:     info,
 					State:    &state,
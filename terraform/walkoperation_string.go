@@ -4,9 +4,9 @@ package terraform
 
 import "fmt"
 
-const _walkOperation_name = "walkInvalidwalkInputwalkApplywalkPlanwalkPlanDestroywalkRefreshwalkValidate"
+const _walkOperation_name = "walkInvalidwalkInputwalkApplywalkPlanwalkPlanDestroywalkRefreshwalkValidatewalkProvisionCheckwalkPreflight"
 
-var _walkOperation_index = [...]uint8{0, 11, 20, 29, 37, 52, 63, 75}
+var _walkOperation_index = [...]uint8{0, 11, 20, 29, 37, 52, 63, 75, 93, 106}
 
 func (i walkOperation) String() string {
 	if i >= walkOperation(len(_walkOperation_index)-1) {